@@ -3,6 +3,7 @@ package values
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,21 +11,114 @@ import (
 	"helm.sh/helm/v3/pkg/strvals"
 
 	"github.com/atframework/atdtool/internal/pkg/util"
+	yamlparser "github.com/atframework/atdtool/pkg/confparser/yaml"
 )
 
+// stdin is read by the values file "-", it is replaced in tests.
+var stdin io.Reader = os.Stdin
+
 type Options struct {
-	Values []string
-	Paths  []string
+	// ValueFiles are the yaml files of the values, "-" reads from stdin
+	ValueFiles   []string
+	Values       []string
+	StringValues []string
+	FileValues   []string
+	JSONValues   []string
+	// Paths are the values directories, the remote directories of
+	// https://host/values.tar.gz[//subdir] and git::<url>[//subdir][?ref=<ref>]
+	// are fetched into CacheDir
+	Paths []string
+	// Refresh fetches the remote directories again instead of using the cache
+	Refresh bool
+	// CacheDir is the cache of the remote directories, <user cache>/atdtool/values
+	// by default
+	CacheDir string
+	// ExpandEnv expands the ${ENV_VAR} and ${ENV_VAR:-default} placeholders in
+	// the string values of the values files
+	ExpandEnv bool
+	// Decrypt decrypts the SOPS-encrypted values files by the sops command
+	Decrypt bool
+	// ListMerge are the merge strategies of the lists, "<strategy>" for all the
+	// lists or "<key.path>=<strategy>" for a list
+	ListMerge []string
+}
+
+// ValuesOptions returns the options of loading the values files.
+func (opts *Options) ValuesOptions() yamlparser.ValuesOptions {
+	return yamlparser.ValuesOptions{ExpandEnv: opts.ExpandEnv, Decrypt: opts.Decrypt}
 }
 
+// MergeOptions returns the options of merging the chart values.
+func (opts *Options) MergeOptions() util.MergeOptions {
+	mergeOpts := util.MergeOptions{ValuesOptions: opts.ValuesOptions()}
+	for _, s := range opts.ListMerge {
+		if mergeOpts.ListMerge == nil {
+			mergeOpts.ListMerge = make(map[string]string)
+		}
+		if p, strategy, ok := strings.Cut(s, "="); ok {
+			mergeOpts.ListMerge[p] = strategy
+		} else {
+			mergeOpts.ListMerge[""] = s
+		}
+	}
+	return mergeOpts
+}
+
+// MergeValues merges the values of the command line in the same order as Helm,
+// the values files, --set-json, --set, --set-string and then --set-file, the
+// later ones override the former ones.
 func (opts *Options) MergeValues() (map[string]interface{}, error) {
 	base := make(map[string]interface{})
+	// User specified a values file via -f/--values-file
+	readStdin := false
+	for _, filePath := range opts.ValueFiles {
+		if filePath == "-" {
+			if readStdin {
+				return nil, fmt.Errorf("values file - (stdin) is specified more than once")
+			}
+			readStdin = true
+		}
+		currentMap, err := readValuesFile(filePath, opts.ValuesOptions())
+		if err != nil {
+			return nil, err
+		}
+		base = mergeMaps(base, currentMap)
+	}
+
+	// User specified a value via --set-json
+	for _, value := range opts.JSONValues {
+		if err := strvals.ParseJSON(value, base); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-json data %s: %v", value, err)
+		}
+	}
+
 	// User specified a value via --set
 	for _, value := range opts.Values {
 		if err := strvals.ParseInto(value, base); err != nil {
 			return nil, fmt.Errorf("failed parsing --set data: %v", err)
 		}
 	}
+
+	// User specified a value via --set-string
+	for _, value := range opts.StringValues {
+		if err := strvals.ParseIntoString(value, base); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-string data: %v", err)
+		}
+	}
+
+	// User specified a value via --set-file
+	for _, value := range opts.FileValues {
+		reader := func(rs []rune) (interface{}, error) {
+			data, err := os.ReadFile(util.LongPath(string(rs)))
+			if err != nil {
+				return nil, err
+			}
+			return string(data), nil
+		}
+		if err := strvals.ParseIntoFile(value, base, reader); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-file data: %v", err)
+		}
+	}
 	return base, nil
 }
 
@@ -35,6 +129,18 @@ func (opts *Options) MergePaths() ([]string, error) {
 		var path string = v
 		var err error
 
+		if src, ok, err := parseRemoteSource(v); ok {
+			if err == nil {
+				path, err = opts.fetchRemote(src)
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			paths = append(paths, path)
+			continue
+		}
+
 		if !filepath.IsAbs(path) {
 			if strings.HasPrefix(path, "~") {
 				path = strings.TrimPrefix(path, "~")
@@ -62,3 +168,48 @@ func (opts *Options) MergePaths() ([]string, error) {
 	}
 	return paths, errors.Join(errs...)
 }
+
+// readValuesFile reads the yaml values file, "-" reads from stdin. The numbers
+// are decoded as json.Number as the values of the directories.
+func readValuesFile(filePath string, valuesOpts yamlparser.ValuesOptions) (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	if filePath == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(util.LongPath(filePath))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading values file %s: %v", filePath, err)
+	}
+
+	var name string
+	if filePath != "-" {
+		name = util.LongPath(filePath)
+	}
+	currentMap, err := yamlparser.ParseValues(name, data, valuesOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing values file %s: %v", filePath, err)
+	}
+	return currentMap, nil
+}
+
+// mergeMaps merges b into a deeply, the values of b take precedence.
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k]; ok {
+				if bv, ok := bv.(map[string]interface{}); ok {
+					out[k] = mergeMaps(bv, v)
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
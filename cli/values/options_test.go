@@ -1,6 +1,8 @@
 package values
 
 import (
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -45,6 +47,45 @@ func TestOptionsMergeValues(t *testing.T) {
 		assert.Equal(t, "normal", first["name"])
 	})
 
+	t.Run("parse set-string set-file and set-json", func(t *testing.T) {
+		certFile := filepath.Join(t.TempDir(), "cert.pem")
+		if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----\nabc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		opts := &Options{
+			Values:       []string{"port=7001", "name=from-set"},
+			StringValues: []string{"version=1.10", "enabled=true"},
+			FileValues:   []string{"tls.cert=" + certFile},
+			JSONValues:   []string{`vector.sources=[{"name":"normal","ports":[1,2]}]`, `name="from-json"`},
+		}
+		got, err := opts.MergeValues()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, int64(7001), got["port"])
+		// --set overrides --set-json
+		assert.Equal(t, "from-set", got["name"])
+		assert.Equal(t, "1.10", got["version"])
+		assert.Equal(t, "true", got["enabled"])
+		assert.Equal(t, map[string]interface{}{"cert": "-----BEGIN CERTIFICATE-----\nabc\n"}, got["tls"])
+		assert.Equal(t, map[string]interface{}{
+			"sources": []interface{}{map[string]interface{}{"name": "normal", "ports": []interface{}{float64(1), float64(2)}}},
+		}, got["vector"])
+	})
+
+	t.Run("return error for invalid set-file and set-json", func(t *testing.T) {
+		_, err := (&Options{FileValues: []string{"cert=" + filepath.Join(t.TempDir(), "not-found")}}).MergeValues()
+		assert.ErrorContains(t, err, "failed parsing --set-file data")
+
+		_, err = (&Options{JSONValues: []string{"vector={invalid"}}).MergeValues()
+		assert.ErrorContains(t, err, "failed parsing --set-json data")
+
+		_, err = (&Options{StringValues: []string{"invalid"}}).MergeValues()
+		assert.ErrorContains(t, err, "failed parsing --set-string data")
+	})
+
 	t.Run("return error for invalid set syntax", func(t *testing.T) {
 		opts := &Options{Values: []string{"invalid"}}
 		_, err := opts.MergeValues()
@@ -120,3 +161,66 @@ func TestOptionsMergePaths(t *testing.T) {
 		assert.Contains(t, err.Error(), "missing-b")
 	})
 }
+
+func TestOptionsMergeValueFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.yaml")
+	if err := os.WriteFile(first, []byte("global:\n  log_level: INFO\n  world_id: 1\ngamesvr:\n  port: 7001\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("global:\n  log_level: DEBUG\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(r io.Reader) { stdin = r }(stdin)
+	stdin = strings.NewReader("gamesvr:\n  port: 7002\n  name: from-stdin\n")
+
+	opts := &Options{ValueFiles: []string{first, second, "-"}, Values: []string{"global.world_id=2"}}
+	got, err := opts.MergeValues()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the later files and --set take precedence
+	assert.Equal(t, map[string]interface{}{"log_level": "DEBUG", "world_id": int64(2)}, got["global"])
+	assert.Equal(t, map[string]interface{}{"port": json.Number("7002"), "name": "from-stdin"}, got["gamesvr"])
+
+	_, err = (&Options{ValueFiles: []string{"-", "-"}}).MergeValues()
+	assert.Error(t, err)
+	_, err = (&Options{ValueFiles: []string{filepath.Join(dir, "not-found.yaml")}}).MergeValues()
+	assert.ErrorContains(t, err, "failed reading values file")
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("a: 1\na: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Options{ValueFiles: []string{invalid}}).MergeValues()
+	assert.ErrorContains(t, err, "failed parsing values file")
+}
+
+func TestOptionsMergeValueFilesExpandEnv(t *testing.T) {
+	t.Setenv("VALUES_TEST_ENDPOINT", "https://dev.example.com")
+	name := filepath.Join(t.TempDir(), "values.yaml")
+	if err := os.WriteFile(name, []byte("endpoint: ${VALUES_TEST_ENDPOINT}\nregion: ${VALUES_TEST_REGION:-ap-guangzhou}\nport: 7001\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the placeholders are kept as they are by default
+	got, err := (&Options{ValueFiles: []string{name}}).MergeValues()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "${VALUES_TEST_ENDPOINT}", got["endpoint"])
+	}
+
+	got, err = (&Options{ValueFiles: []string{name}, ExpandEnv: true}).MergeValues()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://dev.example.com", got["endpoint"])
+		assert.Equal(t, "ap-guangzhou", got["region"])
+		assert.Equal(t, json.Number("7001"), got["port"])
+	}
+
+	if err := os.WriteFile(name, []byte("secret: ${VALUES_TEST_NOT_SET}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Options{ValueFiles: []string{name}, ExpandEnv: true}).MergeValues()
+	assert.ErrorContains(t, err, "VALUES_TEST_NOT_SET is not set")
+}
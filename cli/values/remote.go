@@ -0,0 +1,319 @@
+package values
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const (
+	// remoteTimeout is the timeout of fetching a remote values directory.
+	remoteTimeout = 5 * time.Minute
+	// maxArchiveSize is the max size of a downloaded values archive, the values
+	// directories are small, a larger response is likely a wrong url.
+	maxArchiveSize = 64 << 20
+)
+
+// gitSchemes are the url schemes of the git sources, the other transports of
+// git such as ext:: and file:// are not allowed.
+var gitSchemes = map[string]bool{"http": true, "https": true, "ssh": true, "git": true}
+
+// remoteSource is a values directory fetched at render time, the syntax is the
+// same as go-getter:
+//
+//	https://host/values.tar.gz[//subdir]          an archive of tar, tar.gz or zip
+//	git::https://host/repo.git[//subdir][?ref=v1]  a git repository
+type remoteSource struct {
+	raw    string
+	git    bool
+	url    string
+	ref    string
+	subdir string
+}
+
+// parseRemoteSource parses the remote values path, it returns false for the
+// local paths.
+func parseRemoteSource(s string) (*remoteSource, bool, error) {
+	src := &remoteSource{raw: s}
+	switch {
+	case strings.HasPrefix(s, "git::"):
+		src.git = true
+		s = strings.TrimPrefix(s, "git::")
+	case strings.HasPrefix(s, "https://"), strings.HasPrefix(s, "http://"):
+	default:
+		return nil, false, nil
+	}
+
+	var query string
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		s, query = s[:i], s[i+1:]
+	}
+	src.url, src.subdir = splitSubdir(s)
+	if src.git && query != "" {
+		q, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid values source(%s): %v", src.raw, err)
+		}
+		src.ref = q.Get("ref")
+		q.Del("ref")
+		query = q.Encode()
+	}
+	if query != "" {
+		src.url += "?" + query
+	}
+	if hasParentElem(src.subdir) {
+		return nil, true, fmt.Errorf("invalid subdir of values source(%s)", src.raw)
+	}
+	if src.git {
+		if err := checkGitSource(src); err != nil {
+			return nil, true, err
+		}
+	}
+	return src, true, nil
+}
+
+// checkGitSource rejects the url and ref which could be taken as options of the
+// git command, and the url schemes other than gitSchemes.
+func checkGitSource(src *remoteSource) error {
+	if strings.HasPrefix(src.url, "-") || strings.HasPrefix(src.ref, "-") {
+		return fmt.Errorf("invalid values source(%s): url and ref must not start with '-'", src.raw)
+	}
+	u, err := url.Parse(src.url)
+	if err != nil {
+		return fmt.Errorf("invalid values source(%s): %v", src.raw, err)
+	}
+	if !gitSchemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("invalid values source(%s): unsupported git url scheme %q", src.raw, u.Scheme)
+	}
+	return nil
+}
+
+// IsRemote reports whether the values path is fetched from a remote source.
+func IsRemote(s string) bool {
+	_, ok, _ := parseRemoteSource(s)
+	return ok
+}
+
+// splitSubdir splits the "//subdir" after the host of the url.
+func splitSubdir(s string) (string, string) {
+	start := 0
+	if i := strings.Index(s, "://"); i >= 0 {
+		start = i + 3
+	}
+	i := strings.Index(s[start:], "//")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:start+i], strings.Trim(s[start+i+2:], "/")
+}
+
+// fetchRemote returns the local directory of the remote source. The source is
+// fetched into the cache directory once, and again if Refresh is set.
+func (opts *Options) fetchRemote(src *remoteSource) (string, error) {
+	cacheRoot := opts.CacheDir
+	if cacheRoot == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", fmt.Errorf("find cache directory of values source(%s): %v", src.raw, err)
+		}
+		cacheRoot = filepath.Join(userCache, "atdtool", "values")
+	}
+
+	sum := sha256.Sum256([]byte(src.raw))
+	key := hex.EncodeToString(sum[:16])
+	dir := filepath.Join(cacheRoot, key)
+	if opts.Refresh || !util.PathExist(dir) {
+		if err := os.MkdirAll(cacheRoot, os.ModePerm); err != nil {
+			return "", fmt.Errorf("make cache directory(%s): %v", cacheRoot, err)
+		}
+		tmp, err := os.MkdirTemp(cacheRoot, key+".tmp")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(tmp)
+
+		if src.git {
+			err = fetchGit(src, tmp)
+		} else {
+			err = fetchArchive(src, tmp)
+		}
+		if err != nil {
+			return "", fmt.Errorf("fetch values source(%s): %v", src.raw, err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return "", err
+		}
+		if err := os.Rename(tmp, dir); err != nil {
+			return "", err
+		}
+	}
+
+	target := filepath.Join(dir, filepath.FromSlash(src.subdir))
+	if !util.PathExist(target) {
+		return "", fmt.Errorf("subdir(%s) of values source(%s) is not exist", src.subdir, src.raw)
+	}
+	return target, nil
+}
+
+// fetchGit fetches the ref of the repository by the git command, so that the
+// credentials of the user are used. The ref could be a branch, a tag or a commit.
+func fetchGit(src *remoteSource, dir string) error {
+	ref := src.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// the positional arguments follow "--", so that they are never parsed as
+	// options
+	for _, step := range []struct {
+		name string
+		args []string
+	}{
+		{"init", []string{"init", "-q", "--", dir}},
+		{"fetch", []string{"-C", dir, "fetch", "-q", "--depth", "1", "--", src.url, ref}},
+		{"checkout", []string{"-C", dir, "checkout", "-q", "FETCH_HEAD", "--"}},
+	} {
+		cmd := exec.Command("git", step.args...)
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %v: %s", step.name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return os.RemoveAll(filepath.Join(dir, ".git"))
+}
+
+// fetchArchive downloads the archive and extracts it into the directory, the
+// format is detected by the content.
+func fetchArchive(src *remoteSource, dir string) error {
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Get(src.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxArchiveSize {
+		return fmt.Errorf("archive is larger than %d bytes", maxArchiveSize)
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return extractTar(zr, dir)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return extractZip(data, dir)
+	case len(data) > 262 && string(data[257:262]) == "ustar":
+		return extractTar(bytes.NewReader(data), dir)
+	default:
+		return fmt.Errorf("unsupported archive, should be tar, tar.gz or zip")
+	}
+}
+
+// archivePath returns the local path of the archive entry, the entries out of
+// the directory are rejected.
+func archivePath(dir, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean("/" + name)
+	if hasParentElem(name) || clean == "/" {
+		return "", fmt.Errorf("invalid archive entry: %s", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// hasParentElem checks whether the slash separated path contains "..".
+func hasParentElem(name string) bool {
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func writeArchiveFile(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := archivePath(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		if err := writeArchiveFile(target, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(data []byte, dir string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		target, err := archivePath(dir, f.Name)
+		if err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(target, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
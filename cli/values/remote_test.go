@@ -0,0 +1,184 @@
+package values
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRemoteSource(t *testing.T) {
+	tests := []struct {
+		in     string
+		remote bool
+		git    bool
+		url    string
+		ref    string
+		subdir string
+	}{
+		{"./values/prod", false, false, "", "", ""},
+		{"https://cfg.example.com/values.tar.gz", true, false, "https://cfg.example.com/values.tar.gz", "", ""},
+		{"https://cfg.example.com/values.tar.gz//prod/?token=abc", true, false, "https://cfg.example.com/values.tar.gz?token=abc", "", "prod"},
+		{"git::https://git.example.com/ops/values.git//env/prod?ref=v1.2", true, true, "https://git.example.com/ops/values.git", "v1.2", "env/prod"},
+		{"git::ssh://git@git.example.com/ops/values.git", true, true, "ssh://git@git.example.com/ops/values.git", "", ""},
+	}
+	for _, tt := range tests {
+		src, ok, err := parseRemoteSource(tt.in)
+		if !assert.NoError(t, err, tt.in) || !assert.Equal(t, tt.remote, ok, tt.in) || !ok {
+			continue
+		}
+		assert.Equal(t, tt.git, src.git, tt.in)
+		assert.Equal(t, tt.url, src.url, tt.in)
+		assert.Equal(t, tt.ref, src.ref, tt.in)
+		assert.Equal(t, tt.subdir, src.subdir, tt.in)
+	}
+
+	for _, in := range []string{
+		"https://cfg.example.com/values.tar.gz//../etc",
+		"git::--upload-pack=touch /tmp/pwned//x",
+		"git::https://git.example.com/ops/values.git?ref=--upload-pack=touch%20/tmp/pwned",
+		"git::ext::sh -c touch% /tmp/pwned",
+		"git::file:///srv/values.git",
+	} {
+		_, _, err := parseRemoteSource(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func tarGzArchive(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestMergePathsHTTP(t *testing.T) {
+	var hits atomic.Int32
+	archive := tarGzArchive(t, map[string]string{"prod/global.yaml": "log_level: INFO\n"})
+	zipBuf := &bytes.Buffer{}
+	zw := zip.NewWriter(zipBuf)
+	f, _ := zw.Create("global.yaml")
+	_, _ = f.Write([]byte("log_level: DEBUG\n"))
+	_ = zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/values.tar.gz":
+			_, _ = w.Write(archive)
+		case "/values.zip":
+			_, _ = w.Write(zipBuf.Bytes())
+		case "/evil.tar.gz":
+			_, _ = w.Write(tarGzArchive(t, map[string]string{"../evil.yaml": "a: 1\n"}))
+		case "/plain":
+			_, _ = w.Write([]byte("log_level: INFO\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	opts := &Options{Paths: []string{srv.URL + "/values.tar.gz//prod", srv.URL + "/values.zip"}, CacheDir: cacheDir}
+	paths, err := opts.MergePaths()
+	if !assert.NoError(t, err) || !assert.Len(t, paths, 2) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(paths[0], "global.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "log_level: INFO\n", string(data))
+	data, err = os.ReadFile(filepath.Join(paths[1], "global.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "log_level: DEBUG\n", string(data))
+	assert.Equal(t, int32(2), hits.Load())
+
+	// the cache is used until refreshed
+	again, err := opts.MergePaths()
+	assert.NoError(t, err)
+	assert.Equal(t, paths, again)
+	assert.Equal(t, int32(2), hits.Load())
+
+	opts.Refresh = true
+	_, err = opts.MergePaths()
+	assert.NoError(t, err)
+	assert.Equal(t, int32(4), hits.Load())
+
+	for _, p := range []string{"/values.tar.gz//staging", "/evil.tar.gz", "/plain", "/not-found.tar.gz"} {
+		_, err := (&Options{Paths: []string{srv.URL + p}, CacheDir: cacheDir}).MergePaths()
+		assert.Error(t, err, p)
+	}
+	assert.NoFileExists(t, filepath.Join(cacheDir, "evil.yaml"))
+}
+
+func TestMergePathsGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	if err := os.MkdirAll(filepath.Join(repo, "env", "prod"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "env", "prod", "global.yaml"), []byte("log_level: INFO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+	if err := os.WriteFile(filepath.Join(repo, "env", "prod", "global.yaml"), []byte("log_level: DEBUG\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("commit", "-q", "-am", "v2")
+
+	cacheDir := t.TempDir()
+	read := func(source string) string {
+		paths, err := (&Options{Paths: []string{source}, CacheDir: cacheDir, Refresh: true}).MergePaths()
+		if !assert.NoError(t, err) || !assert.Len(t, paths, 1) {
+			return ""
+		}
+		assert.NoDirExists(t, filepath.Join(paths[0], ".git"))
+		data, _ := os.ReadFile(filepath.Join(paths[0], "global.yaml"))
+		return string(data)
+	}
+	// file:// is not an allowed scheme, the git url is rewritten to the local
+	// repository by the config of git
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "url.file://"+filepath.ToSlash(repo)+".insteadOf")
+	t.Setenv("GIT_CONFIG_VALUE_0", "git://git.example.com/ops/values.git")
+	url := "git::git://git.example.com/ops/values.git"
+	assert.Equal(t, "log_level: DEBUG\n", read(url+"//env/prod"))
+	assert.Equal(t, "log_level: INFO\n", read(url+"//env/prod?ref=v1"))
+
+	_, err := (&Options{Paths: []string{url + "?ref=nonexistence"}, CacheDir: cacheDir}).MergePaths()
+	assert.Error(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"time"
 
 	"github.com/atframework/atdtool/cli/values"
 	"github.com/spf13/cobra"
@@ -18,6 +19,12 @@ var (
 Common actions for atdtool:
 
 - atdtool template:      Render custom chart templates
+- atdtool diff:          Show the changes of the rendered configuration
+- atdtool guid:          Generate the unique ids, 'guid decode' decodes them
+- atdtool init env:      Create the values directory of a new environment
+- atdtool zone add:      Add a zone into the deploy configuration
+- atdtool bench template: Measure the rendering throughput of the charts
+- atdtool compress bench: Measure the compression ratio and the throughput of a file
 `
 )
 
@@ -27,8 +34,16 @@ func ToolName() string {
 }
 
 func addValueOptionsFlags(f *pflag.FlagSet, v *values.Options) {
-	f.StringSliceVarP(&v.Paths, "values", "p", []string{}, "set values path on the command line (can specify multiple paths with commas:path1,path2)")
+	f.StringSliceVarP(&v.Paths, "values", "p", []string{}, "set values path on the command line, https:// archives and git:: repositories are fetched (can specify multiple paths with commas:path1,path2)")
+	f.BoolVar(&v.Refresh, "refresh", false, "fetch the remote values paths (https:// and git::) again instead of using the cache")
+	f.BoolVar(&v.ExpandEnv, "expand-env", false, "expand ${ENV_NAME} and ${ENV_NAME:-default} in the string values of the values files")
+	f.BoolVar(&v.Decrypt, "decrypt", false, "decrypt the SOPS-encrypted values files by the sops command, which could be specified by $ATDTOOL_SOPS")
+	f.StringArrayVar(&v.ListMerge, "list-merge", []string{}, "merge strategy of the lists in the values: replace, append or merge-by-key[:<key>], for all the lists or a list by <key.path>=<strategy> (can specify multiple)")
+	f.StringSliceVarP(&v.ValueFiles, "values-file", "f", []string{}, "specify values in a YAML file, '-' reads from stdin (can specify multiple)")
 	f.StringArrayVarP(&v.Values, "set", "s", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&v.StringValues, "set-string", []string{}, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&v.FileValues, "set-file", []string{}, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+	f.StringArrayVar(&v.JSONValues, "set-json", []string{}, "set JSON values on the command line (can specify multiple or separate values with commas: key1=jsonval1,key2=jsonval2)")
 }
 
 func newRootCmd(out io.Writer, args []string) (*cobra.Command, error) {
@@ -47,9 +62,18 @@ func newRootCmd(out io.Writer, args []string) (*cobra.Command, error) {
 	cmd.AddCommand(
 		newVersionCmd(out),
 		newTemplateCmd(out),
+		newDiffCmd(out),
 		newMergeValuesCmd(out),
+		newExplainValueCmd(out),
 		newWatchCmd(out),
 		newExecCmd(out),
+		newInitCmd(out),
+		newCreateCmd(out),
+		newDependencyCmd(out),
+		newZoneCmd(out),
+		newBenchCmd(out),
+		newCompressCmd(out),
+		newGuidCmd(out),
 	)
 
 	return cmd, nil
@@ -62,7 +86,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := cmd.Execute(); err != nil {
+	begin := time.Now()
+	executed, err := cmd.ExecuteC()
+	reportTelemetry(executed, time.Since(begin), err)
+
+	if err != nil {
 		out.WriteTo(os.Stderr)
 		os.Exit(1)
 	}
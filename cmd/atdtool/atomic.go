@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// atomicOutput renders into a staging copy of the output directory, which is
+// swapped into place when the render succeeds, so that a failed render never
+// leaves the output half old and half new.
+type atomicOutput struct {
+	root    string
+	staging string
+	// backups is the number of the previous trees retained after the swap
+	backups int
+}
+
+// beginAtomicOutput creates the staging directory beside the output directory
+// root, the existing files are copied into it, so that the incremental render
+// and the instances not rendered keep their files.
+func beginAtomicOutput(root string, backups int) (*atomicOutput, error) {
+	if backups < 0 {
+		return nil, fmt.Errorf("invalid atomic backups: %d", backups)
+	}
+
+	root = filepath.Clean(root)
+	parent := filepath.Dir(root)
+	if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+		return nil, err
+	}
+	// the staging directory is on the same file system to be renamed
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(root)+".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging output: %v", err)
+	}
+
+	a := &atomicOutput{root: root, staging: staging, backups: backups}
+	// the staging directory is private, it takes the mode of the output
+	if err := os.Chmod(staging, 0755); err != nil {
+		a.rollback()
+		return nil, err
+	}
+	if util.PathExist(root) {
+		if err := copyTree(root, staging); err != nil {
+			a.rollback()
+			return nil, fmt.Errorf("copy output(%s) into staging: %v", root, err)
+		}
+	}
+	return a, nil
+}
+
+// backupPrefix is the prefix of the names of the previous trees.
+func (a *atomicOutput) backupPrefix() string {
+	return "." + filepath.Base(a.root) + ".bak-"
+}
+
+// finish swaps the staging directory into place if err is nil, otherwise the
+// staging directory is removed and the output is kept as it was.
+func (a *atomicOutput) finish(err error) error {
+	if err != nil {
+		a.rollback()
+		return err
+	}
+
+	parent := filepath.Dir(a.root)
+	var backup string
+	if util.PathExist(a.root) {
+		backup = filepath.Join(parent, a.backupPrefix()+time.Now().UTC().Format("20060102T150405.000000000"))
+		if err := os.Rename(a.root, backup); err != nil {
+			a.rollback()
+			return fmt.Errorf("move output(%s) aside: %v", a.root, err)
+		}
+	}
+	if err := os.Rename(a.staging, a.root); err != nil {
+		// restore the previous tree
+		if backup != "" {
+			if rerr := os.Rename(backup, a.root); rerr != nil {
+				return fmt.Errorf("swap output(%s): %v, and restore it from %s: %v", a.root, err, backup, rerr)
+			}
+		}
+		a.rollback()
+		return fmt.Errorf("swap output(%s): %v", a.root, err)
+	}
+	return a.pruneBackups()
+}
+
+// rollback removes the staging directory.
+func (a *atomicOutput) rollback() {
+	_ = os.RemoveAll(a.staging)
+}
+
+// pruneBackups removes the oldest previous trees beyond the retained count.
+func (a *atomicOutput) pruneBackups() error {
+	parent := filepath.Dir(a.root)
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), a.backupPrefix()) {
+			names = append(names, e.Name())
+		}
+	}
+	// the timestamps of the names are in order
+	sort.Strings(names)
+	for len(names) > a.backups {
+		if err := os.RemoveAll(filepath.Join(parent, names[0])); err != nil {
+			return fmt.Errorf("remove output backup: %v", err)
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// copyTree copies the files, directories and symbolic links of src into dst
+// with their modes.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(util.LongPath(target), info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(util.LongPath(target), info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(p, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(util.LongPath(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(util.LongPath(dst), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+// siblings returns the names of the hidden directories beside dir.
+func siblings(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestTemplateOptionsRunAtomic(t *testing.T) {
+	chartsDir := t.TempDir()
+	if err := copyDir(fixturePath("charts"), chartsDir); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "output")
+	if err := os.MkdirAll(filepath.Join(outDir, "other"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// the files not rendered are kept
+	if err := os.WriteFile(filepath.Join(outDir, "other", "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newOptions := func() *templateOptions {
+		return &templateOptions{
+			chartPath:     chartsDir,
+			outPath:       outDir,
+			atomic:        true,
+			atomicBackups: 1,
+			validate:      true,
+			valOpts:       values.Options{Paths: []string{fixturePath("values", "default")}},
+		}
+	}
+	if !assert.NoError(t, newOptions().run(&bytes.Buffer{})) {
+		return
+	}
+	rendered := filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml")
+	assert.FileExists(t, rendered)
+	assert.FileExists(t, filepath.Join(outDir, "other", "keep.txt"))
+	backups := siblings(t, outDir)
+	if assert.Len(t, backups, 1) {
+		assert.True(t, strings.HasPrefix(backups[0], ".output.bak-"))
+	}
+	before, err := os.ReadFile(rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed render keeps the output as it was
+	tpl := filepath.Join(chartsDir, "echo", "cfg", "echo.yaml.tpl")
+	if err := os.WriteFile(tpl, []byte("a: 1\na: {{ .Values.bus_addr }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorContains(t, newOptions().run(&bytes.Buffer{}), "invalid yaml")
+	after, err := os.ReadFile(rendered)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(before), string(after))
+	}
+	assert.Equal(t, backups, siblings(t, outDir))
+
+	// only the latest backups are retained
+	if err := os.WriteFile(tpl, []byte("b: {{ .Values.bus_addr }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NoError(t, newOptions().run(&bytes.Buffer{})) {
+		return
+	}
+	after, err = os.ReadFile(rendered)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "b: 1.2.42.3\n", string(after))
+	}
+	latest := siblings(t, outDir)
+	if assert.Len(t, latest, 1) {
+		assert.NotEqual(t, backups[0], latest[0])
+		old, err := os.ReadFile(filepath.Join(filepath.Dir(outDir), latest[0], "echo", "cfg", "echo_1.2.42.3.yaml"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, string(before), string(old))
+		}
+	}
+
+	o := newOptions()
+	o.outPath = ""
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "--atomic requires --output")
+}
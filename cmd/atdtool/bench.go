@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/cli/values"
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const benchTemplateDesc = `
+Measure the rendering throughput of the charts.
+
+The instances are generated from the deploy configuration of the values like
+'template', the charts take turns and the instance ids keep increasing from the
+start instance id, so that '--instances' is not limited by the instance count.
+
+The time of each stage is measured separately:
+
+    chart load      load the chart and parse the templates, once for each chart
+                    unless '--no-cache' is specified
+    values merge    merge the values of the instance
+    render          execute the templates into memory
+    write           write the rendered files into the output
+
+The files are written into a temporary directory which is removed after the
+benchmark, unless '--output' is specified. The report is printed as text or as
+json by '--format' for comparing in CI.
+`
+
+// benchStages are the stages of rendering an instance in order.
+var benchStages = []string{"chart load", "values merge", "render", "write"}
+
+type benchTemplateOptions struct {
+	chartPath string
+	outPath   string
+	valOpts   values.Options
+	instances int
+	noCache   bool
+	format    string
+	// templateExt are the extensions of the templates
+	templateExt []string
+}
+
+// benchStage is the time spent by a stage of all instances.
+type benchStage struct {
+	Name        string        `json:"name"`
+	Total       time.Duration `json:"totalNs"`
+	PerInstance time.Duration `json:"perInstanceNs"`
+}
+
+// benchReport is the result of a benchmark.
+type benchReport struct {
+	Instances  int           `json:"instances"`
+	Files      int           `json:"files"`
+	Total      time.Duration `json:"totalNs"`
+	Throughput float64       `json:"instancesPerSecond"`
+	// AllocBytes and Allocs are the memory allocated by the benchmark
+	AllocBytes uint64        `json:"allocBytes"`
+	Allocs     uint64        `json:"allocs"`
+	SysBytes   uint64        `json:"sysBytes"`
+	Stages     []*benchStage `json:"stages"`
+}
+
+// benchInstance is an instance to render.
+type benchInstance struct {
+	target     *noncloudnative.DeployTarget
+	unit       *noncloudnative.DeployUnit
+	instanceID uint64
+}
+
+func newBenchCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure the performance of atdtool",
+		Args:  require.NoArgs,
+	}
+	cmd.AddCommand(newBenchTemplateCmd(out))
+	return cmd
+}
+
+func newBenchTemplateCmd(out io.Writer) *cobra.Command {
+	o := &benchTemplateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "template [CHART]",
+		Short: "Measure the rendering throughput of the charts",
+		Long:  benchTemplateDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartPath = args[0]
+			return o.run(out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	addValueOptionsFlags(f, &o.valOpts)
+	f.IntVarP(&o.instances, "instances", "n", 100, "number of the instances to render")
+	f.StringVarP(&o.outPath, "output", "o", "", "specify templates rendered result save path, a temporary directory is used if it is empty")
+	f.BoolVar(&o.noCache, "no-cache", false, "load the chart for each instance instead of sharing it")
+	f.StringSliceVar(&o.templateExt, "template-ext", []string{".tpl", ".template"}, "extensions of the files rendered as the templates, .tpl and .template are trimmed from the output file names")
+	f.StringVar(&o.format, "format", "text", "output format of the report, text or json")
+	return cmd
+}
+
+func (o *benchTemplateOptions) run(out io.Writer) error {
+	if o.instances <= 0 {
+		return fmt.Errorf("invalid instances: %d", o.instances)
+	}
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("invalid output format: %s, should be text or json", o.format)
+	}
+
+	exts, err := parseTemplateExts(o.templateExt)
+	if err != nil {
+		return err
+	}
+
+	valuePaths, err := o.valOpts.MergePaths()
+	if err != nil {
+		return err
+	}
+	optVals, err := o.valOpts.MergeValues()
+	if err != nil {
+		return err
+	}
+
+	nonCloudNativeCfg, err := noncloudnative.LoadConfig(valuePaths)
+	if err != nil {
+		return fmt.Errorf("load noncloudnative configuration: %v", err)
+	}
+	instances, err := benchInstances(nonCloudNativeCfg, o.instances)
+	if err != nil {
+		return err
+	}
+
+	outPath := o.outPath
+	if outPath == "" {
+		if outPath, err = os.MkdirTemp("", "atdtool-bench-"); err != nil {
+			return err
+		}
+		defer os.RemoveAll(outPath)
+	}
+	writer, err := newOutputWriter(outPath)
+	if err != nil {
+		return err
+	}
+
+	report := &benchReport{Instances: len(instances)}
+	for _, name := range benchStages {
+		report.Stages = append(report.Stages, &benchStage{Name: name})
+	}
+	stage := func(i int, begin time.Time) {
+		report.Stages[i].Total += time.Since(begin)
+	}
+
+	renderers := make(map[string]*chartRenderer)
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for _, inst := range instances {
+		chartPath := filepath.Join(o.chartPath, inst.unit.Name)
+		busAddr := inst.target.BusAddr(inst.unit, inst.instanceID)
+
+		begin := time.Now()
+		r, ok := renderers[chartPath]
+		if !ok {
+			if r, err = newChartRenderer(chartPath, nonCloudNativeCfg, exts); err != nil {
+				return err
+			}
+			if !o.noCache {
+				renderers[chartPath] = r
+			}
+		}
+		stage(0, begin)
+
+		begin = time.Now()
+		copyOptVals, err := instanceOptValues(optVals, inst.unit)
+		if err != nil {
+			return err
+		}
+		vals, err := util.MergeChartValues(chartPath, valuePaths, o.valOpts.MergeOptions(), copyOptVals, &noncloudnative.RenderValue{
+			BusAddr: busAddr,
+			Config:  nonCloudNativeCfg,
+		})
+		if err != nil {
+			return err
+		}
+		stage(1, begin)
+
+		begin = time.Now()
+		mw := &memoryWriter{}
+		if err := r.render(vals, mw, inst.unit.Name, fmt.Sprintf("_%s", busAddr)); err != nil {
+			return err
+		}
+		stage(2, begin)
+
+		begin = time.Now()
+		if err := mw.writeTo(writer); err != nil {
+			return err
+		}
+		stage(3, begin)
+		report.Files += len(mw.files)
+	}
+
+	report.Total = time.Since(start)
+	runtime.ReadMemStats(&after)
+	report.AllocBytes = after.TotalAlloc - before.TotalAlloc
+	report.Allocs = after.Mallocs - before.Mallocs
+	report.SysBytes = after.Sys
+	if report.Total > 0 {
+		report.Throughput = float64(report.Instances) / report.Total.Seconds()
+	}
+	for _, s := range report.Stages {
+		s.PerInstance = s.Total / time.Duration(report.Instances)
+	}
+
+	if o.format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	report.print(out)
+	return nil
+}
+
+// benchInstances generates n instances from the deploy targets, the charts of
+// the targets take turns and the instance ids keep increasing.
+func benchInstances(cfg *noncloudnative.Config, n int) ([]benchInstance, error) {
+	targets, err := cfg.Deploy.Targets()
+	if err != nil {
+		return nil, fmt.Errorf("load noncloudnative deploy targets: %v", err)
+	}
+
+	var units []benchInstance
+	for _, target := range targets {
+		for _, unit := range target.Instance {
+			units = append(units, benchInstance{target: target, unit: unit, instanceID: unit.StartInstanceId})
+		}
+	}
+	if len(units) == 0 {
+		return nil, fmt.Errorf("no instance is deployed")
+	}
+
+	instances := make([]benchInstance, 0, n)
+	for i := 0; i < n; i++ {
+		inst := units[i%len(units)]
+		inst.instanceID += uint64(i / len(units))
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+func (r *benchReport) print(out io.Writer) {
+	fmt.Fprintf(out, "instances:   %d\n", r.Instances)
+	fmt.Fprintf(out, "files:       %d\n", r.Files)
+	fmt.Fprintf(out, "total:       %v\n", r.Total)
+	fmt.Fprintf(out, "throughput:  %.1f instances/s\n", r.Throughput)
+	fmt.Fprintf(out, "allocated:   %d bytes, %d allocs (%d bytes/instance)\n", r.AllocBytes, r.Allocs, r.AllocBytes/uint64(r.Instances))
+	fmt.Fprintf(out, "sys:         %d bytes\n", r.SysBytes)
+	fmt.Fprintf(out, "\n%-14s %14s %14s\n", "stage", "total", "per instance")
+	for _, s := range r.Stages {
+		fmt.Fprintf(out, "%-14s %14v %14v\n", s.Name, s.Total, s.PerInstance)
+	}
+}
+
+// memoryWriter holds the rendered files in memory, so that the rendering and
+// the writing are measured separately.
+type memoryWriter struct {
+	names []string
+	files map[string]*bytes.Buffer
+}
+
+func (w *memoryWriter) Create(name string) (io.WriteCloser, error) {
+	if w.files == nil {
+		w.files = make(map[string]*bytes.Buffer)
+	}
+	buf, ok := w.files[name]
+	if !ok {
+		w.names = append(w.names, name)
+		buf = &bytes.Buffer{}
+		w.files[name] = buf
+	}
+	buf.Reset()
+	return nopWriteCloser{buf}, nil
+}
+
+func (w *memoryWriter) LocalPath() string {
+	return ""
+}
+
+// writeTo writes the files into the output.
+func (w *memoryWriter) writeTo(out outputWriter) error {
+	for _, name := range w.names {
+		f, err := out.Create(name)
+		if err != nil {
+			return fmt.Errorf("create configuration file(%s): %v", name, err)
+		}
+		if _, err := w.files[name].WriteTo(f); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("write config file(%s): %v", name, err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("close config file(%s): %v", name, err)
+		}
+	}
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestBenchTemplateRun(t *testing.T) {
+	outDir := t.TempDir()
+	stdout := &bytes.Buffer{}
+	o := &benchTemplateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+		instances: 5,
+		format:    "json",
+	}
+
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+
+	report := &benchReport{}
+	if !assert.NoError(t, json.Unmarshal(stdout.Bytes(), report)) {
+		return
+	}
+	assert.Equal(t, 5, report.Instances)
+	assert.Equal(t, 10, report.Files)
+	if assert.Len(t, report.Stages, len(benchStages)) {
+		for i, s := range report.Stages {
+			assert.Equal(t, benchStages[i], s.Name)
+		}
+	}
+
+	// the instance ids keep increasing beyond the instance count
+	assert.FileExists(t, filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.7.yaml"))
+}
+
+func TestBenchTemplateRunInvalidOptions(t *testing.T) {
+	o := &benchTemplateOptions{chartPath: fixturePath("charts"), instances: 0, format: "text"}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+
+	o = &benchTemplateOptions{chartPath: fixturePath("charts"), instances: 1, format: "yaml"}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+const compressBenchDesc = `
+Measure the compression ratio and the throughput of a file with each supported
+algorithm and level.
+
+The whole file is compressed if it is not larger than '--sample-size', or the
+chunks read evenly from the file are compressed as the sample. The algorithm
+selected by 'compress: auto' of the upload rule of log-archive is marked, which
+is the best ratio among the ones not slower than '--min-throughput', or the
+fastest one if all of them are slower.
+
+The throughput depends on the CPU, run it on the machine uploading the files.
+`
+
+type compressBenchOptions struct {
+	path          string
+	sampleSize    int64
+	minThroughput float64
+	format        string
+}
+
+// compressBenchResult is the result of an algorithm and a level.
+type compressBenchResult struct {
+	compress.ProbeResult
+	Ratio      float64 `json:"ratio"`
+	Throughput float64 `json:"bytesPerSecond"`
+	Selected   bool    `json:"selected,omitempty"`
+}
+
+// compressBenchReport is the result of the compression benchmark.
+type compressBenchReport struct {
+	File    string                 `json:"file"`
+	Results []*compressBenchResult `json:"results"`
+}
+
+func newCompressCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compress",
+		Short: "Measure the compression of the files",
+		Args:  require.NoArgs,
+	}
+	cmd.AddCommand(newCompressBenchCmd(out))
+	return cmd
+}
+
+func newCompressBenchCmd(out io.Writer) *cobra.Command {
+	o := &compressBenchOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "bench PATH",
+		Short: "Measure the compression ratio and the throughput of a file",
+		Long:  compressBenchDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.path = args[0]
+			return o.run(out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	f.Int64Var(&o.sampleSize, "sample-size", compress.DefaultProbeSampleSize, "max size of the sample read from the file")
+	f.Float64Var(&o.minThroughput, "min-throughput", compress.DefaultProbeMinThroughput>>20, "min throughput in MB/s of the selected algorithm")
+	f.StringVar(&o.format, "format", "text", "output format of the report, text or json")
+	return cmd
+}
+
+func (o *compressBenchOptions) run(out io.Writer) error {
+	if o.sampleSize <= 0 {
+		return fmt.Errorf("invalid sample size: %d", o.sampleSize)
+	}
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("invalid output format: %s, should be text or json", o.format)
+	}
+
+	results, err := compress.Probe(o.path, compress.ProbeOptions{SampleSize: o.sampleSize})
+	if err != nil {
+		return fmt.Errorf("probe compression of %s: %v", o.path, err)
+	}
+	selected, _ := compress.Select(results, o.minThroughput*(1<<20))
+
+	report := &compressBenchReport{File: o.path}
+	for _, r := range results {
+		report.Results = append(report.Results, &compressBenchResult{
+			ProbeResult: r,
+			Ratio:       r.Ratio(),
+			Throughput:  r.Throughput(),
+			Selected:    r.ProbeCandidate == selected.ProbeCandidate,
+		})
+	}
+
+	if o.format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	report.print(out)
+	return nil
+}
+
+func (r *compressBenchReport) print(out io.Writer) {
+	fmt.Fprintf(out, "file:    %s\n", r.File)
+	if len(r.Results) > 0 {
+		fmt.Fprintf(out, "sample:  %d bytes\n", r.Results[0].Size)
+	}
+	fmt.Fprintf(out, "\n%-10s %-8s %14s %8s %14s\n", "algorithm", "level", "compressed", "ratio", "throughput")
+	for _, res := range r.Results {
+		level := "-"
+		if res.Level != 0 {
+			level = res.Level.String()
+		}
+		mark := ""
+		if res.Selected {
+			mark = "  *"
+		}
+		fmt.Fprintf(out, "%-10s %-8s %14d %8.2f %9.1f MB/s%s\n", res.Algorithm, level, res.CompressedSize, res.Ratio, res.Throughput/(1<<20), mark)
+	}
+	fmt.Fprintf(out, "\n* is selected by 'compress: auto'\n")
+}
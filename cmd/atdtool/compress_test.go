@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestCompressBenchRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.log")
+	var data bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&data, "line %d of the log file\n", i)
+	}
+	if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &bytes.Buffer{}
+	o := &compressBenchOptions{path: path, sampleSize: 64 << 10, minThroughput: 0, format: "json"}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+
+	report := &compressBenchReport{}
+	if !assert.NoError(t, json.Unmarshal(stdout.Bytes(), report)) {
+		return
+	}
+	assert.Equal(t, path, report.File)
+	if !assert.Len(t, report.Results, len(compress.ProbeCandidates())) {
+		return
+	}
+	var selected int
+	for _, r := range report.Results {
+		assert.Equal(t, int64(64<<10), r.Size)
+		assert.Greater(t, r.Ratio, 1.0)
+		if r.Selected {
+			selected++
+		}
+	}
+	assert.Equal(t, 1, selected)
+
+	stdout.Reset()
+	o.format = "text"
+	if assert.NoError(t, o.run(stdout)) {
+		assert.True(t, strings.HasPrefix(stdout.String(), "file:    "+path+"\n"))
+		assert.Contains(t, stdout.String(), "lz4        -")
+	}
+}
+
+func TestCompressBenchRunInvalidOptions(t *testing.T) {
+	o := &compressBenchOptions{path: "nonexistence.log", sampleSize: 1 << 20, format: "text"}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+
+	o = &compressBenchOptions{path: "nonexistence.log", sampleSize: 0, format: "text"}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+
+	o = &compressBenchOptions{path: "nonexistence.log", sampleSize: 1 << 20, format: "yaml"}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+}
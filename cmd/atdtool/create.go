@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const createDesc = `
+Create the skeleton of a new service chart.
+
+The chart is created in the directory NAME, the base name of which is the name
+of the chart, e.g. 'atdtool create ./charts/gamesvr':
+
+    NAME/Chart.yaml                  metadata of the chart
+    NAME/values.yaml                 default values with func_name and type_id
+    NAME/cfg/<name>.yaml.tpl         configuration rendered for each instance
+    NAME/bin/start.sh.tpl            start scripts rendered for each instance
+    NAME/bin/start.bat.tpl
+
+The service-level values are read from '<values path>/<func_name>.yaml' when the
+chart is rendered. The '--values' flag creates it in the values directory, with the
+'modules/' directory of the module values.
+`
+
+type createOptions struct {
+	chartPath  string
+	funcName   string
+	typeID     string
+	valuesPath string
+	force      bool
+}
+
+func newCreateCmd(out io.Writer) *cobra.Command {
+	o := &createOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create the skeleton of a new service chart",
+		Long:  createDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartPath = args[0]
+			return o.run(out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&o.funcName, "func-name", "", "func_name of the chart, which is the name of the service-level values file, the chart name by default")
+	f.StringVar(&o.typeID, "type-id", "0", "default type_id of the chart, it is overridden by instance_type_id of deploy.yaml when rendering")
+	f.StringVar(&o.valuesPath, "values", "", "values directory where the service-level values file and the modules directory are created")
+	f.BoolVar(&o.force, "force", false, "overwrite the existing files")
+	return cmd
+}
+
+// chartSkeleton are the files of the chart skeleton, "<name>", "<func_name>"
+// and "<type_id>" are replaced by the options.
+var chartSkeleton = map[string]string{
+	"Chart.yaml": `apiVersion: v2
+name: <name>
+description: The configuration of <name>
+type: application
+version: 0.1.0
+`,
+	"values.yaml": `# the service-level values are read from <values path>/<func_name>.yaml
+func_name: <func_name>
+# overridden by instance_type_id of non_cloud_native/deploy.yaml when rendering
+type_id: "<type_id>"
+
+# the modules are enabled here, their values are read from
+# <values path>/modules/<module>.yaml
+# logging:
+#   enabled: true
+
+log_level: info
+`,
+	"cfg/<name>.yaml.tpl": `{{- /* rendered into cfg/<name>_<bus_addr>.yaml for each instance */ -}}
+name: {{ .Values.func_name }}
+type_id: {{ .Values.type_id }}
+bus_addr: {{ .Values.bus_addr }}
+world_id: {{ .Values.world_id }}
+zone_id: {{ .Values.zone_id }}
+instance_id: {{ .Values.instance_id }}
+log_level: {{ .Values.log_level }}
+`,
+	"bin/start.sh.tpl": `#!/bin/sh
+cd "$(dirname "$0")/.." || exit 1
+exec ./bin/<name> -c cfg/<name>_{{ .Values.bus_addr }}.yaml "$@"
+`,
+	"bin/start.bat.tpl": `@echo off
+cd /d "%~dp0.."
+bin\<name>.exe -c cfg\<name>_{{ .Values.bus_addr }}.yaml %*
+`,
+}
+
+// validName reports whether the name could be a chart or a file name.
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_") &&
+		!strings.ContainsAny(name, "/\\ \t\r\n{}<>:\"|?*")
+}
+
+func (o *createOptions) run(out io.Writer) error {
+	name := filepath.Base(filepath.Clean(o.chartPath))
+	if !validName(name) {
+		return fmt.Errorf("invalid chart name: %q", name)
+	}
+	funcName := o.funcName
+	if funcName == "" {
+		funcName = name
+	}
+	if !validName(funcName) {
+		return fmt.Errorf("invalid func name: %q", funcName)
+	}
+	if _, err := strconv.ParseUint(o.typeID, 10, 64); err != nil {
+		return fmt.Errorf("invalid type id: %q", o.typeID)
+	}
+
+	replacer := strings.NewReplacer("<name>", name, "<func_name>", funcName, "<type_id>", o.typeID)
+	files := make(map[string]string, len(chartSkeleton)+1)
+	for p, content := range chartSkeleton {
+		files[filepath.Join(o.chartPath, filepath.FromSlash(replacer.Replace(p)))] = replacer.Replace(content)
+	}
+	if o.valuesPath != "" {
+		files[filepath.Join(o.valuesPath, funcName+".yaml")] = "# the service-level values of " + name + "\n"
+	}
+
+	names := make([]string, 0, len(files))
+	for p := range files {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	if !o.force {
+		for _, p := range names {
+			if util.FileExist(p) {
+				return fmt.Errorf("file(%s) already exists, use --force to overwrite", p)
+			}
+		}
+	}
+
+	if o.valuesPath != "" {
+		if err := os.MkdirAll(filepath.Join(o.valuesPath, "modules"), os.ModePerm); err != nil {
+			return err
+		}
+	}
+	for _, p := range names {
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(files[p]), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "create %s\n", p)
+	}
+
+	// the skeleton must be accepted by template
+	r, err := newChartRenderer(o.chartPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("load created chart: %v", err)
+	}
+	vals, err := util.MergeLoadedChartValues(r.chrt, nil, util.MergeOptions{}, nil, nil)
+	if err != nil {
+		return fmt.Errorf("merge values of created chart: %v", err)
+	}
+	if err := r.render(vals, &memoryWriter{}, "", ""); err != nil {
+		return fmt.Errorf("render created chart: %v", err)
+	}
+	return nil
+}
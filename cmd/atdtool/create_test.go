@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestCreateChart(t *testing.T) {
+	dir := t.TempDir()
+	chartsDir := filepath.Join(dir, "charts")
+	valuesDir := filepath.Join(dir, "values")
+	o := &createOptions{
+		chartPath:  filepath.Join(chartsDir, "demo"),
+		funcName:   "demosvr",
+		typeID:     "7",
+		valuesPath: valuesDir,
+	}
+	stdout := &bytes.Buffer{}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	assert.Contains(t, stdout.String(), "create "+filepath.Join(chartsDir, "demo", "cfg", "demo.yaml.tpl"))
+	assert.FileExists(t, filepath.Join(valuesDir, "demosvr.yaml"))
+	assert.DirExists(t, filepath.Join(valuesDir, "modules"))
+
+	// the created chart is rendered by template with the service-level values
+	if err := os.WriteFile(filepath.Join(valuesDir, "demosvr.yaml"), []byte("log_level: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deploy := "world_id: 1\nzone_id: 2\nproc_desc:\n  - chart_name: demo\n    instance_type_id: \"42\"\n    instance_count: 1\n    start_instance_id: 3\n"
+	if err := os.MkdirAll(filepath.Join(valuesDir, "non_cloud_native"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(valuesDir, "non_cloud_native", "deploy.yaml"), []byte(deploy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "out")
+	to := &templateOptions{
+		chartPath: chartsDir,
+		outPath:   outDir,
+		valOpts:   values.Options{Paths: []string{valuesDir}},
+	}
+	if !assert.NoError(t, to.run(&bytes.Buffer{})) {
+		return
+	}
+	cfg, err := os.ReadFile(filepath.Join(outDir, "demo", "cfg", "demo_1.2.42.3.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "name: demosvr\ntype_id: 42\nbus_addr: 1.2.42.3\nworld_id: 1\nzone_id: 2\ninstance_id: 3\nlog_level: debug\n", string(cfg))
+	}
+	assert.FileExists(t, filepath.Join(outDir, "demo", "bin", "start_1.2.42.3.sh"))
+	assert.FileExists(t, filepath.Join(outDir, "demo", "bin", "start_1.2.42.3.bat"))
+
+	// the existing files are not overwritten by default
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "already exists")
+	o.force = true
+	assert.NoError(t, o.run(&bytes.Buffer{}))
+
+	assert.ErrorContains(t, (&createOptions{chartPath: filepath.Join(dir, ".demo"), typeID: "0"}).run(&bytes.Buffer{}), "invalid chart name")
+	assert.ErrorContains(t, (&createOptions{chartPath: filepath.Join(dir, "demo"), typeID: "x"}).run(&bytes.Buffer{}), "invalid type id")
+}
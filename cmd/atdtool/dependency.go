@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const dependencyDesc = `
+Manage the dependencies of a chart.
+
+The dependencies are declared in Chart.yaml like Helm, their charts are saved as
+archives into the charts/ directory of the chart, so that the shared templates
+could live in library charts:
+
+    dependencies:
+      - name: common
+        version: "~1.2.0"
+        repository: "file://../common"        # a chart directory
+      - name: logging
+        version: "^2.0.0"
+        repository: "file:///data/charts"     # a local repository directory
+      - name: router
+        version: "1.x"
+        repository: "https://charts.example.com/stable"
+
+A local repository directory contains an index.yaml, or the chart directories
+and archives. An HTTP chart repository serves its index.yaml like Helm, the user
+and password in the URL are used for the basic authentication.
+
+The dependencies without the repository are not managed, they must be in the
+charts/ directory already.
+`
+
+const dependencyUpdateDesc = `
+Resolve the dependencies of Chart.yaml to the latest versions matching their
+version ranges, save them into the charts/ directory and write the versions into
+the lock file Chart.lock.
+`
+
+const dependencyBuildDesc = `
+Save the dependencies of the lock file Chart.lock into the charts/ directory, so
+that the charts are rebuilt with the same versions. The dependencies are updated
+if there is no lock file, it fails if the lock file is out of sync with Chart.yaml.
+`
+
+type dependencyOptions struct {
+	chartPath string
+	timeout   time.Duration
+}
+
+func newDependencyCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "dependency update|build [CHART]",
+		Aliases: []string{"dep", "dependencies"},
+		Short:   "Manage the dependencies of a chart",
+		Long:    dependencyDesc,
+		Args:    require.NoArgs,
+	}
+	cmd.AddCommand(
+		newDependencySubCmd(out, "update", "Update the dependencies and the lock file", dependencyUpdateDesc, (*dependencyOptions).update),
+		newDependencySubCmd(out, "build", "Rebuild the dependencies from the lock file", dependencyBuildDesc, (*dependencyOptions).build),
+	)
+	return cmd
+}
+
+func newDependencySubCmd(out io.Writer, use, short, long string, run func(*dependencyOptions, io.Writer) error) *cobra.Command {
+	o := &dependencyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   use + " [CHART]",
+		Short: short,
+		Long:  long,
+		Args:  require.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartPath = "."
+			if len(args) > 0 {
+				o.chartPath = args[0]
+			}
+			return run(o, out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	f.DurationVar(&o.timeout, "timeout", time.Minute, "time to wait for each request to the chart repositories")
+	return cmd
+}
+
+// lockFile returns the lock file of the chart, requirements.lock is used by
+// the charts of apiVersion v1.
+func lockFile(chartPath string, meta *chart.Metadata) string {
+	if meta.APIVersion == chart.APIVersionV1 {
+		return filepath.Join(chartPath, "requirements.lock")
+	}
+	return filepath.Join(chartPath, "Chart.lock")
+}
+
+// hashReq digests the dependencies and their locked versions, which is the same
+// as Helm, so that the lock file is also accepted by Helm.
+func hashReq(req, lock []*chart.Dependency) (string, error) {
+	data, err := json.Marshal([2][]*chart.Dependency{req, lock})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
+
+func (o *dependencyOptions) loadChartfile() (*chart.Metadata, error) {
+	meta, err := chartutil.LoadChartfile(filepath.Join(o.chartPath, chartutil.ChartfileName))
+	if err != nil {
+		return nil, fmt.Errorf("load chart(%s): %v", o.chartPath, err)
+	}
+	for _, dep := range meta.Dependencies {
+		if err := dep.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return meta, nil
+}
+
+// update resolves the dependencies to the latest matching versions.
+func (o *dependencyOptions) update(out io.Writer) error {
+	meta, err := o.loadChartfile()
+	if err != nil {
+		return err
+	}
+
+	var locked []*chart.Dependency
+	var sources []*chartSource
+	for _, dep := range meta.Dependencies {
+		if dep.Repository == "" {
+			continue
+		}
+		src, err := o.resolve(dep.Name, dep.Version, dep.Repository)
+		if err != nil {
+			return err
+		}
+		locked = append(locked, &chart.Dependency{Name: dep.Name, Version: src.version.Original(), Repository: dep.Repository})
+		sources = append(sources, src)
+	}
+
+	if err := o.save(out, sources); err != nil {
+		return err
+	}
+
+	digest, err := hashReq(meta.Dependencies, locked)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(&chart.Lock{Generated: time.Now(), Digest: digest, Dependencies: locked})
+	if err != nil {
+		return err
+	}
+	filename := lockFile(o.chartPath, meta)
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("write lock file(%s): %v", filename, err)
+	}
+	fmt.Fprintf(out, "write %s\n", filename)
+	return nil
+}
+
+// build saves the dependencies of the lock file.
+func (o *dependencyOptions) build(out io.Writer) error {
+	meta, err := o.loadChartfile()
+	if err != nil {
+		return err
+	}
+
+	filename := lockFile(o.chartPath, meta)
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(out, "no lock file(%s), update the dependencies\n", filename)
+		return o.update(out)
+	}
+	if err != nil {
+		return err
+	}
+
+	lock := &chart.Lock{}
+	if err := yaml.Unmarshal(data, lock); err != nil {
+		return fmt.Errorf("load lock file(%s): %v", filename, err)
+	}
+	if digest, err := hashReq(meta.Dependencies, lock.Dependencies); err != nil || digest != lock.Digest {
+		return fmt.Errorf("the lock file(%s) is out of sync with %s, run 'atdtool dependency update' first", filename, chartutil.ChartfileName)
+	}
+
+	var sources []*chartSource
+	for _, dep := range lock.Dependencies {
+		src, err := o.resolve(dep.Name, dep.Version, dep.Repository)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, src)
+	}
+	return o.save(out, sources)
+}
+
+// save saves the charts into the charts/ directory, the archives of the other
+// versions of the charts are removed. All charts are downloaded before the
+// directory is changed, so that it is not left half updated.
+func (o *dependencyOptions) save(out io.Writer, sources []*chartSource) error {
+	archives := make([][]byte, len(sources))
+	for i, src := range sources {
+		data, err := src.archive(o)
+		if err != nil {
+			return err
+		}
+		archives[i] = data
+	}
+
+	chartsDir := filepath.Join(o.chartPath, "charts")
+	if err := os.MkdirAll(chartsDir, os.ModePerm); err != nil {
+		return err
+	}
+	for i, src := range sources {
+		entries, err := os.ReadDir(chartsDir)
+		if err != nil {
+			return err
+		}
+		archive := fmt.Sprintf("%s-%s.tgz", src.name, src.version.Original())
+		for _, e := range entries {
+			v, ok := strings.CutPrefix(e.Name(), src.name+"-")
+			if !ok || e.IsDir() || e.Name() == archive || !strings.HasSuffix(v, ".tgz") {
+				continue
+			}
+			if _, err := semver.StrictNewVersion(strings.TrimSuffix(v, ".tgz")); err != nil {
+				continue
+			}
+			if err := os.Remove(filepath.Join(chartsDir, e.Name())); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "remove %s\n", filepath.Join(chartsDir, e.Name()))
+		}
+
+		if err := os.WriteFile(filepath.Join(chartsDir, archive), archives[i], 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "save %s %s from %s\n", src.name, src.version.Original(), src.repository)
+	}
+	return nil
+}
+
+// chartSource is a version of a chart in the repository.
+type chartSource struct {
+	name       string
+	version    *semver.Version
+	repository string
+
+	// dir is the chart directory, which is packaged when it is saved
+	dir string
+	// file is the local archive of the chart
+	file string
+	// url is the archive in the HTTP repository, which is verified by digest
+	url    string
+	digest string
+}
+
+// archive returns the archive of the chart.
+func (s *chartSource) archive(o *dependencyOptions) ([]byte, error) {
+	var data []byte
+	switch {
+	case s.dir != "":
+		chrt, err := loader.LoadDir(util.LongPath(s.dir))
+		if err != nil {
+			return nil, fmt.Errorf("load chart(%s): %v", s.dir, err)
+		}
+		tmp, err := os.MkdirTemp("", "atdtool-dependency-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		filename, err := chartutil.Save(chrt, tmp)
+		if err != nil {
+			return nil, fmt.Errorf("package chart(%s): %v", s.dir, err)
+		}
+		return os.ReadFile(filename)
+	case s.file != "":
+		var err error
+		if data, err = os.ReadFile(s.file); err != nil {
+			return nil, err
+		}
+	default:
+		var err error
+		if data, err = o.get(s.url); err != nil {
+			return nil, err
+		}
+		if s.digest != "" {
+			digest := sha256.Sum256(data)
+			if hex.EncodeToString(digest[:]) != strings.TrimPrefix(s.digest, "sha256:") {
+				return nil, fmt.Errorf("digest of chart %s %s(%s) mismatch", s.name, s.version.Original(), s.url)
+			}
+		}
+	}
+
+	// the archive must be the chart of the dependency
+	chrt, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("load chart %s %s: %v", s.name, s.version.Original(), err)
+	}
+	if chrt.Name() != s.name || chrt.Metadata.Version != s.version.Original() {
+		return nil, fmt.Errorf("chart %s %s of the repository is %s %s", s.name, s.version.Original(), chrt.Name(), chrt.Metadata.Version)
+	}
+	return data, nil
+}
+
+// resolve finds the latest version of the chart matching the version range
+// in the repository.
+func (o *dependencyOptions) resolve(name, version, repository string) (*chartSource, error) {
+	if version == "" {
+		version = "*"
+	}
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s: invalid version %q: %v", name, version, err)
+	}
+
+	var sources []*chartSource
+	switch {
+	case strings.HasPrefix(repository, "file://"):
+		sources, err = o.localSources(name, repository)
+	case strings.HasPrefix(repository, "http://"), strings.HasPrefix(repository, "https://"):
+		sources, err = o.httpSources(name, repository)
+	default:
+		err = fmt.Errorf("unsupported repository: %s, should be file:// or http(s)://", repository)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dependency %s: %v", name, err)
+	}
+
+	var found *chartSource
+	for _, src := range sources {
+		if !constraint.Check(src.version) {
+			continue
+		}
+		if found == nil || src.version.GreaterThan(found.version) {
+			found = src
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("dependency %s: no version matches %s in %s", name, version, repository)
+	}
+	return found, nil
+}
+
+// localSources lists the versions of the chart in the local chart directory or
+// repository directory, the relative path is relative to the chart.
+func (o *dependencyOptions) localSources(name, repository string) ([]*chartSource, error) {
+	dir := filepath.FromSlash(strings.TrimPrefix(repository, "file://"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(o.chartPath, dir)
+	}
+
+	newSource := func(meta *chart.Metadata) (*chartSource, error) {
+		v, err := semver.NewVersion(meta.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of chart %s: %q", meta.Name, meta.Version)
+		}
+		return &chartSource{name: meta.Name, version: v, repository: repository}, nil
+	}
+
+	// the chart directory itself like Helm
+	if util.FileExist(filepath.Join(dir, chartutil.ChartfileName)) {
+		meta, err := chartutil.LoadChartfile(filepath.Join(dir, chartutil.ChartfileName))
+		if err != nil {
+			return nil, err
+		}
+		if meta.Name != name {
+			return nil, fmt.Errorf("chart in %s is %s", dir, meta.Name)
+		}
+		src, err := newSource(meta)
+		if err != nil {
+			return nil, err
+		}
+		src.dir = dir
+		return []*chartSource{src}, nil
+	}
+
+	if util.FileExist(filepath.Join(dir, "index.yaml")) {
+		data, err := os.ReadFile(filepath.Join(dir, "index.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		return indexSources(name, repository, data, func(u string) (*chartSource, error) {
+			if strings.Contains(u, "://") {
+				return &chartSource{url: u}, nil
+			}
+			return &chartSource{file: filepath.Join(dir, filepath.FromSlash(u))}, nil
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read repository(%s): %v", dir, err)
+	}
+	var sources []*chartSource
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		switch {
+		case e.IsDir() && util.FileExist(filepath.Join(p, chartutil.ChartfileName)):
+			meta, err := chartutil.LoadChartfile(filepath.Join(p, chartutil.ChartfileName))
+			if err != nil || meta.Name != name {
+				continue
+			}
+			src, err := newSource(meta)
+			if err != nil {
+				return nil, err
+			}
+			src.dir = p
+			sources = append(sources, src)
+		case !e.IsDir() && strings.HasPrefix(e.Name(), name+"-") && strings.HasSuffix(e.Name(), ".tgz"):
+			chrt, err := loader.LoadFile(p)
+			if err != nil || chrt.Name() != name {
+				continue
+			}
+			src, err := newSource(chrt.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			src.file = p
+			sources = append(sources, src)
+		}
+	}
+	return sources, nil
+}
+
+// httpSources lists the versions of the chart in the index of the HTTP chart
+// repository.
+func (o *dependencyOptions) httpSources(name, repository string) ([]*chartSource, error) {
+	base, err := url.Parse(strings.TrimSuffix(repository, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository(%s): %v", repository, err)
+	}
+	data, err := o.get(base.JoinPath("index.yaml").String())
+	if err != nil {
+		return nil, err
+	}
+	return indexSources(name, repository, data, func(u string) (*chartSource, error) {
+		ref, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart url(%s): %v", u, err)
+		}
+		return &chartSource{url: base.ResolveReference(ref).String()}, nil
+	})
+}
+
+// repoIndex is the index.yaml of a chart repository.
+type repoIndex struct {
+	Entries map[string][]*repoChartVersion `json:"entries"`
+}
+
+type repoChartVersion struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	URLs    []string `json:"urls"`
+	Digest  string   `json:"digest,omitempty"`
+}
+
+// indexSources lists the versions of the chart in the repository index, the
+// urls of the charts are resolved by locate.
+func indexSources(name, repository string, data []byte, locate func(string) (*chartSource, error)) ([]*chartSource, error) {
+	index := &repoIndex{}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("load index of repository(%s): %v", repository, err)
+	}
+
+	var sources []*chartSource
+	for _, cv := range index.Entries[name] {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil || len(cv.URLs) == 0 {
+			continue
+		}
+		src, err := locate(cv.URLs[0])
+		if err != nil {
+			return nil, err
+		}
+		src.name, src.version, src.repository, src.digest = name, v, repository, cv.Digest
+		sources = append(sources, src)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].version.LessThan(sources[j].version)
+	})
+	return sources, nil
+}
+
+// get downloads the file from the HTTP repository.
+func (o *dependencyOptions) get(u string) ([]byte, error) {
+	timeout := o.timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	client := &http.Client{Timeout: timeout}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the credential is not sent to the redirected hosts
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+		req.URL.User = nil
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %v", req.URL.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func saveTestChart(t *testing.T, dir, name, version, typ string, templates map[string]string) string {
+	chrt := &chart.Chart{Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version, Type: typ}}
+	for n, data := range templates {
+		chrt.Templates = append(chrt.Templates, &chart.File{Name: n, Data: []byte(data)})
+	}
+	filename, err := chartutil.Save(chrt, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestDependencyUpdateAndBuild(t *testing.T) {
+	root := t.TempDir()
+
+	// a local repository directory with the archives of the library chart
+	repoDir := filepath.Join(root, "repo")
+	if err := os.MkdirAll(repoDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"0.1.0", "0.2.0"} {
+		saveTestChart(t, repoDir, "lib", v, "library", map[string]string{
+			"templates/_lib.tpl": fmt.Sprintf(`{{- define "lib.banner" -}}# lib %s{{- end -}}`, v),
+		})
+	}
+
+	// an HTTP chart repository
+	httpDir := t.TempDir()
+	archive := saveTestChart(t, httpDir, "router", "1.1.0", "", nil)
+	saveTestChart(t, httpDir, "router", "2.0.0", "", nil)
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+	index := fmt.Sprintf(`apiVersion: v1
+entries:
+  router:
+    - name: router
+      version: 2.0.0
+      urls: [router-2.0.0.tgz]
+    - name: router
+      version: 1.1.0
+      urls: [charts/router-1.1.0.tgz]
+      digest: %s
+`, hex.EncodeToString(digest[:]))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stable/index.yaml":
+			_, _ = w.Write([]byte(index))
+		case "/stable/charts/router-1.1.0.tgz":
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	chartPath := writeChart(t, map[string]string{
+		"Chart.yaml": fmt.Sprintf(`apiVersion: v2
+name: demo
+version: 0.1.0
+dependencies:
+  - name: common
+    version: "~1.2.0"
+    repository: "file://../common"
+  - name: lib
+    version: ">=0.1.0"
+    repository: "file://%s"
+  - name: router
+    version: "1.x"
+    repository: "%s/stable"
+`, filepath.ToSlash(repoDir), srv.URL),
+		"cfg/demo.yaml.tpl":               "{{ include \"lib.banner\" . }}\n{{ include \"common.name\" . }}\n",
+		"charts/lib-0.1.0.tgz":            "stale",
+		"../common/Chart.yaml":            "apiVersion: v2\nname: common\nversion: 1.2.3\ntype: library\n",
+		"../common/templates/_common.tpl": `{{- define "common.name" -}}name: {{ .Values.name }}{{- end -}}`,
+	})
+
+	o := &dependencyOptions{chartPath: chartPath}
+	stdout := &bytes.Buffer{}
+	if !assert.NoError(t, o.update(stdout)) {
+		return
+	}
+	assert.Contains(t, stdout.String(), "remove "+filepath.Join(chartPath, "charts", "lib-0.1.0.tgz"))
+	assert.Contains(t, stdout.String(), "save router 1.1.0 from "+srv.URL+"/stable")
+	for _, name := range []string{"common-1.2.3.tgz", "lib-0.2.0.tgz", "router-1.1.0.tgz"} {
+		assert.FileExists(t, filepath.Join(chartPath, "charts", name))
+	}
+	lock, err := os.ReadFile(filepath.Join(chartPath, "Chart.lock"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(lock), "- name: lib\n  repository: file://")
+		assert.Contains(t, string(lock), "version: 0.2.0")
+		assert.Contains(t, string(lock), "digest: sha256:")
+	}
+
+	// the templates of the library charts are included by the chart
+	render := func() string {
+		r, err := newChartRenderer(chartPath, nil, nil)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		w := &memoryWriter{}
+		if !assert.NoError(t, r.render(map[string]any{"name": "demo"}, w, "", "_1")) {
+			return ""
+		}
+		if !assert.Contains(t, w.files, "cfg/demo_1.yaml") {
+			return ""
+		}
+		return w.files["cfg/demo_1.yaml"].String()
+	}
+	assert.Equal(t, "# lib 0.2.0\nname: demo\n", render())
+
+	// the charts are rebuilt from the lock file
+	if err := os.RemoveAll(filepath.Join(chartPath, "charts")); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NoError(t, o.build(&bytes.Buffer{})) {
+		return
+	}
+	assert.Equal(t, "# lib 0.2.0\nname: demo\n", render())
+
+	// the lock file must be updated after Chart.yaml is changed
+	chartfile := filepath.Join(chartPath, "Chart.yaml")
+	meta, err := chartutil.LoadChartfile(chartfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Dependencies[1].Version = "^0.1.0"
+	if err := chartutil.SaveChartfile(chartfile, meta); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorContains(t, o.build(&bytes.Buffer{}), "out of sync")
+	if assert.NoError(t, o.update(&bytes.Buffer{})) {
+		assert.Equal(t, "# lib 0.1.0\nname: demo\n", render())
+	}
+
+	meta.Dependencies[1].Version = "^3.0.0"
+	if err := chartutil.SaveChartfile(chartfile, meta); err != nil {
+		t.Fatal(err)
+	}
+	assert.ErrorContains(t, o.update(&bytes.Buffer{}), "dependency lib: no version matches ^3.0.0")
+
+	// the digest of the index is verified
+	meta.Dependencies[1].Version = "*"
+	if err := chartutil.SaveChartfile(chartfile, meta); err != nil {
+		t.Fatal(err)
+	}
+	data = []byte("broken")
+	assert.ErrorContains(t, o.update(&bytes.Buffer{}), "digest of chart router 1.1.0")
+}
+
+func TestChartRendererLibraryDependency(t *testing.T) {
+	files := map[string]string{
+		"Chart.yaml": `apiVersion: v2
+name: demo
+version: 0.1.0
+dependencies:
+  - name: common
+    version: 1.2.3
+    condition: common.enabled
+`,
+		"cfg/demo.yaml.tpl":                             "{{ include \"common.name\" . }}\n",
+		"charts/common/Chart.yaml":                      "apiVersion: v2\nname: common\nversion: 1.2.3\ntype: library\n",
+		"charts/common/templates/_common.tpl":           `{{- define "common.name" -}}name: {{ .Values.name }}{{- end -}}`,
+		"charts/common/templates/common.yaml":           "kind: ignored\n",
+		"charts/common/cfg/common.yaml.tpl":             "kind: ignored\n",
+		"charts/common/templates/_unused.tpl":           `{{- define "common.unused" -}}{{- end -}}`,
+		"charts/common/charts/base/Chart.yaml":          "apiVersion: v2\nname: base\nversion: 0.1.0\ntype: library\n",
+		"charts/common/charts/base/templates/_base.tpl": `{{- define "base.name" -}}{{ .Values.name }}{{- end -}}`,
+	}
+	vals := map[string]any{"name": "demo", "common": map[string]any{"enabled": false}}
+
+	// only library charts, the chart is rendered without the Helm engine, and
+	// the library chart is not disabled by the condition
+	r, err := newChartRenderer(writeChart(t, files), nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, r.tmpl)
+	w := &memoryWriter{}
+	if assert.NoError(t, r.render(vals, w, "", "")) {
+		assert.Equal(t, []string{"cfg/demo.yaml"}, slices.Sorted(maps.Keys(w.files)))
+		assert.Equal(t, "name: demo\n", w.files["cfg/demo.yaml"].String())
+	}
+
+	// with an application dependency, the chart is rendered by the Helm engine
+	// and the outputs of the library chart are not written either
+	files["Chart.yaml"] += "  - name: router\n    version: 0.1.0\n"
+	files["charts/router/Chart.yaml"] = "apiVersion: v2\nname: router\nversion: 0.1.0\n"
+	if r, err = newChartRenderer(writeChart(t, files), nil, nil); !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, r.tmpl)
+	w = &memoryWriter{}
+	if assert.NoError(t, r.render(vals, w, "", "")) {
+		assert.Equal(t, []string{"cfg/demo.yaml"}, slices.Sorted(maps.Keys(w.files)))
+		assert.Equal(t, "name: demo\n", w.files["cfg/demo.yaml"].String())
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const diffDesc = `
+Render the chart templates in memory and show the unified diff against the
+configuration directory generated before, so that the changes of the values
+could be reviewed before they are applied.
+
+The flags of the values are the same as 'atdtool template'. The files are
+grouped by the instances, the name of each file contains its bus_addr. The
+files which are no longer rendered under the directories of the instances are
+shown as removed. The render hooks are not executed, so the files generated by
+the hooks may be shown as removed.
+
+The '--header' and '--no-header' flags should be the same as the template
+command if the files were stamped with the header. The header is ignored when
+comparing the files, since the digest of the values and the generated time
+change in each run, the files only differ in the header are not shown.
+
+With '--exit-code', the command fails if there are any differences, like
+'git diff --exit-code'.
+`
+
+// headerLinePattern matches the lines of the file header.
+var headerLinePattern = regexp.MustCompile(`(?m)^\S+ (Code generated by \S+( \S+)?\. DO NOT EDIT\.|chart: .*|values: sha256:[0-9a-f]+|generated: \d{4}-\d{2}-\d{2}T\S+?)( -->)?\r?\n`)
+
+type diffOptions struct {
+	templateOptions
+	context  int
+	summary  bool
+	exitCode bool
+}
+
+// diffChange is the change of a file, the status is A (added), M (modified) or
+// D (removed).
+type diffChange struct {
+	status string
+	name   string
+	old    string
+	new    string
+}
+
+func newDiffCmd(out io.Writer) *cobra.Command {
+	o := &diffOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff [CHART]",
+		Short: "Show the changes of the rendered configuration",
+		Long:  diffDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartPath = args[0]
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	addValueOptionsFlags(f, &o.valOpts)
+	f.StringVarP(&o.outPath, "output", "o", "", "the configuration directory generated before")
+	f.StringSliceVar(&o.templateExt, "template-ext", []string{".tpl", ".template"}, "extensions of the files rendered as the templates, .tpl and .template are trimmed from the output file names")
+	f.StringVar(&o.outputLayout, "output-layout", layoutFlat, "layout of the rendered files as the template command")
+	f.BoolVar(&o.header, "header", false, "render the files with the comment header as the template command")
+	f.StringSliceVar(&o.noHeader, "no-header", []string{}, "patterns of the file names rendered without header, can specify multiple or separate values with commas")
+	f.BoolVar(&o.validate, "validate", false, "fail if a rendered xml, json, yaml or toml file has syntax errors")
+	f.IntVarP(&o.context, "context", "U", 3, "number of the context lines of the unified diff")
+	f.BoolVar(&o.summary, "summary", false, "only print the status and the names of the changed files")
+	f.BoolVar(&o.exitCode, "exit-code", false, "fail if there are any differences")
+	return cmd
+}
+
+func (o *diffOptions) run(out io.Writer) error {
+	if o.outPath == "" {
+		return fmt.Errorf("outPath not found")
+	}
+	if o.context < 0 {
+		return fmt.Errorf("invalid context lines: %d", o.context)
+	}
+	w, err := newOutputWriter(o.outPath)
+	if err != nil {
+		return err
+	}
+	root := w.LocalPath()
+	if root == "" {
+		return fmt.Errorf("diff only supports the local output directory: %s", o.outPath)
+	}
+
+	rendered := &memoryWriter{}
+	t := &o.templateOptions
+	t.writer = rendered
+	t.skipHooks = true
+	t.renderers = nil
+	if err := t.run(io.Discard); err != nil {
+		return err
+	}
+
+	changes, err := diffRendered(root, rendered)
+	if err != nil {
+		return err
+	}
+
+	var added, modified, removed int
+	for _, c := range changes {
+		switch c.status {
+		case "A":
+			added++
+		case "M":
+			modified++
+		case "D":
+			removed++
+		}
+
+		if o.summary {
+			fmt.Fprintf(out, "%s %s\n", c.status, c.name)
+			continue
+		}
+		if err := o.printChange(out, c); err != nil {
+			return err
+		}
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(out, "no changes")
+		return nil
+	}
+	fmt.Fprintf(out, "%d files changed, %d added, %d modified, %d removed\n", len(changes), added, modified, removed)
+	if o.exitCode {
+		return fmt.Errorf("rendered configuration differs from %s", o.outPath)
+	}
+	return nil
+}
+
+func (o *diffOptions) printChange(out io.Writer, c *diffChange) error {
+	from, to := "a/"+c.name, "b/"+c.name
+	switch c.status {
+	case "A":
+		from = "/dev/null"
+	case "D":
+		to = "/dev/null"
+	}
+
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(c.old),
+		B:        difflib.SplitLines(c.new),
+		FromFile: from,
+		ToFile:   to,
+		Context:  o.context,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "diff %s %s\n", "a/"+c.name, "b/"+c.name)
+	_, err = io.WriteString(out, text)
+	return err
+}
+
+// diffRendered compares the rendered files with the files of the directory,
+// the files under the directories of the rendered instances are compared.
+func diffRendered(root string, rendered *memoryWriter) ([]*diffChange, error) {
+	var changes []*diffChange
+	instances := make(map[string]bool)
+	for _, name := range rendered.names {
+		instances[strings.SplitN(name, "/", 2)[0]] = true
+
+		content := rendered.files[name].String()
+		data, err := os.ReadFile(util.LongPath(filepath.Join(root, filepath.FromSlash(name))))
+		if os.IsNotExist(err) {
+			changes = append(changes, &diffChange{status: "A", name: name, new: content})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stripHeader(string(data)) != stripHeader(content) {
+			changes = append(changes, &diffChange{status: "M", name: name, old: string(data), new: content})
+		}
+	}
+
+	for instance := range instances {
+		dir := filepath.Join(root, instance)
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			name := filepath.ToSlash(rel)
+			if _, ok := rendered.files[name]; ok {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, &diffChange{status: "D", name: name, old: string(data)})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].name < changes[j].name
+	})
+	return changes, nil
+}
+
+// stripHeader removes the file header.
+func stripHeader(s string) string {
+	return headerLinePattern.ReplaceAllString(s, "")
+}
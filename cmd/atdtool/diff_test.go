@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestDiffOptionsRun(t *testing.T) {
+	outDir := t.TempDir()
+	valOpts := values.Options{Paths: []string{fixturePath("values", "default")}}
+	tpl := &templateOptions{chartPath: fixturePath("charts"), outPath: outDir, valOpts: valOpts, header: true}
+	if !assert.NoError(t, tpl.run(&bytes.Buffer{})) {
+		return
+	}
+
+	// the header is ignored
+	time.Sleep(1100 * time.Millisecond)
+	stdout := &bytes.Buffer{}
+	o := &diffOptions{templateOptions: templateOptions{chartPath: fixturePath("charts"), outPath: outDir, valOpts: valOpts, header: true}, context: 3}
+	if assert.NoError(t, o.run(stdout)) {
+		assert.Equal(t, "no changes\n", stdout.String())
+	}
+
+	// modify the values, remove a file and leave a stale file
+	cfg := filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml")
+	if err := os.Remove(filepath.Join(outDir, "echo", "bin", "start_1.2.42.4.sh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.9.yaml"), []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	o.valOpts.Values = []string{"echo.shared=changed"}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	text := stdout.String()
+	assert.Contains(t, text, "diff a/echo/cfg/echo_1.2.42.3.yaml b/echo/cfg/echo_1.2.42.3.yaml\n--- a/echo/cfg/echo_1.2.42.3.yaml\n+++ b/echo/cfg/echo_1.2.42.3.yaml\n")
+	assert.Contains(t, text, "-shared: service\n+shared: changed\n")
+	assert.Contains(t, text, "--- /dev/null\n+++ b/echo/bin/start_1.2.42.4.sh\n")
+	assert.Contains(t, text, "--- a/echo/cfg/echo_1.2.42.9.yaml\n+++ /dev/null\n")
+	assert.Contains(t, text, "4 files changed, 1 added, 2 modified, 1 removed\n")
+
+	// the directory is not changed
+	data, err := os.ReadFile(cfg)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "shared: service")
+	}
+
+	stdout.Reset()
+	o.summary = true
+	o.exitCode = true
+	assert.Error(t, o.run(stdout))
+	assert.Equal(t, "A echo/bin/start_1.2.42.4.sh\nM echo/cfg/echo_1.2.42.3.yaml\nM echo/cfg/echo_1.2.42.4.yaml\nD echo/cfg/echo_1.2.42.9.yaml\n"+
+		"4 files changed, 1 added, 2 modified, 1 removed\n", stdout.String())
+}
+
+func TestDiffOptionsRunInvalid(t *testing.T) {
+	valOpts := values.Options{Paths: []string{fixturePath("values", "default")}}
+	assert.Error(t, (&diffOptions{templateOptions: templateOptions{chartPath: fixturePath("charts"), valOpts: valOpts}}).run(&bytes.Buffer{}))
+	assert.Error(t, (&diffOptions{templateOptions: templateOptions{chartPath: fixturePath("charts"), outPath: "s3://bucket/prefix", valOpts: valOpts}}).run(&bytes.Buffer{}))
+	assert.Error(t, (&diffOptions{templateOptions: templateOptions{chartPath: fixturePath("charts"), outPath: t.TempDir(), valOpts: valOpts}, context: -1}).run(&bytes.Buffer{}))
+}
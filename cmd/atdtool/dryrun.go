@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// commandPlan is the fully resolved command which would be executed.
+type commandPlan struct {
+	Path           string   `json:"path"`
+	Args           []string `json:"args"`
+	Dir            string   `json:"dir"`
+	Env            []string `json:"env"`
+	TimeoutSeconds float64  `json:"timeoutSeconds"`
+	// Error is set when the command can not be found
+	Error string `json:"error,omitempty"`
+}
+
+// watchPlan describes what triggers the command in watch mode.
+type watchPlan struct {
+	Paths        []string `json:"paths"`
+	SignalNotify bool     `json:"signalNotify"`
+	TriggerFile  string   `json:"triggerFile,omitempty"`
+}
+
+// dryRunResult is printed as JSON by the commands running in dry-run mode.
+type dryRunResult struct {
+	Watch   *watchPlan   `json:"watch,omitempty"`
+	Command *commandPlan `json:"command,omitempty"`
+}
+
+// newCommandPlan resolves the command the same way as exec.CommandContext does,
+// without executing it.
+func newCommandPlan(name string, args []string, workDir string, timeout time.Duration) (*commandPlan, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = workDir
+
+	plan := &commandPlan{
+		Path:           cmd.Path,
+		Args:           cmd.Args,
+		Dir:            workDir,
+		Env:            cmd.Environ(),
+		TimeoutSeconds: timeout.Seconds(),
+	}
+	if cmd.Err != nil {
+		plan.Error = cmd.Err.Error()
+	}
+
+	if plan.Dir == "" {
+		plan.Dir = "."
+	}
+	dir, err := filepath.Abs(plan.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve workdir %v", err)
+	}
+	plan.Dir = dir
+	return plan, nil
+}
+
+func printDryRun(out io.Writer, result *dryRunResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
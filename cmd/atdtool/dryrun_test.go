@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecOptionsRunDryRun(t *testing.T) {
+	goPath, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not found in PATH")
+	}
+
+	workDir := t.TempDir()
+	o := &execOptions{
+		runCmd:     "go",
+		runCmdArgs: []string{"version"},
+		workDir:    workDir,
+		timeout:    time.Minute,
+		dryRun:     true,
+	}
+
+	var out bytes.Buffer
+	if !assert.NoError(t, o.run(&out)) {
+		return
+	}
+
+	var result dryRunResult
+	if !assert.NoError(t, json.Unmarshal(out.Bytes(), &result)) || !assert.NotNil(t, result.Command) {
+		return
+	}
+	assert.Nil(t, result.Watch)
+	assert.Equal(t, goPath, result.Command.Path)
+	assert.Equal(t, []string{"go", "version"}, result.Command.Args)
+	assert.Equal(t, workDir, result.Command.Dir)
+	assert.Equal(t, float64(60), result.Command.TimeoutSeconds)
+	assert.NotEmpty(t, result.Command.Env)
+	assert.Empty(t, result.Command.Error)
+}
+
+func TestWatchConfigMapOptionsRunDryRun(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := &watchConfigMapOptions{
+		configPaths:      []string{"testdata"},
+		runCmd:           "atdtool-command-not-exists",
+		enableUserSignal: true,
+		triggerFile:      "reload.trigger",
+		timeout:          time.Second,
+		dryRun:           true,
+	}
+
+	var out bytes.Buffer
+	if !assert.NoError(t, o.run(&out)) {
+		return
+	}
+
+	var result dryRunResult
+	if !assert.NoError(t, json.Unmarshal(out.Bytes(), &result)) || !assert.NotNil(t, result.Watch) {
+		return
+	}
+	assert.Equal(t, []string{filepath.Join(cwd, "testdata")}, result.Watch.Paths)
+	assert.True(t, result.Watch.SignalNotify)
+	assert.Equal(t, filepath.Join(cwd, "reload.trigger"), result.Watch.TriggerFile)
+	if assert.NotNil(t, result.Command) {
+		assert.Equal(t, cwd, result.Command.Dir)
+		assert.NotEmpty(t, result.Command.Error)
+	}
+}
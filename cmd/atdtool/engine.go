@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const noValue = "<no value>"
+
+// chartRenderer renders the configuration templates of a chart. The chart is
+// loaded and the templates are parsed once, then they are reused by all instances
+// of the chart. Each output is streamed to its file instead of being held in memory.
+//
+// A chart with dependencies other than the library charts is rendered by the
+// Helm engine, because the enabled dependencies are decided by the values of
+// each instance. The library charts only provide their partials. The charts
+// calling helmFuncs or failed to parse are also rendered by the Helm engine,
+// and the failed templates are reported by it.
+type chartRenderer struct {
+	chartPath string
+	chrt      *chart.Chart
+	// digest is the digest of all files of the chart
+	digest string
+
+	// processed is the chart with the dependencies processed like the Helm
+	// engine, which provides .Chart and .Subcharts
+	processed *chart.Chart
+	tmpl      *template.Template
+	names     []string
+	files     chartFiles
+	exts      templateExts
+	// busAddrFuncs reports whether the templates call the bus address
+	// functions, which are not provided by the Helm engine
+	busAddrFuncs bool
+
+	// showOnly are the patterns of the templates which are written, all
+	// templates are written if it is empty
+	showOnly []string
+}
+
+// newChartRenderer loads the chart, the files with the extensions exts are the
+// templates, and the bus address functions of the templates are backed by the
+// deploy configuration cfg.
+func newChartRenderer(chartPath string, cfg *noncloudnative.Config, exts templateExts) (*chartRenderer, error) {
+	chrt, err := loader.Load(util.LongPath(chartPath))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(exts) == 0 {
+		exts = defaultTemplateExts
+	}
+	r := &chartRenderer{chartPath: chartPath, chrt: chrt, digest: chartDigest(chrt), exts: exts}
+	if _, ok := libraryDependencies(chrt); !ok {
+		return r, nil
+	}
+
+	// the values of the chart are merged from the unprocessed one, the library
+	// charts are enabled regardless of the values
+	processed := chrt
+	if len(chrt.Metadata.Dependencies) != 0 {
+		if processed, err = loader.Load(util.LongPath(chartPath)); err != nil {
+			return nil, err
+		}
+		if err := processDependencies(processed, chartutil.Values{}); err != nil {
+			return nil, err
+		}
+	}
+	libs, _ := libraryDependencies(processed)
+
+	allConfigTemplates(processed, exts)
+	tpls := make(map[string]string, len(processed.Templates))
+	for _, t := range processed.Templates {
+		tpls[path.Join(processed.ChartFullPath(), t.Name)] = string(t.Data)
+	}
+	// only the templates of the chart are rendered
+	rendered := make(map[string]bool, len(tpls))
+	for name := range tpls {
+		rendered[name] = true
+	}
+	for _, lib := range libs {
+		for _, t := range lib.Templates {
+			if strings.HasPrefix(path.Base(t.Name), "_") {
+				tpls[path.Join(lib.ChartFullPath(), t.Name)] = string(t.Data)
+			}
+		}
+	}
+
+	// parse in the same order as the Helm engine, the higher-level templates first
+	names := make([]string, 0, len(tpls))
+	for name := range tpls {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := names[i], names[j]
+		ca, cb := strings.Count(a, "/"), strings.Count(b, "/")
+		if ca == cb {
+			return a > b
+		}
+		return ca > cb
+	})
+	for _, name := range names {
+		if rendered[name] {
+			r.names = append(r.names, name)
+		}
+	}
+
+	tmpl := template.New("gotpl").Option("missingkey=zero").Funcs(funcMap()).Funcs(busAddrFuncs(cfg))
+	for _, name := range names {
+		// the parse error is reported by the Helm engine
+		if _, err := tmpl.New(name).Parse(tpls[name]); err != nil {
+			return r, nil
+		}
+	}
+
+	funcs := templateFuncs(tmpl)
+	for name := range busAddrFuncs(nil) {
+		r.busAddrFuncs = r.busAddrFuncs || funcs[name]
+	}
+	for _, name := range helmFuncs {
+		if !funcs[name] {
+			continue
+		}
+		if r.busAddrFuncs {
+			return nil, fmt.Errorf("chart %s calls %s of the Helm engine, which could not be called with the bus address functions", chrt.Name(), name)
+		}
+		return r, nil
+	}
+
+	r.processed = processed
+	r.tmpl = tmpl
+	r.files = newChartFiles(processed.Files)
+	return r, nil
+}
+
+// isLibraryChart reports whether the chart is a library chart, which only
+// provides the partials to the charts depending on it.
+func isLibraryChart(chrt *chart.Chart) bool {
+	return strings.EqualFold(chrt.Metadata.Type, "library")
+}
+
+// libraryDependencies returns the library charts the chart depends on directly
+// or indirectly, false is returned if any dependency is not a library chart, is
+// not found in charts/ or is aliased, or any indirect dependency has the
+// condition or the tags, which are decided by the values of each instance.
+func libraryDependencies(chrt *chart.Chart) ([]*chart.Chart, bool) {
+	for _, req := range chrt.Metadata.Dependencies {
+		if req.Alias != "" || (!chrt.IsRoot() && (req.Condition != "" || len(req.Tags) != 0)) {
+			return nil, false
+		}
+		found := false
+		for _, dep := range chrt.Dependencies() {
+			if dep.Name() == req.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+
+	var libs []*chart.Chart
+	for _, dep := range chrt.Dependencies() {
+		if !isLibraryChart(dep) {
+			return nil, false
+		}
+		sub, ok := libraryDependencies(dep)
+		if !ok {
+			return nil, false
+		}
+		libs = append(libs, dep)
+		libs = append(libs, sub...)
+	}
+	return libs, true
+}
+
+// processDependencies enables the dependencies by the values like Helm, the
+// library charts are always enabled, since they only provide the partials.
+func processDependencies(chrt *chart.Chart, vals chartutil.Values) error {
+	for _, req := range chrt.Metadata.Dependencies {
+		for _, dep := range chrt.Dependencies() {
+			if dep.Name() == req.Name && isLibraryChart(dep) {
+				req.Condition = ""
+				req.Tags = nil
+			}
+		}
+	}
+	return chartutil.ProcessDependencies(chrt, vals)
+}
+
+// errTemplatePanic is the error of a template which panics.
+var errTemplatePanic = errors.New("rendering template failed")
+
+// render writes the outputs of the instance into outPath of the output.
+func (r *chartRenderer) render(vals chartutil.Values, w outputWriter, outPath, outSuffix string) error {
+	if r.tmpl == nil {
+		chrt, err := loader.Load(util.LongPath(r.chartPath))
+		if err != nil {
+			return err
+		}
+		return render(chrt, vals, w, outPath, outSuffix, r.exts, r.showOnly)
+	}
+
+	err := r.execute(vals, w, outPath, outSuffix)
+	var execErr template.ExecError
+	if errors.As(err, &execErr) || errors.Is(err, errTemplatePanic) {
+		return r.helmError(vals, err)
+	}
+	return err
+}
+
+// helmError returns the error of rendering the chart by the Helm engine, so
+// that the failed template is reported the same as the Helm engine. err is
+// returned if the chart could not be rendered by it.
+func (r *chartRenderer) helmError(vals chartutil.Values, err error) error {
+	if r.busAddrFuncs {
+		return err
+	}
+	chrt, loadErr := loader.Load(util.LongPath(r.chartPath))
+	if loadErr != nil {
+		return err
+	}
+	if _, helmErr := helmRender(chrt, vals, r.exts); helmErr != nil {
+		return helmErr
+	}
+	return err
+}
+
+func (r *chartRenderer) execute(vals chartutil.Values, w outputWriter, outPath, outSuffix string) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%w: %v", errTemplatePanic, v)
+		}
+	}()
+
+	// the clone shares the parsed templates, include and tpl are bound to
+	// it, so that instances could be rendered concurrently
+	t, err := r.tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	bindFuncs(t, make(map[string]int))
+
+	for _, name := range r.names {
+		// partials are only included from other templates
+		if strings.HasPrefix(path.Base(name), "_") {
+			continue
+		}
+
+		top := map[string]interface{}{
+			"Chart":        chartMetadata(r.processed),
+			"Files":        r.files,
+			"Release":      nil,
+			"Capabilities": nil,
+			"Values":       vals,
+			"Subcharts":    subcharts(r.processed, vals),
+			"Template":     chartutil.Values{"Name": name, "BasePath": path.Join(r.processed.ChartFullPath(), "templates")},
+		}
+
+		// the templates not shown are executed for their errors
+		if !showTemplate(r.showOnly, r.chrt.Name(), name) {
+			if err := t.ExecuteTemplate(io.Discard, name, top); err != nil {
+				return fmt.Errorf("execution error in (%s): %w", name, err)
+			}
+			continue
+		}
+
+		if err := r.renderFile(t, name, top, w, outPath, outSuffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chartMetadata is the .Chart object of the chart.
+func chartMetadata(chrt *chart.Chart) interface{} {
+	return struct {
+		chart.Metadata
+		IsRoot bool
+	}{*chrt.Metadata, chrt.IsRoot()}
+}
+
+// subcharts is the .Subcharts object of the chart like the Helm engine, which
+// has the top-level objects of the dependencies, the values of each one are the
+// table of its name.
+func subcharts(chrt *chart.Chart, vals chartutil.Values) map[string]interface{} {
+	subs := make(map[string]interface{})
+	for _, dep := range chrt.Dependencies() {
+		depVals := make(chartutil.Values)
+		if vs, err := vals.Table(dep.Name()); err == nil {
+			depVals = vs
+		}
+		subs[dep.Name()] = map[string]interface{}{
+			"Chart":        chartMetadata(dep),
+			"Files":        newChartFiles(dep.Files),
+			"Release":      nil,
+			"Capabilities": nil,
+			"Values":       depVals,
+			"Subcharts":    subcharts(dep, depVals),
+		}
+	}
+	return subs
+}
+
+func (r *chartRenderer) renderFile(t *template.Template, name string, top map[string]interface{}, w outputWriter, outPath, outSuffix string) error {
+	outFile := path.Join(outputFilePath(r.chrt.Name(), name, outPath, outSuffix))
+	f, err := w.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("create configuration file(%s): %v", outFile, err)
+	}
+
+	nw := &noValueWriter{w: bufio.NewWriter(f)}
+	if err := t.ExecuteTemplate(nw, name, top); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("execution error in (%s): %w", name, err)
+	}
+
+	if err := nw.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write config file(%s): %v", outFile, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close config file(%s) of (%s): %v", outFile, name, err)
+	}
+	return nil
+}
+
+// showTemplate reports whether the template matches any pattern of showOnly,
+// which matches the path of the template relative to the chart, such as
+// "cfg/*.yaml.tpl".
+func showTemplate(showOnly []string, chartName, name string) bool {
+	if len(showOnly) == 0 {
+		return true
+	}
+	relPath, _ := util.TrimPathPrefix(name, chartName)
+	for _, pattern := range showOnly {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// outputFilePath returns the output directory and file name of the template,
+// the .tpl and .template extensions are trimmed, and the suffix is inserted before the extension of the file name. The directory
+// is a slash separated path relative to the root of the output.
+func outputFilePath(chartName, name, outPath, outSuffix string) (string, string) {
+	relPath, _ := util.TrimPathPrefix(path.Dir(name), chartName)
+	cfgOutPath := util.SlashJoin(outPath, relPath)
+
+	filename := trimTemplateExt(path.Base(name))
+	if outSuffix != "" {
+		idx := strings.LastIndex(filename, ".")
+		if idx != -1 {
+			// 存在. 分割
+			left := filename[:idx]
+			right := filename[idx:]
+			filename = left + outSuffix + right
+		} else {
+			// 直接拼接
+			filename = filename + outSuffix
+		}
+	}
+	return cfgOutPath, filename
+}
+
+// defaultTemplateExts are the extensions of the configuration templates.
+var defaultTemplateExts = templateExts{".tpl", ".template"}
+
+// trimmedTemplateExts are the extensions trimmed from the output file names,
+// the other extensions like .yaml are kept, since they are the formats of the
+// files.
+var trimmedTemplateExts = []string{".tpl", ".template"}
+
+// templateExts are the extensions of the files rendered as the templates.
+type templateExts []string
+
+// parseTemplateExts parses the extensions, the leading dot is optional.
+func parseTemplateExts(exts []string) (templateExts, error) {
+	var ret templateExts
+	for _, ext := range exts {
+		ext = strings.TrimSpace(ext)
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if len(ext) < 2 || strings.ContainsAny(ext, "/\\*?[") {
+			return nil, fmt.Errorf("invalid template extension: %s", ext)
+		}
+		ret = append(ret, ext)
+	}
+	return ret, nil
+}
+
+// match reports whether the file is a template.
+func (e templateExts) match(name string) bool {
+	for _, ext := range e {
+		if strings.HasSuffix(name, ext) && len(path.Base(name)) > len(ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimTemplateExt trims the .tpl or .template extension of the file name.
+func trimTemplateExt(filename string) string {
+	for _, ext := range trimmedTemplateExts {
+		if strings.HasSuffix(filename, ext) && len(filename) > len(ext) {
+			return strings.TrimSuffix(filename, ext)
+		}
+	}
+	return filename
+}
+
+// noValueWriter removes "<no value>" from the output like the Helm engine does
+// after rendering. The tail which may be the beginning of "<no value>" is held
+// until the next write.
+type noValueWriter struct {
+	w       *bufio.Writer
+	pending []byte
+}
+
+func (nw *noValueWriter) Write(p []byte) (int, error) {
+	buf := bytes.ReplaceAll(append(nw.pending, p...), []byte(noValue), nil)
+
+	keep := 0
+	for i := min(len(noValue)-1, len(buf)); i > 0; i-- {
+		if bytes.HasSuffix(buf, []byte(noValue[:i])) {
+			keep = i
+			break
+		}
+	}
+
+	if _, err := nw.w.Write(buf[:len(buf)-keep]); err != nil {
+		return 0, err
+	}
+	nw.pending = append(nw.pending[:0], buf[len(buf)-keep:]...)
+	return len(p), nil
+}
+
+// Flush writes the held tail and flushes the underlying writer.
+func (nw *noValueWriter) Flush() error {
+	if _, err := nw.w.Write(nw.pending); err != nil {
+		return err
+	}
+	nw.pending = nw.pending[:0]
+	return nw.w.Flush()
+}
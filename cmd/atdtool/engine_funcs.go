@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/sprig/v3"
+	"github.com/gobwas/glob"
+	"helm.sh/helm/v3/pkg/chart"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+// The functions and the files object below mirror the ones of the Helm engine
+// (helm.sh/helm/v3/pkg/engine), which are not exported, so that the templates
+// rendered by chartRenderer behave the same as rendered by Helm. The engine of
+// render is neither strict nor linting, so are the mirrored functions.
+
+const recursionMaxNums = 1000
+
+// helmFuncs are the functions whose results are decided by the configuration
+// of the Helm engine, such as the cluster connection of lookup, or are not
+// mirrored, the charts calling them are rendered by the Helm engine. They are
+// kept in funcMap for parsing and for the templates passed to tpl.
+var helmFuncs = []string{"lookup", "getHostByName", "toToml"}
+
+// funcMap returns the functions of the Helm engine, include and tpl are bound by bindFuncs.
+func funcMap() template.FuncMap {
+	f := sprig.TxtFuncMap()
+	delete(f, "env")
+	delete(f, "expandenv")
+
+	extra := template.FuncMap{
+		"toToml":        toTOML,
+		"toYaml":        toYAML,
+		"fromYaml":      fromYAML,
+		"fromYamlArray": fromYAMLArray,
+		"toJson":        toJSON,
+		"fromJson":      fromJSON,
+		"fromJsonArray": fromJSONArray,
+
+		"include": func(string, interface{}) string { return "not implemented" },
+		"tpl":     func(string, interface{}) interface{} { return "not implemented" },
+		"required": func(warn string, val interface{}) (interface{}, error) {
+			if val == nil {
+				return val, errors.New(warn)
+			} else if s, ok := val.(string); ok && s == "" {
+				return val, errors.New(warn)
+			}
+			return val, nil
+		},
+		"fail": func(msg string) (string, error) {
+			return "", errors.New(msg)
+		},
+		"lookup": func(string, string, string, string) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		},
+		"getHostByName": func(_ string) string {
+			return ""
+		},
+	}
+
+	for k, v := range extra {
+		f[k] = v
+	}
+	for k, v := range busAddrFuncs(nil) {
+		f[k] = v
+	}
+	return f
+}
+
+// busAddrFuncs returns the functions addressing the instances by the deploy
+// configuration, they fail when the configuration is not loaded:
+//
+//	busAddr world zone type instance   the bus address "world.zone.type.instance"
+//	uniqID "1.2.42.3"                  the numeric bus address packed by the mask
+//	logicID "1.2.42.3"                 the numeric id of the world and the zone
+//	addrShift "zone"                   the shift of the segment in the numeric bus address
+//	funcIDOf "gamesvr"                 the instance type id of the chart in proc_desc
+func busAddrFuncs(cfg *noncloudnative.Config) template.FuncMap {
+	mask := func() (noncloudnative.BusAddrMask, error) {
+		if cfg == nil || cfg.Deploy == nil {
+			return noncloudnative.BusAddrMask{}, errors.New("deploy configuration is not loaded")
+		}
+		return cfg.Deploy.Mask()
+	}
+	pack := func(addr string) ([4]uint64, noncloudnative.BusAddrMask, uint64, error) {
+		m, err := mask()
+		if err != nil {
+			return [4]uint64{}, m, 0, err
+		}
+		ids, err := noncloudnative.ParseBusAddr(addr)
+		if err != nil {
+			return ids, m, 0, err
+		}
+		id, err := m.Pack(ids)
+		if err != nil {
+			return ids, m, 0, fmt.Errorf("bus address %s: %v", addr, err)
+		}
+		return ids, m, id, nil
+	}
+
+	return template.FuncMap{
+		"busAddr": func(world, zone, typeID, instance interface{}) (string, error) {
+			ids, err := noncloudnative.BusAddrIds(world, zone, typeID, instance)
+			if err != nil {
+				return "", err
+			}
+			addr := fmt.Sprintf("%d.%d.%d.%d", ids[0], ids[1], ids[2], ids[3])
+			if _, _, _, err := pack(addr); err != nil {
+				return "", err
+			}
+			return addr, nil
+		},
+		"uniqID": func(addr string) (uint64, error) {
+			_, _, id, err := pack(addr)
+			return id, err
+		},
+		"logicID": func(addr string) (uint64, error) {
+			ids, m, _, err := pack(addr)
+			if err != nil {
+				return 0, err
+			}
+			return ids[0]<<m[1] | ids[1], nil
+		},
+		"addrShift": func(segment string) (uint, error) {
+			m, err := mask()
+			if err != nil {
+				return 0, err
+			}
+			return m.Shift(segment)
+		},
+		"funcIDOf": func(name string) (uint64, error) {
+			if cfg == nil || cfg.Deploy == nil {
+				return 0, errors.New("deploy configuration is not loaded")
+			}
+			return cfg.Deploy.FuncID(name)
+		},
+	}
+}
+
+// bindFuncs binds include and tpl to the template, includedNames detects the infinite recursion.
+func bindFuncs(t *template.Template, includedNames map[string]int) {
+	t.Funcs(template.FuncMap{
+		"include": includeFun(t, includedNames),
+		"tpl":     tplFun(t, includedNames, false),
+	})
+}
+
+func includeFun(t *template.Template, includedNames map[string]int) func(string, interface{}) (string, error) {
+	return func(name string, data interface{}) (string, error) {
+		var buf strings.Builder
+		if v, ok := includedNames[name]; ok {
+			if v > recursionMaxNums {
+				return "", fmt.Errorf("rendering template has a nested reference name: %s", name)
+			}
+			includedNames[name]++
+		} else {
+			includedNames[name] = 1
+		}
+		err := t.ExecuteTemplate(&buf, name, data)
+		includedNames[name]--
+		return buf.String(), err
+	}
+}
+
+func tplFun(parent *template.Template, includedNames map[string]int, strict bool) func(string, interface{}) (string, error) {
+	return func(tpl string, vals interface{}) (string, error) {
+		t, err := parent.Clone()
+		if err != nil {
+			return "", fmt.Errorf("cannot clone template: %v", err)
+		}
+
+		// the clone loses the missingkey option
+		if strict {
+			t.Option("missingkey=error")
+		} else {
+			t.Option("missingkey=zero")
+		}
+		t.Funcs(template.FuncMap{
+			"include": includeFun(t, includedNames),
+			"tpl":     tplFun(t, includedNames, strict),
+		})
+
+		t, err = t.New(parent.Name()).Parse(tpl)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse template %q: %v", tpl, err)
+		}
+
+		var buf strings.Builder
+		if err := t.Execute(&buf, vals); err != nil {
+			return "", fmt.Errorf("error during tpl function execution for %q: %v", tpl, err)
+		}
+		return strings.ReplaceAll(buf.String(), noValue, ""), nil
+	}
+}
+
+func toYAML(v interface{}) string {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func fromYAML(str string) map[string]interface{} {
+	m := map[string]interface{}{}
+
+	if err := yaml.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+func fromYAMLArray(str string) []interface{} {
+	a := []interface{}{}
+
+	if err := yaml.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+func toTOML(v interface{}) string {
+	b := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(b).Encode(v); err != nil {
+		return err.Error()
+	}
+	return b.String()
+}
+
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func fromJSON(str string) map[string]interface{} {
+	m := make(map[string]interface{})
+
+	if err := json.Unmarshal([]byte(str), &m); err != nil {
+		m["Error"] = err.Error()
+	}
+	return m
+}
+
+func fromJSONArray(str string) []interface{} {
+	a := []interface{}{}
+
+	if err := json.Unmarshal([]byte(str), &a); err != nil {
+		a = []interface{}{err.Error()}
+	}
+	return a
+}
+
+// chartFiles is the .Files object of the templates.
+type chartFiles map[string][]byte
+
+func newChartFiles(from []*chart.File) chartFiles {
+	files := make(chartFiles, len(from))
+	for _, f := range from {
+		files[f.Name] = f.Data
+	}
+	return files
+}
+
+// GetBytes gets a file by path.
+func (f chartFiles) GetBytes(name string) []byte {
+	if v, ok := f[name]; ok {
+		return v
+	}
+	return []byte{}
+}
+
+// Get returns a string representation of the given file.
+func (f chartFiles) Get(name string) string {
+	return string(f.GetBytes(name))
+}
+
+// Glob returns the files matched the glob pattern.
+func (f chartFiles) Glob(pattern string) chartFiles {
+	g, err := glob.Compile(pattern, '/')
+	if err != nil {
+		g, _ = glob.Compile("**")
+	}
+
+	nf := newChartFiles(nil)
+	for name, contents := range f {
+		if g.Match(name) {
+			nf[name] = contents
+		}
+	}
+	return nf
+}
+
+// AsConfig flattens the files to a YAML map keyed by the file names.
+func (f chartFiles) AsConfig() string {
+	if f == nil {
+		return ""
+	}
+
+	m := make(map[string]string)
+	for k, v := range f {
+		m[path.Base(k)] = string(v)
+	}
+	return toYAML(m)
+}
+
+// AsSecrets flattens the base64-encoded files to a YAML map keyed by the file names.
+func (f chartFiles) AsSecrets() string {
+	if f == nil {
+		return ""
+	}
+
+	m := make(map[string]string)
+	for k, v := range f {
+		m[path.Base(k)] = base64.StdEncoding.EncodeToString(v)
+	}
+	return toYAML(m)
+}
+
+// Lines returns each line of a named file.
+func (f chartFiles) Lines(path string) []string {
+	if f == nil || f[path] == nil {
+		return []string{}
+	}
+	s := string(f[path])
+	if s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
+	return strings.Split(s, "\n")
+}
+
+// templateFuncs returns the names of the functions called by the templates.
+func templateFuncs(t *template.Template) map[string]bool {
+	funcs := make(map[string]bool)
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IdentifierNode:
+			funcs[n.Ident] = true
+		}
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			walk(tmpl.Tree.Root)
+		}
+	}
+	return funcs
+}
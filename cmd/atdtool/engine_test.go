@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+func writeChart(t *testing.T, files map[string]string) string {
+	dir := filepath.Join(t.TempDir(), "demo")
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestChartRendererMatchesHelmEngine(t *testing.T) {
+	chartPath := writeChart(t, map[string]string{
+		"Chart.yaml":       "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"values.yaml":      "name: demo\n",
+		"data/table.txt":   "a\nb\n",
+		"cfg/_helpers.tpl": `{{- define "demo.addr" -}}{{ .Values.bus_addr }}{{- end -}}`,
+		"cfg/demo.yaml.tpl": `chart: {{ .Chart.Name }}
+addr: {{ include "demo.addr" . }}
+missing: {{ .Values.missing }}
+tpl: {{ tpl "{{ .Values.name }}" . }}
+lines: {{ .Files.Lines "data/table.txt" | toJson }}
+template: {{ .Template.Name }}
+{{ toYaml .Values.list }}
+`,
+		"cfg/sub/demo.conf.tpl": "{{ .Values.name | upper }}\n",
+	})
+
+	vals := map[string]any{
+		"name":     "demo",
+		"bus_addr": "1.2.3.4",
+		"list":     []any{"x", "y"},
+	}
+
+	helmOut := t.TempDir()
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NoError(t, render(chrt, vals, &localWriter{root: helmOut}, "", "_1.2.3.4", defaultTemplateExts, nil)) {
+		return
+	}
+
+	r, err := newChartRenderer(chartPath, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the parsed templates are reused by the instances
+	for i := 0; i < 2; i++ {
+		out := t.TempDir()
+		if !assert.NoError(t, r.render(vals, &localWriter{root: out}, "", "_1.2.3.4")) {
+			return
+		}
+
+		for _, name := range []string{filepath.Join("cfg", "demo_1.2.3.4.yaml"), filepath.Join("cfg", "sub", "demo_1.2.3.4.conf")} {
+			want, err := os.ReadFile(filepath.Join(helmOut, name))
+			if !assert.NoError(t, err) {
+				continue
+			}
+			got, err := os.ReadFile(filepath.Join(out, name))
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(want), string(got), name)
+			}
+		}
+		assert.NoFileExists(t, filepath.Join(out, "cfg", "_helpers"))
+	}
+}
+
+// readOutput returns the files of the output by their slash separated paths.
+func readOutput(t *testing.T, root string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestChartRendererHelmParity(t *testing.T) {
+	var charts []string
+	for _, dir := range []string{fixturePath("charts"), fixturePath("engine")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			charts = append(charts, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	instance := map[string]any{
+		"bus_addr":    "1.2.42.3",
+		"world_id":    1,
+		"zone_id":     2,
+		"instance_id": 3,
+		"type_id":     42,
+		"type_name":   "echo",
+	}
+	for _, chartPath := range charts {
+		t.Run(filepath.Base(chartPath), func(t *testing.T) {
+			r, err := newChartRenderer(chartPath, nil, nil)
+			if !assert.NoError(t, err) || !assert.NotNil(t, r.tmpl, "rendered by the Helm engine") {
+				return
+			}
+			// the values are merged for each rendering, since the Helm engine
+			// processes them
+			values := func() chartutil.Values {
+				vals, err := chartutil.CoalesceValues(r.chrt, instance)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return vals
+			}
+
+			helmOut, out := t.TempDir(), t.TempDir()
+			chrt, err := loader.Load(chartPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !assert.NoError(t, render(chrt, values(), &localWriter{root: helmOut}, "", "_1.2.42.3", defaultTemplateExts, nil)) {
+				return
+			}
+			if !assert.NoError(t, r.render(values(), &localWriter{root: out}, "", "_1.2.42.3")) {
+				return
+			}
+
+			want := readOutput(t, helmOut)
+			assert.NotEmpty(t, want)
+			got := readOutput(t, out)
+			assert.Equal(t, slices.Sorted(maps.Keys(want)), slices.Sorted(maps.Keys(got)))
+			for name := range want {
+				assert.Equal(t, want[name], got[name], name)
+			}
+		})
+	}
+}
+
+func TestChartRendererHelmErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		// parsed reports whether the chart is rendered by chartRenderer
+		parsed bool
+	}{
+		{"required", `{{ required "name is required" .Values.name }}`, true},
+		{"fail", `{{ fail "failed" }}`, true},
+		{"fail in tpl", `{{ tpl "{{ fail \"failed in tpl\" }}" . }}`, true},
+		{"missing include", `{{ include "missing" . }}`, true},
+		{"recursive include", `{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`, true},
+		{"nil pointer", `{{ .Values.a.b.c }}`, true},
+		{"lines of empty file", `{{ .Files.Lines "empty.txt" }}`, true},
+		{"parse error", `{{ .Values.name `, false},
+		{"undefined function", `{{ undefined .Values.name }}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chartPath := writeChart(t, map[string]string{
+				"Chart.yaml":        "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+				"empty.txt":         "",
+				"cfg/demo.yaml.tpl": tt.template,
+			})
+
+			chrt, err := loader.Load(chartPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, want := helmRender(chrt, chartutil.Values{}, defaultTemplateExts)
+			if !assert.Error(t, want) {
+				return
+			}
+
+			r, err := newChartRenderer(chartPath, nil, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.parsed, r.tmpl != nil)
+			assert.EqualError(t, r.render(chartutil.Values{}, &localWriter{root: t.TempDir()}, "", ""), want.Error())
+		})
+	}
+}
+
+func TestChartRendererHelmFuncs(t *testing.T) {
+	for _, name := range helmFuncs {
+		t.Run(name, func(t *testing.T) {
+			call := map[string]string{
+				"lookup":        `{{ lookup "v1" "Pod" "" "" | toJson }}`,
+				"getHostByName": `{{ getHostByName "localhost" }}`,
+				"toToml":        `{{ toToml .Values }}`,
+			}[name]
+			chartPath := writeChart(t, map[string]string{
+				"Chart.yaml":        "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+				"values.yaml":       "name: demo\n",
+				"cfg/demo.yaml.tpl": call,
+			})
+
+			// the chart is rendered by the Helm engine
+			r, err := newChartRenderer(chartPath, nil, nil)
+			if assert.NoError(t, err) {
+				assert.Nil(t, r.tmpl)
+				assert.NoError(t, r.render(chartutil.Values{"name": "demo"}, &localWriter{root: t.TempDir()}, "", ""))
+			}
+
+			// which has no bus address functions
+			if err := os.WriteFile(filepath.Join(chartPath, "cfg", "demo.yaml.tpl"), []byte(call+"{{ uniqID .Values.bus_addr }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err = newChartRenderer(chartPath, nil, nil)
+			assert.ErrorContains(t, err, "calls "+name+" of the Helm engine")
+		})
+	}
+}
+
+func TestChartRendererExecutionError(t *testing.T) {
+	chartPath := writeChart(t, map[string]string{
+		"Chart.yaml":        "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"cfg/demo.yaml.tpl": `{{ required "name is required" .Values.name }}`,
+	})
+
+	r, err := newChartRenderer(chartPath, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ErrorContains(t, r.render(map[string]any{}, &localWriter{root: t.TempDir()}, "", ""), "name is required")
+}
+
+func TestNoValueWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &noValueWriter{w: bufio.NewWriter(&out)}
+
+	for _, s := range []string{"a: <no", " value>\n", "b: <no value><", "no value>", "c: <n"} {
+		_, err := w.Write([]byte(s))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "a: \nb: c: <n", out.String())
+}
+
+func TestOutputFilePath(t *testing.T) {
+	dir, name := outputFilePath("demo", "demo/cfg/sub/demo.conf.tpl", "svc", "_1.2.3.4")
+	assert.Equal(t, "svc/cfg/sub", dir)
+	assert.Equal(t, "demo_1.2.3.4.conf", name)
+
+	// the subchart is kept under the directory of the parent chart
+	dir, name = outputFilePath("demo", "demo/charts/db/cfg/db.tpl", "", "_1")
+	assert.Equal(t, "charts/db/cfg", dir)
+	assert.Equal(t, "db_1", name)
+
+	// only the chart directory itself is trimmed
+	dir, _ = outputFilePath("demo", "demo-ext/cfg/demo.conf.tpl", "svc", "")
+	assert.Equal(t, "svc/demo-ext/cfg", dir)
+}
+
+func TestChartRendererBusAddrFuncs(t *testing.T) {
+	chartPath := writeChart(t, map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"cfg/demo.yaml.tpl": `uniq: {{ uniqID .Values.bus_addr }}
+logic: {{ logicID .Values.bus_addr }}
+zone_shift: {{ addrShift "zone" }}
+router: {{ busAddr .Values.world_id .Values.zone_id (funcIDOf "router") 1 }}
+`,
+	})
+	cfg := &noncloudnative.Config{Deploy: &noncloudnative.DeployConf{
+		BusAddrMask: "8.8.8.8",
+		Instance:    []*noncloudnative.DeployUnit{{Name: "router", TypeId: "7"}},
+	}}
+	vals := map[string]any{"bus_addr": "1.2.42.3", "world_id": uint64(1), "zone_id": uint64(2)}
+
+	r, err := newChartRenderer(chartPath, cfg, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out := t.TempDir()
+	if !assert.NoError(t, r.render(vals, &localWriter{root: out}, "", "")) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(out, "cfg", "demo.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "uniq: 16919043\nlogic: 258\nzone_shift: 16\nrouter: 1.2.7.1\n", string(data))
+	}
+
+	// the ids exceeding the mask and the unknown charts fail the rendering
+	vals["bus_addr"] = "1.256.42.3"
+	assert.ErrorContains(t, r.render(vals, &localWriter{root: t.TempDir()}, "", ""), "zone id 256 exceeds 8 bits")
+
+	r, err = newChartRenderer(chartPath, nil, nil)
+	if assert.NoError(t, err) {
+		assert.ErrorContains(t, r.render(vals, &localWriter{root: t.TempDir()}, "", ""), "deploy configuration is not loaded")
+	}
+}
+
+func TestChartRendererTemplateExts(t *testing.T) {
+	chartPath := writeChart(t, map[string]string{
+		"Chart.yaml":             "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"cfg/demo.yaml":          "name: {{ .Values.name }}\n",
+		"cfg/demo.conf.template": "name={{ .Values.name }}\n",
+		"bin/start.tpl":          "echo {{ .Values.name }}\n",
+		"data/table.txt":         "{{ .Values.name }}\n",
+	})
+	vals := map[string]any{"name": "demo"}
+
+	tests := []struct {
+		exts  []string
+		files map[string]string
+	}{
+		{nil, map[string]string{
+			"cfg/demo_1.conf": "name=demo\n",
+			"bin/start_1":     "echo demo\n",
+		}},
+		{[]string{".tpl", ".template", "yaml"}, map[string]string{
+			"cfg/demo_1.yaml": "name: demo\n",
+			"cfg/demo_1.conf": "name=demo\n",
+			"bin/start_1":     "echo demo\n",
+		}},
+	}
+	for _, tt := range tests {
+		exts, err := parseTemplateExts(tt.exts)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		r, err := newChartRenderer(chartPath, nil, exts)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		w := &memoryWriter{}
+		if !assert.NoError(t, r.render(vals, w, "", "_1"), tt.exts) {
+			continue
+		}
+		assert.ElementsMatch(t, slices.Collect(maps.Keys(tt.files)), w.names, tt.exts)
+		for name, want := range tt.files {
+			if assert.Contains(t, w.files, name) {
+				assert.Equal(t, want, w.files[name].String(), name)
+			}
+		}
+	}
+
+	_, err := parseTemplateExts([]string{"*.yaml"})
+	assert.ErrorContains(t, err, "invalid template extension")
+	_, err = parseTemplateExts([]string{"."})
+	assert.ErrorContains(t, err, "invalid template extension")
+}
@@ -0,0 +1,57 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputFilePathWindows(t *testing.T) {
+	dir, name := outputFilePath("demo", "demo/cfg/sub/demo.conf.tpl", `local\svc`, "_1")
+	assert.Equal(t, "local/svc/cfg/sub", dir)
+	assert.Equal(t, "demo_1.conf", name)
+}
+
+func TestChartRendererLongPath(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// the chart and the output are deeper than MAX_PATH
+	deep := strings.Repeat("deep"+string(filepath.Separator), 60)
+	chartPath := filepath.Join(deep, "demo")
+	files := map[string]string{
+		"Chart.yaml":        "apiVersion: v2\nname: demo\nversion: 0.1.0\n",
+		"cfg/demo.yaml.tpl": "name: {{ .Values.name }}\n",
+	}
+	for name, content := range files {
+		p, _ := filepath.Abs(filepath.Join(chartPath, filepath.FromSlash(name)))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := newChartRenderer(chartPath, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out := filepath.Join(deep, "out")
+	if !assert.NoError(t, r.render(map[string]any{"name": "demo"}, &localWriter{root: out}, "svc", "")) {
+		return
+	}
+
+	// os supports the absolute long paths by itself
+	outFile, _ := filepath.Abs(filepath.Join(out, "svc", "cfg", "demo.yaml"))
+	got, err := os.ReadFile(outFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "name: demo\n", string(got))
+	}
+}
@@ -19,6 +19,7 @@ type execOptions struct {
 	runCmdArgs []string
 	workDir    string
 	timeout    time.Duration
+	dryRun     bool
 }
 
 func newExecCmd(out io.Writer) *cobra.Command {
@@ -48,6 +49,7 @@ func newExecCmd(out io.Writer) *cobra.Command {
 	f.StringVarP(&o.workDir, "workdir", "r", "", "specify run command root path")
 	f.StringSliceVar(&o.runCmdArgs, "args", nil, "arguments used by run command, multiple args separated by comma")
 	f.DurationVar(&o.timeout, "timeout", 5*time.Minute, "time to wait for command execution")
+	f.BoolVar(&o.dryRun, "dry-run", false, "print the resolved command as JSON without executing it")
 	return cmd
 }
 
@@ -56,6 +58,14 @@ func (o *execOptions) run(out io.Writer) error {
 		return nil
 	}
 
+	if o.dryRun {
+		plan, err := newCommandPlan(o.runCmd, o.runCmdArgs, o.workDir, o.timeout)
+		if err != nil {
+			return err
+		}
+		return printDryRun(out, &dryRunResult{Command: plan})
+	}
+
 	ctx, cancle := context.WithTimeout(context.Background(), o.timeout)
 	defer cancle()
 	cmd := exec.CommandContext(ctx, o.runCmd, o.runCmdArgs...)
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/cli/values"
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const explainValueDesc = `
+Explain which source supplies the final value of a key in a chart.
+
+The key is a dot-separated path such as 'cache.size'. The values are merged in
+the same way as 'merge-values', the sources are listed from the highest
+precedence to the lowest:
+
+    set       the '--set' flags and the '-f' values files
+    service   '<values path>/<type_name|func_name|chart name>.yaml'
+    chart     the values.yaml of the chart
+    global    '<values path>/global.yaml'
+    module    '<values path>/modules/<module>.yaml' of the enabled modules
+
+The sources of the remote values paths are marked as remote. The source which
+supplies the final value is marked with '*', all the sources are marked if the
+value is a table merged from them.
+`
+
+type explainValueOptions struct {
+	chartPath string
+	key       string
+	valOpts   values.Options
+}
+
+func newExplainValueCmd(out io.Writer) *cobra.Command {
+	o := &explainValueOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "explain-value [CHART] KEY",
+		Short: "Explain which source supplies the value of a key",
+		Long:  explainValueDesc,
+		Args:  require.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.chartPath = args[0]
+			o.key = args[1]
+			return o.run(out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	addValueOptionsFlags(cmd.Flags(), &o.valOpts)
+	return cmd
+}
+
+// lookupValue returns the value of the dot-separated key.
+func lookupValue(vals map[string]any, key string) (any, bool) {
+	var cur any = vals
+	for _, k := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[k]; !ok || cur == nil {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func (o *explainValueOptions) run(out io.Writer) error {
+	if strings.Trim(o.key, ".") != o.key || strings.Contains(o.key, "..") {
+		return fmt.Errorf("invalid key: %q", o.key)
+	}
+
+	valuePaths, err := o.valOpts.MergePaths()
+	if err != nil {
+		return err
+	}
+	// the paths are resolved in order, the remote ones are fetched into the cache
+	remotes := make(map[string]string)
+	for i, p := range o.valOpts.Paths {
+		if i < len(valuePaths) && values.IsRemote(p) {
+			remotes[valuePaths[i]] = p
+		}
+	}
+
+	optVals, err := o.valOpts.MergeValues()
+	if err != nil {
+		return err
+	}
+
+	chrt, err := loader.Load(util.LongPath(o.chartPath))
+	if err != nil {
+		return err
+	}
+	sources, err := util.ChartValuesSources(chrt, valuePaths, o.valOpts.MergeOptions(), optVals)
+	if err != nil {
+		return err
+	}
+	vals, err := util.MergeLoadedChartValues(chrt, valuePaths, o.valOpts.MergeOptions(), optVals, nil)
+	if err != nil {
+		return err
+	}
+	final, ok := lookupValue(vals, o.key)
+	if !ok {
+		return fmt.Errorf("key %s is not set in chart %s", o.key, chrt.Name())
+	}
+
+	_, merged := final.(map[string]any)
+	var lines []string
+	winner := false
+	for i := len(sources) - 1; i >= 0; i-- {
+		src := sources[i]
+		v, ok := lookupValue(src.Values, o.key)
+		if !ok {
+			continue
+		}
+
+		kind := src.Kind
+		var location string
+		switch src.Kind {
+		case util.ValuesSourceSet:
+			location = "command line"
+		case util.ValuesSourceChart:
+			location = filepath.Join(o.chartPath, "values.yaml")
+		default:
+			location = src.File
+			if remote, ok := remotes[src.ValuesPath]; ok {
+				kind = "remote " + kind
+				location = fmt.Sprintf("%s (%s)", remote, filepath.ToSlash(strings.TrimPrefix(src.File, src.ValuesPath+string(filepath.Separator))))
+			}
+		}
+
+		_, isMap := v.(map[string]any)
+		mark := " "
+		if merged && isMap || !merged && !winner && !isMap {
+			mark = "*"
+			winner = !merged
+		}
+		lines = append(lines, fmt.Sprintf("%s %-15s %s", mark, kind, location))
+	}
+
+	value, err := yaml.Marshal(final)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "key: %s\n", o.key)
+	if merged {
+		fmt.Fprintf(out, "value:\n%s", indentLines(string(value), "  "))
+	} else {
+		fmt.Fprintf(out, "value: %s", value)
+	}
+	fmt.Fprintln(out, "sources:")
+	for _, l := range lines {
+		fmt.Fprintln(out, l)
+	}
+	return nil
+}
+
+// indentLines indents each line of s.
+func indentLines(s, indent string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = indent + l
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestExplainValueOptionsRun(t *testing.T) {
+	chartPath := fixturePath("charts", "echo")
+	valuesPath := fixturePath("values", "default")
+	explain := func(key string, set ...string) (string, error) {
+		o := &explainValueOptions{
+			chartPath: chartPath,
+			key:       key,
+			valOpts:   values.Options{Paths: []string{valuesPath}, Values: set},
+		}
+		stdout := &bytes.Buffer{}
+		err := o.run(stdout)
+		return stdout.String(), err
+	}
+
+	got, err := explain("shared")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "key: shared\nvalue: service\nsources:\n"+
+		"* service         "+filepath.Join(valuesPath, "echo.yaml")+"\n"+
+		"  chart           "+filepath.Join(chartPath, "values.yaml")+"\n"+
+		"  global          "+filepath.Join(valuesPath, "global.yaml")+"\n", got)
+
+	got, err = explain("shared", "shared=cli")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, got, "value: cli\nsources:\n* set             command line\n  service ")
+
+	// the tables are merged from all the sources
+	got, err = explain("extra")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, got, "value:\n  enabled: true\n  from_module: module-default\n")
+	assert.Contains(t, got, "* module          "+filepath.Join(valuesPath, "modules", "extra.yaml")+"\n")
+	assert.Contains(t, got, "* chart ")
+
+	_, err = explain("nonexistence.key")
+	assert.ErrorContains(t, err, "key nonexistence.key is not set")
+	_, err = explain("shared..key")
+	assert.ErrorContains(t, err, "invalid key")
+}
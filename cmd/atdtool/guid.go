@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/pkg/guid"
+	"github.com/atframework/atdtool/pkg/snowflake"
+)
+
+const guidDesc = `
+Generate the unique ids by the snowflake algorithm.
+
+The worker id is derived from the local ipv4 address by default, '--worker-id'
+specifies it explicitly, which must be unique among the processes generating
+the ids at the same time.
+`
+
+const guidGenDesc = `
+Generate the unique ids by the algorithm.
+
+The algorithms are snowflake (default), uuid4, uuidv7, ulid and ksuid. The ids
+are printed in the standard format of the algorithm by default, the decimal of
+snowflake, the canonical form of uuid, the crockford base32 of ulid and the
+base62 of ksuid, '--format' prints them in dec, hex or base62 instead.
+
+The uuidv7 and the ulid ids generated in a batch are monotonic even in the same
+millisecond.
+`
+
+const guidDecodeDesc = `
+Decode the snowflake ids into the time, the worker id and the sequence.
+
+The worker id is also shown as the last two octets of the ipv4 address, which is
+the host generating the id if its worker id is derived from the local address.
+`
+
+type guidOptions struct {
+	count     int
+	workerId  int64
+	algorithm string
+	format    string
+}
+
+type guidDecodeOptions struct {
+	ids    []string
+	utc    bool
+	format string
+}
+
+// guidDecodeResult is the decomposition of an id.
+type guidDecodeResult struct {
+	ID        int64  `json:"id"`
+	Time      string `json:"time"`
+	WorkerId  int64  `json:"workerId"`
+	IPSuffix  string `json:"ipSuffix"`
+	Sequence  int64  `json:"sequence"`
+	Timestamp int64  `json:"timestampMs"`
+}
+
+type guidWorkerIdGenerator int64
+
+func (g guidWorkerIdGenerator) Id() (int64, error) {
+	return int64(g), nil
+}
+
+func newGuidCmd(out io.Writer) *cobra.Command {
+	o := &guidOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "guid",
+		Short: "Generate the unique ids by the snowflake algorithm",
+		Long:  guidDesc,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	o.addFlags(cmd)
+
+	cmd.AddCommand(newGuidGenCmd(out))
+	cmd.AddCommand(newGuidDecodeCmd(out))
+	cmd.AddCommand(newGuidServeCmd(out))
+	return cmd
+}
+
+func newGuidGenCmd(out io.Writer) *cobra.Command {
+	o := &guidOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "gen",
+		Short: "Generate the unique ids by the algorithm",
+		Long:  guidGenDesc,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	o.addFlags(cmd)
+	return cmd
+}
+
+func (o *guidOptions) addFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.IntVarP(&o.count, "count", "n", 1, "number of the ids to generate")
+	f.Int64Var(&o.workerId, "worker-id", -1, "worker id of the snowflake ids, derived from the local ipv4 address if it is negative")
+	f.StringVar(&o.algorithm, "algorithm", string(guid.Snowflake), "algorithm of the ids, snowflake, uuid4, uuidv7, ulid or ksuid")
+	f.StringVar(&o.format, "format", "default", "output format of the ids, default, dec, hex or base62")
+}
+
+func (o *guidOptions) run(out io.Writer) error {
+	algorithm, err := guid.ParseAlgorithm(o.algorithm)
+	if err != nil {
+		return err
+	}
+	format, err := guid.ParseFormat(o.format)
+	if err != nil {
+		return err
+	}
+	if o.count <= 0 {
+		return fmt.Errorf("invalid count: %d", o.count)
+	}
+
+	if algorithm == guid.Snowflake {
+		var generator snowflake.WorkerIdGenerator
+		if o.workerId >= 0 {
+			generator = guidWorkerIdGenerator(o.workerId)
+		}
+		ids, err := snowflake.NewSnowFlake(generator).NextVals(o.count)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, uint64(id))
+			fmt.Fprintln(out, guid.Encode(algorithm, b, format))
+		}
+		return nil
+	}
+
+	generator, err := guid.NewGenerator(algorithm)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < o.count; i++ {
+		id, err := generator.Next()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, guid.Encode(algorithm, id, format))
+	}
+	return nil
+}
+
+func newGuidDecodeCmd(out io.Writer) *cobra.Command {
+	o := &guidDecodeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "decode ID...",
+		Short: "Decode the snowflake ids",
+		Long:  guidDecodeDesc,
+		Args:  require.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.ids = args
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&o.utc, "utc", false, "print the time in UTC instead of the local time zone")
+	f.StringVar(&o.format, "format", "text", "output format, text or json")
+	return cmd
+}
+
+func (o *guidDecodeOptions) run(out io.Writer) error {
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("invalid output format: %s, should be text or json", o.format)
+	}
+
+	results := make([]*guidDecodeResult, 0, len(o.ids))
+	for _, s := range o.ids {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid id: %s", s)
+		}
+		id, err := snowflake.Parse(n)
+		if err != nil {
+			return err
+		}
+		t := id.Timestamp
+		if o.utc {
+			t = t.UTC()
+		}
+		results = append(results, &guidDecodeResult{
+			ID:        n,
+			Time:      t.Format("2006-01-02T15:04:05.000Z07:00"),
+			WorkerId:  id.WorkerId,
+			IPSuffix:  id.IPSuffix(),
+			Sequence:  id.Sequence,
+			Timestamp: id.Timestamp.UnixMilli(),
+		})
+	}
+
+	if o.format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for i, r := range results {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "id:         %d\n", r.ID)
+		fmt.Fprintf(out, "time:       %s (%s ago)\n", r.Time, time.Since(time.UnixMilli(r.Timestamp)).Truncate(time.Second))
+		fmt.Fprintf(out, "worker id:  %d (ip %s)\n", r.WorkerId, r.IPSuffix)
+		fmt.Fprintf(out, "sequence:   %d\n", r.Sequence)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+
+	"github.com/atframework/atdtool/pkg/snowflake"
+)
+
+const guidServeDesc = `
+Run a http service handing out the snowflake ids, so that the tools which can
+not link the go code could still get the collision-free ids.
+
+The endpoints are:
+
+  GET /v1/guid                  one id, {"id":"..."}
+  GET /v1/guid/batch?count=N    N ids in increasing order, {"ids":["...",...]}
+  GET /healthz                  200 if the worker id is available, 503 otherwise
+
+The ids are strings in json since they exceed the safe integers of javascript,
+'?format=text' returns them one per line instead. Only http is served, there is
+no grpc service, the json endpoints could be called by any language without the
+generated stubs.
+
+The worker id is coordinated by '--worker-id-source', a lease directory shared
+by the instances ('lease' with '--lease-dir'), etcd ('etcd' with
+'--etcd-endpoint'), or the static sources ip, env, file and pod. The worker id
+is released when the service exits on SIGINT or SIGTERM.
+`
+
+// defaultGuidMaxBatch is the max count of the ids of a batch request by default.
+const defaultGuidMaxBatch = 10000
+
+type guidServeOptions struct {
+	listen       string
+	workerId     int64
+	source       string
+	leaseDir     string
+	etcdEndpoint string
+	etcdPrefix   string
+	ttl          time.Duration
+	stateFile    string
+	maxBatch     int
+}
+
+func newGuidServeCmd(out io.Writer) *cobra.Command {
+	o := &guidServeOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a http service handing out the snowflake ids",
+		Long:  guidServeDesc,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&o.listen, "listen", ":8080", "address of the http service")
+	f.Int64Var(&o.workerId, "worker-id", -1, "static worker id, '--worker-id-source' is used if it is negative")
+	f.StringVar(&o.source, "worker-id-source", snowflake.WorkerIdSourceIP, "source of the worker id, ip, env, file, pod, etcd or lease")
+	f.StringVar(&o.leaseDir, "lease-dir", "", "shared directory of the lease files of the lease source")
+	f.StringVar(&o.etcdEndpoint, "etcd-endpoint", "", "url of the grpc gateway of etcd of the etcd source, like http://127.0.0.1:2379")
+	f.StringVar(&o.etcdPrefix, "etcd-prefix", "", "key prefix of the worker ids of the etcd source")
+	f.DurationVar(&o.ttl, "ttl", 0, "ttl of the worker id held by the etcd or lease source, 60s by default")
+	f.StringVar(&o.stateFile, "state-file", "", "file saving the max timestamp, so that the ids are not repeated if the clock moves backwards across restarts")
+	f.IntVar(&o.maxBatch, "max-batch", defaultGuidMaxBatch, "max count of the ids of a batch request")
+	return cmd
+}
+
+// workerIdGenerator creates the worker id generator of the options.
+func (o *guidServeOptions) workerIdGenerator() (snowflake.WorkerIdGenerator, error) {
+	if o.workerId >= 0 {
+		return guidWorkerIdGenerator(o.workerId), nil
+	}
+	return snowflake.NewWorkerIdGenerator(snowflake.WorkerIdOptions{
+		Source: o.source,
+		Etcd:   snowflake.EtcdWorkerIdOptions{Endpoint: o.etcdEndpoint, Prefix: o.etcdPrefix, TTL: o.ttl},
+		Lease:  snowflake.LeaseWorkerIdOptions{Dir: o.leaseDir, TTL: o.ttl},
+	})
+}
+
+func (o *guidServeOptions) run(out io.Writer) error {
+	if o.maxBatch <= 0 {
+		return fmt.Errorf("invalid max batch: %d", o.maxBatch)
+	}
+	workerIds, err := o.workerIdGenerator()
+	if err != nil {
+		return err
+	}
+	if c, ok := workerIds.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				log.Printf("[WARN] release worker id: %v", err)
+			}
+		}()
+	}
+	workerId, err := workerIds.Id()
+	if err != nil {
+		return err
+	}
+	generator, err := snowflake.NewSnowFlakeWithOptions(workerIds, snowflake.Options{StateFile: o.stateFile})
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", o.listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: newGuidHandler(generator, workerIds, o.maxBatch), ReadHeaderTimeout: 10 * time.Second}
+	fmt.Fprintf(out, "guid service is listening on %s with worker id %d\n", listener.Addr(), workerId)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(listener)
+	}()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(ch)
+	select {
+	case err := <-errCh:
+		return err
+	case s := <-ch:
+		log.Printf("[INFO] guid service exits due to %v signal", s)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// guidHandler serves the snowflake ids over http.
+type guidHandler struct {
+	generator *snowflake.Snowflake
+	workerIds snowflake.WorkerIdGenerator
+	maxBatch  int
+}
+
+func newGuidHandler(generator *snowflake.Snowflake, workerIds snowflake.WorkerIdGenerator, maxBatch int) http.Handler {
+	h := &guidHandler{generator: generator, workerIds: workerIds, maxBatch: maxBatch}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/guid", h.single)
+	mux.HandleFunc("/v1/guid/batch", h.batch)
+	mux.HandleFunc("/healthz", h.healthz)
+	return mux
+}
+
+func (h *guidHandler) single(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	id, err := h.generator.NextVal()
+	if err != nil {
+		guidError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		fmt.Fprintln(w, id)
+		return
+	}
+	guidJSON(w, map[string]string{"id": strconv.FormatInt(id, 10)})
+}
+
+func (h *guidHandler) batch(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count <= 0 || count > h.maxBatch {
+		guidError(w, http.StatusBadRequest, fmt.Errorf("count should be between 1 and %d", h.maxBatch))
+		return
+	}
+	ids, err := h.generator.NextVals(count)
+	if err != nil {
+		guidError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	values := make([]string, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, strconv.FormatInt(id, 10))
+	}
+	if r.URL.Query().Get("format") == "text" {
+		fmt.Fprintln(w, strings.Join(values, "\n"))
+		return
+	}
+	guidJSON(w, map[string][]string{"ids": values})
+}
+
+func (h *guidHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	id, err := h.workerIds.Id()
+	if err != nil {
+		guidError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	guidJSON(w, map[string]int64{"workerId": id})
+}
+
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", "GET, POST")
+	guidError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	return false
+}
+
+func guidJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func guidError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/pkg/snowflake"
+)
+
+func TestGuidRun(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	o := &guidOptions{count: 3, workerId: 2571}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	lines := strings.Fields(stdout.String())
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+
+	stdout.Reset()
+	d := &guidDecodeOptions{ids: lines, utc: true, format: "json"}
+	if !assert.NoError(t, d.run(stdout)) {
+		return
+	}
+	var results []*guidDecodeResult
+	if !assert.NoError(t, json.Unmarshal(stdout.Bytes(), &results)) || !assert.Len(t, results, 3) {
+		return
+	}
+	for i, r := range results {
+		assert.Equal(t, lines[i], strconv.FormatInt(r.ID, 10))
+		assert.Equal(t, int64(2571), r.WorkerId)
+		assert.Equal(t, "*.*.10.11", r.IPSuffix)
+		assert.True(t, strings.HasSuffix(r.Time, "Z"), r.Time)
+	}
+
+	stdout.Reset()
+	d.format = "text"
+	if assert.NoError(t, d.run(stdout)) {
+		assert.Contains(t, stdout.String(), "worker id:  2571 (ip *.*.10.11)")
+	}
+}
+
+func TestGuidGenRun(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		format    string
+		length    int
+	}{
+		{"uuid4", "default", 36},
+		{"uuidv7", "hex", 32},
+		{"ulid", "default", 26},
+		{"ksuid", "default", 27},
+		{"uuidv7", "base62", 22},
+		{"snowflake", "hex", 16},
+	}
+
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		o := &guidOptions{count: 3, workerId: 1, algorithm: tt.algorithm, format: tt.format}
+		if !assert.NoError(t, o.run(stdout), tt.algorithm) {
+			continue
+		}
+		lines := strings.Fields(stdout.String())
+		if assert.Len(t, lines, 3, tt.algorithm) {
+			for _, line := range lines {
+				assert.Len(t, line, tt.length, "%s %s", tt.algorithm, tt.format)
+			}
+		}
+	}
+}
+
+func TestGuidRunInvalidOptions(t *testing.T) {
+	assert.Error(t, (&guidOptions{count: 0, workerId: 1}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidOptions{count: 1, workerId: 1 << 16}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidOptions{count: 1, algorithm: "uuid1"}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidOptions{count: 1, algorithm: "ulid", format: "base32"}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidOptions{count: 0, algorithm: "ulid"}).run(&bytes.Buffer{}))
+
+	assert.Error(t, (&guidDecodeOptions{ids: []string{"abc"}, format: "text"}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidDecodeOptions{ids: []string{"-1"}, format: "text"}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidDecodeOptions{ids: []string{"1"}, format: "yaml"}).run(&bytes.Buffer{}))
+}
+
+// lostWorkerIdGenerator is the worker id lost by the lease.
+type lostWorkerIdGenerator struct{}
+
+func (lostWorkerIdGenerator) Id() (int64, error) {
+	return 0, fmt.Errorf("worker id is lost")
+}
+
+func TestGuidServeHandler(t *testing.T) {
+	workerIds := guidWorkerIdGenerator(2571)
+	srv := httptest.NewServer(newGuidHandler(snowflake.NewSnowFlake(workerIds), workerIds, 100))
+	defer srv.Close()
+
+	get := func(path string) (int, []byte) {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	code, body := get("/v1/guid")
+	var single struct {
+		ID string `json:"id"`
+	}
+	if assert.Equal(t, http.StatusOK, code) && assert.NoError(t, json.Unmarshal(body, &single)) {
+		n, err := strconv.ParseInt(single.ID, 10, 64)
+		if assert.NoError(t, err) {
+			id, err := snowflake.Parse(n)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(2571), id.WorkerId)
+		}
+	}
+
+	code, body = get("/v1/guid/batch?count=100")
+	var batch struct {
+		IDs []string `json:"ids"`
+	}
+	if assert.Equal(t, http.StatusOK, code) && assert.NoError(t, json.Unmarshal(body, &batch)) && assert.Len(t, batch.IDs, 100) {
+		assert.Greater(t, batch.IDs[0], single.ID)
+	}
+
+	code, body = get("/v1/guid/batch?count=3&format=text")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, strings.Fields(string(body)), 3)
+
+	code, _ = get("/v1/guid/batch?count=101")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get("/v1/guid/batch")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, body = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"workerId":2571}`, string(body))
+
+	resp, err := http.Head(srv.URL + "/v1/guid")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+
+	// the ids are not handed out after the worker id is lost
+	lost := httptest.NewServer(newGuidHandler(snowflake.NewSnowFlake(lostWorkerIdGenerator{}), lostWorkerIdGenerator{}, 100))
+	defer lost.Close()
+	for _, path := range []string{"/v1/guid", "/v1/guid/batch?count=2", "/healthz"} {
+		resp, err := http.Get(lost.URL + path)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, path)
+		}
+	}
+}
+
+func TestGuidServeInvalidOptions(t *testing.T) {
+	assert.Error(t, (&guidServeOptions{maxBatch: 0, workerId: 1}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidServeOptions{maxBatch: 1, workerId: -1, source: snowflake.WorkerIdSourceLease}).run(&bytes.Buffer{}))
+	assert.Error(t, (&guidServeOptions{maxBatch: 1, workerId: -1, source: "zookeeper"}).run(&bytes.Buffer{}))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// commentStyle is the comment syntax of a file format.
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+// commentStyles maps the extensions of the rendered files to their comment
+// syntax. The files of the other formats, e.g. json, are written without header.
+var commentStyles = map[string]commentStyle{
+	".yaml":       {prefix: "# "},
+	".yml":        {prefix: "# "},
+	".toml":       {prefix: "# "},
+	".conf":       {prefix: "# "},
+	".cfg":        {prefix: "# "},
+	".ini":        {prefix: "# "},
+	".properties": {prefix: "# "},
+	".env":        {prefix: "# "},
+	".sh":         {prefix: "# "},
+	".py":         {prefix: "# "},
+	".bat":        {prefix: "@REM "},
+	".cmd":        {prefix: "@REM "},
+	".lua":        {prefix: "-- "},
+	".sql":        {prefix: "-- "},
+	".js":         {prefix: "// "},
+	".ts":         {prefix: "// "},
+	".go":         {prefix: "// "},
+	".c":          {prefix: "// "},
+	".h":          {prefix: "// "},
+	".cpp":        {prefix: "// "},
+	".hpp":        {prefix: "// "},
+	".proto":      {prefix: "// "},
+	".xml":        {prefix: "<!-- ", suffix: " -->"},
+	".html":       {prefix: "<!-- ", suffix: " -->"},
+	".htm":        {prefix: "<!-- ", suffix: " -->"},
+}
+
+// fileHeader is the header stamped on the rendered files for audit, it tells
+// who generated the file from which chart and values.
+type fileHeader struct {
+	lines []string
+	// skip is the patterns of the file names written without header
+	skip []string
+}
+
+func newFileHeader(chrt *chart.Chart, vals map[string]any, now time.Time, skip []string) (*fileHeader, error) {
+	digest, err := valuesDigest(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := toolName
+	if v := ToolVersion(); v != "" {
+		generator += " " + v
+	}
+
+	chartName := chrt.Name()
+	if chrt.Metadata != nil && chrt.Metadata.Version != "" {
+		chartName += " " + chrt.Metadata.Version
+	}
+
+	return &fileHeader{
+		lines: []string{
+			fmt.Sprintf("Code generated by %s. DO NOT EDIT.", generator),
+			fmt.Sprintf("chart: %s", chartName),
+			fmt.Sprintf("values: %s", digest),
+			fmt.Sprintf("generated: %s", now.UTC().Format(time.RFC3339)),
+		},
+		skip: skip,
+	}, nil
+}
+
+// valuesDigest returns the sha256 digest of the values, like "sha256:<hex>".
+func valuesDigest(vals map[string]any) (string, error) {
+	data, err := json.Marshal(vals)
+	if err != nil {
+		return "", fmt.Errorf("digest values: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(digest[:]), nil
+}
+
+// format returns the header of the file, it is empty when the format of the
+// file does not support comments or the file is skipped.
+func (h *fileHeader) format(name string) []byte {
+	base := path.Base(name)
+	for _, pattern := range h.skip {
+		if ok, _ := path.Match(pattern, base); ok {
+			return nil
+		}
+	}
+
+	style, ok := commentStyles[strings.ToLower(path.Ext(base))]
+	if !ok {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, line := range h.lines {
+		buf.WriteString(style.prefix + line + style.suffix + "\n")
+	}
+	return buf.Bytes()
+}
+
+// headerWriter stamps the header on the files created by the output.
+type headerWriter struct {
+	outputWriter
+	header *fileHeader
+}
+
+func (w *headerWriter) Create(name string) (io.WriteCloser, error) {
+	f, err := w.outputWriter.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	header := w.header.format(name)
+	if header == nil {
+		return f, nil
+	}
+	return &headerFile{WriteCloser: f, header: header}, nil
+}
+
+// headerFile writes the header before the content. The first line is held
+// until it is complete, because the header must follow the shebang of a script
+// or the declaration of a xml file.
+type headerFile struct {
+	io.WriteCloser
+	header  []byte
+	pending []byte
+}
+
+func (f *headerFile) Write(p []byte) (int, error) {
+	if f.header == nil {
+		return f.WriteCloser.Write(p)
+	}
+
+	f.pending = append(f.pending, p...)
+	if bytes.IndexByte(f.pending, '\n') < 0 {
+		return len(p), nil
+	}
+	if err := f.flushHeader(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (f *headerFile) Close() error {
+	if f.header != nil {
+		if err := f.flushHeader(); err != nil {
+			_ = f.WriteCloser.Close()
+			return err
+		}
+	}
+	return f.WriteCloser.Close()
+}
+
+func (f *headerFile) flushHeader() error {
+	var buf bytes.Buffer
+	if bytes.HasPrefix(f.pending, []byte("#!")) || bytes.HasPrefix(f.pending, []byte("<?xml")) {
+		line := f.pending
+		if idx := bytes.IndexByte(line, '\n'); idx >= 0 {
+			line = line[:idx+1]
+		} else {
+			line = append(line, '\n')
+		}
+		buf.Write(line)
+		f.pending = f.pending[min(len(line), len(f.pending)):]
+	}
+	buf.Write(f.header)
+	buf.Write(f.pending)
+
+	f.header, f.pending = nil, nil
+	_, err := f.WriteCloser.Write(buf.Bytes())
+	return err
+}
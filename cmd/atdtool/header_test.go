@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestFileHeaderFormat(t *testing.T) {
+	chrt := &chart.Chart{Metadata: &chart.Metadata{Name: "echo", Version: "0.1.0"}}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	h, err := newFileHeader(chrt, map[string]any{"a": 1}, now, []string{"*.ini"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	yaml := string(h.format("cfg/echo.yaml"))
+	assert.True(t, strings.HasPrefix(yaml, "# Code generated by atdtool"))
+	assert.Contains(t, yaml, "# chart: echo 0.1.0\n")
+	assert.Contains(t, yaml, "# values: sha256:015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862\n")
+	assert.Contains(t, yaml, "# generated: 2024-01-02T03:04:05Z\n")
+
+	assert.Contains(t, string(h.format("cfg/echo.XML")), "<!-- chart: echo 0.1.0 -->\n")
+	assert.Contains(t, string(h.format("bin/start.bat")), "@REM chart: echo 0.1.0\n")
+	assert.Nil(t, h.format("cfg/echo.json"))
+	assert.Nil(t, h.format("cfg/echo.ini"))
+}
+
+func TestHeaderFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"plain", []string{"a: ", "1\nb: 2\n"}, "# h\na: 1\nb: 2\n"},
+		{"shebang", []string{"#!/bin/", "sh\necho\n"}, "#!/bin/sh\n# h\necho\n"},
+		{"xml", []string{"<?xml version=\"1.0\"?>\n<a/>"}, "<?xml version=\"1.0\"?>\n# h\n<a/>"},
+		{"no newline", []string{"a: 1"}, "# h\na: 1"},
+		{"shebang only", []string{"#!/bin/sh"}, "#!/bin/sh\n# h\n"},
+		{"empty", nil, "# h\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			f := &headerFile{WriteCloser: nopCloser{buf}, header: []byte("# h\n")}
+			for _, w := range tt.writes {
+				_, err := io.WriteString(f, w)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, f.Close())
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestTemplateOptionsRunHeader(t *testing.T) {
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		header:    true,
+		noHeader:  []string{"start_*"},
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	cfg, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml"))
+	if assert.NoError(t, err) {
+		assert.True(t, strings.HasPrefix(string(cfg), "# Code generated by atdtool"))
+		assert.Contains(t, string(cfg), "# chart: echo 0.1.0\n")
+		assert.Contains(t, string(cfg), "type_id: 42")
+	}
+
+	script, err := os.ReadFile(filepath.Join(outDir, "echo", "bin", "start_1.2.42.3.sh"))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(script), "Code generated")
+	}
+
+	o.noHeader = []string{"["}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "invalid no-header pattern")
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+const (
+	hooksDir = "hooks"
+
+	hookPreRender  = "pre-render"
+	hookPostRender = "post-render"
+	// hookPostRenderAll is run once for each chart after all its instances are rendered
+	hookPostRenderAll = "post-render-all"
+)
+
+// renderHooks runs the hooks of an instance. The hook template in chart
+// (hooks/<hook>.tpl) is rendered with the instance values and executed as a
+// shell script, then the configured command is executed.
+type renderHooks struct {
+	chartPath string
+	outPath   string
+	name      string
+	busAddr   string
+	// busAddrs are the instances of the chart for the post-render-all hook
+	busAddrs []string
+	vals     map[string]any
+	commands map[string]string
+	timeout  time.Duration
+	out      io.Writer
+}
+
+func (h *renderHooks) run(hook string) error {
+	script, found, err := renderHookTemplate(h.chartPath, hook, h.vals)
+	if err != nil {
+		return fmt.Errorf("render %s hook of %s: %v", hook, h.name, err)
+	}
+
+	command := h.commands[hook]
+	if !found && command == "" {
+		return nil
+	}
+
+	// the hooks work in the output directory, which is not available for the remote outputs
+	if h.outPath == "" {
+		return fmt.Errorf("%s hook of %s is not supported by the remote output", hook, h.name)
+	}
+
+	if err := os.MkdirAll(h.outPath, os.ModePerm); err != nil {
+		return fmt.Errorf("make hook work path(%s): %v", h.outPath, err)
+	}
+
+	valuesFile, err := h.writeValues()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(valuesFile)
+
+	if found {
+		if err := h.runScript(hook, script, valuesFile); err != nil {
+			return err
+		}
+	}
+
+	if command != "" {
+		if err := h.exec(hook, shellCommand(command), valuesFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *renderHooks) runScript(hook, script, valuesFile string) error {
+	f, err := os.CreateTemp("", "atdtool-"+hook+"-*"+scriptSuffix())
+	if err != nil {
+		return fmt.Errorf("create %s hook script: %v", hook, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(script); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s hook script: %v", hook, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close %s hook script: %v", hook, err)
+	}
+	return h.exec(hook, shellScript(f.Name()), valuesFile)
+}
+
+func (h *renderHooks) exec(hook string, args []string, valuesFile string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = h.outPath
+	cmd.Env = append(os.Environ(),
+		"ATDTOOL_HOOK="+hook,
+		"ATDTOOL_INSTANCE_NAME="+h.name,
+		"ATDTOOL_BUS_ADDR="+h.busAddr,
+		"ATDTOOL_OUTPUT_DIR="+h.outPath,
+		"ATDTOOL_VALUES_FILE="+valuesFile,
+	)
+	if h.busAddrs != nil {
+		cmd.Env = append(cmd.Env, "ATDTOOL_BUS_ADDRS="+strings.Join(h.busAddrs, ","))
+	}
+	cmd.Stdout = h.out
+	cmd.Stderr = h.out
+
+	if err := cmd.Run(); err != nil {
+		if h.busAddr == "" {
+			return fmt.Errorf("run %s hook of %s: %v", hook, h.name, err)
+		}
+		return fmt.Errorf("run %s hook of ('%s', '%s'): %v", hook, h.name, h.busAddr, err)
+	}
+	return nil
+}
+
+// postRendererWriter pipes each rendered file into the post renderer command,
+// the output of the command is written instead of the rendered content.
+type postRendererWriter struct {
+	outputWriter
+	command string
+	timeout time.Duration
+	env     []string
+}
+
+func (w *postRendererWriter) Create(name string) (io.WriteCloser, error) {
+	return &postRenderedFile{w: w, name: name}, nil
+}
+
+// postRenderedFile holds the rendered content until it is closed.
+type postRenderedFile struct {
+	bytes.Buffer
+	w    *postRendererWriter
+	name string
+}
+
+// Close runs the post renderer and writes its output into the file.
+func (f *postRenderedFile) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), f.w.timeout)
+	defer cancel()
+
+	args := shellCommand(f.w.command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(append(os.Environ(), f.w.env...), "ATDTOOL_FILE="+f.name)
+	cmd.Stdin = &f.Buffer
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run post renderer for file(%s): %v: %s", f.name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	out, err := f.w.outputWriter.Create(f.name)
+	if err != nil {
+		return err
+	}
+	if _, err := stdout.WriteTo(out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeValues saves the instance values for the hook to read.
+func (h *renderHooks) writeValues() (string, error) {
+	data, err := yaml.Marshal(h.vals)
+	if err != nil {
+		return "", fmt.Errorf("marshal hook values: %v", err)
+	}
+
+	f, err := os.CreateTemp("", "atdtool-values-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("create hook values file: %v", err)
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("write hook values file: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("close hook values file: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// renderHookTemplate renders hooks/<hook>.tpl in chart, found is false when the chart has no such hook.
+func renderHookTemplate(chartPath, hook string, vals chartutil.Values) (script string, found bool, err error) {
+	if _, err := os.Stat(filepath.Join(chartPath, hooksDir, hook+".tpl")); err != nil {
+		return "", false, nil
+	}
+
+	chrt, err := loader.Load(util.LongPath(chartPath))
+	if err != nil {
+		return "", false, err
+	}
+
+	name := path.Join(hooksDir, hook+".tpl")
+	chrt.Templates = chrt.Templates[:0]
+	for _, f := range chrt.Files {
+		if f.Name == name {
+			chrt.Templates = append(chrt.Templates, f)
+		}
+	}
+	if len(chrt.Templates) == 0 {
+		return "", false, nil
+	}
+
+	if err := processDependencies(chrt, vals); err != nil {
+		return "", false, err
+	}
+
+	output, err := (&engine.Engine{}).Render(chrt, map[string]interface{}{"Values": vals})
+	if err != nil {
+		return "", false, err
+	}
+	return output[path.Join(chrt.Name(), name)], true, nil
+}
+
+func isHookFile(f *chart.File) bool {
+	return strings.HasPrefix(f.Name, hooksDir+"/")
+}
+
+func scriptSuffix() string {
+	if runtime.GOOS == "windows" {
+		return ".bat"
+	}
+	return ".sh"
+}
+
+func shellScript(name string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", name}
+	}
+	return []string{"sh", name}
+}
+
+func shellCommand(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+	return []string{"sh", "-c", command}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// renderStateFile records the inputs and the outputs of the instances rendered
+// into a local output, so that the unchanged instances are skipped next time.
+const renderStateFile = ".atdtool-render.json"
+
+// renderState is the state of the instances rendered into a local output.
+type renderState struct {
+	Instances map[string]*instanceState `json:"instances"`
+
+	root string
+	mu   sync.Mutex
+
+	changed, unchanged, removed int
+}
+
+// instanceState is the digest of the inputs of an instance and the files
+// rendered from them.
+type instanceState struct {
+	Digest string   `json:"digest"`
+	Files  []string `json:"files"`
+}
+
+// loadRenderState loads the state of the output, it is empty if the state is
+// not found or broken, then all instances are rendered.
+func loadRenderState(root string) *renderState {
+	s := &renderState{root: root}
+	if data, err := os.ReadFile(filepath.Join(root, renderStateFile)); err == nil {
+		_ = json.Unmarshal(data, s)
+	}
+	if s.Instances == nil {
+		s.Instances = make(map[string]*instanceState)
+	}
+	return s
+}
+
+// save writes the state into the output.
+func (s *renderState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFile(data, filepath.Join(s.root, renderStateFile)); err != nil {
+		return fmt.Errorf("write render state: %v", err)
+	}
+	return nil
+}
+
+// skip reports whether the instance is rendered from the same inputs and its
+// files are not removed, the files are counted as unchanged if so.
+func (s *renderState) skip(key, digest string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.Instances[key]
+	if !ok || st.Digest != digest {
+		return false
+	}
+	for _, name := range st.Files {
+		if !util.FileExist(s.localFile(name)) {
+			return false
+		}
+	}
+	s.unchanged += len(st.Files)
+	return true
+}
+
+// files returns the files rendered by the instance last time.
+func (s *renderState) files(key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.Instances[key]; ok {
+		return append([]string{}, st.Files...)
+	}
+	return nil
+}
+
+// forget removes the instance before it is rendered, so that it is rendered
+// again next time if the rendering fails.
+func (s *renderState) forget(key string) *instanceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.Instances[key]
+	delete(s.Instances, key)
+	return st
+}
+
+// update records the rendered files of the instance, the files rendered last
+// time but not this time are removed.
+func (s *renderState) update(key, digest string, files []string, last *instanceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Instances[key] = &instanceState{Digest: digest, Files: files}
+	s.changed += len(files)
+	if last == nil {
+		return nil
+	}
+
+	rendered := make(map[string]bool, len(files))
+	for _, name := range files {
+		rendered[name] = true
+	}
+	for _, name := range last.Files {
+		if rendered[name] {
+			continue
+		}
+		if err := s.remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes the files of the instances which are no longer deployed.
+func (s *renderState) prune(deployed map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, st := range s.Instances {
+		if deployed[key] {
+			continue
+		}
+		for _, name := range st.Files {
+			if err := s.remove(name); err != nil {
+				return err
+			}
+		}
+		delete(s.Instances, key)
+	}
+	return nil
+}
+
+func (s *renderState) remove(name string) error {
+	err := os.Remove(s.localFile(name))
+	if err == nil {
+		s.removed++
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove stale configuration file(%s): %v", name, err)
+	}
+	return nil
+}
+
+func (s *renderState) localFile(name string) string {
+	return util.LongPath(filepath.Join(s.root, filepath.FromSlash(name)))
+}
+
+// summary returns the numbers of the changed, unchanged and removed files.
+func (s *renderState) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d files changed, %d unchanged, %d removed", s.changed, s.unchanged, s.removed)
+}
+
+// instanceKey identifies an instance in the render state.
+func instanceKey(inst renderInstance) string {
+	return inst.unit.Name + "/" + inst.busAddr
+}
+
+// instanceDigest digests the inputs of an instance: the tool version, the
+// chart, the values and the options changing the rendered files, including the
+// post renderer command, the output layout, the template extensions and the
+// hook commands, which are skipped with the instance.
+func (o *templateOptions) instanceDigest(r *chartRenderer, vals map[string]any) (string, error) {
+	data, err := json.Marshal(vals)
+	if err != nil {
+		return "", fmt.Errorf("digest values: %v", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%t\n%s\n%s\n%s\n%s\n", ToolVersion(), r.digest, o.header, strings.Join(o.noHeader, ","), o.postRenderer, o.outputLayout, strings.Join(r.exts, ","))
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n", o.preRenderHook, o.postRenderHook, o.postRenderAllHook, o.hookTimeout)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// chartDigest digests all files of the chart, including the files of its
+// dependencies.
+func chartDigest(chrt *chart.Chart) string {
+	files := make([]*chart.File, len(chrt.Raw))
+	copy(files, chrt.Raw)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\n%d\n", f.Name, len(f.Data))
+		h.Write(f.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter records the names of the created files.
+type recordingWriter struct {
+	outputWriter
+	names []string
+}
+
+func (w *recordingWriter) Create(name string) (io.WriteCloser, error) {
+	if !slices.Contains(w.names, name) {
+		w.names = append(w.names, name)
+	}
+	return w.outputWriter.Create(name)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestTemplateOptionsRunIncremental(t *testing.T) {
+	outDir := t.TempDir()
+	render := func(force bool, set ...string) string {
+		stdout := &bytes.Buffer{}
+		o := &templateOptions{
+			chartPath: fixturePath("charts"),
+			outPath:   outDir,
+			force:     force,
+			valOpts: values.Options{
+				Paths:  []string{fixturePath("values", "default"), fixturePath("values", "multiworld")},
+				Values: set,
+			},
+		}
+		if !assert.NoError(t, o.run(stdout)) {
+			return ""
+		}
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		return lines[len(lines)-1]
+	}
+	cfg := filepath.Join(outDir, "echo", "cfg", "echo_1.3.42.1.yaml")
+
+	assert.Equal(t, "10 files changed, 0 unchanged, 0 removed", render(false))
+	assert.Equal(t, "0 files changed, 10 unchanged, 0 removed", render(false))
+	assert.Equal(t, "10 files changed, 0 unchanged, 0 removed", render(true))
+
+	// the instance is rendered again if its files are removed
+	assert.NoError(t, os.Remove(cfg))
+	assert.Equal(t, "2 files changed, 8 unchanged, 0 removed", render(false))
+	assert.FileExists(t, cfg)
+
+	// the files not rendered by atdtool are never removed
+	user := []string{filepath.Join(outDir, "echo", "cfg", "user.yaml"), filepath.Join(outDir, "notes.txt")}
+	for _, name := range user {
+		assert.NoError(t, os.WriteFile(name, []byte("user"), 0644))
+	}
+
+	// the stale files of the changed instances and the instances no longer
+	// deployed are removed
+	stale := []string{filepath.Join(outDir, "echo", "cfg", "stale.yaml"), filepath.Join(outDir, "gone", "gone.yaml")}
+	for _, name := range stale {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), os.ModePerm))
+		assert.NoError(t, os.WriteFile(name, []byte("stale"), 0644))
+	}
+	state := loadRenderState(outDir)
+	state.Instances["echo/1.3.42.1"].Files = append(state.Instances["echo/1.3.42.1"].Files, "echo/cfg/stale.yaml")
+	state.Instances["gone/1.1.1.1"] = &instanceState{Files: []string{"gone/gone.yaml"}}
+	assert.NoError(t, state.save())
+
+	assert.Equal(t, "10 files changed, 0 unchanged, 2 removed", render(false, "echo.shared=changed"))
+	for _, name := range stale {
+		assert.NoFileExists(t, name)
+	}
+	assert.Equal(t, "10 files changed, 0 unchanged, 0 removed", render(true, "echo.shared=changed"))
+	for _, name := range user {
+		assert.FileExists(t, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, renderStateFile))
+	if assert.NoError(t, err) {
+		saved := &renderState{}
+		assert.NoError(t, json.Unmarshal(data, saved))
+		assert.Len(t, saved.Instances, 5)
+		assert.NotContains(t, saved.Instances, "gone/1.1.1.1")
+	}
+}
+
+func TestTemplateOptionsRunIncrementalFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test are POSIX shell commands")
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath:     fixturePath("charts"),
+		outPath:       outDir,
+		preRenderHook: "exit 3",
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+
+	// the failed instance is not recorded, it is rendered next time
+	o.preRenderHook = ""
+	stdout := &bytes.Buffer{}
+	if assert.NoError(t, o.run(stdout)) {
+		assert.Contains(t, stdout.String(), "create('echo', '1.2.42.3') configuration success")
+	}
+}
+
+func TestTemplateOptionsRunIncrementalHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test are POSIX shell commands")
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	render := func() string {
+		stdout := &bytes.Buffer{}
+		if !assert.NoError(t, o.run(stdout)) {
+			return ""
+		}
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		return lines[len(lines)-1]
+	}
+	hookLog := filepath.Join(outDir, "echo", "hook.log")
+
+	o.postRenderHook = "echo first >> hook.log"
+	first := render()
+	assert.Contains(t, first, "0 unchanged")
+	assert.Contains(t, render(), "0 files changed")
+
+	// the instances are rendered again with the changed hooks
+	tests := []struct {
+		name string
+		set  func()
+	}{
+		{"pre-render-hook", func() { o.preRenderHook = "true" }},
+		{"post-render-hook", func() { o.postRenderHook = "echo second >> hook.log" }},
+		{"post-render-all-hook", func() { o.postRenderAllHook = "true" }},
+		{"hook-timeout", func() { o.hookTimeout = time.Minute }},
+	}
+	for _, tt := range tests {
+		tt.set()
+		assert.Equal(t, first, render(), tt.name)
+		assert.Contains(t, render(), "0 files changed", tt.name)
+	}
+
+	data, err := os.ReadFile(hookLog)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "second")
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+const initEnvDesc = `
+Create the values directory of a new environment.
+
+The world/zone ranges, bus listen template, hosts and charts are asked
+interactively, or read from the answers file specified by '--answers':
+
+    worlds: "1-2"            # a world id or a range of world ids
+    zones: "1-3,5"           # the zone ids or ranges of each world
+    bus_listen: "ipv4://0.0.0.0:{{ .Values.instance_id }}"
+    hosts: [10.0.0.1, 10.0.0.2]
+    charts:
+      - name: gamesvr
+        type_id: "10"
+        instance_count: 2
+        start_instance_id: 1
+        world_instance: false
+
+The created directory could be passed to 'template' by '--values':
+
+    DIR/global.yaml                       hosts and bus_listen shared by the charts
+    DIR/<chart>.yaml                      values of each chart
+    DIR/modules/                          values of the modules
+    DIR/non_cloud_native/deploy.yaml      instances of the charts in each world/zone
+`
+
+// envAnswers are the answers of the environment setup.
+type envAnswers struct {
+	Worlds    string      `json:"worlds"`
+	Zones     string      `json:"zones"`
+	BusListen string      `json:"bus_listen,omitempty"`
+	Hosts     []string    `json:"hosts,omitempty"`
+	Charts    []*envChart `json:"charts"`
+}
+
+type envChart struct {
+	Name            string `json:"name"`
+	TypeId          string `json:"type_id"`
+	InstanceCount   uint64 `json:"instance_count"`
+	StartInstanceId uint64 `json:"start_instance_id"`
+	WorldInstance   bool   `json:"world_instance"`
+}
+
+type initEnvOptions struct {
+	outPath     string
+	answersPath string
+	force       bool
+}
+
+func newInitCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the skeletons of the configuration",
+		Args:  require.NoArgs,
+	}
+	cmd.AddCommand(newInitEnvCmd(out))
+	return cmd
+}
+
+func newInitEnvCmd(out io.Writer) *cobra.Command {
+	o := &initEnvOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "env [DIR]",
+		Short: "Create the values directory of a new environment",
+		Long:  initEnvDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.outPath = args[0]
+
+			var answers *envAnswers
+			var err error
+			if o.answersPath != "" {
+				answers, err = loadEnvAnswers(o.answersPath)
+			} else {
+				// the prompts are not buffered like the output of the command
+				answers, err = askEnvAnswers(cmd.InOrStdin(), cmd.ErrOrStderr())
+			}
+			if err != nil {
+				return err
+			}
+			return o.run(out, answers)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&o.answersPath, "answers", "", "read the answers from the file instead of asking interactively")
+	f.BoolVar(&o.force, "force", false, "overwrite the existing files")
+	return cmd
+}
+
+func loadEnvAnswers(path string) (*envAnswers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	answers := new(envAnswers)
+	if err := yaml.UnmarshalStrict(data, answers); err != nil {
+		return nil, fmt.Errorf("load answers file(%s): %v", path, err)
+	}
+	for _, c := range answers.Charts {
+		if c.InstanceCount == 0 {
+			c.InstanceCount = 1
+		}
+		if c.StartInstanceId == 0 {
+			c.StartInstanceId = 1
+		}
+	}
+	return answers, nil
+}
+
+// prompter asks the questions line by line.
+type prompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.w, "%s: ", question)
+	}
+
+	line, err := p.r.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("no answer for: %s", question)
+		}
+		return "", err
+	}
+
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (p *prompter) askUint(question string, def uint64) (uint64, error) {
+	for {
+		s, err := p.ask(question, strconv.FormatUint(def, 10))
+		if err != nil {
+			return 0, err
+		}
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err == nil {
+			return v, nil
+		}
+		fmt.Fprintf(p.w, "invalid number: %s\n", s)
+	}
+}
+
+func askEnvAnswers(in io.Reader, w io.Writer) (*envAnswers, error) {
+	p := &prompter{r: bufio.NewReader(in), w: w}
+	answers := new(envAnswers)
+
+	var err error
+	if answers.Worlds, err = p.ask("World ids, e.g. 1 or 1-3", "1"); err != nil {
+		return nil, err
+	}
+	if answers.Zones, err = p.ask("Zone ids of each world, e.g. 1-3,5", "1"); err != nil {
+		return nil, err
+	}
+	if answers.BusListen, err = p.ask("Bus listen template, empty to skip", ""); err != nil {
+		return nil, err
+	}
+
+	hosts, err := p.ask("Hosts separated by commas, empty to skip", "")
+	if err != nil {
+		return nil, err
+	}
+	answers.Hosts = splitList(hosts)
+
+	names, err := p.ask("Charts separated by commas", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range splitList(names) {
+		c := &envChart{Name: name}
+		if c.TypeId, err = p.ask(fmt.Sprintf("[%s] instance type id", name), strconv.Itoa(i+1)); err != nil {
+			return nil, err
+		}
+		if c.InstanceCount, err = p.askUint(fmt.Sprintf("[%s] instance count", name), 1); err != nil {
+			return nil, err
+		}
+		if c.StartInstanceId, err = p.askUint(fmt.Sprintf("[%s] start instance id", name), 1); err != nil {
+			return nil, err
+		}
+
+		worldInstance, err := p.ask(fmt.Sprintf("[%s] deployed once in each world (y/n)", name), "n")
+		if err != nil {
+			return nil, err
+		}
+		c.WorldInstance = strings.HasPrefix(strings.ToLower(worldInstance), "y")
+		answers.Charts = append(answers.Charts, c)
+	}
+	return answers, nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// parseRanges parses the ids or ranges separated by commas, e.g. "1-3,5".
+func parseRanges(s string) ([]noncloudnative.ZoneRange, error) {
+	var ranges []noncloudnative.ZoneRange
+	for _, v := range splitList(s) {
+		var r noncloudnative.ZoneRange
+		if err := r.UnmarshalJSON([]byte(v)); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("empty range")
+	}
+	return ranges, nil
+}
+
+// deployConf returns the content of deploy.yaml. The single world and zone is
+// written as the top level world_id and zone_id, otherwise as the worlds.
+func (a *envAnswers) deployConf() (map[string]any, error) {
+	worlds, err := parseRanges(a.Worlds)
+	if err != nil {
+		return nil, fmt.Errorf("worlds: %v", err)
+	}
+	zones, err := parseRanges(a.Zones)
+	if err != nil {
+		return nil, fmt.Errorf("zones: %v", err)
+	}
+
+	if len(a.Charts) == 0 {
+		return nil, fmt.Errorf("no chart is specified")
+	}
+
+	names := make(map[string]bool, len(a.Charts))
+	procDesc := make([]map[string]any, 0, len(a.Charts))
+	for _, c := range a.Charts {
+		if c.Name == "" || strings.ContainsAny(c.Name, `/\`) {
+			return nil, fmt.Errorf("invalid chart name: %q", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate chart: %s", c.Name)
+		}
+		names[c.Name] = true
+
+		if _, err := strconv.ParseUint(c.TypeId, 10, 64); err != nil {
+			return nil, fmt.Errorf("chart %s: invalid type id: %q", c.Name, c.TypeId)
+		}
+
+		procDesc = append(procDesc, map[string]any{
+			"chart_name":        c.Name,
+			"instance_type_id":  c.TypeId,
+			"world_instance":    c.WorldInstance,
+			"instance_count":    c.InstanceCount,
+			"start_instance_id": c.StartInstanceId,
+		})
+	}
+
+	conf := map[string]any{"proc_desc": procDesc}
+	if len(worlds) == 1 && worlds[0].Start == worlds[0].End && len(zones) == 1 && zones[0].Start == zones[0].End {
+		conf["world_id"] = worlds[0].Start
+		conf["zone_id"] = zones[0].Start
+		return conf, nil
+	}
+
+	zoneList := make([]string, 0, len(zones))
+	for _, z := range zones {
+		if z.Start == z.End {
+			zoneList = append(zoneList, strconv.FormatUint(z.Start, 10))
+		} else {
+			zoneList = append(zoneList, fmt.Sprintf("%d-%d", z.Start, z.End))
+		}
+	}
+
+	var worldList []map[string]any
+	for _, w := range worlds {
+		for id := w.Start; id <= w.End; id++ {
+			worldList = append(worldList, map[string]any{"world_id": id, "zones": zoneList})
+		}
+	}
+	conf["worlds"] = worldList
+	return conf, nil
+}
+
+func (o *initEnvOptions) run(out io.Writer, answers *envAnswers) error {
+	deploy, err := answers.deployConf()
+	if err != nil {
+		return err
+	}
+
+	global := map[string]any{}
+	if len(answers.Hosts) != 0 {
+		global["hosts"] = answers.Hosts
+	}
+	if answers.BusListen != "" {
+		global["bus_listen"] = answers.BusListen
+	}
+
+	files := map[string]any{
+		"global.yaml": global,
+		filepath.Join("non_cloud_native", "deploy.yaml"): deploy,
+	}
+	for _, c := range answers.Charts {
+		files[c.Name+".yaml"] = map[string]any{}
+	}
+
+	if !o.force {
+		for name := range files {
+			if _, err := os.Stat(filepath.Join(o.outPath, name)); err == nil {
+				return fmt.Errorf("file(%s) already exists, use --force to overwrite", filepath.Join(o.outPath, name))
+			}
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(o.outPath, "modules"), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(o.outPath, "non_cloud_native"), os.ModePerm); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := yaml.Marshal(files[name])
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(filepath.Join(o.outPath, name), data, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "create %s\n", filepath.Join(o.outPath, name))
+	}
+
+	// the layout must be accepted by template
+	cfg, err := noncloudnative.LoadConfig([]string{o.outPath})
+	if err != nil {
+		return fmt.Errorf("load created configuration: %v", err)
+	}
+	if _, err := cfg.Deploy.Targets(); err != nil {
+		return fmt.Errorf("load created deploy targets: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+func TestAskEnvAnswers(t *testing.T) {
+	in := strings.NewReader("1-2\n1-3,5\n\n10.0.0.1, 10.0.0.2\necho,dir\n42\nx\n2\n\n\n\n\n\ny\n")
+	prompts := &bytes.Buffer{}
+	answers, err := askEnvAnswers(in, prompts)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, &envAnswers{
+		Worlds: "1-2",
+		Zones:  "1-3,5",
+		Hosts:  []string{"10.0.0.1", "10.0.0.2"},
+		Charts: []*envChart{
+			{Name: "echo", TypeId: "42", InstanceCount: 2, StartInstanceId: 1},
+			{Name: "dir", TypeId: "2", InstanceCount: 1, StartInstanceId: 1, WorldInstance: true},
+		},
+	}, answers)
+	assert.Contains(t, prompts.String(), "invalid number: x")
+
+	_, err = askEnvAnswers(strings.NewReader("1\n"), prompts)
+	assert.ErrorContains(t, err, "no answer for: Zone ids")
+}
+
+func TestInitEnvMultiWorld(t *testing.T) {
+	dir := t.TempDir()
+	o := &initEnvOptions{outPath: dir}
+	answers := &envAnswers{
+		Worlds:    "1-2",
+		Zones:     "1-3,5",
+		BusListen: "ipv4://0.0.0.0:8000",
+		Hosts:     []string{"10.0.0.1"},
+		Charts:    []*envChart{{Name: "echo", TypeId: "42", InstanceCount: 1, StartInstanceId: 1}},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{}, answers)) {
+		return
+	}
+
+	cfg, err := noncloudnative.LoadConfig([]string{dir})
+	if !assert.NoError(t, err) {
+		return
+	}
+	targets, err := cfg.Deploy.Targets()
+	if assert.NoError(t, err) {
+		assert.Len(t, targets, 8)
+	}
+
+	global, err := os.ReadFile(filepath.Join(dir, "global.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bus_listen: ipv4://0.0.0.0:8000\nhosts:\n- 10.0.0.1\n", string(global))
+	}
+	assert.DirExists(t, filepath.Join(dir, "modules"))
+	assert.FileExists(t, filepath.Join(dir, "echo.yaml"))
+
+	// the existing files are not overwritten by default
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}, answers), "already exists")
+	o.force = true
+	assert.NoError(t, o.run(&bytes.Buffer{}, answers))
+
+	answers.Charts = append(answers.Charts, &envChart{Name: "echo", TypeId: "1"})
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}, answers), "duplicate chart: echo")
+}
+
+func TestInitEnvTemplate(t *testing.T) {
+	dir := t.TempDir()
+	answersFile := filepath.Join(dir, "answers.yaml")
+	if err := os.WriteFile(answersFile, []byte("worlds: \"1\"\nzones: \"2\"\ncharts:\n  - name: echo\n    type_id: \"42\"\n    instance_count: 2\n    start_instance_id: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	answers, err := loadEnvAnswers(answersFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	valuesDir := filepath.Join(dir, "values")
+	if !assert.NoError(t, (&initEnvOptions{outPath: valuesDir}).run(&bytes.Buffer{}, answers)) {
+		return
+	}
+
+	deploy, err := os.ReadFile(filepath.Join(valuesDir, "non_cloud_native", "deploy.yaml"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(deploy), "world_id: 1\nzone_id: 2\n")
+	}
+
+	// the created values are rendered by template
+	stdout := &bytes.Buffer{}
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   filepath.Join(dir, "out"),
+		valOpts:   values.Options{Paths: []string{valuesDir}},
+	}
+	if assert.NoError(t, o.run(stdout)) {
+		assert.Contains(t, stdout.String(), "create('echo', '1.2.42.4') configuration success")
+	}
+
+	if err := os.WriteFile(answersFile, []byte("worlds: \"1\"\nunknown: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadEnvAnswers(answersFile)
+	assert.ErrorContains(t, err, "unknown field")
+}
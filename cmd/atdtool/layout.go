@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// The output layouts decide the paths of the rendered files of the instances.
+const (
+	// layoutFlat writes the files into the directory of the chart with the bus
+	// address suffix, e.g. echo/cfg/echo_1.2.3.4.yaml
+	layoutFlat = "flat"
+	// layoutInstance writes the files into the subdirectory of each instance,
+	// e.g. echo/1.2.3.4/cfg/echo.yaml
+	layoutInstance = "instance"
+)
+
+// outputLayout is the layout of the rendered files, a custom layout is a Go
+// template rendered into the path of each file.
+type outputLayout struct {
+	name string
+	tmpl *template.Template
+
+	// mu guards paths, which records the instances of the paths of the custom
+	// layout, so that the files of different instances are never overwritten
+	mu    sync.Mutex
+	paths map[string]string
+}
+
+// layoutFile is the data of the custom layout template.
+type layoutFile struct {
+	// Name is the chart name of the instance
+	Name string
+	// TypeID is the instance_type_id of the chart
+	TypeID string
+	// BusAddr is the bus address of the instance
+	BusAddr string
+	// Dir is the directory of the template relative to the chart, it is empty
+	// for the templates in the root of the chart
+	Dir string
+	// File is the file name without the .tpl extension, e.g. echo.yaml
+	File string
+	// Stem and Ext are the file name without and with only its extension,
+	// e.g. echo and .yaml
+	Stem string
+	Ext  string
+}
+
+// parseOutputLayout parses flat, instance or a Go template such as
+// "{{ .Name }}-{{ .BusAddr }}/{{ .Dir }}/{{ .File }}".
+func parseOutputLayout(s string) (*outputLayout, error) {
+	switch s {
+	case "", layoutFlat:
+		return &outputLayout{name: layoutFlat}, nil
+	case layoutInstance:
+		return &outputLayout{name: layoutInstance}, nil
+	}
+
+	if !strings.Contains(s, "{{") {
+		return nil, fmt.Errorf("unknown output layout: %s, should be %s, %s or a Go template", s, layoutFlat, layoutInstance)
+	}
+	tmpl, err := template.New("output-layout").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("parse output layout: %v", err)
+	}
+	return &outputLayout{tmpl: tmpl, paths: make(map[string]string)}, nil
+}
+
+// render renders the templates of the instance by the layout, name is the
+// chart name of the instance.
+func (l *outputLayout) render(r *chartRenderer, vals map[string]any, w outputWriter, name string) error {
+	var busAddr, typeID string
+	if addr, ok := vals["bus_addr"]; ok {
+		busAddr = fmt.Sprint(addr)
+	}
+	if id, ok := vals["type_id"]; ok {
+		typeID = fmt.Sprint(id)
+	}
+
+	switch l.name {
+	case layoutFlat:
+		var suffix string
+		if busAddr != "" {
+			suffix = "_" + busAddr
+		}
+		return r.render(vals, w, name, suffix)
+	case layoutInstance:
+		return r.render(vals, w, util.SlashJoin(name, busAddr), "")
+	}
+
+	return r.render(vals, &layoutWriter{
+		outputWriter: w,
+		layout:       l,
+		file:         layoutFile{Name: name, TypeID: typeID, BusAddr: busAddr},
+	}, "", "")
+}
+
+// layoutWriter creates the files at the paths rendered by the custom layout.
+type layoutWriter struct {
+	outputWriter
+	layout *outputLayout
+	file   layoutFile
+}
+
+func (w *layoutWriter) Create(name string) (io.WriteCloser, error) {
+	f := w.file
+	if f.Dir = path.Dir(name); f.Dir == "." {
+		f.Dir = ""
+	}
+	f.File = path.Base(name)
+	f.Ext = path.Ext(f.File)
+	f.Stem = strings.TrimSuffix(f.File, f.Ext)
+
+	var buf bytes.Buffer
+	if err := w.layout.tmpl.Execute(&buf, f); err != nil {
+		return nil, fmt.Errorf("render output layout of %s: %v", name, err)
+	}
+	outFile, ok := util.TrimPathPrefix(strings.TrimSpace(buf.String()), ".")
+	if !ok || outFile == "" {
+		return nil, fmt.Errorf("output layout of %s is not a relative path: %s", name, buf.String())
+	}
+
+	instance := f.Name + "/" + f.BusAddr
+	w.layout.mu.Lock()
+	if other, ok := w.layout.paths[outFile]; ok && other != instance {
+		w.layout.mu.Unlock()
+		return nil, fmt.Errorf("output layout of %s: %s is also rendered by %s", instance, outFile, other)
+	}
+	w.layout.paths[outFile] = instance
+	w.layout.mu.Unlock()
+
+	return w.outputWriter.Create(outFile)
+}
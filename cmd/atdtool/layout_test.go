@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestTemplateOptionsRunOutputLayout(t *testing.T) {
+	render := func(layout string) (string, error) {
+		outDir := t.TempDir()
+		o := &templateOptions{
+			chartPath:    fixturePath("charts"),
+			outPath:      outDir,
+			outputLayout: layout,
+			valOpts: values.Options{
+				Paths: []string{fixturePath("values", "default")},
+			},
+		}
+		return outDir, o.run(&bytes.Buffer{})
+	}
+
+	tests := []struct {
+		layout string
+		files  []string
+	}{
+		{"", []string{"echo/cfg/echo_1.2.42.3.yaml", "echo/bin/start_1.2.42.3.sh"}},
+		{"flat", []string{"echo/cfg/echo_1.2.42.3.yaml", "echo/bin/start_1.2.42.3.sh"}},
+		{"instance", []string{"echo/1.2.42.3/cfg/echo.yaml", "echo/1.2.42.3/bin/start.sh"}},
+		{"{{ .Name }}-{{ .TypeID }}-{{ .BusAddr }}/{{ .Dir }}/{{ .Stem }}{{ .Ext }}", []string{"echo-42-1.2.42.3/cfg/echo.yaml", "echo-42-1.2.42.3/bin/start.sh"}},
+	}
+	for _, tt := range tests {
+		outDir, err := render(tt.layout)
+		if !assert.NoError(t, err, tt.layout) {
+			continue
+		}
+		for _, name := range tt.files {
+			assert.FileExists(t, filepath.Join(outDir, filepath.FromSlash(name)), tt.layout)
+		}
+	}
+
+	_, err := render("tree")
+	assert.ErrorContains(t, err, "unknown output layout: tree")
+	_, err = render("{{ .Name }")
+	assert.ErrorContains(t, err, "parse output layout")
+	_, err = render("../{{ .File }}")
+	assert.ErrorContains(t, err, "is not a relative path")
+	_, err = render("{{ .Name }}/{{ .Missing }}")
+	assert.ErrorContains(t, err, "render output layout")
+}
+
+func TestTemplateOptionsRunOutputLayoutConflict(t *testing.T) {
+	o := &templateOptions{
+		chartPath:    fixturePath("charts"),
+		outPath:      t.TempDir(),
+		outputLayout: "{{ .Name }}/{{ .File }}",
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default"), fixturePath("values", "multiworld")},
+		},
+	}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "is also rendered by")
+}
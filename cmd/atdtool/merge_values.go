@@ -1,14 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/cmd/helm/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"sigs.k8s.io/yaml"
 
 	"github.com/atframework/atdtool/cli/values"
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
 	"github.com/atframework/atdtool/internal/pkg/util"
 )
 
@@ -22,12 +25,18 @@ Multiple paths are separated by commas. The priority will be given to the last
 
 You can specify the '--set'/'-s' flag multiple times. The priority will be given to the
 last (right-most) set specified.
+
+The '--expand-instances' flag merges the values of every instance of the chart in
+non_cloud_native/deploy.yaml as template does, including the runtime values such
+as bus_addr, and writes them into 'values_<bus_addr>.yaml' of the output directory.
 `
 
 type mergeValuesOptions struct {
 	chartPath string
 	outPath   string
 	valOpts   values.Options
+
+	expandInstances bool
 }
 
 func newMergeValuesCmd(out io.Writer) *cobra.Command {
@@ -63,6 +72,7 @@ func newMergeValuesCmd(out io.Writer) *cobra.Command {
 	f := cmd.Flags()
 	addValueOptionsFlags(f, &o.valOpts)
 	f.StringVarP(&o.outPath, "output", "o", "", "specify values file save path")
+	f.BoolVar(&o.expandInstances, "expand-instances", false, "write the values of each instance in deploy.yaml into values_<bus_addr>.yaml of the output directory")
 	return cmd
 }
 
@@ -83,7 +93,11 @@ func (o *mergeValuesOptions) run(_ io.Writer) (err error) {
 		return
 	}
 
-	vals, err = util.MergeChartValues(o.chartPath, valuePaths, optVals, nil)
+	if o.expandInstances {
+		return o.runInstances(valuePaths, optVals)
+	}
+
+	vals, err = util.MergeChartValues(o.chartPath, valuePaths, o.valOpts.MergeOptions(), optVals, nil)
 	if err != nil {
 		return
 	}
@@ -106,3 +120,77 @@ func (o *mergeValuesOptions) run(_ io.Writer) (err error) {
 	err = util.WriteFile(out, filename)
 	return
 }
+
+// runInstances writes the values of each instance of the chart, which are the
+// same as the values rendered by template.
+func (o *mergeValuesOptions) runInstances(valuePaths []string, optVals map[string]any) error {
+	outDir := o.outPath
+	if outDir == "" {
+		outDir = o.chartPath
+	} else if ext := filepath.Ext(outDir); ext != "" && ext != "." {
+		return fmt.Errorf("--expand-instances writes into a directory, but the output is a file: %s", outDir)
+	}
+
+	nonCloudNativeCfg, err := noncloudnative.LoadConfig(valuePaths)
+	if err != nil {
+		return fmt.Errorf("load noncloudnative configuration: %v", err)
+	}
+	worldFilter, zoneFilter, err := deployTargetFilter(optVals, nonCloudNativeCfg)
+	if err != nil {
+		return err
+	}
+	targets, err := nonCloudNativeCfg.Deploy.Targets()
+	if err != nil {
+		return fmt.Errorf("load noncloudnative deploy targets: %v", err)
+	}
+
+	chrt, err := loader.Load(util.LongPath(o.chartPath))
+	if err != nil {
+		return err
+	}
+
+	// the instances are matched by the chart directory as template does
+	name := filepath.Base(filepath.Clean(o.chartPath))
+	instances := 0
+	for _, target := range targets {
+		if worldFilter != nil && *worldFilter != target.WorldID {
+			continue
+		}
+		if zoneFilter != nil && *zoneFilter != target.ZoneId {
+			continue
+		}
+
+		for _, unit := range target.Instance {
+			if unit.Name != name {
+				continue
+			}
+			for i := uint64(0); i < unit.InstanceCount; i++ {
+				busAddr := target.BusAddr(unit, unit.StartInstanceId+i)
+				copyOptVals, err := instanceOptValues(optVals, unit)
+				if err != nil {
+					return err
+				}
+				vals, err := util.MergeLoadedChartValues(chrt, valuePaths, o.valOpts.MergeOptions(), copyOptVals, &noncloudnative.RenderValue{
+					BusAddr: busAddr,
+					Config:  nonCloudNativeCfg,
+				})
+				if err != nil {
+					return fmt.Errorf("merge values of %s: %v", busAddr, err)
+				}
+
+				out, err := yaml.Marshal(vals)
+				if err != nil {
+					return err
+				}
+				if err := util.WriteFile(out, filepath.Join(outDir, "values_"+busAddr+".yaml")); err != nil {
+					return err
+				}
+				instances++
+			}
+		}
+	}
+	if instances == 0 {
+		return fmt.Errorf("no instance of chart %s in deploy.yaml", name)
+	}
+	return nil
+}
@@ -142,3 +142,46 @@ func copyDir(src, dst string) error {
 	}
 	return nil
 }
+
+func TestMergeValuesOptionsRunExpandInstances(t *testing.T) {
+	outDir := t.TempDir()
+	o := &mergeValuesOptions{
+		chartPath:       fixturePath("charts", "echo"),
+		outPath:         outDir,
+		expandInstances: true,
+		valOpts: values.Options{
+			Paths:  []string{fixturePath("values", "default")},
+			Values: []string{"echo.shared=cli"},
+		},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	for _, busAddr := range []string{"1.2.42.3", "1.2.42.4"} {
+		data, err := os.ReadFile(filepath.Join(outDir, "values_"+busAddr+".yaml"))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		// the runtime values and the command line values of the chart are
+		// merged as template does
+		assert.Contains(t, string(data), "bus_addr: "+busAddr+"\n")
+		assert.Contains(t, string(data), "shared: cli\n")
+		assert.Contains(t, string(data), "type_id: \"42\"\n")
+	}
+	entries, err := os.ReadDir(outDir)
+	if assert.NoError(t, err) {
+		assert.Len(t, entries, 2)
+	}
+
+	o.outPath = filepath.Join(outDir, "values.yaml")
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "writes into a directory")
+
+	// the chart is not deployed
+	chartDir := filepath.Join(t.TempDir(), "other")
+	if err := copyDir(fixturePath("charts", "echo"), chartDir); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	o.chartPath, o.outPath = chartDir, outDir
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "no instance of chart other")
+}
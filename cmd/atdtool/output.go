@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// outputWriter writes the rendered files. The names are slash separated paths
+// relative to the root of the output.
+type outputWriter interface {
+	Create(name string) (io.WriteCloser, error)
+	// LocalPath returns the local directory of the output, it is empty for
+	// the remote outputs.
+	LocalPath() string
+}
+
+// newOutputWriter creates the writer by the scheme of the output:
+//
+//	<dir> or file://<dir>                 the local directory
+//	ssh://[user@]host[:port]/<dir>        the directory of a remote host, sftp:// is the same
+//	s3://<bucket>[/<prefix>]              the object storage compatible with S3
+func newOutputWriter(output string) (outputWriter, error) {
+	if !strings.Contains(output, "://") {
+		return &localWriter{root: output}, nil
+	}
+
+	u, err := url.Parse(output)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output(%s): %v", output, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &localWriter{root: filepath.FromSlash(u.Host + u.Path)}, nil
+	case "ssh", "sftp":
+		return newSSHWriter(u)
+	case "s3":
+		return newS3Writer(u)
+	default:
+		return nil, fmt.Errorf("unsupport output scheme: %s", u.Scheme)
+	}
+}
+
+// localWriter writes the files into a local directory.
+type localWriter struct {
+	root string
+}
+
+func (w *localWriter) Create(name string) (io.WriteCloser, error) {
+	outFile := util.LongPath(filepath.Join(w.root, filepath.FromSlash(name)))
+	if err := os.MkdirAll(filepath.Dir(outFile), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("make configuration output path(%s): %v", filepath.Dir(outFile), err)
+	}
+	return os.Create(outFile)
+}
+
+func (w *localWriter) LocalPath() string {
+	return w.root
+}
+
+// stdoutWriter prints the files into the stdout like helm template, each file
+// is printed at once when it is closed, so that the files of the concurrent
+// instances are not interleaved.
+type stdoutWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	files int
+}
+
+func (w *stdoutWriter) Create(name string) (io.WriteCloser, error) {
+	return &stdoutFile{w: w, name: name}, nil
+}
+
+func (w *stdoutWriter) LocalPath() string {
+	return ""
+}
+
+type stdoutFile struct {
+	bytes.Buffer
+	w    *stdoutWriter
+	name string
+}
+
+func (f *stdoutFile) Close() error {
+	if f.Len() != 0 && !bytes.HasSuffix(f.Bytes(), []byte("\n")) {
+		f.WriteByte('\n')
+	}
+
+	f.w.mu.Lock()
+	defer f.w.mu.Unlock()
+	f.w.files++
+	if _, err := fmt.Fprintf(f.w.w, "---\n# Source: %s\n", f.name); err != nil {
+		return err
+	}
+	_, err := f.WriteTo(f.w.w)
+	return err
+}
+
+// sshWriter writes the files into a directory of the remote host by the ssh
+// command, so that the ssh configuration and agent of the user are used.
+type sshWriter struct {
+	command []string
+	root    string
+}
+
+func newSSHWriter(u *url.URL) (*sshWriter, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("host of output(%s) not found", u.Redacted())
+	}
+
+	command := []string{"ssh", "-o", "BatchMode=yes"}
+	if u.Port() != "" {
+		command = append(command, "-p", u.Port())
+	}
+
+	target := u.Hostname()
+	if u.User != nil {
+		target = u.User.Username() + "@" + target
+	}
+
+	root := u.Path
+	if root == "" {
+		root = "."
+	}
+	return &sshWriter{command: append(command, target), root: root}, nil
+}
+
+func (w *sshWriter) Create(name string) (io.WriteCloser, error) {
+	remoteFile := path.Join(w.root, name)
+	script := fmt.Sprintf("mkdir -p %s && cat > %s", shellQuote(path.Dir(remoteFile)), shellQuote(remoteFile))
+
+	cmd := exec.Command(w.command[0], append(w.command[1:], script)...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("run ssh for file(%s): %v", remoteFile, err)
+	}
+	return &sshFile{WriteCloser: stdin, cmd: cmd, stderr: stderr, name: remoteFile}, nil
+}
+
+func (w *sshWriter) LocalPath() string {
+	return ""
+}
+
+type sshFile struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	name   string
+}
+
+// Close finishes the input and waits for the remote file to be written.
+func (f *sshFile) Close() error {
+	closeErr := f.WriteCloser.Close()
+	if err := f.cmd.Wait(); err != nil {
+		return fmt.Errorf("write remote file(%s): %v: %s", f.name, err, strings.TrimSpace(f.stderr.String()))
+	}
+	return closeErr
+}
+
+// shellQuote quotes the string for the POSIX shell of the remote host.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// s3Writer puts the files into the bucket with the prefix. The endpoint and the
+// credentials are read from the standard AWS environment variables, the endpoint
+// could be any service compatible with S3.
+type s3Writer struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+func newS3Writer(u *url.URL) (*s3Writer, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("bucket of output(%s) not found", u.Redacted())
+	}
+
+	w := &s3Writer{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    os.Getenv("AWS_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: time.Minute},
+	}
+	if w.region == "" {
+		w.region = "us-east-1"
+	}
+	if w.accessKey == "" || w.secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required by output(%s)", u.Redacted())
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", w.region)
+	}
+
+	var err error
+	if w.endpoint, err = url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid endpoint(%s): %v", endpoint, err)
+	}
+	return w, nil
+}
+
+func (w *s3Writer) Create(name string) (io.WriteCloser, error) {
+	return &s3Object{w: w, key: path.Join(w.prefix, name)}, nil
+}
+
+func (w *s3Writer) LocalPath() string {
+	return ""
+}
+
+// s3Object buffers the content, the object is put when it is closed.
+type s3Object struct {
+	bytes.Buffer
+	w   *s3Writer
+	key string
+}
+
+func (o *s3Object) Close() error {
+	return o.w.put(o.key, o.Bytes())
+}
+
+// put uploads the object with the path-style URL and the signature version 4.
+func (w *s3Writer) put(key string, data []byte) error {
+	u := *w.endpoint
+	u.Path = path.Join("/", u.Path, w.bucket, key)
+	u.RawPath = s3EscapePath(u.Path)
+
+	req, err := http.NewRequest(http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	w.sign(req, data, time.Now().UTC())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("put object(%s): %v", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("put object(%s): %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (w *s3Writer) sign(req *http.Request, data []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(data)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if w.token != "" {
+		req.Header.Set("x-amz-security-token", w.token)
+	}
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if w.token != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+		canonicalHeaders += "x-amz-security-token:" + w.token + "\n"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders,
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + w.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+w.secretKey), date)
+	for _, s := range []string{w.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		w.accessKey, scope, strings.Join(signedHeaders, ";"), hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+// s3EscapePath escapes the path as the signature version 4 requires, only the
+// unreserved characters and the slashes are kept.
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
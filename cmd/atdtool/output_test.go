@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeOutputFile(w outputWriter, name, content string) error {
+	f, err := w.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func TestNewOutputWriter(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "ak")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "sk")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+
+	w, err := newOutputWriter("out/dir")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "out/dir", w.LocalPath())
+	}
+
+	w, err = newOutputWriter("ssh://deploy@10.0.0.1:2222/data/cfg")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", w.LocalPath())
+		assert.Equal(t, []string{"ssh", "-o", "BatchMode=yes", "-p", "2222", "deploy@10.0.0.1"}, w.(*sshWriter).command)
+		assert.Equal(t, "/data/cfg", w.(*sshWriter).root)
+	}
+
+	w, err = newOutputWriter("s3://bucket/cfg/")
+	if assert.NoError(t, err) {
+		s3 := w.(*s3Writer)
+		assert.Equal(t, "bucket", s3.bucket)
+		assert.Equal(t, "cfg", s3.prefix)
+		assert.Equal(t, "https://s3.us-east-1.amazonaws.com", s3.endpoint.String())
+	}
+
+	_, err = newOutputWriter("ftp://host/dir")
+	assert.ErrorContains(t, err, "unsupport output scheme")
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	_, err = newOutputWriter("s3://bucket")
+	assert.ErrorContains(t, err, "AWS_SECRET_ACCESS_KEY")
+}
+
+func TestLocalWriter(t *testing.T) {
+	root := t.TempDir()
+	w := &localWriter{root: root}
+	if !assert.NoError(t, writeOutputFile(w, "echo/cfg/echo.yaml", "a: 1\n")) {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "echo", "cfg", "echo.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a: 1\n", string(data))
+	}
+}
+
+func TestSSHWriter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh command is a shell script")
+	}
+
+	// the fake ssh runs the remote script locally
+	dir := t.TempDir()
+	fakeSSH := filepath.Join(dir, "ssh")
+	if err := os.WriteFile(fakeSSH, []byte("#!/bin/sh\nfor last; do :; done\nexec sh -c \"$last\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(dir, "it's remote")
+	w := &sshWriter{command: []string{fakeSSH, "host"}, root: root}
+	if !assert.NoError(t, writeOutputFile(w, "echo/cfg/echo.yaml", "a: 1\n")) {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "echo", "cfg", "echo.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a: 1\n", string(data))
+	}
+
+	w.root = "/dev/null/cfg"
+	assert.ErrorContains(t, writeOutputFile(w, "echo.yaml", "a: 1\n"), "write remote file(/dev/null/cfg/echo.yaml)")
+}
+
+func TestS3Writer(t *testing.T) {
+	objects := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential := "AWS4-HMAC-SHA256 Credential=ak/" + time.Now().UTC().Format("20060102") + "/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.Header.Get("Authorization"), credential) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		assert.Equal(t, sha256Hex(data), r.Header.Get("x-amz-content-sha256"))
+		objects[r.URL.EscapedPath()] = string(data)
+	}))
+	defer srv.Close()
+
+	endpoint, _ := url.Parse(srv.URL)
+	w := &s3Writer{
+		endpoint:  endpoint,
+		bucket:    "bucket",
+		prefix:    "cfg",
+		region:    "us-east-1",
+		accessKey: "ak",
+		secretKey: "sk",
+		client:    srv.Client(),
+	}
+	if !assert.NoError(t, writeOutputFile(w, "echo/bin/start 1+1.sh", "echo\n")) {
+		return
+	}
+	assert.Equal(t, map[string]string{"/bucket/cfg/echo/bin/start%201%2B1.sh": "echo\n"}, objects)
+
+	w.accessKey = "other"
+	assert.ErrorContains(t, writeOutputFile(w, "echo.yaml", ""), "403 Forbidden")
+}
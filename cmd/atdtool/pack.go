@@ -0,0 +1,193 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// packManifestFile is the manifest in the root of the pack.
+const packManifestFile = "manifest.yaml"
+
+// packManifest describes the pack, the instances and the files in it.
+type packManifest struct {
+	Version   string          `json:"version"`
+	Generated string          `json:"generated"`
+	Generator string          `json:"generator"`
+	Instances []*packInstance `json:"instances"`
+	Files     []*packFile     `json:"files"`
+}
+
+// packInstance is an instance rendered into the pack.
+type packInstance struct {
+	Name         string   `json:"name"`
+	BusAddr      string   `json:"bus_addr"`
+	Chart        string   `json:"chart"`
+	ChartVersion string   `json:"chart_version,omitempty"`
+	ValuesDigest string   `json:"values_digest"`
+	Files        []string `json:"files"`
+}
+
+// packFile is a file in the pack.
+type packFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// packWriter holds the rendered files in memory, then writes them into a
+// tar.gz with the manifest, the same inputs always produce the same pack.
+type packWriter struct {
+	mu        sync.Mutex
+	files     map[string][]byte
+	instances []*packInstance
+}
+
+func (w *packWriter) Create(name string) (io.WriteCloser, error) {
+	return &packEntry{w: w, name: name}, nil
+}
+
+func (w *packWriter) LocalPath() string {
+	return ""
+}
+
+// addInstance records an instance rendered into the pack.
+func (w *packWriter) addInstance(inst *packInstance) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.instances = append(w.instances, inst)
+}
+
+// manifest returns the manifest of the rendered instances and files.
+func (w *packWriter) manifest(version string, generated time.Time) *packManifest {
+	generator := toolName
+	if v := ToolVersion(); v != "" {
+		generator += " " + v
+	}
+
+	m := &packManifest{
+		Version:   version,
+		Generated: generated.UTC().Format(time.RFC3339),
+		Generator: generator,
+		Instances: append([]*packInstance{}, w.instances...),
+	}
+	sort.Slice(m.Instances, func(i, j int) bool {
+		if m.Instances[i].Name != m.Instances[j].Name {
+			return m.Instances[i].Name < m.Instances[j].Name
+		}
+		return m.Instances[i].BusAddr < m.Instances[j].BusAddr
+	})
+
+	for name, data := range w.files {
+		digest := sha256.Sum256(data)
+		m.Files = append(m.Files, &packFile{Path: name, Size: len(data), SHA256: hex.EncodeToString(digest[:])})
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	return m
+}
+
+// write writes the pack into the file, the manifest is the first entry and the
+// files are sorted by their names.
+func (w *packWriter) write(filename, version string, generated time.Time) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	m := w.manifest(version, generated)
+	manifest, err := yaml.Marshal(m)
+	if err != nil {
+		return 0, fmt.Errorf("marshal pack manifest: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	if err != nil {
+		return 0, err
+	}
+	zw.ModTime = generated
+	tw := tar.NewWriter(zw)
+	writeEntry := func(name string, data []byte) error {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			ModTime:  generated,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := writeEntry(packManifestFile, manifest); err != nil {
+		return 0, fmt.Errorf("write pack manifest: %v", err)
+	}
+	for _, f := range m.Files {
+		if err := writeEntry(f.Path, w.files[f.Path]); err != nil {
+			return 0, fmt.Errorf("write file(%s) into pack: %v", f.Path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+
+	// the pack is replaced at once, the deployment never sees a partial pack
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return 0, fmt.Errorf("make pack path(%s): %v", filepath.Dir(filename), err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return 0, fmt.Errorf("create pack(%s): %v", filename, err)
+	}
+	_ = f.Chmod(0644)
+	if _, err := buf.WriteTo(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return 0, fmt.Errorf("write pack(%s): %v", filename, err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return 0, fmt.Errorf("close pack(%s): %v", filename, err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		_ = os.Remove(f.Name())
+		return 0, fmt.Errorf("rename pack(%s): %v", filename, err)
+	}
+	return len(m.Files), nil
+}
+
+// packEntry holds a rendered file until it is closed.
+type packEntry struct {
+	bytes.Buffer
+	w    *packWriter
+	name string
+}
+
+func (e *packEntry) Close() error {
+	e.w.mu.Lock()
+	defer e.w.mu.Unlock()
+
+	if e.w.files == nil {
+		e.w.files = make(map[string][]byte)
+	}
+	e.w.files[e.name] = e.Bytes()
+	return nil
+}
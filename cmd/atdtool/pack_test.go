@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestTemplateOptionsRunPack(t *testing.T) {
+	packPath := filepath.Join(t.TempDir(), "release", "config.tar.gz")
+	stdout := &bytes.Buffer{}
+	o := &templateOptions{
+		chartPath:   fixturePath("charts"),
+		packPath:    packPath,
+		packVersion: "1.2.3",
+		parallel:    2,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	assert.Contains(t, stdout.String(), "pack 4 files into "+packPath)
+
+	f, err := os.Open(packPath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if !assert.NoError(t, err) {
+		return
+	}
+	tr := tar.NewReader(zr)
+
+	var names []string
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		names = append(names, hdr.Name)
+		files[hdr.Name] = data
+	}
+
+	// the manifest is the first and the files are sorted
+	if !assert.Len(t, names, 5) {
+		return
+	}
+	assert.Equal(t, packManifestFile, names[0])
+	assert.True(t, sort.StringsAreSorted(names[1:]))
+	assert.Contains(t, string(files["echo/cfg/echo_1.2.42.3.yaml"]), "bus_addr: 1.2.42.3")
+
+	m := &packManifest{}
+	if !assert.NoError(t, yaml.Unmarshal(files[packManifestFile], m)) {
+		return
+	}
+	assert.Equal(t, "1.2.3", m.Version)
+	if assert.Len(t, m.Instances, 2) {
+		inst := m.Instances[0]
+		assert.Equal(t, "echo", inst.Name)
+		assert.Equal(t, "1.2.42.3", inst.BusAddr)
+		assert.Equal(t, "echo", inst.Chart)
+		assert.NotEmpty(t, inst.ChartVersion)
+		assert.Regexp(t, "^sha256:[0-9a-f]{64}$", inst.ValuesDigest)
+		assert.ElementsMatch(t, []string{"echo/cfg/echo_1.2.42.3.yaml", "echo/bin/start_1.2.42.3.sh"}, inst.Files)
+	}
+	if assert.Len(t, m.Files, 4) {
+		for _, pf := range m.Files {
+			digest := sha256.Sum256(files[pf.Path])
+			assert.Equal(t, hex.EncodeToString(digest[:]), pf.SHA256, pf.Path)
+			assert.Equal(t, len(files[pf.Path]), pf.Size, pf.Path)
+		}
+	}
+
+	o = &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   t.TempDir(),
+		packPath:  packPath,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "--pack and --output")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// The formats of the render report.
+const (
+	reportJSON = "json"
+	reportYAML = "yaml"
+)
+
+// The status of the instances in the render report.
+const (
+	reportRendered = "rendered"
+	// reportUnchanged is the instance skipped by the incremental render
+	reportUnchanged = "unchanged"
+)
+
+// renderReport is the machine-readable summary of a render, for the deployment
+// automation instead of parsing the progress lines.
+type renderReport struct {
+	Generated string            `json:"generated"`
+	Generator string            `json:"generator"`
+	Output    string            `json:"output,omitempty"`
+	Instances []*reportInstance `json:"instances"`
+
+	mu sync.Mutex
+}
+
+// reportInstance is an instance in the render report, the paths of the files
+// are relative to the output.
+type reportInstance struct {
+	Name         string      `json:"name"`
+	BusAddr      string      `json:"bus_addr"`
+	Chart        string      `json:"chart"`
+	ChartVersion string      `json:"chart_version,omitempty"`
+	Status       string      `json:"status"`
+	Files        []*packFile `json:"files"`
+	Warnings     []string    `json:"warnings,omitempty"`
+}
+
+// addInstance records an instance, the warnings of its files are checked.
+func (r *renderReport) addInstance(inst *reportInstance) {
+	if inst.Files == nil {
+		inst.Files = []*packFile{}
+	}
+	if len(inst.Files) == 0 && inst.Status == reportRendered {
+		inst.Warnings = append(inst.Warnings, "no file rendered")
+	}
+	for _, f := range inst.Files {
+		if f.Size == 0 {
+			inst.Warnings = append(inst.Warnings, fmt.Sprintf("file %s is empty", f.Path))
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Instances = append(r.Instances, inst)
+}
+
+// write writes the report in the format, the instances are sorted by the chart
+// names and the bus addresses.
+func (r *renderReport) write(out io.Writer, format string, generated time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Generated = generated.UTC().Format(time.RFC3339)
+	r.Generator = toolName
+	if v := ToolVersion(); v != "" {
+		r.Generator += " " + v
+	}
+	if r.Instances == nil {
+		r.Instances = []*reportInstance{}
+	}
+	sort.Slice(r.Instances, func(i, j int) bool {
+		if r.Instances[i].Name != r.Instances[j].Name {
+			return r.Instances[i].Name < r.Instances[j].Name
+		}
+		return r.Instances[i].BusAddr < r.Instances[j].BusAddr
+	})
+
+	var (
+		data []byte
+		err  error
+	)
+	if format == reportJSON {
+		data, err = json.MarshalIndent(r, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(r)
+	}
+	if err != nil {
+		return fmt.Errorf("marshal render report: %v", err)
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+// writeFile writes the report into the file, or out if the file is empty.
+func (r *renderReport) writeFile(name string, out io.Writer, format string, generated time.Time) error {
+	if name == "" {
+		return r.write(out, format, generated)
+	}
+
+	f, err := os.Create(util.LongPath(name))
+	if err != nil {
+		return fmt.Errorf("create render report: %v", err)
+	}
+	if err := r.write(f, format, generated); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// reportFileInfo reads the size and the checksum of a file in the local
+// output, which is not rendered again.
+func reportFileInfo(name, localFile string) (*packFile, error) {
+	data, err := os.ReadFile(localFile)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	return &packFile{Path: name, Size: len(data), SHA256: hex.EncodeToString(digest[:])}, nil
+}
+
+// reportWriter records the sizes and the checksums of the files written into
+// the output.
+type reportWriter struct {
+	outputWriter
+	files []*packFile
+}
+
+func (w *reportWriter) Create(name string) (io.WriteCloser, error) {
+	f, err := w.outputWriter.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &reportedFile{WriteCloser: f, w: w, name: name, hash: sha256.New()}, nil
+}
+
+// reportedFile digests the content written into the file.
+type reportedFile struct {
+	io.WriteCloser
+	w    *reportWriter
+	name string
+	hash hash.Hash
+	size int
+}
+
+func (f *reportedFile) Write(p []byte) (int, error) {
+	n, err := f.WriteCloser.Write(p)
+	f.hash.Write(p[:n])
+	f.size += n
+	return n, err
+}
+
+func (f *reportedFile) Close() error {
+	if err := f.WriteCloser.Close(); err != nil {
+		return err
+	}
+
+	file := &packFile{Path: f.name, Size: f.size, SHA256: hex.EncodeToString(f.hash.Sum(nil))}
+	for i, prev := range f.w.files {
+		// the file is rendered again
+		if prev.Path == f.name {
+			f.w.files[i] = file
+			return nil
+		}
+	}
+	f.w.files = append(f.w.files, file)
+	return nil
+}
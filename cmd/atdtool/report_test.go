@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestTemplateOptionsRunReport(t *testing.T) {
+	outDir := t.TempDir()
+	progress := &bytes.Buffer{}
+	o := &templateOptions{
+		chartPath:    fixturePath("charts"),
+		outPath:      outDir,
+		reportFormat: reportJSON,
+		errOut:       progress,
+		valOpts:      values.Options{Paths: []string{fixturePath("values", "default")}},
+	}
+	stdout := &bytes.Buffer{}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	assert.Contains(t, progress.String(), "create('echo', '1.2.42.3') configuration success")
+
+	report := &renderReport{}
+	if !assert.NoError(t, json.Unmarshal(stdout.Bytes(), report)) {
+		return
+	}
+	assert.Equal(t, outDir, report.Output)
+	if !assert.Len(t, report.Instances, 2) {
+		return
+	}
+	inst := report.Instances[0]
+	assert.Equal(t, "echo", inst.Name)
+	assert.Equal(t, "1.2.42.3", inst.BusAddr)
+	assert.Equal(t, "echo", inst.Chart)
+	assert.Equal(t, reportRendered, inst.Status)
+	assert.Empty(t, inst.Warnings)
+	if assert.Len(t, inst.Files, 2) {
+		for _, f := range inst.Files {
+			data, err := os.ReadFile(filepath.Join(outDir, filepath.FromSlash(f.Path)))
+			if assert.NoError(t, err) {
+				digest := sha256.Sum256(data)
+				assert.Equal(t, len(data), f.Size)
+				assert.Equal(t, hex.EncodeToString(digest[:]), f.SHA256)
+			}
+		}
+	}
+
+	// the instances skipped by the incremental render are reported as unchanged
+	reportFile := filepath.Join(t.TempDir(), "report.yaml")
+	o.reportFormat, o.reportFile = reportYAML, reportFile
+	stdout.Reset()
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	assert.Contains(t, stdout.String(), "skip('echo', '1.2.42.3') configuration unchanged")
+	data, err := os.ReadFile(reportFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	unchanged := &renderReport{}
+	if assert.NoError(t, yaml.Unmarshal(data, unchanged)) && assert.Len(t, unchanged.Instances, 2) {
+		assert.Equal(t, reportUnchanged, unchanged.Instances[0].Status)
+		assert.Equal(t, inst.Files, unchanged.Instances[0].Files)
+	}
+
+	o.reportFormat = "xml"
+	assert.ErrorContains(t, o.run(stdout), "unknown report format: xml")
+
+	o.reportFormat, o.reportFile, o.outPath = reportJSON, "", ""
+	assert.ErrorContains(t, o.run(stdout), "--report-file is required")
+}
+
+func TestRenderReportWarnings(t *testing.T) {
+	r := &renderReport{}
+	r.addInstance(&reportInstance{Name: "echo", BusAddr: "1.2.42.4", Status: reportRendered})
+	r.addInstance(&reportInstance{Name: "echo", BusAddr: "1.2.42.3", Status: reportRendered, Files: []*packFile{{Path: "echo/a.yaml"}}})
+
+	out := &bytes.Buffer{}
+	if !assert.NoError(t, r.write(out, reportYAML, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))) {
+		return
+	}
+	assert.Equal(t, "1.2.42.3", r.Instances[0].BusAddr)
+	assert.Equal(t, []string{"file echo/a.yaml is empty"}, r.Instances[0].Warnings)
+	assert.Equal(t, []string{"no file rendered"}, r.Instances[1].Warnings)
+	assert.Contains(t, out.String(), "- no file rendered\n")
+}
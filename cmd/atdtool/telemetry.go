@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// telemetryEndpointEnv enables the telemetry, nothing is sent if it is not set
+	telemetryEndpointEnv = "ATDTOOL_TELEMETRY_ENDPOINT"
+	// telemetryTimeout limits the delay of the command caused by the telemetry
+	telemetryTimeout = 2 * time.Second
+)
+
+// telemetryEvent is the anonymous usage of a command. Only the names of the
+// flags are sent, the args and the values of the flags are never sent.
+type telemetryEvent struct {
+	Command    string         `json:"command"`
+	Flags      []string       `json:"flags,omitempty"`
+	Version    string         `json:"version,omitempty"`
+	OS         string         `json:"os"`
+	Arch       string         `json:"arch"`
+	DurationMs int64          `json:"duration_ms"`
+	Counts     map[string]int `json:"counts,omitempty"`
+	ErrorClass string         `json:"error_class,omitempty"`
+}
+
+// telemetryCounts are counted by the commands, e.g. the rendered instances.
+var (
+	telemetryCounts   = make(map[string]int)
+	telemetryCountsMu sync.Mutex
+)
+
+func countTelemetry(name string, n int) {
+	telemetryCountsMu.Lock()
+	defer telemetryCountsMu.Unlock()
+	telemetryCounts[name] += n
+}
+
+func newTelemetryEvent(cmd *cobra.Command, duration time.Duration, err error) *telemetryEvent {
+	e := &telemetryEvent{
+		Version:    ToolVersion(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		DurationMs: duration.Milliseconds(),
+		ErrorClass: errorClass(err),
+	}
+	if cmd != nil {
+		e.Command = cmd.CommandPath()
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			e.Flags = append(e.Flags, f.Name)
+		})
+	}
+	if len(telemetryCounts) != 0 {
+		e.Counts = telemetryCounts
+	}
+	return e
+}
+
+// errorClass returns the class of the error, the message is not sent because
+// it may contain the paths or the values.
+func errorClass(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, fs.ErrNotExist):
+		return "not_exist"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	}
+
+	// the usage errors of cobra are not typed
+	msg := err.Error()
+	for _, usage := range []string{"unknown command", "unknown flag", "unknown shorthand flag", "flag needs an argument", "invalid argument", "accepts", "requires"} {
+		if strings.HasPrefix(msg, usage) || strings.Contains(msg, "\" "+usage) {
+			return "usage"
+		}
+	}
+	return "error"
+}
+
+// reportTelemetry sends the usage of the command to the endpoint if the telemetry
+// is enabled. The command is never failed by the telemetry.
+func reportTelemetry(cmd *cobra.Command, duration time.Duration, err error) {
+	endpoint := os.Getenv(telemetryEndpointEnv)
+	if endpoint == "" {
+		return
+	}
+
+	data, jsonErr := json.Marshal(newTelemetryEvent(cmd, duration, err))
+	if jsonErr != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryTimeout)
+	defer cancel()
+
+	req, reqErr := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if reqErr != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, reqErr := http.DefaultClient.Do(req)
+	if reqErr != nil {
+		return
+	}
+	resp.Body.Close()
+}
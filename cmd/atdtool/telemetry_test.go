@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportTelemetry(t *testing.T) {
+	events := make(chan *telemetryEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := new(telemetryEvent)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(e))
+		events <- e
+	}))
+	defer srv.Close()
+
+	args := []string{"merge-values", "--values", "secret/path", "--output", "out.yaml"}
+	cmd, err := newRootCmd(&bytes.Buffer{}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.SetArgs(args)
+	cmd.SetErr(io.Discard)
+	executed, err := cmd.ExecuteC()
+
+	// nothing is sent if the telemetry is not enabled
+	t.Setenv(telemetryEndpointEnv, "")
+	reportTelemetry(executed, time.Second, err)
+	assert.Empty(t, events)
+
+	t.Setenv(telemetryEndpointEnv, srv.URL)
+	reportTelemetry(executed, time.Second, err)
+
+	e := <-events
+	assert.Equal(t, "atdtool merge-values", e.Command)
+	assert.Equal(t, []string{"output", "values"}, e.Flags)
+	assert.Equal(t, int64(1000), e.DurationMs)
+	// the chart is missing
+	assert.Equal(t, "usage", e.ErrorClass)
+
+	// the telemetry never fails the command
+	t.Setenv(telemetryEndpointEnv, "http://127.0.0.1:0/")
+	reportTelemetry(executed, time.Second, err)
+}
+
+func TestErrorClass(t *testing.T) {
+	assert.Equal(t, "", errorClass(nil))
+	assert.Equal(t, "not_exist", errorClass(fmt.Errorf("load: %w", os.ErrNotExist)))
+	assert.Equal(t, "usage", errorClass(fmt.Errorf(`unknown flag: --foo`)))
+	assert.Equal(t, "usage", errorClass(fmt.Errorf(`"atdtool init env" requires 1 argument`)))
+	assert.Equal(t, "error", errorClass(fmt.Errorf("render failed")))
+}
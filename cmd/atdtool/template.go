@@ -1,20 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/mitchellh/copystructure"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/chart"
-	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/engine"
 
@@ -35,12 +39,141 @@ Multiple paths are separated by commas. The priority will be given to the last
 
 You can specify the '--set'/'-s' flag multiple times. The priority will be given to the
 last (right-most) set specified.
+
+The chart can provide 'hooks/pre-render.tpl' and 'hooks/post-render.tpl', they are
+rendered with the instance values and executed as shell scripts before and after
+the instance is rendered. The '--pre-render-hook' and '--post-render-hook' flags
+specify commands which are executed after the chart hooks in the same way. The
+'hooks/post-render-all.tpl' of the chart and the '--post-render-all-hook' flag are
+executed once for each chart after all its instances are rendered.
+
+The '--pack' flag writes all rendered files into a tar.gz instead of the output,
+with a manifest.yaml of the chart versions, the values digests and the sha256 of
+the files, which could be handed to the deployment system as an artifact.
+
+Without '--output' and '--pack', the rendered files are printed to stdout, each one
+is prefixed with its source like helm template, and the hooks are not executed.
+The '--show-only' flag only prints the templates matching the glob patterns of the
+template paths relative to the chart, e.g. '--show-only cfg/*.yaml.tpl'.
+
+The '--post-renderer' flag specifies a command which receives each rendered file
+on the stdin, its stdout is written as the content of the file, e.g. to sign the
+files or convert their formats.
+
+The '--output' flag accepts a local directory, or publishes the rendered files
+directly to where they are consumed:
+
+    ssh://[user@]host[:port]/path   written by the ssh command, sftp:// is the same
+    s3://bucket/prefix              put to the object storage compatible with S3,
+                                    AWS_ENDPOINT_URL, AWS_REGION, AWS_ACCESS_KEY_ID
+                                    and AWS_SECRET_ACCESS_KEY are read from the environment
+
+The hooks are only supported by the local output.
+
+The '--header' flag stamps every rendered file with a comment header, including
+the tool version, chart, digest of the values and generated time. The comment
+syntax is chosen by the file extension, the files of a format without comments
+such as json are written as is. The '--no-header' flag specifies the patterns of
+the file names which could not tolerate comments, e.g. '--no-header=*.ini'.
+
+The files with the extensions of '--template-ext' are rendered as the templates,
+'.tpl' and '.template' by default. These two extensions are trimmed from the output
+file names, the others such as '.yaml' and '.conf' are kept, so that the charts
+using them need not rename their files, e.g. '--template-ext .tpl,.yaml,.conf'.
+
+The '--output-layout' flag decides the paths of the rendered files:
+
+    flat        <chart>/<dir>/<file>_<bus_addr>.<ext>, the default
+    instance    <chart>/<bus_addr>/<dir>/<file>.<ext>
+    <template>  a Go template of the path with .Name, .TypeID, .BusAddr, .Dir,
+                .File, .Stem and .Ext, e.g. '{{ .Name }}-{{ .BusAddr }}/{{ .File }}'
+
+The '--only' and '--skip' flags select the instances to render by the chart names,
+the bus addresses or their glob patterns, e.g. '--only gamesvr,2.3.*.*'. An
+instance is rendered if it matches any pattern of '--only' and none of '--skip'.
+
+The rendering of a local output is incremental, the instances whose charts and
+values are not changed since the last rendering are skipped, and the files which
+are no longer rendered are removed. The state is recorded in the
+.atdtool-render.json of the output, only the files recorded in it are removed.
+The '--force' flag renders all instances.
 `
 
 type templateOptions struct {
-	chartPath string
-	outPath   string
-	valOpts   values.Options
+	chartPath      string
+	outPath        string
+	valOpts        values.Options
+	preRenderHook  string
+	postRenderHook string
+	// postRenderAllHook is executed for each chart after all instances are rendered
+	postRenderAllHook string
+	// postRenderer transforms each rendered file
+	postRenderer string
+	hookTimeout  time.Duration
+	header       bool
+	// validate parses the rendered xml, json, yaml and toml files
+	validate bool
+	// templateExt are the extensions of the templates, which are parsed into exts
+	templateExt []string
+	exts        templateExts
+	// outputLayout is the layout of the rendered files, which is parsed into layout
+	outputLayout string
+	layout       *outputLayout
+	noHeader     []string
+	only         []string
+	skip         []string
+	// zones and zoneList select the zones rendered in a batch, each zone is
+	// written into its own directory of the output
+	zones    []string
+	zoneList string
+
+	// renderTime is stamped in the headers of all files rendered in a run
+	renderTime time.Time
+
+	// writer writes the rendered files into the output, it is created from
+	// outPath if it is not set
+	writer outputWriter
+	// skipHooks skips the render hooks, when the files are not written into
+	// the output
+	skipHooks bool
+
+	// parallel is the number of the instances rendered concurrently
+	parallel int
+	// force renders all instances even if their inputs are not changed
+	force bool
+	// state records the rendered instances of the local output
+	state *renderState
+	// packPath is the tar.gz which the rendered files are packed into instead
+	// of the output
+	packPath    string
+	packVersion string
+	// atomic renders into a staging copy of the output, which replaces the
+	// output on success, atomicBackups previous outputs are retained
+	atomic        bool
+	atomicBackups int
+	pack          *packWriter
+	// reportFormat is the format of the render report written into
+	// reportFile, or stdout if it is empty
+	reportFormat string
+	reportFile   string
+	report       *renderReport
+	// errOut prints the progress lines when the report is written into stdout
+	errOut io.Writer
+	// watch renders again after the chart or the values are changed, the
+	// changes within watchDebounce are rendered once
+	watch         bool
+	watchDebounce time.Duration
+	// showOnly are the patterns of the templates printed to stdout
+	showOnly []string
+	// stdout prints the rendered files when no output is specified
+	stdout *stdoutWriter
+
+	// renderers caches the parsed charts, which are shared by the instances
+	renderers   map[string]*chartRenderer
+	renderersMu sync.Mutex
+	// rendered are the charts which have any instance rendered, it is also
+	// guarded by renderersMu
+	rendered map[string]bool
 }
 
 func newTemplateCmd(out io.Writer) *cobra.Command {
@@ -62,6 +195,12 @@ func newTemplateCmd(out io.Writer) *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			o.chartPath = args[0]
+			o.errOut = cmd.ErrOrStderr()
+			if o.watch {
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				return o.watchRender(ctx, out)
+			}
 			if err := o.run(out); err != nil {
 				return err
 			}
@@ -75,7 +214,32 @@ func newTemplateCmd(out io.Writer) *cobra.Command {
 
 	f := cmd.Flags()
 	addValueOptionsFlags(f, &o.valOpts)
-	f.StringVarP(&o.outPath, "output", "o", "", "specify templates rendered result save path")
+	f.StringVarP(&o.outPath, "output", "o", "", "specify templates rendered result save path, ssh://[user@]host[:port]/path and s3://bucket/prefix are supported")
+	f.StringVar(&o.preRenderHook, "pre-render-hook", "", "command executed before rendering each instance")
+	f.StringVar(&o.postRenderHook, "post-render-hook", "", "command executed after rendering each instance")
+	f.StringVar(&o.postRenderAllHook, "post-render-all-hook", "", "command executed for each chart after rendering all its instances")
+	f.StringVar(&o.postRenderer, "post-renderer", "", "command transforming each rendered file from its stdin to its stdout")
+	f.DurationVar(&o.hookTimeout, "hook-timeout", 5*time.Minute, "time to wait for each hook execution")
+	f.StringSliceVar(&o.templateExt, "template-ext", []string{".tpl", ".template"}, "extensions of the files rendered as the templates, .tpl and .template are trimmed from the output file names")
+	f.StringVar(&o.outputLayout, "output-layout", layoutFlat, "layout of the rendered files: flat, instance or a Go template of the file paths")
+	f.BoolVar(&o.header, "header", false, "stamp the rendered files with a comment header for audit")
+	f.BoolVar(&o.validate, "validate", false, "fail if a rendered xml, json, yaml or toml file has syntax errors")
+	f.StringSliceVar(&o.noHeader, "no-header", []string{}, "patterns of the file names written without header, can specify multiple or separate values with commas")
+	f.StringSliceVar(&o.only, "only", []string{}, "only render the instances matching the chart names or bus address patterns, can specify multiple or separate values with commas")
+	f.StringSliceVar(&o.skip, "skip", []string{}, "skip the instances matching the chart names or bus address patterns, can specify multiple or separate values with commas")
+	f.StringSliceVar(&o.zones, "zones", []string{}, "render the zones in a batch, each into its own directory of the output, e.g. 1-50 or WORLD:ZONES like 2:1-50, can specify multiple or separate values with commas")
+	f.StringVar(&o.zoneList, "zone-list", "", "file of the zones rendered in a batch like --zones, separated by lines, spaces or commas")
+	f.IntVar(&o.parallel, "parallel", 1, "number of instances rendered concurrently")
+	f.StringVar(&o.packPath, "pack", "", "pack the rendered files into a tar.gz with a manifest instead of writing them into the output")
+	f.StringVar(&o.packVersion, "pack-version", "", "version of the pack recorded in the manifest, the render time by default")
+	f.BoolVar(&o.atomic, "atomic", false, "render into a staging copy of the output directory and swap it into place only if all instances succeed")
+	f.IntVar(&o.atomicBackups, "atomic-backups", 0, "number of the previous output directories retained beside the output by --atomic")
+	f.StringVar(&o.reportFormat, "report", "", "write a summary of the rendered instances and files in json or yaml")
+	f.StringVar(&o.reportFile, "report-file", "", "file of the report, the report is written into stdout and the progress into stderr by default")
+	f.StringSliceVar(&o.showOnly, "show-only", []string{}, "only print the templates matching the patterns of the template paths relative to the chart, can specify multiple or separate values with commas")
+	f.BoolVar(&o.watch, "watch", false, "watch the chart and the values, render again after they are changed")
+	f.DurationVar(&o.watchDebounce, "watch-debounce", 500*time.Millisecond, "time to wait for more changes before rendering again in --watch")
+	f.BoolVar(&o.force, "force", false, "render all instances even if their charts and values are not changed")
 	return cmd
 }
 
@@ -100,110 +264,655 @@ func (o *templateOptions) run(out io.Writer) (err error) {
 		return fmt.Errorf("load noncloudnative configuration: %v", err)
 	}
 
-	var optGlobalVals map[string]any
-	var ok bool = false
-	optGlobalVals, ok = optVals["global"].(map[string]any)
-	if ok {
-		// 覆盖 WorldId 与 ZoneId
-		if w, ok := optGlobalVals["world_id"]; ok {
-			var worldId uint64 = 0
-			worldId, err = convertToUint64Opt("world_id", w)
-			if err != nil {
-				return err
+	worldFilter, zoneFilter, err := deployTargetFilter(optVals, nonCloudNativeCfg)
+	if err != nil {
+		return err
+	}
+
+	zoneBatch, err := o.zoneBatch()
+	if err != nil {
+		return err
+	}
+	// the world and zone of the instances in the batch are not overridden
+	if global, _ := optVals["global"].(map[string]any); zoneBatch != nil && (global["world_id"] != nil || global["zone_id"] != nil) {
+		return fmt.Errorf("--zones and --zone-list can not be used with --set global.world_id or global.zone_id")
+	}
+
+	if len(o.showOnly) != 0 && (o.outPath != "" || o.packPath != "") {
+		return fmt.Errorf("--show-only can not be used with --output or --pack")
+	}
+
+	if o.atomic && (o.outPath == "" || o.packPath != "") {
+		return fmt.Errorf("--atomic requires --output without --pack")
+	}
+
+	o.report = nil
+	if o.reportFormat != "" {
+		if o.reportFormat != reportJSON && o.reportFormat != reportYAML {
+			return fmt.Errorf("unknown report format: %s, should be %s or %s", o.reportFormat, reportJSON, reportYAML)
+		}
+		if o.reportFile == "" && o.writer == nil && o.outPath == "" && o.packPath == "" {
+			return fmt.Errorf("--report-file is required when the rendered files are printed to stdout")
+		}
+
+		o.report = &renderReport{Output: o.outPath}
+		if o.packPath != "" {
+			o.report.Output = o.packPath
+		}
+		reportOut := out
+		if o.reportFile == "" {
+			out = o.errOut
+			if out == nil {
+				out = io.Discard
 			}
-			nonCloudNativeCfg.Deploy.WorldID = worldId
-			optGlobalVals["world_id"] = worldId
 		}
-		if z, ok := optGlobalVals["zone_id"]; ok {
-			var zoneId uint64 = 0
-			zoneId, err = convertToUint64Opt("zone_id", z)
-			if err != nil {
+		// the report is written after the output is swapped into place
+		defer func() {
+			if err == nil {
+				err = o.report.writeFile(o.reportFile, reportOut, o.reportFormat, o.renderTime)
+			}
+		}()
+	}
+
+	// the writer created from the options is not reused by the next run
+	if o.writer == nil {
+		defer func() {
+			o.writer = nil
+		}()
+	}
+	o.pack = nil
+	o.stdout = nil
+	if o.writer == nil && o.packPath != "" {
+		if o.outPath != "" {
+			return fmt.Errorf("--pack and --output can not be used together")
+		}
+		o.pack = &packWriter{}
+		o.writer = o.pack
+	}
+	if o.writer == nil && o.outPath == "" {
+		// no output specified, use standard output and only the rendered
+		// files are printed
+		o.stdout = &stdoutWriter{w: out}
+		o.writer = o.stdout
+		out = io.Discard
+	}
+	if o.writer == nil {
+		o.writer, err = newOutputWriter(o.outPath)
+		if err != nil {
+			return err
+		}
+		if o.atomic {
+			root := o.writer.LocalPath()
+			if root == "" {
+				return fmt.Errorf("--atomic only supports the local output directory: %s", o.outPath)
+			}
+			var tx *atomicOutput
+			if tx, err = beginAtomicOutput(root, o.atomicBackups); err != nil {
 				return err
 			}
-			nonCloudNativeCfg.Deploy.ZoneId = zoneId
-			optGlobalVals["zone_id"] = zoneId
+			o.writer = &localWriter{root: tx.staging}
+			defer func() {
+				err = tx.finish(err)
+			}()
 		}
 	}
 
-	if o.outPath == "" {
-		return fmt.Errorf("outPath not found")
+	for _, pattern := range o.noHeader {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid no-header pattern(%s): %v", pattern, err)
+		}
+	}
+	for _, pattern := range o.showOnly {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid show-only pattern(%s): %v", pattern, err)
+		}
+	}
+	for _, pattern := range append(o.only, o.skip...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid instance pattern(%s): %v", pattern, err)
+		}
+	}
+	if o.exts, err = parseTemplateExts(o.templateExt); err != nil {
+		return err
+	}
+	if o.layout, err = parseOutputLayout(o.outputLayout); err != nil {
+		return err
+	}
+	o.renderTime = time.Now()
+	if o.hookTimeout <= 0 {
+		o.hookTimeout = 5 * time.Minute
 	}
 
-	for _, Instance := range nonCloudNativeCfg.Deploy.Instance {
-		for i := uint64(0); i < Instance.InstanceCount; i++ {
-			insID := Instance.StartInstanceId + i
-			addrCom := []string{}
-			addrCom = append(addrCom, fmt.Sprint(nonCloudNativeCfg.Deploy.WorldID))
-			if Instance.WorldInstance {
-				addrCom = append(addrCom, fmt.Sprint(0))
-			} else {
-				addrCom = append(addrCom, fmt.Sprint(nonCloudNativeCfg.Deploy.ZoneId))
+	targets, err := nonCloudNativeCfg.Deploy.Targets()
+	if err != nil {
+		return fmt.Errorf("load noncloudnative deploy targets: %v", err)
+	}
+	if zoneBatch != nil {
+		if targets, err = batchTargets(nonCloudNativeCfg.Deploy, targets, zoneBatch); err != nil {
+			return err
+		}
+	}
+
+	var (
+		instances []renderInstance
+		filtered  int
+		deployed  = make(map[string]bool)
+	)
+	for _, target := range targets {
+		for _, unit := range target.Instance {
+			for i := uint64(0); i < unit.InstanceCount; i++ {
+				deployed[instanceKey(renderInstance{unit: unit, busAddr: target.BusAddr(unit, unit.StartInstanceId+i)})] = true
 			}
-			addrCom = append(addrCom, fmt.Sprint(Instance.TypeId))
-			addrCom = append(addrCom, fmt.Sprint(insID))
-			busAddr := strings.Join(addrCom, ".")
-
-			copyOptVals := make(map[string]any)
-			if val, ok := optVals[Instance.Name]; ok {
-				if vm, ok := val.(map[string]interface{}); ok {
-					for k, v := range vm {
-						copyVal, err := copystructure.Copy(v)
-						if err != nil {
-							return err
-						}
-						copyOptVals[k] = copyVal
-					}
+		}
+
+		if worldFilter != nil && *worldFilter != target.WorldID {
+			continue
+		}
+		if zoneFilter != nil && *zoneFilter != target.ZoneId {
+			continue
+		}
+
+		var dir string
+		if zoneBatch != nil {
+			dir = zoneDir(target)
+		}
+		for _, unit := range target.Instance {
+			for i := uint64(0); i < unit.InstanceCount; i++ {
+				inst := renderInstance{unit: unit, busAddr: target.BusAddr(unit, unit.StartInstanceId+i), zone: dir}
+				if !o.selected(inst) {
+					filtered++
+					continue
 				}
+				instances = append(instances, inst)
 			}
+		}
+	}
+	if len(instances) == 0 && filtered != 0 {
+		return fmt.Errorf("no instance matches the --only/--skip patterns")
+	}
 
-			if val, ok := optVals["global"]; ok {
-				if vm, ok := val.(map[string]interface{}); ok {
-					for k, v := range vm {
-						copyVal, err := copystructure.Copy(v)
-						if err != nil {
-							return err
-						}
-						copyOptVals[k] = copyVal
-					}
+	// only the local output is rendered incrementally
+	o.state = nil
+	if root := o.writer.LocalPath(); root != "" {
+		o.state = loadRenderState(root)
+	}
+	o.rendered = nil
+	if o.state == nil {
+		if err := o.renderInstances(out, instances, nonCloudNativeCfg, valuePaths, optVals); err != nil {
+			return err
+		}
+		if err := o.runChartHooks(out, instances, nonCloudNativeCfg, valuePaths, optVals); err != nil {
+			return err
+		}
+		if len(o.showOnly) != 0 && o.stdout.files == 0 && len(instances) != 0 {
+			return fmt.Errorf("no template matches the --show-only patterns")
+		}
+		if o.pack == nil {
+			return nil
+		}
+
+		version := o.packVersion
+		if version == "" {
+			version = o.renderTime.UTC().Format("20060102150405")
+		}
+		files, err := o.pack.write(o.packPath, version, o.renderTime)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "pack %d files into %s\n", files, o.packPath)
+		return nil
+	}
+
+	err = o.renderInstances(out, instances, nonCloudNativeCfg, valuePaths, optVals)
+	if err == nil {
+		err = o.runChartHooks(out, instances, nonCloudNativeCfg, valuePaths, optVals)
+	}
+	if err == nil {
+		err = o.state.prune(deployed)
+	}
+	// the rendered instances are recorded even if some instances fail
+	if saveErr := o.state.save(); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, o.state.summary())
+	return nil
+}
+
+// renderInstance is an instance of a deploy unit to be rendered.
+type renderInstance struct {
+	unit    *noncloudnative.DeployUnit
+	busAddr string
+	// zone is the directory of the zone in the output, it is empty unless the
+	// zones are rendered in a batch
+	zone string
+}
+
+// selected reports whether the instance is selected by the --only and --skip
+// patterns, which match the chart name or the bus address.
+func (o *templateOptions) selected(inst renderInstance) bool {
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			for _, name := range []string{inst.unit.Name, inst.busAddr} {
+				if ok, _ := path.Match(pattern, name); ok {
+					return true
 				}
 			}
+		}
+		return false
+	}
 
-			copyOptVals["type_id"] = Instance.TypeId
+	if len(o.only) != 0 && !match(o.only) {
+		return false
+	}
+	return !match(o.skip)
+}
 
-			nonCloudNativeOpt := &noncloudnative.RenderValue{
-				BusAddr: busAddr,
-				Config:  nonCloudNativeCfg,
+// renderInstances renders the instances by the pool of o.parallel workers. No
+// more instances are started after the first error, which is returned after the
+// running ones are finished.
+func (o *templateOptions) renderInstances(out io.Writer, instances []renderInstance, nonCloudNativeCfg *noncloudnative.Config,
+	valuePaths []string, optVals map[string]any) error {
+	parallel := min(max(o.parallel, 1), len(instances))
+	if parallel <= 1 {
+		for _, inst := range instances {
+			if err := o.renderInstance(out, inst, nonCloudNativeCfg, valuePaths, optVals); err != nil {
+				return err
 			}
+		}
+		return nil
+	}
 
-			vals, err := util.MergeChartValues(filepath.Join(o.chartPath, Instance.Name), valuePaths, copyOptVals, nonCloudNativeOpt)
-			if err != nil {
-				return err
+	// the outputs of the instances and their hooks are written concurrently
+	out = &syncWriter{w: out}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	jobs := make(chan renderInstance)
+	failed := make(chan struct{})
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for inst := range jobs {
+				if err := o.renderInstance(out, inst, nonCloudNativeCfg, valuePaths, optVals); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
 			}
+		}()
+	}
 
-			if err := renderTemplate(filepath.Join(o.chartPath, Instance.Name), vals, filepath.Join(o.outPath, Instance.Name)); err != nil {
-				return err
+dispatch:
+	for _, inst := range instances {
+		select {
+		case <-failed:
+			break dispatch
+		default:
+		}
+		select {
+		case jobs <- inst:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+// renderInstance renders an instance and runs its hooks.
+func (o *templateOptions) renderInstance(out io.Writer, inst renderInstance, nonCloudNativeCfg *noncloudnative.Config,
+	valuePaths []string, optVals map[string]any) error {
+	chartPath := filepath.Join(o.chartPath, inst.unit.Name)
+	r, err := o.renderer(chartPath, nonCloudNativeCfg)
+	if err != nil {
+		return err
+	}
+
+	copyOptVals, err := instanceOptValues(optVals, inst.unit)
+	if err != nil {
+		return err
+	}
+
+	nonCloudNativeOpt := &noncloudnative.RenderValue{
+		BusAddr: inst.busAddr,
+		Config:  nonCloudNativeCfg,
+	}
+
+	vals, err := util.MergeLoadedChartValues(r.chrt, valuePaths, o.valOpts.MergeOptions(), copyOptVals, nonCloudNativeOpt)
+	if err != nil {
+		return err
+	}
+
+	w := o.writer
+	var (
+		key, digest string
+		last        *instanceState
+		rec         *recordingWriter
+	)
+	if o.state != nil {
+		key = instanceKey(inst)
+		if digest, err = o.instanceDigest(r, vals); err != nil {
+			return err
+		}
+		if !o.force && o.state.skip(key, digest) {
+			fmt.Fprintf(out, "skip('%s', '%s') configuration unchanged\n", inst.unit.Name, inst.busAddr)
+			if o.report != nil {
+				return o.reportUnchanged(r, inst, o.state.files(key))
 			}
-			fmt.Fprintf(out, "create('%s', '%s') configuration success\n", Instance.Name, busAddr)
+			return nil
 		}
+		last = o.state.forget(key)
+	}
+	var reported *reportWriter
+	if o.report != nil {
+		reported = &reportWriter{outputWriter: w}
+		w = reported
+	}
+	if o.state != nil || o.pack != nil {
+		rec = &recordingWriter{outputWriter: w}
+		w = rec
+	}
+	if inst.zone != "" {
+		w = &prefixWriter{outputWriter: w, dir: inst.zone}
+	}
+	if o.postRenderer != "" {
+		w = &postRendererWriter{
+			outputWriter: w,
+			command:      o.postRenderer,
+			timeout:      o.hookTimeout,
+			env:          []string{"ATDTOOL_INSTANCE_NAME=" + inst.unit.Name, "ATDTOOL_BUS_ADDR=" + inst.busAddr},
+		}
+	}
+
+	// the hooks are only run in the local output
+	var hookPath string
+	if local := o.writer.LocalPath(); local != "" {
+		hookPath = filepath.Join(local, filepath.FromSlash(inst.zone), inst.unit.Name)
+	}
+
+	hooks := &renderHooks{
+		chartPath: chartPath,
+		outPath:   hookPath,
+		name:      inst.unit.Name,
+		busAddr:   inst.busAddr,
+		vals:      vals,
+		commands: map[string]string{
+			hookPreRender:  o.preRenderHook,
+			hookPostRender: o.postRenderHook,
+		},
+		timeout: o.hookTimeout,
+		out:     out,
+	}
+
+	if o.runHooks() {
+		if err := hooks.run(hookPreRender); err != nil {
+			return err
+		}
+	}
+
+	if err := o.renderTemplate(r, vals, w, inst.unit.Name); err != nil {
+		return err
+	}
+
+	if o.runHooks() {
+		if err := hooks.run(hookPostRender); err != nil {
+			return err
+		}
+	}
+	if o.state != nil {
+		if err := o.state.update(key, digest, rec.names, last); err != nil {
+			return err
+		}
+	}
+	if o.pack != nil {
+		digest, err := valuesDigest(vals)
+		if err != nil {
+			return err
+		}
+		o.pack.addInstance(&packInstance{
+			Name:         inst.unit.Name,
+			BusAddr:      inst.busAddr,
+			Chart:        r.chrt.Name(),
+			ChartVersion: r.chrt.Metadata.Version,
+			ValuesDigest: digest,
+			Files:        rec.names,
+		})
+	}
+
+	if o.report != nil {
+		o.report.addInstance(&reportInstance{
+			Name:         inst.unit.Name,
+			BusAddr:      inst.busAddr,
+			Chart:        r.chrt.Name(),
+			ChartVersion: r.chrt.Metadata.Version,
+			Status:       reportRendered,
+			Files:        reported.files,
+		})
+	}
+
+	o.renderersMu.Lock()
+	if o.rendered == nil {
+		o.rendered = make(map[string]bool)
+	}
+	o.rendered[util.SlashJoin(inst.zone, inst.unit.Name)] = true
+	o.renderersMu.Unlock()
+
+	fmt.Fprintf(out, "create('%s', '%s') configuration success\n", inst.unit.Name, inst.busAddr)
+	countTelemetry("instances", 1)
+	return nil
+}
+
+// reportUnchanged records the instance skipped by the incremental render, the
+// files rendered last time are read from the output.
+func (o *templateOptions) reportUnchanged(r *chartRenderer, inst renderInstance, names []string) error {
+	files := make([]*packFile, 0, len(names))
+	for _, name := range names {
+		f, err := reportFileInfo(name, o.state.localFile(name))
+		if err != nil {
+			return fmt.Errorf("report unchanged configuration file(%s): %v", name, err)
+		}
+		files = append(files, f)
+	}
+	o.report.addInstance(&reportInstance{
+		Name:         inst.unit.Name,
+		BusAddr:      inst.busAddr,
+		Chart:        r.chrt.Name(),
+		ChartVersion: r.chrt.Metadata.Version,
+		Status:       reportUnchanged,
+		Files:        files,
+	})
+	return nil
+}
+
+// runChartHooks runs the post-render-all hooks of the charts which have any
+// instance rendered, the hooks are run for each zone if the zones are rendered
+// in a batch. The hooks are run with the values of the chart, which are merged
+// without the runtime values of the instances.
+func (o *templateOptions) runChartHooks(out io.Writer, instances []renderInstance, nonCloudNativeCfg *noncloudnative.Config,
+	valuePaths []string, optVals map[string]any) error {
+	if !o.runHooks() {
+		return nil
 	}
 
+	var keys []string
+	units := make(map[string]renderInstance)
+	busAddrs := make(map[string][]string)
+	for _, inst := range instances {
+		key := util.SlashJoin(inst.zone, inst.unit.Name)
+		if _, ok := units[key]; !ok {
+			keys = append(keys, key)
+			units[key] = inst
+		}
+		busAddrs[key] = append(busAddrs[key], inst.busAddr)
+	}
+
+	for _, key := range keys {
+		if !o.rendered[key] {
+			continue
+		}
+
+		inst := units[key]
+		name := inst.unit.Name
+		chartPath := filepath.Join(o.chartPath, name)
+		r, err := o.renderer(chartPath, nonCloudNativeCfg)
+		if err != nil {
+			return err
+		}
+		copyOptVals, err := instanceOptValues(optVals, inst.unit)
+		if err != nil {
+			return err
+		}
+		vals, err := util.MergeLoadedChartValues(r.chrt, valuePaths, o.valOpts.MergeOptions(), copyOptVals, nil)
+		if err != nil {
+			return err
+		}
+
+		var hookPath string
+		if local := o.writer.LocalPath(); local != "" {
+			hookPath = filepath.Join(local, filepath.FromSlash(key))
+		}
+		hooks := &renderHooks{
+			chartPath: chartPath,
+			outPath:   hookPath,
+			name:      name,
+			busAddrs:  busAddrs[key],
+			vals:      vals,
+			commands:  map[string]string{hookPostRenderAll: o.postRenderAllHook},
+			timeout:   o.hookTimeout,
+			out:       out,
+		}
+		if err := hooks.run(hookPostRenderAll); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func renderTemplate(chartPath string, vals map[string]any, outPath string) error {
-	var err error
-	var chrt *chart.Chart
+// runHooks reports whether the render hooks are run, they are not run when
+// the files are not written into the output.
+func (o *templateOptions) runHooks() bool {
+	return !o.skipHooks && o.stdout == nil
+}
+
+// deployTargetFilter applies --set global.world_id/zone_id, which overrides the
+// world and zone of a single world deploy.yaml, and selects the targets of a
+// multi-world one. The filters are nil if they are not specified.
+func deployTargetFilter(optVals map[string]any, nonCloudNativeCfg *noncloudnative.Config) (*uint64, *uint64, error) {
+	var worldFilter, zoneFilter *uint64
+	multiWorld := len(nonCloudNativeCfg.Deploy.Worlds) != 0
 
-	chrt, err = loader.Load(chartPath)
+	var optGlobalVals map[string]any
+	var ok bool = false
+	optGlobalVals, ok = optVals["global"].(map[string]any)
+	if ok {
+		// 覆盖 WorldId 与 ZoneId
+		if w, ok := optGlobalVals["world_id"]; ok {
+			worldId, err := convertToUint64Opt("world_id", w)
+			if err != nil {
+				return nil, nil, err
+			}
+			if multiWorld {
+				worldFilter = &worldId
+			} else {
+				nonCloudNativeCfg.Deploy.WorldID = worldId
+			}
+			optGlobalVals["world_id"] = worldId
+		}
+		if z, ok := optGlobalVals["zone_id"]; ok {
+			zoneId, err := convertToUint64Opt("zone_id", z)
+			if err != nil {
+				return nil, nil, err
+			}
+			if multiWorld {
+				zoneFilter = &zoneId
+			} else {
+				nonCloudNativeCfg.Deploy.ZoneId = zoneId
+			}
+			optGlobalVals["zone_id"] = zoneId
+		}
+	}
+	return worldFilter, zoneFilter, nil
+}
+
+// instanceOptValues returns the command line values of an instance, which are
+// the copies of the values of its chart and the global values.
+func instanceOptValues(optVals map[string]any, unit *noncloudnative.DeployUnit) (map[string]any, error) {
+	copyOptVals := make(map[string]any)
+	for _, key := range []string{unit.Name, "global"} {
+		vm, ok := optVals[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range vm {
+			copyVal, err := copystructure.Copy(v)
+			if err != nil {
+				return nil, err
+			}
+			copyOptVals[k] = copyVal
+		}
+	}
+
+	copyOptVals["type_id"] = unit.TypeId
+	return copyOptVals, nil
+}
+
+// renderer returns the renderer of the chart, the chart is loaded and parsed
+// once, then it is shared by all instances of the chart.
+func (o *templateOptions) renderer(chartPath string, nonCloudNativeCfg *noncloudnative.Config) (*chartRenderer, error) {
+	o.renderersMu.Lock()
+	defer o.renderersMu.Unlock()
+
+	if r, ok := o.renderers[chartPath]; ok {
+		return r, nil
+	}
+	r, err := newChartRenderer(chartPath, nonCloudNativeCfg, o.exts)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	r.showOnly = o.showOnly
+	if o.renderers == nil {
+		o.renderers = make(map[string]*chartRenderer)
+	}
+	o.renderers[chartPath] = r
+	return r, nil
+}
 
-	var suffix string
-	if addr, ok := vals["bus_addr"]; ok {
-		suffix = fmt.Sprintf("_%s", addr)
+// renderTemplate renders the chart into outPath of the output by the layout.
+func (o *templateOptions) renderTemplate(r *chartRenderer, vals map[string]any, w outputWriter, outPath string) error {
+	if o.header {
+		header, err := newFileHeader(r.chrt, vals, o.renderTime, o.noHeader)
+		if err != nil {
+			return err
+		}
+		w = &headerWriter{outputWriter: w, header: header}
 	}
-	return render(chrt, vals, outPath, suffix)
+	// the files are validated before the headers are stamped
+	if o.validate {
+		w = &validateWriter{outputWriter: w, instance: fmt.Sprintf("('%s', '%v')", outPath, vals["bus_addr"])}
+	}
+
+	return o.layout.render(r, vals, w, outPath)
+}
+
+// syncWriter serializes the writes of the concurrent instances.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
 }
 
 func convertToUint64Opt(name string, input any) (uint64, error) {
@@ -232,87 +941,74 @@ func convertToUint64Opt(name string, input any) (uint64, error) {
 	return 0, fmt.Errorf("wrong type %s: %s can not convert to uint64", name, reflect.TypeOf(input).Name())
 }
 
-func allConfigTemplates(chrt *chart.Chart) {
+// allConfigTemplates replaces the templates of the chart with the files which
+// have the template extensions.
+func allConfigTemplates(chrt *chart.Chart, exts templateExts) {
 	chrt.Templates = chrt.Templates[:0]
 	for _, f := range chrt.Files {
-		if strings.HasSuffix(f.Name, ".tpl") || strings.HasSuffix(f.Name, ".template") {
+		// hook templates are executed instead of being written to the output
+		if isHookFile(f) {
+			continue
+		}
+		if exts.match(f.Name) {
 			chrt.Templates = append(chrt.Templates, f)
 		}
 	}
 }
 
-// render generate service configuration file in chart.
-func render(chrt *chart.Chart, vals chartutil.Values, outPath, outSuffix string) error {
-	if err := chartutil.ProcessDependencies(chrt, vals); err != nil {
-		return err
-	}
-
-	top := make(map[string]interface{})
-	top["Values"] = vals
-	en := &engine.Engine{
-		LintMode: false,
-	}
-
-	allConfigTemplates(chrt)
-	output, err := en.Render(chrt, top)
+// render generate service configuration file in chart, the files are written
+// into outPath of the output.
+func render(chrt *chart.Chart, vals chartutil.Values, w outputWriter, outPath, outSuffix string, exts templateExts, showOnly []string) error {
+	output, err := helmRender(chrt, vals, exts)
 	if err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	var cfgOutPath string
 	for k, v := range output {
-		// no output path specified, use standard output
-		if outPath == "" {
+		// no output specified, use standard output
+		if w == nil {
 			fmt.Println("---")
 			fmt.Printf("# Source: %s\n", k)
 			fmt.Println(v)
 			continue
 		}
 
-		suffix := filepath.Ext(path.Base(k))
-		if suffix != ".tpl" {
+		// the partials and the templates not shown are not written
+		if strings.HasPrefix(path.Base(k), "_") || !showTemplate(showOnly, chrt.Name(), k) {
 			continue
 		}
 
-		relPath := strings.TrimPrefix(filepath.Dir(k), chrt.Name())
-		cfgOutPath = filepath.Join(outPath, relPath)
-		if !util.PathExist(cfgOutPath) {
-			if err := os.MkdirAll(cfgOutPath, os.ModePerm); err != nil {
-				return fmt.Errorf("make configuration output path(%s): %v", cfgOutPath, err)
-			}
-		}
-
-		filename := strings.TrimSuffix(path.Base(k), suffix)
-
-		if outSuffix != "" {
-			idx := strings.LastIndex(filename, ".")
-			if idx != -1 {
-				// 存在. 分割
-				left := filename[:idx]
-				right := filename[idx:]
-				filename = left + outSuffix + right
-			} else {
-				// 直接拼接
-				filename = filename + outSuffix
-			}
-		}
-
-		outFile := path.Join(cfgOutPath, filename)
-
-		f, err := os.Create(outFile)
+		outFile := path.Join(outputFilePath(chrt.Name(), k, outPath, outSuffix))
+		f, err := w.Create(outFile)
 		if err != nil {
 			return fmt.Errorf("create configuration file(%s): %v", outFile, err)
 		}
 
-		if _, err := f.WriteString(v); err != nil {
+		if _, err := io.WriteString(f, v); err != nil {
 			_ = f.Close()
 			return fmt.Errorf("write config file(%s): %v", outFile, err)
 		}
 
 		if err := f.Close(); err != nil {
-			return fmt.Errorf("close config file(%s): %v", outFile, err)
+			return fmt.Errorf("close config file(%s) of (%s): %v", outFile, k, err)
 		}
 	}
 	return nil
 }
+
+// helmRender renders the templates of the chart by the Helm engine.
+func helmRender(chrt *chart.Chart, vals chartutil.Values, exts templateExts) (map[string]string, error) {
+	if err := processDependencies(chrt, vals); err != nil {
+		return nil, err
+	}
+
+	top := make(map[string]interface{})
+	top["Values"] = vals
+	en := &engine.Engine{
+		LintMode: false,
+	}
+
+	allConfigTemplates(chrt, exts)
+	return en.Render(chrt, top)
+}
@@ -3,9 +3,12 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -159,7 +162,7 @@ func TestConvertToUint64Opt(t *testing.T) {
 	}
 }
 
-func TestTemplateOptionsRunRequiresOutputPath(t *testing.T) {
+func TestTemplateOptionsRunStdout(t *testing.T) {
 	o := &templateOptions{
 		chartPath: fixturePath("charts"),
 		valOpts: values.Options{
@@ -167,9 +170,44 @@ func TestTemplateOptionsRunRequiresOutputPath(t *testing.T) {
 		},
 	}
 
-	err := o.run(&bytes.Buffer{})
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "outPath not found")
+	stdout := &bytes.Buffer{}
+	if !assert.NoError(t, o.run(stdout)) {
+		return
+	}
+	// only the rendered files are printed
+	got := stdout.String()
+	assert.True(t, strings.HasPrefix(got, "---\n# Source: echo/"), got)
+	assert.Contains(t, got, "---\n# Source: echo/cfg/echo_1.2.42.3.yaml\n")
+	assert.Contains(t, got, "---\n# Source: echo/bin/start_1.2.42.3.sh\n")
+	assert.Contains(t, got, "bus_addr: 1.2.42.3")
+	assert.NotContains(t, got, "configuration success")
+}
+
+func TestTemplateOptionsRunShowOnly(t *testing.T) {
+	newOptions := func(showOnly ...string) *templateOptions {
+		return &templateOptions{
+			chartPath: fixturePath("charts"),
+			showOnly:  showOnly,
+			valOpts: values.Options{
+				Paths: []string{fixturePath("values", "default")},
+			},
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	if !assert.NoError(t, newOptions("cfg/*.yaml.tpl").run(stdout)) {
+		return
+	}
+	assert.Equal(t, 2, strings.Count(stdout.String(), "# Source: "), stdout.String())
+	assert.Contains(t, stdout.String(), "# Source: echo/cfg/echo_1.2.42.3.yaml\n")
+	assert.NotContains(t, stdout.String(), "start_")
+
+	assert.ErrorContains(t, newOptions("cfg/missing.tpl").run(&bytes.Buffer{}), "no template matches the --show-only patterns")
+	assert.ErrorContains(t, newOptions("[").run(&bytes.Buffer{}), "invalid show-only pattern")
+
+	o := newOptions("cfg/*.yaml.tpl")
+	o.outPath = t.TempDir()
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "--show-only can not be used with --output or --pack")
 }
 
 func TestTemplateOptionsRunGlobalOverridesInstanceSet(t *testing.T) {
@@ -227,3 +265,393 @@ func TestTemplateOptionsRunTypeIdFromDeploy(t *testing.T) {
 	// type_id is unconditionally set to Instance.TypeId (42) after copying optVals.
 	assert.Contains(t, text, "type_id: 42")
 }
+
+func TestTemplateOptionsRunIteratesWorlds(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		wantBus []string
+	}{
+		{
+			name:    "all worlds",
+			wantBus: []string{"1.1.42.1", "1.3.42.1", "1.4.42.1", "2.5.42.10", "2.5.42.11"},
+		},
+		{
+			name:    "select world",
+			values:  []string{"global.world_id=2"},
+			wantBus: []string{"2.5.42.10", "2.5.42.11"},
+		},
+		{
+			name:    "select world and zone",
+			values:  []string{"global.world_id=1", "global.zone_id=3"},
+			wantBus: []string{"1.3.42.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := t.TempDir()
+			stdout := &bytes.Buffer{}
+			o := &templateOptions{
+				chartPath: fixturePath("charts"),
+				outPath:   outDir,
+				valOpts: values.Options{
+					Paths:  []string{fixturePath("values", "default"), fixturePath("values", "multiworld")},
+					Values: tt.values,
+				},
+			}
+
+			err := o.run(stdout)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var want string
+			for _, bus := range tt.wantBus {
+				want += fmt.Sprintf("create('echo', '%s') configuration success\n", bus)
+			}
+			want += fmt.Sprintf("%d files changed, 0 unchanged, 0 removed\n", 2*len(tt.wantBus))
+			assert.Equal(t, want, stdout.String())
+
+			data, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", fmt.Sprintf("echo_%s.yaml", tt.wantBus[0])))
+			if assert.NoError(t, err) {
+				assert.Contains(t, string(data), "bus_addr: "+tt.wantBus[0])
+			}
+		})
+	}
+}
+
+func TestTemplateOptionsRunResolvesFeatureFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   string
+	}{
+		{
+			name:   "plain flag",
+			values: []string{"global.flags.beta=true"},
+			want:   "flag_beta: true",
+		},
+		{
+			name:   "stage allowlist matched",
+			values: []string{"global.stage=dev", "global.flags.beta.stages={dev,test}"},
+			want:   "flag_beta: true",
+		},
+		{
+			name:   "stage allowlist not matched",
+			values: []string{"global.stage=prod", "global.flags.beta.stages={dev,test}"},
+			want:   "flag_beta: false",
+		},
+		{
+			name:   "world allowlist not matched",
+			values: []string{"global.flags.beta.worlds={3,4}"},
+			want:   "flag_beta: false",
+		},
+		{
+			name:   "instance scoped flag",
+			values: []string{"echo.flags.beta.worlds={1}"},
+			want:   "flag_beta: true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := t.TempDir()
+			o := &templateOptions{
+				chartPath: fixturePath("charts"),
+				outPath:   outDir,
+				valOpts: values.Options{
+					Paths:  []string{fixturePath("values", "default")},
+					Values: tt.values,
+				},
+			}
+
+			err := o.run(&bytes.Buffer{})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			data, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Contains(t, string(data), tt.want)
+		})
+	}
+}
+
+func TestTemplateOptionsRunExecutesRenderHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts in this test are POSIX shell scripts")
+	}
+
+	chartPath := filepath.Join(t.TempDir(), "charts")
+	if err := os.CopyFS(chartPath, os.DirFS(fixturePath("charts"))); err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(chartPath, "echo", "hooks")
+	if err := os.MkdirAll(hookPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// the post-render hook derives a file from the rendered output
+	hook := `cksum cfg/echo_{{ .Values.bus_addr }}.yaml > cfg/echo_{{ .Values.bus_addr }}.cksum`
+	if err := os.WriteFile(filepath.Join(hookPath, "post-render.tpl"), []byte(hook), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath:     chartPath,
+		outPath:       outDir,
+		preRenderHook: `echo "$ATDTOOL_INSTANCE_NAME $ATDTOOL_BUS_ADDR" >> pre-render.log && grep -q "bus_addr: $ATDTOOL_BUS_ADDR" "$ATDTOOL_VALUES_FILE"`,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+
+	err := o.run(&bytes.Buffer{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "echo", "pre-render.log"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "echo 1.2.42.3\necho 1.2.42.4\n", string(data))
+
+	assert.FileExists(t, filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.cksum"))
+	assert.FileExists(t, filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.4.cksum"))
+	// hook templates are not rendered as output files
+	assert.NoDirExists(t, filepath.Join(outDir, "echo", "hooks"))
+}
+
+func TestTemplateOptionsRunFailsOnHookError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test are POSIX shell commands")
+	}
+
+	o := &templateOptions{
+		chartPath:     fixturePath("charts"),
+		outPath:       t.TempDir(),
+		preRenderHook: "exit 3",
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+
+	err := o.run(&bytes.Buffer{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "run pre-render hook of ('echo', '1.2.42.3')")
+	}
+}
+
+func TestTemplateOptionsRunWithValuesFile(t *testing.T) {
+	outDir := t.TempDir()
+	valuesFile := filepath.Join(t.TempDir(), "override.yaml")
+	if err := os.WriteFile(valuesFile, []byte("global:\n  zone_id: 5\necho:\n  shared: from-file\n  service_only: from-file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		valOpts: values.Options{
+			Paths:      []string{fixturePath("values", "default")},
+			ValueFiles: []string{valuesFile},
+			Values:     []string{"echo.service_only=from-set"},
+		},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", "echo_1.5.42.3.yaml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(data), "zone_id: 5")
+	assert.Contains(t, string(data), "shared: from-file")
+	assert.Contains(t, string(data), "service_only: from-set")
+}
+
+func TestTemplateOptionsRunParallel(t *testing.T) {
+	render := func(parallel int, hook string) (map[string]string, []string, error) {
+		outDir := t.TempDir()
+		stdout := &bytes.Buffer{}
+		o := &templateOptions{
+			chartPath:     fixturePath("charts"),
+			outPath:       outDir,
+			parallel:      parallel,
+			preRenderHook: hook,
+			valOpts: values.Options{
+				Paths: []string{fixturePath("values", "default"), fixturePath("values", "multiworld")},
+			},
+		}
+		if err := o.run(stdout); err != nil {
+			return nil, nil, err
+		}
+
+		files := make(map[string]string)
+		err := filepath.WalkDir(outDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			files[strings.TrimPrefix(p, outDir)] = string(data)
+			return err
+		})
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		sort.Strings(lines)
+		return files, lines, err
+	}
+
+	serialFiles, serialLines, err := render(1, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	parallelFiles, parallelLines, err := render(4, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, parallelLines, 6)
+	assert.Equal(t, serialLines, parallelLines)
+	assert.Equal(t, serialFiles, parallelFiles)
+
+	if runtime.GOOS != "windows" {
+		_, _, err = render(4, "exit 3")
+		assert.Error(t, err)
+	}
+}
+
+func TestTemplateOptionsRunFiltersInstances(t *testing.T) {
+	tests := []struct {
+		name    string
+		only    []string
+		skip    []string
+		wantBus []string
+		wantErr bool
+	}{
+		{name: "chart name", only: []string{"echo"}, wantBus: []string{"1.1.42.1", "1.3.42.1", "1.4.42.1", "2.5.42.10", "2.5.42.11"}},
+		{name: "bus address glob", only: []string{"1.*.*.*"}, wantBus: []string{"1.1.42.1", "1.3.42.1", "1.4.42.1"}},
+		{name: "bus address", only: []string{"2.5.42.11", "1.1.42.1"}, wantBus: []string{"1.1.42.1", "2.5.42.11"}},
+		{name: "skip", skip: []string{"1.*.*.*", "2.5.42.10"}, wantBus: []string{"2.5.42.11"}},
+		{name: "only and skip", only: []string{"2.*.*.*"}, skip: []string{"*.*.*.10"}, wantBus: []string{"2.5.42.11"}},
+		{name: "nothing matched", only: []string{"gamesvr"}, wantErr: true},
+		{name: "invalid pattern", skip: []string{"[1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			o := &templateOptions{
+				chartPath: fixturePath("charts"),
+				outPath:   t.TempDir(),
+				only:      tt.only,
+				skip:      tt.skip,
+				valOpts: values.Options{
+					Paths: []string{fixturePath("values", "default"), fixturePath("values", "multiworld")},
+				},
+			}
+
+			err := o.run(stdout)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var want string
+			for _, bus := range tt.wantBus {
+				want += fmt.Sprintf("create('echo', '%s') configuration success\n", bus)
+			}
+			want += fmt.Sprintf("%d files changed, 0 unchanged, 0 removed\n", 2*len(tt.wantBus))
+			assert.Equal(t, want, stdout.String())
+		})
+	}
+}
+
+func TestTemplateOptionsRunPostRenderer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post renderer in this test is a POSIX shell command")
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath:    fixturePath("charts"),
+		outPath:      outDir,
+		postRenderer: `tr a-z A-Z; echo "# $ATDTOOL_FILE $ATDTOOL_BUS_ADDR"`,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "BUS_ADDR: 1.2.42.3")
+		assert.Contains(t, string(data), "# echo/cfg/echo_1.2.42.3.yaml 1.2.42.3\n")
+	}
+
+	o.postRenderer = "echo failed >&2; exit 1"
+	o.force = true
+	err = o.run(&bytes.Buffer{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "run post renderer for file(echo/")
+		assert.Contains(t, err.Error(), "failed")
+	}
+}
+
+func TestTemplateOptionsRunExecutesChartHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts in this test are POSIX shell scripts")
+	}
+
+	chartPath := filepath.Join(t.TempDir(), "charts")
+	if err := os.CopyFS(chartPath, os.DirFS(fixturePath("charts"))); err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(chartPath, "echo", "hooks")
+	if err := os.MkdirAll(hookPath, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// the post-render-all hook sees all instances rendered
+	hook := `ls cfg > all.log && echo "{{ .Values.type_id }} $ATDTOOL_BUS_ADDRS" >> all.log`
+	if err := os.WriteFile(filepath.Join(hookPath, "post-render-all.tpl"), []byte(hook), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath:         chartPath,
+		outPath:           outDir,
+		parallel:          2,
+		postRenderAllHook: `echo "$ATDTOOL_HOOK $ATDTOOL_INSTANCE_NAME" >> all.log`,
+		valOpts: values.Options{
+			Paths: []string{fixturePath("values", "default")},
+		},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "echo", "all.log"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "echo_1.2.42.3.yaml\necho_1.2.42.4.yaml\n42 1.2.42.3,1.2.42.4\npost-render-all echo\n", string(data))
+	}
+
+	// the hooks are not run if no instance is rendered
+	assert.NoError(t, os.Remove(filepath.Join(outDir, "echo", "all.log")))
+	assert.NoError(t, o.run(&bytes.Buffer{}))
+	assert.NoFileExists(t, filepath.Join(outDir, "echo", "all.log"))
+
+	o.postRenderAllHook = "exit 3"
+	o.force = true
+	err = o.run(&bytes.Buffer{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "run post-render-all hook of echo")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+// watchRender renders the chart, then renders it again after the chart or the
+// values are changed until ctx is done. The changes within the debounce are
+// rendered once, and the failed renders are printed without stopping watching.
+func (o *templateOptions) watchRender(ctx context.Context, out io.Writer) error {
+	if o.outPath == "" || o.packPath != "" {
+		return fmt.Errorf("--watch requires --output without --pack")
+	}
+	for _, name := range o.valOpts.ValueFiles {
+		if name == "-" {
+			return fmt.Errorf("--watch can not read the values file from stdin")
+		}
+	}
+	if o.watchDebounce <= 0 {
+		o.watchDebounce = 500 * time.Millisecond
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("new watcher %v", err)
+	}
+	defer watcher.Close()
+
+	targets := []string{o.chartPath}
+	for _, p := range append(append([]string{}, o.valOpts.Paths...), o.valOpts.ValueFiles...) {
+		if !values.IsRemote(p) {
+			targets = append(targets, p)
+		}
+	}
+	w := &templateWatcher{watcher: watcher, dirs: make(map[string]bool), files: make(map[string]bool)}
+	if root, err := filepath.Abs(o.outPath); err == nil {
+		w.output = filepath.Clean(root)
+	}
+	for _, p := range targets {
+		if err := w.add(p); err != nil {
+			return fmt.Errorf("add watch target %v", err)
+		}
+	}
+
+	o.renderWatched(out, "")
+
+	var (
+		timer   *time.Timer
+		fire    <-chan time.Time
+		changed string
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !w.relevant(event) {
+				continue
+			}
+			// the new directories are watched as well
+			if event.Has(fsnotify.Create) {
+				if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+					_ = w.addDir(event.Name)
+				}
+			}
+
+			if changed == "" {
+				changed = event.Name
+			}
+			if timer == nil {
+				timer = time.NewTimer(o.watchDebounce)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(o.watchDebounce)
+			}
+			fire = timer.C
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(out, "watch error: %v\n", err)
+		case <-fire:
+			fire = nil
+			o.renderWatched(out, changed)
+			changed = ""
+		}
+	}
+}
+
+// renderWatched renders the chart after the file is changed, the charts are
+// loaded again since the templates may be changed.
+func (o *templateOptions) renderWatched(out io.Writer, changed string) {
+	if changed != "" {
+		fmt.Fprintf(out, "%s changed, render again\n", changed)
+	}
+	o.renderers = nil
+	if err := o.run(out); err != nil {
+		fmt.Fprintf(out, "Error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "render finished at %s, watching for changes\n", time.Now().Format(time.TimeOnly))
+}
+
+// templateWatcher watches the directories of the chart and the values
+// recursively, the values files are watched by their directories, so that the
+// files replaced by the editors are still watched.
+type templateWatcher struct {
+	watcher *fsnotify.Watcher
+	// dirs are the directories of the chart and the values
+	dirs map[string]bool
+	// files are the watched values files, the other files in their
+	// directories are ignored
+	files map[string]bool
+	// output is the rendered output, its changes are ignored
+	output string
+}
+
+func (w *templateWatcher) add(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return w.addDir(p)
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	w.files[abs] = true
+	return w.watcher.Add(filepath.Dir(abs))
+}
+
+func (w *templateWatcher) addDir(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		if w.inOutput(abs) {
+			return filepath.SkipDir
+		}
+		w.dirs[abs] = true
+		return w.watcher.Add(p)
+	})
+}
+
+// relevant reports whether the event changes the inputs of the render. The
+// changes of the output, the temporary files of the editors and the chmod
+// only events are ignored.
+func (w *templateWatcher) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	abs, err := filepath.Abs(event.Name)
+	if err != nil {
+		return false
+	}
+	if w.inOutput(abs) {
+		return false
+	}
+
+	base := filepath.Base(abs)
+	if strings.HasSuffix(base, "~") || strings.HasPrefix(base, ".#") ||
+		strings.HasSuffix(base, ".swp") || strings.HasSuffix(base, ".swx") {
+		return false
+	}
+
+	// the other files in the directories of the values files are ignored
+	return w.dirs[filepath.Dir(abs)] || w.files[abs]
+}
+
+// inOutput reports whether the path is the output, or the staging and the
+// backup directories of --atomic beside it.
+func (w *templateWatcher) inOutput(p string) bool {
+	if w.output == "" {
+		return false
+	}
+	if p == w.output || strings.HasPrefix(p, w.output+string(filepath.Separator)) {
+		return true
+	}
+	rel, err := filepath.Rel(filepath.Dir(w.output), p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	first := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+	return strings.HasPrefix(first, "."+filepath.Base(w.output)+".")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestTemplateOptionsWatchRender(t *testing.T) {
+	chartsDir := t.TempDir()
+	if err := copyDir(fixturePath("charts"), chartsDir); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(t.TempDir(), "output")
+	o := &templateOptions{
+		chartPath:     chartsDir,
+		outPath:       outDir,
+		watchDebounce: 50 * time.Millisecond,
+		valOpts:       values.Options{Paths: []string{fixturePath("values", "default")}},
+	}
+
+	buf := &bytes.Buffer{}
+	out := &syncWriter{w: buf}
+	output := func() string {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		return buf.String()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- o.watchRender(ctx, out)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	rendered := filepath.Join(outDir, "echo", "cfg", "echo_1.2.42.3.yaml")
+	if !assert.Eventually(t, func() bool {
+		return strings.Contains(output(), "watching for changes")
+	}, 5*time.Second, 10*time.Millisecond) {
+		return
+	}
+	assert.FileExists(t, rendered)
+
+	tpl := filepath.Join(chartsDir, "echo", "cfg", "echo.yaml.tpl")
+	if err := os.WriteFile(tpl, []byte("watched: {{ .Values.bus_addr }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(rendered)
+		return string(data) == "watched: 1.2.42.3\n"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, output(), tpl+" changed, render again\n")
+
+	// the failed render does not stop watching
+	if err := os.WriteFile(tpl, []byte("watched: {{ .Values.bus_addr \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return strings.Contains(output(), "Error: ")
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTemplateWatcherRelevant(t *testing.T) {
+	dir := t.TempDir()
+	valuesFile := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(valuesFile, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chartDir := filepath.Join(dir, "charts")
+	if err := os.MkdirAll(filepath.Join(chartDir, "output"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	w := &templateWatcher{watcher: watcher, dirs: make(map[string]bool), files: make(map[string]bool), output: filepath.Join(chartDir, "output")}
+	for _, p := range []string{chartDir, valuesFile} {
+		if err := w.add(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.True(t, w.relevant(fsnotify.Event{Name: valuesFile, Op: fsnotify.Write}))
+	assert.True(t, w.relevant(fsnotify.Event{Name: filepath.Join(chartDir, "echo.yaml.tpl"), Op: fsnotify.Create}))
+	assert.False(t, w.relevant(fsnotify.Event{Name: valuesFile, Op: fsnotify.Chmod}))
+	// the other files beside the values file
+	assert.False(t, w.relevant(fsnotify.Event{Name: filepath.Join(dir, "other.yaml"), Op: fsnotify.Write}))
+	assert.False(t, w.relevant(fsnotify.Event{Name: filepath.Join(chartDir, ".echo.yaml.tpl.swp"), Op: fsnotify.Write}))
+	assert.False(t, w.relevant(fsnotify.Event{Name: filepath.Join(chartDir, "output", "echo", "a.yaml"), Op: fsnotify.Write}))
+	assert.False(t, w.relevant(fsnotify.Event{Name: filepath.Join(chartDir, ".output.tmp-123", "a.yaml"), Op: fsnotify.Create}))
+}
@@ -10,3 +10,6 @@ service_only: {{ .Values.service_only }}
 platform: {{ .Values.atdtool_running_platform }}
 extra_enabled: {{ .Values.extra.enabled }}
 extra_from_module: {{ .Values.extra.from_module }}
+{{- if .Values.flags }}
+flag_beta: {{ .Values.flags.beta }}
+{{- end }}
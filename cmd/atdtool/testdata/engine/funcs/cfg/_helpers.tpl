@@ -0,0 +1,8 @@
+{{- define "funcs.fullname" -}}
+{{ .Chart.Name }}-{{ .Values.bus_addr | default "none" }}
+{{- end -}}
+
+{{- define "funcs.labels" -}}
+name: {{ include "funcs.fullname" . }}
+version: {{ .Chart.Version | quote }}
+{{- end -}}
@@ -0,0 +1,54 @@
+# objects
+chart: {{ .Chart.Name }} {{ .Chart.Version }} {{ .Chart.AppVersion }} {{ .Chart.IsRoot }}
+template: {{ .Template.Name }} {{ .Template.BasePath }}
+release: {{ .Release }}
+capabilities: {{ .Capabilities }}
+subcharts: {{ toJson .Subcharts }}
+missing: {{ .Values.missing }} {{ .Values.tags.missing }}
+labels:
+{{ include "funcs.labels" . | indent 2 }}
+
+# files
+table: {{ .Files.Get "data/table.txt" | quote }}
+bytes: {{ .Files.GetBytes "data/table.txt" | len }}
+lines: {{ .Files.Lines "data/table.txt" | toJson }}
+none: {{ .Files.Lines "data/none.txt" | toJson }} {{ .Files.Get "data/none.txt" | quote }}
+empty: {{ .Files.Get "data/empty.txt" | quote }}
+glob: {{ range $path, $_ := .Files.Glob "data/conf/*.conf" }}{{ $path }} {{ end }}
+config:
+{{ (.Files.Glob "data/conf/*").AsConfig | indent 2 }}
+secrets:
+{{ (.Files.Glob "data/conf/*").AsSecrets | indent 2 }}
+
+# tpl
+tpl: {{ tpl .Values.nested.template . }}
+tpl_define: {{ tpl "{{ define \"funcs.inner\" }}inner {{ .name }}{{ end }}{{ include \"funcs.inner\" . }}" .Values }}
+tpl_missing: {{ tpl "{{ .missing }}" .Values }}
+
+# conversions
+yaml: {{ toYaml .Values.tags | nindent 2 }}
+json: {{ toJson .Values.list }}
+from_yaml: {{ fromYaml "a: 1\nb: [x, y]" | toJson }}
+from_yaml_error: {{ fromYaml "a: [" | toJson }}
+from_yaml_array: {{ fromYamlArray "[1, two]" | toJson }}
+from_json: {{ fromJson "{\"a\": 1}" | toJson }}
+from_json_error: {{ fromJson "{" | toJson }}
+from_json_array: {{ fromJsonArray "[1, \"two\"]" | toJson }}
+
+# sprig
+required: {{ required "name is required" .Values.name }}
+sorted: {{ sortAlpha .Values.list | join "," }}
+dict: {{ dict "b" 2 "a" 1 | toJson }}
+default: {{ .Values.missing | default "fallback" }} {{ .Values.port | default 1 }}
+ternary: {{ ternary "on" "off" .Values.enabled }}
+math: {{ add .Values.port 1 }} {{ mul .Values.ratio 4 }} {{ .Values.port | int64 | toString }}
+strings: {{ .Values.name | upper | repeat 2 | trunc 6 | b64enc }} {{ sha256sum .Values.name | trunc 8 }}
+regex: {{ regexReplaceAll "[0-9]+" "port 8080" "N" }}
+semver: {{ semverCompare ">=0.1.0" .Chart.Version }}
+{{- with .Values.tags }}
+{{- range $k, $v := . }}
+tag_{{ $k }}: {{ $v | quote }}
+{{- end }}
+{{- else }}
+no tags
+{{- end }}
@@ -0,0 +1,5 @@
+[{{ .Template.Name }}]
+name = {{ include "funcs.fullname" . }}
+{{- range $i, $v := .Values.list }}
+item{{ $i }} = {{ $v }}
+{{- end }}
@@ -0,0 +1,7 @@
+label: {{ include "common.label" . }}
+value: {{ include "base.value" . }}
+chart:
+{{ toYaml .Chart | indent 2 }}
+subcharts:
+{{ toYaml .Subcharts | indent 2 }}
+common: {{ .Subcharts.common.Values.prefix }} {{ .Subcharts.common.Chart.Name }} {{ .Subcharts.common.Chart.IsRoot }}
@@ -0,0 +1,3 @@
+{{- define "base.value" -}}
+base-{{ .Chart.Name }}
+{{- end -}}
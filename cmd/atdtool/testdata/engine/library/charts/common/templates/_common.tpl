@@ -0,0 +1,3 @@
+{{- define "common.label" -}}
+{{ .Values.common.prefix }}-{{ .Values.name }}
+{{- end -}}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "sigs.k8s.io/yaml/goyaml.v2"
+)
+
+// fileValidators parse the rendered files by their extensions, the files of
+// the other formats are not validated.
+var fileValidators = map[string]func(data []byte) error{
+	".xml":  validateXML,
+	".json": validateJSON,
+	".yaml": validateYAML,
+	".yml":  validateYAML,
+	".toml": validateTOML,
+}
+
+// validateWriter validates the syntax of the rendered files before they are
+// written, so that a broken file fails the command instead of the service
+// loading it.
+type validateWriter struct {
+	outputWriter
+	// instance is the instance rendering the files, e.g. ('echo', '1.2.3.4')
+	instance string
+}
+
+func (w *validateWriter) Create(name string) (io.WriteCloser, error) {
+	ext := strings.ToLower(path.Ext(name))
+	validate, ok := fileValidators[ext]
+	if !ok {
+		return w.outputWriter.Create(name)
+	}
+	return &validatedFile{w: w, name: name, format: strings.TrimPrefix(ext, "."), validate: validate}, nil
+}
+
+// validatedFile holds the rendered content until it is closed.
+type validatedFile struct {
+	bytes.Buffer
+	w        *validateWriter
+	name     string
+	format   string
+	validate func(data []byte) error
+}
+
+// Close validates the content and writes it into the file.
+func (f *validatedFile) Close() error {
+	if err := f.validate(f.Bytes()); err != nil {
+		return fmt.Errorf("invalid %s rendered by %s: %v", f.format, f.w.instance, err)
+	}
+
+	out, err := f.w.outputWriter.Create(f.name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteTo(out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// validateXML checks that the document is well-formed with a single root element.
+func validateXML(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// the encodings other than UTF-8 are declared by some configurations
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	depth, roots := 0, 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if roots++; roots > 1 {
+					line, _ := d.InputPos()
+					return fmt.Errorf("line %d: multiple root elements, the second is <%s>", line, tok.Name.Local)
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(tok)) != 0 {
+				line, _ := d.InputPos()
+				return fmt.Errorf("line %d: text outside of the root element", line)
+			}
+		}
+	}
+	if roots == 0 {
+		return errors.New("no root element")
+	}
+	return nil
+}
+
+// validateJSON checks the syntax of the JSON document.
+func validateJSON(data []byte) error {
+	var v any
+	err := json.Unmarshal(data, &v)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(data[:min(int(syntaxErr.Offset), len(data))], []byte("\n"))
+		return fmt.Errorf("line %d: %v", line, err)
+	}
+	return err
+}
+
+// validateYAML checks the syntax of all the YAML documents, the duplicate keys
+// are rejected.
+func validateYAML(data []byte) error {
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.SetStrict(true)
+	for {
+		var v any
+		if err := d.Decode(&v); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// validateTOML checks the syntax of the TOML document.
+func validateTOML(data []byte) error {
+	var v map[string]any
+	_, err := toml.Decode(string(data), &v)
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+func TestFileValidators(t *testing.T) {
+	for _, tc := range []struct {
+		ext  string
+		data string
+		err  string
+	}{
+		{".xml", "<?xml version=\"1.0\" encoding=\"GBK\"?>\n<server><port>7001</port></server>\n", ""},
+		{".xml", "<server>\n<port>7001</server>\n", "line 2"},
+		{".xml", "<a/>\n<b/>\n", "multiple root elements"},
+		{".xml", "<!-- empty -->\n", "no root element"},
+		{".json", "{\"port\": 7001}", ""},
+		{".json", "{\n\"port\": 7001,\n}", "line 3"},
+		{".yaml", "a: 1\n---\nb: 2\n", ""},
+		{".yaml", "", ""},
+		{".yaml", "a: 1\na: 2\n", "already set"},
+		{".yml", "a: [1\n", "line"},
+		{".toml", "[server]\nport = 7001\n", ""},
+		{".toml", "[server]\nport = 7001\nport = 7002\n", "line 3"},
+	} {
+		err := fileValidators[tc.ext]([]byte(tc.data))
+		if tc.err == "" {
+			assert.NoError(t, err, "%s: %s", tc.ext, tc.data)
+		} else {
+			assert.ErrorContains(t, err, tc.err, "%s: %s", tc.ext, tc.data)
+		}
+	}
+}
+
+func TestTemplateOptionsRunValidate(t *testing.T) {
+	chartsDir := t.TempDir()
+	if err := copyDir(fixturePath("charts"), chartsDir); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(chartsDir, "echo", "cfg", "server.xml.tpl")
+	if err := os.WriteFile(broken, []byte("<server><port>{{ .Values.bus_addr }}</server>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath: chartsDir,
+		outPath:   outDir,
+		valOpts:   values.Options{Paths: []string{fixturePath("values", "default")}},
+	}
+	// the broken file is written without validation
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+	assert.FileExists(t, filepath.Join(outDir, "echo", "cfg", "server_1.2.42.3.xml"))
+
+	outDir = t.TempDir()
+	o.outPath = outDir
+	o.validate = true
+	err := o.run(&bytes.Buffer{})
+	assert.ErrorContains(t, err, "echo/cfg/server.xml.tpl")
+	assert.ErrorContains(t, err, "invalid xml rendered by ('echo', '1.2.42.3')")
+	assert.NoFileExists(t, filepath.Join(outDir, "echo", "cfg", "server_1.2.42.3.xml"))
+
+	// the valid files are written as they are
+	if err := os.WriteFile(broken, []byte("<server><port>{{ .Values.bus_addr }}</port></server>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o.header = true
+	o.renderers = nil
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, "echo", "cfg", "server_1.2.42.3.xml"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "<!-- Code generated by atdtool")
+		assert.Contains(t, string(data), "<server><port>1.2.42.3</port></server>\n")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"syscall"
 	"time"
 
@@ -47,7 +48,9 @@ type watchConfigMapOptions struct {
 	runCmdArgs       []string
 	workDir          string
 	enableUserSignal bool
+	triggerFile      string
 	timeout          time.Duration
+	dryRun           bool
 }
 
 func newWatchConfigMapCmd(out io.Writer) *cobra.Command {
@@ -77,12 +80,22 @@ func newWatchConfigMapCmd(out io.Writer) *cobra.Command {
 	f.StringVar(&o.runCmd, "command", "", "run custom command when configuration changes")
 	f.StringVarP(&o.workDir, "workdir", "r", "", "specify run command root path")
 	f.BoolVar(&o.enableUserSignal, "signal-notify", false, "use user signal to trigger command execution")
+	f.StringVar(&o.triggerFile, "trigger-file", "", "trigger command execution when the file is created or touched, used instead of user signal on windows")
 	f.StringSliceVar(&o.runCmdArgs, "args", nil, "arguments used by run command, multiple args separated by comma")
 	f.DurationVar(&o.timeout, "timeout", 5*time.Minute, "time to wait for command execution")
+	f.BoolVar(&o.dryRun, "dry-run", false, "print the watched paths and the resolved command as JSON without watching")
 	return cmd
 }
 
-func (o *watchConfigMapOptions) run(_ io.Writer) error {
+func (o *watchConfigMapOptions) run(out io.Writer) error {
+	if o.dryRun {
+		return o.printDryRun(out)
+	}
+
+	if o.enableUserSignal && runtime.GOOS == "windows" {
+		return fmt.Errorf("user signal is not supported on windows, use --trigger-file instead")
+	}
+
 	signalChan := make(chan os.Signal, 1)
 	SetupSignalReload(signalChan)
 
@@ -99,6 +112,16 @@ func (o *watchConfigMapOptions) run(_ io.Writer) error {
 		}
 	}
 
+	// the directory is watched, so that the trigger file could be created later
+	if o.triggerFile != "" {
+		if o.triggerFile, err = filepath.Abs(o.triggerFile); err != nil {
+			return fmt.Errorf("resolve trigger file %v", err)
+		}
+		if err := watcher.Add(filepath.Dir(o.triggerFile)); err != nil {
+			return fmt.Errorf("add watch trigger file %v", err)
+		}
+	}
+
 	// Start listening for events.
 	go func() {
 		for {
@@ -108,6 +131,14 @@ func (o *watchConfigMapOptions) run(_ io.Writer) error {
 					return
 				}
 
+				if o.isTriggerEvent(event) {
+					log.Printf("[INFO] triggered by %v", event)
+					if err := o.runCustomCmd(); err != nil {
+						log.Printf("[ERROR] handle trigger: %v", err)
+					}
+					continue
+				}
+
 				if !isValidConfigMapEvent(event) {
 					continue
 				}
@@ -137,6 +168,37 @@ func (o *watchConfigMapOptions) run(_ io.Writer) error {
 	return nil
 }
 
+func (o *watchConfigMapOptions) printDryRun(out io.Writer) error {
+	result := &dryRunResult{
+		Watch: &watchPlan{SignalNotify: o.enableUserSignal},
+	}
+
+	if o.triggerFile != "" {
+		path, err := filepath.Abs(o.triggerFile)
+		if err != nil {
+			return fmt.Errorf("resolve trigger file %v", err)
+		}
+		result.Watch.TriggerFile = path
+	}
+
+	for _, v := range o.configPaths {
+		path, err := filepath.Abs(v)
+		if err != nil {
+			return fmt.Errorf("resolve watch target %v", err)
+		}
+		result.Watch.Paths = append(result.Watch.Paths, path)
+	}
+
+	if o.runCmd != "" {
+		plan, err := newCommandPlan(o.runCmd, o.runCmdArgs, o.workDir, o.timeout)
+		if err != nil {
+			return err
+		}
+		result.Command = plan
+	}
+	return printDryRun(out, result)
+}
+
 func (o *watchConfigMapOptions) handleSignal(signal os.Signal) error {
 	log.Printf("[INFO] received %v", signal)
 	return o.runCustomCmd()
@@ -174,6 +236,14 @@ func (o *watchConfigMapOptions) runCustomCmd() error {
 	return nil
 }
 
+// isTriggerEvent reports whether the trigger file is created, written or touched.
+func (o *watchConfigMapOptions) isTriggerEvent(event fsnotify.Event) bool {
+	if o.triggerFile == "" || filepath.Clean(event.Name) != o.triggerFile {
+		return false
+	}
+	return event.Has(fsnotify.Create) || event.Has(fsnotify.Write) || event.Has(fsnotify.Chmod)
+}
+
 func isValidConfigMapEvent(event fsnotify.Event) bool {
 	if event.Op&fsnotify.Create != fsnotify.Create {
 		return false
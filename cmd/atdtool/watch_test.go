@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTriggerEvent(t *testing.T) {
+	dir := t.TempDir()
+	trigger := filepath.Join(dir, "reload.trigger")
+
+	o := &watchConfigMapOptions{}
+	assert.False(t, o.isTriggerEvent(fsnotify.Event{Name: trigger, Op: fsnotify.Create}))
+
+	o.triggerFile = trigger
+	assert.True(t, o.isTriggerEvent(fsnotify.Event{Name: trigger, Op: fsnotify.Create}))
+	assert.True(t, o.isTriggerEvent(fsnotify.Event{Name: trigger, Op: fsnotify.Write}))
+	// touch the existing file
+	assert.True(t, o.isTriggerEvent(fsnotify.Event{Name: trigger, Op: fsnotify.Chmod}))
+	assert.False(t, o.isTriggerEvent(fsnotify.Event{Name: trigger, Op: fsnotify.Remove}))
+	assert.False(t, o.isTriggerEvent(fsnotify.Event{Name: filepath.Join(dir, "..data"), Op: fsnotify.Create}))
+}
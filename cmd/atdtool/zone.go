@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v3/cmd/helm/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+const zoneAddDesc = `
+Add a zone into the deploy.yaml of a values directory.
+
+The zone is appended to the zones of the world, the world is created if it
+does not exist. A deploy.yaml with the top level world_id and zone_id is
+converted into the worlds layout first. The instance count and start instance
+id of the charts could be overridden in the world by '--instance-count' and
+'--start-instance-id', which apply to every zone of the world.
+
+The entries of the new zone, e.g. the whitelist or hosts, could be appended to
+other files by '--append FILE=TEMPLATE'. The template is a Go template with the
+sprig functions, rendered with:
+
+    .WorldID      the world id
+    .ZoneID       the zone id
+    .Instances    the instances of the zone, each has .Name, .TypeId, .InstanceID and .BusAddr
+
+All changes are validated before any file is written: the deploy targets are
+reloaded, the bus addresses must be unique and the appended yaml files must
+still be valid. The comments of deploy.yaml are not kept.
+`
+
+// zoneInstance is an instance of the new zone passed to the append templates.
+type zoneInstance struct {
+	Name       string
+	TypeId     string
+	InstanceID uint64
+	BusAddr    string
+}
+
+type zoneAddOptions struct {
+	valuesPath      string
+	worldID         uint64
+	zoneID          uint64
+	instanceCounts  []string
+	startInstanceID []string
+	appends         []string
+}
+
+func newZoneCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "zone",
+		Short: "Manage the zones of the deploy configuration",
+		Args:  require.NoArgs,
+	}
+	cmd.AddCommand(newZoneAddCmd(out))
+	return cmd
+}
+
+func newZoneAddCmd(out io.Writer) *cobra.Command {
+	o := &zoneAddOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "add [DIR]",
+		Short: "Add a zone into the deploy configuration",
+		Long:  zoneAddDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.valuesPath = args[0]
+			return o.run(out)
+		},
+	}
+
+	if out != nil {
+		cmd.SetOut(out)
+	}
+
+	f := cmd.Flags()
+	f.Uint64Var(&o.worldID, "world", 0, "the world id of the zone")
+	f.Uint64Var(&o.zoneID, "zone", 0, "the zone id to add")
+	f.StringArrayVar(&o.instanceCounts, "instance-count", nil, "override the instance count of a chart in the world, e.g. gamesvr=4")
+	f.StringArrayVar(&o.startInstanceID, "start-instance-id", nil, "override the start instance id of a chart in the world, e.g. gamesvr=1")
+	f.StringArrayVar(&o.appends, "append", nil, "append the entries rendered by the template to the file, e.g. whitelist.yaml=whitelist.tpl")
+	_ = cmd.MarkFlagRequired("world")
+	_ = cmd.MarkFlagRequired("zone")
+	return cmd
+}
+
+func (o *zoneAddOptions) run(out io.Writer) error {
+	deployPath, err := findDeployFile(o.valuesPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(deployPath)
+	if err != nil {
+		return err
+	}
+
+	conf := make(map[string]any)
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("load %s: %v", deployPath, err)
+	}
+	if err := o.addZone(conf); err != nil {
+		return err
+	}
+
+	newData, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	instances, err := o.validateDeploy(newData)
+	if err != nil {
+		return fmt.Errorf("validate %s: %v", deployPath, err)
+	}
+
+	appended := make(map[string][]byte, len(o.appends))
+	var files []string
+	for _, v := range o.appends {
+		file, tpl, ok := strings.Cut(v, "=")
+		if !ok || file == "" || tpl == "" {
+			return fmt.Errorf("invalid append: %q, should be FILE=TEMPLATE", v)
+		}
+		if _, ok := appended[file]; !ok {
+			files = append(files, file)
+		}
+
+		content, err := o.renderEntries(tpl, instances)
+		if err != nil {
+			return err
+		}
+		if appended[file], err = appendEntries(file, appended[file], content); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(deployPath, newData, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "update %s\n", deployPath)
+
+	for _, file := range files {
+		if err := os.WriteFile(file, appended[file], 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "append %s\n", file)
+	}
+
+	for _, ins := range instances {
+		fmt.Fprintf(out, "%s %s\n", ins.BusAddr, ins.Name)
+	}
+
+	// the values directory must be accepted by template
+	cfg, err := noncloudnative.LoadConfig([]string{o.valuesPath})
+	if err != nil {
+		return fmt.Errorf("load updated configuration: %v", err)
+	}
+	if _, err := cfg.Deploy.Targets(); err != nil {
+		return fmt.Errorf("load updated deploy targets: %v", err)
+	}
+	return nil
+}
+
+// findDeployFile returns the deploy.yaml which is loaded by template, that is
+// the last one found in the values directory.
+func findDeployFile(dir string) (string, error) {
+	var found string
+	err := filepath.Walk(dir, func(filename string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && fi.Name() == "deploy.yaml" {
+			found = filename
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("deploy.yaml not found in %s", dir)
+	}
+	return found, nil
+}
+
+// addZone adds the zone into the content of deploy.yaml.
+func (o *zoneAddOptions) addZone(conf map[string]any) error {
+	worlds, _ := conf["worlds"].([]any)
+	if len(worlds) == 0 {
+		worldID, ok1 := uintValue(conf["world_id"])
+		zoneID, ok2 := uintValue(conf["zone_id"])
+		if !ok1 || !ok2 {
+			return fmt.Errorf("world_id and zone_id or worlds is required in deploy.yaml")
+		}
+		worlds = []any{map[string]any{"world_id": worldID, "zones": []any{zoneID}}}
+		delete(conf, "world_id")
+		delete(conf, "zone_id")
+	}
+
+	var world map[string]any
+	for i, v := range worlds {
+		w, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("invalid world %d in deploy.yaml", i)
+		}
+		if id, ok := uintValue(w["world_id"]); ok && id == o.worldID {
+			world = w
+			break
+		}
+	}
+	if world == nil {
+		world = map[string]any{"world_id": o.worldID}
+		worlds = append(worlds, world)
+	}
+	conf["worlds"] = worlds
+
+	zones, _ := world["zones"].([]any)
+	for _, z := range zones {
+		var r noncloudnative.ZoneRange
+		if id, ok := uintValue(z); ok {
+			r.Start, r.End = id, id
+		} else if err := r.UnmarshalJSON([]byte(fmt.Sprint(z))); err != nil {
+			return fmt.Errorf("world %d: %v", o.worldID, err)
+		}
+		if r.Start <= o.zoneID && o.zoneID <= r.End {
+			return fmt.Errorf("zone %d already exists in world %d", o.zoneID, o.worldID)
+		}
+	}
+	world["zones"] = append(zones, o.zoneID)
+
+	for _, v := range o.instanceCounts {
+		if err := patchWorldUnit(world, "instance_count", v); err != nil {
+			return err
+		}
+	}
+	for _, v := range o.startInstanceID {
+		if err := patchWorldUnit(world, "start_instance_id", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchWorldUnit sets the field of a chart in the proc_desc of the world by
+// CHART=VALUE.
+func patchWorldUnit(world map[string]any, field, v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("invalid %s: %q, should be CHART=VALUE", field, v)
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s of chart %s: %q", field, name, value)
+	}
+
+	units, _ := world["proc_desc"].([]any)
+	for _, u := range units {
+		if unit, ok := u.(map[string]any); ok && unit["chart_name"] == name {
+			unit[field] = n
+			return nil
+		}
+	}
+	world["proc_desc"] = append(units, map[string]any{"chart_name": name, field: n})
+	return nil
+}
+
+// validateDeploy loads the targets of the new deploy.yaml, checks the bus
+// addresses are unique and returns the instances of the new zone.
+func (o *zoneAddOptions) validateDeploy(data []byte) ([]*zoneInstance, error) {
+	deploy := new(noncloudnative.DeployConf)
+	if err := yaml.Unmarshal(data, deploy); err != nil {
+		return nil, err
+	}
+	targets, err := deploy.Targets()
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*zoneInstance
+	owners := make(map[string]string)
+	for _, t := range targets {
+		for _, u := range t.Instance {
+			for i := uint64(0); i < u.InstanceCount; i++ {
+				ins := &zoneInstance{Name: u.Name, TypeId: u.TypeId, InstanceID: u.StartInstanceId + i}
+				ins.BusAddr = t.BusAddr(u, ins.InstanceID)
+
+				owner := fmt.Sprintf("%s of world %d zone %d", u.Name, t.WorldID, t.ZoneId)
+				if other, ok := owners[ins.BusAddr]; ok {
+					return nil, fmt.Errorf("bus address %s is used by both %s and %s", ins.BusAddr, other, owner)
+				}
+				owners[ins.BusAddr] = owner
+
+				if t.WorldID == o.worldID && t.ZoneId == o.zoneID {
+					instances = append(instances, ins)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(instances, func(i, j int) bool { return instances[i].BusAddr < instances[j].BusAddr })
+	return instances, nil
+}
+
+// renderEntries renders the append template of the new zone.
+func (o *zoneAddOptions) renderEntries(tplPath string, instances []*zoneInstance) ([]byte, error) {
+	data, err := os.ReadFile(tplPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := template.New(filepath.Base(tplPath)).Funcs(funcMap()).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, map[string]any{
+		"WorldID":   o.worldID,
+		"ZoneID":    o.zoneID,
+		"Instances": instances,
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendEntries appends the content to the file, the previous content is read
+// from the file when it is nil. The yaml file must be still valid.
+func appendEntries(file string, prev, content []byte) ([]byte, error) {
+	if prev == nil {
+		data, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		prev = data
+	}
+
+	if len(prev) != 0 && prev[len(prev)-1] != '\n' {
+		prev = append(prev, '\n')
+	}
+	data := append(prev, content...)
+
+	if ext := filepath.Ext(file); ext == ".yaml" || ext == ".yml" {
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("append to %s: %v", file, err)
+		}
+	}
+	return data, nil
+}
+
+func uintValue(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case uint64:
+		return n, true
+	case float64:
+		if n < 0 || n != float64(uint64(n)) {
+			return 0, false
+		}
+		return uint64(n), true
+	case string:
+		i, err := strconv.ParseUint(strings.TrimSpace(n), 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// zoneSelector selects the zones rendered in a batch, like "3", "1-50" or
+// "2:1-50" with the world id.
+type zoneSelector struct {
+	spec string
+	// world is nil when the selector matches the zones of any world
+	world *uint64
+	zones noncloudnative.ZoneRange
+}
+
+func (s *zoneSelector) match(worldID, zoneID uint64) bool {
+	return (s.world == nil || *s.world == worldID) && s.zones.Start <= zoneID && zoneID <= s.zones.End
+}
+
+// parseZoneSelectors parses the --zones flags and the entries of the
+// --zone-list file.
+func parseZoneSelectors(specs []string) ([]*zoneSelector, error) {
+	selectors := make([]*zoneSelector, 0, len(specs))
+	for _, spec := range specs {
+		s := &zoneSelector{spec: strings.TrimSpace(spec)}
+		zones := s.spec
+		if world, after, ok := strings.Cut(s.spec, ":"); ok {
+			worldID, err := strconv.ParseUint(strings.TrimSpace(world), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid world of zones %q", spec)
+			}
+			s.world, zones = &worldID, after
+		}
+		if err := s.zones.UnmarshalJSON([]byte(zones)); err != nil {
+			return nil, fmt.Errorf("invalid zones %q: %v", spec, err)
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors, nil
+}
+
+// readZoneList reads the zones of the --zone-list file, the entries are
+// separated by lines, spaces or commas, and the comments start with '#'.
+func readZoneList(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read zone list: %v", err)
+	}
+
+	var specs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		specs = append(specs, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no zone in zone list: %s", name)
+	}
+	return specs, nil
+}
+
+// zoneBatch returns the selectors of the --zones and --zone-list options, it
+// is nil if the zones are not rendered in a batch.
+func (o *templateOptions) zoneBatch() ([]*zoneSelector, error) {
+	specs := append([]string{}, o.zones...)
+	if o.zoneList != "" {
+		list, err := readZoneList(o.zoneList)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, list...)
+	}
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	return parseZoneSelectors(specs)
+}
+
+// batchTargets returns the targets of the zones in the batch. The zones of a
+// multi-world deploy.yaml are selected from its targets, while the zones of a
+// single world one are rendered with its instances. The world instances are
+// rendered only once in each world, with the first zone.
+func batchTargets(deploy *noncloudnative.DeployConf, targets []*noncloudnative.DeployTarget,
+	selectors []*zoneSelector) ([]*noncloudnative.DeployTarget, error) {
+	if len(deploy.Worlds) != 0 {
+		var selected []*noncloudnative.DeployTarget
+		found := make([]bool, len(selectors))
+		for _, t := range targets {
+			matched := false
+			for i, s := range selectors {
+				if s.match(t.WorldID, t.ZoneId) {
+					found[i], matched = true, true
+				}
+			}
+			if matched {
+				selected = append(selected, t)
+			}
+		}
+		for i, s := range selectors {
+			if !found[i] {
+				return nil, fmt.Errorf("zones %q not found in deploy.yaml", s.spec)
+			}
+		}
+		return selected, nil
+	}
+
+	var (
+		selected []*noncloudnative.DeployTarget
+		zones    = make(map[[2]uint64]bool)
+		worlds   = make(map[uint64]bool)
+	)
+	for _, s := range selectors {
+		worldID := deploy.WorldID
+		if s.world != nil {
+			worldID = *s.world
+		}
+		for zoneID := s.zones.Start; zoneID <= s.zones.End; zoneID++ {
+			if zones[[2]uint64{worldID, zoneID}] {
+				continue
+			}
+			zones[[2]uint64{worldID, zoneID}] = true
+
+			t := &noncloudnative.DeployTarget{WorldID: worldID, ZoneId: zoneID}
+			for _, u := range deploy.Instance {
+				if u.WorldInstance && worlds[worldID] {
+					continue
+				}
+				t.Instance = append(t.Instance, u)
+			}
+			worlds[worldID] = true
+			selected = append(selected, t)
+		}
+	}
+	return selected, nil
+}
+
+// zoneDir is the directory of the zone in the output when the zones are
+// rendered in a batch, e.g. 1.3 for zone 3 of world 1.
+func zoneDir(t *noncloudnative.DeployTarget) string {
+	return fmt.Sprintf("%d.%d", t.WorldID, t.ZoneId)
+}
+
+// prefixWriter creates the files under the directory of the output.
+type prefixWriter struct {
+	outputWriter
+	dir string
+}
+
+func (w *prefixWriter) Create(name string) (io.WriteCloser, error) {
+	return w.outputWriter.Create(util.SlashJoin(w.dir, name))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/cli/values"
+)
+
+// renderedFiles lists the files under dir relative to it.
+func renderedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestParseZoneSelectors(t *testing.T) {
+	selectors, err := parseZoneSelectors([]string{"3", " 1-50 ", "2:4-5"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, selectors[0].match(7, 3))
+	assert.False(t, selectors[0].match(7, 4))
+	assert.True(t, selectors[1].match(1, 50))
+	assert.False(t, selectors[1].match(1, 51))
+	assert.True(t, selectors[2].match(2, 4))
+	assert.False(t, selectors[2].match(1, 4))
+
+	for _, spec := range []string{"", "a", "5-3", "x:1", "1:"} {
+		_, err := parseZoneSelectors([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTemplateOptionsRunZoneBatch(t *testing.T) {
+	zoneList := filepath.Join(t.TempDir(), "zones.txt")
+	if err := os.WriteFile(zoneList, []byte("# zones of world 3\n3:7\n3:8, 3:7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		zones:     []string{"5-6"},
+		zoneList:  zoneList,
+		valOpts:   values.Options{Paths: []string{fixturePath("values", "default")}},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	var want []string
+	for _, zone := range []string{"1.5", "1.6", "3.7", "3.8"} {
+		for _, ins := range []string{"3", "4"} {
+			want = append(want, zone+"/echo/bin/start_"+zone+".42."+ins+".sh", zone+"/echo/cfg/echo_"+zone+".42."+ins+".yaml")
+		}
+	}
+	sort.Strings(want)
+	assert.Equal(t, want, renderedFiles(t, outDir))
+
+	data, err := os.ReadFile(filepath.Join(outDir, "3.8", "echo", "cfg", "echo_3.8.42.4.yaml"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(data), "world_id: 3\nzone_id: 8\n")
+	}
+
+	o.zoneList = ""
+	o.valOpts.Values = []string{"global.zone_id=2"}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "can not be used with --set global.world_id or global.zone_id")
+}
+
+func TestTemplateOptionsRunZoneBatchSelectsWorlds(t *testing.T) {
+	outDir := t.TempDir()
+	o := &templateOptions{
+		chartPath: fixturePath("charts"),
+		outPath:   outDir,
+		zones:     []string{"1:3-4", "2:5"},
+		valOpts:   values.Options{Paths: []string{fixturePath("values", "default"), fixturePath("values", "multiworld")}},
+	}
+	if !assert.NoError(t, o.run(&bytes.Buffer{})) {
+		return
+	}
+
+	var cfgs []string
+	for _, f := range renderedFiles(t, outDir) {
+		if strings.Contains(f, "/cfg/") {
+			cfgs = append(cfgs, f)
+		}
+	}
+	assert.Equal(t, []string{
+		"1.3/echo/cfg/echo_1.3.42.1.yaml",
+		"1.4/echo/cfg/echo_1.4.42.1.yaml",
+		"2.5/echo/cfg/echo_2.5.42.10.yaml",
+		"2.5/echo/cfg/echo_2.5.42.11.yaml",
+	}, cfgs)
+
+	o.zones = []string{"1:2"}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), `zones "1:2" not found in deploy.yaml`)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+)
+
+const zoneTestDeploy = `proc_desc:
+  - chart_name: logic
+    instance_type_id: "11"
+    instance_count: 1
+    start_instance_id: 1
+  - chart_name: router
+    instance_type_id: "12"
+    world_instance: true
+    instance_count: 1
+    start_instance_id: 1
+`
+
+func writeZoneTestDir(t *testing.T, deploy string) string {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "non_cloud_native"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "non_cloud_native", "deploy.yaml"), []byte(deploy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestZoneAddSingleWorld(t *testing.T) {
+	dir := writeZoneTestDir(t, zoneTestDeploy+"world_id: 3\nzone_id: 16\n")
+
+	whitelist := filepath.Join(dir, "whitelist.yaml")
+	if err := os.WriteFile(whitelist, []byte("whitelist:\n  - 3.16.11.1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tpl := filepath.Join(dir, "whitelist.tpl")
+	if err := os.WriteFile(tpl, []byte("{{- range .Instances }}\n  - {{ .BusAddr }}\n{{- end }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := &zoneAddOptions{
+		valuesPath:     dir,
+		worldID:        3,
+		zoneID:         17,
+		instanceCounts: []string{"logic=2"},
+		appends:        []string{whitelist + "=" + tpl},
+	}
+	var out bytes.Buffer
+	if !assert.NoError(t, o.run(&out)) {
+		return
+	}
+	assert.Contains(t, out.String(), "3.17.11.2 logic")
+
+	cfg, err := noncloudnative.LoadConfig([]string{dir})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, cfg.Deploy.WorldID)
+	targets, err := cfg.Deploy.Targets()
+	if !assert.NoError(t, err) || !assert.Len(t, targets, 2) {
+		return
+	}
+	assert.Equal(t, uint64(17), targets[1].ZoneId)
+	assert.Equal(t, uint64(2), targets[1].Instance[0].InstanceCount)
+	// the world instance is deployed with the first zone only
+	assert.Len(t, targets[1].Instance, 1)
+
+	data, err := os.ReadFile(whitelist)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var entries map[string][]string
+	if assert.NoError(t, yaml.Unmarshal(data, &entries)) {
+		assert.Equal(t, []string{"3.16.11.1", "3.17.11.1", "3.17.11.2"}, entries["whitelist"])
+	}
+}
+
+func TestZoneAddNewWorld(t *testing.T) {
+	dir := writeZoneTestDir(t, zoneTestDeploy+"worlds:\n  - world_id: 1\n    zones: [1, \"2-3\"]\n")
+
+	o := &zoneAddOptions{valuesPath: dir, worldID: 2, zoneID: 1}
+	var out bytes.Buffer
+	if !assert.NoError(t, o.run(&out)) {
+		return
+	}
+	assert.Contains(t, out.String(), "2.0.12.1 router")
+	assert.Contains(t, out.String(), "2.1.11.1 logic")
+
+	o = &zoneAddOptions{valuesPath: dir, worldID: 1, zoneID: 2}
+	assert.ErrorContains(t, o.run(&out), "zone 2 already exists in world 1")
+}
+
+func TestZoneAddValidate(t *testing.T) {
+	deploy := zoneTestDeploy + "world_id: 1\nzone_id: 1\n"
+	dir := writeZoneTestDir(t, deploy)
+
+	o := &zoneAddOptions{valuesPath: dir, worldID: 1, zoneID: 2, instanceCounts: []string{"unknown=2"}}
+	assert.ErrorContains(t, o.run(&bytes.Buffer{}), "chart unknown not found")
+
+	tpl := filepath.Join(dir, "hosts.tpl")
+	if err := os.WriteFile(tpl, []byte("hosts: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	o = &zoneAddOptions{valuesPath: dir, worldID: 1, zoneID: 2, appends: []string{filepath.Join(dir, "hosts.yaml") + "=" + tpl}}
+	assert.Error(t, o.run(&bytes.Buffer{}))
+
+	// nothing is written when the validation fails
+	data, err := os.ReadFile(filepath.Join(dir, "non_cloud_native", "deploy.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, deploy, string(data))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "hosts.yaml"))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+
+	yamlparser "github.com/atframework/atdtool/pkg/confparser/yaml"
+)
+
+// controlTokenEnv is the token sent to the control socket if '--token' is not
+// specified, so that the token is not shown in the process list.
+const controlTokenEnv = "LOG_ARCHIVE_TOKEN"
+
+// The roles of the control tokens, a role is allowed to run the commands of
+// the lower roles.
+const (
+	roleReadOnly = "readonly"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{
+	roleReadOnly: 1,
+	roleOperator: 2,
+	roleAdmin:    3,
+}
+
+// commandRoles is the lowest role required by the control commands.
+var commandRoles = map[string]string{
+	controlStatus: roleReadOnly,
+	controlPause:  roleOperator,
+	controlResume: roleOperator,
+	controlReload: roleOperator,
+	controlStop:   roleAdmin,
+}
+
+type controlToken struct {
+	// Name identifies the user of the token in the errors
+	Name  string `yaml:"name" json:"name"`
+	Token string `yaml:"token" json:"token"`
+	Role  string `yaml:"role" json:"role"`
+}
+
+// controlAuth authorizes the control commands by the tokens of the auth file.
+type controlAuth struct {
+	Tokens []controlToken `yaml:"tokens" json:"tokens"`
+}
+
+func loadControlAuth(name string) (*controlAuth, error) {
+	// the tokens should only be readable by the owner like the ssh keys
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("auth file: %s is accessible by others, it should be 0600", name)
+	}
+
+	data, err := yamlparser.LoadJSON(name)
+	if err != nil {
+		return nil, fmt.Errorf("read auth file: %v", err)
+	}
+
+	a := new(controlAuth)
+	if err := json.Unmarshal(data, a); err != nil {
+		return nil, fmt.Errorf("parse auth file: %v", err)
+	}
+
+	if len(a.Tokens) == 0 {
+		return nil, fmt.Errorf("auth file: %s has no tokens", name)
+	}
+	seen := make(map[string]bool, len(a.Tokens))
+	for i, t := range a.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("auth file: token %d is empty", i)
+		}
+		if _, ok := roleLevels[t.Role]; !ok {
+			return nil, fmt.Errorf("auth file: unknown role: %s of token %d", t.Role, i)
+		}
+		if seen[t.Token] {
+			return nil, fmt.Errorf("auth file: token %d is duplicated", i)
+		}
+		seen[t.Token] = true
+	}
+	return a, nil
+}
+
+// authorize checks whether the token is allowed to run the command, all
+// commands are allowed if the auth is not enabled.
+func (a *controlAuth) authorize(command, token string) error {
+	if a == nil {
+		return nil
+	}
+
+	required, ok := commandRoles[command]
+	if !ok {
+		return fmt.Errorf("unknown control command: %s", command)
+	}
+
+	for _, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) != 1 {
+			continue
+		}
+		if roleLevels[t.Role] < roleLevels[required] {
+			return fmt.Errorf("permission denied: %s (%s) could not %s", t.Name, t.Role, command)
+		}
+		return nil
+	}
+	return fmt.Errorf("unauthorized: invalid token")
+}
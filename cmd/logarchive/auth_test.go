@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeAuthFile(t *testing.T, content string, perm os.FileMode) string {
+	path := filepath.Join(t.TempDir(), "auth.yaml")
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadControlAuth(t *testing.T) {
+	t.Setenv("TEST_ADMIN_TOKEN", "admin-token")
+	a, err := loadControlAuth(writeAuthFile(t, `
+tokens:
+  - name: monitor
+    token: monitor-token
+    role: readonly
+  - name: ops
+    token: ${TEST_ADMIN_TOKEN}
+    role: admin
+`, 0600))
+	if assert.NoError(t, err) && assert.Len(t, a.Tokens, 2) {
+		assert.Equal(t, "admin-token", a.Tokens[1].Token)
+	}
+
+	_, err = loadControlAuth(writeAuthFile(t, "tokens:\n  - {token: t, role: root}\n", 0600))
+	assert.ErrorContains(t, err, "unknown role: root")
+	_, err = loadControlAuth(writeAuthFile(t, "tokens:\n  - {token: t, role: admin}\n  - {token: t, role: readonly}\n", 0600))
+	assert.ErrorContains(t, err, "duplicated")
+	_, err = loadControlAuth(writeAuthFile(t, "tokens:\n  - {role: admin}\n", 0600))
+	assert.ErrorContains(t, err, "empty")
+	_, err = loadControlAuth(writeAuthFile(t, "tokens: []\n", 0600))
+	assert.ErrorContains(t, err, "no tokens")
+
+	if runtime.GOOS != "windows" {
+		_, err = loadControlAuth(writeAuthFile(t, "tokens:\n  - {token: t, role: admin}\n", 0644))
+		assert.ErrorContains(t, err, "accessible by others")
+	}
+}
+
+func TestControlAuthorize(t *testing.T) {
+	var none *controlAuth
+	assert.NoError(t, none.authorize(controlStop, ""))
+
+	a := &controlAuth{Tokens: []controlToken{
+		{Name: "monitor", Token: "r", Role: roleReadOnly},
+		{Name: "ops", Token: "o", Role: roleOperator},
+		{Name: "root", Token: "a", Role: roleAdmin},
+	}}
+	for _, c := range []struct {
+		command string
+		allowed []string
+	}{
+		{controlStatus, []string{"r", "o", "a"}},
+		{controlPause, []string{"o", "a"}},
+		{controlResume, []string{"o", "a"}},
+		{controlReload, []string{"o", "a"}},
+		{controlStop, []string{"a"}},
+	} {
+		for _, token := range []string{"r", "o", "a"} {
+			err := a.authorize(c.command, token)
+			if contains(c.allowed, token) {
+				assert.NoError(t, err, "%s by %s", c.command, token)
+			} else {
+				assert.ErrorContains(t, err, "permission denied", "%s by %s", c.command, token)
+			}
+		}
+	}
+
+	assert.EqualError(t, a.authorize(controlStatus, ""), "unauthorized: invalid token")
+	assert.EqualError(t, a.authorize(controlStatus, "x"), "unauthorized: invalid token")
+	assert.EqualError(t, a.authorize("restart", "a"), "unknown control command: restart")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestControlSocketAuth(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "ctl.sock")
+	a := &controlAuth{Tokens: []controlToken{{Name: "monitor", Token: "r", Role: roleReadOnly}}}
+
+	s, err := listenControl(socket, "", a, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer s.Close()
+	go s.serve()
+
+	// all users could connect to the socket with auth
+	if info, err := os.Stat(socket); assert.NoError(t, err) && runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+	}
+
+	assert.EqualError(t, sendControlErr(socket, controlStatus, "", time.Second), "unauthorized: invalid token")
+	assert.EqualError(t, sendControlErr(socket, controlPause, "r", time.Second), "permission denied: monitor (readonly) could not pause")
+	assert.EqualError(t, sendControlErr(socket, controlStatus, "r", time.Second), "logarchive is not running")
+
+	// the token is read from the environment
+	t.Setenv(controlTokenEnv, "r")
+	o := &controlOptions{socket: socket, timeout: 1}
+	_, err = o.send(controlPause)
+	assert.ErrorContains(t, err, "permission denied")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+const compressDictTrainDesc = `
+Train a zstd dictionary from the sample files under the path.
+
+The small and similar files, like the logs of each session, are compressed much
+better with a dictionary trained from them. The regular files under the path are
+sampled, filtered by '--pattern' of the file name. At most '--max-samples' files
+are picked evenly, and at most '--max-sample-size' bytes are read from each one.
+
+The dictionary is written into '--output', and is used by the 'compressDictionary'
+option of the upload rule of the cos output. The name of the dictionary is the
+file name without the extension, the name and the id are recorded in the metadata
+of the uploaded objects. The objects could be decompressed by:
+
+    zstd -d -D <dictionary> <object>
+`
+
+type compressDictTrainOptions struct {
+	path          string
+	output        string
+	pattern       string
+	size          int
+	maxSamples    int
+	maxSampleSize int
+}
+
+func newCompressCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compress",
+		Short: "Manage the compression of the uploads",
+		Args:  exactArgs(0),
+	}
+
+	dictCmd := &cobra.Command{
+		Use:   "dict",
+		Short: "Manage the zstd dictionaries",
+		Args:  exactArgs(0),
+	}
+	dictCmd.AddCommand(newCompressDictTrainCmd(out))
+	cmd.AddCommand(dictCmd)
+	return cmd
+}
+
+func newCompressDictTrainCmd(out io.Writer) *cobra.Command {
+	o := &compressDictTrainOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "train PATH",
+		Short: "Train a zstd dictionary from the sample files",
+		Long:  compressDictTrainDesc,
+		Args:  exactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.path = args[0]
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.output, "output", "o", "", "Output file of the dictionary")
+	f.StringVar(&o.pattern, "pattern", "", "Glob pattern of the names of the sample files")
+	f.IntVar(&o.size, "size", compress.DefaultDictionarySize, "Max size of the dictionary")
+	f.IntVar(&o.maxSamples, "max-samples", 1000, "Max number of the sample files")
+	f.IntVar(&o.maxSampleSize, "max-sample-size", 128<<10, "Max size read from each sample file")
+	return cmd
+}
+
+func (o *compressDictTrainOptions) run(out io.Writer) error {
+	if o.output == "" {
+		return fmt.Errorf("the output file of the dictionary is required")
+	}
+
+	samples, err := compress.SampleFiles(o.path, o.pattern, o.maxSamples, o.maxSampleSize)
+	if err != nil {
+		return fmt.Errorf("sample files: %v", err)
+	}
+	if len(samples) < 2 {
+		return fmt.Errorf("at least 2 sample files are required, found %d", len(samples))
+	}
+
+	content, err := compress.TrainDictionary(samples, o.size)
+	if err != nil {
+		return fmt.Errorf("train dictionary: %v", err)
+	}
+	if err := os.WriteFile(o.output, content, 0644); err != nil {
+		return fmt.Errorf("write dictionary: %v", err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(o.output), filepath.Ext(o.output))
+	dict := compress.NewDictionary(name, content)
+	fmt.Fprintf(out, "dictionary: %s\n", o.output)
+	fmt.Fprintf(out, "name:       %s\n", dict.Name)
+	fmt.Fprintf(out, "id:         %d\n", dict.ID)
+	fmt.Fprintf(out, "size:       %d bytes\n", len(content))
+	fmt.Fprintf(out, "samples:    %d files\n", len(samples))
+	return nil
+}
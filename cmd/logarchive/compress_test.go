@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestCompressDictTrain(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		var b bytes.Buffer
+		for j := 0; j < 20; j++ {
+			fmt.Fprintf(&b, "INFO [session=%d] user=%d action=login result=ok latency=%dms\n", i, i*7, j)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.log", i)), b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	output := filepath.Join(t.TempDir(), "session.dict")
+	var out bytes.Buffer
+	cmd, err := newRootCmd(&out, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	cmd.SetArgs([]string{"compress", "dict", "train", dir, "-o", output, "--size", "1024", "--pattern", "*.log"})
+	if !assert.NoError(t, cmd.Execute()) {
+		return
+	}
+
+	dict, err := compress.LoadDictionary(output)
+	if assert.NoError(t, err) {
+		assert.LessOrEqual(t, len(dict.Content), 1024)
+		assert.Contains(t, out.String(), "name:       session")
+		assert.Contains(t, out.String(), fmt.Sprintf("id:         %d", dict.ID))
+		assert.Contains(t, out.String(), "samples:    20 files")
+	}
+
+	// no sample matches the pattern
+	cmd.SetArgs([]string{"compress", "dict", "train", dir, "-o", output, "--pattern", "*.txt"})
+	assert.Error(t, cmd.Execute())
+}
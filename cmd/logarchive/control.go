@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const (
+	controlReload = "reload"
+	controlPause  = "pause"
+	controlResume = "resume"
+	controlStop   = "stop"
+	controlStatus = "status"
+
+	// controlReadTimeout limits the time to receive the command
+	controlReadTimeout = 5 * time.Second
+)
+
+// controlServer serves the control commands of the running log-archive on a
+// unix socket. The request is the command and the optional token separated by
+// a space and ended with a newline, and the reply is "ok" followed by the
+// optional result, or the error message in one line.
+type controlServer struct {
+	ln         net.Listener
+	configFile string
+	auth       *controlAuth
+
+	// stop stops the log-archive and returns the exit code
+	stop func() int
+	exit func(code int)
+}
+
+// listenControl listens on the socket, the socket left by a killed process is
+// replaced, but the one in use is not. The commands are served by serve.
+//
+// Only the owner could connect to the socket unless the auth is enabled, then
+// all users could connect and the commands are authorized by the tokens.
+func listenControl(path, configFile string, auth *controlAuth, stop func() int) (*controlServer, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("control socket: %s is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket: %s is in use", path)
+		}
+		_ = os.Remove(path)
+	}
+
+	// the socket is created by the owner only, so that it could not be
+	// connected before the mode is changed
+	ln, err := listenPrivateUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("listen control socket: %v", err)
+	}
+
+	if auth != nil {
+		if err := os.Chmod(path, 0666); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("chmod control socket: %v", err)
+		}
+	}
+
+	return &controlServer{ln: ln, configFile: configFile, auth: auth, stop: stop, exit: os.Exit}, nil
+}
+
+// Close stops serving and removes the socket.
+func (s *controlServer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *controlServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *controlServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(controlReadTimeout)); err != nil {
+		return
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	command, token, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if err := s.auth.authorize(command, token); err != nil {
+		replyControl(conn, "", err)
+		return
+	}
+
+	if command == controlStop {
+		s.handleStop(conn)
+		return
+	}
+
+	result, err := s.execute(command)
+	replyControl(conn, result, err)
+}
+
+func replyControl(w io.Writer, result string, err error) {
+	reply := "ok"
+	if err != nil {
+		reply = strings.ReplaceAll(err.Error(), "\n", " ")
+	} else if result != "" {
+		reply += " " + result
+	}
+	_, _ = fmt.Fprintf(w, "%s\n", reply)
+}
+
+// handleStop replies after the log-archive has stopped, then exits the process.
+// It is the graceful stop on windows, where the signals could not be sent to
+// other processes.
+func (s *controlServer) handleStop(conn net.Conn) {
+	code := s.stop()
+
+	var err error
+	if code != ExitCodeSuccess {
+		err = fmt.Errorf("log-archive stopped with errors")
+	}
+	replyControl(conn, "", err)
+	conn.Close()
+	s.exit(code)
+}
+
+// execute runs the command and returns the result.
+func (s *controlServer) execute(command string) (string, error) {
+	switch command {
+	case controlStatus:
+		paused, err := logarchive.Paused()
+		if err != nil {
+			return "", err
+		}
+		if paused {
+			return "paused", nil
+		}
+		return "running", nil
+	case controlReload:
+		config, err := readConfigFile(s.configFile)
+		if err != nil {
+			return "", err
+		}
+		return "", logarchive.Reload(config)
+	case controlPause:
+		return "", logarchive.Pause()
+	case controlResume:
+		return "", logarchive.Resume()
+	default:
+		return "", fmt.Errorf("unknown control command: %s", command)
+	}
+}
+
+// sendControl sends the command to the control socket and returns the result
+// of the reply.
+func sendControl(socket, command, token string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return "", fmt.Errorf("connect log-archive: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+
+	request := command
+	if token != "" {
+		request += " " + token
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", request); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("wait for log-archive: %v", err)
+	}
+
+	reply = strings.TrimSpace(reply)
+	if reply == "ok" {
+		return "", nil
+	}
+	if result, ok := strings.CutPrefix(reply, "ok "); ok {
+		return result, nil
+	}
+	return "", fmt.Errorf("%s", reply)
+}
+
+type controlOptions struct {
+	socket  string
+	token   string
+	timeout int
+}
+
+// addControlFlags adds the flags to connect the control socket.
+func (o *controlOptions) addControlFlags(cmd *cobra.Command, timeout int) {
+	f := cmd.Flags()
+	f.StringVar(&o.socket, "socket", "", "The control socket of the process")
+	f.StringVar(&o.token, "token", "", "The token of the control socket, $"+controlTokenEnv+" is used if not specified")
+	f.IntVar(&o.timeout, "timeout", timeout, "Seconds to wait for the process to finish the command")
+}
+
+func (o *controlOptions) send(command string) (string, error) {
+	token := o.token
+	if token == "" {
+		token = os.Getenv(controlTokenEnv)
+	}
+	return sendControl(o.socket, command, token, time.Duration(o.timeout)*time.Second)
+}
+
+// newControlCmd returns the command which sends the control command to the
+// running log-archive, done is printed once it succeeds.
+func newControlCmd(out io.Writer, command, short, long, done string) *cobra.Command {
+	o := &controlOptions{}
+
+	cmd := &cobra.Command{
+		Use:   command,
+		Short: short,
+		Long:  long,
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := o.send(command); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, done)
+			return nil
+		},
+	}
+
+	o.addControlFlags(cmd, 60)
+	cobra.MarkFlagRequired(cmd.Flags(), "socket")
+	return cmd
+}
+
+func newReloadCmd(out io.Writer) *cobra.Command {
+	return newControlCmd(out, controlReload, "Reloads the configuration of the log-archive process",
+		"Reloads the configuration file of the log-archive process by the control socket. The configuration is validated before the running archives are stopped, and the previous configuration is restored if the new one fails to start",
+		"Reloaded log-archive")
+}
+
+func newPauseCmd(out io.Writer) *cobra.Command {
+	return newControlCmd(out, controlPause, "Pauses the uploads of the log-archive process",
+		"Pauses the uploads of the log-archive process by the control socket, e.g. during the maintenance of the output. The files are still collected and uploaded after resumed, the pause is kept across reloading",
+		"Paused the uploads of log-archive")
+}
+
+func newResumeCmd(out io.Writer) *cobra.Command {
+	return newControlCmd(out, controlResume, "Resumes the uploads of the log-archive process",
+		"Resumes the uploads of the log-archive process paused by 'pause'",
+		"Resumed the uploads of log-archive")
+}
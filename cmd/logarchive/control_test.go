@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestControlSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "ctl.sock")
+
+	// the socket left by a killed process is replaced
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	stopped := make(chan int, 1)
+	s, err := listenControl(socket, filepath.Join(dir, "none.yaml"), nil, func() int {
+		return ExitCodeFailedQuit
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s.exit = func(code int) { stopped <- code }
+	go s.serve()
+
+	_, err = listenControl(socket, "", nil, nil)
+	assert.ErrorContains(t, err, "is in use")
+
+	// only the owner could connect to the socket without the auth
+	if info, err := os.Stat(socket); assert.NoError(t, err) && runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// the errors are replied
+	assert.EqualError(t, sendControlErr(socket, controlPause, "", time.Second), "logarchive is not running")
+	assert.ErrorContains(t, sendControlErr(socket, controlReload, "", time.Second), "read log-archive config file")
+	assert.EqualError(t, sendControlErr(socket, "restart", "", time.Second), "unknown control command: restart")
+
+	// the reply of stop is sent before exiting
+	assert.EqualError(t, sendControlErr(socket, controlStop, "", time.Second), "log-archive stopped with errors")
+	assert.Equal(t, ExitCodeFailedQuit, <-stopped)
+
+	assert.NoError(t, s.Close())
+	assert.NoFileExists(t, socket)
+	assert.ErrorContains(t, sendControlErr(socket, controlPause, "", time.Second), "connect log-archive")
+
+	if err := os.WriteFile(socket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = listenControl(socket, "", nil, nil)
+	assert.ErrorContains(t, err, "is not a socket")
+}
+
+func sendControlErr(socket, command, token string, timeout time.Duration) error {
+	_, err := sendControl(socket, command, token, timeout)
+	return err
+}
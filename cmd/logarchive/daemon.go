@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// daemonReadyEnv is set for the daemon process, the daemon reports whether it
+// has started by the pipe of the file descriptor.
+const daemonReadyEnv = "LOG_ARCHIVE_DAEMON_READY_FD"
+
+const startDesc = `
+Start the log-archive process.
+
+The process runs in the background by default, and the command returns once
+the archives have started. The logs should be written into a file by the 'log'
+option of the configuration, because the output of the background process is
+discarded. Use '--foreground' to run in the current process, e.g. managed by
+systemd or supervisord.
+
+The pid file specified by '--pidfile' prevents starting another process, and is
+used by 'stop' and 'status'. The unix socket specified by '--socket' is used by
+'reload', 'pause', 'resume' and 'stop' to control the running process, it is
+the only way to stop gracefully on windows.
+
+The control socket is only accessible by the owner of the process, unless
+'--auth-file' is specified. Then all users could connect to it, and each
+command requires a token of the role allowed to run it:
+
+  readonly   status
+  operator   status, pause, resume and reload
+  admin      all of the above and stop
+
+The tokens are listed in the auth file which should only be readable by the
+owner, the ${ENV_VAR} placeholders are expanded:
+
+  tokens:
+    - name: monitor
+      token: ${MONITOR_TOKEN}
+      role: readonly
+`
+
+type startOptions struct {
+	pidFile    string
+	socket     string
+	authFile   string
+	foreground bool
+
+	ctl      *controlServer
+	stopOnce sync.Once
+	exitCode int
+}
+
+func newStartCmd(out io.Writer) *cobra.Command {
+	o := &startOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Starts the log-archive process",
+		Long:  startDesc,
+		Args:  exactArgs(0),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				// Allow file completion when completing the argument for the name
+				// which could be a path
+				return nil, cobra.ShellCompDirectiveDefault
+			}
+			// No more completions, so disable file completion
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !o.foreground && os.Getenv(daemonReadyEnv) == "" {
+				return o.daemonize(out)
+			}
+			return o.run()
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&configFile, "config", "c", "", "Configuration file")
+	f.StringVar(&o.pidFile, "pidfile", "", "Write the pid of the process into the file")
+	f.StringVar(&o.socket, "socket", "", "Listen on the unix socket for 'reload', 'pause', 'resume' and 'stop'")
+	f.StringVar(&o.authFile, "auth-file", "", "Authorize the commands of the control socket by the tokens in the file")
+	f.BoolVar(&o.foreground, "foreground", false, "Run in the foreground instead of the background")
+	return cmd
+}
+
+// run starts the log-archive in the current process and blocks indefinitely.
+func (o *startOptions) run() (err error) {
+	defer func() {
+		if err != nil {
+			notifyReady(err)
+		}
+	}()
+
+	// the pid file is created before starting, so that only one of the
+	// processes started at the same time runs
+	if o.pidFile != "" {
+		if err := createPidFile(o.pidFile); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				removePidFile(o.pidFile)
+			}
+		}()
+	}
+
+	var auth *controlAuth
+	if o.authFile != "" {
+		if o.socket == "" {
+			return fmt.Errorf("--auth-file requires --socket")
+		}
+		if auth, err = loadControlAuth(o.authFile); err != nil {
+			return err
+		}
+	}
+
+	if o.socket != "" {
+		if o.ctl, err = listenControl(o.socket, configFile, auth, o.shutdown); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				o.ctl.Close()
+			}
+		}()
+		go o.ctl.serve()
+	}
+
+	// trap signal
+	go func() {
+		sigchan := make(chan os.Signal, 1)
+		signal.Notify(sigchan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+
+		for sig := range sigchan {
+			switch sig {
+			case syscall.SIGQUIT:
+				os.Exit(ExitCodeForceQuit)
+			case syscall.SIGINT:
+				fallthrough
+			case syscall.SIGTERM:
+				os.Exit(o.shutdown())
+			}
+		}
+	}()
+
+	config, err := readConfigFile(configFile)
+	if err != nil {
+		return err
+	}
+
+	success, exit := make(chan struct{}), make(chan error)
+	// start server
+	go func() {
+		if err := logarchive.Start(config); err != nil {
+			exit <- err
+		} else {
+			close(success)
+		}
+	}()
+
+	select {
+	case <-success:
+	case err := <-exit:
+		return err
+	}
+
+	notifyReady(nil)
+	fmt.Printf("Successfully started log-archive\n")
+
+	// block
+	select {}
+}
+
+// shutdown stops the log-archive and returns the exit code, it is called by
+// the signals and the 'stop' control command, so only the first one stops.
+func (o *startOptions) shutdown() int {
+	o.stopOnce.Do(func() {
+		if o.ctl != nil {
+			o.ctl.Close()
+		}
+		err := logarchive.Stop()
+		removePidFile(o.pidFile)
+
+		o.exitCode = ExitCodeSuccess
+		if err != nil {
+			o.exitCode = ExitCodeFailedQuit
+		}
+	})
+	return o.exitCode
+}
+
+// notifyReady reports the result of starting to the process which started the daemon.
+func notifyReady(err error) {
+	fd, convErr := strconv.Atoi(os.Getenv(daemonReadyEnv))
+	if convErr != nil {
+		return
+	}
+	os.Unsetenv(daemonReadyEnv)
+
+	f := os.NewFile(uintptr(fd), "ready")
+	if f == nil {
+		return
+	}
+	defer f.Close()
+
+	msg := "ok"
+	if err != nil {
+		msg = err.Error()
+	}
+	_, _ = f.WriteString(msg)
+}
+
+// waitReady waits for the result of starting reported by the daemon.
+func waitReady(r io.Reader) error {
+	data, _ := io.ReadAll(r)
+	switch msg := string(data); msg {
+	case "ok":
+		return nil
+	case "":
+		return fmt.Errorf("log-archive exited before started")
+	default:
+		return fmt.Errorf("%s", msg)
+	}
+}
+
+func readPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file: %s", path)
+	}
+	return pid, nil
+}
+
+// runningPid returns the pid in the pid file if the process is running.
+func runningPid(path string) (int, bool) {
+	pid, err := readPidFile(path)
+	if err != nil || pid == os.Getpid() {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// createPidFile creates the pid file exclusively, it fails if the process of
+// the pid file is running. The pid file of the process which has exited is
+// replaced, the invalid one is kept to be checked by the user.
+func createPidFile(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return fmt.Errorf("write pid file: %v", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("create pid file: %v", err)
+		}
+
+		pid, err := readNewPidFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("log-archive is already running (pid %d)", pid)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove stale pid file: %v", err)
+		}
+	}
+	return fmt.Errorf("pid file %s is created by another process", path)
+}
+
+// readNewPidFile reads the pid file which may be just created by another
+// process, the file is empty until the pid is written.
+func readNewPidFile(path string) (int, error) {
+	for i := 0; i < 10; i++ {
+		if info, err := os.Stat(path); err != nil || info.Size() > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return readPidFile(path)
+}
+
+// removePidFile removes the pid file written by the current process.
+func removePidFile(path string) {
+	if path == "" {
+		return
+	}
+	if pid, err := readPidFile(path); err == nil && pid == os.Getpid() {
+		_ = os.Remove(path)
+	}
+}
+
+type pidFileOptions struct {
+	controlOptions
+	pidFile string
+}
+
+func newStopCmd(out io.Writer) *cobra.Command {
+	o := &pidFileOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stops the log-archive process",
+		Long:  "Stops the log-archive process of the pid file or the control socket, and waits until it exits. The control socket is required to stop gracefully on windows, where the process of the pid file is killed",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.socket != "" {
+				return o.stopBySocket(out)
+			}
+			return o.stop(out)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.pidFile, "pidfile", "", "The pid file of the process")
+	o.addControlFlags(cmd, 30)
+	cmd.MarkFlagsOneRequired("pidfile", "socket")
+	return cmd
+}
+
+func newStatusCmd(out io.Writer) *cobra.Command {
+	o := &pidFileOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Prints whether the log-archive process is running",
+		Long:  "Prints whether the log-archive process of the pid file or the control socket is running, it fails if not. The control socket also reports whether the uploads are paused",
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.socket != "" {
+				return o.statusBySocket(out)
+			}
+
+			pid, ok := runningPid(o.pidFile)
+			if !ok {
+				return fmt.Errorf("log-archive is not running")
+			}
+			fmt.Fprintf(out, "log-archive is running (pid %d)\n", pid)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&o.pidFile, "pidfile", "", "The pid file of the process")
+	o.addControlFlags(cmd, 10)
+	cmd.MarkFlagsOneRequired("pidfile", "socket")
+	return cmd
+}
+
+// stopBySocket sends the 'stop' control command, the reply is sent after the
+// archives have stopped.
+func (o *pidFileOptions) stopBySocket(out io.Writer) error {
+	if _, err := o.send(controlStop); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Stopped log-archive\n")
+	return nil
+}
+
+func (o *pidFileOptions) statusBySocket(out io.Writer) error {
+	status, err := o.send(controlStatus)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "log-archive is %s\n", status)
+	return nil
+}
+
+func (o *pidFileOptions) stop(out io.Writer) error {
+	pid, ok := runningPid(o.pidFile)
+	if !ok {
+		return fmt.Errorf("log-archive is not running")
+	}
+
+	if err := terminateProcess(pid); err != nil {
+		return fmt.Errorf("stop log-archive (pid %d): %v", pid, err)
+	}
+
+	deadline := time.Now().Add(time.Duration(o.timeout) * time.Second)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("log-archive (pid %d) has not exited in %d seconds", pid, o.timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	fmt.Fprintf(out, "Stopped log-archive (pid %d)\n", pid)
+	return nil
+}
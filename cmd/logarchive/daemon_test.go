@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log-archive.pid")
+
+	_, ok := runningPid(path)
+	assert.False(t, ok)
+
+	// the pid of the current process is ignored, e.g. reused after reboot
+	assert.NoError(t, createPidFile(path))
+	_, ok = runningPid(path)
+	assert.False(t, ok)
+	assert.NoError(t, createPidFile(path))
+
+	removePidFile(path)
+	assert.NoFileExists(t, path)
+
+	// the pid file of another process is kept
+	ppid := os.Getppid()
+	assert.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(ppid)+"\n"), 0644))
+	pid, ok := runningPid(path)
+	assert.True(t, ok)
+	assert.Equal(t, ppid, pid)
+	removePidFile(path)
+	assert.FileExists(t, path)
+	assert.ErrorContains(t, createPidFile(path), "already running")
+
+	// the pid file of the exited process is replaced
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if assert.NoError(t, cmd.Run()) {
+		assert.NoError(t, os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644))
+		assert.NoError(t, createPidFile(path))
+		pid, err := readPidFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.Getpid(), pid)
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("invalid"), 0644))
+	_, err := readPidFile(path)
+	assert.ErrorContains(t, err, "invalid pid file")
+	assert.ErrorContains(t, createPidFile(path), "invalid pid file")
+}
+
+// pidFileHelperEnv makes the test binary a process creating the pid file, which
+// prints the result and holds the pid file until its stdin is closed.
+const pidFileHelperEnv = "LOG_ARCHIVE_TEST_PID_FILE"
+
+func TestCreatePidFileHelper(t *testing.T) {
+	path := os.Getenv(pidFileHelperEnv)
+	if path == "" {
+		t.Skip("only run as the helper process")
+	}
+	if err := createPidFile(path); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("ok")
+	_, _ = io.Copy(io.Discard, os.Stdin)
+}
+
+func TestCreatePidFileConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log-archive.pid")
+
+	// only one of the processes started at the same time creates the pid file
+	const n = 8
+	results := make([]string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestCreatePidFileHelper$")
+		cmd.Env = append(os.Environ(), pidFileHelperEnv+"="+path)
+		stdin, err := cmd.StdinPipe()
+		if !assert.NoError(t, err) {
+			return
+		}
+		stdout, err := cmd.StdoutPipe()
+		if !assert.NoError(t, err) || !assert.NoError(t, cmd.Start()) {
+			return
+		}
+		// the helper holding the pid file exits once its stdin is closed
+		defer func() {
+			stdin.Close()
+			_ = cmd.Wait()
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			line, _ := bufio.NewReader(stdout).ReadString('\n')
+			results[i] = strings.TrimSpace(line)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, result := range results {
+		if result == "ok" {
+			created++
+		} else {
+			assert.Contains(t, result, "already running")
+		}
+	}
+	assert.Equal(t, 1, created, "results: %v", results)
+}
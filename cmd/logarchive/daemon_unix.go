@@ -0,0 +1,76 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// daemonize starts the log-archive in a new session in the background, and waits
+// until it has started.
+func (o *startOptions) daemonize(out io.Writer) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer devNull.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	// the first extra file is the file descriptor 3 of the daemon
+	cmd.Env = append(os.Environ(), daemonReadyEnv+"=3")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = devNull, devNull, devNull
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("start log-archive daemon: %v", err)
+	}
+
+	if err := waitReady(r); err != nil {
+		_ = cmd.Wait()
+		return err
+	}
+	pid := cmd.Process.Pid
+	_ = cmd.Process.Release()
+
+	fmt.Fprintf(out, "Successfully started log-archive (pid %d)\n", pid)
+	return nil
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func terminateProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// listenPrivateUnix listens on the unix socket created with the mode 0600, the
+// umask is process wide, so the files created by the other goroutines at the
+// same time are also restricted to the owner.
+func listenPrivateUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
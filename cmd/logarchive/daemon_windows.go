@@ -0,0 +1,40 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+func (o *startOptions) daemonize(_out io.Writer) error {
+	return fmt.Errorf("running in the background is not supported on windows, use --foreground")
+}
+
+// processAlive reports whether the process exists, FindProcess opens the
+// process on windows.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// listenPrivateUnix listens on the unix socket, the access of which follows the
+// acl of the directory on windows.
+func listenPrivateUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+)
+
+const retryDeadLetterDesc = `
+Move the files in the dead-letter directories back to their original paths.
+
+The files which have failed to upload are moved into the dead-letter directory
+of the archive when the 'deadLetterDir' option is configured. This command puts
+them back, so that they are collected again by the running log-archive.
+
+The '--archive' flag limits the retried archive, all archives are retried by default.
+`
+
+type retryDeadLetterOptions struct {
+	configFile string
+	archive    string
+}
+
+func newRetryDeadLetterCmd(out io.Writer) *cobra.Command {
+	o := &retryDeadLetterOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "retry-dead-letter",
+		Short: "Re-enqueue the files which have failed to upload",
+		Long:  retryDeadLetterDesc,
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.configFile, "config", "c", "", "Configuration file")
+	f.StringVar(&o.archive, "archive", "", "Only retry the dead letter of the archive")
+	return cmd
+}
+
+func (o *retryDeadLetterOptions) run(out io.Writer) error {
+	data, err := readConfigFile(o.configFile)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := loadDeadLetterDirs(data)
+	if err != nil {
+		return err
+	}
+
+	if o.archive != "" {
+		dir, ok := dirs[o.archive]
+		if !ok {
+			return fmt.Errorf("archive %s has no dead letter dir", o.archive)
+		}
+		dirs = map[string]string{o.archive: dir}
+	}
+
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	retried, failed := 0, 0
+	for _, name := range names {
+		records, err := filearchive.LoadDeadLetter(dirs[name])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load dead letter of archive %s: %v", name, err)
+		}
+
+		for _, r := range records {
+			if err := filearchive.RetryDeadLetter(r); err != nil {
+				fmt.Fprintf(out, "%s: retry %s failed: %v\n", name, r.Path(), err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(out, "%s: %s has been moved back to %s\n", name, r.Path(), r.File)
+			retried++
+		}
+	}
+
+	if failed != 0 {
+		return fmt.Errorf("failed to retry %d files", failed)
+	}
+	fmt.Fprintf(out, "%d files have been re-enqueued\n", retried)
+	return nil
+}
+
+// loadDeadLetterDirs returns the dead-letter directories of the archives.
+func loadDeadLetterDirs(data []byte) (map[string]string, error) {
+	cfg := new(logarchive.Config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("decode log-archive config: %v", err)
+	}
+
+	dirs := make(map[string]string)
+	for name, raw := range cfg.ArchivesRaw {
+		var ar struct {
+			DeadLetterDir string `json:"deadLetterDir"`
+		}
+		if err := json.Unmarshal(raw, &ar); err != nil {
+			return nil, fmt.Errorf("decode archive %s: %v", name, err)
+		}
+		if ar.DeadLetterDir != "" {
+			dirs[name] = ar.DeadLetterDir
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no dead letter dir found")
+	}
+	return dirs, nil
+}
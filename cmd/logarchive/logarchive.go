@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/signal"
 	"runtime"
-	"syscall"
 
 	"github.com/spf13/cobra"
 
-	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/containerarchive"
 	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/cos"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/credential"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/dbdump"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/execarchive"
 	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/filter"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/syslogarchive"
+	yamlparser "github.com/atframework/atdtool/pkg/confparser/yaml"
 )
 
 const (
@@ -31,8 +35,18 @@ var (
 	globalUsage = `Used to collect log from multiple inputs to the specified output
 Common actions for log-archive:
 
-- log-archive start:      Starts the log-archive process and blocks indefinitely
-- log-archive version:    Prints the version
+- log-archive start:             Starts the log-archive process in the background
+- log-archive stop:              Stops the log-archive process of the pid file or the control socket
+- log-archive status:            Prints whether the log-archive process is running
+- log-archive reload:            Reloads the configuration of the process by the control socket
+- log-archive pause:             Pauses the uploads of the process by the control socket
+- log-archive resume:            Resumes the uploads of the process by the control socket
+- log-archive reconcile:         Compares the upload journal with the objects in the bucket
+- log-archive modules:           Lists the registered modules and describes their options
+- log-archive retry-dead-letter: Re-enqueues the files which have failed to upload
+- log-archive validate:          Checks the configuration without starting
+- log-archive compress dict:     Trains the zstd dictionaries of the uploads
+- log-archive version:           Prints the version
 `
 )
 
@@ -51,6 +65,16 @@ func exactArgs(n int) cobra.PositionalArgs {
 	}
 }
 
+// readConfigFile reads the config file in YAML or JSON and converts it into JSON,
+// the ${ENV_VAR} placeholders are expanded.
+func readConfigFile(name string) ([]byte, error) {
+	data, err := yamlparser.LoadJSON(name)
+	if err != nil {
+		return nil, fmt.Errorf("read log-archive config file: %v", err)
+	}
+	return data, nil
+}
+
 // ToolName returns the tool name.
 func ToolName() string {
 	return toolName
@@ -72,6 +96,16 @@ func newRootCmd(out io.Writer, args []string) (*cobra.Command, error) {
 	cmd.AddCommand(
 		newVersionCmd(out),
 		newStartCmd(out),
+		newStopCmd(out),
+		newStatusCmd(out),
+		newReloadCmd(out),
+		newPauseCmd(out),
+		newResumeCmd(out),
+		newReconcileCmd(out),
+		newRetryDeadLetterCmd(out),
+		newValidateCmd(out),
+		newModulesCmd(out),
+		newCompressCmd(out),
 	)
 
 	return cmd, nil
@@ -105,78 +139,6 @@ func newVersionCmd(out io.Writer) *cobra.Command {
 	return cmd
 }
 
-func newStartCmd(_ io.Writer) *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "start",
-		Short: "Starts the log-archive process in the background",
-		Long:  "Starts the log-archive process in the background",
-		Args:  exactArgs(0),
-		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-			if len(args) == 0 {
-				// Allow file completion when completing the argument for the name
-				// which could be a path
-				return nil, cobra.ShellCompDirectiveDefault
-			}
-			// No more completions, so disable file completion
-			return nil, cobra.ShellCompDirectiveNoFileComp
-		},
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return startProcess()
-		},
-	}
-
-	f := cmd.Flags()
-	f.StringVarP(&configFile, "config", "c", "", "Configuration file")
-	return cmd
-}
-
-func startProcess() error {
-	// trap signal
-	go func() {
-		sigchan := make(chan os.Signal, 1)
-		signal.Notify(sigchan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
-
-		for sig := range sigchan {
-			switch sig {
-			case syscall.SIGQUIT:
-				os.Exit(ExitCodeForceQuit)
-			case syscall.SIGINT:
-				fallthrough
-			case syscall.SIGTERM:
-				if err := logarchive.Stop(); err != nil {
-					os.Exit(ExitCodeFailedQuit)
-				}
-				os.Exit(ExitCodeSuccess)
-			}
-		}
-	}()
-
-	config, err := os.ReadFile(configFile)
-	if err != nil {
-		return fmt.Errorf("read log-archive config file: %v", err)
-	}
-
-	success, exit := make(chan struct{}), make(chan error)
-	// start server
-	go func() {
-		if err := logarchive.Start(config); err != nil {
-			exit <- err
-		} else {
-			close(success)
-		}
-	}()
-
-	select {
-	case <-success:
-		fmt.Printf("Successfully started log-archive\n")
-	case err := <-exit:
-		return err
-	}
-
-	// block
-	select {}
-}
-
 func main() {
 	var out bytes.Buffer
 	cmd, err := newRootCmd(&out, os.Args[1:])
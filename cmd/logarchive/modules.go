@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const modulesDesc = `
+List the modules registered in log-archive.
+
+The archives are configured by the names of the modules without namespace,
+e.g. 'file', and the outputs are selected by the 'type' of the output, e.g.
+'cos' for the module 'output.cos'.
+`
+
+const modulesDescribeDesc = `
+Print the configuration fields of a module with their types and yaml tags.
+
+The fields of the nested objects are named by their paths, e.g.
+'collectRule.keepSourceFile', '[]' is the elements of a list and '*' is the
+values of a map. The fields of type 'module' load the modules of the namespace.
+`
+
+func newModulesCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "modules",
+		Short: "List the registered modules",
+		Long:  modulesDesc,
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, mod := range logarchive.Modules() {
+				fmt.Fprintln(out, mod.ID)
+			}
+			return nil
+		},
+	}
+	cmd.AddCommand(newModulesDescribeCmd(out))
+	return cmd
+}
+
+func newModulesDescribeCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe [ID]",
+		Short: "Print the configuration fields of a module",
+		Long:  modulesDescribeDesc,
+		Args:  exactArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			var ids []string
+			for _, mod := range logarchive.Modules() {
+				ids = append(ids, string(mod.ID))
+			}
+			return ids, cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mod, err := logarchive.GetModule(args[0])
+			if err != nil {
+				return err
+			}
+			return describeModule(out, mod)
+		},
+	}
+	return cmd
+}
+
+func describeModule(out io.Writer, mod logarchive.ModuleInfo) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tYAML TAG")
+	for _, f := range mod.Fields() {
+		typ := f.Type
+		if f.Namespace != "" {
+			typ += fmt.Sprintf(" (%s.*)", f.Namespace)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, typ, f.Tag)
+	}
+	return w.Flush()
+}
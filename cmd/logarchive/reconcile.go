@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/cos"
+)
+
+const reconcileDesc = `
+Compare the upload journal of the cos outputs with the objects in the bucket.
+
+It reports the objects which are recorded as uploaded in the journal but missing
+in the bucket, and the objects in the bucket which are not recorded in the journal.
+The journal is enabled by the 'journal' option of the cos output.
+
+The '--since' flag accepts a RFC3339 time or a duration, e.g. '24h'.
+`
+
+type reconcileOptions struct {
+	configFile string
+	prefix     string
+	since      string
+}
+
+func newReconcileCmd(out io.Writer) *cobra.Command {
+	o := &reconcileOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Compare the upload journal with the objects in the bucket",
+		Long:  reconcileDesc,
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.configFile, "config", "c", "", "Configuration file")
+	f.StringVar(&o.prefix, "prefix", "", "Only check the objects with the key prefix")
+	f.StringVar(&o.since, "since", "", "Only check the objects uploaded since the time")
+	return cmd
+}
+
+func (o *reconcileOptions) run(out io.Writer) error {
+	since, err := parseSince(o.since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	data, err := readConfigFile(o.configFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := logarchive.NewContext(logarchive.Context{Context: context.Background()})
+	defer cancel()
+
+	outputs, err := loadCosOutputs(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mismatched := 0
+	for _, name := range names {
+		report, err := outputs[name].Reconcile(ctx, o.prefix, since)
+		if err != nil {
+			return fmt.Errorf("reconcile archive %s: %v", name, err)
+		}
+
+		for _, r := range report.MissingRemote {
+			fmt.Fprintf(out, "%s: missing remote: %s (file: %s, uploaded at: %s)\n", name, r.Key, r.File, r.Time.Format(time.RFC3339))
+		}
+		for _, obj := range report.MissingLocal {
+			fmt.Fprintf(out, "%s: missing local: %s (size: %d, modified at: %s)\n", name, obj.Key, obj.Size, obj.LastModified)
+		}
+		mismatched += len(report.MissingRemote) + len(report.MissingLocal)
+	}
+
+	if mismatched != 0 {
+		return fmt.Errorf("found %d mismatched objects", mismatched)
+	}
+	fmt.Fprintf(out, "all objects are consistent\n")
+	return nil
+}
+
+// loadCosOutputs returns the cos outputs of the archives with the journal enabled.
+func loadCosOutputs(ctx logarchive.Context, data []byte) (map[string]*cos.Handler, error) {
+	cfg := new(logarchive.Config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("decode log-archive config: %v", err)
+	}
+
+	outputs := make(map[string]*cos.Handler)
+	for name, raw := range cfg.ArchivesRaw {
+		var ar struct {
+			Output json.RawMessage `json:"output"`
+		}
+		if err := json.Unmarshal(raw, &ar); err != nil {
+			return nil, fmt.Errorf("decode archive %s: %v", name, err)
+		}
+
+		var typ struct {
+			Type string `json:"type"`
+		}
+		if len(ar.Output) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(ar.Output, &typ); err != nil {
+			return nil, fmt.Errorf("decode archive %s output: %v", name, err)
+		}
+		if typ.Type != "cos" {
+			continue
+		}
+
+		h := new(cos.Handler)
+		if err := json.Unmarshal(ar.Output, h); err != nil {
+			return nil, fmt.Errorf("decode archive %s output: %v", name, err)
+		}
+		if h.Journal == "" {
+			return nil, fmt.Errorf("archive %s: the journal of cos output is not configured", name)
+		}
+		if err := h.LoadCredential(ctx); err != nil {
+			return nil, fmt.Errorf("archive %s: %v", name, err)
+		}
+		outputs[name] = h
+	}
+
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no cos output found")
+	}
+	return outputs, nil
+}
+
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since: %s, should be a RFC3339 time or a duration", s)
+	}
+	return t, nil
+}
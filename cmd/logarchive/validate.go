@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const validateDesc = `
+Check the configuration without starting the log-archive process.
+
+The modules are provisioned and validated as 'start' does, so the invalid
+regexes, the missing buckets and the unknown module names are reported before
+rollout. The archives are not started, no file is collected or uploaded.
+
+The report is printed as text or as json by '--output', and the command fails
+if any check fails.
+`
+
+type validateOptions struct {
+	configFile string
+	output     string
+}
+
+func newValidateCmd(out io.Writer) *cobra.Command {
+	o := &validateOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration without starting",
+		Long:  validateDesc,
+		Args:  exactArgs(0),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out)
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&o.configFile, "config", "c", "", "Configuration file")
+	f.StringVarP(&o.output, "output", "o", "text", "Output format of the report, text or json")
+	return cmd
+}
+
+func (o *validateOptions) run(out io.Writer) error {
+	if o.output != "text" && o.output != "json" {
+		return fmt.Errorf("invalid output format: %s, should be text or json", o.output)
+	}
+
+	data, err := readConfigFile(o.configFile)
+	if err != nil {
+		return err
+	}
+
+	report := logarchive.Validate(data)
+	if o.output == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range report.Results {
+			name := r.Component
+			if r.Name != "" {
+				name += " " + r.Name
+			}
+			if r.Error != "" {
+				fmt.Fprintf(out, "FAIL %s: %s\n", name, r.Error)
+			} else {
+				fmt.Fprintf(out, "ok   %s\n", name)
+			}
+		}
+	}
+
+	if n := report.Failed(); n != 0 {
+		return fmt.Errorf("%d checks failed", n)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package logarchive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+const (
+	alertKindSuccessRatio = "success_ratio"
+	alertKindBacklogAge   = "backlog_age"
+)
+
+// AlertRule defines the SLO thresholds of one module.
+// Module is the "module" label of the metrics, e.g. "cos" for the output
+// success ratio or "file" for the input backlog age.
+type AlertRule struct {
+	Name            string  `yaml:"name,omitempty" json:"name,omitempty"`
+	Module          string  `yaml:"module,omitempty" json:"module,omitempty"`
+	Window          int     `yaml:"window,omitempty" json:"window,omitempty"`
+	MinSuccessRatio float64 `yaml:"minSuccessRatio,omitempty" json:"minSuccessRatio,omitempty"`
+	MinRequests     int     `yaml:"minRequests,omitempty" json:"minRequests,omitempty"`
+	MaxBacklogAge   int     `yaml:"maxBacklogAge,omitempty" json:"maxBacklogAge,omitempty"`
+
+	samples []alertSample
+	firing  map[string]time.Time
+}
+
+type alertSample struct {
+	at      time.Time
+	success float64
+	total   float64
+}
+
+// Alert evaluates the internal metrics periodically and fires notifier events
+// when an SLO is burning, so hosts without Prometheus alerting still get paged.
+type Alert struct {
+	EvalInterval   int          `yaml:"evalInterval,omitempty" json:"evalInterval,omitempty"`
+	RepeatInterval int          `yaml:"repeatInterval,omitempty" json:"repeatInterval,omitempty"`
+	Rules          []*AlertRule `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Notifier       *Notifier    `yaml:"notifier,omitempty" json:"notifier,omitempty"`
+
+	done chan struct{}
+	// send delivers the events, it is Notifier.Notify unless replaced in tests
+	send func(NotifyEvent) error
+
+	logger *zap.SugaredLogger
+}
+
+// Provision initializes the Alert instance with required components
+func (a *Alert) Provision(ctx Context) error {
+	a.done = make(chan struct{})
+	a.logger = ctx.Logger().Sugar().Named("alert")
+
+	if a.Notifier == nil {
+		return fmt.Errorf("alert notifier is required")
+	}
+	if err := a.Notifier.Validate(); err != nil {
+		return err
+	}
+	a.send = a.Notifier.Notify
+
+	if a.EvalInterval <= 0 {
+		a.EvalInterval = 60
+	}
+	if a.RepeatInterval <= 0 {
+		a.RepeatInterval = 3600
+	}
+
+	for i, r := range a.Rules {
+		if r.Module == "" {
+			return fmt.Errorf("alert rule %d: module is required", i)
+		}
+		if r.MinSuccessRatio < 0 || r.MinSuccessRatio > 1 {
+			return fmt.Errorf("alert rule %d: minSuccessRatio must be between 0 and 1", i)
+		}
+		if r.Name == "" {
+			r.Name = r.Module
+		}
+		if r.Window <= 0 {
+			r.Window = 5 * a.EvalInterval
+		}
+		r.firing = make(map[string]time.Time)
+	}
+	return nil
+}
+
+func (a *Alert) Start() error {
+	go a.run()
+	return nil
+}
+
+func (a *Alert) Stop() error {
+	select {
+	case <-a.done:
+	default:
+		close(a.done)
+	}
+	return nil
+}
+
+func (a *Alert) run() {
+	ticker := time.NewTicker(time.Second * time.Duration(a.EvalInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.evaluate(now)
+		}
+	}
+}
+
+func (a *Alert) evaluate(now time.Time) {
+	for _, r := range a.Rules {
+		if r.MinSuccessRatio > 0 {
+			// the state is kept without enough requests in the window, so a
+			// stalled output is not resolved
+			ratio, total, ok := r.successRatio(now)
+			if ok && total >= float64(r.MinRequests) {
+				a.transition(r, alertKindSuccessRatio, ratio < r.MinSuccessRatio, now,
+					fmt.Sprintf("success ratio %.4f of %.0f requests in %ds is below %.4f", ratio, total, r.Window, r.MinSuccessRatio))
+			}
+		}
+
+		if r.MaxBacklogAge > 0 {
+			age := gaugeValue(InputBacklogAge, r.Module)
+			a.transition(r, alertKindBacklogAge, age > float64(r.MaxBacklogAge), now,
+				fmt.Sprintf("backlog age %.0fs exceeds %ds", age, r.MaxBacklogAge))
+		}
+	}
+}
+
+// transition fires an event when the rule starts burning, repeats it every
+// RepeatInterval while burning, and sends a resolved event once it recovers.
+func (a *Alert) transition(r *AlertRule, kind string, burning bool, now time.Time, message string) {
+	last, firing := r.firing[kind]
+	switch {
+	case burning && (!firing || now.Sub(last) >= time.Duration(a.RepeatInterval)*time.Second):
+		r.firing[kind] = now
+		a.notify(r, kind, message, false, now)
+	case !burning && firing:
+		delete(r.firing, kind)
+		a.notify(r, kind, "resolved", true, now)
+	}
+}
+
+func (a *Alert) notify(r *AlertRule, kind, message string, resolved bool, now time.Time) {
+	e := NotifyEvent{
+		Kind:     kind,
+		Name:     r.Name,
+		Module:   r.Module,
+		Message:  message,
+		Resolved: resolved,
+		Time:     now,
+	}
+	a.logger.Warnf("slo alert %s(%s): %s", r.Name, kind, message)
+	if err := a.send(e); err != nil {
+		a.logger.Errorf("notify slo alert %s(%s): %v", r.Name, kind, err)
+	}
+}
+
+// successRatio records a sample of the output request counters and returns
+// the ratio of successful requests within the rule window.
+func (r *AlertRule) successRatio(now time.Time) (ratio, total float64, ok bool) {
+	var s alertSample
+	s.at = now
+	for _, m := range collectMetrics(OutputRequestTotal) {
+		if labelValue(m, "module") != r.Module {
+			continue
+		}
+		v := m.GetCounter().GetValue()
+		s.total += v
+		if labelValue(m, "code") == "0" {
+			s.success += v
+		}
+	}
+
+	r.samples = append(r.samples, s)
+	begin := 0
+	for begin < len(r.samples)-1 && now.Sub(r.samples[begin].at) > time.Duration(r.Window)*time.Second {
+		begin++
+	}
+	r.samples = r.samples[begin:]
+
+	if len(r.samples) < 2 {
+		return 0, 0, false
+	}
+
+	first := r.samples[0]
+	total = s.total - first.total
+	if total <= 0 {
+		return 0, 0, false
+	}
+	return (s.success - first.success) / total, total, true
+}
+
+func gaugeValue(c prometheus.Collector, module string) float64 {
+	var v float64
+	for _, m := range collectMetrics(c) {
+		if labelValue(m, "module") == module && m.GetGauge().GetValue() > v {
+			v = m.GetGauge().GetValue()
+		}
+	}
+	return v
+}
+
+func collectMetrics(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var ms []*dto.Metric
+	for pm := range ch {
+		m := new(dto.Metric)
+		if err := pm.Write(m); err != nil {
+			continue
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package logarchive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestAlert provisions the alert with the rules, the events are recorded
+// instead of being sent.
+func newTestAlert(t *testing.T, rules ...*AlertRule) (*Alert, *[]NotifyEvent) {
+	ctx := Context{Context: context.Background(), cfg: &Config{
+		Logging: &Logging{logger: zap.NewNop()},
+	}}
+	a := &Alert{RepeatInterval: 600, Rules: rules, Notifier: &Notifier{Command: "true"}}
+	if err := a.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	events := &[]NotifyEvent{}
+	a.send = func(e NotifyEvent) error {
+		*events = append(*events, e)
+		return nil
+	}
+	return a, events
+}
+
+// addRequests adds the successful and the failed requests of the module.
+func addRequests(module string, success, failed int) {
+	OutputRequestTotal.WithLabelValues(module, "0").Add(float64(success))
+	OutputRequestTotal.WithLabelValues(module, "1").Add(float64(failed))
+}
+
+func TestAlertRuleSuccessRatio(t *testing.T) {
+	type step struct {
+		at              int
+		success, failed int
+		ratio, total    float64
+		ok              bool
+	}
+	tests := []struct {
+		name   string
+		window int
+		steps  []step
+	}{
+		{"first sample", 60, []step{
+			{at: 0, success: 5},
+		}},
+		{"ratio in the window", 60, []step{
+			{at: 0},
+			{at: 30, success: 3, failed: 1, ratio: 0.75, total: 4, ok: true},
+		}},
+		{"samples out of the window trimmed", 60, []step{
+			{at: 0},
+			{at: 30, failed: 10, ratio: 0, total: 10, ok: true},
+			{at: 90, success: 5, ratio: 1, total: 5, ok: true},
+		}},
+		{"only the last sample in the window", 60, []step{
+			{at: 0},
+			{at: 100, success: 5},
+		}},
+		{"no traffic", 60, []step{
+			{at: 0, failed: 2},
+			{at: 30},
+		}},
+	}
+
+	begin := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &AlertRule{Module: "alert_ratio_" + tt.name, Window: tt.window}
+			for _, s := range tt.steps {
+				addRequests(r.Module, s.success, s.failed)
+				ratio, total, ok := r.successRatio(begin.Add(time.Duration(s.at) * time.Second))
+				assert.Equal(t, s.ok, ok, "at %d", s.at)
+				assert.Equal(t, s.ratio, ratio, "at %d", s.at)
+				assert.Equal(t, s.total, total, "at %d", s.at)
+			}
+		})
+	}
+}
+
+func TestAlertTransition(t *testing.T) {
+	r := &AlertRule{Name: "cos", Module: "cos"}
+	a, events := newTestAlert(t, r)
+
+	tests := []struct {
+		at      int
+		burning bool
+		// event is the expected event, "fire", "resolved" or none
+		event string
+	}{
+		{0, false, ""},
+		{60, true, "fire"},
+		{120, true, ""},
+		{600, true, ""},
+		{660, true, "fire"},
+		{720, false, "resolved"},
+		{780, false, ""},
+		{840, true, "fire"},
+	}
+
+	begin := time.Now()
+	for _, tt := range tests {
+		*events = nil
+		now := begin.Add(time.Duration(tt.at) * time.Second)
+		a.transition(r, alertKindBacklogAge, tt.burning, now, "burning")
+
+		if tt.event == "" {
+			assert.Empty(t, *events, "at %d", tt.at)
+			continue
+		}
+		if assert.Len(t, *events, 1, "at %d", tt.at) {
+			e := (*events)[0]
+			assert.Equal(t, tt.event == "resolved", e.Resolved, "at %d", tt.at)
+			assert.Equal(t, alertKindBacklogAge, e.Kind)
+			assert.Equal(t, "cos", e.Name)
+			assert.Equal(t, now, e.Time)
+		}
+	}
+}
+
+func TestAlertEvaluateSuccessRatio(t *testing.T) {
+	r := &AlertRule{Module: "alert_evaluate_ratio", Window: 60, MinSuccessRatio: 0.9, MinRequests: 10}
+	a, events := newTestAlert(t, r)
+	assert.Equal(t, r.Module, r.Name)
+
+	tests := []struct {
+		name            string
+		at              int
+		success, failed int
+		event           string
+	}{
+		{"first sample", 0, 0, 0, ""},
+		{"below the min requests", 60, 0, 2, ""},
+		{"burning", 120, 0, 10, "fire"},
+		{"no traffic keeps firing", 180, 0, 0, ""},
+		{"recovered", 240, 20, 0, "resolved"},
+	}
+
+	begin := time.Now()
+	for _, tt := range tests {
+		*events = nil
+		addRequests(r.Module, tt.success, tt.failed)
+		a.evaluate(begin.Add(time.Duration(tt.at) * time.Second))
+
+		if tt.event == "" {
+			assert.Empty(t, *events, tt.name)
+			continue
+		}
+		if assert.Len(t, *events, 1, tt.name) {
+			assert.Equal(t, alertKindSuccessRatio, (*events)[0].Kind, tt.name)
+			assert.Equal(t, tt.event == "resolved", (*events)[0].Resolved, tt.name)
+		}
+	}
+}
+
+func TestAlertEvaluateBacklogAge(t *testing.T) {
+	r := &AlertRule{Module: "alert_evaluate_backlog", MaxBacklogAge: 100}
+	a, events := newTestAlert(t, r)
+
+	tests := []struct {
+		name  string
+		age   float64
+		other float64
+		event string
+	}{
+		{"below the max age", 50, 0, ""},
+		{"other modules ignored", 50, 500, ""},
+		{"exceeded", 150, 0, "fire"},
+		{"still exceeded", 200, 0, ""},
+		{"recovered", 0, 0, "resolved"},
+	}
+
+	begin := time.Now()
+	for i, tt := range tests {
+		*events = nil
+		InputBacklogAge.WithLabelValues(r.Module).Set(tt.age)
+		InputBacklogAge.WithLabelValues(r.Module + "_other").Set(tt.other)
+		a.evaluate(begin.Add(time.Duration(i) * time.Minute))
+
+		if tt.event == "" {
+			assert.Empty(t, *events, tt.name)
+			continue
+		}
+		if assert.Len(t, *events, 1, tt.name) {
+			e := (*events)[0]
+			assert.Equal(t, alertKindBacklogAge, e.Kind, tt.name)
+			assert.Equal(t, r.Module, e.Module, tt.name)
+			assert.Equal(t, tt.event == "resolved", e.Resolved, tt.name)
+			if !e.Resolved {
+				assert.Equal(t, "backlog age 150s exceeds 100s", e.Message)
+			}
+		}
+	}
+}
+
+func TestAlertProvision(t *testing.T) {
+	ctx := Context{Context: context.Background(), cfg: &Config{
+		Logging: &Logging{logger: zap.NewNop()},
+	}}
+	notifier := &Notifier{Command: "true"}
+	for _, a := range []*Alert{
+		{},
+		{Notifier: &Notifier{}},
+		{Notifier: notifier, Rules: []*AlertRule{{}}},
+		{Notifier: notifier, Rules: []*AlertRule{{Module: "cos", MinSuccessRatio: 1.5}}},
+	} {
+		assert.Error(t, a.Provision(ctx))
+	}
+
+	a := &Alert{Notifier: notifier, Rules: []*AlertRule{{Module: "cos"}}}
+	if assert.NoError(t, a.Provision(ctx)) {
+		assert.Equal(t, 60, a.EvalInterval)
+		assert.Equal(t, 3600, a.RepeatInterval)
+		assert.Equal(t, "cos", a.Rules[0].Name)
+		assert.Equal(t, 300, a.Rules[0].Window)
+	}
+}
@@ -0,0 +1,98 @@
+package logarchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// The actions recorded by the audit log.
+const (
+	AuditActionDelete = "delete"
+	AuditActionShred  = "shred"
+)
+
+// AuditRecord is a line of the audit log, it records a destructive action on
+// a file of the archives.
+type AuditRecord struct {
+	Time    time.Time `yaml:"time" json:"time"`
+	Action  string    `yaml:"action" json:"action"`
+	Archive string    `yaml:"archive" json:"archive"`
+	Path    string    `yaml:"path" json:"path"`
+	Size    int64     `yaml:"size" json:"size"`
+	// Checksum is the sha256 of the file before the action
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
+	// Destination is where the file has been uploaded
+	Destination string `yaml:"destination,omitempty" json:"destination,omitempty"`
+	Error       string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// Audit is an append-only log of the destructive actions, e.g. the deletion of
+// the source files after uploading. The records are written as JSON lines into
+// Path, which is rotated by its own policy apart from the log of the daemon.
+type Audit struct {
+	Path     string `yaml:"path,omitempty" json:"path,omitempty"`
+	RollSize int    `yaml:"rollSize,omitempty" json:"rollSize,omitempty"`
+	RollKeep int    `yaml:"rollKeep,omitempty" json:"rollKeep,omitempty"`
+
+	mu     sync.Mutex
+	writer io.WriteCloser
+}
+
+// Provision initializes the Audit instance with required components
+func (a *Audit) Provision(_ Context) error {
+	if a.Path == "" {
+		return fmt.Errorf("audit path is required")
+	}
+	if a.RollSize < 0 || a.RollKeep < 0 {
+		return fmt.Errorf("invalid audit rollSize: %d or rollKeep: %d", a.RollSize, a.RollKeep)
+	}
+
+	// the file is opened in append mode by the first record
+	a.writer = &lumberjack.Logger{
+		Filename:   a.Path,
+		MaxSize:    a.RollSize,
+		MaxBackups: a.RollKeep,
+		LocalTime:  true,
+	}
+	return nil
+}
+
+func (a *Audit) Stop() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.writer.Close()
+}
+
+// Audit returns the audit log, it is nil when the audit log is disabled.
+func (ctx Context) Audit() *Audit {
+	if ctx.cfg == nil {
+		return nil
+	}
+	return ctx.cfg.Audit
+}
+
+// Record appends the record to the audit log.
+func (a *Audit) Record(r AuditRecord) error {
+	if a == nil {
+		return nil
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.writer.Write(data)
+	return err
+}
@@ -0,0 +1,147 @@
+package logarchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Pauser is implemented by the archives which could stop uploading temporarily,
+// e.g. during the maintenance of the output. The files are still collected while
+// paused, and uploaded after resumed.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+var (
+	// controlMu serializes the control of the running logarchive
+	controlMu sync.Mutex
+	// logarchiveCfg is the configuration of the running logarchive, it is
+	// started again if reloading fails
+	logarchiveCfg []byte
+	// paused is kept across reloading
+	paused bool
+)
+
+// Pause pauses the uploads of all archives.
+func Pause() error {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if logarchiveCtx.cfg == nil {
+		return fmt.Errorf("logarchive is not running")
+	}
+	paused = true
+	setPaused(logarchiveCtx, true)
+	logarchiveCtx.Logger().Sugar().Info("logarchive paused")
+	return nil
+}
+
+// Resume resumes the uploads of all archives.
+func Resume() error {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if logarchiveCtx.cfg == nil {
+		return fmt.Errorf("logarchive is not running")
+	}
+	paused = false
+	setPaused(logarchiveCtx, false)
+	logarchiveCtx.Logger().Sugar().Info("logarchive resumed")
+	return nil
+}
+
+// Reload replaces the running logarchive with the configuration. The configuration
+// is validated before the running one is stopped, and the running one is started
+// again if the new one fails to start.
+func Reload(cfg []byte) error {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if logarchiveCtx.cfg == nil {
+		return fmt.Errorf("logarchive is not running")
+	}
+
+	if report := Validate(cfg); report.Failed() != 0 {
+		return fmt.Errorf("invalid configuration: %s", validateErrors(report))
+	}
+
+	logarchiveCtx.Logger().Sugar().Info("logarchive reloading")
+	if err := shutdown(logarchiveCtx); err != nil {
+		logarchiveCtx.Logger().Sugar().Errorf("logarchive shutdown: %v", err)
+	}
+	logarchiveCtx = Context{}
+
+	err := start(cfg)
+	if err == nil {
+		logarchiveCtx.Logger().Sugar().Info("logarchive reloaded")
+		return nil
+	}
+
+	if rollbackErr := start(logarchiveCfg); rollbackErr != nil {
+		return fmt.Errorf("%v; additionally, start previous configuration: %v", err, rollbackErr)
+	}
+	return fmt.Errorf("%v; previous configuration is restored", err)
+}
+
+// start runs the configuration as the running logarchive.
+func start(cfg []byte) error {
+	newCfg := new(Config)
+	if err := json.Unmarshal(cfg, newCfg); err != nil {
+		return err
+	}
+
+	ctx, err := run(newCfg)
+	if err != nil {
+		return err
+	}
+
+	logarchiveCtx = ctx
+	logarchiveCfg = cfg
+	if paused {
+		setPaused(ctx, true)
+	}
+	return nil
+}
+
+func setPaused(ctx Context, pause bool) {
+	for _, ar := range ctx.cfg.archives {
+		p, ok := ar.(Pauser)
+		if !ok {
+			continue
+		}
+		if pause {
+			p.Pause()
+		} else {
+			p.Resume()
+		}
+	}
+}
+
+func validateErrors(report *ValidateReport) string {
+	var errs []string
+	for _, res := range report.Results {
+		if res.Error == "" {
+			continue
+		}
+		if res.Name != "" {
+			errs = append(errs, fmt.Sprintf("%s %s: %s", res.Component, res.Name, res.Error))
+		} else {
+			errs = append(errs, fmt.Sprintf("%s: %s", res.Component, res.Error))
+		}
+	}
+	return strings.Join(errs, "; ")
+}
+
+// Paused reports whether the uploads are paused.
+func Paused() (bool, error) {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
+	if logarchiveCtx.cfg == nil {
+		return false, fmt.Errorf("logarchive is not running")
+	}
+	return paused, nil
+}
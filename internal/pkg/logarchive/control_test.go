@@ -0,0 +1,64 @@
+package logarchive_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestReloadKeepsPaused(t *testing.T) {
+	assert.ErrorContains(t, logarchive.Pause(), "not running")
+
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(logs, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	startConfig(t, "file", dir)
+	for len(fakeTasks) != 0 {
+		<-fakeTasks
+	}
+
+	data, err := os.ReadFile(filepath.Join("testdata", "config", "file.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := []byte(strings.ReplaceAll(string(data), "$TESTDIR", filepath.ToSlash(dir)))
+
+	assert.NoError(t, logarchive.Pause())
+
+	// the running archives are kept if the configuration is invalid
+	loaded := logarchive.LoadedArchives()["file"]
+	err = logarchive.Reload([]byte(strings.ReplaceAll(string(cfg), "/logs", "/none")))
+	assert.ErrorContains(t, err, "invalid configuration: archive file:")
+	assert.Same(t, loaded, logarchive.LoadedArchives()["file"])
+
+	if !assert.NoError(t, logarchive.Reload(cfg)) {
+		return
+	}
+	assert.NotSame(t, loaded, logarchive.LoadedArchives()["file"])
+
+	// the reloaded archives are still paused
+	if err := os.WriteFile(filepath.Join(logs, "app.log"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case task := <-fakeTasks:
+		t.Fatalf("unexpected task while paused: %+v", task)
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	assert.NoError(t, logarchive.Resume())
+	select {
+	case task := <-fakeTasks:
+		assert.Equal(t, filepath.Join(logs, "app.log"), task.FilePath)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no file has been collected after resumed")
+	}
+}
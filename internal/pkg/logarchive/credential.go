@@ -0,0 +1,74 @@
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// credentialRefreshWindow is how long before the expiration the credential is
+// refreshed, at most half of the lifetime of the credential.
+const credentialRefreshWindow = 5 * time.Minute
+
+// credentialRetryInterval is how long to wait before refreshing again after a failure.
+const credentialRetryInterval = 10 * time.Second
+
+// Credential is the access key of the cloud services.
+type Credential struct {
+	SecretID     string
+	SecretKey    string
+	SessionToken string
+	// Expiration is zero when the credential never expires
+	Expiration time.Time
+}
+
+// CredentialProvider is implemented by the credential modules, e.g. reading the
+// credential from the environment variables or the instance metadata.
+type CredentialProvider interface {
+	Credential(ctx context.Context) (*Credential, error)
+}
+
+// CredentialCache caches the credential of the provider for the outputs, and
+// refreshes it before it expires.
+type CredentialCache struct {
+	provider CredentialProvider
+
+	mu        sync.Mutex
+	cred      *Credential
+	refreshAt time.Time
+}
+
+// NewCredentialCache returns the cache of the provider.
+func NewCredentialCache(provider CredentialProvider) *CredentialCache {
+	return &CredentialCache{provider: provider}
+}
+
+// Get returns the cached credential, the credential is refreshed when it is
+// about to expire. The cached credential is still used if the refresh fails
+// before it expires.
+func (c *CredentialCache) Get(ctx context.Context) (*Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if c.cred != nil && (c.cred.Expiration.IsZero() || (now.Before(c.refreshAt) && now.Before(c.cred.Expiration))) {
+		return c.cred, nil
+	}
+
+	cred, err := c.provider.Credential(ctx)
+	if err == nil && (cred == nil || cred.SecretID == "" || cred.SecretKey == "") {
+		err = fmt.Errorf("empty credential")
+	}
+	if err != nil {
+		if c.cred != nil && now.Before(c.cred.Expiration) {
+			c.refreshAt = now.Add(credentialRetryInterval)
+			return c.cred, nil
+		}
+		return nil, err
+	}
+
+	c.cred = cred
+	c.refreshAt = cred.Expiration.Add(-min(credentialRefreshWindow, cred.Expiration.Sub(now)/2))
+	return cred, nil
+}
@@ -0,0 +1,69 @@
+package logarchive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCredentialProvider struct {
+	creds []*Credential
+	err   error
+	calls int
+}
+
+func (p *testCredentialProvider) Credential(_ context.Context) (*Credential, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	cred := p.creds[0]
+	p.creds = p.creds[1:]
+	return cred, nil
+}
+
+func TestCredentialCache(t *testing.T) {
+	now := time.Now()
+	p := &testCredentialProvider{creds: []*Credential{
+		{SecretID: "id1", SecretKey: "key1", Expiration: now.Add(time.Hour)},
+		{SecretID: "id2", SecretKey: "key2", Expiration: now.Add(2 * time.Minute)},
+		{SecretID: "id3", SecretKey: "key3", Expiration: now.Add(time.Hour)},
+	}}
+	c := NewCredentialCache(p)
+
+	cred, err := c.Get(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id1", cred.SecretID)
+	}
+	cred, _ = c.Get(context.Background())
+	assert.Equal(t, "id1", cred.SecretID)
+	assert.Equal(t, 1, p.calls)
+
+	// refreshed before it expires
+	c.refreshAt = now
+	cred, _ = c.Get(context.Background())
+	assert.Equal(t, "id2", cred.SecretID)
+	// the credential with short lifetime is refreshed at the half of it
+	assert.WithinDuration(t, now.Add(time.Minute), c.refreshAt, time.Second)
+
+	// the cached credential is used until it expires if the refresh fails
+	c.refreshAt = now
+	p.err = errors.New("unavailable")
+	cred, err = c.Get(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id2", cred.SecretID)
+	}
+	c.cred.Expiration = now
+	_, err = c.Get(context.Background())
+	assert.ErrorContains(t, err, "unavailable")
+
+	p.err = nil
+	cred, _ = c.Get(context.Background())
+	assert.Equal(t, "id3", cred.SecretID)
+
+	_, err = NewCredentialCache(&testCredentialProvider{creds: []*Credential{{SecretID: "id"}}}).Get(context.Background())
+	assert.ErrorContains(t, err, "empty credential")
+}
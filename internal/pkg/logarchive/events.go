@@ -0,0 +1,151 @@
+package logarchive
+
+import (
+	"sync"
+	"time"
+)
+
+// The kinds of the events published by the archives.
+const (
+	EventFileDiscovered  = "file_discovered"
+	EventUploadStarted   = "upload_started"
+	EventUploadSucceeded = "upload_succeeded"
+	EventUploadFailed    = "upload_failed"
+	EventFileDeleted     = "file_deleted"
+)
+
+// eventBufferSize is the number of events buffered for each subscriber, the
+// events are dropped when the subscriber falls behind.
+const eventBufferSize = 1024
+
+var eventKinds = map[string]struct{}{
+	EventFileDiscovered:  {},
+	EventUploadStarted:   {},
+	EventUploadSucceeded: {},
+	EventUploadFailed:    {},
+	EventFileDeleted:     {},
+}
+
+// Event is a structured event of a file handled by an archive.
+type Event struct {
+	Kind    string    `yaml:"kind" json:"kind"`
+	Archive string    `yaml:"archive" json:"archive"`
+	File    string    `yaml:"file" json:"file"`
+	Error   string    `yaml:"error,omitempty" json:"error,omitempty"`
+	Time    time.Time `yaml:"time" json:"time"`
+}
+
+// EventHandler handles the events of a subscription.
+type EventHandler func(Event)
+
+type eventSubscriber struct {
+	kinds   map[string]struct{}
+	events  chan Event
+	handler EventHandler
+}
+
+// EventBus delivers the events published by the archives to the subscribers.
+// Each subscriber runs its handler in its own goroutine, so that a slow
+// handler does not block the archives nor the other subscribers.
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+func newEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Events returns the event bus of the running configuration.
+func (ctx Context) Events() *EventBus {
+	if ctx.cfg == nil {
+		return nil
+	}
+	return ctx.cfg.events
+}
+
+// Subscribe calls the handler with the events of the kinds, or all events when
+// no kind is given. The returned function cancels the subscription.
+func (b *EventBus) Subscribe(handler EventHandler, kinds ...string) func() {
+	if b == nil {
+		return func() {}
+	}
+
+	s := &eventSubscriber{
+		events:  make(chan Event, eventBufferSize),
+		handler: handler,
+	}
+	if len(kinds) != 0 {
+		s.kinds = make(map[string]struct{}, len(kinds))
+		for _, kind := range kinds {
+			s.kinds[kind] = struct{}{}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return func() {}
+	}
+	b.subscribers[s] = struct{}{}
+	go s.run()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[s]; ok {
+			delete(b.subscribers, s)
+			close(s.events)
+		}
+	}
+}
+
+// Publish sends the event to the subscribers, it never blocks.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for s := range b.subscribers {
+		if s.kinds != nil {
+			if _, ok := s.kinds[e.Kind]; !ok {
+				continue
+			}
+		}
+		select {
+		case s.events <- e:
+		default:
+			EventDroppedTotal.WithLabelValues(e.Kind).Inc()
+		}
+	}
+}
+
+// Close cancels all subscriptions, the events published later are ignored.
+func (b *EventBus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for s := range b.subscribers {
+		close(s.events)
+	}
+	b.subscribers = nil
+}
+
+func (s *eventSubscriber) run() {
+	for e := range s.events {
+		s.handler(e)
+	}
+}
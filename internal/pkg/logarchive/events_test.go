@@ -0,0 +1,102 @@
+package logarchive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestEventBusSubscribe(t *testing.T) {
+	bus := newEventBus()
+	defer bus.Close()
+
+	failed := make(chan Event, 10)
+	all := make(chan Event, 10)
+	bus.Subscribe(func(e Event) { failed <- e }, EventUploadFailed)
+	unsubscribe := bus.Subscribe(func(e Event) { all <- e })
+
+	bus.Publish(Event{Kind: EventUploadStarted, Archive: "file", File: "a.log"})
+	bus.Publish(Event{Kind: EventUploadFailed, Archive: "file", File: "a.log", Error: "timeout"})
+
+	select {
+	case e := <-failed:
+		assert.Equal(t, EventUploadFailed, e.Kind)
+		assert.Equal(t, "timeout", e.Error)
+		assert.False(t, e.Time.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("upload failed event is not received")
+	}
+
+	for _, kind := range []string{EventUploadStarted, EventUploadFailed} {
+		select {
+		case e := <-all:
+			assert.Equal(t, kind, e.Kind)
+		case <-time.After(time.Second):
+			t.Fatalf("event: %s is not received", kind)
+		}
+	}
+
+	unsubscribe()
+	bus.Publish(Event{Kind: EventFileDeleted, Archive: "file", File: "a.log"})
+	select {
+	case e := <-all:
+		t.Fatalf("unexpected event after unsubscribe: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// publishing to a closed or missing bus is ignored
+	bus.Close()
+	bus.Publish(Event{Kind: EventFileDeleted})
+	var nilBus *EventBus
+	nilBus.Publish(Event{Kind: EventFileDeleted})
+	nilBus.Subscribe(func(Event) {})()
+}
+
+func TestHookProvision(t *testing.T) {
+	ctx := Context{Context: context.Background(), cfg: &Config{
+		Logging: &Logging{logger: zap.NewNop()},
+		events:  newEventBus(),
+	}}
+	defer ctx.cfg.events.Close()
+
+	notifier := &Notifier{Command: "true"}
+	for _, h := range []*Hook{
+		{Notifier: notifier},
+		{Events: []string{"upload_lost"}, Notifier: notifier},
+		{Events: []string{EventUploadFailed}},
+		{Events: []string{EventUploadFailed}, Count: -1, Notifier: notifier},
+	} {
+		assert.Error(t, h.Provision(ctx))
+	}
+
+	h := &Hook{Events: []string{EventUploadFailed}, Count: 3, Notifier: notifier}
+	if assert.NoError(t, h.Provision(ctx)) {
+		assert.Equal(t, EventUploadFailed, h.Name)
+		assert.Equal(t, 300, h.Window)
+		assert.NoError(t, h.Stop())
+	}
+}
+
+func TestHookMatch(t *testing.T) {
+	h := &Hook{Archives: []string{"file"}, Count: 3, Window: 60}
+	h.archives = map[string]struct{}{"file": {}}
+
+	now := time.Now()
+	failed := func(archive string, at time.Duration) Event {
+		return Event{Kind: EventUploadFailed, Archive: archive, Time: now.Add(at)}
+	}
+
+	assert.False(t, h.match(failed("file", 0)))
+	assert.False(t, h.match(failed("exec", time.Second)))
+	assert.False(t, h.match(failed("file", 30*time.Second)))
+	// the first failure is out of the window
+	assert.False(t, h.match(failed("file", 61*time.Second)))
+	assert.True(t, h.match(failed("file", 62*time.Second)))
+	// fires again only after another 3 failures
+	assert.False(t, h.match(failed("file", 63*time.Second)))
+	assert.False(t, h.match(failed("file", 64*time.Second)))
+	assert.True(t, h.match(failed("file", 65*time.Second)))
+}
@@ -0,0 +1,9 @@
+package logarchive
+
+// LoadedArchives returns the archives loaded by Start.
+func LoadedArchives() map[string]Archive {
+	if logarchiveCtx.cfg == nil {
+		return nil
+	}
+	return logarchiveCtx.cfg.archives
+}
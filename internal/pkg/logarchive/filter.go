@@ -0,0 +1,54 @@
+package logarchive
+
+import (
+	"errors"
+	"io"
+)
+
+// Filter is implemented by the filter modules, which transform the content of
+// the files between the collection and the output, e.g. masking the personal
+// data which must not be uploaded.
+type Filter interface {
+	// Filter reads the content from r and writes the transformed content into w.
+	Filter(w io.Writer, r io.Reader) error
+}
+
+// ApplyFilters transforms the content from r by the filters in order and writes
+// the result into w, each filter reads the output of the previous one by a pipe.
+func ApplyFilters(filters []Filter, w io.Writer, r io.Reader) error {
+	if len(filters) == 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	errs := make(chan error, len(filters)-1)
+	for _, f := range filters[:len(filters)-1] {
+		pr, pw := io.Pipe()
+		go func(f Filter, src io.Reader) {
+			err := f.Filter(pw, src)
+			pw.CloseWithError(err)
+			closePipe(src)
+			errs <- err
+		}(f, r)
+		r = pr
+	}
+
+	err := filters[len(filters)-1].Filter(w, r)
+	// the previous filters are stopped if the last one does not read all
+	closePipe(r)
+	for i := 0; i < len(filters)-1; i++ {
+		// a filter stopped by the closed pipe is not a failure
+		if err2 := <-errs; err == nil && err2 != nil && !errors.Is(err2, io.ErrClosedPipe) {
+			err = err2
+		}
+	}
+	return err
+}
+
+// closePipe closes the reader of the pipe, so that the writer of the pipe
+// fails instead of being blocked.
+func closePipe(r io.Reader) {
+	if pr, ok := r.(*io.PipeReader); ok {
+		pr.Close()
+	}
+}
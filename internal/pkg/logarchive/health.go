@@ -0,0 +1,72 @@
+package logarchive
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// HealthChecker is implemented by the modules which could fail while running,
+// the failed module should be restarted, it is reported by /healthz.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// ReadyChecker is implemented by the modules which could be temporarily unable
+// to archive files, e.g. the output is unreachable, it is reported by /readyz.
+type ReadyChecker interface {
+	Ready() error
+}
+
+// healthHandler reports the checks of the archives in the format of the
+// Kubernetes components, the status is 503 if any of the checks fails.
+func (m *Metric) healthHandler(check func(ar Archive) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var archives map[string]Archive
+		if m.ctx.cfg != nil {
+			archives = m.ctx.cfg.archives
+		}
+
+		names := make([]string, 0, len(archives))
+		for name := range archives {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var b strings.Builder
+		failed := false
+		for _, name := range names {
+			if err := check(archives[name]); err != nil {
+				failed = true
+				fmt.Fprintf(&b, "[-]%s failed: %v\n", name, err)
+			} else {
+				fmt.Fprintf(&b, "[+]%s ok\n", name)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			b.WriteString("check failed\n")
+		} else {
+			b.WriteString("ok\n")
+		}
+		_, _ = w.Write([]byte(b.String()))
+	})
+}
+
+func checkHealthy(ar Archive) error {
+	if hc, ok := ar.(HealthChecker); ok {
+		return hc.Healthy()
+	}
+	return nil
+}
+
+func checkReady(ar Archive) error {
+	if rc, ok := ar.(ReadyChecker); ok {
+		return rc.Ready()
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package logarchive
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Hook runs the notifier on the selected events of the archives. With Count
+// greater than 1, the notifier runs once the events have happened Count times
+// within Window seconds, e.g. to page on repeated upload failures.
+type Hook struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Events are the kinds of the events, e.g. "upload_failed"
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+	// Archives are the names of the archives, all archives by default
+	Archives []string  `yaml:"archives,omitempty" json:"archives,omitempty"`
+	Count    int       `yaml:"count,omitempty" json:"count,omitempty"`
+	Window   int       `yaml:"window,omitempty" json:"window,omitempty"`
+	Notifier *Notifier `yaml:"notifier,omitempty" json:"notifier,omitempty"`
+
+	archives map[string]struct{}
+	// recent is only accessed by the goroutine of the subscription
+	recent []time.Time
+
+	unsubscribe func()
+
+	logger *zap.SugaredLogger
+}
+
+// Provision initializes the Hook instance with required components
+func (h *Hook) Provision(ctx Context) error {
+	h.logger = ctx.Logger().Sugar().Named("hook")
+
+	if len(h.Events) == 0 {
+		return fmt.Errorf("hook events are required")
+	}
+	for _, kind := range h.Events {
+		if _, ok := eventKinds[kind]; !ok {
+			return fmt.Errorf("unknown hook event: %s", kind)
+		}
+	}
+
+	if h.Notifier == nil {
+		return fmt.Errorf("hook notifier is required")
+	}
+	if err := h.Notifier.Validate(); err != nil {
+		return err
+	}
+
+	if h.Count < 0 || h.Window < 0 {
+		return fmt.Errorf("invalid hook count: %d or window: %d", h.Count, h.Window)
+	}
+	if h.Count == 0 {
+		h.Count = 1
+	}
+	if h.Count > 1 && h.Window == 0 {
+		h.Window = 300
+	}
+	if h.Name == "" {
+		h.Name = h.Events[0]
+	}
+
+	if len(h.Archives) != 0 {
+		h.archives = make(map[string]struct{}, len(h.Archives))
+		for _, name := range h.Archives {
+			h.archives[name] = struct{}{}
+		}
+	}
+
+	h.unsubscribe = ctx.Events().Subscribe(h.handle, h.Events...)
+	return nil
+}
+
+// Stop cancels the subscription of the hook.
+func (h *Hook) Stop() error {
+	if h.unsubscribe != nil {
+		h.unsubscribe()
+	}
+	return nil
+}
+
+func (h *Hook) handle(e Event) {
+	if !h.match(e) {
+		return
+	}
+
+	message := e.Error
+	if h.Count > 1 {
+		message = fmt.Sprintf("%s happened %d times in %ds, last: %s %s", e.Kind, h.Count, h.Window, e.File, e.Error)
+	}
+
+	h.logger.Infof("hook %s(%s): %s", h.Name, e.Kind, message)
+	err := h.Notifier.Notify(NotifyEvent{
+		Kind:    e.Kind,
+		Name:    h.Name,
+		Module:  e.Archive,
+		Message: message,
+		Labels:  map[string]string{"file": e.File},
+		Time:    e.Time,
+	})
+	if err != nil {
+		h.logger.Errorf("notify hook %s(%s): %v", h.Name, e.Kind, err)
+	}
+}
+
+// match reports whether the event triggers the hook. The recent events are
+// cleared after the hook has been triggered, so it fires again only after
+// another Count events.
+func (h *Hook) match(e Event) bool {
+	if h.archives != nil {
+		if _, ok := h.archives[e.Archive]; !ok {
+			return false
+		}
+	}
+	if h.Count <= 1 {
+		return true
+	}
+
+	begin := 0
+	for begin < len(h.recent) && e.Time.Sub(h.recent[begin]) > time.Duration(h.Window)*time.Second {
+		begin++
+	}
+	h.recent = append(h.recent[begin:], e.Time)
+
+	if len(h.recent) < h.Count {
+		return false
+	}
+	h.recent = h.recent[:0]
+	return true
+}
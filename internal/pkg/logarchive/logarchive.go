@@ -2,7 +2,6 @@ package logarchive
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 )
 
@@ -12,29 +11,36 @@ type Config struct {
 
 	Metric *Metric `yaml:"metric,omitempty" json:"metric,omitempty"`
 
+	Alert *Alert `yaml:"alert,omitempty" json:"alert,omitempty"`
+
+	Quota *Quota `yaml:"quota,omitempty" json:"quota,omitempty"`
+
+	Hooks []*Hook `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+
+	Audit *Audit `yaml:"audit,omitempty" json:"audit,omitempty"`
+
 	ArchivesRaw ModuleMap `yaml:"archives,omitempty" json:"archives,omitempty"`
 
+	// AllowOverlap starts the archives even if their watched paths overlap
+	AllowOverlap bool `yaml:"allowOverlap,omitempty" json:"allowOverlap,omitempty"`
+
+	// DryRun logs the files which would be uploaded instead of uploading them,
+	// and the source files are never deleted
+	DryRun bool `yaml:"dryRun,omitempty" json:"dryRun,omitempty"`
+
 	archives map[string]Archive
+	events   *EventBus
+	memory   *MemoryBudget
 
 	cancelFunc context.CancelFunc
 }
 
 // Start start the logarchive.
 func Start(cfg []byte) error {
-	var err error
-
-	newCfg := new(Config)
-	if err := json.Unmarshal(cfg, newCfg); err != nil {
-		return err
-	}
-
-	ctx, err := run(newCfg)
-	if err != nil {
-		return err
-	}
+	controlMu.Lock()
+	defer controlMu.Unlock()
 
-	logarchiveCtx = ctx
-	return nil
+	return start(cfg)
 }
 
 func run(newCfg *Config) (Context, error) {
@@ -46,9 +52,11 @@ func run(newCfg *Config) (Context, error) {
 			// if there were any errors during startup,
 			// we should cancel the new context we created
 			cancel()
+			newCfg.events.Close()
 		}
 	}()
 	newCfg.cancelFunc = cancel
+	newCfg.events = newEventBus()
 
 	if newCfg.Logging != nil {
 		if err := newCfg.Logging.Provision(ctx); err != nil {
@@ -62,6 +70,37 @@ func run(newCfg *Config) (Context, error) {
 		}
 	}
 
+	if newCfg.Alert != nil {
+		if err := newCfg.Alert.Provision(ctx); err != nil {
+			return ctx, err
+		}
+	}
+
+	if newCfg.Quota != nil {
+		if err := newCfg.Quota.Provision(ctx); err != nil {
+			return ctx, err
+		}
+	}
+
+	if newCfg.Audit != nil {
+		if err := newCfg.Audit.Provision(ctx); err != nil {
+			return ctx, err
+		}
+	}
+
+	compressMemory := int64(defaultCompressMemory)
+	if newCfg.Quota != nil && newCfg.Quota.CompressMemory > 0 {
+		compressMemory = newCfg.Quota.CompressMemory
+	}
+	newCfg.memory = NewMemoryBudget(compressMemory)
+
+	for i, h := range newCfg.Hooks {
+		if err = h.Provision(ctx); err != nil {
+			err = fmt.Errorf("hook %d: %v", i, err)
+			return ctx, err
+		}
+	}
+
 	newCfg.archives = make(map[string]Archive)
 
 	// load archives
@@ -77,6 +116,23 @@ func run(newCfg *Config) (Context, error) {
 		return ctx, err
 	}
 
+	if !newCfg.AllowOverlap {
+		if err = checkPathOverlap(newCfg.archives); err != nil {
+			return ctx, err
+		}
+	}
+
+	// start quota before archives, which wait for the bandwidth
+	if newCfg.Quota != nil {
+		if err = newCfg.Quota.Start(); err != nil {
+			return ctx, err
+		}
+	}
+
+	if newCfg.DryRun {
+		ctx.Logger().Sugar().Warn("logarchive runs in dry run mode, files are not uploaded or deleted")
+	}
+
 	// start archives
 	err = func() error {
 		started := make([]string, 0, len(newCfg.archives))
@@ -96,14 +152,22 @@ func run(newCfg *Config) (Context, error) {
 	}()
 
 	// start record metric
-	if newCfg.Metric != nil {
+	if err == nil && newCfg.Metric != nil {
 		err = newCfg.Metric.Start()
 	}
+
+	// start evaluate slo alert
+	if err == nil && newCfg.Alert != nil {
+		err = newCfg.Alert.Start()
+	}
 	return ctx, err
 }
 
 // Stop stop the logarchive.
 func Stop() error {
+	controlMu.Lock()
+	defer controlMu.Unlock()
+
 	logarchiveCtx.Logger().Sugar().Error("logarchive shutdown")
 
 	if err := shutdown(logarchiveCtx); err != nil {
@@ -112,6 +176,8 @@ func Stop() error {
 	}
 
 	logarchiveCtx = Context{}
+	logarchiveCfg = nil
+	paused = false
 	return nil
 }
 
@@ -128,6 +194,13 @@ func shutdown(ctx Context) error {
 		}
 	}
 
+	// stop alert
+	if ctx.cfg.Alert != nil {
+		if err2 := ctx.cfg.Alert.Stop(); err2 != nil {
+			err = fmt.Errorf("%v; stop alert: %v", err, err2)
+		}
+	}
+
 	// stop archives
 	for _, s := range ctx.cfg.archives {
 		if err2 := s.Stop(); err2 != nil {
@@ -135,10 +208,38 @@ func shutdown(ctx Context) error {
 		}
 	}
 
+	// stop quota
+	if ctx.cfg.Quota != nil {
+		if err2 := ctx.cfg.Quota.Stop(); err2 != nil {
+			err = fmt.Errorf("%v; stop quota: %v", err, err2)
+		}
+	}
+
+	// stop hooks after archives, which publish events until stopped
+	for _, h := range ctx.cfg.Hooks {
+		if err2 := h.Stop(); err2 != nil {
+			err = fmt.Errorf("%v; stop hook: %v", err, err2)
+		}
+	}
+	ctx.cfg.events.Close()
+
+	// stop audit after archives, which record until stopped
+	if ctx.cfg.Audit != nil {
+		if err2 := ctx.cfg.Audit.Stop(); err2 != nil {
+			err = fmt.Errorf("%v; stop audit: %v", err, err2)
+		}
+	}
+
 	ctx.cfg.cancelFunc()
 	return err
 }
 
+// DryRun reports whether the running configuration is in dry run mode, the
+// outputs should not upload and the archives should not delete any file.
+func (ctx Context) DryRun() bool {
+	return ctx.cfg != nil && ctx.cfg.DryRun
+}
+
 // Archive is an interface that defines the basic operations for file archives.
 // Implementations should provide Start and Stop methods to manage the archive lifecycle.
 type Archive interface {
@@ -152,6 +253,12 @@ type OutputTask interface {
 	TaskInfo() OutputTaskInfo
 }
 
+// OutputDestination is implemented by the output tasks which tell where the
+// file has been uploaded after the task is executed.
+type OutputDestination interface {
+	Destination() string
+}
+
 // OutputTaskInfo defines the structure containing information about an output task.
 // It provides a factory function to create new instances of OutputTask.
 type OutputTaskInfo struct {
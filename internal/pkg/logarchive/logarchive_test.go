@@ -0,0 +1,227 @@
+package logarchive_test
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/cos"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/execarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+	_ "github.com/atframework/atdtool/internal/pkg/logarchive/modules/syslogarchive"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// fakeOutput records the tasks instead of uploading the files.
+type fakeOutput struct{}
+
+var fakeTasks = make(chan *cos.Task, 100)
+
+func (fakeOutput) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "output.fake",
+		New: func() logarchive.Module {
+			return new(fakeOutput)
+		},
+	}
+}
+
+func (fakeOutput) TaskInfo() logarchive.OutputTaskInfo {
+	return cos.Task{}.TaskInfo()
+}
+
+func (fakeOutput) Execute(task logarchive.OutputTask) error {
+	fakeTasks <- task.(*cos.Task)
+	return nil
+}
+
+// startConfig starts the logarchive with the config in testdata, $TESTDIR in
+// the config is replaced by dir.
+func startConfig(t *testing.T, name, dir string) {
+	startConfigWith(t, name, "$TESTDIR", filepath.ToSlash(dir))
+}
+
+// startConfigWith starts the logarchive with the config in testdata, the
+// variables in the config are replaced by the old, new string pairs.
+func startConfigWith(t *testing.T, name string, oldnew ...string) {
+	data, err := os.ReadFile(filepath.Join("testdata", "config", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logarchive.RegisterModuleForTest(fakeOutput{})
+	t.Cleanup(logarchive.ResetModulesForTest)
+
+	cfg := strings.NewReplacer(oldnew...).Replace(string(data))
+	if err := logarchive.Start([]byte(cfg)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, logarchive.Stop())
+	})
+}
+
+func TestStartGoldenConfig(t *testing.T) {
+	for _, name := range []string{"file", "file_poll", "exec", "syslog"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "logs"), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			startConfig(t, name, dir)
+
+			got, err := json.MarshalIndent(logarchive.LoadedArchives(), "", "  ")
+			if !assert.NoError(t, err) {
+				return
+			}
+			got = []byte(strings.ReplaceAll(string(got), filepath.ToSlash(dir), "$TESTDIR") + "\n")
+
+			golden := filepath.Join("testdata", "config", name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if assert.NoError(t, err) {
+				assert.Equal(t, string(want), string(got))
+			}
+		})
+	}
+}
+
+func TestStartCollectMode(t *testing.T) {
+	logarchive.RegisterModuleForTest(fakeOutput{})
+	t.Cleanup(logarchive.ResetModulesForTest)
+
+	tests := []struct {
+		mode         string
+		scanInterval int
+		wantMode     filearchive.CollectMode
+		wantInterval int
+		err          string
+	}{
+		{"", 0, filearchive.CollectModeNotify, 0, ""},
+		{"notify", 0, filearchive.CollectModeNotify, 0, ""},
+		{"poll", 0, filearchive.CollectModePoll, 10, ""},
+		{"poll", -1, filearchive.CollectModePoll, 10, ""},
+		{"poll", 30, filearchive.CollectModePoll, 30, ""},
+		{"inotify", 0, "", 0, "unsupport collect mode: inotify"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			dir := filepath.ToSlash(t.TempDir())
+			err := logarchive.Start([]byte(fmt.Sprintf(`{
+  "log": {"level": "error"},
+  "archives": {
+    "file": {
+      "paths": [%q],
+      "collectMode": %q,
+      "scanInterval": %d,
+      "collectRule": {"keepSourceFile": true},
+      "output": {"type": "fake"}
+    }
+  }
+}`, dir, tt.mode, tt.scanInterval)))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, logarchive.Stop())
+			}()
+
+			if ar, ok := logarchive.LoadedArchives()["file"].(*filearchive.Archive); assert.True(t, ok) {
+				assert.Equal(t, tt.wantMode, ar.CollectMode)
+				assert.Equal(t, tt.wantInterval, ar.ScanInterval)
+			}
+		})
+	}
+}
+
+func TestStartCollectsFilesWithFakeOutput(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(logs, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// files existing at startup are not collected when source files are kept
+	startConfig(t, "file", dir)
+	for _, name := range []string{"app.log", "app.log.tmp"} {
+		if err := os.WriteFile(filepath.Join(logs, name), []byte("log"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case task := <-fakeTasks:
+		assert.Equal(t, filepath.Join(logs, "app.log"), task.FilePath)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no file has been collected")
+	}
+
+	// the excluded file is never collected
+	select {
+	case task := <-fakeTasks:
+		t.Errorf("unexpected task: %+v", task)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestMetricListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	startConfigWith(t, "metric", "$TESTDIR", filepath.ToSlash(dir), "$TESTADDR", addr)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "logarchive_input_worker_count")
+
+	// the textfile is disabled
+	assert.NoFileExists(t, "logarchive.prom")
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, err := http.Get("http://" + addr + path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "[+]file ok\nok\n", string(body))
+	}
+}
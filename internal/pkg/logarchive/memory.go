@@ -0,0 +1,83 @@
+package logarchive
+
+import (
+	"context"
+	"sync"
+)
+
+// defaultCompressMemory is the memory budget of the compression buffers when
+// it is not set by the quota.
+const defaultCompressMemory = 256 << 20
+
+// MemoryBudget limits the memory of the buffers held by the workers of all
+// archives, e.g. the compressed files waiting for upload. The nil budget is
+// unlimited.
+type MemoryBudget struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// changed is closed when the memory is released
+	changed chan struct{}
+}
+
+// NewMemoryBudget returns the budget of limit bytes.
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	return &MemoryBudget{limit: limit, changed: make(chan struct{})}
+}
+
+// Limit returns the limit of the budget, it is 0 when unlimited.
+func (b *MemoryBudget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// Acquire waits until n bytes are available. A request larger than the limit
+// is granted when nothing is used, otherwise it would never be granted.
+func (b *MemoryBudget) Acquire(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			CompressMemoryBytes.Set(float64(b.used))
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release returns n bytes acquired to the budget.
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	CompressMemoryBytes.Set(float64(b.used))
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// MemoryBudget returns the memory budget of the running configuration.
+func (ctx Context) MemoryBudget() *MemoryBudget {
+	if ctx.cfg == nil {
+		return nil
+	}
+	return ctx.cfg.memory
+}
@@ -0,0 +1,46 @@
+package logarchive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	b := NewMemoryBudget(100)
+	ctx := context.Background()
+
+	// a request larger than the limit is granted when nothing is used
+	assert.NoError(t, b.Acquire(ctx, 150))
+	b.Release(150)
+
+	assert.NoError(t, b.Acquire(ctx, 60))
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.Acquire(ctx, 60) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired over the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	b.Release(60)
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("not acquired after released")
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.Acquire(timeout, 60), context.DeadlineExceeded)
+
+	// the nil budget is unlimited
+	var unlimited *MemoryBudget
+	assert.NoError(t, unlimited.Acquire(ctx, 1<<40))
+	unlimited.Release(1 << 40)
+	assert.Equal(t, int64(0), unlimited.Limit())
+}
@@ -1,25 +1,44 @@
 package logarchive
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/expfmt"
 	"go.uber.org/zap"
 )
 
 const (
-	LogArciveSubSystem       = "logarchive"
-	DiskUsageKey             = "disk_usage"
-	InputQueneSizeKey        = "input_queue_size"
-	InputRequestSizeKey      = "input_request_size_bytes"
-	InputDiscardTotalKey     = "input_discard_total"
-	OutputTruncateTotalKey   = "output_truncate_total"
-	OutputRequestTotalKey    = "output_request_total"
-	OutputRequestDurationKey = "output_request_duration_seconds"
+	LogArciveSubSystem        = "logarchive"
+	DiskUsageKey              = "disk_usage"
+	InputQueneSizeKey         = "input_queue_size"
+	InputRequestSizeKey       = "input_request_size_bytes"
+	InputDiscardTotalKey      = "input_discard_total"
+	InputBacklogAgeKey        = "input_backlog_age_seconds"
+	InputDeleteFailedTotalKey = "input_delete_failed_total"
+	InputWorkerCountKey       = "input_worker_count"
+	InputInFlightKey          = "input_inflight"
+	InputFilesPendingKey      = "input_files_pending"
+	InputUploadLatencyKey     = "input_upload_latency_seconds"
+	InputWatcherEventsKey     = "input_watcher_events_total"
+	InputClockJumpsTotalKey   = "input_clock_jumps_total"
+	InputDedupTotalKey        = "input_dedup_total"
+	QuotaQueuedBytesKey       = "quota_queued_bytes"
+	CompressMemoryBytesKey    = "compress_memory_bytes"
+	OutputTruncateTotalKey    = "output_truncate_total"
+	OutputRequestTotalKey     = "output_request_total"
+	OutputRequestDurationKey  = "output_request_duration_seconds"
+	OutputBytesTotalKey       = "output_bytes_total"
+	EventDroppedTotalKey      = "event_dropped_total"
 )
 
 var (
@@ -71,6 +90,140 @@ var (
 		},
 	)
 
+	InputBacklogAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputBacklogAgeKey,
+			Help:      "The age in seconds of the oldest input target waiting for upload",
+		},
+		[]string{
+			"module",
+		},
+	)
+
+	InputDeleteFailedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputDeleteFailedTotalKey,
+			Help:      "The number of input target failed to be deleted",
+		},
+		[]string{
+			"module",
+			"reason",
+		},
+	)
+
+	InputWorkerCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputWorkerCountKey,
+			Help:      "The number of output workers",
+		},
+		[]string{
+			"module",
+		},
+	)
+
+	InputInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputInFlightKey,
+			Help:      "The number of files queued or uploading of the watched path",
+		},
+		[]string{
+			"module",
+			"path",
+		},
+	)
+
+	InputFilesPending = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputFilesPendingKey,
+			Help:      "The number of files waiting for upload or uploading",
+		},
+		[]string{
+			"module",
+		},
+	)
+
+	InputUploadLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputUploadLatencyKey,
+			Help:      "Histogram of the time (in seconds) from the file last modified to its upload completed",
+			Buckets:   []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600, 86400},
+		},
+		[]string{
+			"module",
+		},
+	)
+
+	InputWatcherEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputWatcherEventsKey,
+			Help:      "The number of file system events received by the watcher",
+		},
+		[]string{
+			"module",
+			"op",
+		},
+	)
+
+	InputClockJumpsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputClockJumpsTotalKey,
+			Help:      "The number of the wall clock jumps detected, e.g. stepped by NTP",
+		},
+		[]string{
+			"module",
+			"direction",
+		},
+	)
+
+	InputDedupTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      InputDedupTotalKey,
+			Help:      "The number of files skipped because the same content has been uploaded",
+		},
+		[]string{
+			"module",
+		},
+	)
+
+	QuotaQueuedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      QuotaQueuedBytesKey,
+			Help:      "The size of files queued or uploading of the archive with quota",
+		},
+		[]string{
+			"archive",
+		},
+	)
+
+	EventDroppedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      EventDroppedTotalKey,
+			Help:      "The number of events dropped because the subscriber falls behind",
+		},
+		[]string{
+			"kind",
+		},
+	)
+
+	CompressMemoryBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      CompressMemoryBytesKey,
+			Help:      "The memory of the compression buffers held by the outputs",
+		},
+	)
+
 	OutputTruncateTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Subsystem: LogArciveSubSystem,
@@ -106,16 +259,38 @@ var (
 			"code",
 		},
 	)
+
+	OutputBytesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: LogArciveSubSystem,
+			Name:      OutputBytesTotalKey,
+			Help:      "The bytes uploaded, after compression if any",
+		},
+		[]string{
+			"module",
+		},
+	)
 )
 
 // Metric struct defines the configuration and runtime state for logarchive metrics collection.
 // It contains fields for output path, scrape interval, and manages the metrics collection process.
+// The metrics are written into the textfile for node_exporter, served by the HTTP listener
+// for Prometheus to scrape when Listen is set, and pushed when Push is set.
 type Metric struct {
 	OutPath       string `yaml:"outPath,omitempty" json:"outPath,omitempty"`
 	ScrapInterval int    `yaml:"scrapInterval,omitempty" json:"scrapInterval,omitempty"`
 
+	// Listen is the address of the HTTP listener serving /metrics, /healthz and /readyz, such as ":9273"
+	Listen string `yaml:"listen,omitempty" json:"listen,omitempty"`
+	// DisableTextfile stops writing the textfile when the metrics are scraped by HTTP or pushed
+	DisableTextfile bool `yaml:"disableTextfile,omitempty" json:"disableTextfile,omitempty"`
+	// Push pushes the metrics for the hosts without a scraper
+	Push *MetricPush `yaml:"push,omitempty" json:"push,omitempty"`
+
+	ctx    Context
 	done   chan struct{}
 	ticker time.Ticker
+	server *http.Server
 
 	register *prometheus.Registry
 
@@ -124,6 +299,7 @@ type Metric struct {
 
 // Provision initializes the Metric instance with required components
 func (m *Metric) Provision(ctx Context) error {
+	m.ctx = ctx
 	m.done = make(chan struct{})
 	m.logger = ctx.Logger().Sugar().Named("metric")
 	m.register = prometheus.NewRegistry()
@@ -132,19 +308,54 @@ func (m *Metric) Provision(ctx Context) error {
 	m.register.MustRegister(InputQueneSize)
 	m.register.MustRegister(InputRequestSize)
 	m.register.MustRegister(InputDiscardTotal)
+	m.register.MustRegister(InputBacklogAge)
+	m.register.MustRegister(InputDeleteFailedTotal)
+	m.register.MustRegister(InputWorkerCount)
+	m.register.MustRegister(InputInFlight)
+	m.register.MustRegister(InputFilesPending)
+	m.register.MustRegister(InputUploadLatency)
+	m.register.MustRegister(InputWatcherEvents)
+	m.register.MustRegister(InputClockJumpsTotal)
+	m.register.MustRegister(InputDedupTotal)
+	m.register.MustRegister(QuotaQueuedBytes)
 	m.register.MustRegister(OutputTruncateTotal)
 	m.register.MustRegister(OutputRequestTotal)
 	m.register.MustRegister(OutputRequestDuration)
+	m.register.MustRegister(OutputBytesTotal)
+	m.register.MustRegister(EventDroppedTotal)
+	m.register.MustRegister(CompressMemoryBytes)
+
+	if m.DisableTextfile && m.Listen == "" && m.Push == nil {
+		return fmt.Errorf("metric listen address or push is required when textfile is disabled")
+	}
 
 	if m.ScrapInterval == 0 {
 		m.ScrapInterval = 60
 	}
+
+	if m.Push != nil {
+		if err := m.Push.provision(m.ScrapInterval); err != nil {
+			return err
+		}
+	}
 	m.ticker = *time.NewTicker(time.Second * time.Duration(m.ScrapInterval))
 	return nil
 }
 
 func (m *Metric) Start() error {
-	go m.runRecordMetrics()
+	if m.Listen != "" {
+		if err := m.startServer(); err != nil {
+			return err
+		}
+	}
+
+	if !m.DisableTextfile {
+		go m.runRecordMetrics()
+	}
+
+	if m.Push != nil {
+		go m.runPush()
+	}
 	return nil
 }
 
@@ -154,6 +365,37 @@ func (m *Metric) Stop() error {
 	}
 
 	close(m.done)
+
+	if m.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := m.server.Shutdown(ctx); err != nil {
+			return fmt.Errorf("shutdown metric server: %v", err)
+		}
+	}
+	return nil
+}
+
+// startServer listens on the address before returning, so that the address
+// conflict is reported by Start.
+func (m *Metric) startServer() error {
+	ln, err := net.Listen("tcp", m.Listen)
+	if err != nil {
+		return fmt.Errorf("metric listen: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.register, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", m.healthHandler(checkHealthy))
+	mux.Handle("/readyz", m.healthHandler(checkReady))
+	m.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := m.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			m.logger.Errorf("metric server: %v", err)
+		}
+	}()
+	m.logger.Infof("metric server is listening on %s", ln.Addr())
 	return nil
 }
 
@@ -0,0 +1,334 @@
+package logarchive
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const defaultPushJob = "logarchive"
+
+// MetricTLS is the TLS configuration of the push endpoints.
+type MetricTLS struct {
+	CAFile             string `yaml:"caFile,omitempty" json:"caFile,omitempty"`
+	CertFile           string `yaml:"certFile,omitempty" json:"certFile,omitempty"`
+	KeyFile            string `yaml:"keyFile,omitempty" json:"keyFile,omitempty"`
+	ServerName         string `yaml:"serverName,omitempty" json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty" json:"insecureSkipVerify,omitempty"`
+}
+
+// MetricPush pushes the metrics periodically for the hosts without a scraper,
+// to a Prometheus Pushgateway, a remote_write endpoint or both of them.
+// Job is "logarchive" and Instance is the hostname by default.
+type MetricPush struct {
+	Pushgateway   string            `yaml:"pushgateway,omitempty" json:"pushgateway,omitempty"`
+	RemoteWrite   string            `yaml:"remoteWrite,omitempty" json:"remoteWrite,omitempty"`
+	Interval      int               `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Job           string            `yaml:"job,omitempty" json:"job,omitempty"`
+	Instance      string            `yaml:"instance,omitempty" json:"instance,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Username      string            `yaml:"username,omitempty" json:"username,omitempty"`
+	Password      string            `yaml:"password,omitempty" json:"password,omitempty"`
+	Timeout       int               `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retry         int               `yaml:"retry,omitempty" json:"retry,omitempty"`
+	RetryInterval int               `yaml:"retryInterval,omitempty" json:"retryInterval,omitempty"`
+	TLS           *MetricTLS        `yaml:"tls,omitempty" json:"tls,omitempty"`
+
+	client *http.Client
+}
+
+// provision fills the defaults and creates the HTTP client.
+func (p *MetricPush) provision(scrapInterval int) error {
+	if p.Pushgateway == "" && p.RemoteWrite == "" {
+		return fmt.Errorf("metric push requires pushgateway or remoteWrite")
+	}
+
+	if p.Interval <= 0 {
+		p.Interval = scrapInterval
+	}
+	if p.Job == "" {
+		p.Job = defaultPushJob
+	}
+	if p.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("get hostname: %v", err)
+		}
+		p.Instance = hostname
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 10
+	}
+	if p.Retry <= 0 {
+		p.Retry = 3
+	}
+	if p.RetryInterval <= 0 {
+		p.RetryInterval = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.TLS != nil {
+		cfg, err := p.TLS.config()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = cfg
+	}
+	p.client = &http.Client{Transport: transport, Timeout: time.Duration(p.Timeout) * time.Second}
+	return nil
+}
+
+func (t *MetricTLS) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		data, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in ca file: %s", t.CAFile)
+		}
+	}
+
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func (m *Metric) runPush() {
+	ticker := time.NewTicker(time.Second * time.Duration(m.Push.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			if err := m.pushWithRetry(); err != nil {
+				m.logger.Errorf("push metrics: %v", err)
+			}
+		}
+	}
+}
+
+func (m *Metric) pushWithRetry() error {
+	var err error
+	for i := 0; i < m.Push.Retry; i++ {
+		if i != 0 {
+			select {
+			case <-m.done:
+				return err
+			case <-time.After(time.Second * time.Duration(m.Push.RetryInterval)):
+			}
+		}
+
+		if err = m.pushMetrics(); err == nil {
+			return nil
+		}
+		m.logger.Warnf("push metrics failed %d times: %v", i+1, err)
+	}
+	return err
+}
+
+// pushMetrics pushes the metrics to every configured endpoint.
+func (m *Metric) pushMetrics() error {
+	p := m.Push
+	if p.Pushgateway != "" {
+		pusher := push.New(p.Pushgateway, p.Job).
+			Gatherer(m.register).
+			Client(p.client).
+			Grouping("instance", p.Instance)
+		for _, name := range sortedKeys(p.Labels) {
+			pusher = pusher.Grouping(name, p.Labels[name])
+		}
+		if p.Username != "" {
+			pusher = pusher.BasicAuth(p.Username, p.Password)
+		}
+
+		if err := pusher.Push(); err != nil {
+			return fmt.Errorf("pushgateway: %v", err)
+		}
+	}
+
+	if p.RemoteWrite != "" {
+		if err := m.remoteWrite(); err != nil {
+			return fmt.Errorf("remote write: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m *Metric) remoteWrite() error {
+	p := m.Push
+	mfs, err := m.GetGather()
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]string{"job": p.Job, "instance": p.Instance}
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.client.Timeout)
+	defer cancel()
+
+	body := snappyEncode(encodeWriteRequest(mfs, labels, time.Now().UnixMilli()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.RemoteWrite, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return nil
+}
+
+// encodeWriteRequest encodes the metric families into the prometheus.WriteRequest
+// protobuf message of the remote write protocol. The histograms and summaries are
+// flattened into the series as the classic exposition format does.
+func encodeWriteRequest(mfs []*dto.MetricFamily, extra map[string]string, ts int64) []byte {
+	var buf []byte
+	addSeries := func(name string, labels map[string]string, value float64) {
+		all := map[string]string{"__name__": name}
+		for k, v := range extra {
+			all[k] = v
+		}
+		for k, v := range labels {
+			all[k] = v
+		}
+
+		var series []byte
+		for _, k := range sortedKeys(all) {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, k)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, all[k])
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, series)
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		for _, metric := range mf.GetMetric() {
+			labels := make(map[string]string, len(metric.GetLabel()))
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				addSeries(name, labels, metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				addSeries(name, labels, metric.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				addSeries(name, labels, metric.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := metric.GetHistogram()
+				for _, b := range h.GetBucket() {
+					addSeries(name+"_bucket", withLabel(labels, "le", formatFloat(b.GetUpperBound())), float64(b.GetCumulativeCount()))
+				}
+				addSeries(name+"_bucket", withLabel(labels, "le", "+Inf"), float64(h.GetSampleCount()))
+				addSeries(name+"_sum", labels, h.GetSampleSum())
+				addSeries(name+"_count", labels, float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := metric.GetSummary()
+				for _, q := range s.GetQuantile() {
+					addSeries(name, withLabel(labels, "quantile", formatFloat(q.GetQuantile())), q.GetValue())
+				}
+				addSeries(name+"_sum", labels, s.GetSampleSum())
+				addSeries(name+"_count", labels, float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return buf
+}
+
+// snappyEncode encodes the data into the snappy block format with literals only,
+// which is valid for any snappy decoder and good enough for the small payload.
+func snappyEncode(data []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(data)))
+	for len(data) != 0 {
+		n := min(len(data), 1<<16)
+		// the literal tag with the length in the following 2 bytes
+		buf = append(buf, 61<<2, byte(n-1), byte((n-1)>>8))
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+	}
+	return buf
+}
+
+func withLabel(labels map[string]string, name, value string) map[string]string {
+	all := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		all[k] = v
+	}
+	all[name] = value
+	return all
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
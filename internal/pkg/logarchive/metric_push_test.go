@@ -0,0 +1,203 @@
+package logarchive
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// snappyDecode decodes the literals written by snappyEncode.
+func snappyDecode(t *testing.T, data []byte) []byte {
+	size, n := binary.Uvarint(data)
+	data = data[n:]
+
+	var out []byte
+	for len(data) != 0 {
+		if !assert.Equal(t, byte(61<<2), data[0]) {
+			return nil
+		}
+		l := int(data[1]) | int(data[2])<<8 + 1
+		out = append(out, data[3:3+l]...)
+		data = data[3+l:]
+	}
+	assert.Equal(t, int(size), len(out))
+	return out
+}
+
+// decodeWriteRequest returns the series as "name{k=v,...} value".
+func decodeWriteRequest(t *testing.T, data []byte) []string {
+	fields := func(b []byte, fn func(num protowire.Number, v []byte, u uint64)) {
+		for len(b) != 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				fn(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				fn(num, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				fn(num, nil, v)
+				b = b[n:]
+			default:
+				t.Fatalf("unexpected wire type: %v", typ)
+			}
+		}
+	}
+
+	var all []string
+	fields(data, func(_ protowire.Number, series []byte, _ uint64) {
+		var name string
+		var labels []string
+		var value float64
+		fields(series, func(num protowire.Number, v []byte, _ uint64) {
+			if num == 1 {
+				var k, lv string
+				fields(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						k = string(v)
+					} else {
+						lv = string(v)
+					}
+				})
+				if k == "__name__" {
+					name = lv
+				} else {
+					labels = append(labels, k+"="+lv)
+				}
+				return
+			}
+			fields(v, func(num protowire.Number, _ []byte, u uint64) {
+				if num == 1 {
+					value = math.Float64frombits(u)
+				}
+			})
+		})
+		all = append(all, name+"{"+strings.Join(labels, ",")+"} "+formatFloat(value))
+	})
+	sort.Strings(all)
+	return all
+}
+
+func newPushTestMetric(t *testing.T, p *MetricPush) *Metric {
+	m := &Metric{
+		Push:     p,
+		register: prometheus.NewRegistry(),
+		logger:   zap.NewNop().Sugar(),
+		done:     make(chan struct{}),
+	}
+
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge"}, []string{"module"})
+	g.WithLabelValues("file").Set(3)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1}})
+	h.Observe(0.5)
+	h.Observe(2)
+	m.register.MustRegister(g, h)
+
+	if err := p.provision(60); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMetricRemoteWrite(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "user:pass", user+":"+pass)
+
+		data, _ := io.ReadAll(r.Body)
+		got = decodeWriteRequest(t, snappyDecode(t, data))
+	}))
+	defer srv.Close()
+
+	m := newPushTestMetric(t, &MetricPush{
+		RemoteWrite: srv.URL,
+		Instance:    "host1",
+		Labels:      map[string]string{"env": "test"},
+		Username:    "user",
+		Password:    "pass",
+	})
+	if !assert.NoError(t, m.pushMetrics()) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		"test_gauge{env=test,instance=host1,job=logarchive,module=file} 3",
+		"test_seconds_bucket{env=test,instance=host1,job=logarchive,le=+Inf} 2",
+		"test_seconds_bucket{env=test,instance=host1,job=logarchive,le=1} 1",
+		"test_seconds_count{env=test,instance=host1,job=logarchive} 2",
+		"test_seconds_sum{env=test,instance=host1,job=logarchive} 2.5",
+	}, got)
+}
+
+func TestMetricPushgatewayRetry(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the order of the grouping labels is not stable
+		pairs := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/job/logarchive/"), "/")
+		var groups []string
+		for i := 0; i+1 < len(pairs); i += 2 {
+			groups = append(groups, pairs[i]+"="+pairs[i+1])
+		}
+		sort.Strings(groups)
+		paths = append(paths, r.Method+" "+strings.Join(groups, ","))
+		// the first push fails
+		if len(paths) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	m := newPushTestMetric(t, &MetricPush{
+		Pushgateway:   srv.URL,
+		Instance:      "host1",
+		Labels:        map[string]string{"env": "test"},
+		Retry:         2,
+		RetryInterval: 1,
+	})
+	assert.NoError(t, m.pushWithRetry())
+	assert.Equal(t, []string{
+		"PUT env=test,instance=host1",
+		"PUT env=test,instance=host1",
+	}, paths)
+}
+
+func TestMetricPushProvision(t *testing.T) {
+	p := &MetricPush{}
+	assert.ErrorContains(t, p.provision(60), "requires pushgateway or remoteWrite")
+
+	p = &MetricPush{RemoteWrite: "http://127.0.0.1/api/v1/write"}
+	if assert.NoError(t, p.provision(30)) {
+		assert.Equal(t, 30, p.Interval)
+		assert.Equal(t, "logarchive", p.Job)
+		assert.NotEmpty(t, p.Instance)
+	}
+
+	p = &MetricPush{RemoteWrite: "https://127.0.0.1/api/v1/write", TLS: &MetricTLS{CAFile: "not-exist.pem"}}
+	assert.ErrorContains(t, p.provision(30), "read ca file")
+}
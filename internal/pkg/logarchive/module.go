@@ -64,6 +64,42 @@ func RegisterModule(instance Module) {
 	modules[string(mod.ID)] = mod
 }
 
+// RegisterModuleForTest registers a module like RegisterModule, but a module
+// with the same ID is replaced until ResetModulesForTest is called. It allows
+// tests to provide fake modules, e.g. an output which does not upload files.
+func RegisterModuleForTest(instance Module) {
+	mod := instance.ArchiveModule()
+	if mod.ID == "" {
+		panic("module ID missing")
+	}
+	if mod.New == nil {
+		panic("missing ModuleInfo.New")
+	}
+
+	id := string(mod.ID)
+	if _, ok := replacedModules[id]; !ok {
+		if old, ok := modules[id]; ok {
+			replacedModules[id] = &old
+		} else {
+			replacedModules[id] = nil
+		}
+	}
+	modules[id] = mod
+}
+
+// ResetModulesForTest removes the modules registered by RegisterModuleForTest
+// and restores the modules they replaced.
+func ResetModulesForTest() {
+	for id, old := range replacedModules {
+		if old == nil {
+			delete(modules, id)
+		} else {
+			modules[id] = *old
+		}
+	}
+	replacedModules = make(map[string]*ModuleInfo)
+}
+
 // Provisioner is implemented by module which may need to perform
 // some additional "setup" steps immediately after being loaded.
 type Provisioner interface {
@@ -99,7 +135,7 @@ func ParseStructTag(tag string) (map[string]string, error) {
 }
 
 func isJSONRawMessage(typ reflect.Type) bool {
-	return typ.PkgPath() == "encoding/json" && typ.Name() == "RawMessage"
+	return typ == rawMessageType
 }
 
 func isModuleMapType(typ reflect.Type) bool {
@@ -110,4 +146,10 @@ func isModuleMapType(typ reflect.Type) bool {
 
 var (
 	modules = make(map[string]ModuleInfo)
+
+	// rawMessageType is compared directly since json.RawMessage may be an alias
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+	// replacedModules saves the modules replaced in tests, nil means the module was not registered
+	replacedModules = make(map[string]*ModuleInfo)
 )
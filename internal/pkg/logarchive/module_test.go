@@ -0,0 +1,109 @@
+package logarchive
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testModule struct {
+	id string
+}
+
+func (m testModule) ArchiveModule() ModuleInfo {
+	return ModuleInfo{
+		ID: ModuleID(m.id),
+		New: func() Module {
+			return &testModule{id: m.id}
+		},
+	}
+}
+
+func TestRegisterModuleForTest(t *testing.T) {
+	RegisterModule(testModule{id: "test.registered"})
+	defer delete(modules, "test.registered")
+	origin := modules["test.registered"]
+
+	replaced := ModuleInfo{ID: "test.registered", New: func() Module { return &testModule{id: "replaced"} }}
+	RegisterModuleForTest(moduleInfoModule(replaced))
+	RegisterModuleForTest(testModule{id: "test.new"})
+
+	if assert.Contains(t, modules, "test.new") {
+		assert.Equal(t, "replaced", modules["test.registered"].New().(*testModule).id)
+	}
+
+	ResetModulesForTest()
+	assert.NotContains(t, modules, "test.new")
+	assert.Equal(t, "test.registered", modules["test.registered"].New().(*testModule).id)
+	assert.Equal(t, origin.ID, modules["test.registered"].ID)
+	assert.Empty(t, replacedModules)
+}
+
+// moduleInfoModule registers the module info as it is.
+type moduleInfoModule ModuleInfo
+
+func (m moduleInfoModule) ArchiveModule() ModuleInfo {
+	return ModuleInfo(m)
+}
+
+type testDocRule struct {
+	Enabled bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+type testDocBase struct {
+	Paths []string `yaml:"paths,omitempty" json:"paths,omitempty"`
+}
+
+type testDocModule struct {
+	testDocBase
+	Rule      testDocRule              `yaml:"rule,omitempty" json:"rule,omitempty"`
+	Rules     []*testDocRule           `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Timeout   time.Duration            `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	OutputRaw json.RawMessage          `yaml:"output,omitempty" json:"output,omitempty" logarchive:"namespace=output inline_key=type"`
+	Labels    map[string]string        `json:"labels,omitempty"`
+	Ignored   string                   `yaml:"-" json:"-"`
+	Nested    map[string]testDocModule `yaml:"nested,omitempty" json:"nested,omitempty"`
+
+	internal int
+}
+
+func (testDocModule) ArchiveModule() ModuleInfo {
+	return ModuleInfo{
+		ID:  "test.doc",
+		New: func() Module { return new(testDocModule) },
+	}
+}
+
+func TestModuleFields(t *testing.T) {
+	RegisterModuleForTest(testDocModule{})
+	defer ResetModulesForTest()
+
+	mod, err := GetModule("test.doc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var ids []ModuleID
+	for _, m := range Modules() {
+		ids = append(ids, m.ID)
+	}
+	assert.Contains(t, ids, mod.ID)
+	assert.IsIncreasing(t, ids)
+
+	assert.Equal(t, []ModuleField{
+		{Name: "paths", Type: "[]string", Tag: "paths,omitempty"},
+		{Name: "rule", Type: "object", Tag: "rule,omitempty"},
+		{Name: "rule.enabled", Type: "bool", Tag: "enabled,omitempty"},
+		{Name: "rules", Type: "[]object", Tag: "rules,omitempty"},
+		{Name: "rules[].enabled", Type: "bool", Tag: "enabled,omitempty"},
+		{Name: "timeout", Type: "duration", Tag: "timeout,omitempty"},
+		{Name: "output", Type: "module", Tag: "output,omitempty", Namespace: "output"},
+		{Name: "labels", Type: "map[string]string", Tag: "labels,omitempty"},
+		// the recursive type is not expanded
+		{Name: "nested", Type: "map[string]object", Tag: "nested,omitempty"},
+	}, mod.Fields())
+
+	_, err = GetModule("test.unknown")
+	assert.ErrorContains(t, err, "module not registered")
+}
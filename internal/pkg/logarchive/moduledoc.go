@@ -0,0 +1,177 @@
+package logarchive
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// ModuleField describes a configuration field of a module.
+type ModuleField struct {
+	// Name is the path of the field in the configuration, e.g. "collectRule.keepSourceFile",
+	// "[]" is the elements of a list and "*" is the values of a map
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Tag is the yaml tag of the field
+	Tag string `json:"tag,omitempty"`
+	// Namespace is the namespace of the modules loaded by the field, e.g. "output"
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Modules returns the registered modules sorted by ID.
+func Modules() []ModuleInfo {
+	mods := make([]ModuleInfo, 0, len(modules))
+	for _, mod := range modules {
+		mods = append(mods, mod)
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].ID < mods[j].ID })
+	return mods
+}
+
+// GetModule returns the registered module by ID.
+func GetModule(id string) (ModuleInfo, error) {
+	mod, ok := modules[id]
+	if !ok {
+		return ModuleInfo{}, fmt.Errorf("module not registered: %s", id)
+	}
+	return mod, nil
+}
+
+// Fields returns the configuration fields of the module, the fields of the
+// nested structs are flattened.
+func (m ModuleInfo) Fields() []ModuleField {
+	typ := reflect.TypeOf(m.New())
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []ModuleField
+	appendStructFields(&fields, "", typ, map[reflect.Type]bool{})
+	return fields
+}
+
+func appendStructFields(fields *[]ModuleField, prefix string, typ reflect.Type, visiting map[reflect.Type]bool) {
+	// the recursive types are not expanded again
+	if visiting[typ] {
+		return
+	}
+	visiting[typ] = true
+	defer delete(visiting, typ)
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		tag, ok := sf.Tag.Lookup("yaml")
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		// the embedded structs are inlined as encoding/json does
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			appendStructFields(fields, prefix, ft, visiting)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if strings.Contains(tag, ",inline") {
+			appendStructFields(fields, prefix, ft, visiting)
+			continue
+		}
+
+		field := ModuleField{Name: prefix + name, Type: fieldTypeName(ft), Tag: tag}
+		if isJSONRawMessage(ft) || isModuleMapType(ft) {
+			if structTag, err := ParseStructTag(sf.Tag.Get("logarchive")); err == nil && structTag["namespace"] != "" {
+				field.Namespace = structTag["namespace"]
+				field.Type = "module"
+				if isModuleMapType(ft) {
+					field.Type = "map[string]module"
+				}
+			}
+		}
+		*fields = append(*fields, field)
+
+		// the fields of the structs in the lists and maps are named by "[]" and "*"
+		elemPrefix := prefix + name + "."
+		elem := ft
+	elems:
+		for {
+			switch elem.Kind() {
+			case reflect.Pointer:
+				elem = elem.Elem()
+				continue
+			case reflect.Slice, reflect.Array:
+				if !isJSONRawMessage(elem) {
+					elemPrefix = strings.TrimSuffix(elemPrefix, ".") + "[]."
+					elem = elem.Elem()
+					continue
+				}
+			case reflect.Map:
+				if !isModuleMapType(elem) {
+					elemPrefix += "*."
+					elem = elem.Elem()
+					continue
+				}
+			}
+			break elems
+		}
+		if elem.Kind() == reflect.Struct && !isTextType(elem) {
+			appendStructFields(fields, elemPrefix, elem, visiting)
+		}
+	}
+}
+
+// fieldTypeName returns the type of the field in the configuration, the named
+// types are shown as their underlying types, e.g. string for CollectMode.
+func fieldTypeName(typ reflect.Type) string {
+	switch {
+	case typ.Kind() == reflect.Pointer:
+		return fieldTypeName(typ.Elem())
+	case isJSONRawMessage(typ):
+		return "any"
+	case typ == durationType:
+		return "duration"
+	case isTextType(typ):
+		return "string"
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return "[]" + fieldTypeName(typ.Elem())
+	case reflect.Map:
+		return "map[" + fieldTypeName(typ.Key()) + "]" + fieldTypeName(typ.Elem())
+	case reflect.Struct:
+		return "object"
+	case reflect.Interface:
+		return "any"
+	default:
+		return typ.Kind().String()
+	}
+}
+
+// isTextType reports whether the type is decoded from a string by encoding.TextUnmarshaler.
+func isTextType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
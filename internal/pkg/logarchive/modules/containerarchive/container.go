@@ -0,0 +1,248 @@
+package containerarchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+)
+
+// Layout defines how the container runtime stores the stdout log files.
+type Layout string
+
+const (
+	// LayoutCRI is the kubelet layout: <root>/<namespace>_<pod>_<uid>/<container>/<restart>.log
+	LayoutCRI Layout = "cri"
+	// LayoutDocker is the docker json-file layout: <root>/<id>/<id>-json.log
+	LayoutDocker Layout = "docker"
+)
+
+const (
+	defaultCRIRoot    = "/var/log/pods"
+	defaultDockerRoot = "/var/lib/docker/containers"
+
+	defaultDestTemplate = "{namespace}/{pod}/{container}/{file}"
+
+	// labels set by kubelet on docker containers
+	labelPodNamespace = "io.kubernetes.pod.namespace"
+	labelPodName      = "io.kubernetes.pod.name"
+	labelContainer    = "io.kubernetes.container.name"
+)
+
+var (
+	// 0.log, 0.log.20240101-120000, 0.log.20240101-120000.gz
+	criLogRegexp = regexp.MustCompile(`^\d+\.log(\..+)?$`)
+	// <id>-json.log, <id>-json.log.1
+	dockerLogRegexp = regexp.MustCompile(`^[0-9a-f]+-json\.log(\.\d+)?$`)
+)
+
+// Archive collects the stdout log files of containers. It discovers the log files
+// by the layout of the container runtime, and stores them under the destination
+// path enriched with the namespace, pod and container name.
+type Archive struct {
+	filearchive.Archive
+
+	Layout Layout `yaml:"layout,omitempty" json:"layout,omitempty"`
+	Root   string `yaml:"root,omitempty" json:"root,omitempty"`
+	// ActiveLogs collects the log files which are still written by the runtime,
+	// otherwise only the rotated files are collected.
+	ActiveLogs bool `yaml:"activeLogs,omitempty" json:"activeLogs,omitempty"`
+	// DestTemplate supports {namespace}, {pod}, {container} and {file}.
+	DestTemplate string `yaml:"destTemplate,omitempty" json:"destTemplate,omitempty"`
+
+	labels *labelCache
+}
+
+// labelCache caches the labels by container directory, it is accessed by output tasks.
+type labelCache struct {
+	mu sync.Mutex
+	m  map[string]*containerLabels
+}
+
+type containerLabels struct {
+	namespace string
+	pod       string
+	container string
+}
+
+// ArchiveModule returns the container module information.
+func (Archive) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "container",
+		New: func() logarchive.Module {
+			return new(Archive)
+		},
+	}
+}
+
+// Provision implement the module interface
+func (ar *Archive) Provision(ctx logarchive.Context) error {
+	switch ar.Layout {
+	case "", LayoutCRI:
+		ar.Layout = LayoutCRI
+		if ar.Root == "" {
+			ar.Root = defaultCRIRoot
+		}
+	case LayoutDocker:
+		if ar.Root == "" {
+			ar.Root = defaultDockerRoot
+		}
+	default:
+		return fmt.Errorf("unsupport container log layout: %s", ar.Layout)
+	}
+
+	if ar.DestTemplate == "" {
+		ar.DestTemplate = defaultDestTemplate
+	}
+
+	if len(ar.Paths) != 0 {
+		return fmt.Errorf("paths is discovered from root, it can not be specified")
+	}
+	ar.Paths = []string{ar.Root}
+	ar.labels = &labelCache{m: make(map[string]*containerLabels)}
+	ar.SetCollector(ar)
+
+	return ar.Archive.Provision(ctx)
+}
+
+// Accept implement the collector interface
+func (ar *Archive) Accept(rootPath, filePath string) bool {
+	parts, ok := splitLogPath(rootPath, filePath)
+	if !ok {
+		return false
+	}
+
+	name := parts[len(parts)-1]
+	switch ar.Layout {
+	case LayoutCRI:
+		if len(parts) != 3 || !criLogRegexp.MatchString(name) {
+			return false
+		}
+		return ar.ActiveLogs || filepath.Ext(name) != ".log"
+	case LayoutDocker:
+		if len(parts) != 2 || !dockerLogRegexp.MatchString(name) {
+			return false
+		}
+		return ar.ActiveLogs || filepath.Ext(name) != ".log"
+	}
+	return false
+}
+
+// DestPath implement the collector interface
+func (ar *Archive) DestPath(rootPath, filePath string) (string, error) {
+	parts, ok := splitLogPath(rootPath, filePath)
+	if !ok || len(parts) < 2 {
+		return "", fmt.Errorf("file: %s is not a container log file", filePath)
+	}
+
+	var (
+		labels *containerLabels
+		err    error
+	)
+	switch ar.Layout {
+	case LayoutCRI:
+		labels, err = parseCRILabels(parts)
+	case LayoutDocker:
+		labels, err = ar.dockerLabels(filepath.Join(rootPath, parts[0]))
+	default:
+		err = fmt.Errorf("unsupport container log layout: %s", ar.Layout)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	r := strings.NewReplacer(
+		"{namespace}", labels.namespace,
+		"{pod}", labels.pod,
+		"{container}", labels.container,
+		"{file}", parts[len(parts)-1],
+	)
+	return filepath.FromSlash(r.Replace(ar.DestTemplate)), nil
+}
+
+// parseCRILabels parses <namespace>_<pod>_<uid>/<container>/<file>, the
+// namespace and pod name can not contain underscores.
+func parseCRILabels(parts []string) (*containerLabels, error) {
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid cri log path: %s", strings.Join(parts, "/"))
+	}
+
+	fields := strings.SplitN(parts[0], "_", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid cri pod directory: %s", parts[0])
+	}
+	return &containerLabels{
+		namespace: fields[0],
+		pod:       fields[1],
+		container: parts[1],
+	}, nil
+}
+
+// dockerLabels reads the labels from config.v2.json of the container, the
+// containers not managed by kubelet use "docker" as namespace and the
+// container name as pod and container name.
+func (ar *Archive) dockerLabels(dir string) (*containerLabels, error) {
+	ar.labels.mu.Lock()
+	defer ar.labels.mu.Unlock()
+
+	if l, ok := ar.labels.m[dir]; ok {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.v2.json"))
+	if err != nil {
+		return nil, fmt.Errorf("read container config: %v", err)
+	}
+
+	var cfg struct {
+		Name   string `json:"Name"`
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decode container config: %v", err)
+	}
+
+	l := &containerLabels{
+		namespace: cfg.Config.Labels[labelPodNamespace],
+		pod:       cfg.Config.Labels[labelPodName],
+		container: cfg.Config.Labels[labelContainer],
+	}
+	if l.namespace == "" || l.pod == "" || l.container == "" {
+		name := strings.TrimPrefix(cfg.Name, "/")
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		l = &containerLabels{namespace: "docker", pod: name, container: name}
+	}
+
+	ar.labels.m[dir] = l
+	return l, nil
+}
+
+func splitLogPath(rootPath, filePath string) ([]string, bool) {
+	rel, err := filepath.Rel(rootPath, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return nil, false
+	}
+	return strings.Split(filepath.ToSlash(rel), "/"), true
+}
+
+func init() {
+	logarchive.RegisterModule(Archive{})
+}
+
+var (
+	_ logarchive.Provisioner  = (*Archive)(nil)
+	_ logarchive.Validator    = (*Archive)(nil)
+	_ logarchive.CleanerUpper = (*Archive)(nil)
+	_ logarchive.Archive      = (*Archive)(nil)
+	_ filearchive.Collector   = (*Archive)(nil)
+)
@@ -0,0 +1,85 @@
+package containerarchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveCRILayout(t *testing.T) {
+	root := t.TempDir()
+	podDir := filepath.Join(root, "game_lobby-7d9f_0c6b4a2e", "lobby")
+
+	tests := []struct {
+		name       string
+		activeLogs bool
+		file       string
+		accept     bool
+		dest       string
+	}{
+		{name: "rotated file", file: filepath.Join(podDir, "0.log.20240101-120000"), accept: true, dest: "game/lobby-7d9f/lobby/0.log.20240101-120000"},
+		{name: "compressed rotated file", file: filepath.Join(podDir, "1.log.20240101-120000.gz"), accept: true, dest: "game/lobby-7d9f/lobby/1.log.20240101-120000.gz"},
+		{name: "active file is skipped", file: filepath.Join(podDir, "0.log"), accept: false},
+		{name: "active file", activeLogs: true, file: filepath.Join(podDir, "0.log"), accept: true, dest: "game/lobby-7d9f/lobby/0.log"},
+		{name: "unknown file", file: filepath.Join(podDir, "other.txt"), accept: false},
+		{name: "file outside container directory", file: filepath.Join(root, "game_lobby-7d9f_0c6b4a2e", "0.log.1"), accept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar := &Archive{Layout: LayoutCRI, ActiveLogs: tt.activeLogs, DestTemplate: defaultDestTemplate}
+			assert.Equal(t, tt.accept, ar.Accept(root, tt.file))
+			if !tt.accept {
+				return
+			}
+
+			dest, err := ar.DestPath(root, tt.file)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, filepath.FromSlash(tt.dest), dest)
+		})
+	}
+}
+
+func TestArchiveDockerLayout(t *testing.T) {
+	root := t.TempDir()
+	writeConfig := func(id, config string) string {
+		dir := filepath.Join(root, id)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "config.v2.json"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	k8sDir := writeConfig("abc123", `{"Name":"/k8s_lobby","Config":{"Labels":{
+		"io.kubernetes.pod.namespace":"game",
+		"io.kubernetes.pod.name":"lobby-0",
+		"io.kubernetes.container.name":"lobby"}}}`)
+	plainDir := writeConfig("def456", `{"Name":"/redis","Config":{"Labels":{}}}`)
+
+	ar := &Archive{Layout: LayoutDocker, DestTemplate: defaultDestTemplate}
+	ar.labels = &labelCache{m: make(map[string]*containerLabels)}
+
+	assert.False(t, ar.Accept(root, filepath.Join(k8sDir, "abc123-json.log")))
+	assert.False(t, ar.Accept(root, filepath.Join(k8sDir, "config.v2.json")))
+	assert.True(t, ar.Accept(root, filepath.Join(k8sDir, "abc123-json.log.1")))
+
+	dest, err := ar.DestPath(root, filepath.Join(k8sDir, "abc123-json.log.1"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.FromSlash("game/lobby-0/lobby/abc123-json.log.1"), dest)
+	}
+
+	dest, err = ar.DestPath(root, filepath.Join(plainDir, "def456-json.log.2"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, filepath.FromSlash("docker/redis/redis/def456-json.log.2"), dest)
+	}
+
+	_, err = ar.DestPath(root, filepath.Join(root, "missing", "missing-json.log.1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package cos
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+// autoProbeSampleSize is the size of the sample probed for 'compress: auto'
+const autoProbeSampleSize = 1 << 20
+
+// autoCompress caches the upload rules of the algorithms selected for the
+// directories, the algorithm of a directory is selected by probing its first
+// file, since the files of a directory are similar in most cases.
+type autoCompress struct {
+	mu    sync.Mutex
+	rules map[string]*FileUploadRule
+}
+
+// provisionAuto checks the options of 'compress: auto', the options of the
+// encoder which depend on the algorithm are not allowed.
+func (r *FileUploadRule) provisionAuto() error {
+	if r.CompressLevel != 0 || r.CompressWindowSize != 0 || r.CompressConcurrency != 0 || r.CompressDictionary != "" {
+		return fmt.Errorf("compressLevel, compressWindowSize, compressConcurrency and compressDictionary could not be used with auto compress")
+	}
+	if r.CompressParallel < 0 {
+		return fmt.Errorf("invalid compress parallel: %d", r.CompressParallel)
+	}
+	if r.CompressAutoMinThroughput < 0 {
+		return fmt.Errorf("invalid compress auto min throughput: %d", r.CompressAutoMinThroughput)
+	}
+	r.auto = &autoCompress{rules: make(map[string]*FileUploadRule)}
+	return nil
+}
+
+// uploadRule returns the upload rule of the file, the algorithm and the level
+// are resolved for the directory of the file if the algorithm is auto.
+func (h *Handler) uploadRule(filePath string) *FileUploadRule {
+	if h.UploadRule.CompressAlgorithm != compress.AUTO {
+		return &h.UploadRule
+	}
+
+	auto := h.UploadRule.auto
+	dir := filepath.Dir(filePath)
+	auto.mu.Lock()
+	rule, ok := auto.rules[dir]
+	auto.mu.Unlock()
+	if ok {
+		return rule
+	}
+
+	// the files are probed without the lock, a directory may be probed more
+	// than once by the concurrent uploads, which is harmless
+	rule = &FileUploadRule{}
+	*rule = h.UploadRule
+	results, err := compress.Probe(filePath, compress.ProbeOptions{SampleSize: autoProbeSampleSize})
+	if err != nil {
+		// the empty files are compressed by the default algorithm, and the
+		// directory is probed again with the next file
+		h.logger.Debugf("probe compress of %s: %v, use %s", filePath, err, compress.ZSTD)
+		rule.CompressAlgorithm = compress.ZSTD
+		return rule
+	}
+
+	minThroughput := h.UploadRule.CompressAutoMinThroughput
+	if minThroughput <= 0 {
+		minThroughput = compress.DefaultProbeMinThroughput
+	}
+	selected, _ := compress.Select(results, float64(minThroughput))
+	rule.CompressAlgorithm = selected.Algorithm
+	rule.CompressLevel = selected.Level
+	h.logger.Infof("auto compress of directory: %s selects %s, level: %s, ratio: %.2f, throughput: %.1fMB/s",
+		dir, selected.Algorithm, selected.Level, selected.Ratio(), selected.Throughput()/(1<<20))
+
+	auto.mu.Lock()
+	defer auto.mu.Unlock()
+	auto.rules[dir] = rule
+	return rule
+}
@@ -0,0 +1,94 @@
+package cos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestUploadRuleProvisionAuto(t *testing.T) {
+	tests := []struct {
+		rule    FileUploadRule
+		wantErr bool
+	}{
+		{FileUploadRule{CompressAlgorithm: compress.AUTO}, false},
+		{FileUploadRule{CompressAlgorithm: compress.AUTO, CompressParallel: 4, CompressAutoMinThroughput: 100 << 20}, false},
+		{FileUploadRule{CompressAlgorithm: compress.AUTO, CompressLevel: compress.LevelBest}, true},
+		{FileUploadRule{CompressAlgorithm: compress.AUTO, CompressWindowSize: 1 << 20}, true},
+		{FileUploadRule{CompressAlgorithm: compress.AUTO, CompressDictionary: "session.dict"}, true},
+		{FileUploadRule{CompressAlgorithm: compress.AUTO, CompressAutoMinThroughput: -1}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.rule.provision()
+		if tt.wantErr {
+			assert.Error(t, err, "%+v", tt.rule)
+		} else if assert.NoError(t, err, "%+v", tt.rule) {
+			assert.NotNil(t, tt.rule.auto)
+		}
+	}
+}
+
+func TestExecuteAutoCompress(t *testing.T) {
+	s := &objectServer{objects: make(map[string][]byte)}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	root := t.TempDir()
+	var data bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&data, "line %d of the log file\n", i)
+	}
+	for _, name := range []string{"a.log", "b.log", "empty.log"} {
+		content := data.Bytes()
+		if name == "empty.log" {
+			content = nil
+		}
+		if err := os.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, _ := url.Parse(srv.URL)
+	h := &Handler{
+		Url:        "https://bucket",
+		UploadRule: FileUploadRule{CompressAlgorithm: compress.AUTO},
+		ctx:        logarchive.Context{Context: context.Background()},
+		client:     cos.NewClient(&cos.BaseURL{BucketURL: u}, srv.Client()),
+		logger:     zap.NewNop().Sugar(),
+	}
+	if !assert.NoError(t, h.UploadRule.provision()) {
+		return
+	}
+
+	// the empty file could not be probed, it is compressed by zstd
+	rule := h.uploadRule(filepath.Join(root, "empty.log"))
+	assert.Equal(t, compress.ZSTD, rule.CompressAlgorithm)
+	assert.Empty(t, h.UploadRule.auto.rules)
+
+	task := &Task{RootPath: root, FilePath: filepath.Join(root, "a.log")}
+	if !assert.NoError(t, h.Execute(task)) {
+		return
+	}
+	rule = h.uploadRule(task.FilePath)
+	assert.NotEqual(t, compress.AUTO, rule.CompressAlgorithm)
+	assert.NoError(t, compress.ValidateCompressOption(rule.compressOption()))
+	assert.Equal(t, "https://bucket/a.log"+compress.GetCompressAlgorithmSuffix(rule.CompressAlgorithm), task.Destination())
+	assert.Less(t, len(s.objects["a.log"+compress.GetCompressAlgorithmSuffix(rule.CompressAlgorithm)]), data.Len())
+
+	// the algorithm is selected once for the directory
+	assert.Same(t, rule, h.uploadRule(filepath.Join(root, "b.log")))
+	assert.Len(t, h.UploadRule.auto.rules, 1)
+}
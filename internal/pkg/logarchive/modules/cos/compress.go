@@ -0,0 +1,198 @@
+package cos
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/tencentyun/cos-go-sdk-v5"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+// defaultMemoryCompressSize is the max size of the files compressed in memory
+// by default, the larger files are compressed into temporary files.
+const defaultMemoryCompressSize = 8 << 20
+
+// compressedFile is the compressed content of a file to upload, it is held in
+// memory, spilled into a temporary file or streamed while uploading.
+type compressedFile struct {
+	buf    *bytes.Buffer
+	path   string
+	stream *countReader
+	size   int64
+
+	release func()
+}
+
+// Size returns the size of the compressed content, the size of the stream is
+// only known after it is read.
+func (c *compressedFile) Size() int64 {
+	if c.stream != nil {
+		return c.stream.n
+	}
+	return c.size
+}
+
+// countReader counts the bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Close releases the memory or removes the temporary file.
+func (c *compressedFile) Close() {
+	if c.release != nil {
+		c.release()
+		c.release = nil
+	}
+}
+
+// compressOption returns the compress option of the upload rule.
+func (r *FileUploadRule) compressOption() compress.CompressOption {
+	return compress.NewCompressOption(r.CompressAlgorithm, compress.EncoderOptions{
+		Level:       r.CompressLevel,
+		WindowSize:  r.CompressWindowSize,
+		Concurrency: r.CompressConcurrency,
+		Dictionary:  r.dictionary,
+		Parallel:    r.CompressParallel,
+	})
+}
+
+// provision checks the options of the upload rule and loads the compress
+// dictionary.
+func (r *FileUploadRule) provision() error {
+	if r.SplitSize < 0 {
+		return fmt.Errorf("invalid split size: %d", r.SplitSize)
+	}
+	if r.SplitRetries < 0 {
+		return fmt.Errorf("invalid split retries: %d", r.SplitRetries)
+	}
+	if r.CompressAlgorithm == compress.NONE {
+		return nil
+	}
+	if r.CompressAlgorithm == compress.AUTO {
+		return r.provisionAuto()
+	}
+	if r.CompressDictionary != "" {
+		dict, err := compress.LoadDictionary(r.CompressDictionary)
+		if err != nil {
+			return err
+		}
+		r.dictionary = dict
+	}
+	return compress.ValidateCompressOption(r.compressOption())
+}
+
+// objectMetadata returns the metadata of the uploaded objects, the name and the
+// id of the compress dictionary are recorded to decompress the objects.
+func (r *FileUploadRule) objectMetadata() *cos.ObjectPutHeaderOptions {
+	if r.dictionary == nil {
+		return nil
+	}
+	header := http.Header{}
+	header.Set("x-cos-meta-compress-dict", r.dictionary.Name)
+	header.Set("x-cos-meta-compress-dict-id", strconv.FormatUint(uint64(r.dictionary.ID), 10))
+	return &cos.ObjectPutHeaderOptions{XCosMetaXXX: &header}
+}
+
+// compressFile compresses the file of the size. The memory is acquired from
+// the budget shared by the outputs before compressing, and the files larger
+// than memoryCompressSize or the budget are streamed to the uploader, or
+// spilled into temporary files if SpillDir is set, so that the memory does not
+// grow with the concurrent uploads of large files.
+func (h *Handler) compressFile(rule *FileUploadRule, filePath string, size int64) (*compressedFile, error) {
+	option := rule.compressOption()
+
+	limit := h.UploadRule.MemoryCompressSize
+	if limit <= 0 {
+		limit = defaultMemoryCompressSize
+	}
+	if budget := h.memory.Limit(); budget > 0 && budget < limit {
+		limit = budget
+	}
+
+	if size > limit {
+		if h.UploadRule.SpillDir != "" {
+			return h.spillCompressFile(filePath, option)
+		}
+		r, err := compress.NewCompressFileReader(filePath, option)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedFile{stream: &countReader{r: r}, release: func() { _ = r.Close() }}, nil
+	}
+
+	// the compressed data is not larger than the file in most cases
+	if err := h.memory.Acquire(h.ctx, size); err != nil {
+		return nil, err
+	}
+	buf := newCompressBuffer()
+	c := &compressedFile{buf: buf, release: func() {
+		freeCompressBuffer(buf)
+		h.memory.Release(size)
+	}}
+	if err := compress.CompressFile(filePath, option, buf); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.size = int64(buf.Len())
+	return c, nil
+}
+
+// spillCompressFile compresses the file into a temporary file in SpillDir.
+func (h *Handler) spillCompressFile(filePath string, option compress.CompressOption) (*compressedFile, error) {
+	f, err := os.CreateTemp(h.UploadRule.SpillDir, "logarchive-compress-*")
+	if err != nil {
+		return nil, err
+	}
+	c := &compressedFile{path: f.Name(), release: func() { _ = os.Remove(f.Name()) }}
+
+	err = compress.CompressFile(filePath, option, f)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.size = info.Size()
+	return c, nil
+}
+
+// upload puts the compressed content as the object of the key, the temporary
+// file is uploaded by parts and the stream is uploaded by chunks.
+func (h *Handler) upload(rule *FileUploadRule, key string, c *compressedFile) error {
+	var putOpt *cos.ObjectPutOptions
+	var uploadOpt *cos.MultiUploadOptions
+	if metadata := rule.objectMetadata(); metadata != nil {
+		putOpt = &cos.ObjectPutOptions{ObjectPutHeaderOptions: metadata}
+		uploadOpt = &cos.MultiUploadOptions{OptIni: &cos.InitiateMultipartUploadOptions{ObjectPutHeaderOptions: metadata}}
+	}
+
+	var err error
+	switch {
+	case c.buf != nil:
+		_, err = h.client.Object.Put(h.ctx, key, c.buf, putOpt)
+	case c.path != "":
+		_, _, err = h.client.Object.Upload(h.ctx, key, c.path, uploadOpt)
+	default:
+		_, err = h.client.Object.Put(h.ctx, key, c.stream, putOpt)
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package cos
+
+import (
+	"bytes"
+	"context"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestCompressFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.log")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spillDir := t.TempDir()
+	budget := logarchive.NewMemoryBudget(1 << 20)
+	h := &Handler{
+		UploadRule: FileUploadRule{CompressAlgorithm: compress.ZSTD, SpillDir: spillDir},
+		ctx:        logarchive.Context{Context: context.Background()},
+		memory:     budget,
+	}
+
+	decode := func(r io.Reader) []byte {
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dec.Close()
+		out, err := io.ReadAll(dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// the small file is compressed in memory
+	c, err := h.compressFile(&h.UploadRule, filePath, int64(len(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.NotNil(t, c.buf) {
+		assert.Equal(t, int64(c.buf.Len()), c.size)
+		assert.Equal(t, data, decode(bytes.NewReader(c.buf.Bytes())))
+	}
+	c.Close()
+
+	// the memory is released, the whole budget could be acquired
+	assert.NoError(t, budget.Acquire(context.Background(), 1<<20))
+	budget.Release(1 << 20)
+
+	// the file larger than memoryCompressSize is spilled
+	h.UploadRule.MemoryCompressSize = 1024
+	c, err = h.compressFile(&h.UploadRule, filePath, int64(len(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, c.buf)
+	assert.Equal(t, spillDir, filepath.Dir(c.path))
+	f, err := os.Open(c.path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, decode(f))
+		f.Close()
+	}
+	c.Close()
+	assert.NoFileExists(t, c.path)
+}
+
+func TestCompressFileStream(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.log")
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{
+		UploadRule: FileUploadRule{CompressAlgorithm: compress.ZSTD, MemoryCompressSize: 1024},
+		ctx:        logarchive.Context{Context: context.Background()},
+		memory:     logarchive.NewMemoryBudget(1 << 20),
+	}
+
+	// the file larger than memoryCompressSize is streamed without spillDir
+	c, err := h.compressFile(&h.UploadRule, filePath, int64(len(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	assert.Nil(t, c.buf)
+	assert.Empty(t, c.path)
+	if !assert.NotNil(t, c.stream) {
+		return
+	}
+
+	compressed, err := io.ReadAll(c.stream)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(len(compressed)), c.Size())
+	dec, err := zstd.NewReader(bytes.NewReader(compressed))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dec.Close()
+	out, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+}
+
+func TestUploadRuleProvision(t *testing.T) {
+	tests := []struct {
+		rule    FileUploadRule
+		wantErr bool
+	}{
+		{FileUploadRule{}, false},
+		{FileUploadRule{CompressAlgorithm: compress.GZIP}, false},
+		{FileUploadRule{CompressAlgorithm: compress.GZIP, CompressLevel: 9}, false},
+		{FileUploadRule{CompressAlgorithm: compress.GZIP, CompressLevel: 10}, true},
+		{FileUploadRule{CompressAlgorithm: compress.ZSTD, CompressLevel: 19}, false},
+		{FileUploadRule{CompressAlgorithm: compress.LZ4, CompressLevel: 1}, true},
+		{FileUploadRule{CompressAlgorithm: compress.XZ, CompressLevel: compress.LevelBest}, false},
+		{FileUploadRule{CompressAlgorithm: compress.XZ, CompressLevel: 10}, true},
+		{FileUploadRule{CompressAlgorithm: "bzip2"}, true},
+		{FileUploadRule{CompressAlgorithm: compress.ZSTD, CompressLevel: compress.LevelBest, CompressWindowSize: 1 << 22, CompressConcurrency: 1}, false},
+		{FileUploadRule{CompressAlgorithm: compress.ZSTD, CompressWindowSize: 3000}, true},
+		{FileUploadRule{CompressAlgorithm: compress.GZIP, CompressConcurrency: 2}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.rule.provision()
+		if tt.wantErr {
+			assert.Error(t, err, "%+v", tt.rule)
+		} else {
+			assert.NoError(t, err, "%+v", tt.rule)
+		}
+	}
+}
+
+func TestUploadRuleUnmarshal(t *testing.T) {
+	var rule FileUploadRule
+	data := []byte("compress: zstd\ncompressLevel: better\ncompressWindowSize: 4194304\ncompressConcurrency: 2\n")
+	if assert.NoError(t, yaml.Unmarshal(data, &rule)) {
+		assert.Equal(t, compress.LevelBetter, rule.CompressLevel)
+		assert.Equal(t, 1<<22, rule.CompressWindowSize)
+		assert.Equal(t, 2, rule.CompressConcurrency)
+		assert.NoError(t, rule.provision())
+	}
+
+	rule = FileUploadRule{}
+	if assert.NoError(t, yaml.Unmarshal([]byte("compress: gzip\ncompressLevel: 9\ncompressParallel: 4\n"), &rule)) {
+		assert.Equal(t, compress.Level(9), rule.CompressLevel)
+		assert.Equal(t, 4, rule.CompressParallel)
+		assert.NoError(t, rule.provision())
+	}
+	assert.Error(t, yaml.Unmarshal([]byte("compressLevel: slowest\n"), &rule))
+}
+
+func TestExecuteCompressDictionary(t *testing.T) {
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("x-cos-hash-crc64ecma", strconv.FormatUint(crc64.Checksum(body, crc64.MakeTable(crc64.ECMA)), 10))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("INFO session started user=alice action=login result=ok\n"), 20)
+	dictPath := filepath.Join(root, "session.dict")
+	filePath := filepath.Join(root, "a.log")
+	data := []byte("INFO session started user=bob action=login result=ok\n")
+	if err := os.WriteFile(dictPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	h := &Handler{
+		Url:        "https://bucket",
+		UploadRule: FileUploadRule{CompressAlgorithm: compress.ZSTD, CompressDictionary: dictPath},
+		ctx:        logarchive.Context{Context: context.Background()},
+		client:     cos.NewClient(&cos.BaseURL{BucketURL: u}, srv.Client()),
+		logger:     zap.NewNop().Sugar(),
+	}
+	if !assert.NoError(t, h.UploadRule.provision()) {
+		return
+	}
+	if !assert.NoError(t, h.Execute(&Task{RootPath: root, FilePath: filePath})) {
+		return
+	}
+
+	dict := compress.NewDictionary("session", content)
+	assert.Equal(t, "session", header.Get("x-cos-meta-compress-dict"))
+	assert.Equal(t, strconv.FormatUint(uint64(dict.ID), 10), header.Get("x-cos-meta-compress-dict-id"))
+
+	dec, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderDictRaw(0, content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dec.Close()
+	got, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// the dictionary is only supported by zstd
+	rule := FileUploadRule{CompressAlgorithm: compress.GZIP, CompressDictionary: dictPath}
+	assert.Error(t, rule.provision())
+	rule = FileUploadRule{CompressAlgorithm: compress.ZSTD, CompressDictionary: filepath.Join(root, "nonexistence.dict")}
+	assert.Error(t, rule.provision())
+}
@@ -2,12 +2,16 @@ package cos
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -42,6 +46,35 @@ type FileUploadRule struct {
 	CompressAlgorithm compress.CompressAlgorithm `yaml:"compress,omitempty" json:"compress,omitempty"`
 	MaxFileSize       int                        `yaml:"maxFileSize,omitempty" json:"maxFileSize,omitempty"`
 	Timeout           int64                      `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// CompressLevel is the level of the compression algorithm, a number or one of
+	// fastest, default, better and best, the default level is used if it is empty
+	CompressLevel compress.Level `yaml:"compressLevel,omitempty" json:"compressLevel,omitempty"`
+	// CompressWindowSize is the window size of the zstd encoder
+	CompressWindowSize int `yaml:"compressWindowSize,omitempty" json:"compressWindowSize,omitempty"`
+	// CompressConcurrency is the number of the goroutines of the zstd encoder
+	CompressConcurrency int `yaml:"compressConcurrency,omitempty" json:"compressConcurrency,omitempty"`
+	// CompressParallel is the number of the blocks of a large file compressed in
+	// parallel, so that a large file is compressed by multiple cores
+	CompressParallel int `yaml:"compressParallel,omitempty" json:"compressParallel,omitempty"`
+	// CompressDictionary is the dictionary file of the zstd encoder, its name and id
+	// are recorded in the metadata of the objects
+	CompressDictionary string `yaml:"compressDictionary,omitempty" json:"compressDictionary,omitempty"`
+	// MemoryCompressSize is the max size of the files compressed in memory, 8MB by default
+	MemoryCompressSize int64 `yaml:"memoryCompressSize,omitempty" json:"memoryCompressSize,omitempty"`
+	// SpillDir keeps the temporary compressed files of the large files, which are streamed if it is empty
+	SpillDir string `yaml:"spillDir,omitempty" json:"spillDir,omitempty"`
+	// SplitSize splits the files larger than it into the parts of the size, which
+	// are uploaded with an index object, the files are not split if it is zero
+	SplitSize int64 `yaml:"splitSize,omitempty" json:"splitSize,omitempty"`
+	// SplitRetries is the attempts of uploading each part, 3 by default
+	SplitRetries int `yaml:"splitRetries,omitempty" json:"splitRetries,omitempty"`
+	// CompressAutoMinThroughput is the min throughput in bytes per second of the
+	// algorithm selected by 'compress: auto', 50MB/s by default
+	CompressAutoMinThroughput int64 `yaml:"compressAutoMinThroughput,omitempty" json:"compressAutoMinThroughput,omitempty"`
+
+	dictionary *compress.Dictionary
+	// auto are the upload rules selected for the directories by 'compress: auto'
+	auto *autoCompress
 }
 
 // Handler implements COS file archiving functionality
@@ -50,11 +83,24 @@ type Handler struct {
 	SecretID   string         `yaml:"secretID,omitempty" json:"secretID,omitempty"`
 	SecretKey  string         `yaml:"secretKey,omitempty" json:"secretKey,omitempty"`
 	UploadRule FileUploadRule `yaml:"uploadRule,omitempty" json:"uploadRule,omitempty"`
+	// Journal is the file to record the uploaded objects, it is used by reconciliation
+	Journal string `yaml:"journal,omitempty" json:"journal,omitempty"`
+	// CredentialRaw loads the credential from a provider instead of SecretID and SecretKey
+	CredentialRaw json.RawMessage `yaml:"credential,omitempty" json:"credential,omitempty" logarchive:"namespace=credential inline_key=type"`
 
 	ctx logarchive.Context
 
-	task   logarchive.OutputTaskInfo
-	client *cos.Client
+	task        logarchive.OutputTaskInfo
+	client      *cos.Client
+	journal     *journal
+	credentials *logarchive.CredentialCache
+	memory      *logarchive.MemoryBudget
+
+	// lastSuccess is the monotonic nanoseconds of the last successful request
+	lastSuccess int64
+
+	// dryRun logs the uploads instead of executing them
+	dryRun bool
 
 	logger *zap.SugaredLogger
 }
@@ -74,21 +120,91 @@ func (h *Handler) Provision(ctx logarchive.Context) error {
 	h.ctx = ctx
 	h.logger = ctx.Logger().Sugar().Named("cos")
 	h.task = (Task{}).TaskInfo()
+	h.dryRun = ctx.DryRun()
+	h.memory = ctx.MemoryBudget()
 
-	url, _ := url.Parse(h.Url)
-	bktUrl := &cos.BaseURL{BucketURL: url}
+	if err := h.UploadRule.provision(); err != nil {
+		return fmt.Errorf("invalid upload rule: %v", err)
+	}
+
+	if err := h.LoadCredential(ctx); err != nil {
+		return err
+	}
 
 	if h.client == nil {
-		h.client = cos.NewClient(bktUrl, &http.Client{
-			Transport: &cos.AuthorizationTransport{
-				SecretID:  h.SecretID,
-				SecretKey: h.SecretKey,
-			},
-		})
+		h.client = h.newClient()
+	}
+
+	if h.Journal != "" {
+		h.journal = &journal{path: h.Journal}
+	}
+	return nil
+}
+
+// LoadCredential loads the credential provider of the handler, and resolves the
+// credential to check the provider works.
+func (h *Handler) LoadCredential(ctx logarchive.Context) error {
+	if h.CredentialRaw == nil {
+		return nil
+	}
+	if h.SecretID != "" || h.SecretKey != "" {
+		return fmt.Errorf("secretID and secretKey could not be used with credential")
+	}
+
+	mod, err := ctx.LoadModule(h, "CredentialRaw")
+	if err != nil {
+		return err
+	}
+	provider, ok := mod.(logarchive.CredentialProvider)
+	if !ok {
+		return fmt.Errorf("module %T is not a credential provider", mod)
+	}
+
+	h.credentials = logarchive.NewCredentialCache(provider)
+	if _, err := h.credentials.Get(ctx); err != nil {
+		return fmt.Errorf("resolve credential: %v", err)
 	}
 	return nil
 }
 
+func (h *Handler) newClient() *cos.Client {
+	url, _ := url.Parse(h.Url)
+	bktUrl := &cos.BaseURL{BucketURL: url}
+
+	var transport http.RoundTripper = &cos.AuthorizationTransport{
+		SecretID:  h.SecretID,
+		SecretKey: h.SecretKey,
+	}
+	if h.credentials != nil {
+		transport = &credentialTransport{credentials: h.credentials}
+	}
+	return cos.NewClient(bktUrl, &http.Client{Transport: transport})
+}
+
+// credentialTransport signs the requests with the credential of the provider,
+// which is refreshed before it expires.
+type credentialTransport struct {
+	credentials *logarchive.CredentialCache
+	transport   http.RoundTripper
+}
+
+func (t *credentialTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cred, err := t.credentials.Get(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("get credential: %v", err)
+	}
+
+	// the request must not be modified by the round tripper
+	req = req.Clone(req.Context())
+	cos.AddAuthorizationHeader(cred.SecretID, cred.SecretKey, cred.SessionToken, req, cos.NewAuthTime(time.Hour))
+
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return transport.RoundTrip(req)
+}
+
 // Validate implement the output interface
 func (h *Handler) Validate() error {
 	if h.client == nil {
@@ -103,6 +219,7 @@ func (h *Handler) Validate() error {
 	if !ok {
 		return fmt.Errorf("cos bucket does not exist")
 	}
+	h.markSuccess()
 	return nil
 }
 
@@ -144,55 +261,123 @@ func (h *Handler) Execute(t logarchive.OutputTask) error {
 		return fmt.Errorf("input: %s is directory", task.FilePath)
 	}
 
-	dstPath, err := filepath.Rel(task.RootPath, task.FilePath)
-	if err != nil {
-		h.logger.Errorf("can't get targetpath: %s relative path to basepath: %s for reason: %v", task.FilePath, task.RootPath, err)
-		return err
+	dstPath := task.DstPath
+	if dstPath == "" {
+		dstPath, err = filepath.Rel(task.RootPath, task.FilePath)
+		if err != nil {
+			h.logger.Errorf("can't get targetpath: %s relative path to basepath: %s for reason: %v", task.FilePath, task.RootPath, err)
+			return err
+		}
 	}
 
-	prefix := getArchivePrefix(h.UploadRule.ArchiveRule, task.FilePath)
-	if prefix != "" {
-		dstPath = filepath.Join(prefix, dstPath)
-	}
+	dstPath = objectKey(getArchivePrefix(h.UploadRule.ArchiveRule, task.FilePath), dstPath)
 
 	// add suffix by compress type
-	dstPath += compress.GetCompressAlgorithmSuffix(h.UploadRule.CompressAlgorithm)
+	rule := h.uploadRule(task.FilePath)
+	dstPath += compress.GetCompressAlgorithmSuffix(rule.CompressAlgorithm)
+
+	if h.dryRun {
+		return h.dryRunUpload(rule, task, dstPath, info.Size())
+	}
+
+	if h.UploadRule.SplitSize > 0 && info.Size() > h.UploadRule.SplitSize {
+		indexKey, err := h.splitUpload(rule, task.FilePath, dstPath, info.Size())
+		if err != nil {
+			errCode = codeCallAPIFailed
+			h.logger.Errorf("split upload file: %s failed: %v", task.FilePath, err)
+			return err
+		}
+		task.destination = h.objectURL(indexKey)
+		return nil
+	}
 
 	// use cos advanced api
-	if h.UploadRule.CompressAlgorithm == compress.NONE {
+	if rule.CompressAlgorithm == compress.NONE {
 		_, _, err = h.client.Object.Upload(h.ctx, dstPath, task.FilePath, nil)
 		if err != nil {
 			errCode = codeCallAPIFailed
 			h.logger.Errorf("call upload api: %v", err)
+			return err
 		}
-		return err
+		h.recordUpload(task.FilePath, dstPath, info.Size())
+		task.destination = h.objectURL(dstPath)
+		return nil
 	}
 
 	// compress target file
-	buf := newCompressBuffer()
-	defer freeCompressBuffer(buf)
-
-	err = compress.CompressFile(task.FilePath, compress.NewDefaultCompressOption(h.UploadRule.CompressAlgorithm), buf)
-	if err != nil && err != compress.ErrUnexpectedEOF {
+	c, err := h.compressFile(rule, task.FilePath, info.Size())
+	if err != nil {
 		errCode = codeCompressFailed
 		h.logger.Errorf("compress file: %s failed: %v", task.FilePath, err)
 		return err
 	}
+	defer c.Close()
 
-	if err == compress.ErrUnexpectedEOF {
-		logarchive.OutputTruncateTotal.WithLabelValues(h.ArchiveModule().ID.Name()).Inc()
-		h.logger.Warnf("file %s size %d is too larger", task.FilePath, info.Size())
-	}
-
-	_, err = h.client.Object.Put(h.ctx, dstPath, buf, nil)
-	if err != nil {
+	if err = h.upload(rule, dstPath, c); err != nil {
 		errCode = codeCallAPIFailed
 		h.logger.Errorf("call upload api: %v", err)
 		return err
 	}
+	h.recordUpload(task.FilePath, dstPath, c.Size())
+	task.destination = h.objectURL(dstPath)
+	return nil
+}
+
+// dryRunUpload logs the upload instead of executing it, the size is estimated
+// by compressing the file.
+func (h *Handler) dryRunUpload(rule *FileUploadRule, task *Task, key string, size int64) error {
+	// the split file is referred by the index object
+	if h.UploadRule.SplitSize > 0 && size > h.UploadRule.SplitSize {
+		key += splitIndexSuffix
+	}
+
+	if rule.CompressAlgorithm != compress.NONE {
+		c, err := h.compressFile(rule, task.FilePath, size)
+		if err != nil {
+			h.logger.Errorf("compress file: %s failed: %v", task.FilePath, err)
+			return err
+		}
+		if c.stream != nil {
+			_, err = io.Copy(io.Discard, c.stream)
+		}
+		size = c.Size()
+		c.Close()
+		if err != nil {
+			h.logger.Errorf("compress file: %s failed: %v", task.FilePath, err)
+			return err
+		}
+	}
+
+	task.destination = h.objectURL(key)
+	h.logger.Infof("dry run: upload file: %s to %s, size: %d", task.FilePath, task.destination, size)
 	return nil
 }
 
+// objectURL returns the url of the object in the bucket.
+func (h *Handler) objectURL(key string) string {
+	return strings.TrimSuffix(h.Url, "/") + "/" + key
+}
+
+func (h *Handler) recordUpload(filePath, key string, size int64) {
+	logarchive.OutputBytesTotal.WithLabelValues(h.ArchiveModule().ID.Name()).Add(float64(size))
+	h.markSuccess()
+
+	if h.journal == nil {
+		return
+	}
+
+	r := &JournalRecord{Time: time.Now(), File: filePath, Key: key, Size: size}
+	if err := h.journal.append(r); err != nil {
+		h.logger.Errorf("record upload journal of %s: %v", key, err)
+	}
+}
+
+// objectKey returns the key of the object, the keys are always separated by
+// slashes even if the paths are separated by backslashes on windows.
+func objectKey(prefix, dstPath string) string {
+	return path.Join(prefix, filepath.ToSlash(dstPath))
+}
+
 func getArchivePrefix(rule ArchiveRule, in string) string {
 	var modifyTime time.Time
 
@@ -222,8 +407,10 @@ func newCompressBuffer() *bytes.Buffer {
 	return buf
 }
 
+// freeCompressBuffer puts the buffer back to the pool, the buffers larger than
+// the files compressed in memory by default are dropped.
 func freeCompressBuffer(buf *bytes.Buffer) {
-	if buf == nil || buf.Len() > 1024*1024 {
+	if buf == nil || buf.Cap() > defaultMemoryCompressSize {
 		return
 	}
 	buf.Reset()
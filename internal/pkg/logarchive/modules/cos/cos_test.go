@@ -0,0 +1,15 @@
+package cos
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectKey(t *testing.T) {
+	// the paths are separated by backslashes on windows
+	assert.Equal(t, "2024010203/app/app.log", objectKey("2024010203", filepath.Join("app", "app.log")))
+	assert.Equal(t, "app/app.log", objectKey("", filepath.Join("app", "app.log")))
+	assert.Equal(t, "app.log", objectKey("", "app.log"))
+}
@@ -0,0 +1,54 @@
+package cos
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+type staticCredential struct{}
+
+func (staticCredential) Credential(_ context.Context) (*logarchive.Credential, error) {
+	return &logarchive.Credential{
+		SecretID:     "AKIDtest",
+		SecretKey:    "key",
+		SessionToken: "token",
+		Expiration:   time.Now().Add(time.Hour),
+	}, nil
+}
+
+func TestCredentialTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.Contains(r.Header.Get("Authorization"), "q-ak=AKIDtest"), r.Header.Get("Authorization"))
+		assert.Equal(t, "token", r.Header.Get("x-cos-security-token"))
+	}))
+	defer srv.Close()
+
+	h := &Handler{
+		Url:         srv.URL,
+		credentials: logarchive.NewCredentialCache(staticCredential{}),
+	}
+	h.client = h.newClient()
+
+	ok, err := h.client.Bucket.IsExist(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLoadCredentialExclusive(t *testing.T) {
+	h := &Handler{SecretID: "id", CredentialRaw: json.RawMessage(`{"type": "env"}`)}
+	assert.ErrorContains(t, h.LoadCredential(logarchive.Context{}), "could not be used with credential")
+
+	// nothing is loaded without credential
+	h = &Handler{SecretID: "id", SecretKey: "key"}
+	assert.NoError(t, h.LoadCredential(logarchive.Context{}))
+	assert.Nil(t, h.credentials)
+}
@@ -0,0 +1,52 @@
+package cos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestExecuteDryRun(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.log")
+	if err := os.WriteFile(filePath, []byte("data data data data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	for _, algorithm := range []compress.CompressAlgorithm{compress.NONE, compress.ZSTD} {
+		h := &Handler{
+			Url:        "https://bucket",
+			UploadRule: FileUploadRule{CompressAlgorithm: algorithm},
+			ctx:        logarchive.Context{Context: context.Background()},
+			client:     cos.NewClient(&cos.BaseURL{BucketURL: u}, srv.Client()),
+			dryRun:     true,
+			logger:     zap.NewNop().Sugar(),
+		}
+
+		task := &Task{RootPath: root, FilePath: filePath}
+		if !assert.NoError(t, h.Execute(task)) {
+			continue
+		}
+		assert.Equal(t, "https://bucket/a.log"+compress.GetCompressAlgorithmSuffix(algorithm), task.Destination())
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
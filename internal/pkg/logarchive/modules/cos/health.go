@@ -0,0 +1,48 @@
+package cos
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// readyCheckInterval is how long a successful request proves the bucket is reachable
+	readyCheckInterval = time.Minute
+	readyCheckTimeout  = 5 * time.Second
+)
+
+// monotonicBase is the base of the monotonic time, which is not affected by the
+// wall clock jumps.
+var monotonicBase = time.Now()
+
+func monotonicNow() int64 {
+	return int64(time.Since(monotonicBase))
+}
+
+// Ready implement the ready checker interface. The bucket is checked again
+// when no request has succeeded in the last minute.
+func (h *Handler) Ready() error {
+	if last := atomic.LoadInt64(&h.lastSuccess); last != 0 && time.Duration(monotonicNow()-last) < readyCheckInterval {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, readyCheckTimeout)
+	defer cancel()
+
+	ok, err := h.client.Bucket.IsExist(ctx)
+	if err != nil {
+		return fmt.Errorf("check cos bucket: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("cos bucket does not exist")
+	}
+	h.markSuccess()
+	return nil
+}
+
+func (h *Handler) markSuccess() {
+	// the zero value means no request has succeeded
+	atomic.StoreInt64(&h.lastSuccess, max(monotonicNow(), 1))
+}
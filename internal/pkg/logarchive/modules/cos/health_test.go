@@ -0,0 +1,41 @@
+package cos
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestHandlerReady(t *testing.T) {
+	var status, requests int32 = http.StatusOK, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	h := &Handler{
+		ctx:    logarchive.Context{Context: context.Background()},
+		client: cos.NewClient(&cos.BaseURL{BucketURL: u}, srv.Client()),
+	}
+
+	assert.NoError(t, h.Ready())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// the bucket is not checked again in a minute
+	atomic.StoreInt32(&status, http.StatusForbidden)
+	assert.NoError(t, h.Ready())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	atomic.StoreInt64(&h.lastSuccess, 0)
+	assert.ErrorContains(t, h.Ready(), "check cos bucket")
+}
@@ -0,0 +1,74 @@
+package cos
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// JournalRecord is a line of the upload journal, it records an object which
+// has been uploaded successfully.
+type JournalRecord struct {
+	Time time.Time `json:"time"`
+	File string    `json:"file"`
+	Key  string    `json:"key"`
+	Size int64     `json:"size"`
+}
+
+type journal struct {
+	mu   sync.Mutex
+	path string
+}
+
+// append writes the record to the end of the journal file.
+func (j *journal) append(r *JournalRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadJournal reads the upload journal, the later records of the same key
+// replace the earlier ones.
+func LoadJournal(path string) (map[string]*JournalRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make(map[string]*JournalRecord)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		r := new(JournalRecord)
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("journal %s line %d: %v", path, line, err)
+		}
+		records[r.Key] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
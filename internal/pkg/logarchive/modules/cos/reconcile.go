@@ -0,0 +1,98 @@
+package cos
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// ReconcileReport is the difference between the upload journal and the bucket.
+type ReconcileReport struct {
+	// MissingRemote are the journal records whose object is not found in the bucket
+	MissingRemote []*JournalRecord
+	// MissingLocal are the objects in the bucket which are not recorded in the journal
+	MissingLocal []cos.Object
+}
+
+// Reconcile lists the objects with prefix in the bucket and compares them with
+// the upload journal, only the records and objects since the given time are checked.
+func (h *Handler) Reconcile(ctx context.Context, prefix string, since time.Time) (*ReconcileReport, error) {
+	if h.Journal == "" {
+		return nil, fmt.Errorf("journal is not configured")
+	}
+
+	records, err := LoadJournal(h.Journal)
+	if err != nil {
+		return nil, fmt.Errorf("load journal: %v", err)
+	}
+
+	if h.client == nil {
+		h.client = h.newClient()
+	}
+
+	objects, err := h.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list objects: %v", err)
+	}
+	return compareJournal(records, objects, prefix, since), nil
+}
+
+func (h *Handler) listObjects(ctx context.Context, prefix string) ([]cos.Object, error) {
+	var (
+		objects []cos.Object
+		marker  string
+	)
+	for {
+		res, _, err := h.client.Bucket.Get(ctx, &cos.BucketGetOptions{
+			Prefix:  prefix,
+			Marker:  marker,
+			MaxKeys: 1000,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		objects = append(objects, res.Contents...)
+		if !res.IsTruncated {
+			return objects, nil
+		}
+
+		marker = res.NextMarker
+		if marker == "" && len(res.Contents) != 0 {
+			marker = res.Contents[len(res.Contents)-1].Key
+		}
+	}
+}
+
+func compareJournal(records map[string]*JournalRecord, objects []cos.Object, prefix string, since time.Time) *ReconcileReport {
+	report := new(ReconcileReport)
+
+	remote := make(map[string]struct{}, len(objects))
+	for _, o := range objects {
+		remote[o.Key] = struct{}{}
+
+		if modified, err := time.Parse(time.RFC3339, o.LastModified); err == nil && modified.Before(since) {
+			continue
+		}
+		if _, ok := records[o.Key]; !ok {
+			report.MissingLocal = append(report.MissingLocal, o)
+		}
+	}
+
+	for key, r := range records {
+		if !strings.HasPrefix(key, prefix) || r.Time.Before(since) {
+			continue
+		}
+		if _, ok := remote[key]; !ok {
+			report.MissingRemote = append(report.MissingRemote, r)
+		}
+	}
+
+	sort.Slice(report.MissingRemote, func(i, j int) bool { return report.MissingRemote[i].Key < report.MissingRemote[j].Key })
+	sort.Slice(report.MissingLocal, func(i, j int) bool { return report.MissingLocal[i].Key < report.MissingLocal[j].Key })
+	return report
+}
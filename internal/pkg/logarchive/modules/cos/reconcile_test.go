@@ -0,0 +1,57 @@
+package cos
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+func TestJournalAppendAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j := &journal{path: path}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, r := range []*JournalRecord{
+		{Time: now, File: "/data/a.log", Key: "a.log.gz", Size: 1},
+		{Time: now, File: "/data/b.log", Key: "b.log.gz", Size: 2},
+		{Time: now.Add(time.Second), File: "/data/a.log", Key: "a.log.gz", Size: 3},
+	} {
+		if !assert.NoError(t, j.append(r)) {
+			return
+		}
+	}
+
+	records, err := LoadJournal(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, records, 2)
+	assert.Equal(t, int64(3), records["a.log.gz"].Size)
+	assert.Equal(t, "/data/b.log", records["b.log.gz"].File)
+}
+
+func TestCompareJournal(t *testing.T) {
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	records := map[string]*JournalRecord{
+		"logs/ok.gz":          {Key: "logs/ok.gz", Time: since.Add(time.Hour)},
+		"logs/lost.gz":        {Key: "logs/lost.gz", Time: since.Add(time.Hour)},
+		"logs/old-lost.gz":    {Key: "logs/old-lost.gz", Time: since.Add(-time.Hour)},
+		"other/not-prefix.gz": {Key: "other/not-prefix.gz", Time: since.Add(time.Hour)},
+	}
+	objects := []cos.Object{
+		{Key: "logs/ok.gz", LastModified: "2024-01-02T01:00:00.000Z"},
+		{Key: "logs/unknown.gz", LastModified: "2024-01-02T02:00:00.000Z"},
+		{Key: "logs/old-unknown.gz", LastModified: "2024-01-01T02:00:00.000Z"},
+	}
+
+	report := compareJournal(records, objects, "logs/", since)
+	if assert.Len(t, report.MissingRemote, 1) {
+		assert.Equal(t, "logs/lost.gz", report.MissingRemote[0].Key)
+	}
+	if assert.Len(t, report.MissingLocal, 1) {
+		assert.Equal(t, "logs/unknown.gz", report.MissingLocal[0].Key)
+	}
+}
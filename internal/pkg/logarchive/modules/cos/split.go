@@ -0,0 +1,172 @@
+package cos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/tencentyun/cos-go-sdk-v5"
+
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+const (
+	// defaultSplitRetries is the attempts of uploading each part by default
+	defaultSplitRetries = 3
+	// splitIndexSuffix is the suffix of the index object of the split file
+	splitIndexSuffix = ".index"
+	// splitLineWindow is the max size searched backwards for the end of line
+	// at the end of each part
+	splitLineWindow = 64 << 10
+)
+
+// splitRetryInterval is the interval before retrying a part, it grows with the
+// attempts.
+var splitRetryInterval = time.Second
+
+// SplitIndex is the index object of a file uploaded in parts. The parts are
+// compressed independently, each one could be decompressed alone, and the
+// concatenation of the decompressed parts is the file.
+type SplitIndex struct {
+	File     string                     `json:"file"`
+	Size     int64                      `json:"size"`
+	Compress compress.CompressAlgorithm `json:"compress,omitempty"`
+	Parts    []SplitPart                `json:"parts"`
+}
+
+// SplitPart is a part of the split file.
+type SplitPart struct {
+	Key string `json:"key"`
+	// Offset and Size are the range of the part in the file
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// UploadSize is the size of the uploaded object
+	UploadSize int64 `json:"uploadSize"`
+}
+
+// splitPartKey returns the object key of the i-th part.
+func splitPartKey(key string, i int) string {
+	return fmt.Sprintf("%s.%03d", key, i)
+}
+
+// splitRanges splits the file of the size into the ranges not larger than
+// splitSize. The ranges end at the end of lines if possible, so that the lines
+// are not broken into the parts.
+func splitRanges(f io.ReaderAt, size, splitSize int64) ([][2]int64, error) {
+	var ranges [][2]int64
+	window := make([]byte, min(splitSize, splitLineWindow))
+	for offset := int64(0); offset < size; {
+		end := offset + splitSize
+		if end >= size {
+			ranges = append(ranges, [2]int64{offset, size})
+			break
+		}
+
+		if _, err := f.ReadAt(window, end-int64(len(window))); err != nil {
+			return nil, err
+		}
+		if i := bytes.LastIndexByte(window, '\n'); i >= 0 {
+			end = end - int64(len(window)) + int64(i) + 1
+		}
+		ranges = append(ranges, [2]int64{offset, end})
+		offset = end
+	}
+	return ranges, nil
+}
+
+// splitUpload uploads the file in parts of SplitSize and the index of the parts,
+// each part is retried separately. It returns the key of the index object.
+func (h *Handler) splitUpload(rule *FileUploadRule, filePath, key string, size int64) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ranges, err := splitRanges(f, size, h.UploadRule.SplitSize)
+	if err != nil {
+		return "", fmt.Errorf("split file: %s failed: %v", filePath, err)
+	}
+
+	index := &SplitIndex{File: filePath, Size: size, Compress: rule.CompressAlgorithm}
+	for i, r := range ranges {
+		part := SplitPart{Key: splitPartKey(key, i), Offset: r[0], Size: r[1] - r[0]}
+		err := h.retryPart(part.Key, func() error {
+			n, err := h.uploadPart(rule, part.Key, io.NewSectionReader(f, part.Offset, part.Size))
+			part.UploadSize = n
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+		h.recordUpload(filePath, part.Key, part.UploadSize)
+		index.Parts = append(index.Parts, part)
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return "", err
+	}
+	indexKey := key + splitIndexSuffix
+	err = h.retryPart(indexKey, func() error {
+		_, err := h.client.Object.Put(h.ctx, indexKey, bytes.NewReader(data), nil)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	h.recordUpload(filePath, indexKey, int64(len(data)))
+	return indexKey, nil
+}
+
+// retryPart calls upload until it succeeds or the attempts reach SplitRetries.
+func (h *Handler) retryPart(key string, upload func() error) error {
+	retries := h.UploadRule.SplitRetries
+	if retries <= 0 {
+		retries = defaultSplitRetries
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := upload()
+		if err == nil {
+			return nil
+		}
+		if attempt >= retries {
+			return fmt.Errorf("upload part: %s failed after %d attempts: %v", key, attempt, err)
+		}
+		h.logger.Warnf("upload part: %s failed, attempt: %d, retry: %v", key, attempt, err)
+
+		select {
+		case <-h.ctx.Done():
+			return h.ctx.Err()
+		case <-time.After(time.Duration(attempt) * splitRetryInterval):
+		}
+	}
+}
+
+// uploadPart compresses the part while uploading it, and returns the size of
+// the uploaded object.
+func (h *Handler) uploadPart(rule *FileUploadRule, key string, r io.Reader) (int64, error) {
+	var opt *cos.ObjectPutOptions
+	if metadata := rule.objectMetadata(); metadata != nil {
+		opt = &cos.ObjectPutOptions{ObjectPutHeaderOptions: metadata}
+	}
+
+	if rule.CompressAlgorithm == compress.NONE {
+		cr := &countReader{r: r}
+		_, err := h.client.Object.Put(h.ctx, key, cr, opt)
+		return cr.n, err
+	}
+
+	rc, err := compress.NewCompressReader(r, rule.compressOption())
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	cr := &countReader{r: rc}
+	_, err = h.client.Object.Put(h.ctx, key, cr, opt)
+	return cr.n, err
+}
@@ -0,0 +1,150 @@
+package cos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/pkg/compress"
+)
+
+func TestSplitRanges(t *testing.T) {
+	data := []byte("aaaa\nbbbb\ncccc\ndddddddddddd\ne")
+	ranges, err := splitRanges(bytes.NewReader(data), int64(len(data)), 8)
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the parts end at the end of lines, the long line is cut
+	assert.Equal(t, [][2]int64{{0, 5}, {5, 10}, {10, 15}, {15, 23}, {23, 29}}, ranges)
+
+	ranges, err = splitRanges(bytes.NewReader(data), int64(len(data)), 100)
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][2]int64{{0, 29}}, ranges)
+	}
+}
+
+// objectServer is a fake bucket keeping the uploaded objects, the uploads of
+// the keys in fails fail the times.
+type objectServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	fails   map[string]int
+}
+
+func (s *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	key := strings.TrimPrefix(r.URL.Path, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fails[key] > 0 {
+		s.fails[key]--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.objects[key] = body
+	w.Header().Set("x-cos-hash-crc64ecma", strconv.FormatUint(crc64.Checksum(body, crc64.MakeTable(crc64.ECMA)), 10))
+}
+
+func TestExecuteSplit(t *testing.T) {
+	interval := splitRetryInterval
+	splitRetryInterval = time.Millisecond
+	defer func() { splitRetryInterval = interval }()
+
+	s := &objectServer{objects: make(map[string][]byte), fails: map[string]int{"a.log.zst.001": 2}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	root := t.TempDir()
+	filePath := filepath.Join(root, "a.log")
+	var data bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&data, "line %d of the large file\n", i)
+	}
+	if err := os.WriteFile(filePath, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	h := &Handler{
+		Url:        "https://bucket",
+		UploadRule: FileUploadRule{CompressAlgorithm: compress.ZSTD, SplitSize: 10000},
+		ctx:        logarchive.Context{Context: context.Background()},
+		client:     cos.NewClient(&cos.BaseURL{BucketURL: u}, srv.Client()),
+		logger:     zap.NewNop().Sugar(),
+	}
+	task := &Task{RootPath: root, FilePath: filePath}
+	if !assert.NoError(t, h.Execute(task)) {
+		return
+	}
+	assert.Equal(t, "https://bucket/a.log.zst.index", task.Destination())
+
+	var index SplitIndex
+	if !assert.NoError(t, json.Unmarshal(s.objects["a.log.zst.index"], &index)) {
+		return
+	}
+	assert.Equal(t, filePath, index.File)
+	assert.Equal(t, int64(data.Len()), index.Size)
+	assert.Equal(t, compress.ZSTD, index.Compress)
+	if !assert.Len(t, index.Parts, 3) {
+		return
+	}
+
+	// each part is decompressed alone
+	var got []byte
+	for i, part := range index.Parts {
+		assert.Equal(t, fmt.Sprintf("a.log.zst.%03d", i), part.Key)
+		assert.LessOrEqual(t, part.Size, int64(10000))
+		assert.Equal(t, int64(len(s.objects[part.Key])), part.UploadSize)
+
+		dec, err := zstd.NewReader(bytes.NewReader(s.objects[part.Key]))
+		if !assert.NoError(t, err) {
+			return
+		}
+		content, err := io.ReadAll(dec)
+		dec.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, part.Size, int64(len(content)))
+		assert.True(t, bytes.HasSuffix(content, []byte("\n")))
+		got = append(got, content...)
+	}
+	assert.Equal(t, data.Bytes(), got)
+
+	// the task fails if a part fails more than the retries
+	s.fails["a.log.zst.002"] = 3
+	assert.Error(t, h.Execute(&Task{RootPath: root, FilePath: filePath}))
+
+	// the dry run refers the index object
+	h.dryRun = true
+	if assert.NoError(t, h.Execute(task)) {
+		assert.Equal(t, "https://bucket/a.log.zst.index", task.Destination())
+	}
+	h.dryRun = false
+
+	// the small files are not split
+	s.objects = make(map[string][]byte)
+	h.UploadRule.SplitSize = int64(data.Len())
+	if assert.NoError(t, h.Execute(task)) {
+		assert.Equal(t, "https://bucket/a.log.zst", task.Destination())
+		assert.Len(t, s.objects, 1)
+	}
+}
@@ -6,6 +6,11 @@ import "github.com/atframework/atdtool/internal/pkg/logarchive"
 type Task struct {
 	RootPath string `yaml:"rootPath,omitempty" json:"rootPath,omitempty"`
 	FilePath string `yaml:"filePath,omitempty" json:"filePath,omitempty"`
+	// DstPath overrides the destination path which is relative to RootPath by default
+	DstPath string `yaml:"dstPath,omitempty" json:"dstPath,omitempty"`
+
+	// destination is the url of the uploaded object, it is set by Execute
+	destination string
 }
 
 // TaskInfo returns the OutputTaskInfo for COS task
@@ -18,6 +23,12 @@ func (Task) TaskInfo() logarchive.OutputTaskInfo {
 	}
 }
 
+// Destination returns the url of the object uploaded by the task.
+func (t *Task) Destination() string {
+	return t.destination
+}
+
 var (
-	_ logarchive.OutputTask = (*Task)(nil)
+	_ logarchive.OutputTask        = (*Task)(nil)
+	_ logarchive.OutputDestination = (*Task)(nil)
 )
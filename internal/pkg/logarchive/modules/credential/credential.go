@@ -0,0 +1,67 @@
+// Package credential provides the credentials of the outputs, so that the secrets
+// are not written in the config file.
+package credential
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const (
+	defaultTimeout         = 5
+	defaultRefreshInterval = 300
+)
+
+// getURL sends a GET request and returns the body of the successful response.
+func getURL(ctx context.Context, client *http.Client, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return data, nil
+}
+
+func newHTTPClient(timeout int) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Timeout: time.Duration(timeout) * time.Second}
+}
+
+// refreshTime returns the expiration of the credential which is read again after
+// the interval, e.g. it is rotated by another process.
+func refreshTime(interval int) time.Time {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	return time.Now().Add(time.Duration(interval) * time.Second)
+}
+
+func init() {
+	logarchive.RegisterModule(Env{})
+	logarchive.RegisterModule(File{})
+	logarchive.RegisterModule(Vault{})
+	logarchive.RegisterModule(CVM{})
+}
@@ -0,0 +1,133 @@
+package credential
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestEnvCredential(t *testing.T) {
+	t.Setenv("TENCENTCLOUD_SECRET_ID", "id")
+	t.Setenv("TENCENTCLOUD_SECRET_KEY", "key")
+
+	e := &Env{}
+	assert.NoError(t, e.Provision(logarchive.Context{}))
+	cred, err := e.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, &logarchive.Credential{SecretID: "id", SecretKey: "key"}, cred)
+	}
+
+	e = &Env{SecretIDEnv: "CREDENTIAL_TEST_NOT_SET"}
+	assert.NoError(t, e.Provision(logarchive.Context{}))
+	_, err = e.Credential(context.Background())
+	assert.ErrorContains(t, err, "CREDENTIAL_TEST_NOT_SET")
+}
+
+func TestFileCredential(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credential.yaml")
+	if err := os.WriteFile(path, []byte("secretID: id\nsecretKey: key\nexpiration: 2000-01-01T00:00:00Z\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &File{Path: path}
+	assert.NoError(t, f.Validate())
+	cred, err := f.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id", cred.SecretID)
+		assert.Equal(t, "key", cred.SecretKey)
+		assert.Equal(t, time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), cred.Expiration.UTC())
+	}
+
+	// the file is read again after the refresh interval without expiration
+	if err := os.WriteFile(path, []byte(`{"secretID": "id2", "secretKey": "key2"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cred, err = f.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id2", cred.SecretID)
+		assert.WithinDuration(t, time.Now().Add(defaultRefreshInterval*time.Second), cred.Expiration, time.Minute)
+	}
+
+	assert.Error(t, (&File{}).Validate())
+}
+
+func TestVaultCredential(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/data/logarchive":
+			w.Write([]byte(`{"lease_duration": 0, "data": {"data": {"secretID": "id2", "secretKey": "key2"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/logarchive":
+			w.Write([]byte(`{"lease_duration": 60, "data": {"id": "id1", "key": "key1", "token": "t1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "token")
+
+	v := &Vault{Path: "secret/data/logarchive"}
+	assert.NoError(t, v.Provision(logarchive.Context{}))
+	assert.NoError(t, v.Validate())
+	cred, err := v.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id2", cred.SecretID)
+		assert.Equal(t, "key2", cred.SecretKey)
+	}
+
+	v = &Vault{Path: "kv/logarchive", SecretIDKey: "id", SecretKeyKey: "key", SessionTokenKey: "token"}
+	assert.NoError(t, v.Provision(logarchive.Context{}))
+	cred, err = v.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id1", cred.SecretID)
+		assert.Equal(t, "key1", cred.SecretKey)
+		assert.Equal(t, "t1", cred.SessionToken)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), cred.Expiration, 10*time.Second)
+	}
+
+	v = &Vault{Path: "not/exist"}
+	assert.NoError(t, v.Provision(logarchive.Context{}))
+	_, err = v.Credential(context.Background())
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestCVMCredential(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte("role1\n"))
+		case "/role1":
+			w.Write([]byte(`{"TmpSecretId": "id", "TmpSecretKey": "key", "Token": "token", "ExpiredTime": 4102444800, "Code": "Success"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := &CVM{Endpoint: srv.URL}
+	assert.NoError(t, c.Provision(logarchive.Context{}))
+	cred, err := c.Credential(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, &logarchive.Credential{
+			SecretID:     "id",
+			SecretKey:    "key",
+			SessionToken: "token",
+			Expiration:   time.Unix(4102444800, 0),
+		}, cred)
+	}
+
+	c = &CVM{Endpoint: srv.URL, Role: "role2"}
+	assert.NoError(t, c.Provision(logarchive.Context{}))
+	_, err = c.Credential(context.Background())
+	assert.ErrorContains(t, err, "cam role role2")
+}
@@ -0,0 +1,94 @@
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const defaultMetadataEndpoint = "http://metadata.tencentyun.com/latest/meta-data/cam/security-credentials/"
+
+// CVM reads the temporary credential of the CAM role bound to the CVM instance
+// from the instance metadata, which is also available on the nodes of TKE. The
+// first role bound to the instance is used if Role is empty.
+type CVM struct {
+	Role     string `yaml:"role,omitempty" json:"role,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	Timeout  int    `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	client *http.Client
+}
+
+type cvmCredential struct {
+	TmpSecretId  string `json:"TmpSecretId"`
+	TmpSecretKey string `json:"TmpSecretKey"`
+	Token        string `json:"Token"`
+	ExpiredTime  int64  `json:"ExpiredTime"`
+	Code         string `json:"Code"`
+}
+
+// ArchiveModule returns the cvm credential module information.
+func (CVM) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "credential.cvm",
+		New: func() logarchive.Module {
+			return new(CVM)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (c *CVM) Provision(_ logarchive.Context) error {
+	if c.Endpoint == "" {
+		c.Endpoint = defaultMetadataEndpoint
+	}
+	if !strings.HasSuffix(c.Endpoint, "/") {
+		c.Endpoint += "/"
+	}
+	c.client = newHTTPClient(c.Timeout)
+	return nil
+}
+
+// Credential implement the credential provider interface
+func (c *CVM) Credential(ctx context.Context) (*logarchive.Credential, error) {
+	role := c.Role
+	if role == "" {
+		data, err := getURL(ctx, c.client, c.Endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("get cam role of instance: %v", err)
+		}
+		role, _, _ = strings.Cut(strings.TrimSpace(string(data)), "\n")
+		if role = strings.TrimSpace(role); role == "" {
+			return nil, fmt.Errorf("no cam role is bound to the instance")
+		}
+	}
+
+	data, err := getURL(ctx, c.client, c.Endpoint+role, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get credential of cam role %s: %v", role, err)
+	}
+
+	var cred cvmCredential
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return nil, fmt.Errorf("decode credential of cam role %s: %v", role, err)
+	}
+	if cred.Code != "" && cred.Code != "Success" {
+		return nil, fmt.Errorf("get credential of cam role %s: %s", role, cred.Code)
+	}
+
+	expiration := refreshTime(0)
+	if cred.ExpiredTime != 0 {
+		expiration = time.Unix(cred.ExpiredTime, 0)
+	}
+	return &logarchive.Credential{
+		SecretID:     cred.TmpSecretId,
+		SecretKey:    cred.TmpSecretKey,
+		SessionToken: cred.Token,
+		Expiration:   expiration,
+	}, nil
+}
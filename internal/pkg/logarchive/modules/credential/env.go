@@ -0,0 +1,54 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// Env reads the credential from the environment variables, which are the
+// variables of the tencentcloud sdk by default.
+type Env struct {
+	SecretIDEnv     string `yaml:"secretIDEnv,omitempty" json:"secretIDEnv,omitempty"`
+	SecretKeyEnv    string `yaml:"secretKeyEnv,omitempty" json:"secretKeyEnv,omitempty"`
+	SessionTokenEnv string `yaml:"sessionTokenEnv,omitempty" json:"sessionTokenEnv,omitempty"`
+}
+
+// ArchiveModule returns the env credential module information.
+func (Env) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "credential.env",
+		New: func() logarchive.Module {
+			return new(Env)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (e *Env) Provision(_ logarchive.Context) error {
+	if e.SecretIDEnv == "" {
+		e.SecretIDEnv = "TENCENTCLOUD_SECRET_ID"
+	}
+	if e.SecretKeyEnv == "" {
+		e.SecretKeyEnv = "TENCENTCLOUD_SECRET_KEY"
+	}
+	if e.SessionTokenEnv == "" {
+		e.SessionTokenEnv = "TENCENTCLOUD_SESSION_TOKEN"
+	}
+	return nil
+}
+
+// Credential implement the credential provider interface
+func (e *Env) Credential(_ context.Context) (*logarchive.Credential, error) {
+	cred := &logarchive.Credential{
+		SecretID:     os.Getenv(e.SecretIDEnv),
+		SecretKey:    os.Getenv(e.SecretKeyEnv),
+		SessionToken: os.Getenv(e.SessionTokenEnv),
+	}
+	if cred.SecretID == "" || cred.SecretKey == "" {
+		return nil, fmt.Errorf("environment variable %s or %s is not set", e.SecretIDEnv, e.SecretKeyEnv)
+	}
+	return cred, nil
+}
@@ -0,0 +1,76 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// File reads the credential from a YAML or JSON file, e.g. a kubernetes secret
+// mounted as a file or rendered by the vault agent:
+//
+//	secretID: AKIDxxx
+//	secretKey: xxx
+//	sessionToken: xxx                 # optional
+//	expiration: 2024-01-01T00:00:00Z  # optional
+//
+// The file is read again after RefreshInterval seconds, so the rotated
+// credential is used without restart.
+type File struct {
+	Path            string `yaml:"path,omitempty" json:"path,omitempty"`
+	RefreshInterval int    `yaml:"refreshInterval,omitempty" json:"refreshInterval,omitempty"`
+}
+
+type fileCredential struct {
+	SecretID     string    `json:"secretID"`
+	SecretKey    string    `json:"secretKey"`
+	SessionToken string    `json:"sessionToken,omitempty"`
+	Expiration   time.Time `json:"expiration,omitempty"`
+}
+
+// ArchiveModule returns the file credential module information.
+func (File) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "credential.file",
+		New: func() logarchive.Module {
+			return new(File)
+		},
+	}
+}
+
+// Validate implement the validator interface
+func (f *File) Validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("credential file path is required")
+	}
+	return nil
+}
+
+// Credential implement the credential provider interface
+func (f *File) Credential(_ context.Context) (*logarchive.Credential, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c fileCredential
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("decode credential file(%s): %v", f.Path, err)
+	}
+
+	expiration := refreshTime(f.RefreshInterval)
+	if !c.Expiration.IsZero() && c.Expiration.Before(expiration) {
+		expiration = c.Expiration
+	}
+	return &logarchive.Credential{
+		SecretID:     c.SecretID,
+		SecretKey:    c.SecretKey,
+		SessionToken: c.SessionToken,
+		Expiration:   expiration,
+	}, nil
+}
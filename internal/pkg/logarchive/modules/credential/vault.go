@@ -0,0 +1,138 @@
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// Vault reads the credential from a secret of HashiCorp Vault, both the kv
+// secrets engine version 1 and 2 are supported. Address and Token are read from
+// VAULT_ADDR and VAULT_TOKEN by default.
+type Vault struct {
+	Address   string `yaml:"address,omitempty" json:"address,omitempty"`
+	Token     string `yaml:"token,omitempty" json:"token,omitempty"`
+	TokenFile string `yaml:"tokenFile,omitempty" json:"tokenFile,omitempty"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	// Path is the path of the secret, e.g. "secret/data/logarchive" for kv version 2
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+
+	// the keys of the secret, which are secretID, secretKey and sessionToken by default
+	SecretIDKey     string `yaml:"secretIDKey,omitempty" json:"secretIDKey,omitempty"`
+	SecretKeyKey    string `yaml:"secretKeyKey,omitempty" json:"secretKeyKey,omitempty"`
+	SessionTokenKey string `yaml:"sessionTokenKey,omitempty" json:"sessionTokenKey,omitempty"`
+
+	Timeout         int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	RefreshInterval int `yaml:"refreshInterval,omitempty" json:"refreshInterval,omitempty"`
+
+	client *http.Client
+}
+
+type vaultSecret struct {
+	LeaseDuration int            `json:"lease_duration"`
+	Data          map[string]any `json:"data"`
+}
+
+// ArchiveModule returns the vault credential module information.
+func (Vault) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "credential.vault",
+		New: func() logarchive.Module {
+			return new(Vault)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (v *Vault) Provision(_ logarchive.Context) error {
+	if v.Address == "" {
+		v.Address = os.Getenv("VAULT_ADDR")
+	}
+	if v.Token == "" && v.TokenFile == "" {
+		v.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if v.SecretIDKey == "" {
+		v.SecretIDKey = "secretID"
+	}
+	if v.SecretKeyKey == "" {
+		v.SecretKeyKey = "secretKey"
+	}
+	if v.SessionTokenKey == "" {
+		v.SessionTokenKey = "sessionToken"
+	}
+	v.client = newHTTPClient(v.Timeout)
+	return nil
+}
+
+// Validate implement the validator interface
+func (v *Vault) Validate() error {
+	if v.Address == "" {
+		return fmt.Errorf("vault address is required")
+	}
+	if v.Path == "" {
+		return fmt.Errorf("vault secret path is required")
+	}
+	return nil
+}
+
+// Credential implement the credential provider interface
+func (v *Vault) Credential(ctx context.Context) (*logarchive.Credential, error) {
+	token := v.Token
+	if v.TokenFile != "" {
+		// the token file may be renewed by the vault agent
+		data, err := os.ReadFile(v.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vault token file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	header := http.Header{}
+	header.Set("X-Vault-Token", token)
+	if v.Namespace != "" {
+		header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	url := strings.TrimRight(v.Address, "/") + "/v1/" + strings.TrimLeft(v.Path, "/")
+	data, err := getURL(ctx, v.client, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("read vault secret: %v", err)
+	}
+
+	var secret vaultSecret
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("decode vault secret: %v", err)
+	}
+
+	// the data of kv version 2 is nested with its metadata
+	values := secret.Data
+	if nested, ok := values["data"].(map[string]any); ok {
+		if _, ok := values["metadata"]; ok {
+			values = nested
+		}
+	}
+
+	str := func(key string) string {
+		s, _ := values[key].(string)
+		return s
+	}
+
+	expiration := refreshTime(v.RefreshInterval)
+	if secret.LeaseDuration > 0 {
+		if lease := time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second); lease.Before(expiration) {
+			expiration = lease
+		}
+	}
+	return &logarchive.Credential{
+		SecretID:     str(v.SecretIDKey),
+		SecretKey:    str(v.SecretKeyKey),
+		SessionToken: str(v.SessionTokenKey),
+		Expiration:   expiration,
+	}, nil
+}
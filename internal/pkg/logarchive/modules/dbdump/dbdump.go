@@ -0,0 +1,245 @@
+package dbdump
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/schedule"
+)
+
+const (
+	defaultDumpTimeout = 3600
+	defaultDumpName    = "dump"
+	defaultDumpSuffix  = ".dump"
+
+	// dumpFilePlaceholder in the command arguments is replaced by the dump file path,
+	// e.g. redis-cli --rdb {file}, otherwise the stdout of the command is saved
+	dumpFilePlaceholder = "{file}"
+	activeFileSuffix    = ".part"
+	dumpFileTimeFmt     = "20060102T150405"
+)
+
+// Archive runs the dump command on schedule, writes the dump into DumpDir and
+// uploads it through the configured output, e.g. mysqldump or redis-cli --rdb.
+type Archive struct {
+	filearchive.Archive
+
+	Command  string   `yaml:"command,omitempty" json:"command,omitempty"`
+	Args     []string `yaml:"args,omitempty" json:"args,omitempty"`
+	Env      []string `yaml:"env,omitempty" json:"env,omitempty"`
+	Schedule string   `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	DumpDir  string   `yaml:"dumpDir,omitempty" json:"dumpDir,omitempty"`
+	// Name is the prefix of the dump file name
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Suffix is the suffix of the dump file name, e.g. ".sql" or ".rdb"
+	Suffix string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	// Timeout is the max time in seconds a dump can run
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	schedule *schedule.Schedule
+	ctx      logarchive.Context
+	done     chan struct{}
+
+	logger *zap.SugaredLogger
+}
+
+// ArchiveModule returns the dbdump module information.
+func (Archive) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "dbdump",
+		New: func() logarchive.Module {
+			return new(Archive)
+		},
+	}
+}
+
+// Provision implement the module interface
+func (ar *Archive) Provision(ctx logarchive.Context) error {
+	ar.ctx = ctx
+	ar.logger = ctx.Logger().Sugar().Named("dbdump")
+	ar.done = make(chan struct{})
+
+	if ar.Command == "" {
+		return fmt.Errorf("dump command is required")
+	}
+
+	var err error
+	ar.schedule, err = schedule.Parse(ar.Schedule)
+	if err != nil {
+		return err
+	}
+
+	if len(ar.Paths) != 0 {
+		return fmt.Errorf("paths is the dump dir, it can not be specified")
+	}
+	if ar.DumpDir == "" {
+		ar.DumpDir = filepath.Join(os.TempDir(), "logarchive-dbdump")
+	}
+	if ar.Name == "" {
+		ar.Name = defaultDumpName
+	}
+	if ar.Suffix == "" {
+		ar.Suffix = defaultDumpSuffix
+	}
+	if ar.Timeout <= 0 {
+		ar.Timeout = defaultDumpTimeout
+	}
+
+	if err := os.MkdirAll(ar.DumpDir, os.ModePerm); err != nil {
+		return fmt.Errorf("make dump dir(%s): %v", ar.DumpDir, err)
+	}
+
+	// the dumps interrupted by last run are incomplete
+	names, err := filepath.Glob(filepath.Join(ar.DumpDir, ar.Name+"-*"+activeFileSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("remove incomplete dump(%s): %v", name, err)
+		}
+	}
+
+	ar.Paths = []string{ar.DumpDir}
+	ar.SetCollector(ar)
+	return ar.Archive.Provision(ctx)
+}
+
+// Start implement the archive interface
+func (ar *Archive) Start() error {
+	if err := ar.Archive.Start(); err != nil {
+		return err
+	}
+
+	go ar.runSchedule()
+	return nil
+}
+
+// Stop implement the archive interface
+func (ar *Archive) Stop() error {
+	select {
+	case <-ar.done:
+	default:
+		close(ar.done)
+	}
+	return ar.Archive.Stop()
+}
+
+// Accept implement the collector interface, only the completed dumps are collected.
+func (ar *Archive) Accept(rootPath, filePath string) bool {
+	name := filepath.Base(filePath)
+	return filepath.Dir(filePath) == filepath.Clean(rootPath) &&
+		strings.HasPrefix(name, ar.Name+"-") && strings.HasSuffix(name, ar.Suffix)
+}
+
+// DestPath implement the collector interface
+func (ar *Archive) DestPath(rootPath, filePath string) (string, error) {
+	return filepath.Rel(rootPath, filePath)
+}
+
+func (ar *Archive) runSchedule() {
+	for {
+		next := ar.schedule.Next(time.Now())
+		if next.IsZero() {
+			ar.logger.Errorf("schedule: %s never matches", ar.Schedule)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ar.ctx.Done():
+			timer.Stop()
+			return
+		case <-ar.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := ar.dump(next); err != nil {
+				ar.logger.Errorf("dump failed: %v", err)
+			}
+		}
+	}
+}
+
+// dump runs the dump command, the dump file is renamed to be collected when
+// the command exits successfully.
+func (ar *Archive) dump(t time.Time) error {
+	name := filepath.Join(ar.DumpDir, ar.Name+"-"+t.Format(dumpFileTimeFmt)+ar.Suffix)
+	part := name + activeFileSuffix
+
+	ctx, cancel := context.WithTimeout(ar.ctx, time.Duration(ar.Timeout)*time.Second)
+	defer cancel()
+
+	args, toStdout := dumpArgs(ar.Args, part)
+	cmd := exec.CommandContext(ctx, ar.Command, args...)
+	cmd.Env = append(os.Environ(), ar.Env...)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	var f *os.File
+	if toStdout {
+		var err error
+		f, err = os.Create(part)
+		if err != nil {
+			return fmt.Errorf("create dump file(%s): %v", part, err)
+		}
+		cmd.Stdout = f
+	}
+
+	begin := time.Now()
+	err := cmd.Run()
+	if f != nil {
+		// the file must be closed before renaming
+		if err2 := f.Close(); err == nil {
+			err = err2
+		}
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("run %s: %v, stderr: %s", ar.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := os.Rename(part, name); err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("complete dump file(%s): %v", name, err)
+	}
+	ar.logger.Infof("dump: %s has been created, cost: %v", name, time.Since(begin))
+	return nil
+}
+
+// dumpArgs replaces the file placeholder in args, toStdout is true when there is
+// no placeholder and the stdout of the command should be saved as the dump.
+func dumpArgs(args []string, file string) (replaced []string, toStdout bool) {
+	toStdout = true
+	replaced = make([]string, len(args))
+	for i, arg := range args {
+		if strings.Contains(arg, dumpFilePlaceholder) {
+			toStdout = false
+			arg = strings.ReplaceAll(arg, dumpFilePlaceholder, file)
+		}
+		replaced[i] = arg
+	}
+	return
+}
+
+func init() {
+	logarchive.RegisterModule(Archive{})
+}
+
+var (
+	_ logarchive.Provisioner  = (*Archive)(nil)
+	_ logarchive.Validator    = (*Archive)(nil)
+	_ logarchive.CleanerUpper = (*Archive)(nil)
+	_ logarchive.Archive      = (*Archive)(nil)
+	_ filearchive.Collector   = (*Archive)(nil)
+)
@@ -0,0 +1,17 @@
+package dbdump
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpArgs(t *testing.T) {
+	args, toStdout := dumpArgs([]string{"--rdb", "{file}"}, "/tmp/dump.part")
+	assert.Equal(t, []string{"--rdb", "/tmp/dump.part"}, args)
+	assert.False(t, toStdout)
+
+	args, toStdout = dumpArgs([]string{"--all-databases"}, "/tmp/dump.part")
+	assert.Equal(t, []string{"--all-databases"}, args)
+	assert.True(t, toStdout)
+}
@@ -0,0 +1,220 @@
+package execarchive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/schedule"
+)
+
+const (
+	defaultExecTimeout  = 60
+	defaultOutputName   = "exec"
+	defaultOutputSuffix = ".log"
+
+	activeFileSuffix  = ".part"
+	outputFileTimeFmt = "20060102T150405"
+)
+
+// Archive runs the command on schedule, saves its stdout into OutputDir and
+// uploads it through the configured output, e.g. `ss -s` or `top -b -n1`.
+type Archive struct {
+	filearchive.Archive
+
+	Command   string   `yaml:"command,omitempty" json:"command,omitempty"`
+	Args      []string `yaml:"args,omitempty" json:"args,omitempty"`
+	Env       []string `yaml:"env,omitempty" json:"env,omitempty"`
+	Schedule  string   `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	OutputDir string   `yaml:"outputDir,omitempty" json:"outputDir,omitempty"`
+	// Name is the prefix of the output file name
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Suffix is the suffix of the output file name
+	Suffix string `yaml:"suffix,omitempty" json:"suffix,omitempty"`
+	// Timeout is the max time in seconds the command can run
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	schedule *schedule.Schedule
+	ctx      logarchive.Context
+	done     chan struct{}
+
+	logger *zap.SugaredLogger
+}
+
+// ArchiveModule returns the exec module information.
+func (Archive) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "exec",
+		New: func() logarchive.Module {
+			return new(Archive)
+		},
+	}
+}
+
+// Provision implement the module interface
+func (ar *Archive) Provision(ctx logarchive.Context) error {
+	ar.ctx = ctx
+	ar.logger = ctx.Logger().Sugar().Named("exec")
+	ar.done = make(chan struct{})
+
+	if ar.Command == "" {
+		return fmt.Errorf("exec command is required")
+	}
+
+	var err error
+	ar.schedule, err = schedule.Parse(ar.Schedule)
+	if err != nil {
+		return err
+	}
+
+	if len(ar.Paths) != 0 {
+		return fmt.Errorf("paths is the output dir, it can not be specified")
+	}
+	if ar.Name == "" {
+		ar.Name = defaultOutputName
+	}
+	if ar.OutputDir == "" {
+		ar.OutputDir = filepath.Join(os.TempDir(), "logarchive-exec", ar.Name)
+	}
+	if ar.Suffix == "" {
+		ar.Suffix = defaultOutputSuffix
+	}
+	if ar.Timeout <= 0 {
+		ar.Timeout = defaultExecTimeout
+	}
+
+	if err := os.MkdirAll(ar.OutputDir, os.ModePerm); err != nil {
+		return fmt.Errorf("make output dir(%s): %v", ar.OutputDir, err)
+	}
+
+	// the outputs interrupted by last run are incomplete
+	names, err := filepath.Glob(filepath.Join(ar.OutputDir, ar.Name+"-*"+activeFileSuffix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("remove incomplete output(%s): %v", name, err)
+		}
+	}
+
+	ar.Paths = []string{ar.OutputDir}
+	ar.SetCollector(ar)
+	return ar.Archive.Provision(ctx)
+}
+
+// Start implement the archive interface
+func (ar *Archive) Start() error {
+	if err := ar.Archive.Start(); err != nil {
+		return err
+	}
+
+	go ar.runSchedule()
+	return nil
+}
+
+// Stop implement the archive interface
+func (ar *Archive) Stop() error {
+	select {
+	case <-ar.done:
+	default:
+		close(ar.done)
+	}
+	return ar.Archive.Stop()
+}
+
+// Accept implement the collector interface, only the completed outputs are collected.
+func (ar *Archive) Accept(rootPath, filePath string) bool {
+	name := filepath.Base(filePath)
+	return filepath.Dir(filePath) == filepath.Clean(rootPath) &&
+		strings.HasPrefix(name, ar.Name+"-") && strings.HasSuffix(name, ar.Suffix)
+}
+
+// DestPath implement the collector interface
+func (ar *Archive) DestPath(rootPath, filePath string) (string, error) {
+	return filepath.Rel(rootPath, filePath)
+}
+
+func (ar *Archive) runSchedule() {
+	for {
+		next := ar.schedule.Next(time.Now())
+		if next.IsZero() {
+			ar.logger.Errorf("schedule: %s never matches", ar.Schedule)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ar.ctx.Done():
+			timer.Stop()
+			return
+		case <-ar.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := ar.run(next); err != nil {
+				ar.logger.Errorf("exec failed: %v", err)
+			}
+		}
+	}
+}
+
+// run executes the command and saves its stdout, the output file is renamed
+// to be collected when the command exits successfully.
+func (ar *Archive) run(t time.Time) error {
+	name := filepath.Join(ar.OutputDir, ar.Name+"-"+t.Format(outputFileTimeFmt)+ar.Suffix)
+	part := name + activeFileSuffix
+
+	f, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("create output file(%s): %v", part, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ar.ctx, time.Duration(ar.Timeout)*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ar.Command, ar.Args...)
+	cmd.Env = append(os.Environ(), ar.Env...)
+	cmd.Stdout = f
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	begin := time.Now()
+	err = cmd.Run()
+	// the file must be closed before renaming
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("run %s: %v, stderr: %s", ar.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if err := os.Rename(part, name); err != nil {
+		_ = os.Remove(part)
+		return fmt.Errorf("complete output file(%s): %v", name, err)
+	}
+	ar.logger.Debugf("exec: %s has been created, cost: %v", name, time.Since(begin))
+	return nil
+}
+
+func init() {
+	logarchive.RegisterModule(Archive{})
+}
+
+var (
+	_ logarchive.Provisioner  = (*Archive)(nil)
+	_ logarchive.Validator    = (*Archive)(nil)
+	_ logarchive.CleanerUpper = (*Archive)(nil)
+	_ logarchive.Archive      = (*Archive)(nil)
+	_ filearchive.Collector   = (*Archive)(nil)
+)
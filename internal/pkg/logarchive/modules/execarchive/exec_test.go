@@ -0,0 +1,73 @@
+package execarchive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func newTestArchive(t *testing.T, command string, args ...string) *Archive {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands require sh")
+	}
+
+	return &Archive{
+		Command:   command,
+		Args:      args,
+		OutputDir: t.TempDir(),
+		Name:      "stats",
+		Suffix:    defaultOutputSuffix,
+		Timeout:   defaultExecTimeout,
+		ctx:       logarchive.Context{Context: context.Background()},
+		logger:    zap.NewNop().Sugar(),
+	}
+}
+
+func TestArchiveRunSavesStdout(t *testing.T) {
+	ar := newTestArchive(t, "sh", "-c", "echo stats; echo ignored >&2")
+
+	now := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	if !assert.NoError(t, ar.run(now)) {
+		return
+	}
+
+	name := filepath.Join(ar.OutputDir, "stats-20240501T123000.log")
+	data, err := os.ReadFile(name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "stats\n", string(data))
+	assert.True(t, ar.Accept(ar.OutputDir, name))
+	assert.False(t, ar.Accept(ar.OutputDir, name+activeFileSuffix))
+}
+
+func TestArchiveRunRemovesOutputOnFailure(t *testing.T) {
+	ar := newTestArchive(t, "sh", "-c", "echo partial; echo broken >&2; exit 3")
+
+	err := ar.run(time.Now())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "broken")
+	}
+
+	names, err := filepath.Glob(filepath.Join(ar.OutputDir, "*"))
+	if assert.NoError(t, err) {
+		assert.Empty(t, names)
+	}
+}
+
+func TestArchiveRunTimeout(t *testing.T) {
+	ar := newTestArchive(t, "sleep", "5")
+	ar.Timeout = 1
+
+	begin := time.Now()
+	assert.Error(t, ar.run(time.Now()))
+	assert.Less(t, time.Since(begin), 4*time.Second)
+}
@@ -0,0 +1,58 @@
+package filearchive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// auditRemoveFile removes the file and records the deletion into the audit log.
+// The size and checksum are taken before removing, the failed deletions are
+// recorded too since a shredded file may have been overwritten partly.
+func (ar *Archive) auditRemoveFile(path, destination string) error {
+	if ar.audit == nil {
+		return ar.removeFile(path)
+	}
+
+	r := logarchive.AuditRecord{
+		Action:      logarchive.AuditActionDelete,
+		Archive:     ar.archiveName(),
+		Path:        path,
+		Destination: destination,
+	}
+	if ar.DeleteRule.Shred {
+		r.Action = logarchive.AuditActionShred
+	}
+
+	var err error
+	if r.Size, r.Checksum, err = fileChecksum(path); err != nil {
+		ar.logger.Warnf("checksum of file: %s for audit got error: %v", path, err)
+	}
+
+	if err = ar.removeFile(path); err != nil {
+		r.Error = err.Error()
+	}
+	if auditErr := ar.audit.Record(r); auditErr != nil {
+		ar.logger.Errorf("record audit of file: %s got error: %v", path, auditErr)
+	}
+	return err
+}
+
+// fileChecksum returns the size and the sha256 of the file.
+func fileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
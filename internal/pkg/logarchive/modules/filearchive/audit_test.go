@@ -0,0 +1,64 @@
+//go:build !windows
+// +build !windows
+
+package filearchive
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestAuditRemoveFile(t *testing.T) {
+	dir := t.TempDir()
+	ar := newTestArchive()
+	ar.audit = &logarchive.Audit{Path: filepath.Join(dir, "audit", "audit.log")}
+	if !assert.NoError(t, ar.audit.Provision(logarchive.Context{})) {
+		return
+	}
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ar.auditRemoveFile(path, "https://bucket.cos/app.log"))
+	assert.NoFileExists(t, path)
+	assert.Error(t, ar.auditRemoveFile(path, ""))
+	assert.NoError(t, ar.audit.Stop())
+
+	f, err := os.Open(ar.audit.Path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	var records []logarchive.AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r logarchive.AuditRecord
+		if assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r)) {
+			records = append(records, r)
+		}
+	}
+	if !assert.Len(t, records, 2) {
+		return
+	}
+
+	assert.Equal(t, logarchive.AuditActionDelete, records[0].Action)
+	assert.Equal(t, "file", records[0].Archive)
+	assert.Equal(t, path, records[0].Path)
+	assert.Equal(t, int64(5), records[0].Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", records[0].Checksum)
+	assert.Equal(t, "https://bucket.cos/app.log", records[0].Destination)
+	assert.Empty(t, records[0].Error)
+	assert.False(t, records[0].Time.IsZero())
+
+	// the failed deletion is recorded with the error
+	assert.NotEmpty(t, records[1].Error)
+}
@@ -10,6 +10,8 @@ type element struct {
 type fileCacheKey struct {
 	watchPath string
 	filePath  string
+	// destination is where the file has been uploaded, for the audit of deleting
+	destination string
 }
 
 type fileCacheMap map[string]*element
@@ -44,7 +46,8 @@ func releaseCacheKey(key *fileCacheKey) {
 
 	key.watchPath = ""
 	key.filePath = ""
-	notifyPool.Put(key)
+	key.destination = ""
+	cacheKeyPool.Put(key)
 }
 
 var (
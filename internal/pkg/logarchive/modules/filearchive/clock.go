@@ -0,0 +1,64 @@
+package filearchive
+
+import (
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// clockJumpThreshold is the least difference between the wall clock and the
+// monotonic clock elapsed between two ticks to be treated as a clock jump. The
+// delayed ticks are not jumps, both clocks are delayed equally.
+const clockJumpThreshold = 5 * time.Second
+
+// detectClockJump returns how far the wall clock jumped since the last tick,
+// e.g. it was stepped by NTP, or zero if it did not jump.
+func (ar *Archive) detectClockJump(t time.Time) time.Duration {
+	last := ar.lastTick
+	ar.lastTick = t
+	if last.IsZero() {
+		return 0
+	}
+
+	// Round(0) strips the monotonic clock reading
+	jump := t.Round(0).Sub(last.Round(0)) - t.Sub(last)
+	if jump.Abs() < clockJumpThreshold {
+		return 0
+	}
+	return jump
+}
+
+// handleClockJump shifts the deadlines computed by the wall clock, so that the
+// files are neither uploaded before their protected time ends nor stalled until
+// the clock catches up.
+func (ar *Archive) handleClockJump(jump time.Duration) {
+	direction := "forward"
+	if jump < 0 {
+		direction = "backward"
+	}
+	logarchive.InputClockJumpsTotal.WithLabelValues(ar.ArchiveModule().ID.Name(), direction).Inc()
+	ar.logger.Warnf("wall clock jumped %s by %v, the pending deadlines are shifted", direction, jump.Abs())
+
+	seconds := int64(jump.Round(time.Second) / time.Second)
+	for _, cache := range ar.fileCache {
+		for _, v := range cache.files {
+			v.protectedEndTime += seconds
+			v.discoveredTime += seconds
+		}
+	}
+
+	if ar.lastPruneTime != 0 {
+		ar.lastPruneTime += seconds
+	}
+	if ar.lastStateTime != 0 {
+		ar.lastStateTime += seconds
+	}
+}
+
+// modifyProtectEndTime returns the end of the protected time of the file modified
+// at modTime. The modification time later than now, e.g. the file was written
+// before the clock jumped backward, is treated as now, otherwise the file is not
+// uploaded until the clock catches up.
+func (ar *Archive) modifyProtectEndTime(modTime, now int64) int64 {
+	return min(modTime, now) + ar.CollectRule.ModifyProtectTime
+}
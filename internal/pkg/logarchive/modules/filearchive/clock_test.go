@@ -0,0 +1,76 @@
+package filearchive
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestDetectClockJump(t *testing.T) {
+	ar := newScheduleTestArchive(t, 1, nil)
+
+	now := time.Now()
+	assert.Zero(t, ar.detectClockJump(now))
+	// the wall clock and the monotonic clock elapsed equally
+	assert.Zero(t, ar.detectClockJump(now.Add(time.Minute)))
+	assert.Equal(t, now.Add(time.Minute), ar.lastTick)
+}
+
+func TestHandleClockJump(t *testing.T) {
+	root := t.TempDir()
+	ar := newScheduleTestArchive(t, 1, map[string]int{root: 1})
+	ar.lastStateTime = 1000
+
+	var v *fileInfo
+	for _, v = range ar.fileCache[root].files {
+		v.protectedEndTime = 1100
+		v.discoveredTime = 900
+	}
+
+	counter := func() float64 {
+		m := &dto.Metric{}
+		if err := logarchive.InputClockJumpsTotal.WithLabelValues("file", "backward").Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	before := counter()
+
+	ar.handleClockJump(-time.Hour)
+	assert.Equal(t, int64(1100-3600), v.protectedEndTime)
+	assert.Equal(t, int64(900-3600), v.discoveredTime)
+	assert.Equal(t, int64(1000-3600), ar.lastStateTime)
+	// the zero time is kept, it is not set yet
+	assert.Zero(t, ar.lastPruneTime)
+	assert.Equal(t, before+1, counter())
+}
+
+func TestScheduleUploadsFutureModTime(t *testing.T) {
+	root := t.TempDir()
+	ar := newScheduleTestArchive(t, 1, map[string]int{root: 1})
+	ar.CollectRule.ModifyProtectTime = 10
+
+	// the file was written before the wall clock jumped backward
+	now := time.Now().Unix()
+	for name := range ar.fileCache[root].files {
+		future := time.Unix(now+3600, 0)
+		if err := os.Chtimes(name, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ar.scheduleUploads(now)
+	assert.Equal(t, 0, uploadingFiles(ar, root))
+	for _, v := range ar.fileCache[root].files {
+		assert.Equal(t, now+10, v.protectedEndTime)
+	}
+
+	// the file is not stalled until the clock catches up
+	ar.scheduleUploads(now + 10)
+	assert.Equal(t, 1, uploadingFiles(ar, root))
+}
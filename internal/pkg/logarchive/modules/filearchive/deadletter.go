@@ -0,0 +1,138 @@
+package filearchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const deadLetterRecordSuffix = ".deadletter.json"
+
+// DeadLetterRecord is the sidecar of a file moved into the dead-letter directory,
+// it describes where the file comes from and why it was failed to upload.
+type DeadLetterRecord struct {
+	Time        time.Time `json:"time"`
+	File        string    `json:"file"`
+	RootPath    string    `json:"rootPath"`
+	Error       string    `json:"error,omitempty"`
+	FailedCount int       `json:"failedCount"`
+
+	// path is the file in the dead-letter directory
+	path string
+}
+
+// Path returns the path of the file in the dead-letter directory.
+func (r *DeadLetterRecord) Path() string {
+	return r.path
+}
+
+// moveToDeadLetter moves the file which has failed to upload into the dead-letter
+// directory and writes the sidecar record next to it.
+func (ar *Archive) moveToDeadLetter(rootPath, filePath string, failedCount int, errMsg string) error {
+	if err := os.MkdirAll(ar.DeadLetterDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + filepath.Base(filePath)
+	dst := filepath.Join(ar.DeadLetterDir, name)
+	if err := moveFile(filePath, dst); err != nil {
+		return err
+	}
+
+	r := &DeadLetterRecord{
+		Time:        time.Now(),
+		File:        filePath,
+		RootPath:    rootPath,
+		Error:       errMsg,
+		FailedCount: failedCount,
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst+deadLetterRecordSuffix, data, 0644)
+}
+
+// LoadDeadLetter reads the records in the dead-letter directory, sorted by time.
+func LoadDeadLetter(dir string) ([]*DeadLetterRecord, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DeadLetterRecord
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), deadLetterRecordSuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		r := new(DeadLetterRecord)
+		if err := json.Unmarshal(data, r); err != nil {
+			return nil, fmt.Errorf("decode %s: %v", e.Name(), err)
+		}
+		r.path = filepath.Join(dir, strings.TrimSuffix(e.Name(), deadLetterRecordSuffix))
+		records = append(records, r)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// RetryDeadLetter moves the file back to its original path, so that the file
+// is collected again by the running archive, the record is removed then.
+func RetryDeadLetter(r *DeadLetterRecord) error {
+	if _, err := os.Lstat(r.File); err == nil {
+		return fmt.Errorf("file %s already exists", r.File)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.File), os.ModePerm); err != nil {
+		return err
+	}
+
+	if err := moveFile(r.path, r.File); err != nil {
+		return err
+	}
+	return os.Remove(r.path + deadLetterRecordSuffix)
+}
+
+// moveFile renames the file, it is copied when the destination is on another device.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
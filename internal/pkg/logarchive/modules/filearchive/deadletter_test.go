@@ -0,0 +1,70 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterRetry(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(logs, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(logs, "app.log")
+	if err := os.WriteFile(path, []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := &Archive{DeadLetterDir: filepath.Join(dir, "dead")}
+	if !assert.NoError(t, ar.moveToDeadLetter(logs, path, 3, "upload failed")) {
+		return
+	}
+	assert.NoFileExists(t, path)
+
+	records, err := LoadDeadLetter(ar.DeadLetterDir)
+	if !assert.NoError(t, err) || !assert.Len(t, records, 1) {
+		return
+	}
+	r := records[0]
+	assert.Equal(t, path, r.File)
+	assert.Equal(t, logs, r.RootPath)
+	assert.Equal(t, "upload failed", r.Error)
+	assert.Equal(t, 3, r.FailedCount)
+	assert.FileExists(t, r.Path())
+
+	// the file is not overwritten if it has been created again
+	if err := os.WriteFile(path, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, RetryDeadLetter(r))
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.NoError(t, RetryDeadLetter(r)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "log", string(data))
+	}
+
+	records, err = LoadDeadLetter(ar.DeadLetterDir)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestValidateDeadLetterDir(t *testing.T) {
+	dir := t.TempDir()
+
+	ar := &Archive{Paths: []string{dir}, DeadLetterDir: filepath.Join(dir, "dead")}
+	assert.Error(t, ar.Validate())
+
+	ar.DeadLetterDir = filepath.Join(filepath.Dir(dir), "dead")
+	assert.NoError(t, ar.Validate())
+}
@@ -0,0 +1,81 @@
+package filearchive
+
+import "sync"
+
+const defaultDedupMaxEntries = 10000
+
+// FileDedupRule skips uploading the files whose content has been uploaded, e.g.
+// a file copied back by an operator, by the sha256 of the uploaded files. The
+// hashes are saved in the state file if it is set.
+type FileDedupRule struct {
+	Enabled bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// MaxEntries limits the hashes remembered, the oldest are forgotten first
+	MaxEntries int `yaml:"maxEntries,omitempty" json:"maxEntries,omitempty"`
+}
+
+// dedupIndex is the hashes of the uploaded files, it is accessed by the workers.
+type dedupIndex struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]string
+	// order is the hashes from the oldest to the newest
+	order []string
+}
+
+func newDedupIndex(max int) *dedupIndex {
+	if max <= 0 {
+		max = defaultDedupMaxEntries
+	}
+	return &dedupIndex{max: max, entries: make(map[string]string)}
+}
+
+// lookup returns the destination of the uploaded file with the hash.
+func (d *dedupIndex) lookup(hash string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	destination, ok := d.entries[hash]
+	return destination, ok
+}
+
+// add remembers the hash of an uploaded file.
+func (d *dedupIndex) add(hash, destination string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.entries[hash]; !ok {
+		d.order = append(d.order, hash)
+	}
+	d.entries[hash] = destination
+	for len(d.order) > d.max {
+		delete(d.entries, d.order[0])
+		d.order = d.order[1:]
+	}
+}
+
+// records returns the hashes from the oldest to the newest for the state file.
+func (d *dedupIndex) records() []stateHash {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	records := make([]stateHash, 0, len(d.order))
+	for _, hash := range d.order {
+		records = append(records, stateHash{Hash: hash, Destination: d.entries[hash]})
+	}
+	return records
+}
+
+// dedupFile reports whether the content of the file has been uploaded, the hash
+// is returned to be remembered after the file is uploaded.
+func (ar *Archive) dedupFile(filePath string) (hash, destination string, found bool) {
+	if ar.dedup == nil {
+		return "", "", false
+	}
+
+	_, hash, err := fileChecksum(filePath)
+	if err != nil {
+		// the error is reported by uploading
+		return "", "", false
+	}
+	destination, found = ar.dedup.lookup(hash)
+	return hash, destination, found
+}
@@ -0,0 +1,57 @@
+package filearchive
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupIndex(t *testing.T) {
+	d := newDedupIndex(2)
+	d.add("a", "dst/a")
+	d.add("b", "dst/b")
+	d.add("a", "dst/a2")
+	d.add("c", "dst/c")
+
+	// the oldest hash is forgotten first
+	_, ok := d.lookup("a")
+	assert.False(t, ok)
+	destination, ok := d.lookup("c")
+	assert.True(t, ok)
+	assert.Equal(t, "dst/c", destination)
+	assert.Equal(t, []stateHash{{Hash: "b", Destination: "dst/b"}, {Hash: "c", Destination: "dst/c"}}, d.records())
+}
+
+func TestScheduleUploadsDedup(t *testing.T) {
+	dir := t.TempDir()
+	ar := newScheduleTestArchive(t, 10, map[string]int{dir: 1})
+	ar.notifyChan = make(chan *notifyInfo, 10)
+	ar.StateFile = filepath.Join(t.TempDir(), "state.json")
+
+	sum := sha256.Sum256([]byte("data"))
+	ar.dedup = newDedupIndex(0)
+	ar.dedup.add(hex.EncodeToString(sum[:]), "https://bucket/0.log")
+
+	ar.scheduleUploads(time.Now().Unix())
+	if !assert.Equal(t, 1, len(ar.tasks)) {
+		return
+	}
+	// the file is not uploaded since the output is not called
+	assert.NoError(t, (<-ar.tasks)())
+
+	notify := <-ar.notifyChan
+	assert.True(t, notify.result)
+	assert.Equal(t, filepath.Join(dir, "0.log"), notify.filePath)
+	assert.Equal(t, "https://bucket/0.log", notify.destination)
+
+	// the hashes are kept in the state file across restarts
+	ar.saveState(time.Now().Unix())
+	state, err := loadState(ar.StateFile)
+	if assert.NoError(t, err) && assert.NotNil(t, state) {
+		assert.Equal(t, ar.dedup.records(), state.hashes)
+	}
+}
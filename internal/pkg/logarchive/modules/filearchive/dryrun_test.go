@@ -0,0 +1,35 @@
+package filearchive
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunKeepsSourceFiles(t *testing.T) {
+	dir := t.TempDir()
+	ar := newScheduleTestArchive(t, 10, map[string]int{dir: 2})
+	ar.deleteChan = make(chan *fileCacheKey, 10)
+	ar.DeadLetterDir = t.TempDir()
+	ar.StateFile = filepath.Join(t.TempDir(), "state.json")
+	ar.dryRun = true
+
+	uploaded := filepath.Join(dir, "0.log")
+	ar.handleTaskNotify(newNotifyInfo(notifyTypeOutputTask, dir, uploaded, true))
+
+	// the file failed the last retry is not moved into the dead letter
+	failed := filepath.Join(dir, "1.log")
+	ar.fileCache[dir].files[failed].uploadFailedCount = 2
+	ar.handleTaskNotify(newNotifyInfo(notifyTypeOutputTask, dir, failed, false))
+
+	assert.Equal(t, 0, len(ar.deleteChan))
+	assert.FileExists(t, uploaded)
+	assert.FileExists(t, failed)
+	assert.Equal(t, fileStatusUploaded, ar.fileCache[dir].files[uploaded].status)
+
+	// nothing is uploaded, so the state is not saved
+	ar.saveState(time.Now().Unix())
+	assert.NoFileExists(t, ar.StateFile)
+}
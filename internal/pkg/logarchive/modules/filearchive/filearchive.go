@@ -8,7 +8,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/atframework/atdtool/internal/pkg/logarchive"
@@ -40,6 +42,19 @@ const (
 	discardReasonReachMaxRetry = -10000
 )
 
+// CollectMode defines how the archive discovers new files in watched paths.
+type CollectMode string
+
+const (
+	// CollectModeNotify relies on filesystem notification (inotify/kqueue/ReadDirectoryChangesW).
+	CollectModeNotify CollectMode = "notify"
+	// CollectModePoll periodically rescans watched paths, used for NFS/CIFS mounts
+	// which do not deliver notification events for changes made by other hosts.
+	CollectModePoll CollectMode = "poll"
+)
+
+const defaultScanInterval = 10
+
 // FileCollectRule defines the rules for collecting files in the archive process.
 // It contains configuration options for how source files should be handled after archiving.
 type FileCollectRule struct {
@@ -47,6 +62,15 @@ type FileCollectRule struct {
 	ModifyProtectTime int64 `yaml:"modifyProtectTime,omitempty" json:"modifyProtectTime,omitempty"`
 }
 
+// Collector customizes which files are collected and where they are stored,
+// it allows archive modules to be built on top of the file archive.
+type Collector interface {
+	// Accept reports whether the file should be collected.
+	Accept(rootPath, filePath string) bool
+	// DestPath returns the destination path of the file relative to the output.
+	DestPath(rootPath, filePath string) (string, error)
+}
+
 // Archive represents the main structure for file archiving operations.
 // It contains configuration and runtime state for monitoring, uploading and managing files.
 type Archive struct {
@@ -54,17 +78,86 @@ type Archive struct {
 	Paths        []string        `yaml:"paths,omitempty" json:"paths,omitempty"`
 	ExcludeFiles []string        `yaml:"excludeFiles,omitempty" json:"excludeFiles,omitempty"`
 	CollectRule  FileCollectRule `yaml:"collectRule,omitempty" json:"collectRule,omitempty"`
-	OutputRaw    json.RawMessage `yaml:"output,omitempty" json:"output,omitempty" filearchive:"namespace=output inline_key=type"`
+	DeleteRule   FileDeleteRule  `yaml:"deleteRule,omitempty" json:"deleteRule,omitempty"`
+	CollectMode  CollectMode     `yaml:"collectMode,omitempty" json:"collectMode,omitempty"`
+	ScanInterval int             `yaml:"scanInterval,omitempty" json:"scanInterval,omitempty"`
+	OutputRaw    json.RawMessage `yaml:"output,omitempty" json:"output,omitempty" logarchive:"namespace=output inline_key=type"`
+	// FiltersRaw transform the content of the files in order before uploading
+	FiltersRaw []json.RawMessage `yaml:"filters,omitempty" json:"filters,omitempty" logarchive:"namespace=filter inline_key=type"`
+
+	// DeadLetterDir keeps the files which have failed to upload instead of deleting them
+	DeadLetterDir string `yaml:"deadLetterDir,omitempty" json:"deadLetterDir,omitempty"`
+	// NeverDelete is the patterns of the files which are never deleted or moved
+	// even if the source files are not kept, as a safety net of misconfiguration
+	NeverDelete []string `yaml:"neverDelete,omitempty" json:"neverDelete,omitempty"`
+	// StateFile records the uploaded files, so that the files not uploaded before restart
+	// are uploaded again when source files are kept
+	StateFile string `yaml:"stateFile,omitempty" json:"stateFile,omitempty"`
+	// Dedup skips the files whose content has been uploaded
+	Dedup FileDedupRule `yaml:"dedup,omitempty" json:"dedup,omitempty"`
+	// UploadWindow limits when the uploads are dispatched, the files are still
+	// discovered all the time
+	UploadWindow FileUploadWindow `yaml:"uploadWindow,omitempty" json:"uploadWindow,omitempty"`
+
+	// MaxPoolSize enables extra workers when tasks are waiting in the queue
+	MaxPoolSize int `yaml:"maxPoolSize,omitempty" json:"maxPoolSize,omitempty"`
+	// QueueSize is the capacity of the task queue
+	QueueSize int `yaml:"queueSize,omitempty" json:"queueSize,omitempty"`
+	// SubmitTimeout is the milliseconds to wait when the task queue is full
+	SubmitTimeout int `yaml:"submitTimeout,omitempty" json:"submitTimeout,omitempty"`
+
+	// MaxInFlight limits the files queued or uploading of the archive
+	MaxInFlight int `yaml:"maxInFlight,omitempty" json:"maxInFlight,omitempty"`
+	// MaxInFlightPerPath limits the files queued or uploading of each watched path
+	MaxInFlightPerPath int `yaml:"maxInFlightPerPath,omitempty" json:"maxInFlightPerPath,omitempty"`
+
+	// WatchLimit is checked before watching the paths in the notify collect mode
+	WatchLimit WatchLimitRule `yaml:"watchLimit,omitempty" json:"watchLimit,omitempty"`
 
 	ctx       logarchive.Context
 	fileCache fileCacheMap
 
-	output logarchive.Outputter
+	output    logarchive.Outputter
+	filters   []logarchive.Filter
+	collector Collector
+
+	ticker     *time.Ticker
+	scanTicker *time.Ticker
+	watcher    *fsnotify.Watcher
+	logger     *zap.SugaredLogger
+	regs       []*regexp.Regexp
+
+	ignoreFiles map[string]*ignoreFile
 
-	ticker  *time.Ticker
-	watcher *fsnotify.Watcher
-	logger  *zap.SugaredLogger
-	regs    []*regexp.Regexp
+	inodes        map[fileID]string
+	renamed       map[string]string
+	lastPruneTime int64
+	lastTick      time.Time
+
+	state         *archiveState
+	dedup         *dedupIndex
+	lastState     []byte
+	lastStateTime int64
+
+	workers int32
+
+	running int32
+	paused  int32
+	// outOfWindow is set when the time is out of the upload window
+	outOfWindow bool
+	watcherErr  atomic.Value
+
+	inFlight       map[string]int
+	inFlightTotal  int
+	scheduleOffset int
+
+	quota        *logarchive.ArchiveQuota
+	events       *logarchive.EventBus
+	audit        *logarchive.Audit
+	dryRun       bool
+	queuedSizes  map[string]int64
+	pendingFiles int
+	overQuota    bool
 
 	done       chan struct{}
 	deleteChan chan *fileCacheKey
@@ -76,14 +169,24 @@ type fileInfo struct {
 	uploadFailedCount int
 	deleteFailedCount int
 	protectedEndTime  int64
-	status            fileStatus
+	// modTime is the modification time of the file when protectedEndTime was computed
+	modTime        int64
+	discoveredTime int64
+	status         fileStatus
+	destination    string
+	id             fileID
+	hasID          bool
 }
 
 type notifyInfo struct {
 	typ       notifyType
+	rootPath  string
 	watchPath string
 	filePath  string
 	result    bool
+	errMsg    string
+	// destination is where the file has been uploaded
+	destination string
 }
 
 // ArchiveModule returns the file module information.
@@ -102,11 +205,37 @@ func (ar *Archive) Provision(ctx logarchive.Context) error {
 	ar.logger = ctx.Logger().Sugar().Named("file")
 	ar.ticker = time.NewTicker(time.Second)
 	ar.fileCache = make(fileCacheMap)
+	ar.ignoreFiles = make(map[string]*ignoreFile)
+	ar.inodes = make(map[fileID]string)
+	ar.renamed = make(map[string]string)
+	ar.inFlight = make(map[string]int)
+	ar.queuedSizes = make(map[string]int64)
+	ar.quota = ctx.Quota(ar.archiveName())
+	ar.events = ctx.Events()
+	ar.audit = ctx.Audit()
+	ar.dryRun = ctx.DryRun()
 
 	if ar.PoolSize == 0 {
 		ar.PoolSize = 1
 	}
 
+	if ar.MaxPoolSize != 0 && ar.MaxPoolSize < ar.PoolSize {
+		return fmt.Errorf("max pool size: %d is less than pool size: %d", ar.MaxPoolSize, ar.PoolSize)
+	}
+
+	if ar.QueueSize <= 0 {
+		ar.QueueSize = defaultQueueSize
+	}
+
+	if ar.DeleteRule.HelperSocket != "" && ar.DeleteRule.HelperTimeout <= 0 {
+		ar.DeleteRule.HelperTimeout = defaultHelperTimeout
+	}
+
+	// the helper only receives the path, the file removed by it is not shredded
+	if ar.DeleteRule.Shred && ar.DeleteRule.HelperSocket != "" {
+		return fmt.Errorf("delete rule: shred could not be used with helperSocket")
+	}
+
 	var err error
 
 	// load output module
@@ -117,11 +246,39 @@ func (ar *Archive) Provision(ctx logarchive.Context) error {
 
 	ar.output = mod.(logarchive.Outputter)
 
-	if ar.watcher == nil {
-		ar.watcher, err = fsnotify.NewWatcher()
-		if err != nil {
-			return fmt.Errorf("new watcher %v", err)
+	// load filter modules
+	mods, err := ctx.LoadModule(ar, "FiltersRaw")
+	if err != nil {
+		return err
+	}
+	for _, mod := range mods.([]any) {
+		f, ok := mod.(logarchive.Filter)
+		if !ok {
+			return fmt.Errorf("module %T is not a filter", mod)
 		}
+		ar.filters = append(ar.filters, f)
+	}
+
+	switch ar.CollectMode {
+	case "", CollectModeNotify:
+		ar.CollectMode = CollectModeNotify
+		if ar.watcher == nil {
+			ar.watcher, err = fsnotify.NewWatcher()
+			if err != nil {
+				return fmt.Errorf("new watcher %v", err)
+			}
+		}
+	case CollectModePoll:
+		if ar.ScanInterval <= 0 {
+			ar.ScanInterval = defaultScanInterval
+		}
+		ar.scanTicker = time.NewTicker(time.Second * time.Duration(ar.ScanInterval))
+	default:
+		return fmt.Errorf("unsupport collect mode: %s", ar.CollectMode)
+	}
+
+	if err = ar.validateNeverDelete(); err != nil {
+		return err
 	}
 
 	if len(ar.ExcludeFiles) != 0 {
@@ -135,10 +292,41 @@ func (ar *Archive) Provision(ctx logarchive.Context) error {
 	}
 
 	ar.done = make(chan struct{})
-	ar.tasks = make(chan func() error, 1000)
+	ar.tasks = make(chan func() error, ar.QueueSize)
 	ar.notifyChan = make(chan *notifyInfo, 100)
 	ar.deleteChan = make(chan *fileCacheKey, 100)
 
+	if ar.Dedup.Enabled {
+		ar.dedup = newDedupIndex(ar.Dedup.MaxEntries)
+	}
+
+	if err := ar.UploadWindow.provision(); err != nil {
+		return fmt.Errorf("upload window: %v", err)
+	}
+
+	if ar.StateFile != "" && (ar.CollectRule.KeepSourceFile || ar.dedup != nil) {
+		state, err := loadState(ar.StateFile)
+		if err != nil {
+			return fmt.Errorf("load state file: %v", err)
+		}
+		if state != nil && ar.dedup != nil {
+			for _, h := range state.hashes {
+				ar.dedup.add(h.Hash, h.Destination)
+			}
+		}
+		if ar.CollectRule.KeepSourceFile {
+			// the state is only used by the files existing at startup
+			ar.state = state
+			defer func() { ar.state = nil }()
+		}
+	}
+
+	if ar.CollectMode == CollectModeNotify {
+		if err = ar.checkWatchLimit(); err != nil {
+			return err
+		}
+	}
+
 	for _, rootPath := range ar.Paths {
 		if walkErr := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
@@ -149,7 +337,7 @@ func (ar *Archive) Provision(ctx logarchive.Context) error {
 				return nil
 			}
 
-			return ar.addWatchPath(rootPath, path)
+			return ar.addWatchPath(rootPath, path, true)
 		}); walkErr != nil {
 			return walkErr
 		}
@@ -157,6 +345,11 @@ func (ar *Archive) Provision(ctx logarchive.Context) error {
 	return nil
 }
 
+// WatchedPaths implement the path watcher interface
+func (ar *Archive) WatchedPaths() []string {
+	return ar.Paths
+}
+
 // Validate implement the module interface
 func (ar *Archive) Validate() error {
 	for _, path := range ar.Paths {
@@ -164,6 +357,14 @@ func (ar *Archive) Validate() error {
 		if err != nil {
 			return err
 		}
+
+		// the files in dead letter are collected again if it is watched
+		if ar.DeadLetterDir != "" && isInsidePath(path, ar.DeadLetterDir) {
+			return fmt.Errorf("dead letter dir: %s is inside the watched path: %s", ar.DeadLetterDir, path)
+		}
+		if ar.StateFile != "" && isInsidePath(path, ar.StateFile) {
+			return fmt.Errorf("state file: %s is inside the watched path: %s", ar.StateFile, path)
+		}
 	}
 	return nil
 }
@@ -177,12 +378,13 @@ func (ar *Archive) Cleanup() error {
 func (ar *Archive) Start() error {
 	// start output task
 	for i := 0; i < ar.PoolSize; i++ {
-		go ar.runOutputTask()
-		if !ar.CollectRule.KeepSourceFile {
+		ar.startWorker(false)
+		if !ar.keepSourceFile() {
 			go ar.runDeleteFileTask()
 		}
 	}
 
+	atomic.StoreInt32(&ar.running, 1)
 	go ar.run()
 	return nil
 }
@@ -195,9 +397,14 @@ func (ar *Archive) Stop() error {
 
 	close(ar.done)
 
-	err := ar.watcher.Close()
-	if err != nil {
-		return err
+	if ar.scanTicker != nil {
+		ar.scanTicker.Stop()
+	}
+
+	if ar.watcher != nil {
+		if err := ar.watcher.Close(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -212,6 +419,21 @@ func (ar *Archive) hasStopped() bool {
 }
 
 func (ar *Archive) run() {
+	defer atomic.StoreInt32(&ar.running, 0)
+
+	// nil channels block forever, so the unused source never fires
+	var (
+		events   chan fsnotify.Event
+		errs     chan error
+		scanTick <-chan time.Time
+	)
+	if ar.watcher != nil {
+		events, errs = ar.watcher.Events, ar.watcher.Errors
+	}
+	if ar.scanTicker != nil {
+		scanTick = ar.scanTicker.C
+	}
+
 	for {
 		select {
 		case <-ar.ctx.Done():
@@ -221,20 +443,27 @@ func (ar *Archive) run() {
 				return
 			}
 			ar.handleTaskNotify(e)
-		case event, ok := <-ar.watcher.Events:
+		case _, ok := <-scanTick:
+			if !ok {
+				return
+			}
+			ar.scanWatchPaths()
+		case event, ok := <-events:
 			if !ok {
 				return
 			}
 
 			ar.logger.Debugf("fs event notify name: %s event: %s", event.Name, event.Op.String())
+			ar.countWatcherEvent(event)
 
 			if err := ar.handleWatcherEvent(event); err != nil {
 				ar.logger.Errorf("handle watcher event: %v", err)
 			}
-		case err, ok := <-ar.watcher.Errors:
+		case err, ok := <-errs:
 			if !ok {
 				return
 			}
+			ar.watcherErr.Store(&watcherError{err: err, time: time.Now()})
 			ar.logger.Errorf("watcher error: %v", err)
 		case t, ok := <-ar.ticker.C:
 			if !ok {
@@ -249,67 +478,44 @@ func (ar *Archive) run() {
 				logarchive.DiskUsage.WithLabelValues(ar.ArchiveModule().ID.Name(), usage.Path, usage.Fstype).Set(usage.UsedPercent)
 			}
 
-			for watchPath, cache := range ar.fileCache {
-				for k, v := range cache.files {
-					if v.status != fileStatusWaitUpload || v.protectedEndTime > t.Unix() {
-						continue
-					}
-
-					info, err := os.Stat(k)
-					if err != nil {
-						delete(cache.files, k)
-						continue
-					}
-
-					protectedEndTime := info.ModTime().Unix() + ar.CollectRule.ModifyProtectTime
-					if protectedEndTime > t.Unix() {
-						v.protectedEndTime = protectedEndTime
-						continue
-					}
-
-					if v.uploadFailedCount == 0 {
-						logarchive.InputRequestSize.WithLabelValues(ar.ArchiveModule().ID.Name()).Observe(float64(info.Size()))
-					}
-
-					v.status = fileStatusUploading
-					if !ar.trySubmitTask(func() error {
-						task := ar.output.TaskInfo().New()
-						err = ar.fillTaskInfo(task, cache.rootPath, k)
-						if err != nil {
-							ar.logger.Errorf("fill task info: %v", err)
-							ar.notifyTaskExecuteResult(watchPath, k, false)
-							return err
-						}
-
-						err = ar.output.Execute(task)
-						if err != nil {
-							ar.notifyTaskExecuteResult(watchPath, k, false)
-							ar.logger.Errorf("execute input task failed: %v, filepath: %s", err, k)
-							return err
-						}
-
-						ar.notifyTaskExecuteResult(watchPath, k, true)
-						return err
-					}) {
-						v.status = fileStatusWaitUpload
-					}
-				}
+			if jump := ar.detectClockJump(t); jump != 0 {
+				ar.handleClockJump(jump)
 			}
 
+			backlogAge := ar.scheduleUploads(t.Unix())
+			ar.rescanUnderQuota()
+
+			ar.pruneUploaded(t.Unix())
+			ar.saveState(t.Unix())
+			ar.scalePool()
+
 			logarchive.InputQueneSize.WithLabelValues(ar.ArchiveModule().ID.Name()).Set(float64(len(ar.tasks)))
+			logarchive.InputBacklogAge.WithLabelValues(ar.ArchiveModule().ID.Name()).Set(float64(backlogAge))
+			logarchive.InputFilesPending.WithLabelValues(ar.ArchiveModule().ID.Name()).Set(float64(ar.pendingFiles))
 		}
 	}
 }
 
-func (ar *Archive) runOutputTask() {
+func (ar *Archive) runOutputTask(elastic bool) {
 	ar.logger.Debug("output task start")
 
+	// nil channel blocks forever, so the worker which is not elastic never be idle
+	var idle <-chan time.Time
 	for {
+		if elastic {
+			idle = time.After(workerIdleTimeout)
+		}
+
 		select {
 		case <-ar.ctx.Done():
 			return
 		case <-ar.done:
 			return
+		case <-idle:
+			if ar.stopIdleWorker() {
+				ar.logger.Debug("idle output task exit")
+				return
+			}
 		case task, ok := <-ar.tasks:
 			if task == nil || !ok {
 				return
@@ -333,25 +539,39 @@ func (ar *Archive) runDeleteFileTask() {
 				return
 			}
 
-			defer releaseCacheKey(e)
-
 			var result bool = false
-			if err := os.Remove(e.filePath); err != nil {
+			if err := ar.auditRemoveFile(e.filePath, e.destination); err != nil {
+				logarchive.InputDeleteFailedTotal.WithLabelValues(ar.ArchiveModule().ID.Name(), deleteFailReason(err)).Inc()
 				ar.logger.Errorf("remove file: %s got error: %v", e.filePath, err)
 			} else {
 				result = true
 				ar.logger.Infof("file: %s has been removed successfully", e.filePath)
+				ar.publishEvent(logarchive.EventFileDeleted, e.filePath, nil)
 			}
 
 			notify := newNotifyInfo(notifyTypeDeleteTask, e.watchPath, e.filePath, result)
+			releaseCacheKey(e)
 			ar.sendNotify(notify)
 		}
 	}
 }
 
+// countWatcherEvent counts the event by each of its ops.
+func (ar *Archive) countWatcherEvent(event fsnotify.Event) {
+	for _, op := range []fsnotify.Op{fsnotify.Create, fsnotify.Write, fsnotify.Remove, fsnotify.Rename, fsnotify.Chmod} {
+		if event.Has(op) {
+			logarchive.InputWatcherEvents.WithLabelValues(ar.ArchiveModule().ID.Name(), strings.ToLower(op.String())).Inc()
+		}
+	}
+}
+
 func (ar *Archive) handleWatcherEvent(event fsnotify.Event) error {
 	if event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
 		ar.removeCache(event.Name)
+		// the entry of a running task is released by the task result
+		if v, ok := ar.fileCache.getFile(filepath.Dir(event.Name), event.Name); ok && v.status != fileStatusUploading {
+			ar.untrackFile(filepath.Dir(event.Name), event.Name)
+		}
 		return nil
 	}
 
@@ -368,32 +588,39 @@ func (ar *Archive) handleWatcherEvent(event fsnotify.Event) error {
 	// add new watch path
 	if info.IsDir() {
 		for _, r := range ar.Paths {
-			if _, err := filepath.Rel(r, event.Name); err != nil {
+			if !isInsidePath(r, event.Name) {
 				continue
 			}
-			return ar.addWatchPath(r, event.Name)
+			return ar.addWatchPath(r, event.Name, false)
 		}
 		return fmt.Errorf("path: %s has no matched base path", event.Name)
 	}
 
-	// filter exculude files
-	for _, re := range ar.regs {
-		// skip execlude files
-		if re.MatchString(event.Name) {
-			return nil
-		}
-	}
-
 	cache, ok := ar.fileCache[filepath.Dir(event.Name)]
 	if !ok {
 		return fmt.Errorf("watch path:%s not found", filepath.Dir(event.Name))
 	}
 
-	fi := &fileInfo{
-		protectedEndTime: info.ModTime().Unix() + ar.CollectRule.ModifyProtectTime,
-		status:           fileStatusWaitUpload,
+	// skip exclude and ignored files
+	if ar.isExcluded(cache.rootPath, event.Name) {
+		return nil
+	}
+
+	if v, ok := cache.files[event.Name]; ok && v.hasID {
+		if id, ok := getFileID(info); ok && id == v.id {
+			// the file is already tracked, e.g. it has been moved back
+			return nil
+		}
+	}
+
+	fi, moved := ar.discoverFile(event.Name, info)
+	if !moved && !ar.admitFile(event.Name, fi) {
+		return nil
 	}
 	cache.files[event.Name] = fi
+	if moved {
+		return nil
+	}
 	ar.logger.Debugf("file:%s has been add into watch list", event.Name)
 	return nil
 }
@@ -404,6 +631,16 @@ func (ar *Archive) handleTaskNotify(e *notifyInfo) {
 
 	switch e.typ {
 	case notifyTypeOutputTask:
+		ar.updateInFlight(e.rootPath, -1)
+		if size, ok := ar.queuedSizes[e.filePath]; ok {
+			delete(ar.queuedSizes, e.filePath)
+			ar.quota.ReleaseQueued(size)
+		}
+
+		if newPath, ok := ar.resolveRenamed(e.filePath); ok {
+			e.watchPath, e.filePath = filepath.Dir(newPath), newPath
+		}
+
 		v, ok := ar.fileCache.getFile(e.watchPath, e.filePath)
 		if !ok {
 			break
@@ -421,17 +658,36 @@ func (ar *Archive) handleTaskNotify(e *notifyInfo) {
 
 		if e.result {
 			v.status = fileStatusUploaded
+			v.destination = e.destination
 		} else {
 			logarchive.InputDiscardTotal.WithLabelValues(ar.ArchiveModule().ID.Name(), strconv.Itoa(discardReasonReachMaxRetry)).Inc()
 			ar.logger.Errorf("path: %v output task execute has failed %d times", e.filePath, v.uploadFailedCount)
 		}
 
-		if !ar.CollectRule.KeepSourceFile {
+		if !ar.keepSourceFile() && ar.blockDelete(e.filePath) {
+			// the protected file is kept like KeepSourceFile
+			v.status = fileStatusUploaded
+			break
+		}
+
+		if !e.result && ar.DeadLetterDir != "" && !ar.keepSourceFile() {
+			if err := ar.moveToDeadLetter(ar.fileCache[e.watchPath].rootPath, e.filePath, v.uploadFailedCount, e.errMsg); err != nil {
+				ar.logger.Errorf("move file: %s to dead letter got error: %v", e.filePath, err)
+			} else {
+				ar.untrackFile(e.watchPath, e.filePath)
+				ar.logger.Warnf("file: %s has been moved to dead letter", e.filePath)
+				break
+			}
+		}
+
+		if !ar.keepSourceFile() {
 			key := newCacheKey(e.watchPath, e.filePath)
+			key.destination = v.destination
 			ar.deleteChan <- key
 		} else {
-			ar.fileCache.removeFile(e.watchPath, e.filePath)
-			ar.logger.Debugf("file:%s has been remove from watch list", e.filePath)
+			// keep the entry so that the file is not treated as a new file
+			// when it is found again by scanning or renaming
+			v.status = fileStatusUploaded
 		}
 	case notifyTypeDeleteTask:
 		v, ok := ar.fileCache.getFile(e.watchPath, e.filePath)
@@ -444,28 +700,42 @@ func (ar *Archive) handleTaskNotify(e *notifyInfo) {
 			// try delete file again
 			if v.deleteFailedCount < 3 {
 				key := newCacheKey(e.watchPath, e.filePath)
+				key.destination = v.destination
 				ar.deleteChan <- key
 				break
 			}
 		}
-		ar.fileCache.removeFile(e.watchPath, e.filePath)
+		ar.untrackFile(e.watchPath, e.filePath)
 		ar.logger.Debugf("file:%s has been remove from watch list", e.filePath)
 	}
 }
 
-func (ar *Archive) notifyTaskExecuteResult(watchPath, filePath string, result bool) {
-	notify := newNotifyInfo(notifyTypeOutputTask, watchPath, filePath, result)
+// keepSourceFile reports whether the uploaded files are kept, the files are
+// never deleted or moved in dry run mode.
+func (ar *Archive) keepSourceFile() bool {
+	return ar.CollectRule.KeepSourceFile || ar.dryRun
+}
+
+func (ar *Archive) notifyTaskExecuteResult(rootPath, watchPath, filePath, destination string, err error) {
+	notify := newNotifyInfo(notifyTypeOutputTask, watchPath, filePath, err == nil)
+	notify.rootPath = rootPath
+	notify.destination = destination
+	if err != nil {
+		notify.errMsg = err.Error()
+		ar.publishEvent(logarchive.EventUploadFailed, filePath, err)
+	} else {
+		ar.publishEvent(logarchive.EventUploadSucceeded, filePath, nil)
+	}
 	ar.sendNotify(notify)
 }
 
-func (ar *Archive) trySubmitTask(task func() error) (submitted bool) {
-	select {
-	case ar.tasks <- task:
-		submitted = true
-		return
-	default:
-		return
+// publishEvent publishes the event of the file to the subscribers of the event bus.
+func (ar *Archive) publishEvent(kind, filePath string, err error) {
+	e := logarchive.Event{Kind: kind, Archive: ar.archiveName(), File: filePath}
+	if err != nil {
+		e.Error = err.Error()
 	}
+	ar.events.Publish(e)
 }
 
 func (ar *Archive) sendNotify(notify *notifyInfo) {
@@ -475,17 +745,28 @@ func (ar *Archive) sendNotify(notify *notifyInfo) {
 }
 
 func (ar *Archive) removeCache(name string) {
+	if c, ok := ar.fileCache[name]; ok {
+		for k, v := range c.files {
+			if v.hasID && ar.inodes[v.id] == k {
+				delete(ar.inodes, v.id)
+			}
+		}
+	}
 	delete(ar.fileCache, name)
 	//ar.logger.Warnf("path: %s has been removed from watch list", name)
 }
 
-func (ar *Archive) addWatchPath(root, name string) error {
+// addWatchPath adds the directory into the file cache. When historical is true,
+// the files existing now are treated as collected if source files are kept.
+func (ar *Archive) addWatchPath(root, name string, historical bool) error {
 	if _, ok := ar.fileCache[name]; ok {
 		return nil
 	}
 
-	if watchErr := ar.watcher.AddWith(name); watchErr != nil {
-		return watchErr
+	if ar.watcher != nil {
+		if watchErr := ar.watcher.AddWith(name); watchErr != nil {
+			return watchLimitError(name, watchErr)
+		}
 	}
 
 	// TODO ignore unix.IN_MODIFY|unix.IN_ATTRIB
@@ -495,8 +776,9 @@ func (ar *Archive) addWatchPath(root, name string) error {
 		files:    make(map[string]*fileInfo),
 	}
 
-	// add historical files index
-	if !ar.CollectRule.KeepSourceFile {
+	// add historical files index, the files existing at startup are also recorded
+	// when source files are kept, so that they are not uploaded after renaming
+	if !ar.CollectRule.KeepSourceFile || historical || ar.CollectMode == CollectModePoll {
 		if walkErr := filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
@@ -509,12 +791,9 @@ func (ar *Archive) addWatchPath(root, name string) error {
 				return filepath.SkipDir
 			}
 
-			// filter exculude files
-			for _, re := range ar.regs {
-				// skip execlude files
-				if re.MatchString(path) {
-					return nil
-				}
+			// skip exclude and ignored files
+			if ar.isExcluded(root, path) {
+				return nil
 			}
 
 			if _, ok := cache.files[path]; !ok {
@@ -523,9 +802,11 @@ func (ar *Archive) addWatchPath(root, name string) error {
 					return err2
 				}
 
-				fi := &fileInfo{
-					protectedEndTime: info.ModTime().Unix() + ar.CollectRule.ModifyProtectTime,
-					status:           fileStatusWaitUpload,
+				fi, moved := ar.discoverFile(path, info)
+				if !moved && historical && ar.CollectRule.KeepSourceFile && (ar.state == nil || ar.state.isUploaded(path, fi)) {
+					fi.status = fileStatusUploaded
+				} else if !moved && !ar.admitFile(path, fi) {
+					return nil
 				}
 				cache.files[path] = fi
 			}
@@ -540,17 +821,54 @@ func (ar *Archive) addWatchPath(root, name string) error {
 	return nil
 }
 
-func (ar *Archive) fillTaskInfo(task logarchive.OutputTask, rootPath, filePath string) error {
+// SetCollector sets the collector, it must be called before Provision.
+func (ar *Archive) SetCollector(c Collector) {
+	ar.collector = c
+}
+
+// fillTaskInfo fills the task to upload the file, the content is read from
+// uploadPath which is the filtered file, or the file itself without filters.
+func (ar *Archive) fillTaskInfo(task logarchive.OutputTask, rootPath, filePath, uploadPath string) error {
 	switch t := task.(type) {
 	case *cos.Task:
 		t.RootPath = rootPath
-		t.FilePath = filePath
+		t.FilePath = uploadPath
+		if uploadPath != filePath {
+			dstPath, err := filepath.Rel(rootPath, filePath)
+			if err != nil {
+				return err
+			}
+			t.DstPath = dstPath
+		}
+		if ar.collector != nil {
+			dstPath, err := ar.collector.DestPath(rootPath, filePath)
+			if err != nil {
+				return err
+			}
+			t.DstPath = dstPath
+		}
 		return nil
 	default:
 		return fmt.Errorf("unsupport output task type")
 	}
 }
 
+func (ar *Archive) newFileInfo(info os.FileInfo) *fileInfo {
+	now := time.Now().Unix()
+	return &fileInfo{
+		protectedEndTime: ar.modifyProtectEndTime(info.ModTime().Unix(), now),
+		modTime:          info.ModTime().Unix(),
+		discoveredTime:   now,
+		status:           fileStatusWaitUpload,
+	}
+}
+
+// isInsidePath reports whether the path is the base path or inside it.
+func isInsidePath(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func newNotifyInfo(typ notifyType, watchPath, filePath string, result bool) *notifyInfo {
 	info := notifyPool.Get().(*notifyInfo)
 
@@ -566,10 +884,13 @@ func releaseNotifyInfo(info *notifyInfo) {
 		return
 	}
 
+	info.rootPath = ""
 	info.watchPath = ""
 	info.filePath = ""
 	info.typ = notifyTypeUnKnown
 	info.result = false
+	info.errMsg = ""
+	info.destination = ""
 	notifyPool.Put(info)
 }
 
@@ -589,4 +910,6 @@ var (
 	_ logarchive.Provisioner  = (*Archive)(nil)
 	_ logarchive.Validator    = (*Archive)(nil)
 	_ logarchive.CleanerUpper = (*Archive)(nil)
+	_ logarchive.Pauser       = (*Archive)(nil)
+	_ logarchive.PathWatcher  = (*Archive)(nil)
 )
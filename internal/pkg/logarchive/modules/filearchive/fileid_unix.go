@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package filearchive
+
+import (
+	"os"
+	"syscall"
+)
+
+// getFileID returns the device and inode number of the file.
+func getFileID(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// getFileLinks returns the number of hard links of the file.
+func getFileLinks(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return 0, false
+	}
+	return uint64(st.Nlink), true
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package filearchive
+
+import "os"
+
+// getFileID is not supported on windows, os.FileInfo does not carry the file index.
+func getFileID(_info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// getFileLinks is not supported on windows.
+func getFileLinks(_info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,43 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// filterFile writes the filtered content of the file into a temporary file,
+// which is uploaded instead of the file and removed by the caller. The
+// temporary file keeps the modification time of the file, which decides the
+// archive prefix of the output.
+func (ar *Archive) filterFile(filePath string) (string, error) {
+	src, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	dst, err := os.CreateTemp("", "logarchive-filter-*"+filepath.Ext(filePath))
+	if err != nil {
+		return "", err
+	}
+
+	err = logarchive.ApplyFilters(ar.filters, dst, src)
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chtimes(dst.Name(), info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
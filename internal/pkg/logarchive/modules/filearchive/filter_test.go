@@ -0,0 +1,62 @@
+package filearchive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/cos"
+)
+
+type upperFilter struct{}
+
+func (upperFilter) Filter(w io.Writer, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bytes.ToUpper(data))
+	return err
+}
+
+func TestFilterFile(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "sub", "a.log")
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := &Archive{filters: []logarchive.Filter{upperFilter{}}}
+	uploadPath, err := ar.filterFile(filePath)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.Remove(uploadPath)
+
+	data, err := os.ReadFile(uploadPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "DATA", string(data))
+	if info, err := os.Stat(uploadPath); assert.NoError(t, err) {
+		assert.True(t, modTime.Equal(info.ModTime()))
+	}
+
+	// the object is named after the source file
+	task := &cos.Task{}
+	if assert.NoError(t, ar.fillTaskInfo(task, root, filePath, uploadPath)) {
+		assert.Equal(t, uploadPath, task.FilePath)
+		assert.Equal(t, filepath.Join("sub", "a.log"), task.DstPath)
+	}
+}
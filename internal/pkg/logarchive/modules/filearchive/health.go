@@ -0,0 +1,45 @@
+package filearchive
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// watcherErrorPeriod is how long the archive is not ready after a watcher error,
+// e.g. the events overflowed and some files may be missed until the next scan.
+const watcherErrorPeriod = time.Minute
+
+type watcherError struct {
+	err  error
+	time time.Time
+}
+
+// Healthy implement the health checker interface, the archive could not recover
+// once the run loop exits, e.g. the watcher has been closed unexpectedly.
+func (ar *Archive) Healthy() error {
+	if ar.hasStopped() || atomic.LoadInt32(&ar.running) != 0 {
+		return nil
+	}
+	return fmt.Errorf("run loop has exited")
+}
+
+// Ready implement the ready checker interface.
+func (ar *Archive) Ready() error {
+	if n := len(ar.tasks); n != 0 && n >= cap(ar.tasks) {
+		return fmt.Errorf("task queue is full: %d", n)
+	}
+
+	if e, ok := ar.watcherErr.Load().(*watcherError); ok && time.Since(e.time) < watcherErrorPeriod {
+		return fmt.Errorf("watcher error at %s: %v", e.time.Format(time.RFC3339), e.err)
+	}
+
+	if rc, ok := ar.output.(logarchive.ReadyChecker); ok {
+		if err := rc.Ready(); err != nil {
+			return fmt.Errorf("output: %v", err)
+		}
+	}
+	return nil
+}
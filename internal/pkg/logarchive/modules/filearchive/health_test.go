@@ -0,0 +1,33 @@
+package filearchive
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveHealth(t *testing.T) {
+	ar := newScheduleTestArchive(t, 1, nil)
+
+	assert.ErrorContains(t, ar.Healthy(), "run loop has exited")
+	atomic.StoreInt32(&ar.running, 1)
+	assert.NoError(t, ar.Healthy())
+
+	assert.NoError(t, ar.Ready())
+	ar.tasks <- func() error { return nil }
+	assert.ErrorContains(t, ar.Ready(), "task queue is full: 1")
+	<-ar.tasks
+
+	ar.watcherErr.Store(&watcherError{err: errors.New("queue or buffer overflow"), time: time.Now()})
+	assert.ErrorContains(t, ar.Ready(), "queue or buffer overflow")
+	ar.watcherErr.Store(&watcherError{err: errors.New("queue or buffer overflow"), time: time.Now().Add(-watcherErrorPeriod)})
+	assert.NoError(t, ar.Ready())
+
+	// the stopped archive is not restarted
+	atomic.StoreInt32(&ar.running, 0)
+	close(ar.done)
+	assert.NoError(t, ar.Healthy())
+}
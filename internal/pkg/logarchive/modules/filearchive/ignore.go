@@ -0,0 +1,207 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/util"
+)
+
+// archiveIgnoreFile is the name of the per-directory ignore file, it uses gitignore syntax.
+const archiveIgnoreFile = ".archiveignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+type ignoreFile struct {
+	modTime time.Time
+	rules   []ignoreRule
+}
+
+// match reports whether the slash separated relative path is ignored by this file.
+// The second return value is false when no rule matched the path.
+func (f *ignoreFile) match(rel string, isDir bool) (ignored bool, matched bool) {
+	for _, r := range f.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			ignored, matched = !r.negate, true
+		}
+	}
+	return
+}
+
+// parseIgnoreRules parses gitignore style patterns.
+func parseIgnoreRules(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		// a pattern with a slash in the beginning or middle is relative to the ignore file
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		expr := globToRegexp(line)
+		if anchored {
+			expr = "^" + expr + "$"
+		} else {
+			expr = "^(.*/)?" + expr + "$"
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					b.WriteString("(.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// loadIgnoreFile returns the rules of the ignore file in dir, it is re-read
+// whenever the modification time of the file changes.
+func (ar *Archive) loadIgnoreFile(dir string) *ignoreFile {
+	name := filepath.Join(dir, archiveIgnoreFile)
+	info, err := os.Stat(name)
+	if err != nil {
+		delete(ar.ignoreFiles, dir)
+		return nil
+	}
+
+	if f, ok := ar.ignoreFiles[dir]; ok && f.modTime.Equal(info.ModTime()) {
+		return f
+	}
+
+	lines, err := util.GetLines(name)
+	if err != nil {
+		ar.logger.Errorf("read ignore file: %s failed: %v", name, err)
+		return ar.ignoreFiles[dir]
+	}
+
+	f := &ignoreFile{
+		modTime: info.ModTime(),
+		rules:   parseIgnoreRules(lines),
+	}
+	ar.ignoreFiles[dir] = f
+	ar.logger.Infof("ignore file: %s has been loaded, %d rules", name, len(f.rules))
+	return f
+}
+
+// isIgnored checks the ignore files from the root path down to the directory of
+// the file, the rules of deeper ignore files take precedence.
+func (ar *Archive) isIgnored(rootPath, path string) bool {
+	if filepath.Base(path) == archiveIgnoreFile {
+		return true
+	}
+
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	ignored := false
+	dir := rootPath
+	for i := range parts {
+		f := ar.loadIgnoreFile(dir)
+		if f != nil {
+			// check every parent directory of the file, then the file itself
+			for j := i; j < len(parts); j++ {
+				if v, ok := f.match(strings.Join(parts[i:j+1], "/"), j < len(parts)-1); ok {
+					ignored = v
+					if v && j < len(parts)-1 {
+						// an excluded directory can not be re-included by its children
+						return true
+					}
+				}
+			}
+		}
+		dir = filepath.Join(dir, parts[i])
+	}
+	return ignored
+}
+
+// isExcluded reports whether the file should not be collected.
+func (ar *Archive) isExcluded(rootPath, path string) bool {
+	if ar.collector != nil && !ar.collector.Accept(rootPath, path) {
+		return true
+	}
+
+	// filter exculude files
+	for _, re := range ar.regs {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return ar.isIgnored(rootPath, path)
+}
@@ -0,0 +1,91 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIgnoreFileMatch(t *testing.T) {
+	f := &ignoreFile{rules: parseIgnoreRules([]string{
+		"# comment",
+		"",
+		"*.tmp",
+		"!keep.tmp",
+		"/debug.log",
+		"cache/",
+		"data/**/raw.log",
+	})}
+
+	tests := []struct {
+		name    string
+		rel     string
+		isDir   bool
+		ignored bool
+		matched bool
+	}{
+		{"glob matches in any directory", "a/b/x.tmp", false, true, true},
+		{"negation re-includes", "keep.tmp", false, false, true},
+		{"anchored pattern matches at root", "debug.log", false, true, true},
+		{"anchored pattern does not match below root", "sub/debug.log", false, false, false},
+		{"directory only pattern matches directory", "cache", true, true, true},
+		{"directory only pattern skips files", "cache", false, false, false},
+		{"double star matches nested directories", "data/x/y/raw.log", false, true, true},
+		{"double star matches zero directories", "data/raw.log", false, true, true},
+		{"no match", "app.log", false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ignored, matched := f.match(tt.rel, tt.isDir)
+			assert.Equal(t, tt.ignored, ignored)
+			assert.Equal(t, tt.matched, matched)
+		})
+	}
+}
+
+func TestArchiveIsIgnored(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(sub, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, archiveIgnoreFile), []byte("*.gz\ntmp/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, archiveIgnoreFile), []byte("!important.gz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := &Archive{
+		ignoreFiles: make(map[string]*ignoreFile),
+		logger:      zap.NewNop().Sugar(),
+	}
+
+	assert.True(t, ar.isIgnored(root, filepath.Join(root, archiveIgnoreFile)))
+	assert.True(t, ar.isIgnored(root, filepath.Join(root, "a.gz")))
+	assert.True(t, ar.isIgnored(root, filepath.Join(sub, "b.gz")))
+	assert.False(t, ar.isIgnored(root, filepath.Join(sub, "important.gz")))
+	assert.True(t, ar.isIgnored(root, filepath.Join(root, "tmp", "a.log")))
+	assert.False(t, ar.isIgnored(root, filepath.Join(sub, "a.log")))
+
+	// the ignore file is re-read after it has been changed
+	name := filepath.Join(root, archiveIgnoreFile)
+	if err := os.WriteFile(name, []byte("*.log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, ar.isIgnored(root, filepath.Join(sub, "a.log")))
+	assert.False(t, ar.isIgnored(root, filepath.Join(root, "a.gz")))
+}
@@ -0,0 +1,22 @@
+package filearchive
+
+import "sync/atomic"
+
+// Pause implement the pauser interface, the files are still collected but not
+// submitted to upload, the uploading files are finished.
+func (ar *Archive) Pause() {
+	if atomic.CompareAndSwapInt32(&ar.paused, 0, 1) {
+		ar.logger.Info("uploads paused")
+	}
+}
+
+// Resume implement the pauser interface
+func (ar *Archive) Resume() {
+	if atomic.CompareAndSwapInt32(&ar.paused, 1, 0) {
+		ar.logger.Info("uploads resumed")
+	}
+}
+
+func (ar *Archive) isPaused() bool {
+	return atomic.LoadInt32(&ar.paused) != 0
+}
@@ -0,0 +1,111 @@
+package filearchive
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// scanWatchPaths rescans all root paths and diffs the result against the file cache.
+// It is used by the poll collect mode instead of filesystem notification.
+func (ar *Archive) scanWatchPaths() {
+	// drop watch paths which have been removed
+	for watchPath := range ar.fileCache {
+		if _, err := os.Stat(watchPath); os.IsNotExist(err) {
+			ar.removeCache(watchPath)
+		}
+	}
+
+	found := make(map[string]os.FileInfo)
+	for _, rootPath := range ar.Paths {
+		walkErr := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// the file may be removed during scanning
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			if d.IsDir() {
+				if _, ok := ar.fileCache[path]; ok {
+					return nil
+				}
+				// the directory appeared after startup, all of its files are new
+				return ar.addWatchPath(rootPath, path, false)
+			}
+
+			cache, ok := ar.fileCache[filepath.Dir(path)]
+			if !ok || ar.isExcluded(cache.rootPath, path) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			found[path] = info
+			return nil
+		})
+		if walkErr != nil {
+			ar.logger.Errorf("scan path: %s failed: %v", rootPath, walkErr)
+		}
+	}
+
+	// the renamed files must be moved before new files take over their old names
+	var added []string
+	for path, info := range found {
+		if ar.isTracked(path, info) {
+			continue
+		}
+
+		if id, ok := getFileID(info); ok {
+			if oldPath, renamed := ar.inodes[id]; renamed && oldPath != path {
+				if fi, moved := ar.discoverFile(path, info); moved {
+					ar.fileCache[filepath.Dir(path)].files[path] = fi
+					continue
+				}
+			}
+		}
+		added = append(added, path)
+	}
+
+	for _, path := range added {
+		if ar.isTracked(path, found[path]) {
+			continue
+		}
+
+		// the old file may have been replaced by a new one
+		ar.untrackFile(filepath.Dir(path), path)
+
+		fi, _ := ar.discoverFile(path, found[path])
+		if !ar.admitFile(path, fi) {
+			continue
+		}
+		ar.fileCache[filepath.Dir(path)].files[path] = fi
+		ar.logger.Debugf("file:%s has been add into watch list by scanning", path)
+	}
+
+	// forget uploaded files which have disappeared from disk
+	for watchPath, cache := range ar.fileCache {
+		for k, v := range cache.files {
+			if v.status != fileStatusUploaded {
+				continue
+			}
+			if _, ok := found[k]; !ok {
+				ar.untrackFile(watchPath, k)
+			}
+		}
+	}
+}
+
+// isTracked reports whether the cache entry of path refers to the same file.
+func (ar *Archive) isTracked(path string, info os.FileInfo) bool {
+	v, ok := ar.fileCache.getFile(filepath.Dir(path), path)
+	if !ok {
+		return false
+	}
+
+	id, hasID := getFileID(info)
+	return !v.hasID || !hasID || id == v.id
+}
@@ -0,0 +1,110 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestArchive() *Archive {
+	return &Archive{
+		fileCache:   make(fileCacheMap),
+		ignoreFiles: make(map[string]*ignoreFile),
+		inodes:      make(map[fileID]string),
+		renamed:     make(map[string]string),
+		logger:      zap.NewNop().Sugar(),
+	}
+}
+
+// newPollArchive watches the dir in the poll collect mode, the files existing
+// now are collected.
+func newPollArchive(t *testing.T, dir string) *Archive {
+	ar := newTestArchive()
+	ar.Paths = []string{dir}
+	ar.CollectMode = CollectModePoll
+	ar.CollectRule.KeepSourceFile = true
+	if err := ar.addWatchPath(dir, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	return ar
+}
+
+func writeFiles(t *testing.T, names ...string) {
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("log"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveScanWatchPathsDiscoversNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.log")
+	writeFiles(t, old)
+
+	ar := newPollArchive(t, dir)
+	ar.regs = []*regexp.Regexp{regexp.MustCompile(`\.tmp$`)}
+
+	// the new files and the files of the new directories are found by the
+	// next scan
+	sub := filepath.Join(dir, "sub")
+	added := []string{filepath.Join(dir, "new.log"), filepath.Join(sub, "a.log"), filepath.Join(sub, "deep", "b.log")}
+	writeFiles(t, append(added, filepath.Join(dir, "new.tmp"))...)
+	ar.scanWatchPaths()
+
+	for _, name := range []string{sub, filepath.Join(sub, "deep")} {
+		if assert.Contains(t, ar.fileCache, name) {
+			assert.Equal(t, dir, ar.fileCache[name].rootPath)
+		}
+	}
+	for _, name := range added {
+		if fi, ok := ar.fileCache.getFile(filepath.Dir(name), name); assert.True(t, ok, name) {
+			assert.Equal(t, fileStatusWaitUpload, fi.status, name)
+		}
+	}
+	assert.Equal(t, fileStatusUploaded, ar.fileCache[dir].files[old].status)
+	assert.NotContains(t, ar.fileCache[dir].files, filepath.Join(dir, "new.tmp"))
+
+	// the tracked files are kept by the following scans
+	ar.fileCache[dir].files[added[0]].status = fileStatusUploading
+	ar.scanWatchPaths()
+	assert.Equal(t, fileStatusUploading, ar.fileCache[dir].files[added[0]].status)
+	assert.Len(t, ar.fileCache[dir].files, 2)
+}
+
+func TestArchiveScanWatchPathsForgetsRemovedDirs(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	name := filepath.Join(sub, "a.log")
+	writeFiles(t, name)
+
+	ar := newPollArchive(t, dir)
+	ar.scanWatchPaths()
+	if !assert.Contains(t, ar.fileCache, sub) {
+		return
+	}
+	fi := ar.fileCache[sub].files[name]
+
+	if err := os.RemoveAll(sub); err != nil {
+		t.Fatal(err)
+	}
+	ar.scanWatchPaths()
+	assert.NotContains(t, ar.fileCache, sub)
+	if fi.hasID {
+		assert.NotContains(t, ar.inodes, fi.id)
+	}
+
+	// the directory created again is a new one
+	writeFiles(t, name)
+	ar.scanWatchPaths()
+	if got, ok := ar.fileCache.getFile(sub, name); assert.True(t, ok) {
+		assert.Equal(t, fileStatusWaitUpload, got.status)
+	}
+}
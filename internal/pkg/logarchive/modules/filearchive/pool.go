@@ -0,0 +1,79 @@
+package filearchive
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const (
+	defaultQueueSize = 1000
+	// workerIdleTimeout is the time an extra worker waits for a task before it exits
+	workerIdleTimeout = 30 * time.Second
+)
+
+// startWorker starts an output worker. The extra workers beyond PoolSize are
+// elastic, they exit after being idle for a while.
+func (ar *Archive) startWorker(elastic bool) {
+	n := atomic.AddInt32(&ar.workers, 1)
+	logarchive.InputWorkerCount.WithLabelValues(ar.ArchiveModule().ID.Name()).Set(float64(n))
+	go ar.runOutputTask(elastic)
+}
+
+// scalePool starts extra workers for the tasks waiting in the queue, up to MaxPoolSize.
+func (ar *Archive) scalePool() {
+	if ar.MaxPoolSize <= ar.PoolSize {
+		return
+	}
+
+	workers := int(atomic.LoadInt32(&ar.workers))
+	n := min(len(ar.tasks), ar.MaxPoolSize-workers)
+	for i := 0; i < n; i++ {
+		ar.startWorker(true)
+	}
+	if n > 0 {
+		ar.logger.Debugf("pool has been scaled up to %d workers", workers+n)
+	}
+}
+
+// stopIdleWorker reports whether the idle elastic worker should exit,
+// the pool is never scaled down below PoolSize.
+func (ar *Archive) stopIdleWorker() bool {
+	for {
+		n := atomic.LoadInt32(&ar.workers)
+		if int(n) <= ar.PoolSize {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&ar.workers, n, n-1) {
+			logarchive.InputWorkerCount.WithLabelValues(ar.ArchiveModule().ID.Name()).Set(float64(n - 1))
+			return true
+		}
+	}
+}
+
+// trySubmitTask puts the task into the queue. When the queue is full, it waits
+// for SubmitTimeout milliseconds at most, so that the burst is not starved.
+func (ar *Archive) trySubmitTask(task func() error) (submitted bool) {
+	select {
+	case ar.tasks <- task:
+		return true
+	default:
+	}
+
+	if ar.SubmitTimeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(time.Millisecond * time.Duration(ar.SubmitTimeout))
+	defer timer.Stop()
+
+	select {
+	case ar.tasks <- task:
+		return true
+	case <-timer.C:
+		return false
+	case <-ar.done:
+		return false
+	}
+}
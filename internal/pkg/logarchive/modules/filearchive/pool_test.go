@@ -0,0 +1,76 @@
+package filearchive
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func newPoolTestArchive(poolSize, maxPoolSize, queueSize int) *Archive {
+	return &Archive{
+		PoolSize:    poolSize,
+		MaxPoolSize: maxPoolSize,
+		ctx:         logarchive.Context{Context: context.Background()},
+		logger:      zap.NewNop().Sugar(),
+		done:        make(chan struct{}),
+		tasks:       make(chan func() error, queueSize),
+	}
+}
+
+func TestScalePool(t *testing.T) {
+	ar := newPoolTestArchive(1, 3, 10)
+	defer close(ar.done)
+
+	release := make(chan struct{})
+	var running int32
+	for i := 0; i < 5; i++ {
+		ar.tasks <- func() error {
+			atomic.AddInt32(&running, 1)
+			<-release
+			return nil
+		}
+	}
+
+	ar.startWorker(false)
+	ar.scalePool()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&ar.workers))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&running) == 3 }, time.Second, 10*time.Millisecond)
+
+	// never scaled beyond the max pool size
+	ar.scalePool()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&ar.workers))
+	close(release)
+
+	assert.True(t, ar.stopIdleWorker())
+	assert.True(t, ar.stopIdleWorker())
+	assert.False(t, ar.stopIdleWorker())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ar.workers))
+}
+
+func TestTrySubmitTaskTimeout(t *testing.T) {
+	ar := newPoolTestArchive(1, 0, 1)
+	defer close(ar.done)
+
+	task := func() error { return nil }
+	assert.True(t, ar.trySubmitTask(task))
+	assert.False(t, ar.trySubmitTask(task))
+
+	ar.SubmitTimeout = 50
+	start := time.Now()
+	assert.False(t, ar.trySubmitTask(task))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// the queue is drained while waiting
+	ar.SubmitTimeout = 1000
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-ar.tasks
+	}()
+	assert.True(t, ar.trySubmitTask(task))
+}
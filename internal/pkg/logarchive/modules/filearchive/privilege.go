@@ -0,0 +1,145 @@
+package filearchive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	deleteFailReasonPermission = "permission"
+	deleteFailReasonNotExist   = "not_exist"
+	deleteFailReasonOther      = "other"
+)
+
+const defaultHelperTimeout = 10
+
+// FileDeleteRule defines how the archive handles the files which can not be removed
+// because of the ownership, e.g. the volume is shared with a server running as another user.
+type FileDeleteRule struct {
+	// Chown takes the ownership of the file and its directory before retrying
+	Chown bool `yaml:"chown,omitempty" json:"chown,omitempty"`
+	// Chmod adds the write permission to the file and its directory before retrying
+	Chmod bool `yaml:"chmod,omitempty" json:"chmod,omitempty"`
+	// HelperSocket is the unix socket of a privileged helper which removes the file instead
+	HelperSocket  string `yaml:"helperSocket,omitempty" json:"helperSocket,omitempty"`
+	HelperTimeout int    `yaml:"helperTimeout,omitempty" json:"helperTimeout,omitempty"`
+	// Shred overwrites the content of the file before removing it, for the logs
+	// containing sensitive data. See shredFile for the limitations.
+	Shred bool `yaml:"shred,omitempty" json:"shred,omitempty"`
+}
+
+// removeFile removes the file, the permission of the file is fixed up or the deletion
+// is delegated to the helper if the file can not be removed due to permission.
+func (ar *Archive) removeFile(path string) error {
+	// the last line of defense, the protected files should not be sent here
+	if pattern := ar.protectedPattern(path); pattern != "" {
+		return fmt.Errorf("%w by pattern: %s", errDeleteProtected, pattern)
+	}
+
+	rule := ar.DeleteRule
+	remove := os.Remove
+	if rule.Shred {
+		remove = ar.shredFile
+	}
+
+	err := remove(path)
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+
+	if rule.Chown || rule.Chmod {
+		if fixErr := fixDeletePermission(path, rule.Chown, rule.Chmod); fixErr != nil {
+			ar.logger.Warnf("fix permission of file: %s got error: %v", path, fixErr)
+		}
+
+		if err = remove(path); err == nil || !errors.Is(err, fs.ErrPermission) {
+			return err
+		}
+	}
+
+	if rule.HelperSocket != "" {
+		if helperErr := removeByHelper(rule.HelperSocket, path, time.Second*time.Duration(rule.HelperTimeout)); helperErr != nil {
+			return fmt.Errorf("%w; additionally, helper: %v", err, helperErr)
+		}
+		return nil
+	}
+	return err
+}
+
+// fixDeletePermission changes the ownership or mode of the file and its directory,
+// the directory decides whether the file could be removed.
+func fixDeletePermission(path string, chown, chmod bool) error {
+	var errs []error
+	for _, p := range []string{filepath.Dir(path), path} {
+		if chown {
+			if err := os.Lchown(p, os.Getuid(), os.Getgid()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if chmod {
+			info, err := os.Lstat(p)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if info.Mode()&fs.ModeSymlink != 0 {
+				continue
+			}
+			if err := os.Chmod(p, info.Mode().Perm()|0200); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// removeByHelper asks the helper to remove the file. The request is the path
+// ended with a newline, and the helper replies "ok" or the error message in one line.
+func removeByHelper(socket, path string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("unix", socket, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", path); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	reply = strings.TrimSpace(reply)
+	if reply != "ok" {
+		return fmt.Errorf("remove file: %s", reply)
+	}
+	return nil
+}
+
+// deleteFailReason returns the reason label of the delete failure metric.
+func deleteFailReason(err error) string {
+	switch {
+	case errors.Is(err, errDeleteProtected):
+		return deleteFailReasonProtected
+	case errors.Is(err, fs.ErrPermission):
+		return deleteFailReasonPermission
+	case errors.Is(err, fs.ErrNotExist):
+		return deleteFailReasonNotExist
+	default:
+		return deleteFailReasonOther
+	}
+}
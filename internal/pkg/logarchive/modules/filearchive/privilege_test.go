@@ -0,0 +1,100 @@
+//go:build !windows
+// +build !windows
+
+package filearchive
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveHelper removes the requested files like a privileged helper.
+func serveHelper(t *testing.T, socket string) {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			path, err := bufio.NewReader(conn).ReadString('\n')
+			if err == nil {
+				if err = os.Remove(strings.TrimSpace(path)); err == nil {
+					fmt.Fprintln(conn, "ok")
+				} else {
+					fmt.Fprintln(conn, err)
+				}
+			}
+			conn.Close()
+		}
+	}()
+}
+
+func TestRemoveByHelper(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "helper.sock")
+	serveHelper(t, socket)
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, removeByHelper(socket, path, time.Second))
+	assert.NoFileExists(t, path)
+
+	err := removeByHelper(socket, path, time.Second)
+	assert.ErrorContains(t, err, "no such file or directory")
+
+	assert.Error(t, removeByHelper(filepath.Join(dir, "none.sock"), path, time.Second))
+}
+
+func TestFixDeletePermission(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("log"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+
+	if !assert.NoError(t, fixDeletePermission(path, false, true)) {
+		return
+	}
+
+	for _, p := range []string{dir, path} {
+		info, err := os.Stat(p)
+		if assert.NoError(t, err) {
+			assert.NotZero(t, info.Mode().Perm()&0200, p)
+		}
+	}
+	assert.NoError(t, os.Remove(path))
+}
+
+func TestDeleteFailReason(t *testing.T) {
+	assert.Equal(t, deleteFailReasonPermission, deleteFailReason(&fs.PathError{Op: "remove", Err: fs.ErrPermission}))
+	assert.Equal(t, deleteFailReasonPermission, deleteFailReason(fmt.Errorf("%w; additionally, helper: failed", fs.ErrPermission)))
+	assert.Equal(t, deleteFailReasonNotExist, deleteFailReason(&fs.PathError{Op: "remove", Err: fs.ErrNotExist}))
+	assert.Equal(t, deleteFailReasonOther, deleteFailReason(fs.ErrClosed))
+}
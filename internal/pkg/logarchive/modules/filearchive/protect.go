@@ -0,0 +1,68 @@
+package filearchive
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const deleteFailReasonProtected = "protected"
+
+var errDeleteProtected = errors.New("file is protected from deletion")
+
+// validateNeverDelete checks the syntax of the neverDelete patterns.
+func (ar *Archive) validateNeverDelete() error {
+	for _, pattern := range ar.NeverDelete {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid never delete pattern: %s: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// protectedPattern returns the neverDelete pattern matching the file, it is empty
+// when the file could be deleted. A pattern with a path separator matches the
+// path of the file or any of its parent directories, otherwise it matches the
+// name of the file.
+func (ar *Archive) protectedPattern(path string) string {
+	if len(ar.NeverDelete) == 0 {
+		return ""
+	}
+
+	path = filepath.Clean(path)
+	for _, pattern := range ar.NeverDelete {
+		if !strings.ContainsRune(pattern, '/') && !strings.ContainsRune(pattern, filepath.Separator) {
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return pattern
+			}
+			continue
+		}
+
+		pattern = filepath.Clean(filepath.FromSlash(pattern))
+		for p := path; ; p = filepath.Dir(p) {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return pattern
+			}
+			if filepath.Dir(p) == p {
+				break
+			}
+		}
+	}
+	return ""
+}
+
+// blockDelete reports whether the deletion of the file is blocked by the
+// neverDelete patterns, the blocked deletion is logged and counted.
+func (ar *Archive) blockDelete(path string) bool {
+	pattern := ar.protectedPattern(path)
+	if pattern == "" {
+		return false
+	}
+
+	logarchive.InputDeleteFailedTotal.WithLabelValues(ar.ArchiveModule().ID.Name(), deleteFailReasonProtected).Inc()
+	ar.logger.Warnf("deleting file: %s is blocked by never delete pattern: %s", path, pattern)
+	return true
+}
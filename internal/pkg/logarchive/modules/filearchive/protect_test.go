@@ -0,0 +1,61 @@
+package filearchive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtectedPattern(t *testing.T) {
+	ar := &Archive{NeverDelete: []string{"*.db", "/data/mysql", "/var/lib/*/keep"}}
+	assert.NoError(t, ar.validateNeverDelete())
+
+	assert.Equal(t, "*.db", ar.protectedPattern("/data/logs/app.db"))
+	assert.Equal(t, filepath.FromSlash("/data/mysql"), ar.protectedPattern("/data/mysql/ibdata1"))
+	assert.Equal(t, filepath.FromSlash("/var/lib/*/keep"), ar.protectedPattern("/var/lib/app/keep/a.log"))
+	assert.Equal(t, "", ar.protectedPattern("/data/logs/app.log"))
+	assert.Equal(t, "", ar.protectedPattern("/data/mysql.log"))
+
+	ar.NeverDelete = []string{"["}
+	assert.ErrorContains(t, ar.validateNeverDelete(), "invalid never delete pattern")
+}
+
+func TestBlockDelete(t *testing.T) {
+	root := t.TempDir()
+	keep := filepath.Join(root, "app.db")
+	if err := os.WriteFile(keep, []byte("db"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := newScheduleTestArchive(t, 1, map[string]int{root: 1})
+	ar.NeverDelete = []string{"*.db"}
+	ar.deleteChan = make(chan *fileCacheKey, 1)
+	ar.fileCache[root].files[keep] = &fileInfo{status: fileStatusUploading}
+	ar.inFlight[root] = 1
+	ar.inFlightTotal = 1
+
+	// the removal is refused even if the file is sent to be deleted
+	err := ar.removeFile(keep)
+	assert.True(t, errors.Is(err, errDeleteProtected))
+	assert.Equal(t, deleteFailReasonProtected, deleteFailReason(err))
+	assert.FileExists(t, keep)
+
+	notify := newNotifyInfo(notifyTypeOutputTask, root, keep, true)
+	notify.rootPath = root
+	ar.handleTaskNotify(notify)
+	assert.Len(t, ar.deleteChan, 0)
+	assert.Equal(t, fileStatusUploaded, ar.fileCache[root].files[keep].status)
+
+	// the other files are deleted as usual
+	other := filepath.Join(root, "0.log")
+	ar.fileCache[root].files[other].status = fileStatusUploading
+	ar.inFlight[root] = 1
+	ar.inFlightTotal = 1
+	notify = newNotifyInfo(notifyTypeOutputTask, root, other, true)
+	notify.rootPath = root
+	ar.handleTaskNotify(notify)
+	assert.Len(t, ar.deleteChan, 1)
+}
@@ -0,0 +1,40 @@
+package filearchive
+
+import "github.com/atframework/atdtool/internal/pkg/logarchive"
+
+// archiveName returns the name of the archive, the archive modules built on
+// top of the file archive are the collectors.
+func (ar *Archive) archiveName() string {
+	if m, ok := ar.collector.(logarchive.Module); ok {
+		return m.ArchiveModule().ID.Name()
+	}
+	return ar.ArchiveModule().ID.Name()
+}
+
+// admitFile reports whether the new file could be tracked under the quota of
+// the archive. The rejected files are tracked by scanning the watched paths
+// again once the archive is under the quota.
+func (ar *Archive) admitFile(path string, fi *fileInfo) bool {
+	if ar.quota.TrackAvailable(ar.pendingFiles) {
+		ar.pendingFiles++
+		return true
+	}
+
+	if fi.hasID && ar.inodes[fi.id] == path {
+		delete(ar.inodes, fi.id)
+	}
+	if !ar.overQuota {
+		ar.logger.Warnf("tracked files have reached the quota: %d, file: %s is delayed", ar.quota.MaxTrackedFiles, path)
+	}
+	ar.overQuota = true
+	return false
+}
+
+// rescanUnderQuota tracks the files rejected by the quota when there is room again.
+func (ar *Archive) rescanUnderQuota() {
+	if !ar.overQuota || !ar.quota.TrackAvailable(ar.pendingFiles) {
+		return
+	}
+	ar.overQuota = false
+	ar.scanWatchPaths()
+}
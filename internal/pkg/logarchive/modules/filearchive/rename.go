@@ -0,0 +1,94 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// pruneInterval is the interval in seconds to drop uploaded entries whose file has gone.
+const pruneInterval = 60
+
+// fileID identifies a file independent of its name, it is used to track
+// renamed files, e.g. app.log -> app.log.1 when a log library rotates files.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// discoverFile returns the cache entry for a newly found file. When the file is a
+// renamed file which is already tracked under its old name, the existing entry is
+// moved to the new name, so that the rotated file is uploaded exactly once.
+func (ar *Archive) discoverFile(path string, info os.FileInfo) (fi *fileInfo, moved bool) {
+	id, ok := getFileID(info)
+	if ok {
+		if oldPath, found := ar.inodes[id]; found && oldPath != path {
+			old, exist := ar.fileCache.getFile(filepath.Dir(oldPath), oldPath)
+			if exist && old.hasID && old.id == id && !isSameFile(oldPath, id) {
+				ar.fileCache.removeFile(filepath.Dir(oldPath), oldPath)
+				if old.status == fileStatusUploading {
+					// the running task still reports the result with the old name
+					ar.renamed[oldPath] = path
+				}
+				ar.inodes[id] = path
+				ar.logger.Infof("file: %s has been renamed to %s", oldPath, path)
+				return old, true
+			}
+		}
+	}
+
+	fi = ar.newFileInfo(info)
+	if ok {
+		fi.id, fi.hasID = id, true
+		ar.inodes[id] = path
+	}
+	ar.publishEvent(logarchive.EventFileDiscovered, path, nil)
+	return fi, false
+}
+
+// untrackFile removes the file from the cache and the rename index.
+func (ar *Archive) untrackFile(watchPath, filePath string) {
+	if v, ok := ar.fileCache.getFile(watchPath, filePath); ok && v.hasID && ar.inodes[v.id] == filePath {
+		delete(ar.inodes, v.id)
+	}
+	ar.fileCache.removeFile(watchPath, filePath)
+}
+
+// resolveRenamed returns the current name of a file which was renamed while it was uploading.
+func (ar *Archive) resolveRenamed(filePath string) (string, bool) {
+	newPath, ok := ar.renamed[filePath]
+	if ok {
+		delete(ar.renamed, filePath)
+	}
+	return newPath, ok
+}
+
+// pruneUploaded drops the uploaded entries whose file does not exist anymore,
+// e.g. a rotated file has been moved out of the watched paths.
+func (ar *Archive) pruneUploaded(now int64) {
+	if now-ar.lastPruneTime < pruneInterval {
+		return
+	}
+	ar.lastPruneTime = now
+
+	for watchPath, cache := range ar.fileCache {
+		for k, v := range cache.files {
+			if v.status != fileStatusUploaded {
+				continue
+			}
+			if _, err := os.Lstat(k); os.IsNotExist(err) {
+				ar.untrackFile(watchPath, k)
+			}
+		}
+	}
+}
+
+func isSameFile(path string, id fileID) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	cur, ok := getFileID(info)
+	return ok && cur == id
+}
@@ -0,0 +1,119 @@
+//go:build !windows
+// +build !windows
+
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveDiscoverFileTracksRename(t *testing.T) {
+	dir := t.TempDir()
+	ar := newTestArchive()
+	if !assert.NoError(t, ar.addWatchPath(dir, dir, false)) {
+		return
+	}
+
+	oldPath := filepath.Join(dir, "app.log")
+	newPath := filepath.Join(dir, "app.log.1")
+	if err := os.WriteFile(oldPath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, moved := ar.discoverFile(oldPath, info)
+	assert.False(t, moved)
+	fi.status = fileStatusUploading
+	ar.fileCache[dir].files[oldPath] = fi
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, moved := ar.discoverFile(newPath, info)
+	assert.True(t, moved)
+	assert.Same(t, fi, got)
+	assert.NotContains(t, ar.fileCache[dir].files, oldPath)
+
+	// the running task reports with the old name
+	resolved, ok := ar.resolveRenamed(oldPath)
+	assert.True(t, ok)
+	assert.Equal(t, newPath, resolved)
+
+	// a new file created with the old name is a different file
+	if err := os.WriteFile(oldPath, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err = os.Stat(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, moved = ar.discoverFile(oldPath, info)
+	assert.False(t, moved)
+}
+
+func TestArchiveScanWatchPathsDetectsRotation(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(logPath, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := newTestArchive()
+	ar.Paths = []string{dir}
+	ar.CollectMode = CollectModePoll
+	ar.CollectRule.KeepSourceFile = true
+	if !assert.NoError(t, ar.addWatchPath(dir, dir, true)) {
+		return
+	}
+	assert.Equal(t, fileStatusUploaded, ar.fileCache[dir].files[logPath].status)
+
+	// rotate: app.log -> app.log.1 and a new app.log
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(logPath, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ar.scanWatchPaths()
+
+	files := ar.fileCache[dir].files
+	if !assert.Contains(t, files, logPath+".1") || !assert.Contains(t, files, logPath) {
+		return
+	}
+	assert.Equal(t, fileStatusUploaded, files[logPath+".1"].status)
+	assert.Equal(t, fileStatusWaitUpload, files[logPath].status)
+}
+
+func TestHandleWatcherEventNewDirRootPath(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	sub := filepath.Join(b, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ar := newTestArchive()
+	ar.Paths = []string{a, b}
+	ar.CollectMode = CollectModePoll
+
+	// the new directory is watched under the base path containing it
+	if !assert.NoError(t, ar.handleWatcherEvent(fsnotify.Event{Name: sub, Op: fsnotify.Create})) {
+		return
+	}
+	if assert.Contains(t, ar.fileCache, sub) {
+		assert.Equal(t, b, ar.fileCache[sub].rootPath)
+	}
+}
@@ -0,0 +1,213 @@
+package filearchive
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// uploadCandidate is a file which is ready to be uploaded.
+type uploadCandidate struct {
+	watchPath string
+	filePath  string
+	size      int64
+	modTime   time.Time
+	info      *fileInfo
+}
+
+// scheduleUploads submits the files ready to be uploaded and returns the age of
+// the oldest file not uploaded yet. The files of the watched paths are submitted
+// in turn, so that a path with lots of files does not delay the others.
+func (ar *Archive) scheduleUploads(now int64) (backlogAge int64) {
+	// a path collects at most the candidates which can be submitted in this tick
+	limit := max(cap(ar.tasks)-len(ar.tasks), 1)
+
+	// the backlog is still measured while paused or out of the upload window
+	paused := ar.isPaused() || !ar.inUploadWindow(time.Unix(now, 0))
+
+	pending := make(map[string][]*uploadCandidate)
+	pendingFiles := 0
+	for watchPath, cache := range ar.fileCache {
+		for k, v := range cache.files {
+			if v.status == fileStatusWaitUpload || v.status == fileStatusUploading {
+				pendingFiles++
+				if now-v.discoveredTime > backlogAge {
+					backlogAge = now - v.discoveredTime
+				}
+			}
+
+			if paused || v.status != fileStatusWaitUpload || v.protectedEndTime > now {
+				continue
+			}
+
+			rootPath := cache.rootPath
+			if len(pending[rootPath]) >= limit || !ar.pathAvailable(rootPath, len(pending[rootPath])) {
+				continue
+			}
+
+			info, err := os.Stat(k)
+			if err != nil {
+				ar.untrackFile(watchPath, k)
+				continue
+			}
+
+			// the ignore file may have been changed after the file was discovered
+			if ar.isIgnored(rootPath, k) {
+				ar.untrackFile(watchPath, k)
+				ar.logger.Debugf("file:%s has been ignored", k)
+				continue
+			}
+
+			// the file has been modified since the protected time was computed
+			if modTime := info.ModTime().Unix(); modTime != v.modTime {
+				v.modTime = modTime
+				if protectedEndTime := ar.modifyProtectEndTime(modTime, now); protectedEndTime > now {
+					v.protectedEndTime = protectedEndTime
+					continue
+				}
+			}
+
+			pending[rootPath] = append(pending[rootPath], &uploadCandidate{
+				watchPath: watchPath,
+				filePath:  k,
+				size:      info.Size(),
+				modTime:   info.ModTime(),
+				info:      v,
+			})
+		}
+	}
+
+	// the files found before the next tick are counted by admitFile
+	ar.pendingFiles = pendingFiles
+
+	if len(pending) == 0 {
+		return backlogAge
+	}
+
+	// the first path is rotated by ticks, otherwise the same path always
+	// gets the free slots of the queue first
+	roots := make([]string, 0, len(pending))
+	for root := range pending {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	ar.scheduleOffset = (ar.scheduleOffset + 1) % len(roots)
+	roots = append(roots[ar.scheduleOffset:], roots[:ar.scheduleOffset]...)
+
+	// the files wait for the next tick once the queue is full
+	for len(roots) != 0 {
+		next := roots[:0]
+		for _, root := range roots {
+			if ar.MaxInFlight > 0 && ar.inFlightTotal >= ar.MaxInFlight {
+				return backlogAge
+			}
+
+			c := pending[root][0]
+			pending[root] = pending[root][1:]
+			if !ar.submitUpload(root, c) {
+				return backlogAge
+			}
+
+			if len(pending[root]) != 0 {
+				next = append(next, root)
+			}
+		}
+		roots = next
+	}
+	return backlogAge
+}
+
+// pathAvailable reports whether more files of the watched path could be
+// uploaded, with n files have been selected in this tick.
+func (ar *Archive) pathAvailable(rootPath string, n int) bool {
+	return ar.MaxInFlightPerPath <= 0 || ar.inFlight[rootPath]+n < ar.MaxInFlightPerPath
+}
+
+// submitUpload puts the output task of the file into the queue, it fails when
+// the queue is full or the queued bytes have reached the quota.
+func (ar *Archive) submitUpload(rootPath string, c *uploadCandidate) bool {
+	if !ar.quota.ReserveQueued(c.size) {
+		return false
+	}
+
+	if c.info.uploadFailedCount == 0 {
+		logarchive.InputRequestSize.WithLabelValues(ar.ArchiveModule().ID.Name()).Observe(float64(c.size))
+	}
+
+	c.info.status = fileStatusUploading
+	if !ar.trySubmitTask(func() error {
+		hash, destination, found := ar.dedupFile(c.filePath)
+		if found {
+			// the content has been uploaded, the file is handled like uploaded
+			logarchive.InputDedupTotal.WithLabelValues(ar.ArchiveModule().ID.Name()).Inc()
+			ar.logger.Infof("file: %s has been uploaded to %s, skip uploading", c.filePath, destination)
+			notify := newNotifyInfo(notifyTypeOutputTask, c.watchPath, c.filePath, true)
+			notify.rootPath, notify.destination = rootPath, destination
+			ar.sendNotify(notify)
+			return nil
+		}
+
+		// the bandwidth is shared with the other archives by the size of source file
+		if err := ar.quota.WaitBandwidth(ar.ctx, c.size); err != nil {
+			ar.notifyTaskExecuteResult(rootPath, c.watchPath, c.filePath, "", err)
+			return err
+		}
+
+		uploadPath := c.filePath
+		if len(ar.filters) != 0 {
+			var err error
+			if uploadPath, err = ar.filterFile(c.filePath); err != nil {
+				ar.logger.Errorf("filter file: %s got error: %v", c.filePath, err)
+				ar.notifyTaskExecuteResult(rootPath, c.watchPath, c.filePath, "", err)
+				return err
+			}
+			defer os.Remove(uploadPath)
+		}
+
+		task := ar.output.TaskInfo().New()
+		err := ar.fillTaskInfo(task, rootPath, c.filePath, uploadPath)
+		if err != nil {
+			ar.logger.Errorf("fill task info: %v", err)
+			ar.notifyTaskExecuteResult(rootPath, c.watchPath, c.filePath, "", err)
+			return err
+		}
+
+		ar.publishEvent(logarchive.EventUploadStarted, c.filePath, nil)
+		err = ar.output.Execute(task)
+		if err != nil {
+			ar.notifyTaskExecuteResult(rootPath, c.watchPath, c.filePath, "", err)
+			ar.logger.Errorf("execute input task failed: %v, filepath: %s", err, c.filePath)
+			return err
+		}
+
+		// the latency from the last write tells how far behind the archive is
+		logarchive.InputUploadLatency.WithLabelValues(ar.ArchiveModule().ID.Name()).Observe(time.Since(c.modTime).Seconds())
+		if d, ok := task.(logarchive.OutputDestination); ok {
+			destination = d.Destination()
+		}
+		if hash != "" {
+			ar.dedup.add(hash, destination)
+		}
+		ar.notifyTaskExecuteResult(rootPath, c.watchPath, c.filePath, destination, nil)
+		return err
+	}) {
+		c.info.status = fileStatusWaitUpload
+		ar.quota.ReleaseQueued(c.size)
+		return false
+	}
+
+	if ar.quota != nil {
+		ar.queuedSizes[c.filePath] = c.size
+	}
+	ar.updateInFlight(rootPath, 1)
+	return true
+}
+
+// updateInFlight counts the files queued or uploading, it is only called by the run loop.
+func (ar *Archive) updateInFlight(rootPath string, delta int) {
+	ar.inFlight[rootPath] += delta
+	ar.inFlightTotal += delta
+	logarchive.InputInFlight.WithLabelValues(ar.ArchiveModule().ID.Name(), rootPath).Set(float64(ar.inFlight[rootPath]))
+}
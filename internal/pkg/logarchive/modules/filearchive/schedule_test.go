@@ -0,0 +1,164 @@
+package filearchive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func newScheduleTestArchive(t *testing.T, queueSize int, files map[string]int) *Archive {
+	ar := &Archive{
+		fileCache:   make(fileCacheMap),
+		ignoreFiles: make(map[string]*ignoreFile),
+		inFlight:    make(map[string]int),
+		inodes:      make(map[fileID]string),
+		queuedSizes: make(map[string]int64),
+		logger:      zap.NewNop().Sugar(),
+		done:        make(chan struct{}),
+		tasks:       make(chan func() error, queueSize),
+	}
+
+	for root, n := range files {
+		ar.fileCache[root] = &element{rootPath: root, files: make(map[string]*fileInfo)}
+		for i := 0; i < n; i++ {
+			name := filepath.Join(root, fmt.Sprintf("%d.log", i))
+			if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			ar.fileCache[root].files[name] = &fileInfo{status: fileStatusWaitUpload}
+		}
+	}
+	return ar
+}
+
+func uploadingFiles(ar *Archive, root string) int {
+	n := 0
+	for _, v := range ar.fileCache[root].files {
+		if v.status == fileStatusUploading {
+			n++
+		}
+	}
+	return n
+}
+
+func TestScheduleUploadsFairness(t *testing.T) {
+	noisy, quiet := t.TempDir(), t.TempDir()
+	ar := newScheduleTestArchive(t, 4, map[string]int{noisy: 100, quiet: 2})
+
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 4, len(ar.tasks))
+	assert.Equal(t, 2, uploadingFiles(ar, noisy))
+	assert.Equal(t, 2, uploadingFiles(ar, quiet))
+	assert.Equal(t, 4, ar.inFlightTotal)
+
+	// the in-flight files are released by the notifications
+	for i := 0; i < 4; i++ {
+		<-ar.tasks
+	}
+	ar.updateInFlight(quiet, -2)
+	ar.updateInFlight(noisy, -2)
+	assert.Equal(t, 0, ar.inFlightTotal)
+}
+
+func TestScheduleUploadsMaxInFlight(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	ar := newScheduleTestArchive(t, 100, map[string]int{a: 10, b: 10})
+	ar.MaxInFlightPerPath = 3
+
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 3, uploadingFiles(ar, a))
+	assert.Equal(t, 3, uploadingFiles(ar, b))
+
+	// no more files until the uploading ones are finished
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 6, len(ar.tasks))
+
+	<-ar.tasks
+	ar.updateInFlight(a, -1)
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 4, uploadingFiles(ar, a))
+	assert.Equal(t, 3, uploadingFiles(ar, b))
+
+	ar.MaxInFlightPerPath = 0
+	ar.MaxInFlight = 10
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 10, ar.inFlightTotal)
+	assert.Equal(t, 10, len(ar.tasks))
+}
+
+func TestScheduleUploadsQuota(t *testing.T) {
+	root := t.TempDir()
+	ar := newScheduleTestArchive(t, 100, map[string]int{root: 5})
+	ar.quota = &logarchive.ArchiveQuota{MaxQueuedBytes: 8, MaxTrackedFiles: 5}
+	ar.CollectRule.KeepSourceFile = true
+
+	// each file has 4 bytes
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 2, len(ar.tasks))
+	assert.Equal(t, 5, ar.pendingFiles)
+
+	e := newNotifyInfo(notifyTypeOutputTask, root, "", true)
+	for k, v := range ar.fileCache[root].files {
+		if v.status == fileStatusUploading {
+			e.filePath, e.rootPath = k, root
+			break
+		}
+	}
+	ar.handleTaskNotify(e)
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 3, len(ar.tasks))
+	assert.Equal(t, 4, ar.pendingFiles)
+
+	// the new files beyond the quota are delayed
+	info, err := os.Stat(filepath.Join(root, "0.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, ar.admitFile(filepath.Join(root, "new.log"), ar.newFileInfo(info)))
+	assert.False(t, ar.admitFile(filepath.Join(root, "other.log"), ar.newFileInfo(info)))
+	assert.True(t, ar.overQuota)
+}
+
+func TestCountWatcherEvent(t *testing.T) {
+	count := func(op string) float64 {
+		m := &dto.Metric{}
+		if err := logarchive.InputWatcherEvents.WithLabelValues("file", op).Write(m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetCounter().GetValue()
+	}
+
+	ar := newScheduleTestArchive(t, 1, nil)
+	create, write, chmod := count("create"), count("write"), count("chmod")
+	ar.countWatcherEvent(fsnotify.Event{Name: "a.log", Op: fsnotify.Create | fsnotify.Write})
+
+	assert.Equal(t, create+1, count("create"))
+	assert.Equal(t, write+1, count("write"))
+	assert.Equal(t, chmod, count("chmod"))
+}
+
+func TestScheduleUploadsPaused(t *testing.T) {
+	dir := t.TempDir()
+	ar := newScheduleTestArchive(t, 10, map[string]int{dir: 3})
+
+	ar.Pause()
+	backlogAge := ar.scheduleUploads(time.Now().Unix() + 5)
+	assert.Equal(t, 0, len(ar.tasks))
+	assert.Equal(t, 0, uploadingFiles(ar, dir))
+	// the backlog is still reported while paused
+	assert.GreaterOrEqual(t, backlogAge, int64(5))
+
+	ar.Resume()
+	ar.scheduleUploads(time.Now().Unix())
+	assert.Equal(t, 3, len(ar.tasks))
+	assert.Equal(t, 3, uploadingFiles(ar, dir))
+}
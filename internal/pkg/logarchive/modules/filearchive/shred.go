@@ -0,0 +1,63 @@
+package filearchive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+const shredBufferSize = 64 * 1024
+
+// shredFile overwrites the content of the file with zeros, flushes it to the disk
+// and then removes the file.
+//
+// It only works when the blocks are overwritten in place, the old content may be
+// kept on copy-on-write or log-structured filesystems (btrfs, zfs, f2fs), the
+// filesystems journaling data, snapshots, network filesystems and the flash
+// storages with wear leveling. The file with other hard links is removed without
+// shredding, because the content is still reachable by the other links.
+func (ar *Archive) shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if links, ok := getFileLinks(info); ok && links > 1 {
+		f.Close()
+		ar.logger.Warnf("file: %s has %d hard links, removed without shredding", path, links)
+		return os.Remove(path)
+	}
+
+	err = overwriteFile(f, info.Size())
+	if err = errors.Join(err, f.Close()); err != nil {
+		return fmt.Errorf("shred file: %w", err)
+	}
+	return os.Remove(path)
+}
+
+// overwriteFile overwrites the first size bytes of the file with zeros and truncates it.
+func overwriteFile(f *os.File, size int64) error {
+	buf := make([]byte, shredBufferSize)
+	for off := int64(0); off < size; {
+		n := min(int64(len(buf)), size-off)
+		if _, err := f.WriteAt(buf[:n], off); err != nil {
+			return err
+		}
+		off += n
+	}
+
+	// the content must reach the disk before the blocks are released by truncating
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+// +build !windows
+
+package filearchive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShredFile(t *testing.T) {
+	dir := t.TempDir()
+	ar := newTestArchive()
+	ar.DeleteRule.Shred = true
+
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("secret"), shredBufferSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the content is overwritten and truncated before removing
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, overwriteFile(f, shredBufferSize*6))
+	f.Close()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	assert.NoError(t, ar.removeFile(path))
+	assert.NoFileExists(t, path)
+
+	// the file with other hard links is not shredded
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "app.log.link")
+	if err := os.Link(path, link); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, ar.removeFile(path))
+	assert.NoFileExists(t, path)
+	data, _ = os.ReadFile(link)
+	assert.Equal(t, "secret", string(data))
+
+	assert.ErrorIs(t, ar.removeFile(path), os.ErrNotExist)
+}
@@ -0,0 +1,141 @@
+package filearchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// stateSaveInterval is the interval in seconds to save the state file.
+const stateSaveInterval = 5
+
+// stateFile records the uploaded files. When source files are kept, the files
+// existing at startup are treated as uploaded, so the files which were discovered
+// but not uploaded before a crash or restart would never be uploaded. With the
+// state file, only the recorded files are treated as uploaded at startup.
+type stateFile struct {
+	Uploaded []stateRecord `json:"uploaded"`
+	// Hashes is the content hashes of the uploaded files for deduplication
+	Hashes []stateHash `json:"hashes,omitempty"`
+}
+
+type stateRecord struct {
+	Path string `json:"path"`
+	Dev  uint64 `json:"dev,omitempty"`
+	Ino  uint64 `json:"ino,omitempty"`
+}
+
+type stateHash struct {
+	Hash        string `json:"hash"`
+	Destination string `json:"destination,omitempty"`
+}
+
+// archiveState is the state loaded at startup.
+type archiveState struct {
+	paths  map[string]struct{}
+	ids    map[fileID]struct{}
+	hashes []stateHash
+}
+
+// isUploaded reports whether the file has been recorded as uploaded,
+// a renamed file is matched by its file ID.
+func (s *archiveState) isUploaded(path string, fi *fileInfo) bool {
+	if _, ok := s.paths[path]; ok {
+		return true
+	}
+	if fi.hasID {
+		if _, ok := s.ids[fi.id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadState reads the state file, it returns nil if the state file does not exist,
+// then all files existing at startup are treated as uploaded like before.
+func loadState(path string) (*archiveState, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f stateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	s := &archiveState{
+		paths:  make(map[string]struct{}, len(f.Uploaded)),
+		ids:    make(map[fileID]struct{}, len(f.Uploaded)),
+		hashes: f.Hashes,
+	}
+	for _, r := range f.Uploaded {
+		s.paths[r.Path] = struct{}{}
+		if r.Dev != 0 || r.Ino != 0 {
+			s.ids[fileID{dev: r.Dev, ino: r.Ino}] = struct{}{}
+		}
+	}
+	return s, nil
+}
+
+// saveState writes the uploaded files into the state file, the file is not
+// written if nothing changed since last time, or in dry run mode since nothing
+// has been uploaded.
+func (ar *Archive) saveState(now int64) {
+	if ar.StateFile == "" || ar.dryRun || now-ar.lastStateTime < stateSaveInterval {
+		return
+	}
+	ar.lastStateTime = now
+
+	f := stateFile{Uploaded: make([]stateRecord, 0)}
+	for _, cache := range ar.fileCache {
+		for k, v := range cache.files {
+			if v.status != fileStatusUploaded {
+				continue
+			}
+			r := stateRecord{Path: k}
+			if v.hasID {
+				r.Dev, r.Ino = v.id.dev, v.id.ino
+			}
+			f.Uploaded = append(f.Uploaded, r)
+		}
+	}
+	sort.Slice(f.Uploaded, func(i, j int) bool { return f.Uploaded[i].Path < f.Uploaded[j].Path })
+	if ar.dedup != nil {
+		f.Hashes = ar.dedup.records()
+	}
+
+	data, err := json.Marshal(&f)
+	if err != nil {
+		ar.logger.Errorf("encode state: %v", err)
+		return
+	}
+	if bytes.Equal(data, ar.lastState) {
+		return
+	}
+
+	if err := writeFileAtomic(ar.StateFile, data); err != nil {
+		ar.logger.Errorf("save state file: %s got error: %v", ar.StateFile, err)
+		return
+	}
+	ar.lastState = data
+}
+
+// writeFileAtomic writes the data into a temporary file and renames it,
+// so that the file is never truncated by a crash.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,88 @@
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newStateTestArchive(stateFile string) *Archive {
+	return &Archive{
+		CollectRule: FileCollectRule{KeepSourceFile: true},
+		StateFile:   stateFile,
+		fileCache:   make(fileCacheMap),
+		ignoreFiles: make(map[string]*ignoreFile),
+		inodes:      make(map[fileID]string),
+		renamed:     make(map[string]string),
+		logger:      zap.NewNop().Sugar(),
+	}
+}
+
+func TestStateRecoversCrashMidUpload(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(logs, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(dir, "state.json")
+
+	writeFile := func(name string) string {
+		path := filepath.Join(logs, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// the files existing before the state file are treated as uploaded
+	history := writeFile("history.log")
+
+	ar := newStateTestArchive(stateFile)
+	if !assert.NoError(t, ar.addWatchPath(logs, logs, true)) {
+		return
+	}
+
+	// one file is uploaded, the other one is submitted but not executed yet
+	uploaded, pending := writeFile("uploaded.log"), writeFile("pending.log")
+	for path, status := range map[string]fileStatus{uploaded: fileStatusUploaded, pending: fileStatusUploading} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, _ := ar.discoverFile(path, info)
+		fi.status = status
+		ar.fileCache[logs].files[path] = fi
+	}
+	ar.saveState(time.Now().Unix())
+	if !assert.FileExists(t, stateFile) {
+		return
+	}
+
+	// the process crashes and restarts
+	restarted := newStateTestArchive(stateFile)
+	state, err := loadState(stateFile)
+	if !assert.NoError(t, err) || !assert.NotNil(t, state) {
+		return
+	}
+	restarted.state = state
+	if !assert.NoError(t, restarted.addWatchPath(logs, logs, true)) {
+		return
+	}
+
+	files := restarted.fileCache[logs].files
+	if assert.Len(t, files, 3) {
+		assert.Equal(t, fileStatusUploaded, files[history].status)
+		assert.Equal(t, fileStatusUploaded, files[uploaded].status)
+		assert.Equal(t, fileStatusWaitUpload, files[pending].status)
+	}
+}
+
+func TestLoadStateNotExist(t *testing.T) {
+	state, err := loadState(filepath.Join(t.TempDir(), "state.json"))
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+}
@@ -0,0 +1,72 @@
+package filearchive
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// minRecommendedWatches is the least fs.inotify.max_user_watches recommended,
+// the watches are shared with the other processes of the same user.
+const minRecommendedWatches = 8192
+
+// WatchLimitRule defines how the archive handles the directories to be watched
+// exceeding fs.inotify.max_user_watches, the archive fails to start by default.
+type WatchLimitRule struct {
+	// Warn logs the limit instead of failing
+	Warn bool `yaml:"warn,omitempty" json:"warn,omitempty"`
+	// Raise writes the recommended limit into fs.inotify.max_user_watches, which
+	// requires the root privilege and is lost after reboot
+	Raise bool `yaml:"raise,omitempty" json:"raise,omitempty"`
+}
+
+// checkWatchLimit compares the directories to be watched with the limit of the
+// watches, instead of failing with "no space left on device" while running.
+func (ar *Archive) checkWatchLimit() error {
+	limit, err := maxUserWatches()
+	if err != nil {
+		if !errors.Is(err, errors.ErrUnsupported) {
+			ar.logger.Warnf("read fs.inotify.max_user_watches: %v", err)
+		}
+		return nil
+	}
+
+	dirs := 0
+	for _, rootPath := range ar.Paths {
+		if walkErr := filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				dirs++
+			}
+			return nil
+		}); walkErr != nil {
+			return walkErr
+		}
+	}
+
+	if dirs <= limit {
+		return nil
+	}
+
+	recommended := max(dirs*2, minRecommendedWatches)
+	if ar.WatchLimit.Raise {
+		if err := setMaxUserWatches(recommended); err != nil {
+			ar.logger.Warnf("raise fs.inotify.max_user_watches to %d: %v", recommended, err)
+		} else {
+			ar.logger.Infof("fs.inotify.max_user_watches has been raised from %d to %d for %d directories", limit, recommended, dirs)
+			return nil
+		}
+	}
+
+	err = fmt.Errorf("%d directories to be watched exceed fs.inotify.max_user_watches: %d, "+
+		"raise it by \"sysctl -w fs.inotify.max_user_watches=%d\" and add it to /etc/sysctl.conf, "+
+		"or use the poll collect mode", dirs, limit, recommended)
+	if ar.WatchLimit.Warn {
+		ar.logger.Warn(err.Error())
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package filearchive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var maxUserWatchesFile = "/proc/sys/fs/inotify/max_user_watches"
+
+func maxUserWatches() (int, error) {
+	data, err := os.ReadFile(maxUserWatchesFile)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func setMaxUserWatches(n int) error {
+	return os.WriteFile(maxUserWatchesFile, []byte(strconv.Itoa(n)+"\n"), 0644)
+}
+
+// watchLimitError explains the error of inotify_add_watch when the limit is reached.
+func watchLimitError(path string, err error) error {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return err
+	}
+
+	limit, _ := maxUserWatches()
+	return fmt.Errorf("watch path: %s: fs.inotify.max_user_watches: %d has been reached, "+
+		"raise it by \"sysctl -w fs.inotify.max_user_watches=<n>\": %v", path, limit, err)
+}
@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package filearchive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckWatchLimit(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b", "c/d"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limitFile := filepath.Join(t.TempDir(), "max_user_watches")
+	old := maxUserWatchesFile
+	maxUserWatchesFile = limitFile
+	defer func() { maxUserWatchesFile = old }()
+
+	ar := newTestArchive()
+	ar.Paths = []string{dir}
+
+	// the limit is unknown
+	assert.NoError(t, ar.checkWatchLimit())
+
+	assert.NoError(t, os.WriteFile(limitFile, []byte("5\n"), 0644))
+	assert.NoError(t, ar.checkWatchLimit())
+
+	assert.NoError(t, os.WriteFile(limitFile, []byte("4\n"), 0644))
+	assert.ErrorContains(t, ar.checkWatchLimit(), "5 directories to be watched exceed fs.inotify.max_user_watches: 4")
+
+	ar.WatchLimit.Warn = true
+	assert.NoError(t, ar.checkWatchLimit())
+
+	ar.WatchLimit = WatchLimitRule{Raise: true}
+	if assert.NoError(t, ar.checkWatchLimit()) {
+		data, _ := os.ReadFile(limitFile)
+		assert.Equal(t, "8192", strings.TrimSpace(string(data)))
+	}
+
+	assert.ErrorContains(t, watchLimitError(dir, syscall.ENOSPC), "fs.inotify.max_user_watches: 8192 has been reached")
+	assert.Equal(t, syscall.EACCES, watchLimitError(dir, syscall.EACCES))
+}
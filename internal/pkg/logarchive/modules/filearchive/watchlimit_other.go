@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package filearchive
+
+import "errors"
+
+// the watches are not limited by a sysctl on the other platforms
+func maxUserWatches() (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func setMaxUserWatches(_n int) error {
+	return errors.ErrUnsupported
+}
+
+func watchLimitError(_path string, err error) error {
+	return err
+}
@@ -0,0 +1,119 @@
+package filearchive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive/schedule"
+)
+
+// FileUploadWindow limits the uploads to the off-peak time, the uploads are
+// dispatched when the time is in any of the windows or matches any of the cron
+// expressions. The uploads are not limited if neither is set.
+type FileUploadWindow struct {
+	// Daily are the windows of every day in local time, e.g. "22:00-06:00",
+	// the end is exclusive and the window could cross midnight
+	Daily []string `yaml:"daily,omitempty" json:"daily,omitempty"`
+	// Cron are the cron expressions, the uploads are dispatched in the minutes
+	// matched, e.g. "* 0-6 * * *"
+	Cron []string `yaml:"cron,omitempty" json:"cron,omitempty"`
+
+	daily     []dailyWindow
+	schedules []*schedule.Schedule
+}
+
+// dailyWindow is the minutes of the day from start to end.
+type dailyWindow struct {
+	start, end int
+}
+
+func (w *FileUploadWindow) provision() error {
+	w.daily, w.schedules = nil, nil
+	for _, s := range w.Daily {
+		d, err := parseDailyWindow(s)
+		if err != nil {
+			return err
+		}
+		w.daily = append(w.daily, d)
+	}
+	for _, expr := range w.Cron {
+		s, err := schedule.Parse(expr)
+		if err != nil {
+			return err
+		}
+		w.schedules = append(w.schedules, s)
+	}
+	return nil
+}
+
+func parseDailyWindow(s string) (dailyWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return dailyWindow{}, fmt.Errorf("invalid daily window: %s, should be HH:MM-HH:MM", s)
+	}
+
+	var d dailyWindow
+	var err error
+	if d.start, err = parseMinuteOfDay(start); err != nil {
+		return dailyWindow{}, fmt.Errorf("invalid daily window: %s: %v", s, err)
+	}
+	if d.end, err = parseMinuteOfDay(end); err != nil {
+		return dailyWindow{}, fmt.Errorf("invalid daily window: %s: %v", s, err)
+	}
+	if d.start == d.end {
+		return dailyWindow{}, fmt.Errorf("invalid daily window: %s, the start is the same as the end", s)
+	}
+	return d, nil
+}
+
+func parseMinuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (d dailyWindow) contains(minute int) bool {
+	if d.start < d.end {
+		return minute >= d.start && minute < d.end
+	}
+	// the window crosses midnight
+	return minute >= d.start || minute < d.end
+}
+
+// contains reports whether the uploads could be dispatched at t.
+func (w *FileUploadWindow) contains(t time.Time) bool {
+	if len(w.daily) == 0 && len(w.schedules) == 0 {
+		return true
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	for _, d := range w.daily {
+		if d.contains(minute) {
+			return true
+		}
+	}
+	for _, s := range w.schedules {
+		if s.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// inUploadWindow reports whether the uploads could be dispatched at t, the
+// changes are logged. It is only called by the run loop.
+func (ar *Archive) inUploadWindow(t time.Time) bool {
+	in := ar.UploadWindow.contains(t)
+	if in == ar.outOfWindow {
+		ar.outOfWindow = !in
+		if in {
+			ar.logger.Info("upload window opened")
+		} else {
+			ar.logger.Info("upload window closed, files are still collected")
+		}
+	}
+	return in
+}
@@ -0,0 +1,61 @@
+package filearchive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadWindowContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		// 2024-02-28 is wednesday
+		return time.Date(2024, 2, 28, hour, minute, 0, 0, time.Local)
+	}
+
+	w := &FileUploadWindow{Daily: []string{"22:00-06:00", "12:00-12:30"}}
+	if !assert.NoError(t, w.provision()) {
+		return
+	}
+	assert.True(t, w.contains(at(23, 0)))
+	assert.True(t, w.contains(at(5, 59)))
+	assert.False(t, w.contains(at(6, 0)))
+	assert.True(t, w.contains(at(12, 10)))
+	assert.False(t, w.contains(at(12, 30)))
+
+	w = &FileUploadWindow{Cron: []string{"* 2-3 * * 3"}}
+	if !assert.NoError(t, w.provision()) {
+		return
+	}
+	assert.True(t, w.contains(at(3, 30)))
+	assert.False(t, w.contains(at(4, 0)))
+
+	// no window does not limit the uploads
+	assert.True(t, (&FileUploadWindow{}).contains(at(12, 0)))
+
+	for _, daily := range []string{"22:00", "25:00-01:00", "01:00-01:00"} {
+		assert.Error(t, (&FileUploadWindow{Daily: []string{daily}}).provision(), daily)
+	}
+	assert.Error(t, (&FileUploadWindow{Cron: []string{"* 24 * * *"}}).provision())
+}
+
+func TestScheduleUploadsUploadWindow(t *testing.T) {
+	dir := t.TempDir()
+	ar := newScheduleTestArchive(t, 10, map[string]int{dir: 2})
+
+	now := time.Now()
+	start := now.Add(time.Hour).Format("15:04")
+	end := now.Add(2 * time.Hour).Format("15:04")
+	ar.UploadWindow.Daily = []string{start + "-" + end}
+	if !assert.NoError(t, ar.UploadWindow.provision()) {
+		return
+	}
+
+	// the files are counted as backlog but not dispatched
+	ar.scheduleUploads(now.Unix())
+	assert.Equal(t, 0, len(ar.tasks))
+	assert.Equal(t, 2, ar.pendingFiles)
+
+	ar.scheduleUploads(now.Add(90 * time.Minute).Unix())
+	assert.Equal(t, 2, len(ar.tasks))
+}
@@ -0,0 +1,55 @@
+// Package filter provides the filters of the archives, which transform the
+// content of the files before they are uploaded.
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// eachLine calls fn with the lines of r in order, the line ending is included
+// and the last line may have no line ending. It stops when fn returns false.
+func eachLine(r io.Reader, fn func(line []byte) (bool, error)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			next, err2 := fn(line)
+			if err2 != nil {
+				return err2
+			}
+			if !next {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// compilePatterns compiles the regular expressions of the config.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	regs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		reg, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %s: %v", p, err)
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+func init() {
+	logarchive.RegisterModule(Redact{})
+	logarchive.RegisterModule(Truncate{})
+	logarchive.RegisterModule(Sample{})
+}
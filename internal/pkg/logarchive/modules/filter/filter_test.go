@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func runFilter(t *testing.T, f logarchive.Filter, in string) string {
+	t.Helper()
+	if p, ok := f.(logarchive.Provisioner); ok {
+		if err := p.Provision(logarchive.Context{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := f.Filter(out, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestRedact(t *testing.T) {
+	f := &Redact{Patterns: []string{`token=\w+`}, Presets: []string{"ipv4", "email"}}
+	got := runFilter(t, f, "login 10.0.0.1 token=abc\nmail a.b@example.com\nno newline 256.1.1.1")
+	assert.Equal(t, "login *** ***\nmail ***\nno newline 256.1.1.1", got)
+
+	f = &Redact{Presets: []string{"ipv6"}, Replacement: "<ip>"}
+	assert.Equal(t, "from <ip>\n", runFilter(t, f, "from 2001:0db8:0000:0000:0000:ff00:0042:8329\n"))
+
+	assert.Error(t, (&Redact{}).Provision(logarchive.Context{}))
+	assert.Error(t, (&Redact{Presets: []string{"phone"}}).Provision(logarchive.Context{}))
+	assert.Error(t, (&Redact{Patterns: []string{"("}}).Provision(logarchive.Context{}))
+}
+
+func TestTruncate(t *testing.T) {
+	in := "1\n2\n3\n4\n5\n6"
+	tests := []struct {
+		filter *Truncate
+		want   string
+	}{
+		{&Truncate{HeadLines: 2}, "1\n2\n"},
+		{&Truncate{TailLines: 2}, "5\n6"},
+		{&Truncate{HeadLines: 2, TailLines: 2, Marker: "..."}, "1\n2\n...\n5\n6"},
+		{&Truncate{HeadLines: 3, TailLines: 3, Marker: "..."}, in},
+		{&Truncate{HeadLines: 10}, in},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, runFilter(t, tt.filter, in), "%+v", tt.filter)
+	}
+
+	assert.Error(t, (&Truncate{}).Provision(logarchive.Context{}))
+	assert.Error(t, (&Truncate{HeadLines: -1, TailLines: 1}).Provision(logarchive.Context{}))
+}
+
+func TestSample(t *testing.T) {
+	var in strings.Builder
+	for i := 0; i < 10; i++ {
+		in.WriteString("info\n")
+	}
+	in.WriteString("error\n")
+
+	got := runFilter(t, &Sample{Rate: 0.2, Keep: []string{"^error"}}, in.String())
+	assert.Equal(t, "info\ninfo\nerror\n", got)
+	assert.Equal(t, in.String(), runFilter(t, &Sample{Rate: 1}, in.String()))
+
+	assert.Error(t, (&Sample{}).Provision(logarchive.Context{}))
+	assert.Error(t, (&Sample{Rate: 1.5}).Provision(logarchive.Context{}))
+}
+
+func TestApplyFilters(t *testing.T) {
+	redact := &Redact{Presets: []string{"ipv4"}}
+	head := &Truncate{HeadLines: 2}
+	for _, f := range []logarchive.Provisioner{redact, head} {
+		if err := f.Provision(logarchive.Context{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the redact filter is stopped when truncate does not read the rest
+	in := strings.Repeat("from 10.0.0.1\n", 100000)
+	out := &bytes.Buffer{}
+	assert.NoError(t, logarchive.ApplyFilters([]logarchive.Filter{redact, head}, out, strings.NewReader(in)))
+	assert.Equal(t, "from ***\nfrom ***\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, logarchive.ApplyFilters(nil, out, strings.NewReader("a\n")))
+	assert.Equal(t, "a\n", out.String())
+}
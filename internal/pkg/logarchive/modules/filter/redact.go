@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+const defaultReplacement = "***"
+
+// redactPresets are the patterns of the common personal data.
+var redactPresets = map[string]string{
+	"ipv4":  `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`,
+	"ipv6":  `\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b`,
+	"email": `\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}\b`,
+}
+
+// Redact masks the text matched by the patterns in each line, e.g. the tokens
+// or the ip addresses of the players.
+type Redact struct {
+	// Patterns are the regular expressions of the text to mask
+	Patterns []string `yaml:"patterns,omitempty" json:"patterns,omitempty"`
+	// Presets are the names of the builtin patterns: ipv4, ipv6 and email
+	Presets []string `yaml:"presets,omitempty" json:"presets,omitempty"`
+	// Replacement replaces the matched text, "***" by default
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+
+	regs []*regexp.Regexp
+}
+
+// ArchiveModule returns the redact filter module information.
+func (Redact) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "filter.redact",
+		New: func() logarchive.Module {
+			return new(Redact)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (f *Redact) Provision(_ logarchive.Context) error {
+	patterns := append([]string{}, f.Patterns...)
+	for _, name := range f.Presets {
+		p, ok := redactPresets[name]
+		if !ok {
+			return fmt.Errorf("unknown redact preset: %s", name)
+		}
+		patterns = append(patterns, p)
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("patterns or presets is required")
+	}
+
+	var err error
+	if f.regs, err = compilePatterns(patterns); err != nil {
+		return err
+	}
+	if f.Replacement == "" {
+		f.Replacement = defaultReplacement
+	}
+	return nil
+}
+
+// Filter implement the filter interface
+func (f *Redact) Filter(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+	replacement := []byte(f.Replacement)
+	if err := eachLine(r, func(line []byte) (bool, error) {
+		for _, reg := range f.regs {
+			line = reg.ReplaceAllLiteral(line, replacement)
+		}
+		_, err := bw.Write(line)
+		return err == nil, err
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+var (
+	_ logarchive.Provisioner = (*Redact)(nil)
+	_ logarchive.Filter      = (*Redact)(nil)
+)
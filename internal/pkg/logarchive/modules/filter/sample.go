@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// Sample keeps a part of the lines by the rate, the lines are picked evenly so
+// that the result of the same file is always the same.
+type Sample struct {
+	// Rate is the ratio of the lines kept, in (0, 1]
+	Rate float64 `yaml:"rate,omitempty" json:"rate,omitempty"`
+	// Keep are the regular expressions of the lines always kept, e.g. the errors
+	Keep []string `yaml:"keep,omitempty" json:"keep,omitempty"`
+
+	regs []*regexp.Regexp
+}
+
+// ArchiveModule returns the sample filter module information.
+func (Sample) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "filter.sample",
+		New: func() logarchive.Module {
+			return new(Sample)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (f *Sample) Provision(_ logarchive.Context) error {
+	if f.Rate <= 0 || f.Rate > 1 {
+		return fmt.Errorf("invalid sample rate: %v, should be in (0, 1]", f.Rate)
+	}
+
+	var err error
+	f.regs, err = compilePatterns(f.Keep)
+	return err
+}
+
+// Filter implement the filter interface
+func (f *Sample) Filter(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+
+	// a line is kept when the expected count of kept lines reaches the next integer
+	var n int
+	if err := eachLine(r, func(line []byte) (bool, error) {
+		n++
+		keep := int(float64(n)*f.Rate) > int(float64(n-1)*f.Rate)
+		for i := 0; !keep && i < len(f.regs); i++ {
+			keep = f.regs[i].Match(line)
+		}
+		if !keep {
+			return true, nil
+		}
+		_, err := bw.Write(line)
+		return err == nil, err
+	}); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+var (
+	_ logarchive.Provisioner = (*Sample)(nil)
+	_ logarchive.Filter      = (*Sample)(nil)
+)
@@ -0,0 +1,92 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+// Truncate keeps the first HeadLines lines and the last TailLines lines of the
+// file, the lines between them are dropped.
+type Truncate struct {
+	HeadLines int `yaml:"headLines,omitempty" json:"headLines,omitempty"`
+	TailLines int `yaml:"tailLines,omitempty" json:"tailLines,omitempty"`
+	// Marker is written as a line in place of the dropped lines if it is set
+	Marker string `yaml:"marker,omitempty" json:"marker,omitempty"`
+}
+
+// ArchiveModule returns the truncate filter module information.
+func (Truncate) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "filter.truncate",
+		New: func() logarchive.Module {
+			return new(Truncate)
+		},
+	}
+}
+
+// Provision implement the provisioner interface
+func (f *Truncate) Provision(_ logarchive.Context) error {
+	if f.HeadLines < 0 || f.TailLines < 0 {
+		return fmt.Errorf("invalid headLines: %d or tailLines: %d", f.HeadLines, f.TailLines)
+	}
+	if f.HeadLines == 0 && f.TailLines == 0 {
+		return fmt.Errorf("headLines or tailLines is required")
+	}
+	return nil
+}
+
+// Filter implement the filter interface
+func (f *Truncate) Filter(w io.Writer, r io.Reader) error {
+	bw := bufio.NewWriter(w)
+
+	var (
+		n       int
+		dropped bool
+		// tail is a ring of the last lines, next is the position of the oldest
+		tail = make([][]byte, 0, f.TailLines)
+		next int
+	)
+	err := eachLine(r, func(line []byte) (bool, error) {
+		n++
+		if n <= f.HeadLines {
+			_, err := bw.Write(line)
+			return err == nil, err
+		}
+		if f.TailLines == 0 {
+			// the rest of the file is not read
+			dropped = true
+			return false, nil
+		}
+		if len(tail) < f.TailLines {
+			tail = append(tail, line)
+			return true, nil
+		}
+		tail[next] = line
+		next = (next + 1) % f.TailLines
+		dropped = true
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if dropped && f.Marker != "" {
+		if _, err := fmt.Fprintln(bw, f.Marker); err != nil {
+			return err
+		}
+	}
+	for i := range tail {
+		if _, err := bw.Write(tail[(next+i)%len(tail)]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	_ logarchive.Provisioner = (*Truncate)(nil)
+	_ logarchive.Filter      = (*Truncate)(nil)
+)
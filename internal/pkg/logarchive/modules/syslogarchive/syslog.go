@@ -0,0 +1,388 @@
+package syslogarchive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+	"github.com/atframework/atdtool/internal/pkg/logarchive/modules/filearchive"
+)
+
+const (
+	defaultMaxFileSize    = 64 * 1024 * 1024
+	defaultRotateInterval = 300
+	maxMessageSize        = 1024 * 1024
+
+	spoolFileSuffix   = ".log"
+	activeFileSuffix  = ".part"
+	spoolFilePrefix   = "syslog-"
+	spoolFileTimeFmt  = "20060102T150405.000000000"
+	defaultListenAddr = ":514"
+)
+
+// Listener defines a syslog listen address, the network is "tcp" or "udp".
+// TCP messages are framed by newline.
+type Listener struct {
+	Network string `yaml:"network,omitempty" json:"network,omitempty"`
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+}
+
+// Archive receives syslog messages, spools them into size/time rotated files
+// in SpoolDir, and pushes the rotated files through the configured output.
+type Archive struct {
+	filearchive.Archive
+
+	Listeners []Listener `yaml:"listeners,omitempty" json:"listeners,omitempty"`
+	SpoolDir  string     `yaml:"spoolDir,omitempty" json:"spoolDir,omitempty"`
+	// MaxFileSize is the max size in bytes of a spool file
+	MaxFileSize int64 `yaml:"maxFileSize,omitempty" json:"maxFileSize,omitempty"`
+	// RotateInterval is the max time in seconds a spool file is written
+	RotateInterval int `yaml:"rotateInterval,omitempty" json:"rotateInterval,omitempty"`
+
+	spool     *spool
+	listeners []net.Listener
+	conns     []net.PacketConn
+	wg        *sync.WaitGroup
+	done      chan struct{}
+
+	logger *zap.SugaredLogger
+}
+
+// ArchiveModule returns the syslog module information.
+func (Archive) ArchiveModule() logarchive.ModuleInfo {
+	return logarchive.ModuleInfo{
+		ID: "syslog",
+		New: func() logarchive.Module {
+			return new(Archive)
+		},
+	}
+}
+
+// Provision implement the module interface
+func (ar *Archive) Provision(ctx logarchive.Context) error {
+	ar.logger = ctx.Logger().Sugar().Named("syslog")
+	ar.done = make(chan struct{})
+	ar.wg = new(sync.WaitGroup)
+
+	if ar.SpoolDir == "" {
+		return fmt.Errorf("syslog spool dir is required")
+	}
+	if len(ar.Paths) != 0 {
+		return fmt.Errorf("paths is the spool dir, it can not be specified")
+	}
+
+	if len(ar.Listeners) == 0 {
+		ar.Listeners = []Listener{{Network: "udp", Address: defaultListenAddr}}
+	}
+	for i, l := range ar.Listeners {
+		if l.Network != "tcp" && l.Network != "udp" {
+			return fmt.Errorf("listener %d: unsupport network: %s", i, l.Network)
+		}
+		if l.Address == "" {
+			ar.Listeners[i].Address = defaultListenAddr
+		}
+	}
+
+	if ar.MaxFileSize <= 0 {
+		ar.MaxFileSize = defaultMaxFileSize
+	}
+	if ar.RotateInterval <= 0 {
+		ar.RotateInterval = defaultRotateInterval
+	}
+
+	if err := os.MkdirAll(ar.SpoolDir, os.ModePerm); err != nil {
+		return fmt.Errorf("make spool dir(%s): %v", ar.SpoolDir, err)
+	}
+
+	ar.spool = &spool{
+		dir:         ar.SpoolDir,
+		maxSize:     ar.MaxFileSize,
+		maxDuration: time.Duration(ar.RotateInterval) * time.Second,
+	}
+	// the active files left by last run are complete now
+	if err := ar.spool.recover(); err != nil {
+		return err
+	}
+
+	ar.Paths = []string{ar.SpoolDir}
+	ar.SetCollector(ar)
+	return ar.Archive.Provision(ctx)
+}
+
+// Start implement the archive interface
+func (ar *Archive) Start() error {
+	if err := ar.Archive.Start(); err != nil {
+		return err
+	}
+
+	for _, l := range ar.Listeners {
+		if err := ar.listen(l); err != nil {
+			ar.closeListeners()
+			return err
+		}
+	}
+
+	ar.wg.Add(1)
+	go ar.runRotate()
+	return nil
+}
+
+// Stop implement the archive interface
+func (ar *Archive) Stop() error {
+	select {
+	case <-ar.done:
+	default:
+		close(ar.done)
+	}
+
+	ar.closeListeners()
+	ar.wg.Wait()
+
+	if err := ar.spool.rotate(); err != nil {
+		ar.logger.Errorf("rotate spool file: %v", err)
+	}
+	return ar.Archive.Stop()
+}
+
+// Accept implement the collector interface, only the rotated spool files are collected.
+func (ar *Archive) Accept(rootPath, filePath string) bool {
+	return filepath.Dir(filePath) == filepath.Clean(rootPath) && strings.HasSuffix(filePath, spoolFileSuffix)
+}
+
+// DestPath implement the collector interface
+func (ar *Archive) DestPath(rootPath, filePath string) (string, error) {
+	return filepath.Rel(rootPath, filePath)
+}
+
+func (ar *Archive) listen(l Listener) error {
+	switch l.Network {
+	case "tcp":
+		ln, err := net.Listen(l.Network, l.Address)
+		if err != nil {
+			return fmt.Errorf("listen %s %s: %v", l.Network, l.Address, err)
+		}
+		ar.listeners = append(ar.listeners, ln)
+
+		ar.wg.Add(1)
+		go ar.serveTCP(ln)
+	case "udp":
+		conn, err := net.ListenPacket(l.Network, l.Address)
+		if err != nil {
+			return fmt.Errorf("listen %s %s: %v", l.Network, l.Address, err)
+		}
+		ar.conns = append(ar.conns, conn)
+
+		ar.wg.Add(1)
+		go ar.serveUDP(conn)
+	}
+	ar.logger.Infof("syslog listen on %s %s", l.Network, l.Address)
+	return nil
+}
+
+func (ar *Archive) closeListeners() {
+	for _, ln := range ar.listeners {
+		_ = ln.Close()
+	}
+	for _, conn := range ar.conns {
+		_ = conn.Close()
+	}
+	ar.listeners, ar.conns = nil, nil
+}
+
+func (ar *Archive) serveTCP(ln net.Listener) {
+	defer ar.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				ar.logger.Errorf("accept syslog connection: %v", err)
+			}
+			return
+		}
+
+		ar.wg.Add(1)
+		go ar.handleConn(conn)
+	}
+}
+
+func (ar *Archive) handleConn(conn net.Conn) {
+	defer ar.wg.Done()
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		// unblock the reading when the archive is stopped
+		select {
+		case <-ar.done:
+			_ = conn.Close()
+		case <-closed:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxMessageSize)
+	for scanner.Scan() {
+		ar.write(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		ar.logger.Errorf("read syslog connection from %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+func (ar *Archive) serveUDP(conn net.PacketConn) {
+	defer ar.wg.Done()
+
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				ar.logger.Errorf("read syslog packet: %v", err)
+			}
+			return
+		}
+		ar.write(buf[:n])
+	}
+}
+
+func (ar *Archive) write(msg []byte) {
+	msg = bytes.TrimRight(msg, "\r\n")
+	if len(msg) == 0 {
+		return
+	}
+
+	if err := ar.spool.write(msg); err != nil {
+		ar.logger.Errorf("write syslog message: %v", err)
+	}
+}
+
+func (ar *Archive) runRotate() {
+	defer ar.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ar.done:
+			return
+		case now := <-ticker.C:
+			if err := ar.spool.rotateExpired(now); err != nil {
+				ar.logger.Errorf("rotate spool file: %v", err)
+			}
+		}
+	}
+}
+
+// spool writes messages into the active file, the file is renamed to *.log
+// when it is rotated, then it is collected by the file archive.
+type spool struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	maxDuration time.Duration
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func (s *spool) write(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil && s.size+int64(len(msg))+1 > s.maxSize {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	if s.file == nil {
+		now := time.Now()
+		name := filepath.Join(s.dir, spoolFilePrefix+now.Format(spoolFileTimeFmt)+spoolFileSuffix+activeFileSuffix)
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		s.file, s.size, s.openedAt = f, 0, now
+	}
+
+	// msg may refer to the read buffer, it must not be appended in place
+	line := make([]byte, len(msg)+1)
+	copy(line, msg)
+	line[len(msg)] = '\n'
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *spool) rotateExpired(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || now.Sub(s.openedAt) < s.maxDuration {
+		return nil
+	}
+	return s.rotateLocked()
+}
+
+func (s *spool) rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rotateLocked()
+}
+
+func (s *spool) rotateLocked() error {
+	if s.file == nil {
+		return nil
+	}
+
+	name := s.file.Name()
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+	return os.Rename(name, strings.TrimSuffix(name, activeFileSuffix))
+}
+
+// recover completes the active files which are left by an unexpected exit.
+func (s *spool) recover() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, spoolFilePrefix+"*"+spoolFileSuffix+activeFileSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := os.Rename(name, strings.TrimSuffix(name, activeFileSuffix)); err != nil {
+			return fmt.Errorf("recover spool file(%s): %v", name, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	logarchive.RegisterModule(Archive{})
+}
+
+var (
+	_ logarchive.Provisioner  = (*Archive)(nil)
+	_ logarchive.Validator    = (*Archive)(nil)
+	_ logarchive.CleanerUpper = (*Archive)(nil)
+	_ logarchive.Archive      = (*Archive)(nil)
+	_ filearchive.Collector   = (*Archive)(nil)
+)
@@ -0,0 +1,91 @@
+package syslogarchive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spoolFiles(t *testing.T, dir, pattern string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestSpoolRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	s := &spool{dir: dir, maxSize: 16, maxDuration: time.Hour}
+
+	for _, msg := range []string{"<13>first", "<13>second", "<13>third"} {
+		if !assert.NoError(t, s.write([]byte(msg))) {
+			return
+		}
+	}
+
+	// the two rotated files are complete, the last one is still active
+	assert.Len(t, spoolFiles(t, dir, "*"+spoolFileSuffix), 2)
+	assert.Len(t, spoolFiles(t, dir, "*"+activeFileSuffix), 1)
+
+	if !assert.NoError(t, s.rotate()) {
+		return
+	}
+	names := spoolFiles(t, dir, "*"+spoolFileSuffix)
+	assert.Len(t, names, 3)
+	assert.Empty(t, spoolFiles(t, dir, "*"+activeFileSuffix))
+
+	var lines []string
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if !assert.NoError(t, err) {
+			return
+		}
+		lines = append(lines, strings.TrimSuffix(string(data), "\n"))
+	}
+	assert.ElementsMatch(t, []string{"<13>first", "<13>second", "<13>third"}, lines)
+}
+
+func TestSpoolRotateExpired(t *testing.T) {
+	dir := t.TempDir()
+	s := &spool{dir: dir, maxSize: 1024, maxDuration: time.Minute}
+
+	if !assert.NoError(t, s.write([]byte("<13>message"))) {
+		return
+	}
+
+	assert.NoError(t, s.rotateExpired(time.Now()))
+	assert.Len(t, spoolFiles(t, dir, "*"+activeFileSuffix), 1)
+
+	assert.NoError(t, s.rotateExpired(time.Now().Add(time.Minute)))
+	assert.Empty(t, spoolFiles(t, dir, "*"+activeFileSuffix))
+	assert.Len(t, spoolFiles(t, dir, "*"+spoolFileSuffix), 1)
+}
+
+func TestSpoolRecover(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, spoolFilePrefix+"20240101T000000.000000000"+spoolFileSuffix+activeFileSuffix)
+	if err := os.WriteFile(name, []byte("<13>left\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &spool{dir: dir}
+	if !assert.NoError(t, s.recover()) {
+		return
+	}
+	assert.NoFileExists(t, name)
+	assert.FileExists(t, strings.TrimSuffix(name, activeFileSuffix))
+}
+
+func TestArchiveAccept(t *testing.T) {
+	dir := t.TempDir()
+	ar := &Archive{}
+
+	assert.True(t, ar.Accept(dir, filepath.Join(dir, "syslog-20240101T000000.000000000.log")))
+	assert.False(t, ar.Accept(dir, filepath.Join(dir, "syslog-20240101T000000.000000000.log.part")))
+	assert.False(t, ar.Accept(dir, filepath.Join(dir, "sub", "syslog.log")))
+}
@@ -0,0 +1,90 @@
+package logarchive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// NotifyEvent is the payload sent by a Notifier.
+type NotifyEvent struct {
+	Kind     string            `yaml:"kind" json:"kind"`
+	Name     string            `yaml:"name" json:"name"`
+	Module   string            `yaml:"module,omitempty" json:"module,omitempty"`
+	Message  string            `yaml:"message,omitempty" json:"message,omitempty"`
+	Resolved bool              `yaml:"resolved,omitempty" json:"resolved,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+	Time     time.Time         `yaml:"time" json:"time"`
+}
+
+// Notifier delivers events to an external system, either by running a command
+// which receives the event as JSON on stdin, or by posting the JSON to a webhook.
+type Notifier struct {
+	Command string   `yaml:"command,omitempty" json:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty" json:"args,omitempty"`
+	Webhook string   `yaml:"webhook,omitempty" json:"webhook,omitempty"`
+	Timeout int      `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// Validate checks the notifier has a destination.
+func (n *Notifier) Validate() error {
+	if n.Command == "" && n.Webhook == "" {
+		return fmt.Errorf("notifier requires command or webhook")
+	}
+	return nil
+}
+
+// Notify sends the event to every configured destination.
+func (n *Notifier) Notify(e NotifyEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding notify event: %v", err)
+	}
+
+	timeout := time.Duration(n.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	if n.Command != "" {
+		cmd := exec.CommandContext(ctx, n.Command, n.Args...)
+		cmd.Stdin = bytes.NewReader(data)
+		cmd.Env = append(os.Environ(),
+			"LOGARCHIVE_EVENT_KIND="+e.Kind,
+			"LOGARCHIVE_EVENT_NAME="+e.Name,
+			"LOGARCHIVE_EVENT_MODULE="+e.Module,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Errorf("run notify command: %v, output: %s", err, out))
+		}
+	}
+
+	if n.Webhook != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Webhook, bytes.NewReader(data))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("new notify request: %v", err))
+		} else {
+			req.Header.Set("Content-Type", "application/json")
+			rsp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("post notify webhook: %v", err))
+			} else {
+				rsp.Body.Close()
+				if rsp.StatusCode >= http.StatusMultipleChoices {
+					errs = append(errs, fmt.Errorf("post notify webhook: unexpected status %s", rsp.Status))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package logarchive
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifierNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("notify commands in this test are POSIX shell commands")
+	}
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r.Header.Get("Content-Type")+" "+string(data))
+		mu.Unlock()
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	e := NotifyEvent{
+		Kind:    alertKindBacklogAge,
+		Name:    "file",
+		Module:  "file",
+		Message: "backlog age 150s exceeds 100s",
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "event.json")
+	env := filepath.Join(dir, "event.env")
+	// the command receives the event on stdin and in the environment
+	command := &Notifier{Command: "sh", Args: []string{"-c",
+		`cat > "$0" && echo "$LOGARCHIVE_EVENT_KIND $LOGARCHIVE_EVENT_NAME $LOGARCHIVE_EVENT_MODULE" > "$1"`, out, env}}
+
+	tests := []struct {
+		name     string
+		notifier *Notifier
+		err      []string
+		webhooks int
+	}{
+		{"command", command, nil, 0},
+		{"failed command", &Notifier{Command: "sh", Args: []string{"-c", "echo boom && exit 3"}}, []string{"run notify command", "boom"}, 0},
+		{"webhook", &Notifier{Webhook: srv.URL + "/ok"}, nil, 1},
+		{"failed webhook", &Notifier{Webhook: srv.URL + "/fail"}, []string{"unexpected status 500"}, 1},
+		{"unreachable webhook", &Notifier{Webhook: "http://127.0.0.1:0/", Timeout: 1}, []string{"post notify webhook"}, 0},
+		{"command and failed webhook", &Notifier{Command: "true", Webhook: srv.URL + "/fail"}, []string{"unexpected status 500"}, 1},
+		{"both failed", &Notifier{Command: "false", Webhook: srv.URL + "/fail"}, []string{"run notify command", "unexpected status 500"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			received = nil
+			mu.Unlock()
+
+			assert.NoError(t, tt.notifier.Validate())
+			err := tt.notifier.Notify(e)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				for _, s := range tt.err {
+					assert.Contains(t, err.Error(), s)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if assert.Len(t, received, tt.webhooks) {
+				for _, r := range received {
+					assert.Equal(t, "application/json "+string(payload), r)
+				}
+			}
+		})
+	}
+
+	data, err := os.ReadFile(out)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, string(payload), string(data))
+	}
+	data, err = os.ReadFile(env)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "backlog_age file file", strings.TrimSpace(string(data)))
+	}
+
+	assert.Error(t, (&Notifier{}).Validate())
+}
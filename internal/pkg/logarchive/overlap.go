@@ -0,0 +1,77 @@
+package logarchive
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PathWatcher is implemented by the archives which collect the files under paths.
+type PathWatcher interface {
+	WatchedPaths() []string
+}
+
+type watchedPath struct {
+	archive string
+	path    string
+	clean   string
+}
+
+// checkPathOverlap returns an error when the paths watched by different archives
+// are the same or inside one another, since the files would be uploaded twice and
+// deleted by both archives.
+func checkPathOverlap(archives map[string]Archive) error {
+	names := make([]string, 0, len(archives))
+	for name := range archives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var paths []watchedPath
+	for _, name := range names {
+		w, ok := archives[name].(PathWatcher)
+		if !ok {
+			continue
+		}
+		for _, p := range w.WatchedPaths() {
+			paths = append(paths, watchedPath{archive: name, path: p, clean: resolvePath(p)})
+		}
+	}
+
+	var overlaps []string
+	for i := range paths {
+		for j := i + 1; j < len(paths); j++ {
+			a, b := paths[i], paths[j]
+			if a.archive == b.archive {
+				continue
+			}
+			if isSubPath(a.clean, b.clean) || isSubPath(b.clean, a.clean) {
+				overlaps = append(overlaps, fmt.Sprintf("%s of archive %s and %s of archive %s", a.path, a.archive, b.path, b.archive))
+			}
+		}
+	}
+
+	if len(overlaps) != 0 {
+		return fmt.Errorf("watched paths overlap: %s, set allowOverlap to start anyway", strings.Join(overlaps, "; "))
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path with the symbolic links resolved, so
+// that the same directory reached by different names is detected.
+func resolvePath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	return filepath.Clean(p)
+}
+
+// isSubPath reports whether path is the base path or inside it.
+func isSubPath(base, path string) bool {
+	rel, err := filepath.Rel(base, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,53 @@
+package logarchive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWatcher []string
+
+func (fakeWatcher) Start() error { return nil }
+
+func (fakeWatcher) Stop() error { return nil }
+
+func (w fakeWatcher) WatchedPaths() []string { return w }
+
+func TestCheckPathOverlap(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	if err := os.MkdirAll(filepath.Join(logs, "exec"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// the paths of the same archive are not checked
+	assert.NoError(t, checkPathOverlap(map[string]Archive{
+		"file": fakeWatcher{logs, filepath.Join(logs, "exec")},
+		"exec": fakeWatcher{filepath.Join(dir, "exec")},
+	}))
+
+	err := checkPathOverlap(map[string]Archive{
+		"file": fakeWatcher{logs},
+		"exec": fakeWatcher{filepath.Join(logs, "exec")},
+	})
+	assert.ErrorContains(t, err, "of archive exec and "+logs+" of archive file")
+
+	assert.Error(t, checkPathOverlap(map[string]Archive{
+		"file": fakeWatcher{logs},
+		"exec": fakeWatcher{logs + string(filepath.Separator)},
+	}))
+
+	// the directory reached by a symbolic link is the same directory
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(logs, link); err == nil {
+		assert.Error(t, checkPathOverlap(map[string]Archive{
+			"file": fakeWatcher{logs},
+			"exec": fakeWatcher{link},
+		}))
+	}
+
+	assert.False(t, isSubPath(logs, logs+"2"))
+}
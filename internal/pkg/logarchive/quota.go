@@ -0,0 +1,259 @@
+package logarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// bandwidthQuantum is the bytes added to the deficit of an archive for each
+// share in a round of the bandwidth scheduling.
+const bandwidthQuantum = 1 << 20
+
+var errQuotaStopped = errors.New("quota has been stopped")
+
+// ArchiveQuota limits the resources used by an archive. The zero values are unlimited.
+type ArchiveQuota struct {
+	// MaxQueuedBytes limits the size of the files queued or uploading
+	MaxQueuedBytes int64 `yaml:"maxQueuedBytes,omitempty" json:"maxQueuedBytes,omitempty"`
+	// MaxTrackedFiles limits the files waiting for upload, the new files are
+	// tracked again after the archive is under the quota
+	MaxTrackedFiles int `yaml:"maxTrackedFiles,omitempty" json:"maxTrackedFiles,omitempty"`
+	// BandwidthShare is the weight of the archive sharing the bandwidth, 1 by default
+	BandwidthShare int `yaml:"bandwidthShare,omitempty" json:"bandwidthShare,omitempty"`
+
+	name        string
+	quota       *Quota
+	queuedBytes int64
+
+	// guarded by the mutex of the quota
+	pending []*bandwidthRequest
+	deficit int64
+}
+
+type bandwidthRequest struct {
+	n        int64
+	granted  chan struct{}
+	canceled atomic.Bool
+}
+
+// Quota shares the resources of the daemon between the archives, so that the
+// runaway log volume of an archive does not starve the others on a shared host.
+// Archives is keyed by the name of the archive, e.g. "file" or "exec".
+type Quota struct {
+	// Bandwidth is the bytes per second shared by the archives, 0 is unlimited
+	Bandwidth int64                    `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty"`
+	Archives  map[string]*ArchiveQuota `yaml:"archives,omitempty" json:"archives,omitempty"`
+	// CompressMemory is the bytes of the compression buffers shared by the
+	// outputs, 256MB by default
+	CompressMemory int64 `yaml:"compressMemory,omitempty" json:"compressMemory,omitempty"`
+
+	mu    sync.Mutex
+	names []string
+	next  int
+
+	ctx  Context
+	wake chan struct{}
+	done chan struct{}
+
+	logger *zap.SugaredLogger
+}
+
+// Provision initializes the Quota instance with required components
+func (q *Quota) Provision(ctx Context) error {
+	q.ctx = ctx
+	q.logger = ctx.Logger().Sugar().Named("quota")
+	q.wake = make(chan struct{}, 1)
+	q.done = make(chan struct{})
+
+	if q.Bandwidth < 0 {
+		return fmt.Errorf("invalid quota bandwidth: %d", q.Bandwidth)
+	}
+	if q.CompressMemory < 0 {
+		return fmt.Errorf("invalid quota compress memory: %d", q.CompressMemory)
+	}
+
+	for name, aq := range q.Archives {
+		if aq == nil {
+			return fmt.Errorf("quota of archive: %s is empty", name)
+		}
+		if aq.MaxQueuedBytes < 0 || aq.MaxTrackedFiles < 0 || aq.BandwidthShare < 0 {
+			return fmt.Errorf("invalid quota of archive: %s", name)
+		}
+		if aq.BandwidthShare == 0 {
+			aq.BandwidthShare = 1
+		}
+
+		aq.name = name
+		aq.quota = q
+		q.names = append(q.names, name)
+	}
+	sort.Strings(q.names)
+	return nil
+}
+
+func (q *Quota) Start() error {
+	if q.Bandwidth > 0 {
+		q.logger.Infof("bandwidth: %d bytes/s is shared by archives: %v", q.Bandwidth, q.names)
+		go q.runBandwidth()
+	}
+	return nil
+}
+
+func (q *Quota) Stop() error {
+	select {
+	case <-q.done:
+	default:
+		close(q.done)
+	}
+	return nil
+}
+
+// Quota returns the quota of the archive, it is nil when the archive has no quota.
+func (ctx Context) Quota(name string) *ArchiveQuota {
+	if ctx.cfg == nil || ctx.cfg.Quota == nil {
+		return nil
+	}
+	return ctx.cfg.Quota.Archives[name]
+}
+
+// ReserveQueued reserves the queued bytes for a file. A file larger than the
+// quota is still accepted when nothing is queued, otherwise it is never uploaded.
+func (aq *ArchiveQuota) ReserveQueued(n int64) bool {
+	if aq == nil {
+		return true
+	}
+
+	queued := atomic.LoadInt64(&aq.queuedBytes)
+	if aq.MaxQueuedBytes > 0 && queued > 0 && queued+n > aq.MaxQueuedBytes {
+		return false
+	}
+	QuotaQueuedBytes.WithLabelValues(aq.name).Set(float64(atomic.AddInt64(&aq.queuedBytes, n)))
+	return true
+}
+
+// ReleaseQueued releases the bytes reserved by ReserveQueued.
+func (aq *ArchiveQuota) ReleaseQueued(n int64) {
+	if aq == nil {
+		return
+	}
+	QuotaQueuedBytes.WithLabelValues(aq.name).Set(float64(atomic.AddInt64(&aq.queuedBytes, -n)))
+}
+
+// TrackAvailable reports whether a new file could be tracked, with tracked
+// files waiting for upload.
+func (aq *ArchiveQuota) TrackAvailable(tracked int) bool {
+	return aq == nil || aq.MaxTrackedFiles <= 0 || tracked < aq.MaxTrackedFiles
+}
+
+// WaitBandwidth blocks until n bytes could be uploaded by the archive. The
+// bandwidth is shared by the waiting archives in proportion to their shares.
+func (aq *ArchiveQuota) WaitBandwidth(ctx context.Context, n int64) error {
+	if aq == nil || aq.quota.Bandwidth <= 0 {
+		return nil
+	}
+
+	q := aq.quota
+	req := &bandwidthRequest{n: n, granted: make(chan struct{})}
+
+	q.mu.Lock()
+	aq.pending = append(aq.pending, req)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-req.granted:
+		return nil
+	case <-ctx.Done():
+		req.canceled.Store(true)
+		return ctx.Err()
+	case <-q.done:
+		return errQuotaStopped
+	}
+}
+
+// runBandwidth grants the requests and paces them by the bandwidth.
+func (q *Quota) runBandwidth() {
+	next := time.Now()
+	for {
+		req := q.nextRequest()
+		if req == nil {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			case <-q.ctx.Done():
+				return
+			}
+		}
+
+		if d := time.Until(next); d > 0 {
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-q.done:
+				timer.Stop()
+				return
+			case <-q.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+		close(req.granted)
+
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+		next = next.Add(time.Duration(float64(req.n) / float64(q.Bandwidth) * float64(time.Second)))
+	}
+}
+
+// nextRequest picks the next request by the deficit round robin of the archives
+// waiting for the bandwidth, it returns nil when no archive is waiting.
+func (q *Quota) nextRequest() *bandwidthRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiting := false
+	for _, name := range q.names {
+		aq := q.Archives[name]
+		for len(aq.pending) != 0 && aq.pending[0].canceled.Load() {
+			aq.pending = aq.pending[1:]
+		}
+		if len(aq.pending) == 0 {
+			// the idle archive does not save its deficit
+			aq.deficit = 0
+		} else {
+			waiting = true
+		}
+	}
+	if !waiting {
+		return nil
+	}
+
+	for {
+		aq := q.Archives[q.names[q.next]]
+		if len(aq.pending) != 0 && aq.pending[0].n <= aq.deficit {
+			req := aq.pending[0]
+			aq.pending = aq.pending[1:]
+			aq.deficit -= req.n
+			return req
+		}
+
+		q.next = (q.next + 1) % len(q.names)
+		if aq := q.Archives[q.names[q.next]]; len(aq.pending) != 0 {
+			aq.deficit += bandwidthQuantum * int64(aq.BandwidthShare)
+		}
+	}
+}
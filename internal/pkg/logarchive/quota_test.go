@@ -0,0 +1,98 @@
+package logarchive
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQuota(bandwidth int64, archives map[string]*ArchiveQuota) *Quota {
+	q := &Quota{
+		Bandwidth: bandwidth,
+		Archives:  archives,
+		ctx:       Context{Context: context.Background()},
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	for name, aq := range archives {
+		aq.name, aq.quota = name, q
+		q.names = append(q.names, name)
+	}
+	sort.Strings(q.names)
+	return q
+}
+
+func TestQuotaBandwidthShares(t *testing.T) {
+	noisy := &ArchiveQuota{BandwidthShare: 1}
+	quiet := &ArchiveQuota{BandwidthShare: 3}
+	q := newTestQuota(1<<30, map[string]*ArchiveQuota{"noisy": noisy, "quiet": quiet})
+
+	owner := make(map[*bandwidthRequest]string)
+	for i := 0; i < 100; i++ {
+		for name, aq := range q.Archives {
+			req := &bandwidthRequest{n: bandwidthQuantum, granted: make(chan struct{})}
+			aq.pending = append(aq.pending, req)
+			owner[req] = name
+		}
+	}
+
+	granted := map[string]int{}
+	for i := 0; i < 40; i++ {
+		granted[owner[q.nextRequest()]]++
+	}
+	assert.Equal(t, map[string]int{"noisy": 10, "quiet": 30}, granted)
+
+	// the idle archive gets the whole bandwidth
+	quiet.pending = nil
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "noisy", owner[q.nextRequest()])
+	}
+
+	noisy.pending = nil
+	assert.Nil(t, q.nextRequest())
+}
+
+func TestQuotaWaitBandwidth(t *testing.T) {
+	aq := &ArchiveQuota{BandwidthShare: 1}
+	q := newTestQuota(10<<20, map[string]*ArchiveQuota{"file": aq})
+	go q.runBandwidth()
+	defer q.Stop()
+
+	// the first request is granted at once, the next one waits for its bytes
+	start := time.Now()
+	assert.NoError(t, aq.WaitBandwidth(context.Background(), 1<<20))
+	assert.NoError(t, aq.WaitBandwidth(context.Background(), 1<<20))
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, aq.WaitBandwidth(ctx, 100<<20), context.DeadlineExceeded)
+	assert.ErrorIs(t, aq.WaitBandwidth(ctx, 1), context.DeadlineExceeded)
+
+	// no quota means no limits
+	var none *ArchiveQuota
+	assert.NoError(t, none.WaitBandwidth(context.Background(), 1<<30))
+	assert.True(t, none.ReserveQueued(1<<30))
+	assert.True(t, none.TrackAvailable(1<<30))
+}
+
+func TestQuotaReserveQueued(t *testing.T) {
+	aq := &ArchiveQuota{MaxQueuedBytes: 100, MaxTrackedFiles: 2}
+
+	// a file larger than the quota is accepted when nothing is queued
+	assert.True(t, aq.ReserveQueued(150))
+	assert.False(t, aq.ReserveQueued(1))
+	aq.ReleaseQueued(150)
+
+	assert.True(t, aq.ReserveQueued(60))
+	assert.True(t, aq.ReserveQueued(40))
+	assert.False(t, aq.ReserveQueued(1))
+	aq.ReleaseQueued(40)
+	assert.True(t, aq.ReserveQueued(1))
+
+	assert.True(t, aq.TrackAvailable(1))
+	assert.False(t, aq.TrackAvailable(2))
+}
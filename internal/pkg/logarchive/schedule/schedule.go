@@ -0,0 +1,148 @@
+// Package schedule parses the cron expressions used by the scheduled archive modules.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression with 5 fields: minute hour day-of-month month day-of-week.
+// Each field supports "*", lists "1,2", ranges "1-5" and steps "*/10" or "1-30/5".
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// the day matches either day-of-month or day-of-week when both are restricted
+	domAny, dowAny bool
+}
+
+var aliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// Parse parses a cron expression, the aliases @hourly, @daily, @weekly, @monthly
+// and @yearly are supported.
+func Parse(expr string) (*Schedule, error) {
+	if alias, ok := aliases[strings.TrimSpace(expr)]; ok {
+		expr = alias
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule: %s, should have 5 fields", expr)
+	}
+
+	s := new(Schedule)
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid schedule minute: %v", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid schedule hour: %v", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid schedule day of month: %v", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid schedule month: %v", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid schedule day of week: %v", err)
+	}
+	// both 0 and 7 are sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domAny = fields[2] == "*"
+	s.dowAny = fields[4] == "*"
+	return s, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			v, err := strconv.Atoi(after)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid step: %s", part)
+			}
+			part, step = before, v
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			before, after, isRange := strings.Cut(part, "-")
+			v, err := strconv.Atoi(before)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value: %s", part)
+			}
+			lo, hi = v, v
+			if isRange {
+				if hi, err = strconv.Atoi(after); err != nil {
+					return 0, fmt.Errorf("invalid range: %s", part)
+				}
+			} else if step > 1 {
+				// "5/10" means from 5 to max every 10
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range [%d, %d]: %s", min, max, part)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Match reports whether the minute of t matches the schedule.
+func (s *Schedule) Match(t time.Time) bool {
+	return s.month&(1<<uint(t.Month())) != 0 && s.matchDay(t) &&
+		s.hour&(1<<uint(t.Hour())) != 0 && s.minute&(1<<uint(t.Minute())) != 0
+}
+
+// Next returns the first time matches the schedule after t, it is zero when
+// the schedule never matches.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// a valid schedule matches at least once in 5 years, e.g. Feb 29
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
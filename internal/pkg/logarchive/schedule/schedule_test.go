@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, 2, 28, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{name: "every minute", expr: "* * * * *", want: time.Date(2024, 2, 28, 10, 18, 0, 0, time.UTC)},
+		{name: "step", expr: "*/15 * * * *", want: time.Date(2024, 2, 28, 10, 30, 0, 0, time.UTC)},
+		{name: "daily alias", expr: "@daily", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "list and range", expr: "0 3,4-6 * * *", want: time.Date(2024, 2, 29, 3, 0, 0, 0, time.UTC)},
+		{name: "day of month", expr: "30 2 1 * *", want: time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC)},
+		{name: "sunday as 7", expr: "0 0 * * 7", want: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", expr: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", expr: "0 0 15 * 5", want: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, s.Next(base))
+		})
+	}
+}
+
+func TestScheduleMatch(t *testing.T) {
+	s, err := Parse("* 0-5 * * 1-5")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// 2024-02-28 is wednesday and 2024-03-02 is saturday
+	assert.True(t, s.Match(time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, s.Match(time.Date(2024, 2, 28, 5, 59, 59, 0, time.UTC)))
+	assert.False(t, s.Match(time.Date(2024, 2, 28, 6, 0, 0, 0, time.UTC)))
+	assert.False(t, s.Match(time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC)))
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,116 @@
+package logarchive
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// ValidateResult is the result of a component of the configuration.
+type ValidateResult struct {
+	// Component is one of "config", "log", "metric", "alert", "quota", "audit", "hook" and "archive"
+	Component string `json:"component"`
+	// Name is the name of the archive, or the index of the hook
+	Name  string `json:"name,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ValidateReport is the report of Validate.
+type ValidateReport struct {
+	Results []ValidateResult `json:"results"`
+}
+
+// Failed returns the number of the components failed to validate.
+func (r *ValidateReport) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *ValidateReport) add(component, name string, err error) {
+	res := ValidateResult{Component: component, Name: name}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	r.Results = append(r.Results, res)
+}
+
+// Validate provisions and validates the modules of the configuration without
+// starting them. All archives are checked even if some of them failed, so that
+// all problems are reported at once. The modules may still touch the environment
+// while provisioning, e.g. the directories to write are created and the cos
+// buckets are checked.
+func Validate(cfg []byte) *ValidateReport {
+	report := new(ValidateReport)
+
+	newCfg := new(Config)
+	if err := json.Unmarshal(cfg, newCfg); err != nil {
+		report.add("config", "", err)
+		return report
+	}
+
+	ctx, cancel := NewContext(Context{Context: context.Background(), cfg: newCfg})
+	defer cancel()
+	newCfg.cancelFunc = cancel
+	newCfg.events = newEventBus()
+	defer newCfg.events.Close()
+
+	if newCfg.Logging == nil {
+		newCfg.Logging = new(Logging)
+	}
+	err := newCfg.Logging.Provision(ctx)
+	report.add("log", "", err)
+	if err != nil {
+		return report
+	}
+	// the logs of the modules are not written into the log of the running process
+	newCfg.Logging.logger = zap.NewNop()
+
+	if newCfg.Metric != nil {
+		report.add("metric", "", newCfg.Metric.Provision(ctx))
+	}
+	if newCfg.Alert != nil {
+		report.add("alert", "", newCfg.Alert.Provision(ctx))
+	}
+	if newCfg.Quota != nil {
+		report.add("quota", "", newCfg.Quota.Provision(ctx))
+	}
+	if newCfg.Audit != nil {
+		report.add("audit", "", newCfg.Audit.Provision(ctx))
+	}
+	for i, h := range newCfg.Hooks {
+		report.add("hook", strconv.Itoa(i), h.Provision(ctx))
+	}
+
+	names := make([]string, 0, len(newCfg.ArchivesRaw))
+	for name := range newCfg.ArchivesRaw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	newCfg.archives = make(map[string]Archive)
+	for _, name := range names {
+		_, err := ctx.Archive(name)
+		report.add("archive", name, err)
+	}
+
+	if !newCfg.AllowOverlap {
+		// the overlap is reported only if found, it is not a component
+		if err := checkPathOverlap(newCfg.archives); err != nil {
+			report.add("config", "", err)
+		}
+	}
+
+	// release the resources acquired by provisioning, e.g. the file watchers
+	for _, ar := range newCfg.archives {
+		_ = ar.Stop()
+	}
+	return report
+}
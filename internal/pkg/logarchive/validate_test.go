@@ -0,0 +1,69 @@
+package logarchive_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/atframework/atdtool/internal/pkg/logarchive"
+)
+
+func TestValidate(t *testing.T) {
+	logarchive.RegisterModuleForTest(fakeOutput{})
+	t.Cleanup(logarchive.ResetModulesForTest)
+
+	dir := filepath.ToSlash(t.TempDir())
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	report := logarchive.Validate([]byte(fmt.Sprintf(`{
+  "log": {"level": "error"},
+  "archives": {
+    "file": {
+      "paths": [%q],
+      "collectRule": {"keepSourceFile": true},
+      "output": {"type": "fake"}
+    }
+  }
+}`, dir+"/logs")))
+	assert.Equal(t, []logarchive.ValidateResult{
+		{Component: "log"},
+		{Component: "archive", Name: "file"},
+	}, report.Results)
+	assert.Equal(t, 0, report.Failed())
+
+	// all archives are checked even if some of them failed
+	report = logarchive.Validate([]byte(fmt.Sprintf(`{
+  "log": {"level": "error"},
+  "archives": {
+    "file": {
+      "paths": [%[1]q],
+      "excludeFiles": ["("],
+      "output": {"type": "fake"}
+    },
+    "exec": {
+      "paths": [%[1]q],
+      "output": {"type": "fake"}
+    },
+    "unknown": {}
+  }
+}`, dir+"/logs")))
+	if assert.Len(t, report.Results, 4) {
+		assert.Equal(t, "exec", report.Results[1].Name)
+		assert.Contains(t, report.Results[1].Error, "exec command is required")
+		assert.Equal(t, "file", report.Results[2].Name)
+		assert.Contains(t, report.Results[2].Error, "error parsing regexp")
+		assert.Equal(t, "unknown", report.Results[3].Name)
+		assert.Contains(t, report.Results[3].Error, "unknown module")
+	}
+	assert.Equal(t, 3, report.Failed())
+
+	report = logarchive.Validate([]byte(`{"archives": `))
+	if assert.Len(t, report.Results, 1) {
+		assert.Equal(t, "config", report.Results[0].Component)
+	}
+}
@@ -0,0 +1,117 @@
+package noncloudnative
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultBusAddrMask is the bit widths of the numeric bus address when
+// bus_addr_mask is not set in deploy.yaml, the same as the id mask of atapp.
+const DefaultBusAddrMask = "8.8.8.8"
+
+// The segments of the bus address world.zone.type.instance.
+var busAddrSegments = []string{"world", "zone", "type", "instance"}
+
+// BusAddrMask is the bit widths of the world, zone, type and instance ids in
+// the numeric bus address, from the highest bits to the lowest.
+type BusAddrMask [4]uint
+
+// ParseBusAddrMask parses the mask like "8.8.8.8".
+func ParseBusAddrMask(s string) (BusAddrMask, error) {
+	var m BusAddrMask
+	vs := strings.Split(strings.TrimSpace(s), ".")
+	if len(vs) != len(m) {
+		return m, fmt.Errorf("bus address mask: %s is illegal, should be a.b.c.d", s)
+	}
+
+	var total uint
+	for i, v := range vs {
+		bits, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || bits == 0 {
+			return m, fmt.Errorf("bus address mask: %s is illegal, invalid bits %s", s, v)
+		}
+		m[i] = uint(bits)
+		total += m[i]
+	}
+	if total > 64 {
+		return m, fmt.Errorf("bus address mask: %s is illegal, more than 64 bits", s)
+	}
+	return m, nil
+}
+
+// Shift returns the shift of the segment, which is world, zone, type or instance.
+func (m BusAddrMask) Shift(segment string) (uint, error) {
+	for i, name := range busAddrSegments {
+		if name != segment {
+			continue
+		}
+		var shift uint
+		for _, bits := range m[i+1:] {
+			shift += bits
+		}
+		return shift, nil
+	}
+	return 0, fmt.Errorf("unknown bus address segment: %s, should be one of %s", segment, strings.Join(busAddrSegments, ", "))
+}
+
+// Pack returns the numeric bus address of the ids, each id must fit in the
+// bits of its segment.
+func (m BusAddrMask) Pack(ids [4]uint64) (uint64, error) {
+	var id uint64
+	for i, v := range ids {
+		if v >= 1<<m[i] {
+			return 0, fmt.Errorf("%s id %d exceeds %d bits", busAddrSegments[i], v, m[i])
+		}
+		id = id<<m[i] | v
+	}
+	return id, nil
+}
+
+// Mask returns the bus address mask of the deploy configuration.
+func (d *DeployConf) Mask() (BusAddrMask, error) {
+	if d.BusAddrMask == "" {
+		return ParseBusAddrMask(DefaultBusAddrMask)
+	}
+	return ParseBusAddrMask(d.BusAddrMask)
+}
+
+// FuncID returns the type id of the chart in proc_desc.
+func (d *DeployConf) FuncID(name string) (uint64, error) {
+	for _, u := range d.Instance {
+		if u.Name != name {
+			continue
+		}
+		id, err := strconv.ParseUint(u.TypeId, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("instance_type_id of chart %s is not a number: %s", name, u.TypeId)
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("chart %s not found in proc_desc", name)
+}
+
+// ParseBusAddr parses the bus address world.zone.type.instance.
+func ParseBusAddr(addr string) ([4]uint64, error) {
+	var ids [4]uint64
+	vs, err := parseBusAddr(addr)
+	if err != nil {
+		return ids, err
+	}
+	copy(ids[:], vs)
+	return ids, nil
+}
+
+// BusAddrIds converts the ids of the world, zone, type and instance, which
+// could be any integer types or strings.
+func BusAddrIds(world, zone, typeID, instance any) ([4]uint64, error) {
+	var ids [4]uint64
+	for i, v := range []any{world, zone, typeID, instance} {
+		id, ok := toUint64(v)
+		if !ok {
+			return ids, fmt.Errorf("invalid %s id: %v", busAddrSegments[i], v)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,64 @@
+package noncloudnative
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBusAddrMask(t *testing.T) {
+	m, err := ParseBusAddrMask("10.10.16.16")
+	if assert.NoError(t, err) {
+		assert.Equal(t, BusAddrMask{10, 10, 16, 16}, m)
+	}
+
+	for _, s := range []string{"8.8.8", "8.8.8.0", "8.a.8.8", "32.32.1.1"} {
+		_, err := ParseBusAddrMask(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBusAddrMask(t *testing.T) {
+	m, err := ParseBusAddrMask("10.10.16.16")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for segment, want := range map[string]uint{"world": 42, "zone": 32, "type": 16, "instance": 0} {
+		shift, err := m.Shift(segment)
+		assert.NoError(t, err)
+		assert.Equal(t, want, shift, segment)
+	}
+	_, err = m.Shift("region")
+	assert.Error(t, err)
+
+	id, err := m.Pack([4]uint64{1, 2, 42, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1)<<42|uint64(2)<<32|uint64(42)<<16|3, id)
+
+	_, err = m.Pack([4]uint64{1024, 2, 42, 3})
+	assert.ErrorContains(t, err, "world id 1024 exceeds 10 bits")
+}
+
+func TestDeployConfAddressing(t *testing.T) {
+	d := &DeployConf{Instance: []*DeployUnit{{Name: "gamesvr", TypeId: "12"}, {Name: "bad", TypeId: "x"}}}
+
+	m, err := d.Mask()
+	if assert.NoError(t, err) {
+		assert.Equal(t, BusAddrMask{8, 8, 8, 8}, m)
+	}
+
+	id, err := d.FuncID("gamesvr")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(12), id)
+	_, err = d.FuncID("bad")
+	assert.Error(t, err)
+	_, err = d.FuncID("nonexistence")
+	assert.Error(t, err)
+
+	ids, err := BusAddrIds(1, "2", uint64(3), 4.0)
+	assert.NoError(t, err)
+	assert.Equal(t, [4]uint64{1, 2, 3, 4}, ids)
+	_, err = BusAddrIds(1, 2, -3, 4)
+	assert.Error(t, err)
+}
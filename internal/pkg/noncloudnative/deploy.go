@@ -1,6 +1,7 @@
 package noncloudnative
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -20,6 +21,135 @@ type DeployConf struct {
 	WorldID  uint64        `json:"world_id"`
 	ZoneId   uint64        `json:"zone_id"`
 	Instance []*DeployUnit `json:"proc_desc"`
+	// Worlds describes multiple worlds in one deploy.yaml, when it is not empty
+	// WorldID and ZoneId are ignored and Instance is the default of each world
+	Worlds []*WorldConf `json:"worlds,omitempty"`
+	// BusAddrMask is the bit widths of the numeric bus address, DefaultBusAddrMask if it is empty
+	BusAddrMask string `json:"bus_addr_mask,omitempty"`
+}
+
+// WorldConf is a world in the multi-world deploy.yaml.
+type WorldConf struct {
+	WorldID  uint64       `json:"world_id"`
+	Zones    []ZoneRange  `json:"zones"`
+	Override []*UnitPatch `json:"proc_desc,omitempty"`
+}
+
+// UnitPatch overrides the instance settings of a chart in a world.
+type UnitPatch struct {
+	Name            string  `json:"chart_name"`
+	InstanceCount   *uint64 `json:"instance_count,omitempty"`
+	StartInstanceId *uint64 `json:"start_instance_id,omitempty"`
+}
+
+// ZoneRange is a zone id or a range of zone ids like "1-3".
+type ZoneRange struct {
+	Start uint64
+	End   uint64
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (z *ZoneRange) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, "\"") {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	s = strings.TrimSpace(s)
+	before, after, isRange := strings.Cut(s, "-")
+	start, err := strconv.ParseUint(strings.TrimSpace(before), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid zone: %s", s)
+	}
+
+	end := start
+	if isRange {
+		end, err = strconv.ParseUint(strings.TrimSpace(after), 10, 64)
+		if err != nil || end < start {
+			return fmt.Errorf("invalid zone range: %s", s)
+		}
+	}
+	z.Start, z.End = start, end
+	return nil
+}
+
+// DeployTarget is a world/zone with the instances deployed in it.
+type DeployTarget struct {
+	WorldID  uint64
+	ZoneId   uint64
+	Instance []*DeployUnit
+}
+
+// Targets expands the deploy configuration into world/zone targets. The world
+// instances are deployed only once in each world, with the first zone.
+func (d *DeployConf) Targets() ([]*DeployTarget, error) {
+	if len(d.Worlds) == 0 {
+		return []*DeployTarget{{WorldID: d.WorldID, ZoneId: d.ZoneId, Instance: d.Instance}}, nil
+	}
+
+	var targets []*DeployTarget
+	for _, w := range d.Worlds {
+		units, err := d.worldUnits(w)
+		if err != nil {
+			return nil, fmt.Errorf("world %d: %v", w.WorldID, err)
+		}
+
+		if len(w.Zones) == 0 {
+			return nil, fmt.Errorf("world %d: zones is required", w.WorldID)
+		}
+
+		first := true
+		for _, z := range w.Zones {
+			for zoneID := z.Start; zoneID <= z.End; zoneID++ {
+				t := &DeployTarget{WorldID: w.WorldID, ZoneId: zoneID}
+				for _, u := range units {
+					if u.WorldInstance && !first {
+						continue
+					}
+					t.Instance = append(t.Instance, u)
+				}
+				targets = append(targets, t)
+				first = false
+			}
+		}
+	}
+	return targets, nil
+}
+
+// BusAddr returns the bus address of an instance of the unit in the target,
+// the world instances are addressed with zone 0.
+func (t *DeployTarget) BusAddr(u *DeployUnit, instanceID uint64) string {
+	zoneID := t.ZoneId
+	if u.WorldInstance {
+		zoneID = 0
+	}
+	return fmt.Sprintf("%d.%d.%s.%d", t.WorldID, zoneID, u.TypeId, instanceID)
+}
+
+func (d *DeployConf) worldUnits(w *WorldConf) ([]*DeployUnit, error) {
+	units := make([]*DeployUnit, 0, len(d.Instance))
+	index := make(map[string]int, len(d.Instance))
+	for _, u := range d.Instance {
+		copied := *u
+		index[u.Name] = len(units)
+		units = append(units, &copied)
+	}
+
+	for _, p := range w.Override {
+		i, ok := index[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("chart %s not found in proc_desc", p.Name)
+		}
+		if p.InstanceCount != nil {
+			units[i].InstanceCount = *p.InstanceCount
+		}
+		if p.StartInstanceId != nil {
+			units[i].StartInstanceId = *p.StartInstanceId
+		}
+	}
+	return units, nil
 }
 
 func loadDeployData(filename string) (interface{}, error) {
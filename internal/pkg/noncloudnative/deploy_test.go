@@ -1,6 +1,9 @@
 package noncloudnative
 
 import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -67,3 +70,112 @@ func TestParseBusAddr(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestDeployConfTargets(t *testing.T) {
+	t.Run("single world", func(t *testing.T) {
+		d := &DeployConf{WorldID: 1, ZoneId: 2, Instance: []*DeployUnit{{Name: "echo", InstanceCount: 1}}}
+		targets, err := d.Targets()
+		if !assert.NoError(t, err) {
+			return
+		}
+		if assert.Len(t, targets, 1) {
+			assert.Equal(t, uint64(1), targets[0].WorldID)
+			assert.Equal(t, uint64(2), targets[0].ZoneId)
+			assert.Equal(t, d.Instance, targets[0].Instance)
+		}
+	})
+
+	t.Run("multiple worlds", func(t *testing.T) {
+		rs, err := loadDeployData(filepath.Join("testdata", "multiworld", "deploy.yaml"))
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		targets, err := rs.(*DeployConf).Targets()
+		if !assert.NoError(t, err) || !assert.Len(t, targets, 4) {
+			return
+		}
+
+		var got []string
+		for _, target := range targets {
+			for _, u := range target.Instance {
+				got = append(got, fmt.Sprintf("%d.%d:%s*%d", target.WorldID, target.ZoneId, u.Name, u.InstanceCount))
+			}
+		}
+		// the world instance is only deployed with the first zone of each world
+		assert.Equal(t, []string{
+			"1.1:logic*1", "1.1:router*1",
+			"1.2:logic*1",
+			"1.3:logic*1",
+			"2.7:logic*3", "2.7:router*1",
+		}, got)
+	})
+
+	t.Run("override does not modify defaults", func(t *testing.T) {
+		count := uint64(5)
+		d := &DeployConf{
+			Instance: []*DeployUnit{{Name: "echo", InstanceCount: 1}},
+			Worlds: []*WorldConf{
+				{WorldID: 1, Zones: []ZoneRange{{Start: 1, End: 1}}, Override: []*UnitPatch{{Name: "echo", InstanceCount: &count}}},
+				{WorldID: 2, Zones: []ZoneRange{{Start: 1, End: 1}}},
+			},
+		}
+		targets, err := d.Targets()
+		if !assert.NoError(t, err) || !assert.Len(t, targets, 2) {
+			return
+		}
+		assert.Equal(t, uint64(5), targets[0].Instance[0].InstanceCount)
+		assert.Equal(t, uint64(1), targets[1].Instance[0].InstanceCount)
+		assert.Equal(t, uint64(1), d.Instance[0].InstanceCount)
+	})
+
+	t.Run("reject unknown chart override", func(t *testing.T) {
+		d := &DeployConf{
+			Instance: []*DeployUnit{{Name: "echo"}},
+			Worlds:   []*WorldConf{{WorldID: 1, Zones: []ZoneRange{{Start: 1, End: 1}}, Override: []*UnitPatch{{Name: "missing"}}}},
+		}
+		_, err := d.Targets()
+		assert.ErrorContains(t, err, "chart missing not found")
+	})
+
+	t.Run("reject world without zones", func(t *testing.T) {
+		d := &DeployConf{Worlds: []*WorldConf{{WorldID: 1}}}
+		_, err := d.Targets()
+		assert.ErrorContains(t, err, "zones is required")
+	})
+}
+
+func TestZoneRangeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    ZoneRange
+		wantErr bool
+	}{
+		{name: "number", input: `3`, want: ZoneRange{Start: 3, End: 3}},
+		{name: "string", input: `"3"`, want: ZoneRange{Start: 3, End: 3}},
+		{name: "range", input: `"1 - 4"`, want: ZoneRange{Start: 1, End: 4}},
+		{name: "reversed range", input: `"4-1"`, wantErr: true},
+		{name: "invalid", input: `"x"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ZoneRange
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDeployTargetBusAddr(t *testing.T) {
+	target := &DeployTarget{WorldID: 3, ZoneId: 17}
+	assert.Equal(t, "3.17.11.2", target.BusAddr(&DeployUnit{TypeId: "11"}, 2))
+	assert.Equal(t, "3.0.12.1", target.BusAddr(&DeployUnit{TypeId: "12", WorldInstance: true}, 1))
+}
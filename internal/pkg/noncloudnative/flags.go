@@ -0,0 +1,149 @@
+package noncloudnative
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FlagsKey is the values key of the feature flags.
+const FlagsKey = "flags"
+
+// ResolveFlags resolves the feature flags in values into concrete booleans of
+// the instance. A flag can be a plain boolean or a rule:
+//
+//	flags:
+//	  new_login:
+//	    enabled: true      # optional, false turns the flag off everywhere
+//	    stages: [dev, test] # optional, allowlist of .Values.stage
+//	    worlds: [1, 2]      # optional, allowlist of .Values.world_id
+//	    percentage: 30      # optional, 0-100, defaults to 100
+//
+// The percentage rollout is deterministic by the hash of the flag name and the
+// bus address, so an instance always gets the same result across renderings.
+func ResolveFlags(values map[string]any) error {
+	v, ok := values[FlagsKey]
+	if !ok || v == nil {
+		return nil
+	}
+
+	flags, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("invalid %s value type: %T", FlagsKey, v)
+	}
+
+	resolved := make(map[string]any, len(flags))
+	for name, flag := range flags {
+		on, err := resolveFlag(name, flag, values)
+		if err != nil {
+			return fmt.Errorf("resolve flag(%s): %v", name, err)
+		}
+		resolved[name] = on
+	}
+	values[FlagsKey] = resolved
+	return nil
+}
+
+func resolveFlag(name string, flag any, values map[string]any) (bool, error) {
+	switch f := flag.(type) {
+	case bool:
+		return f, nil
+	case map[string]any:
+		if v, ok := f["enabled"]; ok {
+			enabled, ok := v.(bool)
+			if !ok {
+				return false, fmt.Errorf("enabled must be a boolean")
+			}
+			if !enabled {
+				return false, nil
+			}
+		}
+
+		if v, ok := f["stages"]; ok {
+			stages, ok := v.([]any)
+			if !ok {
+				return false, fmt.Errorf("stages must be a list")
+			}
+			stage := fmt.Sprint(values["stage"])
+			if !containsFlagValue(stages, func(s any) bool { return fmt.Sprint(s) == stage }) {
+				return false, nil
+			}
+		}
+
+		if v, ok := f["worlds"]; ok {
+			worlds, ok := v.([]any)
+			if !ok {
+				return false, fmt.Errorf("worlds must be a list")
+			}
+			worldID, ok := toUint64(values["world_id"])
+			if !ok {
+				return false, fmt.Errorf("world_id not found")
+			}
+			if !containsFlagValue(worlds, func(w any) bool {
+				id, ok := toUint64(w)
+				return ok && id == worldID
+			}) {
+				return false, nil
+			}
+		}
+
+		if v, ok := f["percentage"]; ok {
+			percentage, ok := toUint64(v)
+			if !ok || percentage > 100 {
+				return false, fmt.Errorf("percentage must be an integer between 0 and 100")
+			}
+			busAddr, ok := values["bus_addr"].(string)
+			if !ok {
+				return false, fmt.Errorf("bus_addr not found")
+			}
+			return flagBucket(name, busAddr) < percentage, nil
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("unsupported value type: %T", flag)
+	}
+}
+
+// flagBucket maps the instance into one of the 100 buckets of the flag.
+func flagBucket(name, busAddr string) uint64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name + "@" + busAddr))
+	return uint64(h.Sum32() % 100)
+}
+
+func containsFlagValue(list []any, match func(any) bool) bool {
+	for _, v := range list {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func toUint64(v any) (uint64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := strconv.ParseUint(n.String(), 10, 64)
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseUint(strings.TrimSpace(n), 10, 64)
+		return i, err == nil
+	case float64:
+		if n < 0 || n != float64(uint64(n)) {
+			return 0, false
+		}
+		return uint64(n), true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.CanUint() {
+		return rv.Uint(), true
+	}
+	if rv.CanInt() && rv.Int() >= 0 {
+		return uint64(rv.Int()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,82 @@
+package noncloudnative
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveFlags(t *testing.T) {
+	base := func(flag any) map[string]any {
+		return map[string]any{
+			"stage":    "dev",
+			"world_id": uint64(1),
+			"bus_addr": "1.2.42.3",
+			FlagsKey:   map[string]any{"f": flag},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		flag      any
+		want      bool
+		wantError bool
+	}{
+		{name: "plain true", flag: true, want: true},
+		{name: "plain false", flag: false, want: false},
+		{name: "empty rule", flag: map[string]any{}, want: true},
+		{name: "disabled", flag: map[string]any{"enabled": false, "stages": []any{"dev"}}, want: false},
+		{name: "stage allowed", flag: map[string]any{"stages": []any{"dev", "test"}}, want: true},
+		{name: "stage not allowed", flag: map[string]any{"stages": []any{"prod"}}, want: false},
+		{name: "world allowed", flag: map[string]any{"worlds": []any{json.Number("1")}}, want: true},
+		{name: "world not allowed", flag: map[string]any{"worlds": []any{int64(2)}}, want: false},
+		{name: "percentage 100", flag: map[string]any{"percentage": json.Number("100")}, want: true},
+		{name: "percentage 0", flag: map[string]any{"percentage": int64(0)}, want: false},
+		{name: "percentage out of range", flag: map[string]any{"percentage": int64(101)}, wantError: true},
+		{name: "invalid stages", flag: map[string]any{"stages": "dev"}, wantError: true},
+		{name: "invalid type", flag: "on", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := base(tt.flag)
+			err := ResolveFlags(values)
+			if tt.wantError {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, values[FlagsKey].(map[string]any)["f"])
+		})
+	}
+}
+
+func TestResolveFlagsPercentageIsDeterministic(t *testing.T) {
+	on := 0
+	for i := 0; i < 1000; i++ {
+		values := map[string]any{
+			"bus_addr": fmt.Sprintf("1.2.42.%d", i),
+			FlagsKey:   map[string]any{"f": map[string]any{"percentage": int64(30)}},
+		}
+		if !assert.NoError(t, ResolveFlags(values)) {
+			return
+		}
+		first := values[FlagsKey].(map[string]any)["f"].(bool)
+
+		values[FlagsKey] = map[string]any{"f": map[string]any{"percentage": int64(30)}}
+		if !assert.NoError(t, ResolveFlags(values)) {
+			return
+		}
+		assert.Equal(t, first, values[FlagsKey].(map[string]any)["f"])
+		if first {
+			on++
+		}
+	}
+
+	// roughly 30% of the instances are enabled
+	assert.InDelta(t, 300, on, 60)
+}
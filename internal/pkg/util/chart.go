@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/mitchellh/copystructure"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
@@ -15,18 +16,23 @@ import (
 )
 
 // MergeChartValues merges multiple sources of Helm chart values into a single values map
-func MergeChartValues(chartPath string, valuesPaths []string, optVals map[string]any, nonCloudNativeVal *noncloudnative.RenderValue) (values map[string]any, err error) {
+func MergeChartValues(chartPath string, valuesPaths []string, mergeOpts MergeOptions, optVals map[string]any, nonCloudNativeVal *noncloudnative.RenderValue) (values map[string]any, err error) {
 	var chrt *chart.Chart
-	chrt, err = loader.Load(chartPath)
+	chrt, err = loader.Load(LongPath(chartPath))
 	if err != nil {
 		return
 	}
+	return MergeLoadedChartValues(chrt, valuesPaths, mergeOpts, optVals, nonCloudNativeVal)
+}
 
-	name := chrt.Name()
-	if n, ok := chrt.Values["type_name"]; ok {
-		name = n.(string)
-	} else if n, ok := chrt.Values["func_name"]; ok {
-		name = n.(string)
+// MergeLoadedChartValues is the same as MergeChartValues, but the chart is loaded
+// by the caller, so that it could be shared by the instances. The chart is not
+// modified, it could be used concurrently.
+func MergeLoadedChartValues(chrt *chart.Chart, valuesPaths []string, mergeOpts MergeOptions, optVals map[string]any, nonCloudNativeVal *noncloudnative.RenderValue) (values map[string]any, err error) {
+	name := serviceValuesName(chrt)
+	lm, err := newListMerger(mergeOpts.ListMerge)
+	if err != nil {
+		return
 	}
 
 	values = make(map[string]any)
@@ -35,28 +41,36 @@ func MergeChartValues(chartPath string, valuesPaths []string, optVals map[string
 		// load global replace configuration
 		filename := chartutil.GlobalKey + ".yaml"
 		if FileExist(filepath.Join(p, filename)) {
-			m := make(map[string]any)
-			err = yamlparser.LoadConfig(filepath.Join(p, filename), &m)
+			var m map[string]any
+			m, err = loadValuesFile(filepath.Join(p, filename), mergeOpts.ValuesOptions)
 			if err != nil {
 				return
 			}
-			globalVals = chartutil.CoalesceTables(m, globalVals)
+			globalVals = lm.coalesceTables(m, globalVals)
 		}
 
 		// load service replace configuration
 		filename = name + ".yaml"
 		if FileExist(filepath.Join(p, filename)) {
-			m := make(map[string]any)
-			err = yamlparser.LoadConfig(filepath.Join(p, filename), &m)
+			var m map[string]any
+			m, err = loadValuesFile(filepath.Join(p, filename), mergeOpts.ValuesOptions)
 			if err != nil {
 				return
 			}
-			values = chartutil.CoalesceTables(m, values)
+			values = lm.coalesceTables(m, values)
 		}
 	}
 
-	values = chartutil.CoalesceTables(values, chrt.Values)
-	values = chartutil.CoalesceTables(values, globalVals)
+	// the nested tables are merged in place, the defaults of the chart are copied
+	var chartVals any
+	chartVals, err = copystructure.Copy(chrt.Values)
+	if err != nil {
+		return
+	}
+	if m, ok := chartVals.(map[string]any); ok {
+		values = lm.coalesceTables(values, m)
+	}
+	values = lm.coalesceTables(values, globalVals)
 
 	if nonCloudNativeVal != nil {
 		if nonCloudNativeVal.Config == nil {
@@ -69,21 +83,60 @@ func MergeChartValues(chartPath string, valuesPaths []string, optVals map[string
 		if err != nil {
 			return
 		}
-		values = chartutil.CoalesceTables(m, values)
+		values = lm.coalesceTables(m, values)
 	}
 
 	// command line options has higher precedence
 	if optVals != nil {
-		values = chartutil.CoalesceTables(optVals, values)
+		values = lm.coalesceTables(optVals, values)
+	}
+
+	values, err = mergeEnabledModuleValues(valuesPaths, mergeOpts.ValuesOptions, lm, values)
+	if err != nil {
+		return
+	}
+
+	// the merge directives are not a part of the values
+	if err = removeMergeDirectives(values); err != nil {
+		return
 	}
 
-	values, err = mergeEnabledModuleValues(valuesPaths, values)
+	// feature flags are resolved per instance
+	if nonCloudNativeVal != nil {
+		if err = noncloudnative.ResolveFlags(values); err != nil {
+			return
+		}
+	}
+
+	// validate the final values before rendering like Helm
+	if len(chrt.Schema) != 0 {
+		err = ValidateValues(chrt.Name(), chrt.Schema, values)
+	}
 	return
 }
 
-// merge enabled module values
-func mergeEnabledModuleValues(valuesPaths []string, dst map[string]any) (map[string]any, error) {
-	moduleVals := make(map[string]any)
+// loadValuesFile loads the values file, the environment variables are expanded
+// and the SOPS-encrypted file is decrypted by the options.
+func loadValuesFile(name string, valuesOpts yamlparser.ValuesOptions) (map[string]any, error) {
+	m, err := yamlparser.LoadValues(name, valuesOpts)
+	if err != nil {
+		return nil, fmt.Errorf("load values file(%s): %v", name, err)
+	}
+	return m, nil
+}
+
+// serviceValuesName returns the name of the service values file of the chart.
+func serviceValuesName(chrt *chart.Chart) string {
+	if n, ok := chrt.Values["type_name"]; ok {
+		return n.(string)
+	} else if n, ok := chrt.Values["func_name"]; ok {
+		return n.(string)
+	}
+	return chrt.Name()
+}
+
+// walkModuleValues loads the module values files of the values paths in order.
+func walkModuleValues(valuesPaths []string, valuesOpts yamlparser.ValuesOptions, fn func(valuesPath, path, moduleName string, val map[string]any)) error {
 	for _, p := range valuesPaths {
 		modulesPath := filepath.Join(p, "modules")
 		if PathExist(modulesPath) {
@@ -96,54 +149,166 @@ func mergeEnabledModuleValues(valuesPaths []string, dst map[string]any) (map[str
 					return nil
 				}
 
-				moduleName := strings.TrimSuffix(d.Name(), ".yaml")
-				val := make(map[string]any)
-				if err := yamlparser.LoadConfig(path, &val); err != nil {
+				val, err := loadValuesFile(path, valuesOpts)
+				if err != nil {
 					return err
 				}
-
-				m := make(map[string]any)
-				m[moduleName] = val
-				moduleVals = chartutil.CoalesceTables(m, moduleVals)
+				fn(p, path, strings.TrimSuffix(d.Name(), ".yaml"), val)
 				return nil
 			})
 			if walkErr != nil {
-				return nil, fmt.Errorf("walking the path(%q):%v", modulesPath, walkErr)
+				return fmt.Errorf("walking the path(%q):%v", modulesPath, walkErr)
 			}
 		}
 	}
+	return nil
+}
+
+// moduleEnabled reports whether the module is enabled by the merged values dst,
+// or by its own values m if the flag is not specified.
+func moduleEnabled(dst map[string]any, name string, m map[string]any) bool {
+	if val, ok := dst[name].(map[string]any); ok {
+		if flag, ok := val["enabled"].(bool); ok {
+			return flag
+		}
+	}
+
+	// the module enable flag is not specified,
+	// if it enabled by default, we will still load it
+	flag, _ := m["enabled"].(bool)
+	return flag
+}
+
+// merge enabled module values
+func mergeEnabledModuleValues(valuesPaths []string, valuesOpts yamlparser.ValuesOptions, lm *listMerger, dst map[string]any) (map[string]any, error) {
+	moduleVals := make(map[string]any)
+	err := walkModuleValues(valuesPaths, valuesOpts, func(_, _, moduleName string, val map[string]any) {
+		m := make(map[string]any)
+		m[moduleName] = val
+		moduleVals = lm.coalesceTables(m, moduleVals)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	for k, v := range moduleVals {
 		m, ok := v.(map[string]any)
 		if !ok {
 			return nil, fmt.Errorf("invalid module(%s) value type", k)
 		}
+		if !moduleEnabled(dst, k, m) {
+			delete(moduleVals, k)
+		}
+	}
 
-		moduleEnabled := false
-		if val, ok := dst[k].(map[string]any); ok {
-			if flag, ok := val["enabled"].(bool); ok {
-				// module disabled
-				if !flag {
-					delete(moduleVals, k)
-					continue
-				}
-				moduleEnabled = true
+	dst = lm.coalesceTables(dst, moduleVals)
+	return dst, nil
+}
+
+// The kinds of the values sources.
+const (
+	ValuesSourceModule  = "module"
+	ValuesSourceGlobal  = "global"
+	ValuesSourceChart   = "chart"
+	ValuesSourceService = "service"
+	ValuesSourceSet     = "set"
+)
+
+// ValuesSource is one of the sources merged by MergeLoadedChartValues.
+type ValuesSource struct {
+	Kind string
+	// File is the values file, it is empty for the chart defaults and the
+	// command line values
+	File string
+	// ValuesPath is the values path of the file
+	ValuesPath string
+	// Values are the values of the source, the values of a module are nested
+	// under the module name
+	Values map[string]any
+}
+
+// ChartValuesSources returns the sources of the chart values from the lowest
+// precedence to the highest, in the same order as MergeLoadedChartValues merges
+// them without the runtime values. Only the enabled modules are returned.
+func ChartValuesSources(chrt *chart.Chart, valuesPaths []string, mergeOpts MergeOptions, optVals map[string]any) ([]*ValuesSource, error) {
+	name := serviceValuesName(chrt)
+	var globals, services []*ValuesSource
+	for _, p := range valuesPaths {
+		for _, src := range []struct {
+			kind string
+			file string
+			dst  *[]*ValuesSource
+		}{
+			{ValuesSourceGlobal, chartutil.GlobalKey + ".yaml", &globals},
+			{ValuesSourceService, name + ".yaml", &services},
+		} {
+			file := filepath.Join(p, src.file)
+			if !FileExist(file) {
+				continue
 			}
+			m, err := loadValuesFile(file, mergeOpts.ValuesOptions)
+			if err != nil {
+				return nil, err
+			}
+			*src.dst = append(*src.dst, &ValuesSource{Kind: src.kind, File: file, ValuesPath: p, Values: m})
 		}
+	}
 
-		// the module enable flag is not specified,
-		// if it enabled by default, we will still load it
-		if !moduleEnabled {
-			if flag, ok := m["enabled"].(bool); ok {
-				moduleEnabled = flag
-			}
+	chartVals, err := copystructure.Copy(chrt.Values)
+	if err != nil {
+		return nil, err
+	}
+	defaults, _ := chartVals.(map[string]any)
+
+	sources := make([]*ValuesSource, 0, len(globals)+len(services)+2)
+	sources = append(sources, globals...)
+	sources = append(sources, &ValuesSource{Kind: ValuesSourceChart, Values: defaults})
+	sources = append(sources, services...)
+	if len(optVals) != 0 {
+		// the command line values are merged in place by MergeLoadedChartValues
+		c, err := copystructure.Copy(optVals)
+		if err != nil {
+			return nil, err
 		}
+		sources = append(sources, &ValuesSource{Kind: ValuesSourceSet, Values: c.(map[string]any)})
+	}
 
-		if !moduleEnabled {
-			delete(moduleVals, k)
+	// the modules are enabled by the values merged without them
+	merged := make(map[string]any)
+	for _, src := range sources {
+		c, err := copystructure.Copy(src.Values)
+		if err != nil {
+			return nil, err
+		}
+		if m, ok := c.(map[string]any); ok {
+			merged = chartutil.CoalesceTables(m, merged)
 		}
 	}
 
-	dst = chartutil.CoalesceTables(dst, moduleVals)
-	return dst, nil
+	var modules []*ValuesSource
+	moduleVals := make(map[string]map[string]any)
+	err = walkModuleValues(valuesPaths, mergeOpts.ValuesOptions, func(valuesPath, path, moduleName string, val map[string]any) {
+		c, _ := copystructure.Copy(val)
+		m, _ := c.(map[string]any)
+		moduleVals[moduleName] = chartutil.CoalesceTables(m, moduleVals[moduleName])
+		modules = append(modules, &ValuesSource{
+			Kind:       ValuesSourceModule,
+			File:       path,
+			ValuesPath: valuesPath,
+			Values:     map[string]any{moduleName: val},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make([]*ValuesSource, 0, len(modules)+len(sources))
+	for _, src := range modules {
+		for k := range src.Values {
+			if moduleEnabled(merged, k, moduleVals[k]) {
+				enabled = append(enabled, src)
+			}
+		}
+	}
+	return append(enabled, sources...), nil
 }
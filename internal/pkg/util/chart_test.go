@@ -1,13 +1,16 @@
 package util
 
 import (
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart/loader"
 
 	"github.com/atframework/atdtool/internal/pkg/noncloudnative"
+	yamlparser "github.com/atframework/atdtool/pkg/confparser/yaml"
 )
 
 func fixturePath(parts ...string) string {
@@ -29,7 +32,7 @@ func TestMergeChartValuesPrecedenceAndModules(t *testing.T) {
 	chartPath := fixturePath("charts", "basic")
 	valuesPaths := []string{fixturePath("values", "default"), fixturePath("values", "dev")}
 
-	got, err := MergeChartValues(chartPath, valuesPaths, nil, nil)
+	got, err := MergeChartValues(chartPath, valuesPaths, MergeOptions{}, nil, nil)
 	if !assert.NoError(t, err) {
 		return
 	}
@@ -63,6 +66,7 @@ func TestMergeChartValuesUsesTypeNameForServiceFile(t *testing.T) {
 	got, err := MergeChartValues(
 		fixturePath("charts", "alias-type"),
 		[]string{fixturePath("values", "default")},
+		MergeOptions{},
 		nil,
 		nil,
 	)
@@ -76,6 +80,7 @@ func TestMergeChartValuesUsesFuncNameForServiceFile(t *testing.T) {
 	got, err := MergeChartValues(
 		fixturePath("charts", "alias-func"),
 		[]string{fixturePath("values", "default")},
+		MergeOptions{},
 		nil,
 		nil,
 	)
@@ -90,7 +95,7 @@ func TestMergeChartValuesCommandLineOverridesAndCanDisableModule(t *testing.T) {
 	valuesPaths := []string{fixturePath("values", "default"), fixturePath("values", "dev")}
 
 	t.Run("command line has highest precedence", func(t *testing.T) {
-		got, err := MergeChartValues(chartPath, valuesPaths, map[string]any{
+		got, err := MergeChartValues(chartPath, valuesPaths, MergeOptions{}, map[string]any{
 			"shared": "cli",
 			"cache": map[string]any{
 				"from_module": "cli",
@@ -107,7 +112,7 @@ func TestMergeChartValuesCommandLineOverridesAndCanDisableModule(t *testing.T) {
 	})
 
 	t.Run("explicit disable skips module injection", func(t *testing.T) {
-		got, err := MergeChartValues(chartPath, valuesPaths, map[string]any{
+		got, err := MergeChartValues(chartPath, valuesPaths, MergeOptions{}, map[string]any{
 			"cache": map[string]any{
 				"enabled": false,
 			},
@@ -128,6 +133,7 @@ func TestMergeChartValuesWithNonCloudNativeValues(t *testing.T) {
 	got, err := MergeChartValues(
 		fixturePath("charts", "basic"),
 		[]string{fixturePath("values", "default")},
+		MergeOptions{},
 		nil,
 		&noncloudnative.RenderValue{
 			BusAddr: "3.4.5.6",
@@ -144,3 +150,114 @@ func TestMergeChartValuesWithNonCloudNativeValues(t *testing.T) {
 	assert.Equal(t, "3.4.5.6", got["bus_addr"])
 	assert.Equal(t, runtime.GOOS, got["atdtool_running_platform"])
 }
+
+func TestMergeChartValuesValidatesSchema(t *testing.T) {
+	chartPath := fixturePath("charts", "schema")
+
+	got, err := MergeChartValues(chartPath, nil, MergeOptions{}, map[string]any{"world_id": 3}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, got["world_id"])
+	}
+
+	_, err = MergeChartValues(chartPath, nil, MergeOptions{}, map[string]any{
+		"world_id": "3",
+		"zone_id":  0,
+		"log":      map[string]any{"level": "trace", "levle": "info"},
+	}, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "chart(schema)")
+		assert.Contains(t, err.Error(), "- /world_id: Invalid type. Expected: integer, given: string")
+		assert.Contains(t, err.Error(), "- /zone_id: Must be greater than or equal to 1")
+		assert.Contains(t, err.Error(), "- /log/level: ")
+		assert.Contains(t, err.Error(), "- /log/levle: Additional property levle is not allowed")
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	schema := []byte(`{"type": "object", "required": ["a/b"], "properties": {"list": {"type": "array", "items": {"type": "string"}}}}`)
+	err := ValidateValues("test", schema, map[string]any{"list": []any{"x", 1}})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "- /a~1b: a/b is required")
+		assert.Contains(t, err.Error(), "- /list/1: Invalid type")
+	}
+
+	assert.Error(t, ValidateValues("test", []byte(`{"type": 1}`), map[string]any{}))
+}
+
+func TestChartValuesSources(t *testing.T) {
+	chrt, err := loader.Load(fixturePath("charts", "basic"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	valuesPaths := []string{fixturePath("values", "default"), fixturePath("values", "dev")}
+	optVals := map[string]any{"shared": "set"}
+
+	sources, err := ChartValuesSources(chrt, valuesPaths, MergeOptions{}, optVals)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var kinds, files []string
+	for _, src := range sources {
+		kinds = append(kinds, src.Kind)
+		files = append(files, src.File)
+	}
+	assert.Equal(t, []string{
+		ValuesSourceModule, ValuesSourceModule,
+		ValuesSourceGlobal, ValuesSourceGlobal,
+		ValuesSourceChart,
+		ValuesSourceService, ValuesSourceService,
+		ValuesSourceSet,
+	}, kinds)
+	// the disabled module is not a source
+	assert.Equal(t, []string{
+		filepath.Join(valuesPaths[0], "modules", "cache.yaml"),
+		filepath.Join(valuesPaths[1], "modules", "cache.yaml"),
+		filepath.Join(valuesPaths[0], "global.yaml"),
+		filepath.Join(valuesPaths[1], "global.yaml"),
+		"",
+		filepath.Join(valuesPaths[0], "basic.yaml"),
+		filepath.Join(valuesPaths[1], "basic.yaml"),
+		"",
+	}, files)
+	assert.Equal(t, valuesPaths[1], sources[1].ValuesPath)
+	assert.Contains(t, sources[0].Values, "cache")
+
+	// the sources are not changed by merging the values
+	_, err = MergeLoadedChartValues(chrt, valuesPaths, MergeOptions{}, optVals, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"shared": "set"}, sources[len(sources)-1].Values)
+}
+
+func TestMergeChartValuesExpandEnv(t *testing.T) {
+	t.Setenv("UTIL_TEST_ENDPOINT", "10.0.0.1:8080")
+	dir := t.TempDir()
+	files := map[string]string{
+		"global.yaml":        "endpoint: ${UTIL_TEST_ENDPOINT}\n",
+		"basic.yaml":         "service_only: ${UTIL_TEST_NOT_SET:-service}\n",
+		"modules/cache.yaml": "enabled: true\nfrom_module: ${UTIL_TEST_ENDPOINT}\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := MergeChartValues(fixturePath("charts", "basic"), []string{dir}, MergeOptions{ValuesOptions: yamlparser.ValuesOptions{ExpandEnv: true}}, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "10.0.0.1:8080", got["endpoint"])
+	assert.Equal(t, "service", got["service_only"])
+	assert.Equal(t, "10.0.0.1:8080", asMap(t, got["cache"])["from_module"])
+
+	// the placeholders are kept without ExpandEnv
+	got, err = MergeChartValues(fixturePath("charts", "basic"), []string{dir}, MergeOptions{}, nil, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "${UTIL_TEST_ENDPOINT}", got["endpoint"])
+	}
+}
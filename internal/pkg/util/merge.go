@@ -0,0 +1,205 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	yamlparser "github.com/atframework/atdtool/pkg/confparser/yaml"
+)
+
+// The merge strategies of the lists.
+const (
+	// ListMergeReplace replaces the list of the lower precedence, the same as Helm
+	ListMergeReplace = "replace"
+	// ListMergeAppend appends the items to the list of the lower precedence
+	ListMergeAppend = "append"
+	// ListMergeByKey merges the tables with the same key field, "merge-by-key:id"
+	// uses the field id, the field is name by default. The other items are appended.
+	ListMergeByKey = "merge-by-key"
+)
+
+// mergeDirectiveKey is the key of the merge strategies of the lists in a table
+// of the values, e.g.
+//
+//	listen:
+//	  $merge:
+//	    ports: append
+//	  ports: [7003]
+const mergeDirectiveKey = "$merge"
+
+// defaultMergeKey is the key field of ListMergeByKey.
+const defaultMergeKey = "name"
+
+// MergeOptions are the options of merging the chart values.
+type MergeOptions struct {
+	yamlparser.ValuesOptions
+	// ListMerge are the merge strategies of the lists, the key is the
+	// dot-separated path of the list, or "" for all the lists
+	ListMerge map[string]string
+}
+
+// listMerger merges the lists of the values by the strategies, the strategy
+// of a list is the directive in the table of the higher precedence, then the
+// one of the lower precedence, then the options.
+type listMerger struct {
+	paths map[string]string
+}
+
+func newListMerger(strategies map[string]string) (*listMerger, error) {
+	for p, strategy := range strategies {
+		if _, _, err := parseListMerge(strategy); err != nil {
+			if p == "" {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+	}
+	return &listMerger{paths: strategies}, nil
+}
+
+// parseListMerge parses the strategy and the key field of ListMergeByKey.
+func parseListMerge(s string) (string, string, error) {
+	strategy, key, hasKey := strings.Cut(s, ":")
+	switch strategy {
+	case ListMergeReplace, ListMergeAppend:
+		if !hasKey {
+			return strategy, "", nil
+		}
+	case ListMergeByKey:
+		if !hasKey {
+			return strategy, defaultMergeKey, nil
+		}
+		if key != "" {
+			return strategy, key, nil
+		}
+	}
+	return "", "", fmt.Errorf("invalid list merge strategy: %q, should be %s, %s or %s[:<key>]",
+		s, ListMergeReplace, ListMergeAppend, ListMergeByKey)
+}
+
+// coalesceTables is chartutil.CoalesceTables with the merge strategies of the
+// lists, dst has higher precedence and is merged in place.
+func (lm *listMerger) coalesceTables(dst, src map[string]any) map[string]any {
+	if dst != nil && src != nil {
+		lm.mergeLists(dst, src, "")
+	}
+	return chartutil.CoalesceTables(dst, src)
+}
+
+// mergeLists merges the lists of src into dst, the lists replaced are kept in
+// dst, so that CoalesceTables keeps them.
+func (lm *listMerger) mergeLists(dst, src map[string]any, prefix string) {
+	for k, dv := range dst {
+		if k == mergeDirectiveKey {
+			continue
+		}
+		sv, ok := src[k]
+		if !ok {
+			continue
+		}
+
+		p := k
+		if prefix != "" {
+			p = prefix + "." + k
+		}
+		switch dv := dv.(type) {
+		case map[string]any:
+			if sv, ok := sv.(map[string]any); ok {
+				lm.mergeLists(dv, sv, p)
+			}
+		case []any:
+			if sv, ok := sv.([]any); ok {
+				dst[k] = lm.mergeList(lm.strategy(dst, src, k, p), dv, sv)
+			}
+		}
+	}
+}
+
+// strategy returns the merge strategy of the list k in the tables.
+func (lm *listMerger) strategy(dst, src map[string]any, k, p string) string {
+	for _, m := range []map[string]any{dst, src} {
+		if directives, ok := m[mergeDirectiveKey].(map[string]any); ok {
+			if s, ok := directives[k].(string); ok {
+				return s
+			}
+		}
+	}
+	if s, ok := lm.paths[p]; ok {
+		return s
+	}
+	return lm.paths[""]
+}
+
+// mergeList merges the list of the higher precedence dst and the lower src.
+func (lm *listMerger) mergeList(s string, dst, src []any) []any {
+	strategy, key, err := parseListMerge(s)
+	if err != nil {
+		// the invalid directives are reported by removeMergeDirectives
+		return dst
+	}
+
+	switch strategy {
+	case ListMergeAppend:
+		return append(append(make([]any, 0, len(src)+len(dst)), src...), dst...)
+	case ListMergeByKey:
+		out := append(make([]any, 0, len(src)+len(dst)), src...)
+		index := make(map[string]int)
+		for i, item := range src {
+			if m, ok := item.(map[string]any); ok {
+				if v, ok := m[key]; ok {
+					index[fmt.Sprint(v)] = i
+				}
+			}
+		}
+		for _, item := range dst {
+			if m, ok := item.(map[string]any); ok {
+				if v, ok := m[key]; ok {
+					if i, ok := index[fmt.Sprint(v)]; ok {
+						if sm, ok := src[i].(map[string]any); ok {
+							out[i] = lm.coalesceTables(m, sm)
+							continue
+						}
+					}
+				}
+			}
+			out = append(out, item)
+		}
+		return out
+	}
+	return dst
+}
+
+// removeMergeDirectives removes the merge directives from the merged values,
+// and validates their strategies.
+func removeMergeDirectives(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		if directives, ok := v[mergeDirectiveKey]; ok {
+			m, ok := directives.(map[string]any)
+			if !ok {
+				return fmt.Errorf("invalid %s: should be a table of the list strategies", mergeDirectiveKey)
+			}
+			for k, s := range m {
+				str, _ := s.(string)
+				if _, _, err := parseListMerge(str); err != nil {
+					return fmt.Errorf("%s.%s: %v", mergeDirectiveKey, k, err)
+				}
+			}
+			delete(v, mergeDirectiveKey)
+		}
+		for _, e := range v {
+			if err := removeMergeDirectives(e); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, e := range v {
+			if err := removeMergeDirectives(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
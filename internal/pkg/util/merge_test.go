@@ -0,0 +1,87 @@
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeValuesDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMergeChartValuesListMerge(t *testing.T) {
+	chartPath := fixturePath("charts", "basic")
+	base := writeValuesDir(t, map[string]string{
+		"global.yaml": "ports: [7001]\n",
+		"basic.yaml": `upstreams:
+  - name: db
+    host: db.default
+    port: 3306
+  - name: cache
+    host: cache.default
+`,
+	})
+	dev := writeValuesDir(t, map[string]string{
+		"basic.yaml": `$merge:
+  ports: append
+  upstreams: merge-by-key
+ports: [7002]
+upstreams:
+  - name: db
+    host: db.dev
+  - name: mq
+    host: mq.dev
+tags: [dev]
+`,
+	})
+
+	got, err := MergeChartValues(chartPath, []string{base, dev}, MergeOptions{}, nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []any{json.Number("7001"), json.Number("7002")}, got["ports"])
+	assert.Equal(t, []any{
+		map[string]any{"name": "db", "host": "db.dev", "port": json.Number("3306")},
+		map[string]any{"name": "cache", "host": "cache.default"},
+		map[string]any{"name": "mq", "host": "mq.dev"},
+	}, got["upstreams"])
+	// the directives are not a part of the values
+	assert.NotContains(t, got, mergeDirectiveKey)
+
+	// the options apply to the lists without the directives
+	optVals := map[string]any{"tags": []any{"cli"}}
+	got, err = MergeChartValues(chartPath, []string{base, dev}, MergeOptions{
+		ListMerge: map[string]string{"": ListMergeReplace, "tags": ListMergeAppend},
+	}, optVals, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{"dev", "cli"}, got["tags"])
+		assert.Len(t, got["ports"], 2)
+	}
+
+	// replace is the default as Helm
+	got, err = MergeChartValues(chartPath, []string{base}, MergeOptions{}, map[string]any{"ports": []any{int64(1)}}, nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []any{int64(1)}, got["ports"])
+	}
+
+	_, err = MergeChartValues(chartPath, nil, MergeOptions{ListMerge: map[string]string{"ports": "prepend"}}, nil, nil)
+	assert.ErrorContains(t, err, "invalid list merge strategy")
+	invalid := writeValuesDir(t, map[string]string{"basic.yaml": "$merge:\n  ports: \"merge-by-key:\"\n"})
+	_, err = MergeChartValues(chartPath, []string{invalid}, MergeOptions{}, nil, nil)
+	assert.ErrorContains(t, err, "$merge.ports")
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SlashJoin joins the elements into a slash separated path, the separators of
+// the os in the elements are converted to slashes.
+func SlashJoin(elem ...string) string {
+	slashed := make([]string, len(elem))
+	for i, e := range elem {
+		slashed[i] = filepath.ToSlash(e)
+	}
+	return path.Join(slashed...)
+}
+
+// TrimPathPrefix returns the slash separated path relative to the prefix, it
+// reports false if the path is not the prefix or under it. Unlike
+// strings.TrimPrefix, "foo-bar/a" is not under "foo".
+func TrimPathPrefix(p, prefix string) (string, bool) {
+	p, prefix = path.Clean(filepath.ToSlash(p)), path.Clean(filepath.ToSlash(prefix))
+	if p == prefix {
+		return "", true
+	}
+	if prefix == "." {
+		return p, !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if !strings.HasPrefix(p, prefix) {
+		return p, false
+	}
+	return p[len(prefix):], true
+}
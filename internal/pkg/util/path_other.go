@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+// LongPath returns the path as is, the length of the path is only limited on windows.
+func LongPath(p string) string {
+	return p
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlashJoin(t *testing.T) {
+	assert.Equal(t, "out/svc/cfg", SlashJoin("out", "svc", "/cfg"))
+	assert.Equal(t, "cfg", SlashJoin("", "cfg"))
+	assert.Equal(t, "", SlashJoin())
+}
+
+func TestTrimPathPrefix(t *testing.T) {
+	for _, c := range []struct {
+		p, prefix, rel string
+		ok             bool
+	}{
+		{"demo/cfg/sub", "demo", "cfg/sub", true},
+		{"demo", "demo", "", true},
+		{"demo/", "demo", "", true},
+		{"demo-ext/cfg", "demo", "demo-ext/cfg", false},
+		{"other/demo/cfg", "demo", "other/demo/cfg", false},
+		{"demo/charts/sub/cfg", "demo/charts/sub", "cfg", true},
+		{"cfg", ".", "cfg", true},
+		{"../cfg", ".", "../cfg", false},
+		{"/data/demo/cfg", "/", "data/demo/cfg", true},
+	} {
+		rel, ok := TrimPathPrefix(c.p, c.prefix)
+		assert.Equal(t, c.rel, rel, c.p)
+		assert.Equal(t, c.ok, ok, c.p)
+	}
+}
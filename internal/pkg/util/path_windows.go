@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is MAX_PATH of windows minus the space of the file name, the directory
+// path longer than it can not be created without the \\?\ prefix.
+const maxPath = 248
+
+// LongPath returns the path with the \\?\ prefix if it is longer than MAX_PATH,
+// so that the deep chart trees could be loaded and rendered on windows. The path
+// is made absolute because the prefix disables the relative path parsing.
+func LongPath(p string) string {
+	if strings.HasPrefix(p, `\\?\`) || strings.HasPrefix(p, `\\.\`) {
+		return p
+	}
+
+	abs, err := filepath.Abs(p)
+	if err != nil || len(abs) < maxPath {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// \\server\share -> \\?\UNC\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlashJoinWindows(t *testing.T) {
+	assert.Equal(t, "C:/out/svc/cfg", SlashJoin(`C:\out`, `svc\cfg`))
+
+	rel, ok := TrimPathPrefix(`demo\cfg\sub`, "demo")
+	assert.True(t, ok)
+	assert.Equal(t, "cfg/sub", rel)
+}
+
+func TestLongPath(t *testing.T) {
+	assert.Equal(t, `C:\out`, LongPath(`C:\out`))
+	assert.Equal(t, `\\?\C:\out`, LongPath(`\\?\C:\out`))
+
+	deep := `C:\` + strings.Repeat(`chart\`, 50) + "Chart.yaml"
+	assert.Equal(t, `\\?\`+deep, LongPath(deep))
+
+	unc := `\\server\share\` + strings.Repeat(`chart\`, 50) + "Chart.yaml"
+	assert.Equal(t, `\\?\UNC\server\share\`+strings.Repeat(`chart\`, 50)+"Chart.yaml", LongPath(unc))
+
+	// the relative path is made absolute
+	t.Chdir(t.TempDir())
+	rel := filepath.Join(strings.Repeat("chart"+string(filepath.Separator), 50), "Chart.yaml")
+	p := LongPath(rel)
+	assert.True(t, strings.HasPrefix(p, `\\?\`), p)
+
+	if assert.NoError(t, WriteFile([]byte("name: demo\n"), p)) {
+		assert.True(t, FileExist(p))
+		_, err := os.Stat(p)
+		assert.NoError(t, err)
+	}
+}
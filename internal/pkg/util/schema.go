@@ -0,0 +1,57 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidateValues validates the merged values of a chart against its
+// values.schema.json, the errors are reported with the JSON pointers of the values.
+func ValidateValues(chartName string, schema []byte, values map[string]any) error {
+	valuesJSON, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewBytesLoader(valuesJSON))
+	if err != nil {
+		return fmt.Errorf("invalid values.schema.json in chart(%s): %v", chartName, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "values don't meet the schema of chart(%s):", chartName)
+	for _, e := range result.Errors() {
+		fmt.Fprintf(&sb, "\n- %s: %s", valuesPointer(e), e.Description())
+	}
+	return fmt.Errorf("%s", sb.String())
+}
+
+// valuesPointer returns the JSON pointer of the value in the error, the missing
+// and the unknown properties are pointed to themselves instead of their parents.
+func valuesPointer(e gojsonschema.ResultError) string {
+	const sep = "\x00"
+	tokens := strings.Split(e.Context().String(sep), sep)[1:]
+	switch e.Type() {
+	case "required", "additional_property_not_allowed":
+		if property, ok := e.Details()["property"].(string); ok {
+			tokens = append(tokens, property)
+		}
+	}
+	if len(tokens) == 0 {
+		return "/"
+	}
+
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var sb strings.Builder
+	for _, token := range tokens {
+		sb.WriteString("/")
+		sb.WriteString(escaper.Replace(token))
+	}
+	return sb.String()
+}
@@ -0,0 +1,212 @@
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat is the container format of the archives of multiple files.
+type ArchiveFormat string
+
+const (
+	ArchiveTar     ArchiveFormat = "tar"
+	ArchiveTarZstd ArchiveFormat = "tar.zst"
+	ArchiveTarLz4  ArchiveFormat = "tar.lz4"
+	ArchiveTarGzip ArchiveFormat = "tar.gz"
+	ArchiveZip     ArchiveFormat = "zip"
+)
+
+// archiveAlgorithms are the compression algorithms of the tar formats.
+var archiveAlgorithms = map[ArchiveFormat]CompressAlgorithm{
+	ArchiveTar:     NONE,
+	ArchiveTarZstd: ZSTD,
+	ArchiveTarLz4:  LZ4,
+	ArchiveTarGzip: GZIP,
+}
+
+// ParseArchiveFormat parses the format, which is also the suffix of the archives.
+func ParseArchiveFormat(s string) (ArchiveFormat, error) {
+	format := ArchiveFormat(strings.TrimPrefix(s, "."))
+	if _, ok := archiveAlgorithms[format]; ok || format == ArchiveZip {
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported archive format: %s", s)
+}
+
+// Suffix returns the file suffix of the format.
+func (f ArchiveFormat) Suffix() string {
+	return "." + string(f)
+}
+
+// ArchiveEntry is the header of a file in the archive.
+type ArchiveEntry struct {
+	// Name is the slash separated relative path in the archive
+	Name string
+	// Size is the size of the content, the content is buffered in memory to get
+	// the size of the tar entries if it is negative
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// ArchiveWriter writes multiple files into an archive stream. The tar formats
+// are compressed as a whole by the algorithm of the format, and the files in the
+// zip format are compressed by deflate separately.
+type ArchiveWriter struct {
+	tw *tar.Writer
+	zw *zip.Writer
+	// cw is the compress writer of the tar formats
+	cw     io.WriteCloser
+	closed bool
+}
+
+// NewArchiveWriter creates an archive writer of the format. The level of the
+// encoder is the level of the compression algorithm of the tar formats, or the
+// level of gzip for the zip format.
+func NewArchiveWriter(w io.Writer, format ArchiveFormat, encoder EncoderOptions) (*ArchiveWriter, error) {
+	if format == ArchiveZip {
+		if err := encoder.validate(GZIP); err != nil {
+			return nil, err
+		}
+		level, _ := resolveLevel(GZIP, encoder.Level)
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+		return &ArchiveWriter{zw: zw}, nil
+	}
+
+	algorithm, ok := archiveAlgorithms[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive format: %s", format)
+	}
+	a := &ArchiveWriter{}
+	if algorithm != NONE {
+		cw, err := NewCompressWriter(w, NewCompressOption(algorithm, encoder))
+		if err != nil {
+			return nil, err
+		}
+		a.cw = cw
+		w = cw
+	}
+	a.tw = tar.NewWriter(w)
+	return a, nil
+}
+
+// archiveName checks the name of the entry, which must be a relative path in the
+// archive.
+func archiveName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || path.IsAbs(name) || !fs.ValidPath(path.Clean(name)) || path.Clean(name) == "." {
+		return "", fmt.Errorf("invalid archive entry name: %s", name)
+	}
+	return path.Clean(name), nil
+}
+
+// Add writes the content of the entry read from r into the archive.
+func (a *ArchiveWriter) Add(entry ArchiveEntry, r io.Reader) error {
+	if a.closed {
+		return io.ErrClosedPipe
+	}
+	name, err := archiveName(entry.Name)
+	if err != nil {
+		return err
+	}
+	mode := entry.Mode.Perm()
+	if mode == 0 {
+		mode = 0644
+	}
+	modTime := entry.ModTime
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	if a.zw != nil {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+		header.SetMode(mode)
+		w, err := a.zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(w, r)
+		if err == nil && entry.Size >= 0 && n != entry.Size {
+			err = fmt.Errorf("archive entry %s: size mismatched, expected %d, got %d", name, entry.Size, n)
+		}
+		return err
+	}
+
+	size := entry.Size
+	if size < 0 {
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, r); err != nil {
+			return err
+		}
+		size = int64(buf.Len())
+		r = &buf
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     int64(mode),
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	n, err := io.CopyN(a.tw, r, size)
+	if err == io.EOF {
+		err = fmt.Errorf("archive entry %s: size mismatched, expected %d, got %d", name, size, n)
+	}
+	return err
+}
+
+// AddFile writes the regular file of the path as the entry of the name.
+func (a *ArchiveWriter) AddFile(name, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("archive file %s is not a regular file", filePath)
+	}
+	return a.Add(ArchiveEntry{Name: name, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}, f)
+}
+
+// Close finishes the archive, the underlying writer is not closed.
+func (a *ArchiveWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+
+	if a.zw != nil {
+		return a.zw.Close()
+	}
+	err := a.tw.Close()
+	if a.cw != nil {
+		if err2 := a.cw.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArchiveFormat(t *testing.T) {
+	for _, s := range []string{"tar", "tar.zst", ".tar.gz", "tar.lz4", "zip"} {
+		format, err := ParseArchiveFormat(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, "."+strings.TrimPrefix(s, "."), format.Suffix())
+		}
+	}
+	_, err := ParseArchiveFormat("tar.xz")
+	assert.Error(t, err)
+}
+
+func TestArchiveWriter(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "a.log")
+	fileData := []byte(strings.Repeat("line of the log file\n", 1000))
+	if err := os.WriteFile(filePath, fileData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	readerData := []byte(randStr(4096))
+
+	for _, format := range []ArchiveFormat{ArchiveTar, ArchiveTarZstd, ArchiveTarLz4, ArchiveTarGzip, ArchiveZip} {
+		encoder := EncoderOptions{Level: LevelBest}
+		if format == ArchiveTarLz4 {
+			encoder.Level = 0
+		}
+		var out bytes.Buffer
+		a, err := NewArchiveWriter(&out, format, encoder)
+		if !assert.NoError(t, err, format) {
+			continue
+		}
+		assert.NoError(t, a.AddFile("logs/a.log", filePath), format)
+		assert.NoError(t, a.Add(ArchiveEntry{Name: "b.txt", Size: -1}, bytes.NewReader(readerData)), format)
+		assert.NoError(t, a.Add(ArchiveEntry{Name: "empty", Size: 0}, bytes.NewReader(nil)), format)
+		assert.NoError(t, a.Close(), format)
+		assert.NoError(t, a.Close(), format)
+		assert.ErrorIs(t, a.Add(ArchiveEntry{Name: "c"}, bytes.NewReader(nil)), io.ErrClosedPipe)
+
+		files := readArchive(t, format, out.Bytes())
+		assert.Equal(t, []string{"logs/a.log", "b.txt", "empty"}, files.names, format)
+		assert.Equal(t, fileData, files.data["logs/a.log"], format)
+		assert.Equal(t, readerData, files.data["b.txt"], format)
+		assert.Empty(t, files.data["empty"], format)
+		assert.True(t, modTime.Equal(files.modTimes["logs/a.log"]), format)
+	}
+}
+
+func TestArchiveWriterInvalid(t *testing.T) {
+	_, err := NewArchiveWriter(&bytes.Buffer{}, "tar.xz", EncoderOptions{})
+	assert.Error(t, err)
+	_, err = NewArchiveWriter(&bytes.Buffer{}, ArchiveTarLz4, EncoderOptions{Level: 1})
+	assert.Error(t, err)
+	_, err = NewArchiveWriter(&bytes.Buffer{}, ArchiveZip, EncoderOptions{Level: 10})
+	assert.Error(t, err)
+
+	for _, format := range []ArchiveFormat{ArchiveTar, ArchiveZip} {
+		a, err := NewArchiveWriter(&bytes.Buffer{}, format, EncoderOptions{})
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for _, name := range []string{"", "/etc/passwd", "../a.log", ".", `..\a.log`} {
+			assert.Error(t, a.Add(ArchiveEntry{Name: name}, bytes.NewReader(nil)), "%s %q", format, name)
+		}
+		// the content is shorter than the size
+		assert.Error(t, a.Add(ArchiveEntry{Name: "a.log", Size: 10}, strings.NewReader("short")), format)
+		assert.Error(t, a.AddFile("dir", t.TempDir()), format)
+	}
+}
+
+type archiveFiles struct {
+	names    []string
+	data     map[string][]byte
+	modTimes map[string]time.Time
+}
+
+// readArchive reads the files in the archive of the format.
+func readArchive(t *testing.T, format ArchiveFormat, data []byte) *archiveFiles {
+	files := &archiveFiles{data: make(map[string][]byte), modTimes: make(map[string]time.Time)}
+	if format == ArchiveZip {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files.names = append(files.names, f.Name)
+			files.data[f.Name] = content
+			files.modTimes[f.Name] = f.Modified
+		}
+		return files
+	}
+
+	if algorithm := archiveAlgorithms[format]; algorithm != NONE {
+		data = decompress(t, algorithm, bytes.NewReader(data))
+	}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files.names = append(files.names, header.Name)
+		files.data[header.Name] = content
+		files.modTimes[header.Name] = header.ModTime
+	}
+}
@@ -18,6 +18,11 @@ const (
 	NONE CompressAlgorithm = ""
 	ZSTD CompressAlgorithm = "zstd"
 	LZ4  CompressAlgorithm = "lz4"
+	GZIP CompressAlgorithm = "gzip"
+	XZ   CompressAlgorithm = "xz"
+	// AUTO selects the algorithm and the level by Probe, it must be resolved
+	// before creating the writers.
+	AUTO CompressAlgorithm = "auto"
 )
 
 // CompressOption is an interface that defines methods for compression configuration
@@ -25,12 +30,24 @@ type CompressOption interface {
 	// CompressAlgorithm returns the compression algorithm to be used
 	CompressAlgorithm() CompressAlgorithm
 
-	// MaxWriterBuffSize returns the maximum buffer size for compression writer
+	// MaxWriterBuffSize returns the maximum buffer size for compression writer.
+	//
+	// Deprecated: the data is streamed without intermediate buffers, the limit
+	// is not applied any more.
 	MaxWriterBuffSize() int
 }
 
+// CompressEncoderOption is implemented by the options which tune the encoder
+// of the compression algorithm, the default encoder is used for the options
+// which do not implement it.
+type CompressEncoderOption interface {
+	// EncoderOptions returns the options of the encoder.
+	EncoderOptions() EncoderOptions
+}
+
 type defaultCompressOption struct {
 	algorithm         CompressAlgorithm
+	encoder           EncoderOptions
 	maxWriterBuffSize int
 }
 
@@ -42,6 +59,10 @@ func (d *defaultCompressOption) MaxWriterBuffSize() int {
 	return d.maxWriterBuffSize
 }
 
+func (d *defaultCompressOption) EncoderOptions() EncoderOptions {
+	return d.encoder
+}
+
 // NewDefaultCompressOption creates a new CompressOption with default settings
 // writer buffer size limit enabled by default
 func NewDefaultCompressOption(algorithm CompressAlgorithm) CompressOption {
@@ -51,31 +72,130 @@ func NewDefaultCompressOption(algorithm CompressAlgorithm) CompressOption {
 	}
 }
 
-// ErrUnexpectedEOF is an error variable indicates unexpected end of file during compression/decompression
+// NewCompressOption creates a new CompressOption with the options of the
+// encoder, so that the CPU could be traded for the compression ratio.
+func NewCompressOption(algorithm CompressAlgorithm, encoder EncoderOptions) CompressOption {
+	return &defaultCompressOption{
+		algorithm:         algorithm,
+		encoder:           encoder,
+		maxWriterBuffSize: maxBufferSize,
+	}
+}
+
+// ValidateCompressOption checks the algorithm and the encoder options of the option.
+func ValidateCompressOption(option CompressOption) error {
+	if option == nil {
+		return fmt.Errorf("invalid compress option")
+	}
+	return encoderOptions(option).validate(option.CompressAlgorithm())
+}
+
+// encoderOptions returns the encoder options of the option.
+func encoderOptions(option CompressOption) EncoderOptions {
+	if o, ok := option.(CompressEncoderOption); ok {
+		return o.EncoderOptions()
+	}
+	return EncoderOptions{}
+}
+
+// ErrUnexpectedEOF is an error variable indicates unexpected end of file during compression/decompression.
+//
+// Deprecated: the files are not truncated any more, it is never returned.
 var ErrUnexpectedEOF = errors.New("unexpected EOF")
 
 // ErrUnsupportAlgorithm is an error variable indicates unsupported compression algorithm
 var ErrUnsupportAlgorithm = errors.New("unsupport compress algorithm")
 
-// CompressFile compress target file with specified algorithm
+// CompressFile compress target file with specified algorithm, the compressed
+// data is streamed into out without buffering the whole file.
 func CompressFile(path string, option CompressOption, out io.Writer) error {
-	if option == nil {
-		return fmt.Errorf("invalid compress option")
+	w, err := NewCompressWriter(out, option)
+	if err != nil {
+		return err
 	}
 
 	fd, err := os.Open(path)
 	if err != nil {
+		_ = w.Close()
 		return fmt.Errorf("open file:%s, %v", path, err)
 	}
 	defer fd.Close()
 
+	if _, err := io.Copy(w, fd); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// NewCompressFileReader returns a reader of the compressed data of the file,
+// the file is compressed by a goroutine while the data is read, so the memory
+// is bounded by the encoder whatever the size of the file. The errors of the
+// compression are returned by Read, and Close stops the compression.
+func NewCompressFileReader(path string, option CompressOption) (io.ReadCloser, error) {
+	if err := ValidateCompressOption(option); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(CompressFile(path, option, pw))
+	}()
+	return pr, nil
+}
+
+// NewCompressReader returns a reader of the compressed data of r, the data is
+// compressed by a goroutine while it is read like NewCompressFileReader.
+func NewCompressReader(r io.Reader, option CompressOption) (io.ReadCloser, error) {
+	if err := ValidateCompressOption(option); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := NewCompressWriter(pw, option)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			_ = w.Close()
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	return pr, nil
+}
+
+// NewCompressWriter returns a writer which compresses the data written into it with
+// specified algorithm and writes the compressed data to w. The data is streamed
+// without intermediate buffers, so the writer buffer size limit of the option is
+// not applied. The writer must be closed to flush the remaining data, and w is
+// not closed by it. The returned writer implements io.ReaderFrom, io.Copy reads
+// the source into the encoder directly.
+func NewCompressWriter(w io.Writer, option CompressOption) (io.WriteCloser, error) {
+	if err := ValidateCompressOption(option); err != nil {
+		return nil, err
+	}
+
+	encoder := encoderOptions(option)
+	if encoder.Parallel > 1 {
+		parallel := encoder.Parallel
+		encoder.Parallel = 0
+		return newParallelWriter(w, NewCompressOption(option.CompressAlgorithm(), encoder), parallel), nil
+	}
+	level, _ := resolveLevel(option.CompressAlgorithm(), encoder.Level)
 	switch option.CompressAlgorithm() {
 	case ZSTD:
-		err = zstdCompress(fd, out, option)
+		return newZstdWriter(w, level, encoder)
+	case GZIP:
+		return newGzipWriter(w, level)
+	case XZ:
+		return newXzWriter(w, level)
 	default:
-		err = ErrUnsupportAlgorithm
+		return newLz4Writer(w)
 	}
-	return err
 }
 
 // GetCompressAlgorithmSuffix returns the file suffix for given compression algorithm
@@ -85,6 +205,10 @@ func GetCompressAlgorithmSuffix(algorithm CompressAlgorithm) string {
 		return ".zst"
 	case LZ4:
 		return ".lz4"
+	case GZIP:
+		return ".gz"
+	case XZ:
+		return ".xz"
 	default:
 		return ""
 	}
@@ -2,13 +2,16 @@ package compress
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,6 +23,8 @@ func TestGetCompressAlgorithmSuffix(t *testing.T) {
 	}{
 		{"ZSTD algorithm", ZSTD, ".zst"},
 		{"LZ4 algorithm", LZ4, ".lz4"},
+		{"GZIP algorithm", GZIP, ".gz"},
+		{"XZ algorithm", XZ, ".xz"},
 		{"None algorithm", NONE, ""},
 		{"Unknown algorithm", "unknown", ""},
 	}
@@ -104,10 +109,19 @@ func TestCompressFile(t *testing.T) {
 		{"Valid file with ZSTD 10M", validPath, 10 * 1024 * 1024, ZSTD, &bytes.Buffer{}, false},
 		{"Valid file with ZSTD 100M", validPath, 100 * 1024 * 1024, ZSTD, &bytes.Buffer{}, false},
 		{"Valid file with ZSTD 1G", validPath, 1024 * 1024 * 1024, ZSTD, &bytes.Buffer{}, false},
+		{"Valid file with LZ4 1K", validPath, 1024, LZ4, &bytes.Buffer{}, false},
+		{"Valid file with LZ4 1M", validPath, 1024 * 1024, LZ4, &bytes.Buffer{}, false},
+		{"Valid file with LZ4 10M", validPath, 10 * 1024 * 1024, LZ4, &bytes.Buffer{}, false},
+		{"Valid file with LZ4 100M", validPath, 100 * 1024 * 1024, LZ4, &bytes.Buffer{}, false},
+		{"Valid file with GZIP 1K", validPath, 1024, GZIP, &bytes.Buffer{}, false},
+		{"Valid file with GZIP 1M", validPath, 1024 * 1024, GZIP, &bytes.Buffer{}, false},
+		{"Valid file with GZIP 10M", validPath, 10 * 1024 * 1024, GZIP, &bytes.Buffer{}, false},
 		{"Valid file with unsupported algo", validPath, 0, "unknown", &bytes.Buffer{}, true},
 		{"Invalid file path", invalidPath, 0, ZSTD, &bytes.Buffer{}, true},
 		{"Empty file path", "", 0, ZSTD, &bytes.Buffer{}, true},
 		{"Invalid writer with ZSTD", validPath, 1024, ZSTD, &errorWriter{}, true},
+		{"Invalid writer with LZ4", validPath, 1024, LZ4, &errorWriter{}, true},
+		{"Invalid writer with GZIP", validPath, 1024, GZIP, &errorWriter{}, true},
 	}
 
 	for _, tt := range tests {
@@ -132,3 +146,210 @@ func TestCompressFile(t *testing.T) {
 		})
 	}
 }
+
+func TestNewCompressWriter(t *testing.T) {
+	data := []byte(randStr(3*maxChunkSize + 100))
+
+	for _, algorithm := range []CompressAlgorithm{ZSTD, LZ4, GZIP} {
+		for _, name := range []string{"Write", "ReadFrom"} {
+			t.Run(string(algorithm)+" "+name, func(t *testing.T) {
+				testCompressWriter(t, algorithm, name == "ReadFrom", data)
+			})
+		}
+	}
+
+	_, err := NewCompressWriter(&bytes.Buffer{}, NewDefaultCompressOption("unknown"))
+	assert.ErrorIs(t, err, ErrUnsupportAlgorithm)
+	_, err = NewCompressWriter(&bytes.Buffer{}, nil)
+	assert.Error(t, err)
+}
+
+// decompress decompresses the data compressed with the algorithm.
+func decompress(t *testing.T, algorithm CompressAlgorithm, r io.Reader) []byte {
+	if algorithm == GZIP {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if algorithm == LZ4 {
+		frame, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := lz4Decode(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	got, err := io.ReadAll(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func testCompressWriter(t *testing.T, algorithm CompressAlgorithm, readFrom bool, data []byte) {
+	var out bytes.Buffer
+	w, err := NewCompressWriter(&out, NewDefaultCompressOption(algorithm))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if !readFrom {
+		for i := 0; i < len(data); i += 4096 {
+			_, err = w.Write(data[i:min(i+4096, len(data))])
+			if !assert.NoError(t, err) {
+				return
+			}
+		}
+	} else {
+		_, err = io.Copy(w, bytes.NewReader(data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, w.Close())
+
+	_, err = w.Write([]byte("closed"))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+	got := decompress(t, algorithm, &out)
+	assert.True(t, bytes.Equal(data, got), "decompressed data mismatched")
+}
+
+func TestNewCompressFileReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testfile")
+	data := []byte(randStr(2*maxChunkSize + 100))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range []CompressAlgorithm{ZSTD, LZ4, GZIP} {
+		r, err := NewCompressFileReader(path, NewDefaultCompressOption(algorithm))
+		if !assert.NoError(t, err) {
+			return
+		}
+		got := decompress(t, algorithm, r)
+		assert.True(t, bytes.Equal(data, got), "decompressed data mismatched")
+		assert.NoError(t, r.Close())
+	}
+
+	// the error of compression is returned by read
+	r, err := NewCompressFileReader(filepath.Join(t.TempDir(), "nonexistence"), NewDefaultCompressOption(ZSTD))
+	if assert.NoError(t, err) {
+		_, err = io.ReadAll(r)
+		assert.Error(t, err)
+		r.Close()
+	}
+
+	// closing before reading all stops the compression
+	r, err = NewCompressFileReader(path, NewDefaultCompressOption(ZSTD))
+	if assert.NoError(t, err) {
+		assert.NoError(t, r.Close())
+	}
+
+	_, err = NewCompressFileReader(path, NewDefaultCompressOption("unknown"))
+	assert.ErrorIs(t, err, ErrUnsupportAlgorithm)
+}
+
+func TestCompressEncoderOptions(t *testing.T) {
+	data := bytes.Repeat([]byte(randStr(4096)), 256)
+
+	tests := []struct {
+		algorithm CompressAlgorithm
+		encoder   EncoderOptions
+		wantErr   bool
+	}{
+		{ZSTD, EncoderOptions{}, false},
+		{ZSTD, EncoderOptions{Level: 1}, false},
+		{ZSTD, EncoderOptions{Level: 19}, false},
+		{ZSTD, EncoderOptions{Level: 23}, true},
+		{ZSTD, EncoderOptions{Level: LevelBest}, false},
+		{ZSTD, EncoderOptions{Level: LevelBetter, WindowSize: 1 << 20, Concurrency: 2}, false},
+		{ZSTD, EncoderOptions{WindowSize: 1000}, true},
+		{ZSTD, EncoderOptions{WindowSize: 1 << 30}, true},
+		{ZSTD, EncoderOptions{Concurrency: -1}, true},
+		{GZIP, EncoderOptions{}, false},
+		{GZIP, EncoderOptions{Level: 1}, false},
+		{GZIP, EncoderOptions{Level: 9}, false},
+		{GZIP, EncoderOptions{Level: LevelFastest}, false},
+		{GZIP, EncoderOptions{Level: 10}, true},
+		{GZIP, EncoderOptions{Level: -5}, true},
+		{GZIP, EncoderOptions{WindowSize: 1 << 20}, true},
+		{LZ4, EncoderOptions{}, false},
+		{LZ4, EncoderOptions{Level: 1}, true},
+		{LZ4, EncoderOptions{Level: LevelBest}, true},
+		{LZ4, EncoderOptions{Concurrency: 2}, true},
+		{LZ4, EncoderOptions{Parallel: 2}, false},
+		{GZIP, EncoderOptions{Level: LevelBest, Parallel: 4}, false},
+		{ZSTD, EncoderOptions{Parallel: -1}, true},
+	}
+
+	for _, tt := range tests {
+		option := NewCompressOption(tt.algorithm, tt.encoder)
+		err := ValidateCompressOption(option)
+		if tt.wantErr {
+			assert.Error(t, err, "%s %+v", tt.algorithm, tt.encoder)
+			_, err = NewCompressWriter(&bytes.Buffer{}, option)
+			assert.Error(t, err, "%s %+v", tt.algorithm, tt.encoder)
+			continue
+		}
+		if !assert.NoError(t, err, "%s %+v", tt.algorithm, tt.encoder) {
+			continue
+		}
+
+		// the encoders of the options are pooled separately
+		for i := 0; i < 2; i++ {
+			var out bytes.Buffer
+			w, err := NewCompressWriter(&out, option)
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = w.Write(data)
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+			assert.True(t, bytes.Equal(data, decompress(t, tt.algorithm, &out)), "%s %+v", tt.algorithm, tt.encoder)
+		}
+	}
+
+	// the default option uses the default level
+	assert.NoError(t, ValidateCompressOption(NewDefaultCompressOption(GZIP)))
+	assert.ErrorIs(t, ValidateCompressOption(NewDefaultCompressOption("unknown")), ErrUnsupportAlgorithm)
+	assert.Error(t, ValidateCompressOption(nil))
+}
+
+func TestNewCompressReader(t *testing.T) {
+	data := []byte(randStr(maxChunkSize + 100))
+	for _, algorithm := range []CompressAlgorithm{ZSTD, LZ4, GZIP} {
+		r, err := NewCompressReader(bytes.NewReader(data), NewDefaultCompressOption(algorithm))
+		if !assert.NoError(t, err) {
+			return
+		}
+		got := decompress(t, algorithm, r)
+		assert.True(t, bytes.Equal(data, got), "decompressed data mismatched")
+		assert.NoError(t, r.Close())
+	}
+
+	// the error of the source is returned by read
+	r, err := NewCompressReader(iotest.ErrReader(io.ErrClosedPipe), NewDefaultCompressOption(ZSTD))
+	if assert.NoError(t, err) {
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, io.ErrClosedPipe)
+		r.Close()
+	}
+
+	_, err = NewCompressReader(bytes.NewReader(data), NewDefaultCompressOption("unknown"))
+	assert.ErrorIs(t, err, ErrUnsupportAlgorithm)
+}
@@ -0,0 +1,248 @@
+package compress
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	// DefaultDictionarySize is the default size of the trained dictionaries,
+	// which is the default of zstd command.
+	DefaultDictionarySize = 112640
+
+	minDictionarySize = 256
+
+	// dictSegmentSize is the size of the segments selected into dictionary
+	dictSegmentSize = 256
+	// dictDmerSize is the size of the substrings counted in the samples
+	dictDmerSize = 8
+
+	// the dictionary ids 0-32767 are reserved by zstd, and so do the ids not
+	// less than 2^31
+	minDictionaryID = 32768
+	maxDictionaryID = 1 << 31
+)
+
+// Dictionary is a named zstd dictionary of the raw content. The frames compressed
+// with it do not contain the dictionary id, so that they could be decompressed by
+// 'zstd -d -D FILE', and the id should be recorded with the compressed data to
+// find the dictionary when decompressing.
+type Dictionary struct {
+	Name    string
+	ID      uint32
+	Content []byte
+}
+
+// NewDictionary creates a dictionary of the content, the id is derived from the
+// content.
+func NewDictionary(name string, content []byte) *Dictionary {
+	return &Dictionary{
+		Name:    name,
+		ID:      minDictionaryID + uint32(xxhash.Sum64(content)%(maxDictionaryID-minDictionaryID)),
+		Content: content,
+	}
+}
+
+// LoadDictionary loads the dictionary file, the name of the dictionary is the
+// file name without the extension.
+func LoadDictionary(path string) (*Dictionary, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load compress dictionary: %v", err)
+	}
+	if len(content) < minDictionarySize {
+		return nil, fmt.Errorf("compress dictionary %s is too small: %d", path, len(content))
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return NewDictionary(name, content), nil
+}
+
+// SampleFiles reads the samples of the regular files under root for training
+// the dictionary. The files are filtered by the glob pattern of the file name
+// if it is not empty, at most maxSamples files are picked evenly from the files
+// in lexical order, and at most maxSampleSize bytes are read from each file.
+func SampleFiles(root, pattern string, maxSamples, maxSampleSize int) ([][]byte, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid sample pattern: %s", pattern)
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, d.Name()); !ok {
+				return nil
+			}
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	if maxSamples > 0 && len(paths) > maxSamples {
+		picked := make([]string, 0, maxSamples)
+		for i := 0; i < maxSamples; i++ {
+			picked = append(picked, paths[i*len(paths)/maxSamples])
+		}
+		paths = picked
+	}
+
+	samples := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		sample, err := readSample(path, maxSampleSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(sample) > 0 {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+func readSample(path string, maxSize int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if maxSize > 0 {
+		r = io.LimitReader(f, int64(maxSize))
+	}
+	return io.ReadAll(r)
+}
+
+// dictSegment is a segment of the samples, its score is the sum of the sample
+// counts of the distinct substrings in it.
+type dictSegment struct {
+	sample int
+	offset int
+	score  int
+}
+
+type dictSegmentHeap []*dictSegment
+
+func (h dictSegmentHeap) Len() int           { return len(h) }
+func (h dictSegmentHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h dictSegmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *dictSegmentHeap) Push(x any)        { *h = append(*h, x.(*dictSegment)) }
+func (h *dictSegmentHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// TrainDictionary trains a dictionary of the size from the samples, which is
+// the raw content selected from the samples like the cover algorithm of zstd.
+// The samples are split into segments, the segments containing the substrings
+// shared by the most samples are selected greedily, and the substrings of the
+// selected segments are not counted again. The best segments are put at the
+// end of the dictionary, which are encoded with the smallest offsets.
+func TrainDictionary(samples [][]byte, size int) ([]byte, error) {
+	if size < minDictionarySize {
+		return nil, fmt.Errorf("invalid dictionary size: %d, should be at least %d", size, minDictionarySize)
+	}
+	var total int
+	for _, s := range samples {
+		total += len(s)
+	}
+	if total <= size {
+		return nil, fmt.Errorf("samples are too small to train a dictionary of %d bytes: %d bytes", size, total)
+	}
+
+	// the number of the samples containing each substring
+	counts := make(map[uint64]int)
+	seen := make(map[uint64]struct{})
+	for _, s := range samples {
+		clear(seen)
+		for i := 0; i+dictDmerSize <= len(s); i++ {
+			dmer := binary.LittleEndian.Uint64(s[i:])
+			if _, ok := seen[dmer]; !ok {
+				seen[dmer] = struct{}{}
+				counts[dmer]++
+			}
+		}
+	}
+
+	score := func(seg *dictSegment) int {
+		s := samples[seg.sample]
+		end := min(seg.offset+dictSegmentSize, len(s))
+		clear(seen)
+		var n int
+		for i := seg.offset; i+dictDmerSize <= end; i++ {
+			dmer := binary.LittleEndian.Uint64(s[i:])
+			if _, ok := seen[dmer]; ok {
+				continue
+			}
+			seen[dmer] = struct{}{}
+			// the substrings of only one sample do not help
+			if c := counts[dmer]; c > 1 {
+				n += c
+			}
+		}
+		return n
+	}
+
+	var segments dictSegmentHeap
+	for i, s := range samples {
+		for offset := 0; offset+dictDmerSize <= len(s); offset += dictSegmentSize {
+			seg := &dictSegment{sample: i, offset: offset}
+			if seg.score = score(seg); seg.score > 0 {
+				segments = append(segments, seg)
+			}
+		}
+	}
+	heap.Init(&segments)
+
+	var selected [][]byte
+	remain := size
+	for remain > 0 && segments.Len() > 0 {
+		seg := heap.Pop(&segments).(*dictSegment)
+		// the scores only decrease, the segment is the best if its score is not
+		// less than the stale score of the next one
+		if seg.score = score(seg); seg.score == 0 {
+			continue
+		}
+		if segments.Len() > 0 && seg.score < segments[0].score {
+			heap.Push(&segments, seg)
+			continue
+		}
+
+		s := samples[seg.sample]
+		content := s[seg.offset:min(seg.offset+dictSegmentSize, len(s), seg.offset+remain)]
+		selected = append(selected, content)
+		remain -= len(content)
+		for i := 0; i+dictDmerSize <= len(content); i++ {
+			delete(counts, binary.LittleEndian.Uint64(content[i:]))
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("samples have no common content")
+	}
+
+	dict := make([]byte, 0, size-remain)
+	for i := len(selected) - 1; i >= 0; i-- {
+		dict = append(dict, selected[i]...)
+	}
+	return dict, nil
+}
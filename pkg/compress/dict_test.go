@@ -0,0 +1,147 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionLog generates a small log of a session, the logs of the sessions are
+// similar to each other.
+func sessionLog(r *rand.Rand) []byte {
+	var b bytes.Buffer
+	user := r.Intn(100000)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&b, "2026-10-16 12:%02d:%02d.%03d INFO [session=%08x] user=%d action=%s result=ok latency=%dms\n",
+			r.Intn(60), r.Intn(60), r.Intn(1000), r.Uint32(), user,
+			[]string{"login", "enter_room", "match_start", "match_end", "logout"}[i%5], r.Intn(500))
+	}
+	return b.Bytes()
+}
+
+func TestTrainDictionary(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var samples [][]byte
+	for i := 0; i < 200; i++ {
+		samples = append(samples, sessionLog(r))
+	}
+
+	content, err := TrainDictionary(samples, 4096)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.LessOrEqual(t, len(content), 4096)
+	dict := NewDictionary("session", content)
+
+	data := sessionLog(r)
+	compressWith := func(dict *Dictionary) []byte {
+		var out bytes.Buffer
+		w, err := NewCompressWriter(&out, NewCompressOption(ZSTD, EncoderOptions{Level: LevelBetter, Dictionary: dict}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		return out.Bytes()
+	}
+
+	plain := compressWith(nil)
+	compressed := compressWith(dict)
+	// the random fields of the logs could not be compressed
+	assert.Less(t, len(compressed)*4, len(plain)*3, "dictionary: %d, plain: %d", len(compressed), len(plain))
+
+	// the frames are decompressed with the raw content dictionary
+	dec, err := zstd.NewReader(bytes.NewReader(compressed), zstd.WithDecoderDictRaw(0, content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer dec.Close()
+	got, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	// the dictionary is only supported by ZSTD
+	assert.Error(t, ValidateCompressOption(NewCompressOption(GZIP, EncoderOptions{Dictionary: dict})))
+
+	_, err = TrainDictionary(samples, 100)
+	assert.Error(t, err)
+	_, err = TrainDictionary(samples[:1], 4096)
+	assert.Error(t, err)
+	// the samples without the common content
+	_, err = TrainDictionary([][]byte{[]byte(randStr(1024)), []byte(randStr(1024))}, 1024)
+	assert.Error(t, err)
+}
+
+func TestLoadDictionary(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.dict")
+	content := []byte(randStr(1024))
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dict, err := LoadDictionary(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "session", dict.Name)
+	assert.Equal(t, content, dict.Content)
+	// the id is derived from the content in the range of the user dictionaries
+	assert.Equal(t, NewDictionary("other", content).ID, dict.ID)
+	assert.GreaterOrEqual(t, dict.ID, uint32(minDictionaryID))
+	assert.Less(t, dict.ID, uint32(maxDictionaryID))
+	assert.NotEqual(t, NewDictionary("session", content[1:]).ID, dict.ID)
+
+	if err := os.WriteFile(path, content[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadDictionary(path)
+	assert.Error(t, err)
+	_, err = LoadDictionary(filepath.Join(dir, "nonexistence.dict"))
+	assert.Error(t, err)
+}
+
+func TestSampleFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 10; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("%d", i%2))
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("%d.log", i)), []byte(fmt.Sprintf("sample %d content", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "ignored.txt"), []byte("ignored"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := SampleFiles(dir, "*.log", 0, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, samples, 10)
+	}
+
+	// the samples are picked evenly and truncated
+	samples, err = SampleFiles(dir, "*.log", 5, 8)
+	if assert.NoError(t, err) {
+		assert.Equal(t, [][]byte{[]byte("sample 0"), []byte("sample 4"), []byte("sample 8"), []byte("sample 3"), []byte("sample 7")}, samples)
+	}
+
+	samples, err = SampleFiles(dir, "", 0, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, samples, 11)
+	}
+
+	_, err = SampleFiles(dir, "[", 0, 0)
+	assert.Error(t, err)
+	_, err = SampleFiles(filepath.Join(dir, "nonexistence"), "", 0, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+)
+
+// gzipDefaultLevel is the level used by default, which is the default level
+// of gzip command.
+const gzipDefaultLevel = 6
+
+// gzipWriter is a streaming gzip writer with the pooled writer.
+type gzipWriter struct {
+	zw   *gzip.Writer
+	pool *sync.Pool
+}
+
+func newGzipWriter(w io.Writer, level int) (*gzipWriter, error) {
+	if level == 0 {
+		level = gzipDefaultLevel
+	}
+	pool := &gzipWriterPools[level]
+	zw, _ := pool.Get().(*gzip.Writer)
+	if zw == nil {
+		var err error
+		if zw, err = gzip.NewWriterLevel(w, level); err != nil {
+			return nil, err
+		}
+	} else {
+		zw.Reset(w)
+	}
+	return &gzipWriter{zw: zw, pool: pool}, nil
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return w.zw.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (w *gzipWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return io.Copy(w.zw, r)
+}
+
+// Close flushes the remaining data and returns the writer to the pool.
+func (w *gzipWriter) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	err := w.zw.Close()
+	// the writer must not keep the underlying writer after returned to the pool
+	w.zw.Reset(nil)
+	w.pool.Put(w.zw)
+	w.zw = nil
+	return err
+}
+
+// gzip writer pools of each level
+var gzipWriterPools [gzip.BestCompression + 1]sync.Pool
@@ -0,0 +1,156 @@
+package compress
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"strconv"
+)
+
+// Level is the level of the compression algorithm. The positive levels are the
+// numbers of the algorithm, the named levels are mapped to the numbers of each
+// algorithm, and zero means the default level of the package.
+type Level int
+
+// The named levels, which are fastest, default, better and best in config.
+const (
+	LevelFastest Level = -(iota + 1)
+	LevelDefault
+	LevelBetter
+	LevelBest
+)
+
+var levelNames = map[Level]string{
+	LevelFastest: "fastest",
+	LevelDefault: "default",
+	LevelBetter:  "better",
+	LevelBest:    "best",
+}
+
+// ParseLevel parses the name or the number of the level.
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if s == name {
+			return l, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid compress level: %s", s)
+	}
+	return Level(n), nil
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return strconv.Itoa(int(l))
+}
+
+// MarshalJSON implements json.Marshaler.
+func (l Level) MarshalJSON() ([]byte, error) {
+	if name, ok := levelNames[l]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(l))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the level is a name or a number.
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid compress level: %s", data)
+		}
+		s = strconv.Itoa(n)
+	}
+	level, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// levelRange is the numbers of the levels of an algorithm.
+type levelRange struct {
+	// max is the max number of the level, the algorithm has no levels if it is zero
+	max int
+	// named are the numbers of the named levels
+	named map[Level]int
+}
+
+var levelRanges = map[CompressAlgorithm]levelRange{
+	ZSTD: {max: 22, named: map[Level]int{LevelFastest: 1, LevelDefault: 3, LevelBetter: 7, LevelBest: 11}},
+	GZIP: {max: 9, named: map[Level]int{LevelFastest: 1, LevelDefault: 6, LevelBetter: 8, LevelBest: 9}},
+	LZ4:  {},
+	XZ:   {max: 9, named: map[Level]int{LevelFastest: 1, LevelDefault: 6, LevelBetter: 7, LevelBest: 9}},
+}
+
+// resolveLevel returns the number of the level of the algorithm, zero means
+// the default level of the package.
+func resolveLevel(algorithm CompressAlgorithm, level Level) (int, error) {
+	r, ok := levelRanges[algorithm]
+	if !ok {
+		return 0, ErrUnsupportAlgorithm
+	}
+	if level == 0 {
+		return 0, nil
+	}
+	if level < 0 {
+		if n, ok := r.named[level]; ok {
+			return n, nil
+		}
+	} else if int(level) <= r.max {
+		return int(level), nil
+	}
+	return 0, fmt.Errorf("invalid %s compress level: %s", algorithm, level)
+}
+
+// EncoderOptions are the options of the encoder, zero means the default.
+type EncoderOptions struct {
+	// Level is the level of the compression algorithm
+	Level Level
+	// WindowSize is the window size of the ZSTD encoder, it must be a power of
+	// 2 between 1KB and 512MB
+	WindowSize int
+	// Concurrency is the number of the goroutines compressing the blocks of the
+	// ZSTD encoder, GOMAXPROCS by default
+	Concurrency int
+	// Dictionary is the dictionary of the ZSTD encoder
+	Dictionary *Dictionary
+	// Parallel is the number of the blocks of a stream compressed in parallel,
+	// the blocks are compressed into independent frames, it is disabled if not
+	// greater than 1. It is supported by all the algorithms.
+	Parallel int
+}
+
+const (
+	minWindowSize = 1 << 10
+	maxWindowSize = 1 << 29
+)
+
+// validate checks the options of the algorithm.
+func (o EncoderOptions) validate(algorithm CompressAlgorithm) error {
+	if _, err := resolveLevel(algorithm, o.Level); err != nil {
+		return err
+	}
+	if o.Parallel < 0 {
+		return fmt.Errorf("invalid compress parallel: %d", o.Parallel)
+	}
+	if o.WindowSize == 0 && o.Concurrency == 0 && o.Dictionary == nil {
+		return nil
+	}
+	if algorithm != ZSTD {
+		return fmt.Errorf("window size, concurrency and dictionary are not supported by %s", algorithm)
+	}
+	if o.WindowSize != 0 && (o.WindowSize < minWindowSize || o.WindowSize > maxWindowSize || bits.OnesCount(uint(o.WindowSize)) != 1) {
+		return fmt.Errorf("invalid compress window size: %d, should be a power of 2 between %d and %d", o.WindowSize, minWindowSize, maxWindowSize)
+	}
+	if o.Concurrency < 0 {
+		return fmt.Errorf("invalid compress concurrency: %d", o.Concurrency)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package compress
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    Level
+		wantErr bool
+	}{
+		{`"fastest"`, LevelFastest, false},
+		{`"default"`, LevelDefault, false},
+		{`"better"`, LevelBetter, false},
+		{`"best"`, LevelBest, false},
+		{`"19"`, 19, false},
+		{`3`, 3, false},
+		{`0`, 0, false},
+		{`-1`, 0, true},
+		{`"slowest"`, 0, true},
+		{`true`, 0, true},
+	}
+
+	for _, tt := range tests {
+		var l Level
+		err := json.Unmarshal([]byte(tt.data), &l)
+		if tt.wantErr {
+			assert.Error(t, err, tt.data)
+			continue
+		}
+		if assert.NoError(t, err, tt.data) {
+			assert.Equal(t, tt.want, l, tt.data)
+		}
+	}
+
+	data, err := json.Marshal([]Level{LevelBest, 3})
+	if assert.NoError(t, err) {
+		assert.Equal(t, `["best",3]`, string(data))
+	}
+}
+
+func TestResolveLevel(t *testing.T) {
+	n, err := resolveLevel(ZSTD, LevelBetter)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+	n, err = resolveLevel(GZIP, LevelDefault)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	n, err = resolveLevel(GZIP, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = resolveLevel("unknown", 0)
+	assert.ErrorIs(t, err, ErrUnsupportAlgorithm)
+	_, err = resolveLevel(LZ4, LevelFastest)
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package compress
+
+import (
+	"io"
+	"sync"
+
+	"github.com/pierrec/lz4/v4"
+)
+
+// lz4WriterPool reuses the lz4 writers, the frames are encoded in independent
+// blocks of 4MB with the content checksum.
+var lz4WriterPool sync.Pool
+
+// lz4Writer is a streaming writer of the lz4 frame format with the pooled
+// writer.
+type lz4Writer struct {
+	zw *lz4.Writer
+}
+
+func newLz4Writer(w io.Writer) (*lz4Writer, error) {
+	zw, _ := lz4WriterPool.Get().(*lz4.Writer)
+	if zw == nil {
+		zw = lz4.NewWriter(w)
+		// the blocks are compressed by the caller goroutine, Parallel is used
+		// for the concurrency like the other algorithms
+		if err := zw.Apply(lz4.BlockSizeOption(lz4.Block4Mb), lz4.ChecksumOption(true), lz4.ConcurrencyOption(1)); err != nil {
+			return nil, err
+		}
+	} else {
+		zw.Reset(w)
+	}
+	return &lz4Writer{zw: zw}, nil
+}
+
+func (w *lz4Writer) Write(p []byte) (int, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return w.zw.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (w *lz4Writer) ReadFrom(r io.Reader) (int64, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return w.zw.ReadFrom(r)
+}
+
+// Close flushes the remaining data, ends the frame and returns the writer to
+// the pool.
+func (w *lz4Writer) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	err := w.zw.Close()
+	// the writer must not keep the underlying writer after returned to the pool
+	w.zw.Reset(nil)
+	lz4WriterPool.Put(w.zw)
+	w.zw = nil
+	return err
+}
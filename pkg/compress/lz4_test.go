@@ -0,0 +1,84 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"testing"
+
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// lz4Decode decodes the concatenated lz4 frames written by lz4Writer, the
+// reader of lz4 package only decodes a frame.
+func lz4Decode(data []byte) ([]byte, error) {
+	src := bytes.NewReader(data)
+	zr := lz4.NewReader(src)
+	var out []byte
+	for {
+		frame, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, frame...)
+		if src.Len() == 0 {
+			return out, nil
+		}
+		zr.Reset(src)
+	}
+}
+
+func TestLz4Writer(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", []byte("hello")},
+		{"repeated", bytes.Repeat([]byte("hello world "), 1<<20)},
+		{"long match", append(bytes.Repeat([]byte{0}, 70000), []byte(randStr(300))...)},
+		{"incompressible", []byte(randStr(4<<20 + 100))},
+	}
+
+	// the frames are also decoded by the lz4 command, the reference
+	// implementation of the format
+	lz4Cmd, _ := exec.LookPath("lz4")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w, err := NewCompressWriter(&out, NewDefaultCompressOption(LZ4))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = w.Write(tt.data)
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+
+			got, err := lz4Decode(out.Bytes())
+			if assert.NoError(t, err) {
+				assert.True(t, bytes.Equal(tt.data, got), "decompressed data mismatched")
+			}
+
+			if lz4Cmd == "" {
+				return
+			}
+			cmd := exec.Command(lz4Cmd, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(out.Bytes())
+			got, err = cmd.Output()
+			if assert.NoError(t, err) {
+				assert.True(t, bytes.Equal(tt.data, got), "decompressed data of lz4 command mismatched")
+			}
+		})
+	}
+
+	// the error of the writer is kept
+	w, err := NewCompressWriter(&errorWriter{}, NewDefaultCompressOption(LZ4))
+	if assert.NoError(t, err) {
+		_, err = w.Write(make([]byte, 4<<20))
+		assert.Error(t, err)
+		_, err = w.Write([]byte("data"))
+		assert.Error(t, err)
+		assert.Error(t, w.Close())
+	}
+}
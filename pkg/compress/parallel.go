@@ -0,0 +1,186 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// parallelBlockSize is the size of the blocks compressed in parallel.
+const parallelBlockSize = 8 << 20
+
+// parallelBlock is a block of the data compressed by a goroutine.
+type parallelBlock struct {
+	data []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+var parallelBlockPool = sync.Pool{
+	New: func() any {
+		return &parallelBlock{data: make([]byte, 0, parallelBlockSize)}
+	},
+}
+
+// parallelWriter compresses the blocks of the data by the goroutines in parallel
+// like pgzip, so that a large file is compressed by multiple cores. Each block is
+// compressed into independent frames, which are written in order and decompressed
+// as one stream, since the concatenated frames are valid for all the algorithms.
+type parallelWriter struct {
+	w      io.Writer
+	option CompressOption
+
+	block   *parallelBlock
+	written bool
+	// pending are the blocks being compressed in order
+	pending chan *parallelBlock
+	done    chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+func newParallelWriter(w io.Writer, option CompressOption, parallel int) *parallelWriter {
+	pw := &parallelWriter{
+		w:      w,
+		option: option,
+		// the block being written out is not in the channel
+		pending: make(chan *parallelBlock, parallel-1),
+		done:    make(chan struct{}),
+	}
+	go pw.writeBlocks()
+	return pw
+}
+
+// writeBlocks writes the compressed blocks in order.
+func (pw *parallelWriter) writeBlocks() {
+	defer close(pw.done)
+	for b := range pw.pending {
+		<-b.done
+		err := b.err
+		if err == nil && pw.error() == nil {
+			_, err = b.out.WriteTo(pw.w)
+		}
+		if err != nil {
+			pw.setError(err)
+		}
+		b.data = b.data[:0]
+		b.out.Reset()
+		parallelBlockPool.Put(b)
+	}
+}
+
+func (pw *parallelWriter) error() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+func (pw *parallelWriter) setError(err error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.err == nil {
+		pw.err = err
+	}
+}
+
+// submit compresses the current block by a goroutine.
+func (pw *parallelWriter) submit() {
+	b := pw.block
+	pw.block = nil
+	pw.written = true
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		w, err := NewCompressWriter(&b.out, pw.option)
+		if err != nil {
+			b.err = err
+			return
+		}
+		if _, err := w.Write(b.data); err != nil {
+			_ = w.Close()
+			b.err = err
+			return
+		}
+		b.err = w.Close()
+	}()
+	pw.pending <- b
+}
+
+// buffer returns the free space of the current block.
+func (pw *parallelWriter) buffer() []byte {
+	if pw.block == nil {
+		pw.block = parallelBlockPool.Get().(*parallelBlock)
+	}
+	return pw.block.data[len(pw.block.data):cap(pw.block.data)]
+}
+
+func (pw *parallelWriter) Write(p []byte) (int, error) {
+	if pw.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	var n int
+	for len(p) > 0 {
+		if err := pw.error(); err != nil {
+			return n, err
+		}
+		m := copy(pw.buffer(), p)
+		pw.block.data = pw.block.data[:len(pw.block.data)+m]
+		n += m
+		p = p[m:]
+		if len(pw.block.data) == cap(pw.block.data) {
+			pw.submit()
+		}
+	}
+	return n, nil
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (pw *parallelWriter) ReadFrom(r io.Reader) (int64, error) {
+	if pw.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	var n int64
+	for {
+		if err := pw.error(); err != nil {
+			return n, err
+		}
+		m, err := io.ReadFull(r, pw.buffer())
+		pw.block.data = pw.block.data[:len(pw.block.data)+m]
+		n += int64(m)
+		if len(pw.block.data) == cap(pw.block.data) {
+			pw.submit()
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close compresses the remaining data and waits for the blocks to be written.
+func (pw *parallelWriter) Close() error {
+	if pw.closed {
+		return nil
+	}
+	pw.closed = true
+
+	// the empty data is compressed into an empty frame
+	if (pw.block != nil && len(pw.block.data) > 0) || !pw.written {
+		pw.buffer()
+		pw.submit()
+	}
+	if pw.block != nil {
+		parallelBlockPool.Put(pw.block)
+		pw.block = nil
+	}
+	close(pw.pending)
+	<-pw.done
+	return pw.error()
+}
@@ -0,0 +1,84 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelWriter(t *testing.T) {
+	// lines of the random and repeated content across several blocks
+	var data []byte
+	line := []byte(randStr(200) + "\n")
+	for len(data) < 2*parallelBlockSize+12345 {
+		data = append(data, line...)
+		if len(data)%7 == 0 {
+			line = []byte(randStr(200) + "\n")
+		}
+	}
+
+	for _, algorithm := range []CompressAlgorithm{ZSTD, GZIP, LZ4} {
+		for _, readFrom := range []bool{false, true} {
+			option := NewCompressOption(algorithm, EncoderOptions{Parallel: 3})
+			var out bytes.Buffer
+			w, err := NewCompressWriter(&out, option)
+			if !assert.NoError(t, err) {
+				continue
+			}
+			assert.IsType(t, &parallelWriter{}, w)
+
+			if readFrom {
+				_, err = io.Copy(w, bytes.NewReader(data))
+			} else {
+				for i := 0; i < len(data) && err == nil; i += 1 << 20 {
+					_, err = w.Write(data[i:min(i+1<<20, len(data))])
+				}
+			}
+			assert.NoError(t, err, algorithm)
+			assert.NoError(t, w.Close(), algorithm)
+			assert.NoError(t, w.Close(), algorithm)
+			_, err = w.Write([]byte("closed"))
+			assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+			got := decompress(t, algorithm, &out)
+			assert.True(t, bytes.Equal(data, got), "%s decompressed data mismatched", algorithm)
+		}
+	}
+}
+
+func TestParallelWriterEmpty(t *testing.T) {
+	for _, algorithm := range []CompressAlgorithm{ZSTD, GZIP, LZ4} {
+		var out bytes.Buffer
+		w, err := NewCompressWriter(&out, NewCompressOption(algorithm, EncoderOptions{Parallel: 2}))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.NoError(t, w.Close())
+		assert.Empty(t, decompress(t, algorithm, &out), algorithm)
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestParallelWriterError(t *testing.T) {
+	w, err := NewCompressWriter(errWriter{}, NewCompressOption(ZSTD, EncoderOptions{Parallel: 2}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data := []byte(randStr(parallelBlockSize))
+	for i := 0; i < 8 && err == nil; i++ {
+		_, err = w.Write(data)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	assert.EqualError(t, err, "write failed")
+}
@@ -0,0 +1,204 @@
+package compress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultProbeSampleSize is the default size of the sample of the file
+	DefaultProbeSampleSize = 4 << 20
+	// DefaultProbeMinThroughput is the default min throughput of the selected
+	// algorithm, in bytes per second
+	DefaultProbeMinThroughput = 50 << 20
+
+	// probeChunkSize is the size of the chunks read evenly from the file
+	probeChunkSize = 1 << 20
+	// probeMinDuration is the min time of compressing the sample repeatedly,
+	// so that the throughput of the small samples is measured stably
+	probeMinDuration = 50 * time.Millisecond
+)
+
+// ProbeCandidate is an algorithm and a level to probe.
+type ProbeCandidate struct {
+	Algorithm CompressAlgorithm `json:"algorithm"`
+	Level     Level             `json:"level,omitempty"`
+}
+
+// ProbeCandidates returns the supported algorithms with the named levels, xz
+// is not probed since it is much slower than the min throughput.
+func ProbeCandidates() []ProbeCandidate {
+	var candidates []ProbeCandidate
+	for _, algorithm := range []CompressAlgorithm{ZSTD, LZ4, GZIP} {
+		if len(levelRanges[algorithm].named) == 0 {
+			candidates = append(candidates, ProbeCandidate{Algorithm: algorithm})
+			continue
+		}
+		for _, level := range []Level{LevelFastest, LevelDefault, LevelBetter, LevelBest} {
+			candidates = append(candidates, ProbeCandidate{Algorithm: algorithm, Level: level})
+		}
+	}
+	return candidates
+}
+
+// ProbeOptions are the options of Probe, zero means the default.
+type ProbeOptions struct {
+	// SampleSize is the max size of the sample read from the file
+	SampleSize int64
+	// Candidates are the algorithms and the levels to probe, ProbeCandidates by default
+	Candidates []ProbeCandidate
+}
+
+// ProbeResult is the result of compressing the sample with a candidate.
+type ProbeResult struct {
+	ProbeCandidate
+	// Size is the size of the sample
+	Size int64 `json:"size"`
+	// CompressedSize is the size of the compressed sample
+	CompressedSize int64 `json:"compressedSize"`
+	// Duration is the time of compressing the sample once
+	Duration time.Duration `json:"durationNs"`
+}
+
+// Ratio returns the size of the sample divided by the compressed size.
+func (r ProbeResult) Ratio() float64 {
+	if r.CompressedSize == 0 {
+		return 0
+	}
+	return float64(r.Size) / float64(r.CompressedSize)
+}
+
+// Throughput returns the bytes of the sample compressed per second.
+func (r ProbeResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Size) / r.Duration.Seconds()
+}
+
+// Probe compresses a sample of the file with each candidate, and reports the
+// compression ratio and the throughput. The sample is the whole file if it is
+// not larger than SampleSize, or the chunks read evenly from the file.
+func Probe(path string, opts ProbeOptions) ([]ProbeResult, error) {
+	sample, err := readProbeSample(path, opts.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+	return ProbeData(sample, opts.Candidates)
+}
+
+// ProbeData compresses the sample with each candidate, ProbeCandidates are used
+// if candidates is empty.
+func ProbeData(sample []byte, candidates []ProbeCandidate) ([]ProbeResult, error) {
+	if len(sample) == 0 {
+		return nil, fmt.Errorf("probe sample is empty")
+	}
+	if len(candidates) == 0 {
+		candidates = ProbeCandidates()
+	}
+
+	results := make([]ProbeResult, 0, len(candidates))
+	for _, c := range candidates {
+		r, err := probe(sample, c)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+func probe(sample []byte, c ProbeCandidate) (ProbeResult, error) {
+	option := NewCompressOption(c.Algorithm, EncoderOptions{Level: c.Level})
+	r := ProbeResult{ProbeCandidate: c, Size: int64(len(sample))}
+
+	var runs int
+	var total time.Duration
+	for runs == 0 || total < probeMinDuration {
+		var out countWriter
+		begin := time.Now()
+		w, err := NewCompressWriter(&out, option)
+		if err != nil {
+			return r, err
+		}
+		if _, err := w.Write(sample); err != nil {
+			_ = w.Close()
+			return r, err
+		}
+		if err := w.Close(); err != nil {
+			return r, err
+		}
+		total += time.Since(begin)
+		runs++
+		r.CompressedSize = out.n
+	}
+	r.Duration = total / time.Duration(runs)
+	return r, nil
+}
+
+// Select selects the result of the best ratio among the ones not slower than
+// minThroughput, or the fastest one if all of them are slower.
+func Select(results []ProbeResult, minThroughput float64) (ProbeResult, bool) {
+	var best, fastest *ProbeResult
+	for i := range results {
+		r := &results[i]
+		if fastest == nil || r.Throughput() > fastest.Throughput() {
+			fastest = r
+		}
+		if r.Throughput() >= minThroughput && (best == nil || r.Ratio() > best.Ratio()) {
+			best = r
+		}
+	}
+	if best == nil {
+		best = fastest
+	}
+	if best == nil {
+		return ProbeResult{}, false
+	}
+	return *best, true
+}
+
+// readProbeSample reads the whole file if it is not larger than size, or the
+// chunks of the file at the even offsets.
+func readProbeSample(path string, size int64) ([]byte, error) {
+	if size <= 0 {
+		size = DefaultProbeSampleSize
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() <= size {
+		return io.ReadAll(f)
+	}
+
+	chunk := min(size, probeChunkSize)
+	chunks := size / chunk
+	sample := make([]byte, chunks*chunk)
+	for i := int64(0); i < chunks; i++ {
+		offset := i * (info.Size() - chunk) / max(chunks-1, 1)
+		if _, err := f.ReadAt(sample[i*chunk:(i+1)*chunk], offset); err != nil {
+			return nil, err
+		}
+	}
+	return sample, nil
+}
+
+// countWriter counts the bytes written into it.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,95 @@
+package compress
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbe(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var data []byte
+	for len(data) < 256<<10 {
+		data = append(data, sessionLog(r)...)
+	}
+	path := filepath.Join(t.TempDir(), "a.log")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := []ProbeCandidate{{Algorithm: ZSTD, Level: LevelFastest}, {Algorithm: LZ4}, {Algorithm: GZIP, Level: LevelBest}}
+	results, err := Probe(path, ProbeOptions{Candidates: candidates})
+	if !assert.NoError(t, err) || !assert.Len(t, results, len(candidates)) {
+		return
+	}
+	for i, r := range results {
+		assert.Equal(t, candidates[i], r.ProbeCandidate)
+		assert.Equal(t, int64(len(data)), r.Size)
+		assert.Greater(t, r.Ratio(), 1.0, r.Algorithm)
+		assert.Greater(t, r.Throughput(), 0.0, r.Algorithm)
+	}
+
+	// the sample of the large file is read evenly
+	results, err = Probe(path, ProbeOptions{SampleSize: 64 << 10, Candidates: candidates[:1]})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(64<<10), results[0].Size)
+	}
+
+	_, err = Probe(path, ProbeOptions{Candidates: []ProbeCandidate{{Algorithm: LZ4, Level: 1}}})
+	assert.Error(t, err)
+	_, err = ProbeData(nil, nil)
+	assert.Error(t, err)
+}
+
+func TestProbeCandidates(t *testing.T) {
+	candidates := ProbeCandidates()
+	assert.Len(t, candidates, 9)
+	for _, c := range candidates {
+		assert.NoError(t, ValidateCompressOption(NewCompressOption(c.Algorithm, EncoderOptions{Level: c.Level})))
+	}
+}
+
+func TestReadProbeSample(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1<<20)
+	path := filepath.Join(t.TempDir(), "a.log")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sample, err := readProbeSample(path, 3<<20)
+	if assert.NoError(t, err) && assert.Len(t, sample, 3<<20) {
+		// the first and the last chunks of the file
+		assert.Equal(t, data[:probeChunkSize], sample[:probeChunkSize])
+		assert.Equal(t, data[len(data)-probeChunkSize:], sample[2*probeChunkSize:])
+	}
+	sample, err = readProbeSample(path, 0)
+	if assert.NoError(t, err) {
+		assert.Len(t, sample, DefaultProbeSampleSize)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	result := func(algorithm CompressAlgorithm, compressed int64, duration time.Duration) ProbeResult {
+		return ProbeResult{ProbeCandidate: ProbeCandidate{Algorithm: algorithm}, Size: 100 << 20, CompressedSize: compressed, Duration: duration}
+	}
+	results := []ProbeResult{
+		result(LZ4, 40<<20, 100*time.Millisecond),
+		result(ZSTD, 20<<20, time.Second),
+		result(GZIP, 10<<20, 10*time.Second),
+	}
+
+	r, ok := Select(results, 50<<20)
+	assert.True(t, ok)
+	assert.Equal(t, ZSTD, r.Algorithm)
+	r, _ = Select(results, 0)
+	assert.Equal(t, GZIP, r.Algorithm)
+	r, _ = Select(results, 1<<30)
+	assert.Equal(t, LZ4, r.Algorithm)
+	_, ok = Select(nil, 0)
+	assert.False(t, ok)
+}
@@ -0,0 +1,67 @@
+package compress
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// xzDefaultLevel is the level used by default, which is the default preset of
+// xz command.
+const xzDefaultLevel = 6
+
+// xzDictCaps are the dictionary sizes of the levels, which are the same as the
+// presets of xz command, the encoder has no other parameters of the level.
+var xzDictCaps = [...]int{
+	1: 1 << 20,
+	2: 2 << 20,
+	3: 4 << 20,
+	4: 4 << 20,
+	5: 8 << 20,
+	6: 8 << 20,
+	7: 16 << 20,
+	8: 32 << 20,
+	9: 64 << 20,
+}
+
+// xzWriter is a streaming xz writer, the encoder can't be reset so it is not
+// pooled like the others.
+type xzWriter struct {
+	zw *xz.Writer
+}
+
+func newXzWriter(w io.Writer, level int) (*xzWriter, error) {
+	if level == 0 {
+		level = xzDefaultLevel
+	}
+	zw, err := xz.WriterConfig{DictCap: xzDictCaps[level]}.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &xzWriter{zw: zw}, nil
+}
+
+func (w *xzWriter) Write(p []byte) (int, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return w.zw.Write(p)
+}
+
+// ReadFrom implements io.ReaderFrom.
+func (w *xzWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.zw == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return io.Copy(w.zw, r)
+}
+
+// Close flushes the remaining data.
+func (w *xzWriter) Close() error {
+	if w.zw == nil {
+		return nil
+	}
+	err := w.zw.Close()
+	w.zw = nil
+	return err
+}
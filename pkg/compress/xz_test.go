@@ -0,0 +1,81 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+func TestXzWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		data  []byte
+	}{
+		{"empty", 0, nil},
+		{"short", 0, []byte("hello")},
+		{"repeated", LevelFastest, bytes.Repeat([]byte("hello world "), 1<<18)},
+		{"random", LevelBest, []byte(randStr(1<<20 + 100))},
+	}
+
+	// the streams are also decoded by the xz command, the reference
+	// implementation of the format
+	xzCmd, _ := exec.LookPath("xz")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w, err := NewCompressWriter(&out, NewCompressOption(XZ, EncoderOptions{Level: tt.level}))
+			if !assert.NoError(t, err) {
+				return
+			}
+			_, err = io.Copy(w, bytes.NewReader(tt.data))
+			assert.NoError(t, err)
+			assert.NoError(t, w.Close())
+			assert.NoError(t, w.Close())
+			_, err = w.Write([]byte("closed"))
+			assert.ErrorIs(t, err, io.ErrClosedPipe)
+
+			zr, err := xz.NewReader(bytes.NewReader(out.Bytes()))
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, err := io.ReadAll(zr)
+			if assert.NoError(t, err) {
+				assert.True(t, bytes.Equal(tt.data, got), "decompressed data mismatched")
+			}
+
+			if xzCmd == "" {
+				return
+			}
+			cmd := exec.Command(xzCmd, "-d", "-c")
+			cmd.Stdin = bytes.NewReader(out.Bytes())
+			got, err = cmd.Output()
+			if assert.NoError(t, err) {
+				assert.True(t, bytes.Equal(tt.data, got), "decompressed data of xz command mismatched")
+			}
+		})
+	}
+
+	// the streams of the parallel writer are concatenated
+	data := []byte(randStr(maxChunkSize + 100))
+	var out bytes.Buffer
+	w, err := NewCompressWriter(&out, NewCompressOption(XZ, EncoderOptions{Level: LevelFastest, Parallel: 2}))
+	if assert.NoError(t, err) {
+		_, err = w.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		zr, err := xz.NewReader(&out)
+		if assert.NoError(t, err) {
+			got, err := io.ReadAll(zr)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(data, got), "decompressed data mismatched")
+		}
+	}
+
+	assert.Error(t, ValidateCompressOption(NewCompressOption(XZ, EncoderOptions{Level: 10})))
+	assert.Error(t, ValidateCompressOption(NewCompressOption(XZ, EncoderOptions{WindowSize: 1 << 20})))
+}
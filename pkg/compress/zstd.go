@@ -1,7 +1,6 @@
 package compress
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"sync"
@@ -9,79 +8,92 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
-func zstdCompress(r io.Reader, out io.Writer, option CompressOption) error {
-	enc := zstdEncoderPool.Get().(*zstd.Encoder)
-	if enc == nil {
-		return fmt.Errorf("malloc zstd encoder failed")
+// zstdWriter is a streaming zstd writer with the pooled encoder.
+type zstdWriter struct {
+	enc  *zstd.Encoder
+	pool *sync.Pool
+}
+
+// zstdEncoderLevel returns the encoder level of the zstd level, the fastest
+// level is used by default.
+func zstdEncoderLevel(level int) zstd.EncoderLevel {
+	if level == 0 {
+		return zstd.SpeedFastest
 	}
-	defer zstdEncoderPool.Put(enc)
-	enc.Reset(out)
+	return zstd.EncoderLevelFromZstd(level)
+}
 
-	buf := bytes.NewBuffer(make([]byte, 0, maxChunkSize))
-	tr := io.TeeReader(r, buf)
-	chunk := make([]byte, 4096)
+// zstdEncoderKey is the options of the pooled encoders.
+type zstdEncoderKey struct {
+	level       zstd.EncoderLevel
+	windowSize  int
+	concurrency int
+	dictID      uint32
+}
 
-	var n int
-	var err error
+func zstdEncoderOptions(level zstd.EncoderLevel, encoder EncoderOptions) []zstd.EOption {
+	opts := []zstd.EOption{zstd.WithEncoderLevel(level), zstd.WithLowerEncoderMem(true)}
+	if encoder.WindowSize > 0 {
+		opts = append(opts, zstd.WithWindowSize(encoder.WindowSize))
+	}
+	if encoder.Concurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(encoder.Concurrency))
+	}
+	if encoder.Dictionary != nil {
+		// the dictionary id is not written into the frames, the zstd command
+		// rejects the frames of the raw content dictionary with id
+		opts = append(opts, zstd.WithEncoderDictRaw(0, encoder.Dictionary.Content))
+	}
+	return opts
+}
 
-	for {
-		n, err = tr.Read(chunk[:])
-		switch {
-		case err == io.EOF:
-			if n == 0 {
-				// Compress remaining data and exit
-				if buf.Len() > 0 {
-					if err := compressBuffer(enc, buf); err != nil {
-						return handleEncoderError(enc, err)
-					}
-				}
-				return enc.Close()
-			}
-			err = nil
-		case err != nil:
-			return handleEncoderError(enc, err)
-		}
+func newZstdWriter(w io.Writer, level int, encoder EncoderOptions) (*zstdWriter, error) {
+	key := zstdEncoderKey{level: zstdEncoderLevel(level), windowSize: encoder.WindowSize, concurrency: encoder.Concurrency}
+	if encoder.Dictionary != nil {
+		key.dictID = encoder.Dictionary.ID
+	}
+	p, _ := zstdEncoderPools.LoadOrStore(key, &sync.Pool{})
+	pool := p.(*sync.Pool)
 
-		// limit memory usage
-		if option.MaxWriterBuffSize() > 0 && buf.Len() > option.MaxWriterBuffSize() {
-			err = ErrUnexpectedEOF
-			return handleEncoderError(enc, err)
+	enc, _ := pool.Get().(*zstd.Encoder)
+	if enc == nil {
+		var err error
+		enc, err = zstd.NewWriter(nil, zstdEncoderOptions(key.level, encoder)...)
+		if err != nil {
+			return nil, fmt.Errorf("malloc zstd encoder failed: %v", err)
 		}
+	}
+	enc.Reset(w)
+	return &zstdWriter{enc: enc, pool: pool}, nil
+}
 
-		if buf.Len() >= maxChunkSize {
-			if err := compressBuffer(enc, buf); err != nil {
-				return handleEncoderError(enc, err)
-			}
-		}
+func (w *zstdWriter) Write(p []byte) (int, error) {
+	if w.enc == nil {
+		return 0, io.ErrClosedPipe
 	}
+	return w.enc.Write(p)
 }
 
-// compressBuffer compresses data from buffer and resets it
-func compressBuffer(enc *zstd.Encoder, buf *bytes.Buffer) error {
-	if _, err := enc.ReadFrom(buf); err != nil {
-		return err
+// ReadFrom implements io.ReaderFrom.
+func (w *zstdWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.enc == nil {
+		return 0, io.ErrClosedPipe
 	}
-	buf.Reset()
-	return enc.Flush()
+	return w.enc.ReadFrom(r)
 }
 
-// handleEncoderError properly closes encoder and wraps errors
-func handleEncoderError(enc *zstd.Encoder, err error) error {
-	if closeErr := enc.Close(); closeErr != nil {
-		return fmt.Errorf("%w; encoder close error: %v", err, closeErr)
+// Close flushes the remaining data and returns the encoder to the pool.
+func (w *zstdWriter) Close() error {
+	if w.enc == nil {
+		return nil
 	}
+	err := w.enc.Close()
+	// the encoder must not keep the writer after returned to the pool
+	w.enc.Reset(nil)
+	w.pool.Put(w.enc)
+	w.enc = nil
 	return err
 }
 
-var (
-	// zstd encoder pool
-	zstdEncoderPool = sync.Pool{
-		New: func() any {
-			enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithLowerEncoderMem(true))
-			if err != nil {
-				return nil
-			}
-			return enc
-		},
-	}
-)
+// zstd encoder pools of each zstdEncoderKey
+var zstdEncoderPools sync.Map
@@ -0,0 +1,96 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// envPattern matches the ${ENV_VAR} and ${ENV_VAR:-default} placeholders, "$${"
+// is an escaped "${".
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// LoadJSON loads YAML or JSON document from file and converts it into JSON. The
+// ${ENV_VAR} placeholders in the string values are replaced by the environment
+// variables, so that the secrets are not written in the file. The duplicate keys
+// are rejected, e.g. the same archive configured twice in a merged file.
+func LoadJSON(name string) ([]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = yaml.YAMLToJSONStrict(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	if doc, err = expandEnv(doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// expandEnv expands the placeholders in the string values of the decoded document.
+func expandEnv(v any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		return ExpandEnv(v)
+	case []any:
+		for i := range v {
+			e, err := expandEnv(v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	case map[string]any:
+		for k := range v {
+			e, err := expandEnv(v[k])
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+	}
+	return v, nil
+}
+
+// ExpandEnv replaces the ${ENV_VAR} placeholders in s by the environment variables,
+// it fails if the variable is not set. ${ENV_VAR:-default} is replaced by the
+// default if the variable is not set or empty. "$${ENV_VAR}" is kept as "${ENV_VAR}".
+func ExpandEnv(s string) (string, error) {
+	var err error
+	s = envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+
+		sub := envPattern.FindStringSubmatch(m)
+		name, def := sub[1], sub[2]
+		val, ok := os.LookupEnv(name)
+		if def != "" {
+			if val == "" {
+				val = strings.TrimPrefix(def, ":-")
+			}
+			return val
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return val
+	})
+	return s, err
+}
@@ -0,0 +1,76 @@
+package yaml
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadJSON(t *testing.T) {
+	t.Setenv("CONFPARSER_SECRET", "s3cret")
+
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(name, []byte(`
+archives:
+  file:
+    paths: [/data/log]
+    excludeFiles: ['\.tmp$', '$${HOME}']
+    poolSize: 4
+    output:
+      type: cos
+      secretKey: ${CONFPARSER_SECRET}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := LoadJSON(name)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{"archives": {"file": {
+			"paths": ["/data/log"],
+			"excludeFiles": ["\\.tmp$", "${HOME}"],
+			"poolSize": 4,
+			"output": {"type": "cos", "secretKey": "s3cret"}
+		}}}`, string(data))
+	}
+
+	// the json document is accepted as it is
+	if err := os.WriteFile(name, []byte(`{"poolSize": 12345678901234567890}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, err = LoadJSON(name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"poolSize":12345678901234567890}`, string(data))
+	}
+
+	// the duplicate keys are rejected instead of the last one wins
+	if err := os.WriteFile(name, []byte(`
+archives:
+  file:
+    paths: [/data/log]
+  file:
+    paths: [/data/log2]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadJSON(name)
+	assert.ErrorContains(t, err, `key "file" already set`)
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("CONFPARSER_A", "a")
+
+	s, err := ExpandEnv("${CONFPARSER_A}/$CONFPARSER_A/$${CONFPARSER_A}")
+	assert.NoError(t, err)
+	assert.Equal(t, "a/$CONFPARSER_A/${CONFPARSER_A}", s)
+
+	_, err = ExpandEnv("${CONFPARSER_NOT_SET}")
+	assert.ErrorContains(t, err, "CONFPARSER_NOT_SET is not set")
+
+	// the default is used if the variable is not set or empty
+	t.Setenv("CONFPARSER_EMPTY", "")
+	s, err = ExpandEnv("${CONFPARSER_A:-x}|${CONFPARSER_NOT_SET:-http://b:80/c}|${CONFPARSER_EMPTY:-e}|${CONFPARSER_NOT_SET:-}|$${CONFPARSER_A:-x}")
+	assert.NoError(t, err)
+	assert.Equal(t, "a|http://b:80/c|e||${CONFPARSER_A:-x}", s)
+}
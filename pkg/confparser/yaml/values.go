@@ -0,0 +1,116 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// sopsCommandEnv is the environment variable of the sops command, "sops" in
+// PATH by default.
+const sopsCommandEnv = "ATDTOOL_SOPS"
+
+// ValuesOptions are the options of loading the values files.
+type ValuesOptions struct {
+	// ExpandEnv expands the ${ENV_VAR} and ${ENV_VAR:-default} placeholders in
+	// the string values
+	ExpandEnv bool
+	// Decrypt decrypts the SOPS-encrypted files by the sops command, the other
+	// files are loaded as they are
+	Decrypt bool
+}
+
+// LoadValues loads the values file by the options.
+func LoadValues(name string, opts ValuesOptions) (map[string]any, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseValues(name, data, opts)
+}
+
+// ParseValues parses the values document, name is the file of the data, it is
+// empty if the data is not read from a file. The numbers are decoded as
+// json.Number.
+func ParseValues(name string, data []byte, opts ValuesOptions) (map[string]any, error) {
+	vals, err := unmarshalValues(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Decrypt && isSOPSEncrypted(vals) {
+		if data, err = decryptSOPS(name, data); err != nil {
+			return nil, err
+		}
+		if vals, err = unmarshalValues(data); err != nil {
+			return nil, fmt.Errorf("parse decrypted values: %v", err)
+		}
+	}
+
+	if opts.ExpandEnv {
+		if _, err := expandEnv(vals); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func unmarshalValues(data []byte) (map[string]any, error) {
+	vals := make(map[string]any)
+	err := yaml.UnmarshalStrict(data, &vals, func(d *json.Decoder) *json.Decoder {
+		d.UseNumber()
+		return d
+	})
+	return vals, err
+}
+
+// isSOPSEncrypted reports whether the document is encrypted by SOPS, which
+// has the metadata in the top-level "sops" key.
+func isSOPSEncrypted(vals map[string]any) bool {
+	m, ok := vals["sops"].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, ok = m["mac"]
+	return ok
+}
+
+// decryptSOPS decrypts the document by the sops command, so that all the key
+// services of SOPS (age, KMS, PGP, ...) are supported with its own configuration.
+func decryptSOPS(name string, data []byte) ([]byte, error) {
+	command := os.Getenv(sopsCommandEnv)
+	if command == "" {
+		command = "sops"
+	}
+
+	// the data not read from a file is decrypted in a private temporary file
+	if name == "" {
+		f, err := os.CreateTemp("", "atdtool-sops-*.yaml")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		name = f.Name()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command, "--decrypt", "--input-type", "yaml", "--output-type", "yaml", name)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sops decrypt: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
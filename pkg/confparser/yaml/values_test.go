@@ -0,0 +1,84 @@
+package yaml
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encrypted is a values document in the layout of SOPS, the fake sops command
+// "decrypts" ENC[...] by removing the wrapper.
+const encrypted = `db:
+  user: ENC[root]
+  password: ENC[${DB_PASSWORD:-p@ss}]
+  port: 3306
+sops:
+  age:
+    - recipient: age1xxx
+  mac: ENC[mac]
+  version: 3.8.1
+`
+
+func fakeSOPS(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake sops command is a POSIX shell script")
+	}
+	script := filepath.Join(t.TempDir(), "sops")
+	content := "#!/bin/sh\n" +
+		"for f; do :; done\n" +
+		"[ \"$1\" = --decrypt ] || { echo \"unexpected args: $*\" >&2; exit 2; }\n" +
+		"grep -q '^sops:' \"$f\" || { echo 'sops metadata not found' >&2; exit 1; }\n" +
+		"sed -e '/^sops:/,$d' -e 's/ENC\\[\\(.*\\)\\]/\\1/' \"$f\"\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(sopsCommandEnv, script)
+}
+
+func TestLoadValuesDecrypt(t *testing.T) {
+	fakeSOPS(t)
+	name := filepath.Join(t.TempDir(), "secret.yaml")
+	if err := os.WriteFile(name, []byte(encrypted), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the encrypted file is loaded as it is without Decrypt
+	vals, err := LoadValues(name, ValuesOptions{})
+	if assert.NoError(t, err) {
+		assert.Contains(t, vals, "sops")
+	}
+
+	vals, err = LoadValues(name, ValuesOptions{Decrypt: true, ExpandEnv: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]any{"db": map[string]any{
+			"user":     "root",
+			"password": "p@ss",
+			"port":     json.Number("3306"),
+		}}, vals)
+	}
+
+	// the data not read from a file is decrypted in a temporary file
+	vals, err = ParseValues("", []byte(encrypted), ValuesOptions{Decrypt: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "${DB_PASSWORD:-p@ss}", vals["db"].(map[string]any)["password"])
+	}
+
+	// the plain files are not passed to sops
+	plain := filepath.Join(t.TempDir(), "plain.yaml")
+	if err := os.WriteFile(plain, []byte("sops: plain\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vals, err = LoadValues(plain, ValuesOptions{Decrypt: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]any{"sops": "plain"}, vals)
+	}
+
+	t.Setenv(sopsCommandEnv, filepath.Join(t.TempDir(), "not-found"))
+	_, err = LoadValues(name, ValuesOptions{Decrypt: true})
+	assert.ErrorContains(t, err, "sops decrypt")
+}
@@ -0,0 +1,276 @@
+// Package guid generates the unique ids of the algorithms other than snowflake,
+// and encodes the ids in the formats of the command line.
+package guid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Algorithm is the algorithm of the ids.
+type Algorithm string
+
+const (
+	Snowflake Algorithm = "snowflake"
+	UUIDv4    Algorithm = "uuid4"
+	UUIDv7    Algorithm = "uuidv7"
+	ULID      Algorithm = "ulid"
+	KSUID     Algorithm = "ksuid"
+)
+
+// Format is the text format of the ids.
+type Format string
+
+const (
+	// FormatDefault is the standard format of the algorithm, the canonical form
+	// of uuid, the crockford base32 of ulid, the base62 of ksuid and the decimal
+	// of snowflake
+	FormatDefault Format = ""
+	FormatDec     Format = "dec"
+	FormatHex     Format = "hex"
+	FormatBase62  Format = "base62"
+)
+
+// ParseAlgorithm parses the algorithm, uuidv4 and uuid7 are accepted as the
+// aliases.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	switch strings.ToLower(s) {
+	case "", string(Snowflake):
+		return Snowflake, nil
+	case string(UUIDv4), "uuidv4":
+		return UUIDv4, nil
+	case string(UUIDv7), "uuid7":
+		return UUIDv7, nil
+	case string(ULID):
+		return ULID, nil
+	case string(KSUID):
+		return KSUID, nil
+	}
+	return "", fmt.Errorf("unsupported guid algorithm: %s, should be snowflake, uuid4, uuidv7, ulid or ksuid", s)
+}
+
+// ParseFormat parses the format, default is the standard format of the algorithm.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatDec, FormatHex, FormatBase62:
+		return f, nil
+	case FormatDefault, "default":
+		return FormatDefault, nil
+	}
+	return "", fmt.Errorf("unsupported guid format: %s, should be default, dec, hex or base62", s)
+}
+
+// Generator generates the ids in bytes.
+type Generator interface {
+	Next() ([]byte, error)
+}
+
+// NewGenerator creates the generator of the algorithm, the snowflake ids are
+// generated by pkg/snowflake instead. The uuidv7 and the ulid ids of the same
+// generator are monotonic even in the same millisecond.
+func NewGenerator(algorithm Algorithm) (Generator, error) {
+	switch algorithm {
+	case UUIDv4:
+		return uuidv4Generator{}, nil
+	case UUIDv7:
+		return &uuidv7Generator{now: time.Now}, nil
+	case ULID:
+		return &ulidGenerator{now: time.Now}, nil
+	case KSUID:
+		return &ksuidGenerator{now: time.Now}, nil
+	}
+	return nil, fmt.Errorf("unsupported guid algorithm: %s", algorithm)
+}
+
+type uuidv4Generator struct{}
+
+func (uuidv4Generator) Next() ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id, nil
+}
+
+// uuidv7Generator generates the uuidv7 ids of RFC 9562, the 12 bits of rand_a
+// are a counter in the same millisecond, which starts from a random value not
+// greater than half of the range, and the timestamp goes forward by itself when
+// the counter overflows.
+type uuidv7Generator struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	timestamp int64
+	counter   uint16
+}
+
+func (g *uuidv7Generator) Next() ([]byte, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	ms := g.now().UnixMilli()
+	if ms <= g.timestamp {
+		ms = g.timestamp
+		g.counter++
+		if g.counter > 0x0fff {
+			ms++
+			g.counter = binary.BigEndian.Uint16(id[6:]) & 0x07ff
+		}
+	} else {
+		g.counter = binary.BigEndian.Uint16(id[6:]) & 0x07ff
+	}
+	g.timestamp = ms
+	counter := g.counter
+	g.mu.Unlock()
+
+	putUint48(id, ms)
+	binary.BigEndian.PutUint16(id[6:], 0x7000|counter)
+	id[8] = id[8]&0x3f | 0x80
+	return id, nil
+}
+
+// ulidGenerator generates the ulid ids, the 80 bits random part is increased
+// by one in the same millisecond as the monotonic ulid.
+type ulidGenerator struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	timestamp int64
+	random    [10]byte
+}
+
+func (g *ulidGenerator) Next() ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := g.now().UnixMilli()
+	if ms <= g.timestamp {
+		ms = g.timestamp
+		if !increase(g.random[:]) {
+			return nil, fmt.Errorf("ulid random part overflows in millisecond %d", ms)
+		}
+	} else if _, err := rand.Read(g.random[:]); err != nil {
+		return nil, err
+	}
+	g.timestamp = ms
+
+	id := make([]byte, 16)
+	putUint48(id, ms)
+	copy(id[6:], g.random[:])
+	return id, nil
+}
+
+// ksuidEpoch is the epoch of the timestamps of ksuid, 2014-05-13 16:53:20 UTC.
+const ksuidEpoch = 1400000000
+
+// ksuidGenerator generates the ksuid ids, 32 bits timestamp in seconds since
+// ksuidEpoch and 128 bits random payload.
+type ksuidGenerator struct {
+	now func() time.Time
+}
+
+func (g *ksuidGenerator) Next() ([]byte, error) {
+	id := make([]byte, 20)
+	binary.BigEndian.PutUint32(id, uint32(g.now().Unix()-ksuidEpoch))
+	if _, err := rand.Read(id[4:]); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func putUint48(b []byte, v int64) {
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
+
+// increase adds one to the big endian number, it returns false if it overflows.
+func increase(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	base62Alphabet    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// Encode encodes the id of the algorithm in the format.
+func Encode(algorithm Algorithm, id []byte, format Format) string {
+	if format == FormatDefault {
+		switch algorithm {
+		case UUIDv4, UUIDv7:
+			s := hex.EncodeToString(id)
+			return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+		case ULID:
+			return encodeCrockford(id)
+		case KSUID:
+			format = FormatBase62
+		default:
+			format = FormatDec
+		}
+	}
+
+	switch format {
+	case FormatHex:
+		return hex.EncodeToString(id)
+	case FormatBase62:
+		return encodeBase62(id)
+	default:
+		return new(big.Int).SetBytes(id).String()
+	}
+}
+
+// encodeBase62 encodes the bytes into the base62 of the fixed width of the
+// length, the width of ksuid is 27.
+func encodeBase62(id []byte) string {
+	width := base62Width(len(id))
+	out := make([]byte, width)
+	n := new(big.Int).SetBytes(id)
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	for i := width - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = base62Alphabet[mod.Int64()]
+	}
+	return string(out)
+}
+
+// base62Width returns the digits of the max number of the bytes in base62.
+func base62Width(size int) int {
+	max := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	var width int
+	for n, base := new(big.Int).Sub(max, big.NewInt(1)), big.NewInt(62); n.Sign() > 0; width++ {
+		n.Div(n, base)
+	}
+	return width
+}
+
+// encodeCrockford encodes the 128 bits ulid into 26 characters of the crockford
+// base32, the first character holds the top 3 bits.
+func encodeCrockford(id []byte) string {
+	n := new(big.Int).SetBytes(id)
+	out := make([]byte, 26)
+	mask := big.NewInt(31)
+	digit := new(big.Int)
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockfordAlphabet[digit.And(n, mask).Int64()]
+		n.Rsh(n, 5)
+	}
+	return string(out)
+}
@@ -0,0 +1,134 @@
+package guid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUUIDv4(t *testing.T) {
+	g, err := NewGenerator(UUIDv4)
+	if !assert.NoError(t, err) {
+		return
+	}
+	id, err := g.Next()
+	if !assert.NoError(t, err) || !assert.Len(t, id, 16) {
+		return
+	}
+	assert.Equal(t, byte(0x40), id[6]&0xf0)
+	assert.Equal(t, byte(0x80), id[8]&0xc0)
+
+	s := Encode(UUIDv4, id, FormatDefault)
+	assert.Len(t, s, 36)
+	assert.Equal(t, byte('4'), s[14])
+}
+
+func TestUUIDv7Monotonic(t *testing.T) {
+	now := time.UnixMilli(1792000000000)
+	g := &uuidv7Generator{now: func() time.Time { return now }}
+
+	var last []byte
+	for i := 0; i < 5000; i++ {
+		id, err := g.Next()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, byte(0x70), id[6]&0xf0)
+		assert.Equal(t, byte(0x80), id[8]&0xc0)
+		if last != nil && !assert.Equal(t, 1, bytes.Compare(id, last), "%x <= %x", id, last) {
+			return
+		}
+		last = id
+	}
+
+	// the timestamp goes forward when the counter overflows
+	ms := int64(binary.BigEndian.Uint64(append([]byte{0, 0}, last[:6]...)))
+	assert.Greater(t, ms, now.UnixMilli())
+}
+
+func TestULIDMonotonic(t *testing.T) {
+	now := time.UnixMilli(1792000000000)
+	g := &ulidGenerator{now: func() time.Time { return now }}
+
+	var last string
+	for i := 0; i < 100; i++ {
+		id, err := g.Next()
+		if !assert.NoError(t, err) {
+			return
+		}
+		s := Encode(ULID, id, FormatDefault)
+		assert.Len(t, s, 26)
+		assert.Greater(t, s, last)
+		last = s
+
+		// the first 10 characters are the timestamp
+		ms := new(big.Int)
+		for _, c := range s[:10] {
+			ms.Lsh(ms, 5).Or(ms, big.NewInt(int64(strings.IndexRune(crockfordAlphabet, c))))
+		}
+		assert.Equal(t, now.UnixMilli(), ms.Int64())
+	}
+
+	// the random part overflows in the same millisecond
+	for i := range g.random {
+		g.random[i] = 0xff
+	}
+	_, err := g.Next()
+	assert.Error(t, err)
+}
+
+func TestKSUID(t *testing.T) {
+	now := time.Unix(1792000000, 0)
+	g := &ksuidGenerator{now: func() time.Time { return now }}
+	id, err := g.Next()
+	if !assert.NoError(t, err) || !assert.Len(t, id, 20) {
+		return
+	}
+	assert.Equal(t, uint32(1792000000-ksuidEpoch), binary.BigEndian.Uint32(id))
+	assert.Len(t, Encode(KSUID, id, FormatDefault), 27)
+
+	// the max ksuid is aWgEPTl1tmebfsQzFP4bxwgy80V
+	max := bytes.Repeat([]byte{0xff}, 20)
+	assert.Equal(t, "aWgEPTl1tmebfsQzFP4bxwgy80V", Encode(KSUID, max, FormatBase62))
+	assert.Equal(t, "000000000000000000000000000", Encode(KSUID, make([]byte, 20), FormatDefault))
+}
+
+func TestEncode(t *testing.T) {
+	id := []byte{0, 0, 0, 0, 0, 0, 0x01, 0x00}
+	assert.Equal(t, "256", Encode(Snowflake, id, FormatDefault))
+	assert.Equal(t, "256", Encode(Snowflake, id, FormatDec))
+	assert.Equal(t, "0000000000000100", Encode(Snowflake, id, FormatHex))
+	assert.Equal(t, "00000000048", Encode(Snowflake, id, FormatBase62))
+
+	uuid := []byte{0x01, 0x8f, 0x3c, 0x4a, 0x5b, 0x6c, 0x7d, 0x8e, 0x9f, 0xa0, 0xb1, 0xc2, 0xd3, 0xe4, 0xf5, 0x06}
+	assert.Equal(t, "018f3c4a-5b6c-7d8e-9fa0-b1c2d3e4f506", Encode(UUIDv7, uuid, FormatDefault))
+	assert.Equal(t, "018f3c4a5b6c7d8e9fa0b1c2d3e4f506", Encode(UUIDv7, uuid, FormatHex))
+	assert.Len(t, Encode(UUIDv7, uuid, FormatBase62), 22)
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", Encode(ULID, bytes.Repeat([]byte{0xff}, 16), FormatDefault))
+}
+
+func TestParse(t *testing.T) {
+	for s, want := range map[string]Algorithm{"": Snowflake, "UUID4": UUIDv4, "uuidv4": UUIDv4, "uuid7": UUIDv7, "ulid": ULID, "ksuid": KSUID} {
+		a, err := ParseAlgorithm(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, a)
+	}
+	_, err := ParseAlgorithm("uuid1")
+	assert.Error(t, err)
+
+	for s, want := range map[string]Format{"": FormatDefault, "default": FormatDefault, "DEC": FormatDec, "hex": FormatHex, "base62": FormatBase62} {
+		f, err := ParseFormat(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, f)
+	}
+	_, err = ParseFormat("base32")
+	assert.Error(t, err)
+
+	_, err = NewGenerator(Snowflake)
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package snowflake
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// base32Alphabet is the crockford base32, which excludes I, L, O and U
+	base32Alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	// Base62Length is the length of the ids encoded by EncodeBase62
+	Base62Length = 11
+	// Base32Length is the length of the ids encoded by EncodeBase32
+	Base32Length = 13
+)
+
+// EncodeBase62 encodes the id into base62 of Base62Length characters, which is
+// safe in urls and filenames. The encoded ids are padded with zeros and sorted
+// in the same order as the ids, since the alphabet is in ascii order. The id
+// should not be negative as the generated ids.
+func EncodeBase62(id int64) string {
+	return encode(uint64(id), base62Alphabet, Base62Length)
+}
+
+// DecodeBase62 decodes the id encoded by EncodeBase62, the leading zeros could
+// be omitted.
+func DecodeBase62(s string) (int64, error) {
+	return decode(s, 62, func(c byte) int {
+		return strings.IndexByte(base62Alphabet, c)
+	})
+}
+
+// EncodeBase32 encodes the id into crockford base32 of Base32Length characters,
+// which is case insensitive and sorted in the same order as the ids.
+func EncodeBase32(id int64) string {
+	return encode(uint64(id), base32Alphabet, Base32Length)
+}
+
+// DecodeBase32 decodes the id encoded by EncodeBase32 case insensitively, the
+// confusing characters I and L are read as 1, and O is read as 0.
+func DecodeBase32(s string) (int64, error) {
+	return decode(s, 32, func(c byte) int {
+		switch c {
+		case 'I', 'i', 'L', 'l':
+			c = '1'
+		case 'O', 'o':
+			c = '0'
+		}
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		return strings.IndexByte(base32Alphabet, c)
+	})
+}
+
+func encode(n uint64, alphabet string, width int) string {
+	base := uint64(len(alphabet))
+	out := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		out[i] = alphabet[n%base]
+		n /= base
+	}
+	return string(out)
+}
+
+func decode(s string, base uint64, digit func(c byte) int) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty encoded id")
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		d := digit(s[i])
+		if d < 0 {
+			return 0, fmt.Errorf("invalid character %q of encoded id %s", s[i], s)
+		}
+		if n > (1<<63-1-uint64(d))/base {
+			return 0, fmt.Errorf("encoded id %s overflows", s)
+		}
+		n = n*base + uint64(d)
+	}
+	return int64(n), nil
+}
@@ -0,0 +1,70 @@
+package snowflake
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBase62(t *testing.T) {
+	ids := []int64{0, 1, 61, 62, 501706945791689408, math.MaxInt64}
+	encoded := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s := EncodeBase62(id)
+		assert.Len(t, s, Base62Length)
+		n, err := DecodeBase62(s)
+		assert.NoError(t, err)
+		assert.Equal(t, id, n)
+		encoded = append(encoded, s)
+	}
+	// the encoded ids are sorted as the ids
+	assert.True(t, sort.StringsAreSorted(encoded), encoded)
+
+	assert.Equal(t, "00000000010", EncodeBase62(62))
+	assert.Equal(t, "AzL8n0Y58m7", EncodeBase62(math.MaxInt64))
+
+	n, err := DecodeBase62("10")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(62), n)
+
+	for _, s := range []string{"", "abc-", "AzL8n0Y58m8", "zzzzzzzzzzzz"} {
+		_, err := DecodeBase62(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEncodeBase32(t *testing.T) {
+	ids := []int64{0, 1, 31, 32, 501706945791689408, math.MaxInt64}
+	encoded := make([]string, 0, len(ids))
+	for _, id := range ids {
+		s := EncodeBase32(id)
+		assert.Len(t, s, Base32Length)
+		n, err := DecodeBase32(s)
+		assert.NoError(t, err)
+		assert.Equal(t, id, n)
+
+		// case insensitive
+		n, err = DecodeBase32(strings.ToLower(s))
+		assert.NoError(t, err)
+		assert.Equal(t, id, n)
+		encoded = append(encoded, s)
+	}
+	assert.True(t, sort.StringsAreSorted(encoded), encoded)
+	assert.Equal(t, "7ZZZZZZZZZZZZ", EncodeBase32(math.MaxInt64))
+
+	// the confusing characters
+	n, err := DecodeBase32("1O")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(32), n)
+	n, err = DecodeBase32("il")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(33), n)
+
+	for _, s := range []string{"", "U", "8000000000000"} {
+		_, err := DecodeBase32(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,225 @@
+package snowflake
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLeaseTTL = 60 * time.Second
+	leaseFileSuffix = ".lease"
+)
+
+// LeaseWorkerIdOptions are the options of the lease source.
+type LeaseWorkerIdOptions struct {
+	// Dir is the directory of the lease files shared by the processes, like a
+	// directory of nfs or a volume mounted by the pods of a node
+	Dir string
+	// TTL is the time after which the lease files not refreshed are taken over,
+	// 60s by default
+	TTL time.Duration
+}
+
+// leaseWorkerIdGenerator holds the worker id by the lease file <id>.lease in a
+// directory, which is created exclusively and refreshed in background. The lease
+// files not refreshed in ttl are left by the crashed processes and are taken over.
+// The file contains a random token, and the id becomes unavailable once the file
+// is removed or taken over by others. It implements io.Closer to remove the file.
+type leaseWorkerIdGenerator struct {
+	options LeaseWorkerIdOptions
+	id      int64
+	path    string
+	token   []byte
+
+	mu     sync.Mutex
+	err    error
+	closed chan struct{}
+	done   chan struct{}
+}
+
+func newLeaseWorkerIdGenerator(options LeaseWorkerIdOptions) (*leaseWorkerIdGenerator, error) {
+	if options.Dir == "" {
+		return nil, fmt.Errorf("the directory of the worker id leases is required")
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultLeaseTTL
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create lease directory: %v", err)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	g := &leaseWorkerIdGenerator{
+		options: options,
+		token:   []byte(fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), hex.EncodeToString(token))),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := g.allocate(); err != nil {
+		return nil, err
+	}
+	go g.refresh()
+	return g, nil
+}
+
+func (g *leaseWorkerIdGenerator) Id() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return 0, g.err
+	}
+	return g.id, nil
+}
+
+// Close removes the lease file, so that the worker id could be allocated by
+// others.
+func (g *leaseWorkerIdGenerator) Close() error {
+	g.mu.Lock()
+	select {
+	case <-g.closed:
+		g.mu.Unlock()
+		return nil
+	default:
+	}
+	close(g.closed)
+	lost := g.err != nil
+	g.err = fmt.Errorf("lease worker id generator is closed")
+	g.mu.Unlock()
+	<-g.done
+
+	if lost || !g.owned() {
+		return nil
+	}
+	if err := os.Remove(g.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// allocate creates the lease file of the lowest free id, the stale lease files
+// are removed and created again.
+func (g *leaseWorkerIdGenerator) allocate() error {
+	entries, err := os.ReadDir(g.options.Dir)
+	if err != nil {
+		return fmt.Errorf("list worker id leases: %v", err)
+	}
+	used := make(map[int64]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, leaseFileSuffix) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, leaseFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) <= g.options.TTL {
+			used[id] = true
+		}
+	}
+
+	for id := int64(0); id <= workeridMax; id++ {
+		if used[id] {
+			continue
+		}
+		path := filepath.Join(g.options.Dir, strconv.FormatInt(id, 10)+leaseFileSuffix)
+		ok, err := g.create(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			g.id = id
+			g.path = path
+			return nil
+		}
+	}
+	return fmt.Errorf("no free worker id in lease directory %s", g.options.Dir)
+}
+
+// create creates the lease file exclusively, the stale file is removed first.
+// Another process may remove the file created just now if it has found it stale
+// before, which is detected by the token when refreshing.
+func (g *leaseWorkerIdGenerator) create(path string) (bool, error) {
+	if info, err := os.Stat(path); err == nil {
+		if time.Since(info.ModTime()) <= g.options.TTL {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("remove stale lease %s: %v", path, err)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("create lease %s: %v", path, err)
+	}
+	_, err = f.Write(g.token)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return false, fmt.Errorf("write lease %s: %v", path, err)
+	}
+	return true, nil
+}
+
+// owned checks whether the lease file is still held by the generator.
+func (g *leaseWorkerIdGenerator) owned() bool {
+	data, err := os.ReadFile(g.path)
+	return err == nil && bytes.Equal(data, g.token)
+}
+
+// refresh touches the lease file every third of the ttl, the worker id becomes
+// unavailable if the file is taken over or can not be touched before the ttl.
+func (g *leaseWorkerIdGenerator) refresh() {
+	defer close(g.done)
+
+	ticker := time.NewTicker(g.options.TTL / 3)
+	defer ticker.Stop()
+	deadline := time.Now().Add(g.options.TTL)
+	for {
+		select {
+		case <-g.closed:
+			return
+		case <-ticker.C:
+		}
+
+		var err error
+		if !g.owned() {
+			err = fmt.Errorf("lease %s is taken over", g.path)
+		} else {
+			now := time.Now()
+			if err = os.Chtimes(g.path, now, now); err == nil {
+				deadline = now.Add(g.options.TTL)
+				continue
+			}
+			if now.Before(deadline) {
+				continue
+			}
+		}
+		g.mu.Lock()
+		if g.err == nil {
+			g.err = fmt.Errorf("lease worker id %d is lost: %v", g.id, err)
+		}
+		g.mu.Unlock()
+		return
+	}
+}
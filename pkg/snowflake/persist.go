@@ -0,0 +1,45 @@
+package snowflake
+
+// Persister records the reserved timestamp of the snowflake generator, the
+// timestamps of the issued ids are less than it. Save is called before the ids
+// of the reserved time are issued, Load returns zero if nothing is recorded.
+type Persister interface {
+	Load() (int64, error)
+	Save(reserved int64) error
+}
+
+// PersisterFuncs is the Persister of the callbacks, the nil LoadFunc loads
+// zero.
+type PersisterFuncs struct {
+	LoadFunc func() (int64, error)
+	SaveFunc func(reserved int64) error
+}
+
+func (p PersisterFuncs) Load() (int64, error) {
+	if p.LoadFunc == nil {
+		return 0, nil
+	}
+	return p.LoadFunc()
+}
+
+func (p PersisterFuncs) Save(reserved int64) error {
+	return p.SaveFunc(reserved)
+}
+
+// filePersister records the reserved timestamp in the state file, which is
+// replaced atomically.
+type filePersister string
+
+// NewFilePersister creates the Persister recording the reserved timestamp in
+// the file, it is the same as Options.StateFile.
+func NewFilePersister(path string) Persister {
+	return filePersister(path)
+}
+
+func (p filePersister) Load() (int64, error) {
+	return loadState(string(p))
+}
+
+func (p filePersister) Save(reserved int64) error {
+	return saveState(string(p), reserved)
+}
@@ -0,0 +1,131 @@
+package snowflake
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryPersister records the reserved timestamp in memory.
+type memoryPersister struct {
+	reserved int64
+	saves    int
+}
+
+func (p *memoryPersister) funcs() PersisterFuncs {
+	return PersisterFuncs{
+		LoadFunc: func() (int64, error) {
+			return p.reserved, nil
+		},
+		SaveFunc: func(reserved int64) error {
+			p.reserved = reserved
+			p.saves++
+			return nil
+		},
+	}
+}
+
+func TestPersister(t *testing.T) {
+	base := time.Now().UnixNano() / 1000000
+	now := base
+	p := &memoryPersister{}
+	options := Options{ClockBackward: ClockBackwardBorrow, Persister: p.funcs(), PersistInterval: 20 * time.Millisecond}
+
+	sf, err := NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	var last int64
+	for i := 0; i < 3; i++ {
+		if last, err = sf.NextVal(); !assert.NoError(t, err) {
+			return
+		}
+	}
+	// the reserved timestamp is saved before the first id, and once for each
+	// interval
+	assert.Equal(t, base+20, p.reserved)
+	assert.Equal(t, 1, p.saves)
+	now = base + 19
+	_, err = sf.NextVal()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.saves)
+	now = base + 20
+	if last, err = sf.NextVal(); assert.NoError(t, err) {
+		assert.Equal(t, base+40, p.reserved)
+		assert.Equal(t, 2, p.saves)
+	}
+
+	// the ids start from the reserved timestamp after the crash, even if the
+	// clock moved backwards
+	now = base - 10
+	sf, err = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	id, err := sf.NextVal()
+	if assert.NoError(t, err) {
+		assert.Greater(t, id, last)
+		assert.Equal(t, base+40, idTimestamp(id))
+		assert.Equal(t, base+60, p.reserved)
+	}
+
+	// the ids earlier than the reserved timestamp are refused
+	options.ClockBackward = ClockBackwardError
+	sf, err = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, options)
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	_, err = sf.NextVal()
+	assert.ErrorIs(t, err, ErrClockBackward)
+
+	// the time within the interval is waited after restarting
+	now = base + 45
+	sf.clock = stepClock(&now, 5)
+	if id, err = sf.NextVal(); assert.NoError(t, err) {
+		assert.GreaterOrEqual(t, idTimestamp(id), base+60)
+	}
+
+	// no id is issued if the reserved timestamp is not saved
+	options.Persister = PersisterFuncs{SaveFunc: func(int64) error { return errors.New("disk full") }}
+	if sf, err = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, options); assert.NoError(t, err) {
+		_, err = sf.NextVal()
+		assert.Error(t, err)
+	}
+
+	options.Persister = PersisterFuncs{LoadFunc: func() (int64, error) { return 0, errors.New("unavailable") }}
+	_, err = NewSnowFlakeWithOptions(nil, options)
+	assert.Error(t, err)
+
+	options.StateFile = filepath.Join(t.TempDir(), "snowflake.state")
+	_, err = NewSnowFlakeWithOptions(nil, options)
+	assert.Error(t, err)
+}
+
+func TestFilePersister(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snowflake.state")
+	p := NewFilePersister(path)
+
+	reserved, err := p.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), reserved)
+
+	// the file is the same as the state file
+	assert.NoError(t, p.Save(1792000000000))
+	reserved, err = loadState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1792000000000), reserved)
+
+	for _, data := range []string{"", "abc", "1 2"} {
+		if assert.NoError(t, os.WriteFile(path, []byte(data), 0644)) {
+			_, err = p.Load()
+			assert.Error(t, err, data)
+		}
+	}
+}
@@ -1,10 +1,21 @@
+// Package snowflake generates the 64 bits ids of the 41 bits milliseconds since
+// 2023-01-01 UTC+8, the 16 bits worker id and the 6 bits sequence. A worker generates
+// at most 64 ids per millisecond, about 64K ids per second, the generator waits
+// for the next millisecond when the sequence is used up, so the generators of
+// more worker ids are needed for the higher throughput.
 package snowflake
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,19 +37,84 @@ const (
 	timestampShift = sequenceBits + workeridBits
 )
 
-// Snowflake represents a snowflake ID generator
+const (
+	// defaultMaxWait is the max time waiting for the clock moved backwards by default
+	defaultMaxWait = 5 * time.Second
+	// stateReserve is the time reserved beyond the last timestamp in the state
+	// file by default, so that the file is not written for each id
+	stateReserve = int64(1000)
+)
+
+// ErrClockBackward is returned when the clock moves backwards and the ids could
+// not be generated.
+var ErrClockBackward = errors.New("clock moved backwards")
+
+// ClockBackwardPolicy is the behavior when the clock moves backwards, for
+// example by the step of NTP.
+type ClockBackwardPolicy int
+
+const (
+	// ClockBackwardWait waits until the clock catches up with the last
+	// timestamp, or returns ErrClockBackward if it takes more than MaxWait
+	ClockBackwardWait ClockBackwardPolicy = iota
+	// ClockBackwardError returns ErrClockBackward immediately
+	ClockBackwardError
+	// ClockBackwardBorrow keeps generating the ids from the last timestamp,
+	// which goes forward by itself when the sequence is used up, until the
+	// clock catches up with it
+	ClockBackwardBorrow
+)
+
+// Options are the options of the snowflake generator, zero means the default.
+type Options struct {
+	// ClockBackward is the behavior when the clock moves backwards
+	ClockBackward ClockBackwardPolicy
+	// MaxWait is the max time waiting for the clock by ClockBackwardWait, 5s by default
+	MaxWait time.Duration
+	// StateFile persists the max timestamp of the ids, so that the clock moved
+	// backwards while the process is stopped is detected after restarting
+	StateFile string
+	// Persister persists the max timestamp of the ids like StateFile, to the
+	// places other than a file, it can't be used with StateFile
+	Persister Persister
+	// PersistInterval is the time reserved beyond the last timestamp when the
+	// max timestamp is persisted, 1s by default
+	PersistInterval time.Duration
+}
+
+// Snowflake represents a snowflake ID generator. The ids are generated by CAS
+// of the last timestamp and sequence without the lock, the lock is only held
+// when the sequence is used up, the clock moves backwards or the state file is
+// written.
 type Snowflake struct {
 	sync.Mutex
-	timestamp         int64
 	workerIdGenerator WorkerIdGenerator
-	sequence          int64
+
+	// last is the timestamp and the sequence of the last id, the timestamp is
+	// shifted by sequenceBits
+	last atomic.Int64
+
+	options Options
+	// persister is the persister of StateFile or Persister
+	persister Persister
+	// reserveAhead is the time reserved by persister in milliseconds
+	reserveAhead int64
+	// reserved is the timestamp persisted by persister, the timestamps of the
+	// ids are less than it
+	reserved atomic.Int64
+	// restored is true until the first id after loading the state, the time
+	// within reserveAhead is waited instead of being treated as the clock moved
+	// backwards
+	restored atomic.Bool
+	// clock returns the current milliseconds, it is replaced in tests
+	clock func() int64
 }
 
 // NewSnowFlake creates a new Snowflake instance with optional worker ID generator
 // If workerIdGenerator is nil, uses local IP based generator by default
 func NewSnowFlake(workerIdGenerator WorkerIdGenerator) *Snowflake {
 	if workerIdGenerator == nil {
-		workerIdGenerator = &localIPWorkerIdGenerator{localIPv4}
+		workerIdGenerator = &localIPWorkerIdGenerator{localIP: localIPv4}
 	}
 
 	return &Snowflake{
@@ -46,6 +122,52 @@ func NewSnowFlake(workerIdGenerator WorkerIdGenerator) *Snowflake {
 	}
 }
 
+// NewSnowFlakeWithOptions creates a new Snowflake instance with the options of
+// the clock moved backwards, the max timestamp is loaded from the state file if
+// it exists.
+func NewSnowFlakeWithOptions(workerIdGenerator WorkerIdGenerator, options Options) (*Snowflake, error) {
+	switch options.ClockBackward {
+	case ClockBackwardWait, ClockBackwardError, ClockBackwardBorrow:
+	default:
+		return nil, fmt.Errorf("invalid clock backward policy: %d", options.ClockBackward)
+	}
+	if options.MaxWait <= 0 {
+		options.MaxWait = defaultMaxWait
+	}
+
+	if options.StateFile != "" && options.Persister != nil {
+		return nil, fmt.Errorf("state file and persister can't be used together")
+	}
+	if options.PersistInterval < 0 {
+		return nil, fmt.Errorf("invalid persist interval: %v", options.PersistInterval)
+	}
+
+	s := NewSnowFlake(workerIdGenerator)
+	s.options = options
+	s.persister = options.Persister
+	if options.StateFile != "" {
+		s.persister = NewFilePersister(options.StateFile)
+	}
+	s.reserveAhead = stateReserve
+	if options.PersistInterval > 0 {
+		s.reserveAhead = max(options.PersistInterval.Milliseconds(), 1)
+	}
+	if s.persister != nil {
+		reserved, err := s.persister.Load()
+		if err != nil {
+			return nil, fmt.Errorf("load snowflake state: %v", err)
+		}
+		// the ids start from the reserved timestamp, which have never been
+		// generated, as if the sequence of the previous one is used up
+		s.reserved.Store(reserved)
+		if reserved > 0 {
+			s.last.Store((reserved-1)<<sequenceBits | sequenceMask)
+		}
+		s.restored.Store(true)
+	}
+	return s, nil
+}
+
 // NextVal generates the next unique ID using the snowflake algorithm
 func (s *Snowflake) NextVal() (int64, error) {
 	workerid, err := s.getWorkerId()
@@ -53,31 +175,134 @@ func (s *Snowflake) NextVal() (int64, error) {
 		return 0, err
 	}
 
-	s.Lock()
-	defer s.Unlock()
+	timestamp, sequence, _, err := s.reserve(1)
+	if err != nil {
+		return 0, err
+	}
+	return compose(timestamp, workerid, sequence), nil
+}
 
-	if s.workerIdGenerator == nil {
-		return 0, fmt.Errorf("worker id generator is nil")
+// NextVals generates n unique IDs in increasing order, the sequences of each
+// millisecond are reserved at once instead of one by one.
+func (s *Snowflake) NextVals(n int) ([]int64, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of ids: %d", n)
+	}
+	workerid, err := s.getWorkerId()
+	if err != nil {
+		return nil, err
 	}
 
-	now := time.Now().UnixNano() / 1000000
-	if s.timestamp == now {
-		s.sequence = (s.sequence + 1) & sequenceMask
-		if s.sequence == 0 {
-			now = s.waitNextMillis(s.timestamp)
+	ids := make([]int64, 0, n)
+	for len(ids) < n {
+		timestamp, sequence, count, err := s.reserve(int64(n - len(ids)))
+		if err != nil {
+			return nil, err
+		}
+		for i := int64(0); i < count; i++ {
+			ids = append(ids, compose(timestamp, workerid, sequence+i))
 		}
-	} else {
-		s.sequence = 0
 	}
+	return ids, nil
+}
 
-	t := now - epoch
-	if t > timestampMax {
-		return 0, fmt.Errorf("epoch must be between 0 and %d", timestampMax-1)
+func compose(timestamp, workerid, sequence int64) int64 {
+	return (timestamp-epoch)<<timestampShift | workerid<<workeridShift | sequence
+}
+
+// reserve reserves at most n sequences of a timestamp, it returns the timestamp,
+// the first sequence and the number of the sequences.
+func (s *Snowflake) reserve(n int64) (int64, int64, int64, error) {
+	for {
+		last := s.last.Load()
+		lastTimestamp, lastSequence := last>>sequenceBits, last&sequenceMask
+
+		now := s.now()
+		var first int64
+		switch {
+		case now > lastTimestamp:
+			first = 0
+		case now == lastTimestamp && lastSequence < sequenceMask:
+			first = lastSequence + 1
+		default:
+			return s.reserveSlow(n)
+		}
+		if s.persister != nil && now >= s.reserved.Load() {
+			return s.reserveSlow(n)
+		}
+		if now-epoch > timestampMax {
+			return 0, 0, 0, fmt.Errorf("epoch must be between 0 and %d", timestampMax-1)
+		}
+
+		count := min(n, sequenceMask+1-first)
+		if s.last.CompareAndSwap(last, now<<sequenceBits|(first+count-1)) {
+			if s.restored.Load() {
+				s.restored.Store(false)
+			}
+			return now, first, count, nil
+		}
 	}
+}
+
+// reserveSlow reserves the sequences with the lock, when the sequence is used
+// up, the clock moves backwards or the state file should be written.
+func (s *Snowflake) reserveSlow(n int64) (int64, int64, int64, error) {
+	s.Lock()
+	defer s.Unlock()
 
-	s.timestamp = now
-	r := int64((t)<<timestampShift | (workerid << workeridShift) | (s.sequence))
-	return r, nil
+	for {
+		last := s.last.Load()
+		lastTimestamp, lastSequence := last>>sequenceBits, last&sequenceMask
+
+		now := s.now()
+		borrowed := false
+		if now < lastTimestamp {
+			switch s.options.ClockBackward {
+			case ClockBackwardError:
+				if s.restored.Load() && lastTimestamp-now <= s.reserveAhead {
+					now = s.waitMillis(lastTimestamp)
+					break
+				}
+				return 0, 0, 0, fmt.Errorf("%w by %dms", ErrClockBackward, lastTimestamp-now)
+			case ClockBackwardBorrow:
+				now = lastTimestamp
+				borrowed = true
+			default:
+				if time.Duration(lastTimestamp-now)*time.Millisecond > s.maxWait() {
+					return 0, 0, 0, fmt.Errorf("%w by %dms, more than %v", ErrClockBackward, lastTimestamp-now, s.maxWait())
+				}
+				now = s.waitMillis(lastTimestamp)
+			}
+		}
+
+		var first int64
+		if now == lastTimestamp {
+			if lastSequence < sequenceMask {
+				first = lastSequence + 1
+			} else if borrowed {
+				now = lastTimestamp + 1
+			} else {
+				now = s.waitNextMillis(lastTimestamp)
+			}
+		}
+
+		if now-epoch > timestampMax {
+			return 0, 0, 0, fmt.Errorf("epoch must be between 0 and %d", timestampMax-1)
+		}
+
+		if s.persister != nil && now >= s.reserved.Load() {
+			if err := s.persister.Save(now + s.reserveAhead); err != nil {
+				return 0, 0, 0, fmt.Errorf("save snowflake state: %v", err)
+			}
+			s.reserved.Store(now + s.reserveAhead)
+		}
+
+		count := min(n, sequenceMask+1-first)
+		if s.last.CompareAndSwap(last, now<<sequenceBits|(first+count-1)) {
+			s.restored.Store(false)
+			return now, first, count, nil
+		}
+	}
 }
 
 func (s *Snowflake) getWorkerId() (int64, error) {
@@ -97,23 +322,109 @@ func (s *Snowflake) getWorkerId() (int64, error) {
 }
 
 func (s *Snowflake) waitNextMillis(lastTimestamp int64) int64 {
-	now := time.Now().UnixNano() / 1000000
+	now := s.now()
 	for now <= lastTimestamp {
-		now = time.Now().UnixNano() / 1000000
+		now = s.now()
+	}
+	return now
+}
+
+// waitMillis sleeps until the clock catches up with the timestamp.
+func (s *Snowflake) waitMillis(timestamp int64) int64 {
+	now := s.now()
+	for now < timestamp {
+		time.Sleep(time.Duration(timestamp-now) * time.Millisecond)
+		now = s.now()
 	}
 	return now
 }
 
+func (s *Snowflake) maxWait() time.Duration {
+	if s.options.MaxWait <= 0 {
+		return defaultMaxWait
+	}
+	return s.options.MaxWait
+}
+
+func (s *Snowflake) now() int64 {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now().UnixNano() / 1000000
+}
+
+// loadState reads the reserved timestamp from the state file, zero is returned
+// if the file does not exist.
+func loadState(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snowflake state file %s: %v", path, err)
+	}
+	return reserved, nil
+}
+
+// saveState writes the reserved timestamp into the state file atomically.
+func saveState(path string, reserved int64) error {
+	return writeFileAtomic(path, strconv.FormatInt(reserved, 10)+"\n")
+}
+
+// writeFileAtomic writes the file by renaming a synced temporary file.
+func writeFileAtomic(path, data string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// localIPWorkerIdGenerator derives the worker id from the local ipv4 address,
+// the id is cached after the first success, so that the interfaces are not
+// listed for each id and the id does not change with the picked address.
 type localIPWorkerIdGenerator struct {
 	localIP func() (net.IP, error)
+
+	mu       sync.Mutex
+	id       atomic.Int64
+	resolved atomic.Bool
 }
 
 func (l *localIPWorkerIdGenerator) Id() (int64, error) {
+	if l.resolved.Load() {
+		return l.id.Load(), nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.resolved.Load() {
+		return l.id.Load(), nil
+	}
 	ip, err := l.localIP()
 	if err != nil {
 		return 0, err
 	}
-	return int64(ip[2])<<8 + int64(ip[3]), nil
+	l.id.Store(int64(ip[2])<<8 + int64(ip[3]))
+	l.resolved.Store(true)
+	return l.id.Load(), nil
 }
 
 func localIPv4() (net.IP, error) {
@@ -140,3 +451,30 @@ func localIPv4() (net.IP, error) {
 	}
 	return ipV4s[rand.Intn(len(ipV4s))], nil
 }
+
+// ID is the decomposition of a snowflake id.
+type ID struct {
+	// Timestamp is the time when the id is generated, in milliseconds
+	Timestamp time.Time
+	WorkerId  int64
+	Sequence  int64
+}
+
+// Parse decomposes the id generated by the layout of Snowflake into the time,
+// the worker id and the sequence.
+func Parse(id int64) (ID, error) {
+	if id < 0 {
+		return ID{}, fmt.Errorf("invalid snowflake id: %d", id)
+	}
+	return ID{
+		Timestamp: time.UnixMilli(id>>timestampShift + epoch),
+		WorkerId:  id >> workeridShift & workeridMax,
+		Sequence:  id & sequenceMask,
+	}, nil
+}
+
+// IPSuffix returns the last two octets of the ipv4 address, if the worker id is
+// derived from the local ip address.
+func (id ID) IPSuffix() string {
+	return fmt.Sprintf("*.*.%d.%d", id.WorkerId>>8, id.WorkerId&0xff)
+}
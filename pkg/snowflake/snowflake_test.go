@@ -1,8 +1,16 @@
 package snowflake
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -65,6 +73,262 @@ func TestNextVal(t *testing.T) {
 	}
 }
 
+// idTimestamp returns the milliseconds of the id.
+func idTimestamp(id int64) int64 {
+	return id>>timestampShift + epoch
+}
+
+// stepClock returns the timestamps from start, which move forward by step after
+// each call.
+func stepClock(start *int64, step int64) func() int64 {
+	return func() int64 {
+		now := *start
+		*start += step
+		return now
+	}
+}
+
+func TestNextValClockBackward(t *testing.T) {
+	base := time.Now().UnixNano() / 1000000
+	now := base
+
+	// error
+	sf, err := NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{ClockBackward: ClockBackwardError})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	_, err = sf.NextVal()
+	assert.NoError(t, err)
+	now = base - 10
+	_, err = sf.NextVal()
+	assert.True(t, errors.Is(err, ErrClockBackward), "Expected ErrClockBackward, got: %v", err)
+
+	// wait until the clock catches up
+	now = base
+	sf, _ = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{MaxWait: 100 * time.Millisecond})
+	sf.clock = stepClock(&now, 10)
+	first, err := sf.NextVal()
+	assert.NoError(t, err)
+	now = base - 20
+	second, err := sf.NextVal()
+	assert.NoError(t, err)
+	assert.Greater(t, second, first)
+	assert.GreaterOrEqual(t, idTimestamp(second), idTimestamp(first))
+
+	// the clock moved back more than MaxWait
+	now = base - 1000
+	_, err = sf.NextVal()
+	assert.True(t, errors.Is(err, ErrClockBackward), "Expected ErrClockBackward, got: %v", err)
+
+	// borrow the timestamps
+	now = base
+	sf, _ = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{ClockBackward: ClockBackwardBorrow})
+	sf.clock = func() int64 { return now }
+	last, err := sf.NextVal()
+	assert.NoError(t, err)
+	now = base - 100
+	for i := 0; i < 200; i++ {
+		id, err := sf.NextVal()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Greater(t, id, last)
+		last = id
+	}
+	// the sequence of each millisecond is used up before borrowing the next one
+	assert.Equal(t, base+200/(sequenceMask+1), idTimestamp(last))
+
+	_, err = NewSnowFlakeWithOptions(nil, Options{ClockBackward: ClockBackwardPolicy(10)})
+	assert.Error(t, err)
+}
+
+func TestNextValStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "snowflake.state")
+	base := time.Now().UnixNano() / 1000000
+	now := base
+
+	sf, err := NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{ClockBackward: ClockBackwardBorrow, StateFile: stateFile})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	last, err := sf.NextVal()
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := os.ReadFile(stateFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, strconv.FormatInt(base+stateReserve, 10), strings.TrimSpace(string(data)))
+	}
+
+	// the clock moved back while the process is stopped
+	now = base - 10
+	sf, err = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{ClockBackward: ClockBackwardBorrow, StateFile: stateFile})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = func() int64 { return now }
+	id, err := sf.NextVal()
+	if assert.NoError(t, err) {
+		assert.Greater(t, id, last)
+		assert.Equal(t, base+stateReserve, idTimestamp(id))
+	}
+
+	// the reserved time is waited after restarting instead of an error
+	now = base + stateReserve
+	sf, err = NewSnowFlakeWithOptions(&MockWorkerIdGenerator{id: 1}, Options{ClockBackward: ClockBackwardError, StateFile: stateFile})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sf.clock = stepClock(&now, stateReserve/2)
+	id, err = sf.NextVal()
+	if assert.NoError(t, err) {
+		assert.Equal(t, base+2*stateReserve, idTimestamp(id))
+	}
+
+	if assert.NoError(t, os.WriteFile(stateFile, []byte("invalid"), 0644)) {
+		_, err = NewSnowFlakeWithOptions(nil, Options{StateFile: stateFile})
+		assert.Error(t, err)
+	}
+}
+
+func TestNextVals(t *testing.T) {
+	base := time.Now().UnixNano() / 1000000
+	now := base
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 5})
+	sf.clock = stepClock(&now, 1)
+
+	_, err := sf.NextVals(0)
+	assert.Error(t, err)
+
+	// the sequences of each millisecond are used up before the next one
+	ids, err := sf.NextVals(200)
+	if !assert.NoError(t, err) || !assert.Len(t, ids, 200) {
+		return
+	}
+	for i, id := range ids {
+		assert.Equal(t, int64(5), id>>workeridShift&workeridMax)
+		assert.Equal(t, int64(i)&sequenceMask, id&sequenceMask)
+		if i > 0 {
+			assert.Greater(t, id, ids[i-1])
+		}
+	}
+	assert.Equal(t, idTimestamp(ids[0]), idTimestamp(ids[sequenceMask]))
+
+	sf = NewSnowFlake(&MockWorkerIdGenerator{err: fmt.Errorf("generator error")})
+	_, err = sf.NextVals(1)
+	assert.Error(t, err)
+}
+
+func TestNextValSequenceLimit(t *testing.T) {
+	base := time.Now().UnixNano() / 1000000
+	calls, limit := 0, math.MaxInt
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 1})
+	sf.clock = func() int64 {
+		calls++
+		if calls > limit {
+			return base + 1
+		}
+		return base
+	}
+
+	// a millisecond has at most 64 ids
+	for i := int64(0); i <= sequenceMask; i++ {
+		id, err := sf.NextVal()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, base, idTimestamp(id))
+		assert.Equal(t, i, id&sequenceMask)
+	}
+	assert.Equal(t, int64(64), sequenceMask+1)
+
+	// the next id waits for the next millisecond
+	limit = calls + 3
+	id, err := sf.NextVal()
+	if assert.NoError(t, err) {
+		assert.Equal(t, base+1, idTimestamp(id))
+		assert.Equal(t, int64(0), id&sequenceMask)
+	}
+}
+
+func TestNextValConcurrent(t *testing.T) {
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 1})
+
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(batch bool) {
+			defer wg.Done()
+			var ids []int64
+			for j := 0; j < 200; j++ {
+				if batch {
+					vals, err := sf.NextVals(10)
+					assert.NoError(t, err)
+					ids = append(ids, vals...)
+					continue
+				}
+				id, err := sf.NextVal()
+				assert.NoError(t, err)
+				ids = append(ids, id)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range ids {
+				assert.False(t, seen[id], "duplicate id: %d", id)
+				seen[id] = true
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	assert.Len(t, seen, 4*200+4*200*10)
+}
+
+func TestParse(t *testing.T) {
+	base := time.Now().UnixNano() / 1000000
+	now := base
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 0x0a0b})
+	sf.clock = func() int64 { return now }
+
+	ids, err := sf.NextVals(3)
+	if !assert.NoError(t, err) {
+		return
+	}
+	id, err := Parse(ids[2])
+	if assert.NoError(t, err) {
+		assert.Equal(t, base, id.Timestamp.UnixMilli())
+		assert.Equal(t, int64(0x0a0b), id.WorkerId)
+		assert.Equal(t, int64(2), id.Sequence)
+		assert.Equal(t, "*.*.10.11", id.IPSuffix())
+	}
+
+	_, err = Parse(-1)
+	assert.Error(t, err)
+}
+
+func BenchmarkSnowflake_NextValParallel(b *testing.B) {
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 1})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := sf.NextVal(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSnowflake_NextVals(b *testing.B) {
+	sf := NewSnowFlake(&MockWorkerIdGenerator{id: 1})
+	for i := 0; i < b.N; i++ {
+		if _, err := sf.NextVals(100); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkSnowflake_NextVal(b *testing.B) {
 	sf := NewSnowFlake(nil)
 
@@ -0,0 +1,399 @@
+package snowflake
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The sources of the worker ids of NewWorkerIdGenerator.
+const (
+	// WorkerIdSourceIP derives the worker id from the local ipv4 address
+	WorkerIdSourceIP = "ip"
+	// WorkerIdSourceEnv reads the worker id from an environment variable
+	WorkerIdSourceEnv = "env"
+	// WorkerIdSourceFile reads the worker id from a file, which is written by the
+	// deployment
+	WorkerIdSourceFile = "file"
+	// WorkerIdSourcePod derives the worker id from the ordinal of the pod of a
+	// StatefulSet, which is the suffix of the pod name
+	WorkerIdSourcePod = "pod"
+	// WorkerIdSourceEtcd allocates the lowest free worker id under a prefix of
+	// etcd, which is held by a lease until the generator is closed, the
+	// generator implements io.Closer
+	WorkerIdSourceEtcd = "etcd"
+	// WorkerIdSourceLease allocates the lowest free worker id by the lease files
+	// in a shared directory, the generator implements io.Closer
+	WorkerIdSourceLease = "lease"
+)
+
+const (
+	defaultWorkerIdEnv = "WORKER_ID"
+	defaultPodNameEnv  = "POD_NAME"
+	defaultEtcdPrefix  = "/atdtool/snowflake/worker/"
+	defaultEtcdTTL     = 60 * time.Second
+)
+
+// WorkerIdOptions selects the source of the worker id and its options.
+type WorkerIdOptions struct {
+	// Source is one of the WorkerIdSource constants, ip by default
+	Source string
+	// Env is the environment variable of the env source, WORKER_ID by default
+	Env string
+	// File is the file of the file source
+	File string
+	// PodName is the pod name of the pod source, the POD_NAME environment
+	// variable or the hostname by default
+	PodName string
+	// Offset is added to the ordinal of the pod source, so that the StatefulSets
+	// could use separate ranges
+	Offset int64
+	// Etcd is the options of the etcd source
+	Etcd EtcdWorkerIdOptions
+	// Lease is the options of the lease source
+	Lease LeaseWorkerIdOptions
+}
+
+// EtcdWorkerIdOptions are the options of the etcd source.
+type EtcdWorkerIdOptions struct {
+	// Endpoint is the url of the grpc gateway of etcd, like http://127.0.0.1:2379
+	Endpoint string
+	// Prefix is the prefix of the keys of the worker ids
+	Prefix string
+	// TTL is the ttl of the lease holding the worker id, 60s by default
+	TTL time.Duration
+	// Client is the http client, http.DefaultClient by default
+	Client *http.Client
+}
+
+// NewWorkerIdGenerator creates the worker id generator of the source. The worker
+// id is resolved once when it is created, and the errors are returned here
+// instead of from NextVal.
+func NewWorkerIdGenerator(options WorkerIdOptions) (WorkerIdGenerator, error) {
+	var id int64
+	var err error
+	switch options.Source {
+	case "", WorkerIdSourceIP:
+		return &localIPWorkerIdGenerator{localIP: localIPv4}, nil
+	case WorkerIdSourceEnv:
+		id, err = envWorkerId(options.Env)
+	case WorkerIdSourceFile:
+		id, err = fileWorkerId(options.File)
+	case WorkerIdSourcePod:
+		id, err = podWorkerId(options.PodName, options.Offset)
+	case WorkerIdSourceEtcd:
+		return newEtcdWorkerIdGenerator(options.Etcd)
+	case WorkerIdSourceLease:
+		return newLeaseWorkerIdGenerator(options.Lease)
+	default:
+		return nil, fmt.Errorf("unsupported worker id source: %s", options.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id < 0 || id > workeridMax {
+		return nil, fmt.Errorf("worker id %d is out of range [0, %d]", id, workeridMax)
+	}
+	return staticWorkerIdGenerator(id), nil
+}
+
+// staticWorkerIdGenerator is the worker id resolved when it is created.
+type staticWorkerIdGenerator int64
+
+func (g staticWorkerIdGenerator) Id() (int64, error) {
+	return int64(g), nil
+}
+
+func parseWorkerId(s string) (int64, error) {
+	return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+}
+
+func envWorkerId(name string) (int64, error) {
+	if name == "" {
+		name = defaultWorkerIdEnv
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return 0, fmt.Errorf("environment variable %s of the worker id is not set", name)
+	}
+	id, err := parseWorkerId(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid worker id of environment variable %s: %s", name, value)
+	}
+	return id, nil
+}
+
+func fileWorkerId(path string) (int64, error) {
+	if path == "" {
+		return 0, fmt.Errorf("the file of the worker id is required")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("read worker id: %v", err)
+	}
+	id, err := parseWorkerId(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("invalid worker id of file %s: %s", path, strings.TrimSpace(string(data)))
+	}
+	return id, nil
+}
+
+// podWorkerId returns the ordinal of the pod plus the offset, the pods of a
+// StatefulSet are named as <name>-<ordinal>.
+func podWorkerId(podName string, offset int64) (int64, error) {
+	if podName == "" {
+		podName = os.Getenv(defaultPodNameEnv)
+	}
+	if podName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return 0, fmt.Errorf("get pod name: %v", err)
+		}
+		podName = hostname
+	}
+
+	i := strings.LastIndexByte(podName, '-')
+	ordinal, err := strconv.ParseInt(podName[i+1:], 10, 64)
+	if i < 0 || err != nil {
+		return 0, fmt.Errorf("pod name %s has no ordinal of StatefulSet", podName)
+	}
+	return ordinal + offset, nil
+}
+
+// etcdWorkerIdGenerator holds the worker id allocated in etcd by a lease, which
+// is kept alive in background. The id is unavailable once the lease is lost, so
+// that it is not used by two processes. It implements io.Closer to release the
+// id. The keys and values are in base64 as the json of the grpc gateway, which
+// is how []byte is encoded by encoding/json.
+type etcdWorkerIdGenerator struct {
+	options EtcdWorkerIdOptions
+	id      int64
+	lease   string
+
+	mu     sync.Mutex
+	err    error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newEtcdWorkerIdGenerator(options EtcdWorkerIdOptions) (*etcdWorkerIdGenerator, error) {
+	if options.Endpoint == "" {
+		return nil, fmt.Errorf("the endpoint of etcd is required")
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultEtcdPrefix
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultEtcdTTL
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	options.Endpoint = strings.TrimSuffix(options.Endpoint, "/")
+
+	g := &etcdWorkerIdGenerator{options: options, done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+	if err := g.allocate(ctx); err != nil {
+		cancel()
+		// the lease may be granted before the id fails to be allocated
+		if g.lease != "" {
+			_ = g.revoke()
+		}
+		return nil, err
+	}
+	go g.keepAlive(ctx)
+	return g, nil
+}
+
+func (g *etcdWorkerIdGenerator) Id() (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return 0, g.err
+	}
+	return g.id, nil
+}
+
+// Close revokes the lease, so that the worker id could be allocated by others.
+func (g *etcdWorkerIdGenerator) Close() error {
+	g.cancel()
+	<-g.done
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err == nil {
+		g.err = fmt.Errorf("etcd worker id generator is closed")
+	}
+	return g.revoke()
+}
+
+// revoke revokes the lease with the keys attached to it.
+func (g *etcdWorkerIdGenerator) revoke() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return g.call(ctx, "/v3/lease/revoke", map[string]any{"ID": g.lease}, nil)
+}
+
+// allocate grants a lease and puts the key of the lowest free id with it, the
+// put fails if the key is created by others at the same time, and the next free
+// id is tried.
+func (g *etcdWorkerIdGenerator) allocate(ctx context.Context) error {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	ttl := int64(g.options.TTL / time.Second)
+	if err := g.call(ctx, "/v3/lease/grant", map[string]any{"TTL": strconv.FormatInt(max(ttl, 1), 10)}, &grant); err != nil {
+		return fmt.Errorf("grant etcd lease: %v", err)
+	}
+	g.lease = grant.ID
+
+	var used map[int64]bool
+	for attempt := 0; attempt < 10; attempt++ {
+		var err error
+		if used, err = g.usedIds(ctx); err != nil {
+			return err
+		}
+		for id := int64(0); id <= workeridMax; id++ {
+			if used[id] {
+				continue
+			}
+			ok, err := g.create(ctx, id)
+			if err != nil {
+				return err
+			}
+			if ok {
+				g.id = id
+				return nil
+			}
+			// the id is taken by others, the used ids are loaded again
+			break
+		}
+		if len(used) > int(workeridMax) {
+			return fmt.Errorf("no free worker id under etcd prefix %s", g.options.Prefix)
+		}
+	}
+	return fmt.Errorf("allocate worker id under etcd prefix %s: too many conflicts", g.options.Prefix)
+}
+
+// usedIds returns the worker ids of the keys under the prefix.
+func (g *etcdWorkerIdGenerator) usedIds(ctx context.Context) (map[int64]bool, error) {
+	prefix := []byte(g.options.Prefix)
+	end := append([]byte{}, prefix...)
+	end[len(end)-1]++
+
+	var resp struct {
+		Kvs []struct {
+			Key []byte `json:"key"`
+		} `json:"kvs"`
+	}
+	req := map[string]any{"key": prefix, "range_end": end, "keys_only": true}
+	if err := g.call(ctx, "/v3/kv/range", req, &resp); err != nil {
+		return nil, fmt.Errorf("list etcd worker ids: %v", err)
+	}
+	used := make(map[int64]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if id, err := strconv.ParseInt(strings.TrimPrefix(string(kv.Key), g.options.Prefix), 10, 64); err == nil {
+			used[id] = true
+		}
+	}
+	return used, nil
+}
+
+// create puts the key of the id with the lease if it does not exist.
+func (g *etcdWorkerIdGenerator) create(ctx context.Context, id int64) (bool, error) {
+	key := []byte(g.options.Prefix + strconv.FormatInt(id, 10))
+	hostname, _ := os.Hostname()
+	value := []byte(fmt.Sprintf("%s:%d", hostname, os.Getpid()))
+
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	req := map[string]any{
+		"compare": []map[string]any{{"key": key, "target": "CREATE", "result": "EQUAL", "create_revision": "0"}},
+		"success": []map[string]any{{"request_put": map[string]any{"key": key, "value": value, "lease": g.lease}}},
+	}
+	if err := g.call(ctx, "/v3/kv/txn", req, &resp); err != nil {
+		return false, fmt.Errorf("create etcd worker id %d: %v", id, err)
+	}
+	return resp.Succeeded, nil
+}
+
+// keepAlive refreshes the lease every third of the ttl, the worker id becomes
+// unavailable if the lease expires.
+func (g *etcdWorkerIdGenerator) keepAlive(ctx context.Context) {
+	defer close(g.done)
+
+	ticker := time.NewTicker(g.options.TTL / 3)
+	defer ticker.Stop()
+	deadline := time.Now().Add(g.options.TTL)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var resp struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		err := g.call(ctx, "/v3/lease/keepalive", map[string]any{"ID": g.lease}, &resp)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			ttl, _ := strconv.ParseInt(resp.Result.TTL, 10, 64)
+			if ttl > 0 {
+				deadline = time.Now().Add(time.Duration(ttl) * time.Second)
+				continue
+			}
+			err = fmt.Errorf("lease %s is expired", g.lease)
+		} else if time.Now().Before(deadline) {
+			// the lease may still be alive after a failed request
+			continue
+		}
+		g.mu.Lock()
+		g.err = fmt.Errorf("etcd worker id %d is lost: %v", g.id, err)
+		g.mu.Unlock()
+		return
+	}
+}
+
+// call posts the request in json to the grpc gateway of etcd.
+func (g *etcdWorkerIdGenerator) call(ctx context.Context, path string, req, resp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.options.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := g.options.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(httpResp.Body).Decode(&e)
+		return fmt.Errorf("etcd %s: %s %s", path, httpResp.Status, e.Message)
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(httpResp.Body).Decode(resp)
+}
@@ -0,0 +1,273 @@
+package snowflake
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWorkerIdGenerator(t *testing.T) {
+	t.Setenv("WORKER_ID", "12")
+	t.Setenv("MY_WORKER_ID", " 34\n")
+	t.Setenv("BAD_WORKER_ID", "abc")
+	t.Setenv("POD_NAME", "gamesvr-7")
+
+	idFile := filepath.Join(t.TempDir(), "worker_id")
+	if err := os.WriteFile(idFile, []byte("56\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bigFile := filepath.Join(t.TempDir(), "worker_id")
+	if err := os.WriteFile(bigFile, []byte("65536"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCase := []struct {
+		name      string
+		options   WorkerIdOptions
+		expectId  int64
+		expectErr bool
+	}{
+		{"env default", WorkerIdOptions{Source: WorkerIdSourceEnv}, 12, false},
+		{"env custom", WorkerIdOptions{Source: WorkerIdSourceEnv, Env: "MY_WORKER_ID"}, 34, false},
+		{"env invalid", WorkerIdOptions{Source: WorkerIdSourceEnv, Env: "BAD_WORKER_ID"}, 0, true},
+		{"env not set", WorkerIdOptions{Source: WorkerIdSourceEnv, Env: "NONEXISTENCE_WORKER_ID"}, 0, true},
+		{"file", WorkerIdOptions{Source: WorkerIdSourceFile, File: idFile}, 56, false},
+		{"file out of range", WorkerIdOptions{Source: WorkerIdSourceFile, File: bigFile}, 0, true},
+		{"file not found", WorkerIdOptions{Source: WorkerIdSourceFile, File: idFile + ".nonexistence"}, 0, true},
+		{"pod env", WorkerIdOptions{Source: WorkerIdSourcePod}, 7, false},
+		{"pod name with offset", WorkerIdOptions{Source: WorkerIdSourcePod, PodName: "battlesvr-web-3", Offset: 100}, 103, false},
+		{"pod without ordinal", WorkerIdOptions{Source: WorkerIdSourcePod, PodName: "gamesvr-6d5f8"}, 0, true},
+		{"etcd without endpoint", WorkerIdOptions{Source: WorkerIdSourceEtcd}, 0, true},
+		{"zookeeper", WorkerIdOptions{Source: "zookeeper"}, 0, true},
+	}
+
+	for _, tc := range testCase {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := NewWorkerIdGenerator(tc.options)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			id, err := g.Id()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectId, id)
+		})
+	}
+
+	g, err := NewWorkerIdGenerator(WorkerIdOptions{})
+	if assert.NoError(t, err) {
+		assert.IsType(t, &localIPWorkerIdGenerator{}, g)
+	}
+}
+
+// etcdServer is a fake grpc gateway of etcd for the worker ids.
+type etcdServer struct {
+	mu        sync.Mutex
+	kvs       map[string]string
+	leases    map[string]bool
+	nextLease int
+	keepAlive int
+	// expired makes the keepalive report the lease is expired
+	expired bool
+	// conflict makes the puts fail as the keys are created by others
+	conflict bool
+}
+
+func (s *etcdServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var req struct {
+		ID       string `json:"ID"`
+		Key      []byte `json:"key"`
+		RangeEnd []byte `json:"range_end"`
+		Compare  []struct {
+			Key []byte `json:"key"`
+		} `json:"compare"`
+		Success []struct {
+			RequestPut struct {
+				Key   []byte `json:"key"`
+				Lease string `json:"lease"`
+			} `json:"request_put"`
+		} `json:"success"`
+	}
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var resp any
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		s.nextLease++
+		id := strconv.Itoa(s.nextLease)
+		s.leases[id] = true
+		resp = map[string]string{"ID": id, "TTL": "3"}
+	case "/v3/lease/keepalive":
+		s.keepAlive++
+		ttl := "3"
+		if s.expired || !s.leases[req.ID] {
+			ttl = "0"
+		}
+		resp = map[string]any{"result": map[string]string{"ID": req.ID, "TTL": ttl}}
+	case "/v3/lease/revoke":
+		delete(s.leases, req.ID)
+		for k, lease := range s.kvs {
+			if lease == req.ID {
+				delete(s.kvs, k)
+			}
+		}
+		resp = map[string]any{}
+	case "/v3/kv/range":
+		var kvs []map[string][]byte
+		for k := range s.kvs {
+			if k >= string(req.Key) && k < string(req.RangeEnd) {
+				kvs = append(kvs, map[string][]byte{"key": []byte(k)})
+			}
+		}
+		resp = map[string]any{"kvs": kvs}
+	case "/v3/kv/txn":
+		key := string(req.Compare[0].Key)
+		_, exists := s.kvs[key]
+		exists = exists || s.conflict
+		if !exists {
+			s.kvs[key] = req.Success[0].RequestPut.Lease
+		}
+		resp = map[string]bool{"succeeded": !exists}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestEtcdWorkerIdGenerator(t *testing.T) {
+	s := &etcdServer{kvs: map[string]string{"/test/0": "other", "/test/2": "other", "/other/1": "other"}, leases: map[string]bool{}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	options := WorkerIdOptions{Source: WorkerIdSourceEtcd, Etcd: EtcdWorkerIdOptions{Endpoint: srv.URL + "/", Prefix: "/test/", TTL: 300 * time.Millisecond}}
+	ids := make([]int64, 0, 2)
+	var generators []WorkerIdGenerator
+	for i := 0; i < 2; i++ {
+		g, err := NewWorkerIdGenerator(options)
+		if !assert.NoError(t, err) {
+			return
+		}
+		id, err := g.Id()
+		assert.NoError(t, err)
+		ids = append(ids, id)
+		generators = append(generators, g)
+	}
+	// the lowest free ids are allocated
+	assert.Equal(t, []int64{1, 3}, ids)
+
+	// the lease is kept alive
+	time.Sleep(250 * time.Millisecond)
+	s.mu.Lock()
+	assert.Greater(t, s.keepAlive, 0)
+	s.mu.Unlock()
+	_, err := generators[0].Id()
+	assert.NoError(t, err)
+
+	// the id is released after closing
+	assert.NoError(t, generators[0].(io.Closer).Close())
+	_, err = generators[0].Id()
+	assert.Error(t, err)
+	s.mu.Lock()
+	_, ok := s.kvs["/test/1"]
+	s.expired = true
+	s.mu.Unlock()
+	assert.False(t, ok)
+
+	// the id is unavailable after the lease is expired
+	assert.Eventually(t, func() bool {
+		_, err := generators[1].Id()
+		return err != nil && strings.Contains(err.Error(), "lost")
+	}, 2*time.Second, 10*time.Millisecond)
+	_ = generators[1].(io.Closer).Close()
+
+	// the lease is revoked if no id is allocated
+	s.mu.Lock()
+	s.conflict = true
+	s.mu.Unlock()
+	_, err = NewWorkerIdGenerator(options)
+	assert.ErrorContains(t, err, "too many conflicts")
+	s.mu.Lock()
+	assert.Empty(t, s.leases)
+	s.mu.Unlock()
+}
+
+func TestLeaseWorkerIdGenerator(t *testing.T) {
+	dir := t.TempDir()
+	// the stale lease is taken over and the fresh one is skipped
+	stale := filepath.Join(dir, "0.lease")
+	if err := os.WriteFile(stale, []byte("crashed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "1.lease"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := WorkerIdOptions{Source: WorkerIdSourceLease, Lease: LeaseWorkerIdOptions{Dir: dir, TTL: 300 * time.Millisecond}}
+	ids := make([]int64, 0, 2)
+	var generators []WorkerIdGenerator
+	for i := 0; i < 2; i++ {
+		g, err := NewWorkerIdGenerator(options)
+		if !assert.NoError(t, err) {
+			return
+		}
+		id, err := g.Id()
+		assert.NoError(t, err)
+		ids = append(ids, id)
+		generators = append(generators, g)
+	}
+	assert.Equal(t, []int64{0, 2}, ids)
+
+	// the lease is refreshed
+	time.Sleep(400 * time.Millisecond)
+	_, err := generators[0].Id()
+	assert.NoError(t, err)
+	info, err := os.Stat(stale)
+	if assert.NoError(t, err) {
+		assert.Less(t, time.Since(info.ModTime()), 300*time.Millisecond)
+	}
+
+	// the lease file is removed after closing
+	assert.NoError(t, generators[0].(io.Closer).Close())
+	_, err = generators[0].Id()
+	assert.Error(t, err)
+	assert.NoFileExists(t, stale)
+
+	// the id is unavailable after the lease is taken over
+	if err := os.WriteFile(filepath.Join(dir, "2.lease"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		_, err := generators[1].Id()
+		return err != nil && strings.Contains(err.Error(), "lost")
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, generators[1].(io.Closer).Close())
+	assert.FileExists(t, filepath.Join(dir, "2.lease"))
+
+	_, err = NewWorkerIdGenerator(WorkerIdOptions{Source: WorkerIdSourceLease})
+	assert.Error(t, err)
+}